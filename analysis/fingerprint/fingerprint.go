@@ -0,0 +1,371 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fingerprint computes stable references to AST nodes, which can be
+// recorded (e.g., in the journal) and resolved to the same nodes later, even
+// after the code has been reformatted or edited.
+//
+// A node is identified by the import path of its package, the path of
+// declarations leading to it, and a hash of the type of the declared entity,
+// rather than by its position.  The string form of a Fingerprint is
+//
+//	<package>#<declaration path>@<signature>[~<node>]
+//
+// for example,
+//
+//	example.com/shapes#Circle.Area@9f86d081
+//	example.com/shapes#Circle.Area/r@2c26b46b
+//	example.com/shapes#main@5feceb66~CallExpr:6b86b273:1
+//
+// The declaration path names a top-level declaration: a function, a method
+// (qualified by its receiver's type name), a type, a variable, or a constant.
+// It may be followed by the name of an object declared inside it (e.g., a
+// local variable), with a suffix :n if it is the nth (counting from 0) such
+// object with that name.  A fingerprint without a node part refers to the
+// name in the last declaration.  Any other node in a top-level declaration is
+// identified by its kind, a hash of its source code (as formatted by
+// go/printer, so whitespace and comments are not significant), and a suffix
+// :n if it is the nth (counting from 0) node in the declaration with the same
+// kind and source code.
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// A Fingerprint is a stable reference to an AST node.
+type Fingerprint struct {
+	// The import path of the package containing the node
+	Package string
+	// The name of the top-level declaration containing the node, followed
+	// (optionally) by the name of an object declared inside it
+	Decl []string
+	// A hash of the type of the object named by the last element of Decl
+	Signature string
+	// If nonempty, identifies a node in the top-level declaration other
+	// than the declared name
+	Node string
+}
+
+func (f *Fingerprint) String() string {
+	result := fmt.Sprintf("%s#%s@%s", f.Package, strings.Join(f.Decl, "/"),
+		f.Signature)
+	if f.Node != "" {
+		result += "~" + f.Node
+	}
+	return result
+}
+
+// Parse converts the string form of a Fingerprint (see String) to a
+// Fingerprint.
+func Parse(s string) (*Fingerprint, error) {
+	hash := strings.Index(s, "#")
+	at := strings.LastIndex(s, "@")
+	if hash <= 0 || at < hash+2 {
+		return nil, fmt.Errorf("invalid fingerprint %q", s)
+	}
+	result := &Fingerprint{
+		Package:   s[:hash],
+		Decl:      strings.Split(s[hash+1:at], "/"),
+		Signature: s[at+1:],
+	}
+	if tilde := strings.Index(result.Signature, "~"); tilde >= 0 {
+		result.Signature, result.Node =
+			result.Signature[:tilde], result.Signature[tilde+1:]
+	}
+	if len(result.Decl) > 2 || result.Signature == "" {
+		return nil, fmt.Errorf("invalid fingerprint %q", s)
+	}
+	return result, nil
+}
+
+// Of returns a Fingerprint for the first node in the given path (as returned
+// by (*loader.Program).PathEnclosingInterval), or nil if it is not in a
+// top-level declaration that can be fingerprinted (e.g., it is in an import
+// declaration).  A function, type, variable, or constant declaration is
+// identified by its name (i.e., it has the same Fingerprint as its name).
+func Of(pkgInfo *loader.PackageInfo, fset *token.FileSet, path []ast.Node) *Fingerprint {
+	if len(path) < 2 {
+		return nil
+	}
+	decl, name := declaration(path[len(path)-2], path[0])
+	if name == nil {
+		return nil
+	}
+	obj := pkgInfo.Defs[name]
+	if obj == nil {
+		return nil
+	}
+	result := &Fingerprint{
+		Package:   pkgInfo.Pkg.Path(),
+		Decl:      []string{declName(name, obj)},
+		Signature: signature(obj),
+	}
+	if path[0] == decl || path[0] == path[len(path)-2] || path[0] == name {
+		return result
+	}
+	if node, ok := path[0].(*ast.Ident); ok {
+		if local := pkgInfo.Defs[node]; local != nil && local.Pkg() != nil &&
+			local.Parent() != local.Pkg().Scope() {
+			n := indexOf(node, localDefs(pkgInfo, decl, node.Name))
+			result.Decl = append(result.Decl, withIndex(node.Name, n))
+			result.Signature = signature(local)
+			return result
+		}
+	}
+	kind, hash := nodeKind(path[0]), nodeHash(fset, path[0])
+	n := indexOf(path[0], matchingNodes(fset, decl, kind, hash))
+	result.Node = withIndex(kind+":"+hash, n)
+	return result
+}
+
+// A Target is the node a Fingerprint refers to.
+type Target struct {
+	// The package and file containing the node
+	Package *loader.PackageInfo
+	File    *ast.File
+	// The node
+	Node ast.Node
+	// True iff the type of the declared object has changed since the
+	// Fingerprint was computed (e.g., a function's parameters changed)
+	SignatureChanged bool
+}
+
+// Resolve returns the node in the given program referred to by the given
+// Fingerprint, or an error if there is no such node.
+func Resolve(fp *Fingerprint, prog *loader.Program) (*Target, error) {
+	var pkgInfo *loader.PackageInfo
+	for pkg, info := range prog.AllPackages {
+		if pkg.Path() == fp.Package {
+			pkgInfo = info
+		}
+	}
+	if pkgInfo == nil {
+		return nil, fmt.Errorf("package %s was not found", fp.Package)
+	}
+	result := &Target{Package: pkgInfo}
+	var decl ast.Node
+	var name *ast.Ident
+	for _, file := range pkgInfo.Files {
+		if decl, name = findDecl(pkgInfo, file, fp.Decl[0]); name != nil {
+			result.File = file
+			break
+		}
+	}
+	if name == nil {
+		return nil, fmt.Errorf("%s was not found in package %s",
+			fp.Decl[0], fp.Package)
+	}
+
+	result.Node = name
+	if len(fp.Decl) > 1 {
+		localName, n := splitIndex(fp.Decl[1])
+		defs := localDefs(pkgInfo, decl, localName)
+		if n >= len(defs) {
+			return nil, fmt.Errorf("%s was not found in %s", fp.Decl[1],
+				fp.Decl[0])
+		}
+		result.Node = defs[n]
+	}
+	obj := pkgInfo.Defs[result.Node.(*ast.Ident)]
+	result.SignatureChanged = obj == nil || signature(obj) != fp.Signature
+
+	if fp.Node != "" {
+		parts := strings.Split(fp.Node, ":")
+		n := 0
+		if len(parts) == 3 {
+			n, _ = strconv.Atoi(parts[2])
+		} else if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid node %q", fp.Node)
+		}
+		nodes := matchingNodes(prog.Fset, decl, parts[0], parts[1])
+		if n >= len(nodes) {
+			return nil, fmt.Errorf("the selected %s was not found in %s",
+				parts[0], fp.Decl[0])
+		}
+		result.Node = nodes[n]
+	}
+	return result, nil
+}
+
+// declaration returns the given node and the name it declares if it is a
+// top-level function, type, variable, or constant declaration.  For a
+// GenDecl, the spec containing the selected node (or the first spec) is
+// returned instead.  For a ValueSpec declaring several names, the name
+// containing the selected node is returned, or the first name.
+func declaration(node, selected ast.Node) (ast.Node, *ast.Ident) {
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		return node, node.Name
+	case *ast.TypeSpec:
+		return node, node.Name
+	case *ast.ValueSpec:
+		for _, name := range node.Names {
+			if name.Pos() <= selected.Pos() && selected.End() <= name.End() {
+				return node, name
+			}
+		}
+		return node, node.Names[0]
+	case *ast.GenDecl:
+		if len(node.Specs) == 0 || node.Tok == token.IMPORT {
+			return nil, nil
+		}
+		for _, spec := range node.Specs {
+			if spec.Pos() <= selected.Pos() && selected.End() <= spec.End() {
+				return declaration(spec, selected)
+			}
+		}
+		return declaration(node.Specs[0], selected)
+	}
+	return nil, nil
+}
+
+// declName returns the name of the given top-level declaration in a
+// declaration path: its name, qualified by its receiver's type name if it is
+// a method.
+func declName(name *ast.Ident, obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			t := recv.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if named, ok := t.(*types.Named); ok {
+				return named.Obj().Name() + "." + name.Name
+			}
+		}
+	}
+	return name.Name
+}
+
+// findDecl returns the top-level declaration in the given file with the given
+// name in a declaration path (see declName), and the name it declares.
+func findDecl(pkgInfo *loader.PackageInfo, file *ast.File, name string) (ast.Node, *ast.Ident) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if obj := pkgInfo.Defs[decl.Name]; obj != nil &&
+				declName(decl.Name, obj) == name {
+				return decl, decl.Name
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.Name == name {
+						return spec, spec.Name
+					}
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						if id.Name == name {
+							return spec, id
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// localDefs returns the identifiers declaring objects with the given name
+// inside the given declaration (other than its own name), in order by
+// position.
+func localDefs(pkgInfo *loader.PackageInfo, decl ast.Node, name string) []ast.Node {
+	result := []ast.Node{}
+	for id, obj := range pkgInfo.Defs {
+		if id.Name == name && obj != nil && decl.Pos() <= id.Pos() &&
+			id.End() <= decl.End() && obj.Pkg() != nil &&
+			obj.Parent() != obj.Pkg().Scope() {
+			result = append(result, id)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pos() < result[j].Pos()
+	})
+	return result
+}
+
+// matchingNodes returns the nodes in the given declaration with the given
+// kind and hash (see nodeKind and nodeHash), in the order ast.Inspect visits
+// them.
+func matchingNodes(fset *token.FileSet, decl ast.Node, kind, hash string) []ast.Node {
+	result := []ast.Node{}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if n != nil && nodeKind(n) == kind && nodeHash(fset, n) == hash {
+			result = append(result, n)
+		}
+		return true
+	})
+	return result
+}
+
+// indexOf returns the index of the given node in the given list, or 0 if it
+// is not present.
+func indexOf(node ast.Node, nodes []ast.Node) int {
+	for i, n := range nodes {
+		if n == node {
+			return i
+		}
+	}
+	return 0
+}
+
+// withIndex appends the suffix :n to the given string, unless n is 0.
+func withIndex(s string, n int) string {
+	if n == 0 {
+		return s
+	}
+	return fmt.Sprintf("%s:%d", s, n)
+}
+
+// splitIndex splits a name in a declaration path with an optional :n suffix
+// (see withIndex) into the name and n.
+func splitIndex(s string) (string, int) {
+	if colon := strings.LastIndex(s, ":"); colon >= 0 {
+		if n, err := strconv.Atoi(s[colon+1:]); err == nil {
+			return s[:colon], n
+		}
+	}
+	return s, 0
+}
+
+// nodeKind returns the name of the node's type, e.g., CallExpr.
+func nodeKind(node ast.Node) string {
+	return reflect.Indirect(reflect.ValueOf(node)).Type().Name()
+}
+
+// nodeHash returns a hash of the node's source code, as formatted by
+// go/printer.
+func nodeHash(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return hash(buf.String())
+}
+
+// signature returns a hash of the type of the given object.
+func signature(obj types.Object) string {
+	return hash(types.TypeString(obj.Type(), types.RelativeTo(obj.Pkg())))
+}
+
+// hash returns the first 8 hexadecimal digits of the SHA-256 hash of s.
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fingerprint_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/fingerprint"
+
+	"golang.org/x/tools/go/loader"
+)
+
+const original = `package shapes
+
+import "math"
+
+type Circle struct{ r float64 }
+
+func (c *Circle) Area() float64 {
+	r := c.r
+	return math.Pi * r * r
+}
+
+var (
+	unit  = Circle{1}
+	big   = Circle{100}
+)
+
+func main() {
+	println(unit.Area())
+	for r := 0; r < 3; r++ {
+		println(big.Area())
+		println(unit.Area())
+	}
+}
+`
+
+// edited is original, reformatted, with declarations reordered, and with
+// code added before each of the nodes in the tests
+const edited = `package shapes
+
+import (
+	"fmt"
+	"math"
+)
+
+var (
+	zero = Circle{0}
+	unit = Circle{1}
+	big  = Circle{100}
+)
+
+// main prints some areas
+func main() {
+	fmt.Println("areas")
+	println(unit.Area())
+	for r := 0; r < 3; r++ { println(big.Area()); println(unit.Area()) }
+}
+
+type Circle struct {
+	r float64
+}
+
+func (c *Circle) Area() float64 {
+	r := c.r   // the radius
+	return math.Pi * r * r
+}
+`
+
+func load(t *testing.T, src string) *loader.Program {
+	var config loader.Config
+	config.ParserMode = parser.ParseComments
+	file, err := config.ParseFile("shapes.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.CreateFromFiles("example.com/shapes", file)
+	prog, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+// find returns the path to the nth (counting from 0) node in the given
+// program whose source code (formatted by go/printer) is text.
+func find(t *testing.T, prog *loader.Program, text string, n int) (*loader.PackageInfo, []ast.Node) {
+	pkgInfo := prog.Created[0]
+	var result ast.Node
+	ast.Inspect(pkgInfo.Files[0], func(node ast.Node) bool {
+		if node != nil && result == nil && format(prog, node) == text {
+			if n == 0 {
+				result = node
+			}
+			n--
+		}
+		return true
+	})
+	if result == nil {
+		t.Fatalf("%s not found", text)
+	}
+	_, path, _ := prog.PathEnclosingInterval(result.Pos(), result.End())
+	for path[0] != result {
+		path = path[1:]
+	}
+	return pkgInfo, path
+}
+
+func format(prog *loader.Program, node ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, prog.Fset, node)
+	return buf.String()
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		text string
+		// The node is the nth node with the given text in original and
+		// the editedNth in edited
+		n, editedN int
+		expected   string // Fingerprint, without the hashes
+	}{
+		{"Area", 0, 3, "example.com/shapes#Circle.Area@"},
+		{"Circle", 0, 3, "example.com/shapes#Circle@"},
+		{"big", 0, 0, "example.com/shapes#big@"},
+		{"r", 1, 4, "example.com/shapes#Circle.Area/r@"},
+		{"r", 5, 0, "example.com/shapes#main/r@"},
+		{"math.Pi * r * r", 0, 0, "example.com/shapes#Circle.Area@~BinaryExpr:"},
+		{"unit.Area()", 1, 1, "example.com/shapes#main@~CallExpr::1"},
+		{"println(big.Area())", 0, 0, "example.com/shapes#main@~ExprStmt:"},
+	}
+	prog := load(t, original)
+	editedProg := load(t, edited)
+	for _, test := range tests {
+		pkgInfo, path := find(t, prog, test.text, test.n)
+		fp := fingerprint.Of(pkgInfo, prog.Fset, path)
+		if fp == nil {
+			t.Fatalf("No fingerprint for %s", test.text)
+		}
+		s := fp.String()
+		withoutHashes := s
+		for _, h := range []string{fp.Signature, strings.Split(fp.Node+":", ":")[1]} {
+			if h != "" {
+				withoutHashes = strings.Replace(withoutHashes, h, "", 1)
+			}
+		}
+		if withoutHashes != test.expected {
+			t.Errorf("Fingerprint of %s: expected %s; got %s",
+				test.text, test.expected, s)
+			continue
+		}
+
+		parsed, err := fingerprint.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.String() != s {
+			t.Fatalf("Parse(%s).String() returned %s", s, parsed)
+		}
+		target, err := fingerprint.Resolve(parsed, editedProg)
+		if err != nil {
+			t.Fatalf("Resolving %s: %s", s, err)
+		}
+		_, expectedPath := find(t, editedProg, test.text, test.editedN)
+		if target.Node != expectedPath[0] || target.SignatureChanged {
+			t.Errorf("%s resolved to %s at %s (signature changed: %v)",
+				s, format(editedProg, target.Node),
+				editedProg.Fset.Position(target.Node.Pos()),
+				target.SignatureChanged)
+		}
+	}
+
+	// Naming a function's result changes its signature
+	changedProg := load(t, strings.Replace(original,
+		"Area() float64", "Area() (area float64)", 1))
+	pkgInfo, path := find(t, prog, "Area", 0)
+	target, err := fingerprint.Resolve(
+		fingerprint.Of(pkgInfo, prog.Fset, path), changedProg)
+	if err != nil || !target.SignatureChanged {
+		t.Errorf("Expected the signature of Area to change (%v)", err)
+	}
+
+	// Nodes that were removed cannot be resolved
+	pkgInfo, path = find(t, prog, "println(big.Area())", 0)
+	fp := fingerprint.Of(pkgInfo, prog.Fset, path)
+	removedProg := load(t, strings.Replace(original,
+		"println(big.Area())", "println(big.r)", 1))
+	if _, err := fingerprint.Resolve(fp, removedProg); err == nil {
+		t.Errorf("Expected %s not to be resolved", fp)
+	}
+
+	for _, s := range []string{"", "shapes", "#main@1234", "shapes#main@",
+		"shapes#a/b/c@1234"} {
+		if _, err := fingerprint.Parse(s); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", s)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains a purely syntactic analysis that suggests how an import
+// cycle can be broken by moving declarations into a new package.
+
+package imports
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Decomposition describes how to remove one import edge From → To from the
+// import graph: the declarations in To that are referenced by From (along with
+// the declarations they depend on within To) are moved into a new package,
+// which both From and To can then import.
+type Decomposition struct {
+	// The importing package
+	From string
+	// The imported package
+	To string
+	// Names of the top-level declarations in To that must be moved to a
+	// new package, sorted.  Methods are included in the form Type.Method.
+	Decls []string
+	// Import paths of packages referenced by the moved declarations that
+	// (transitively) import From.  If this is nonempty, the new package
+	// would still be part of an import cycle, so the decomposition is
+	// not feasible as given.
+	Blocking []string
+}
+
+// Feasible returns true iff moving the declarations into a new package would
+// not itself introduce an import cycle.
+func (d *Decomposition) Feasible() bool {
+	return len(d.Blocking) == 0
+}
+
+func (d *Decomposition) String() string {
+	result := fmt.Sprintf("Break %s -> %s by moving to a new package: %s",
+		d.From, d.To, strings.Join(d.Decls, ", "))
+	if !d.Feasible() {
+		result += fmt.Sprintf(" (not feasible: still depends on %s)",
+			strings.Join(d.Blocking, ", "))
+	}
+	return result
+}
+
+// SuggestBreaks returns a Decomposition for each edge of the given import
+// cycle (as returned by Cycles or WouldCycle).  Feasible decompositions are
+// listed first, and decompositions requiring fewer declarations to be moved
+// are listed before those requiring more.
+func (g *Graph) SuggestBreaks(cycle []string) ([]*Decomposition, error) {
+	result := []*Decomposition{}
+	for i, from := range cycle {
+		to := cycle[(i+1)%len(cycle)]
+		if from == to {
+			continue
+		}
+		d, err := g.Decompose(from, to)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	sort.Stable(byCost(result))
+	return result, nil
+}
+
+// Decompose determines which declarations in the package to would need to be
+// moved into a new package in order for the package from to no longer import
+// it.
+func (g *Graph) Decompose(from, to string) (*Decomposition, error) {
+	fromPkg, err := g.parse(from)
+	if err != nil {
+		return nil, err
+	}
+	toPkg, err := g.parse(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the names in to that are referenced from from
+	referenced := map[string]bool{}
+	for _, f := range fromPkg.files {
+		localName := fromPkg.localNames[f][to]
+		if localName == "" || localName == "_" {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok && x.Name == localName {
+					referenced[sel.Sel.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	// Compute the closure of those declarations within to
+	moved := map[string]bool{}
+	worklist := []string{}
+	for name := range referenced {
+		worklist = append(worklist, name)
+	}
+	blocking := map[string]bool{}
+	for len(worklist) > 0 {
+		name := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if moved[name] {
+			continue
+		}
+		decls, ok := toPkg.decls[name]
+		if !ok {
+			continue
+		}
+		moved[name] = true
+		for _, d := range decls {
+			for dep := range toPkg.referencedTopLevelNames(d.node) {
+				if !moved[dep] {
+					worklist = append(worklist, dep)
+				}
+			}
+			for _, path := range toPkg.referencedImports(d) {
+				if path == from || g.WouldCycle(from, path) != nil {
+					blocking[path] = true
+				}
+			}
+		}
+	}
+
+	result := &Decomposition{From: from, To: to}
+	for name := range moved {
+		for _, d := range toPkg.decls[name] {
+			result.Decls = append(result.Decls, d.describe(name))
+		}
+	}
+	sort.Strings(result.Decls)
+	for path := range blocking {
+		result.Blocking = append(result.Blocking, path)
+	}
+	sort.Strings(result.Blocking)
+	return result, nil
+}
+
+// byCost sorts Decompositions so that feasible decompositions come first, then
+// by the number of declarations that must be moved.
+type byCost []*Decomposition
+
+func (s byCost) Len() int      { return len(s) }
+func (s byCost) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCost) Less(i, j int) bool {
+	if s[i].Feasible() != s[j].Feasible() {
+		return s[i].Feasible()
+	}
+	return len(s[i].Decls) < len(s[j].Decls)
+}
+
+// A parsedPackage contains the ASTs for the (non-test) files in a package, as
+// well as an index of its top-level declarations.
+type parsedPackage struct {
+	files []*ast.File
+	// localNames maps each file to a map from import paths to the names
+	// by which those packages are referenced in that file
+	localNames map[*ast.File]map[string]string
+	// decls maps top-level names to their declarations.  A type name maps
+	// to the type declaration and all of the methods on that type.
+	decls map[string][]*topLevelDecl
+}
+
+// A topLevelDecl is a top-level declaration (or a method) in a file.
+type topLevelDecl struct {
+	file   *ast.File
+	node   ast.Node
+	method string // Method name, if this is a method; otherwise, ""
+}
+
+func (d *topLevelDecl) describe(name string) string {
+	if d.method != "" {
+		return name + "." + d.method
+	}
+	return name
+}
+
+// parse parses the non-test Go files in the package with the given import
+// path, which must be in the graph.
+func (g *Graph) parse(path string) (*parsedPackage, error) {
+	bp, ok := g.pkgs[path]
+	if !ok {
+		return nil, fmt.Errorf("package %s is not in the import graph", path)
+	}
+	result := &parsedPackage{
+		localNames: map[*ast.File]map[string]string{},
+		decls:      map[string][]*topLevelDecl{},
+	}
+	fset := token.NewFileSet()
+	for _, name := range bp.GoFiles {
+		filename := filepath.Join(bp.Dir, name)
+		reader, err := g.openFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, filename, reader, 0)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		result.files = append(result.files, f)
+		result.localNames[f] = g.localNames(bp, f)
+		result.indexDecls(f)
+	}
+	return result, nil
+}
+
+// localNames returns a map from the import paths imported by the given file
+// to the names used to refer to them in that file.
+func (g *Graph) localNames(bp *build.Package, f *ast.File) map[string]string {
+	result := map[string]string{}
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		imp, err := g.ctxt.Import(path, bp.Dir, 0)
+		if err == nil {
+			path = imp.ImportPath
+		}
+		if spec.Name != nil {
+			result[path] = spec.Name.Name
+		} else if err == nil {
+			result[path] = imp.Name
+		} else {
+			result[path] = filepath.Base(path)
+		}
+	}
+	return result
+}
+
+// indexDecls adds the top-level declarations in the given file to the index.
+func (p *parsedPackage) indexDecls(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				p.add(decl.Name.Name, &topLevelDecl{f, decl, ""})
+			} else if recv := receiverTypeName(decl.Recv.List[0].Type); recv != "" {
+				p.add(recv, &topLevelDecl{f, decl, decl.Name.Name})
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					p.add(spec.Name.Name, &topLevelDecl{f, spec, ""})
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						p.add(name.Name, &topLevelDecl{f, spec, ""})
+					}
+				}
+			}
+		}
+	}
+}
+
+func (p *parsedPackage) add(name string, d *topLevelDecl) {
+	if name != "_" {
+		p.decls[name] = append(p.decls[name], d)
+	}
+}
+
+// receiverTypeName returns the name of the type in a method receiver, e.g.,
+// T for a receiver of type T or *T.
+func receiverTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(expr.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// referencedTopLevelNames returns the set of identifiers in the given node
+// that (syntactically) may refer to top-level declarations in this package.
+// Field and method selectors are excluded; local declarations that shadow
+// top-level names are not detected, so the result may be conservative.
+func (p *parsedPackage) referencedTopLevelNames(node ast.Node) map[string]bool {
+	result := map[string]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					if _, ok := p.decls[id.Name]; ok {
+						result[id.Name] = true
+					}
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			if _, ok := p.decls[n.Name]; ok {
+				result[n.Name] = true
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// referencedImports returns the import paths of the packages referenced
+// (via qualified identifiers) in the given declaration.
+func (p *parsedPackage) referencedImports(d *topLevelDecl) []string {
+	byName := map[string]string{}
+	for path, name := range p.localNames[d.file] {
+		byName[name] = path
+	}
+	seen := map[string]bool{}
+	result := []string{}
+	ast.Inspect(d.node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if path, ok := byName[x.Name]; ok && !seen[path] {
+					seen[path] = true
+					result = append(result, path)
+				}
+			}
+		}
+		return true
+	})
+	sort.Strings(result)
+	return result
+}
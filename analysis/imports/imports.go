@@ -0,0 +1,286 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package imports analyzes the import graph of a Go workspace.  It can detect
+// import cycles, determine whether adding an import would introduce a cycle,
+// and suggest which declarations could be moved into a new package to break a
+// cycle.
+//
+// The import graph is constructed using go/build rather than go/loader, so it
+// can be computed even when the workspace contains import cycles (which
+// prevent it from being type checked).
+package imports
+
+import (
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Graph is the import graph of a set of packages and all of the packages
+// they (transitively) import, excluding packages in $GOROOT.
+type Graph struct {
+	ctxt *build.Context
+	// Imports maps the import path of each package in the graph to the
+	// sorted import paths of the packages it imports.  Packages in $GOROOT
+	// are omitted.
+	Imports map[string][]string
+	// pkgs maps import paths to packages, as found by go/build
+	pkgs map[string]*build.Package
+}
+
+// NewGraph constructs the import graph for the given packages.  Each root may
+// be either an import path or the name of a .go file, in which case the
+// package in the directory containing that file is used.
+//
+// If ctxt is nil, build.Default is used.
+func NewGraph(ctxt *build.Context, roots []string) (*Graph, error) {
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+	g := &Graph{
+		ctxt:    ctxt,
+		Imports: map[string][]string{},
+		pkgs:    map[string]*build.Package{},
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		var pkg *build.Package
+		if strings.HasSuffix(root, ".go") {
+			var dir string
+			dir, err = filepath.Abs(filepath.Dir(root))
+			if err != nil {
+				return nil, err
+			}
+			pkg, err = ctxt.ImportDir(dir, 0)
+		} else {
+			pkg, err = ctxt.Import(root, cwd, 0)
+		}
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				continue
+			}
+			return nil, err
+		}
+		if err := g.add(pkg); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// add adds the given package and all of its non-$GOROOT dependencies to the
+// graph.
+func (g *Graph) add(pkg *build.Package) error {
+	if _, ok := g.pkgs[pkg.ImportPath]; ok {
+		return nil
+	}
+	g.pkgs[pkg.ImportPath] = pkg
+	g.Imports[pkg.ImportPath] = []string{}
+	for _, path := range pkg.Imports {
+		if path == "C" {
+			continue
+		}
+		imp, err := g.ctxt.Import(path, pkg.Dir, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				continue
+			}
+			// Missing packages are reported by the type checker;
+			// they cannot participate in a cycle
+			continue
+		}
+		if imp.Goroot {
+			continue
+		}
+		g.Imports[pkg.ImportPath] = append(g.Imports[pkg.ImportPath],
+			imp.ImportPath)
+		if err := g.add(imp); err != nil {
+			return err
+		}
+	}
+	sort.Strings(g.Imports[pkg.ImportPath])
+	return nil
+}
+
+// Packages returns the import paths of all packages in the graph, sorted.
+func (g *Graph) Packages() []string {
+	result := make([]string, 0, len(g.Imports))
+	for path := range g.Imports {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Cycles returns one import cycle for each strongly connected component of
+// the import graph that contains a cycle.  Each cycle is given as a sequence
+// of import paths [p1, p2, ..., pn] where p1 imports p2, p2 imports p3, ...,
+// and pn imports p1.  Each cycle begins with its lexicographically smallest
+// import path, and the cycles are sorted, so the result is deterministic.
+func (g *Graph) Cycles() [][]string {
+	result := [][]string{}
+	for _, scc := range g.stronglyConnectedComponents() {
+		first := scc[0]
+		if len(scc) == 1 && !g.imports(first, first) {
+			continue
+		}
+		inSCC := map[string]bool{}
+		for _, path := range scc {
+			inSCC[path] = true
+		}
+		// Every node in an SCC lies on a cycle through every other
+		// node, so a shortest path from a successor back to the first
+		// node (within the SCC) gives a cycle
+		for _, next := range g.Imports[first] {
+			if !inSCC[next] {
+				continue
+			}
+			if path := g.shortestPath(next, first, inSCC); path != nil {
+				result = append(result,
+					append([]string{first}, path[:len(path)-1]...))
+				break
+			}
+		}
+	}
+	sort.Sort(byFirstElement(result))
+	return result
+}
+
+// WouldCycle determines whether adding an import of the package to by the
+// package from would introduce an import cycle.  If so, it returns the
+// resulting cycle [from, to, ..., p] (where p imports from); otherwise, it
+// returns nil.
+func (g *Graph) WouldCycle(from, to string) []string {
+	if from == to {
+		return []string{from}
+	}
+	path := g.shortestPath(to, from, nil)
+	if path == nil {
+		return nil
+	}
+	return append([]string{from}, path[:len(path)-1]...)
+}
+
+// imports returns true iff the package from directly imports the package to.
+func (g *Graph) imports(from, to string) bool {
+	for _, path := range g.Imports[from] {
+		if path == to {
+			return true
+		}
+	}
+	return false
+}
+
+// shortestPath returns the shortest sequence of import paths [from, ..., to]
+// following import edges, or nil if to is not reachable from from.  If within
+// is non-nil, only packages in that set are traversed.
+func (g *Graph) shortestPath(from, to string, within map[string]bool) []string {
+	pred := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			path := []string{}
+			for p := cur; p != ""; p = pred[p] {
+				path = append([]string{p}, path...)
+			}
+			return path
+		}
+		for _, next := range g.Imports[cur] {
+			if _, seen := pred[next]; seen {
+				continue
+			}
+			if within != nil && !within[next] {
+				continue
+			}
+			pred[next] = cur
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// stronglyConnectedComponents computes the strongly connected components of
+// the import graph using Tarjan's algorithm.  Each component is sorted, and
+// the components are returned in sorted order by their first element.
+func (g *Graph) stronglyConnectedComponents() [][]string {
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	result := [][]string{}
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.Imports[v] {
+			if _, visited := index[w]; !visited {
+				strongConnect(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			scc := []string{}
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Strings(scc)
+			result = append(result, scc)
+		}
+	}
+
+	for _, v := range g.Packages() {
+		if _, visited := index[v]; !visited {
+			strongConnect(v)
+		}
+	}
+	sort.Sort(byFirstElement(result))
+	return result
+}
+
+// byFirstElement sorts a slice of nonempty string slices by their first
+// elements.
+type byFirstElement [][]string
+
+func (s byFirstElement) Len() int           { return len(s) }
+func (s byFirstElement) Less(i, j int) bool { return s[i][0] < s[j][0] }
+func (s byFirstElement) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// openFile opens a file using the build context's OpenFile function, if it is
+// set, or os.Open otherwise.
+func (g *Graph) openFile(path string) (io.ReadCloser, error) {
+	if g.ctxt.OpenFile != nil {
+		return g.ctxt.OpenFile(path)
+	}
+	return os.Open(path)
+}
+
+// min returns the minimum of two integers.
+func min(m, n int) int {
+	if m < n {
+		return m
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imports_test
+
+import (
+	"go/build"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/imports"
+)
+
+func setup(t *testing.T, roots ...string) *imports.Graph {
+	ctxt := build.Default
+	ctxt.GOPATH = "testdata"
+	g, err := imports.NewGraph(&ctxt, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := setup(t, "main")
+	if actual := strings.Join(g.Packages(), " "); actual != "a b main util" {
+		t.Fatalf("Expected packages a b main util, got %s", actual)
+	}
+	g = setup(t, "main", "c")
+	if actual := strings.Join(g.Packages(), " "); actual != "a b c main util" {
+		t.Fatalf("Expected packages a b c main util, got %s", actual)
+	}
+	// $GOROOT packages (strings) are omitted
+	if actual := strings.Join(g.Imports["b"], " "); actual != "a" {
+		t.Fatalf("Expected b to import a, got %s", actual)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	g := setup(t, "main", "c")
+	cycles := g.Cycles()
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 cycle, found %d", len(cycles))
+	}
+	if actual := strings.Join(cycles[0], " -> "); actual != "a -> b" {
+		t.Fatalf("Expected cycle a -> b, got %s", actual)
+	}
+
+	g = setup(t, "c")
+	if len(g.Cycles()) != 0 {
+		t.Fatalf("Expected no cycles")
+	}
+}
+
+func TestWouldCycle(t *testing.T) {
+	g := setup(t, "main", "c")
+	if cycle := g.WouldCycle("util", "main"); cycle == nil {
+		t.Fatalf("util importing main should introduce a cycle")
+	} else if actual := strings.Join(cycle, " -> "); actual != "util -> main" {
+		t.Fatalf("Expected cycle util -> main, got %s", actual)
+	}
+	if cycle := g.WouldCycle("b", "main"); cycle == nil {
+		t.Fatalf("b importing main should introduce a cycle")
+	} else if actual := strings.Join(cycle, " -> "); actual != "b -> main -> a" {
+		t.Fatalf("Expected cycle b -> main -> a, got %s", actual)
+	}
+	if cycle := g.WouldCycle("util", "a"); cycle != nil {
+		t.Fatalf("util importing a should not introduce a cycle, got %v",
+			cycle)
+	}
+	if cycle := g.WouldCycle("c", "a"); cycle != nil {
+		t.Fatalf("c importing a should not introduce a cycle, got %v",
+			cycle)
+	}
+}
+
+func TestSuggestBreaks(t *testing.T) {
+	g := setup(t, "main")
+	suggestions, err := g.SuggestBreaks(g.Cycles()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %d", len(suggestions))
+	}
+	expected := []string{
+		"Break b -> a by moving to a new package: Name",
+		"Break a -> b by moving to a new package: DefaultName, Greeting, prefix",
+	}
+	for i, s := range suggestions {
+		if s.String() != expected[i] {
+			t.Fatalf("Expected %s, got %s", expected[i], s)
+		}
+		if !s.Feasible() {
+			t.Fatalf("Expected %s to be feasible", s)
+		}
+	}
+}
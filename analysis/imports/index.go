@@ -0,0 +1,192 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines an Index of the imports in a workspace, which can be
+// saved in a cache directory and updated incrementally, so the packages that
+// depend on a given package can be found without reading every package in the
+// workspace each time.
+
+package imports
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An Index records which packages each package in a workspace imports.
+type Index struct {
+	// The root directory of the workspace (see FindWorkspace)
+	Root string `json:"root"`
+	// Maps the import path of each package in the workspace to
+	// information about that package
+	Packages map[string]*IndexedPackage `json:"packages"`
+}
+
+// An IndexedPackage describes a single package in an Index.
+type IndexedPackage struct {
+	// The directory containing the package
+	Dir string `json:"dir"`
+	// Summarizes the names, sizes, and modification times of the Go
+	// source files in Dir when the package was indexed.  If this changes,
+	// the package must be indexed again.
+	Stamp string `json:"stamp"`
+	// The sorted import paths of the packages it imports, including
+	// packages imported only by its tests (as they appear in import
+	// declarations)
+	Imports []string `json:"imports"`
+}
+
+// BuildIndex returns an Index of the packages in the workspace rooted at the
+// given directory (see FindPackages).  If old is an Index of the same
+// workspace, packages whose source files have not changed since old was built
+// are not read again.
+//
+// If ctxt is nil, build.Default is used.
+func BuildIndex(ctxt *build.Context, root string, old *Index) (*Index, error) {
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	oldPkgs := map[string]*IndexedPackage{}
+	if old != nil && old.Root == root {
+		for _, pkg := range old.Packages {
+			oldPkgs[pkg.Dir] = pkg
+		}
+	}
+
+	index := &Index{Root: root, Packages: map[string]*IndexedPackage{}}
+	err = walkPackageDirs(ctxt, root, func(dir string, entries []os.FileInfo) {
+		stamp := stampOf(entries)
+		importPath := importPathOf(ctxt, dir)
+		if stamp == "" || importPath == "" {
+			return
+		}
+		if oldPkg, ok := oldPkgs[dir]; ok && oldPkg.Stamp == stamp {
+			index.Packages[importPath] = oldPkg
+			return
+		}
+		pkg, err := ctxt.ImportDir(dir, 0)
+		if err != nil {
+			return
+		}
+		seen := map[string]bool{"C": true}
+		imports := []string{}
+		for _, paths := range [][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+			for _, path := range paths {
+				if !seen[path] {
+					seen[path] = true
+					imports = append(imports, path)
+				}
+			}
+		}
+		sort.Strings(imports)
+		index.Packages[importPath] = &IndexedPackage{
+			Dir:     dir,
+			Stamp:   stamp,
+			Imports: imports,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// importPathOf returns the import path of the package in the given directory,
+// or the empty string if it is not in a GOPATH workspace.
+func importPathOf(ctxt *build.Context, dir string) string {
+	for _, srcDir := range ctxt.SrcDirs() {
+		srcDir, err := filepath.Abs(srcDir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(srcDir, dir)
+		if err == nil && rel != "." && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
+
+// stampOf returns a string summarizing the names, sizes, and modification
+// times of the Go source files among the given directory entries, or the
+// empty string if there are none.
+func stampOf(entries []os.FileInfo) string {
+	h := sha256.New()
+	found := false
+	for _, fi := range entries {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+			continue
+		}
+		found = true
+		fmt.Fprintf(h, "%s %d %d\n", fi.Name(), fi.Size(),
+			fi.ModTime().UnixNano())
+	}
+	if !found {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Dependents returns the sorted import paths of the packages in the index
+// that import the given package, either directly or transitively.  The given
+// package is not included, even if it is part of an import cycle.
+func (index *Index) Dependents(path string) []string {
+	importedBy := map[string][]string{}
+	for from, pkg := range index.Packages {
+		for _, to := range pkg.Imports {
+			importedBy[to] = append(importedBy[to], from)
+		}
+	}
+	return reachable(importedBy, path)
+}
+
+// IndexFilename returns the name of the file in the given cache directory in
+// which the Index for the workspace rooted at root is saved.
+func IndexFilename(cacheDir, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(cacheDir,
+		"imports-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// LoadIndex reads an Index from the given file.
+func LoadIndex(filename string) (*Index, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if index.Packages == nil {
+		index.Packages = map[string]*IndexedPackage{}
+	}
+	return &index, nil
+}
+
+// Save writes this Index to the given file, creating its directory if
+// necessary.
+func (index *Index) Save(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0666)
+}
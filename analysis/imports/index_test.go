@@ -0,0 +1,85 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imports_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/imports"
+)
+
+func TestBuildIndex(t *testing.T) {
+	ctxt := absContext(t)
+	root := filepath.Join(ctxt.GOPATH, "src", "ws")
+	index, err := imports.BuildIndex(ctxt, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Packages) != 4 {
+		t.Fatalf("Expected 4 packages, got %d", len(index.Packages))
+	}
+	if actual := strings.Join(index.Packages["ws/app"].Imports, " "); actual != "ws/lib" {
+		t.Fatalf("Expected ws/app to import ws/lib, got %s", actual)
+	}
+	if actual := strings.Join(index.Dependents("ws/lib"), " "); actual != "ws/app ws/tool" {
+		t.Fatalf("Expected dependents ws/app ws/tool, got %s", actual)
+	}
+
+	// Unchanged packages are not read again, so a (fake) import recorded
+	// in the old index is retained
+	index.Packages["ws/other"].Imports = []string{"ws/lib"}
+	updated, err := imports.BuildIndex(ctxt, root, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(updated.Dependents("ws/lib"), " "); actual != "ws/app ws/other ws/tool" {
+		t.Fatalf("Expected dependents ws/app ws/other ws/tool, got %s", actual)
+	}
+
+	// Changed packages are read again
+	updated.Packages["ws/other"].Stamp = "changed"
+	updated, err = imports.BuildIndex(ctxt, root, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := strings.Join(updated.Dependents("ws/lib"), " "); actual != "ws/app ws/tool" {
+		t.Fatalf("Expected dependents ws/app ws/tool, got %s", actual)
+	}
+}
+
+func TestSaveLoadIndex(t *testing.T) {
+	ctxt := absContext(t)
+	root := filepath.Join(ctxt.GOPATH, "src", "ws")
+	index, err := imports.BuildIndex(ctxt, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "imports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := imports.IndexFilename(filepath.Join(dir, "cache"), root)
+	if _, err := imports.LoadIndex(filename); err == nil {
+		t.Fatalf("Expected error loading missing index")
+	}
+	if err := index.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := imports.LoadIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(index, loaded) {
+		t.Fatalf("Index did not round trip:\n%#v\n%#v", index, loaded)
+	}
+}
@@ -0,0 +1,11 @@
+package a
+
+import "b"
+
+func Hello() string {
+	return b.Greeting(b.DefaultName)
+}
+
+func Name() string {
+	return "a"
+}
@@ -0,0 +1,20 @@
+package b
+
+import (
+	"a"
+	"strings"
+)
+
+const DefaultName = "world"
+
+func Greeting(name string) string {
+	return prefix() + strings.ToUpper(name)
+}
+
+func prefix() string {
+	return "hello, "
+}
+
+func Describe() string {
+	return "b imports " + a.Name()
+}
@@ -0,0 +1,9 @@
+package c
+
+import "util"
+
+type T struct{}
+
+func (T) Value() int {
+	return util.Twice(2)
+}
@@ -0,0 +1,5 @@
+package client
+
+import "ws/lib"
+
+var V = lib.Value()
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"a"
+	"fmt"
+	"util"
+)
+
+func main() {
+	fmt.Println(a.Hello(), util.Twice(1))
+}
@@ -0,0 +1,5 @@
+package util
+
+func Twice(n int) int {
+	return 2 * n
+}
@@ -0,0 +1,7 @@
+package app
+
+import "ws/lib"
+
+func Run() int {
+	return lib.Value()
+}
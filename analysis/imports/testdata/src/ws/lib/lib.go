@@ -0,0 +1,5 @@
+package lib
+
+func Value() int {
+	return 42
+}
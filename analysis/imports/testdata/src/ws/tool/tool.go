@@ -0,0 +1,7 @@
+package tool
+
+import "ws/app"
+
+func Main() int {
+	return app.Run()
+}
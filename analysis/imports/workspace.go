@@ -0,0 +1,168 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file locates the workspace (module or repository) containing a package
+// and determines which packages in the workspace depend on it.
+
+package imports
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// workspaceMarkers are the names of files and directories that identify the
+// root directory of a workspace: a go.mod file, or the metadata directory of
+// a version control system.
+var workspaceMarkers = []string{"go.mod", ".git", ".hg", ".bzr", ".svn"}
+
+// FindWorkspace returns the root directory of the workspace containing the
+// given directory, i.e., the nearest enclosing directory (possibly dir itself)
+// that contains a go.mod file or a version control system's metadata
+// directory.  The search does not proceed above the src directory of the
+// GOPATH workspace containing dir; if dir is not in a GOPATH workspace, the
+// search continues to the root of the file system.  If no workspace is found,
+// FindWorkspace returns the empty string.
+//
+// If ctxt is nil, build.Default is used.
+func FindWorkspace(ctxt *build.Context, dir string) string {
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	stop := ""
+	for _, gopath := range ctxt.SrcDirs() {
+		if rel, err := filepath.Rel(gopath, dir); err == nil &&
+			!strings.HasPrefix(rel, "..") {
+			stop = gopath
+			break
+		}
+	}
+	for dir != stop {
+		if hasWorkspaceMarker(ctxt, dir) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// hasWorkspaceMarker returns true iff the given directory contains one of the
+// workspaceMarkers.
+func hasWorkspaceMarker(ctxt *build.Context, dir string) bool {
+	entries, err := readDir(ctxt, dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		for _, marker := range workspaceMarkers {
+			if entry.Name() == marker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindPackages returns the sorted import paths of all of the packages in the
+// given directory and its subdirectories, excluding directories named vendor
+// or testdata and directories whose names begin with . or _ (which the go tool
+// also ignores).  Packages that are not in a GOPATH workspace (and therefore do
+// not have an import path) are omitted.
+//
+// If ctxt is nil, build.Default is used.
+func FindPackages(ctxt *build.Context, dir string) ([]string, error) {
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+	result := []string{}
+	err := walkPackageDirs(ctxt, dir, func(dir string, entries []os.FileInfo) {
+		pkg, err := ctxt.ImportDir(dir, 0)
+		if err == nil && pkg.ImportPath != "" && pkg.ImportPath != "." {
+			result = append(result, pkg.ImportPath)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// walkPackageDirs invokes the given callback on the given directory and each
+// of its subdirectories that may contain a package (see FindPackages), along
+// with the directory's entries.
+func walkPackageDirs(ctxt *build.Context, dir string, callback func(dir string, entries []os.FileInfo)) error {
+	entries, err := readDir(ctxt, dir)
+	if err != nil {
+		return err
+	}
+	callback(dir, entries)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == "vendor" || name == "testdata" ||
+			strings.HasPrefix(name, ".") ||
+			strings.HasPrefix(name, "_") {
+			continue
+		}
+		if err := walkPackageDirs(ctxt, filepath.Join(dir, name), callback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir reads a directory using the build context's ReadDir function, if it
+// is set, or ioutil.ReadDir otherwise.
+func readDir(ctxt *build.Context, dir string) ([]os.FileInfo, error) {
+	if ctxt.ReadDir != nil {
+		return ctxt.ReadDir(dir)
+	}
+	return ioutil.ReadDir(dir)
+}
+
+// Dependents returns the sorted import paths of the packages in the graph
+// that import the given package, either directly or transitively.  The given
+// package is not included, even if it is part of an import cycle.
+func (g *Graph) Dependents(path string) []string {
+	importedBy := map[string][]string{}
+	for from, imports := range g.Imports {
+		for _, to := range imports {
+			importedBy[to] = append(importedBy[to], from)
+		}
+	}
+	return reachable(importedBy, path)
+}
+
+// reachable returns the sorted keys that are reachable from the given key in
+// the given adjacency lists (excluding the key itself).
+func reachable(edges map[string][]string, path string) []string {
+	seen := map[string]bool{path: true}
+	queue := []string{path}
+	result := []string{}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[cur] {
+			if !seen[next] {
+				seen[next] = true
+				result = append(result, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
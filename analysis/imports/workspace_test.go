@@ -0,0 +1,73 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imports_test
+
+import (
+	"go/build"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/imports"
+)
+
+func absContext(t *testing.T) *build.Context {
+	gopath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxt := build.Default
+	ctxt.GOPATH = gopath
+	return &ctxt
+}
+
+func TestFindWorkspace(t *testing.T) {
+	ctxt := absContext(t)
+	src := filepath.Join(ctxt.GOPATH, "src")
+	ws := filepath.Join(src, "ws")
+	if actual := imports.FindWorkspace(ctxt, filepath.Join(ws, "lib")); actual != ws {
+		t.Fatalf("Expected workspace %s, got %s", ws, actual)
+	}
+	if actual := imports.FindWorkspace(ctxt, ws); actual != ws {
+		t.Fatalf("Expected workspace %s, got %s", ws, actual)
+	}
+	if actual := imports.FindWorkspace(ctxt, filepath.Join(src, "util")); actual != "" {
+		t.Fatalf("Expected no workspace for util, got %s", actual)
+	}
+}
+
+func TestFindPackages(t *testing.T) {
+	ctxt := absContext(t)
+	pkgs, err := imports.FindPackages(ctxt, filepath.Join(ctxt.GOPATH, "src", "ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ws/app ws/lib ws/other ws/tool"
+	if actual := strings.Join(pkgs, " "); actual != expected {
+		t.Fatalf("Expected packages %s, got %s", expected, actual)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	ctxt := absContext(t)
+	g, err := imports.NewGraph(ctxt,
+		[]string{"client", "ws/app", "ws/lib", "ws/other", "ws/tool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "client ws/app ws/tool"
+	if actual := strings.Join(g.Dependents("ws/lib"), " "); actual != expected {
+		t.Fatalf("Expected dependents %s, got %s", expected, actual)
+	}
+	if actual := g.Dependents("ws/tool"); len(actual) != 0 {
+		t.Fatalf("Expected no dependents of ws/tool, got %v", actual)
+	}
+
+	// a and b import each other; neither is its own dependent
+	g = setup(t, "main")
+	if actual := strings.Join(g.Dependents("a"), " "); actual != "b main" {
+		t.Fatalf("Expected dependents b main, got %s", actual)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package members computes the fields and methods of types, including those
+// promoted from embedded fields.  It determines which embedded field provides
+// a selected field or method, and it finds the types that embed a given type,
+// i.e., the types to which its fields and methods are promoted.
+package members
+
+import (
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/loader"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// MethodSet returns the methods that can be called on an addressable value of
+// type t, including methods promoted from embedded fields, in the order given
+// by types.MethodSet.  For a named struct type T, this includes the methods
+// with pointer receivers (i.e., it is the method set of *T).
+func MethodSet(t types.Type) []*types.Selection {
+	return typeutil.IntuitiveMethodSet(types.Unalias(t), nil)
+}
+
+// Lookup returns the field or method named name that can be selected from an
+// addressable value of type t (in code in the given package), or nil if there
+// is none.  Promoted fields and methods are included, as are methods with
+// pointer receivers.  This is typically used to determine whether adding a
+// field or method to a type will conflict with an existing one.
+func Lookup(t types.Type, pkg *types.Package, name string) types.Object {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, pkg, name)
+	return obj
+}
+
+// A Path describes how a selector x.f is resolved, where x has type Recv.
+type Path struct {
+	// The type of x
+	Recv types.Type
+	// The embedded fields through which f is promoted, outermost first;
+	// empty if f is declared directly in (or on) Recv
+	Embedded []*types.Var
+	// The field or method selected
+	Obj types.Object
+	// True if a pointer is dereferenced to reach f
+	Indirect bool
+}
+
+// Resolve returns the Path by which the field or method named name is selected
+// from an addressable value of type t (in code in the given package), or nil
+// if there is no such field or method.
+func Resolve(t types.Type, pkg *types.Package, name string) *Path {
+	obj, index, indirect := types.LookupFieldOrMethod(t, true, pkg, name)
+	if obj == nil {
+		return nil
+	}
+	return newPath(t, obj, index, indirect)
+}
+
+// FromSelection returns the Path by which the given field or method selection
+// is resolved.
+func FromSelection(sel *types.Selection) *Path {
+	return newPath(sel.Recv(), sel.Obj(), sel.Index(), sel.Indirect())
+}
+
+func newPath(recv types.Type, obj types.Object, index []int, indirect bool) *Path {
+	path := &Path{Recv: recv, Obj: obj, Indirect: indirect}
+	t := recv
+	for _, i := range index[:len(index)-1] {
+		st, ok := deref(t).Underlying().(*types.Struct)
+		if !ok {
+			break
+		}
+		field := st.Field(i)
+		path.Embedded = append(path.Embedded, field)
+		t = field.Type()
+	}
+	return path
+}
+
+// Promoted returns true if the selected field or method is promoted from an
+// embedded field.
+func (p *Path) Promoted() bool {
+	return len(p.Embedded) > 0
+}
+
+// Provider returns the type that provides the selected field or method: the
+// type of the innermost embedded field through which it is promoted (with any
+// pointer removed), or Recv if it is not promoted.
+func (p *Path) Provider() types.Type {
+	if len(p.Embedded) == 0 {
+		return p.Recv
+	}
+	return deref(p.Embedded[len(p.Embedded)-1].Type())
+}
+
+// Embedders returns the named types in the given program whose fields and
+// methods include those promoted from the type named by tn: the struct types
+// that embed it (as T or *T), and, transitively, the struct types that embed
+// those types.  If tn is an alias, the embedders of the aliased type are
+// returned.  The result is sorted by position.
+func Embedders(tn *types.TypeName, prog *loader.Program) []*types.TypeName {
+	if named, ok := types.Unalias(tn.Type()).(*types.Named); ok {
+		tn = named.Obj()
+	}
+	structs := []*types.TypeName{}
+	for _, pkgInfo := range prog.AllPackages {
+		for _, obj := range pkgInfo.Defs {
+			if t, ok := obj.(*types.TypeName); ok && !t.IsAlias() {
+				if _, ok := t.Type().Underlying().(*types.Struct); ok {
+					structs = append(structs, t)
+				}
+			}
+		}
+	}
+
+	found := map[*types.TypeName]bool{tn: true}
+	result := []*types.TypeName{}
+	for queue := []*types.TypeName{tn}; len(queue) > 0; queue = queue[1:] {
+		for _, t := range structs {
+			if !found[t] && embeds(t, queue[0]) {
+				found[t] = true
+				result = append(result, t)
+				queue = append(queue, t)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pos() < result[j].Pos()
+	})
+	return result
+}
+
+// embeds returns true if the struct type named by t has an embedded field
+// whose type is (a pointer to) the type named by embedded.
+func embeds(t, embedded *types.TypeName) bool {
+	st := t.Type().Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Embedded() {
+			continue
+		}
+		if named, ok := deref(field.Type()).(*types.Named); ok &&
+			named.Origin().Obj() == embedded {
+			return true
+		}
+	}
+	return false
+}
+
+// deref returns the type pointed to by t, if t is a pointer, and t otherwise,
+// resolving any aliases.
+func deref(t types.Type) types.Type {
+	t = types.Unalias(t)
+	if ptr, ok := t.(*types.Pointer); ok {
+		return types.Unalias(ptr.Elem())
+	}
+	return t
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package members_test
+
+import (
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/members"
+
+	"golang.org/x/tools/go/loader"
+)
+
+const src = `package p
+
+type Base struct{ ID int }
+
+func (b Base) Name() string { return "" }
+func (b *Base) SetName(string) {}
+
+type Logger interface{ Log(string) }
+
+type Middle struct {
+	*Base
+	Logger
+}
+
+func (m Middle) Close() {}
+
+type Top struct {
+	Middle
+	Extra int
+}
+
+type Alias = Base
+
+type Unrelated struct{ Base int }
+`
+
+func load(t *testing.T) (*loader.Program, *types.Package) {
+	var lconfig loader.Config
+	lconfig.Fset = token.NewFileSet()
+	file, err := parser.ParseFile(lconfig.Fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lconfig.CreateFromFiles("p", file)
+	prog, err := lconfig.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog, prog.Created[0].Pkg
+}
+
+func lookupType(pkg *types.Package, name string) *types.TypeName {
+	return pkg.Scope().Lookup(name).(*types.TypeName)
+}
+
+func TestMethodSet(t *testing.T) {
+	_, pkg := load(t)
+	names := []string{}
+	for _, sel := range members.MethodSet(lookupType(pkg, "Top").Type()) {
+		names = append(names, sel.Obj().Name())
+	}
+	if actual := strings.Join(names, " "); actual != "Close Log Name SetName" {
+		t.Fatalf("Expected Close Log Name SetName, got %s", actual)
+	}
+	if members.MethodSet(lookupType(pkg, "Alias").Type())[0].Obj().Name() != "Name" {
+		t.Fatal("The method set of an alias should be that of the aliased type")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	_, pkg := load(t)
+	top := lookupType(pkg, "Top").Type()
+	tests := []struct {
+		name, embedded, provider string
+	}{
+		{"Extra", "", "p.Top"},
+		{"Close", "Middle", "p.Middle"},
+		{"SetName", "Middle Base", "p.Base"},
+		{"ID", "Middle Base", "p.Base"},
+		{"Log", "Middle Logger", "p.Logger"},
+	}
+	for _, tst := range tests {
+		path := members.Resolve(top, pkg, tst.name)
+		if path == nil {
+			t.Fatalf("%s not found", tst.name)
+		}
+		embedded := []string{}
+		for _, field := range path.Embedded {
+			embedded = append(embedded, field.Name())
+		}
+		if strings.Join(embedded, " ") != tst.embedded ||
+			path.Provider().String() != tst.provider ||
+			path.Promoted() != (tst.embedded != "") ||
+			path.Obj.Name() != tst.name {
+			t.Fatalf("%s: expected %s (%s), got %v (%s)", tst.name,
+				tst.embedded, tst.provider, embedded, path.Provider())
+		}
+	}
+	if members.Resolve(top, pkg, "Missing") != nil ||
+		members.Lookup(top, pkg, "Missing") != nil {
+		t.Fatal("Missing should not be found")
+	}
+	if members.Lookup(top, pkg, "SetName") == nil {
+		t.Fatal("SetName should be found")
+	}
+}
+
+func TestEmbedders(t *testing.T) {
+	prog, pkg := load(t)
+	for _, name := range []string{"Base", "Alias"} {
+		names := []string{}
+		for _, tn := range members.Embedders(lookupType(pkg, name), prog) {
+			names = append(names, tn.Name())
+		}
+		if actual := strings.Join(names, " "); actual != "Middle Top" {
+			t.Fatalf("Embedders of %s: expected Middle Top, got %s",
+				name, actual)
+		}
+	}
+	if len(members.Embedders(lookupType(pkg, "Top"), prog)) != 0 {
+		t.Fatal("Top should have no embedders")
+	}
+}
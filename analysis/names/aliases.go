@@ -0,0 +1,40 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package names
+
+import (
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// FindAliases returns the type aliases (type A = T) in the given program
+// that denote the type named by obj, sorted by position.  The result is empty
+// if obj is not a type name.
+//
+// Renaming obj does not rename these aliases, so references through them are
+// not found by FindOccurrences.
+func FindAliases(obj types.Object, program *loader.Program) []*types.TypeName {
+	result := []*types.TypeName{}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return result
+	}
+	target := types.Unalias(tn.Type())
+	for pkgInfo := range packages(map[types.Object]bool{obj: true}, program) {
+		for _, def := range pkgInfo.Defs {
+			alias, ok := def.(*types.TypeName)
+			if ok && alias != tn && alias.IsAlias() &&
+				types.Identical(types.Unalias(alias.Type()), target) {
+				result = append(result, alias)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pos() < result[j].Pos()
+	})
+	return result
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package names
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// FindDotImportConflict determines if renaming the given package-level object
+// to newName would cause a conflict in a file that dot-imports its package
+// (i.e., imports it using import . "path").  The exported package-level names
+// of a dot-imported package are declared in the importing file's block, so
+// the new name conflicts with any other name declared in that file block
+// (e.g., a name dot-imported from another package) or in the importing
+// package's block, and references in the file are captured by any local
+// declaration of the new name that is in scope where they occur.  It returns
+// one such conflicting declaration, if possible, and nil if there are none.
+func FindDotImportConflict(obj types.Object, newName string, prog *loader.Program) types.Object {
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return nil
+	}
+	for _, pkgInfo := range sortedPackages(prog) {
+		for _, file := range pkgInfo.Files {
+			if !dotImports(file, obj.Pkg(), pkgInfo) {
+				continue
+			}
+			fileScope := pkgInfo.Scopes[file]
+			if conflict := fileScope.Lookup(newName); conflict != nil {
+				return conflict
+			}
+			if conflict := pkgInfo.Pkg.Scope().Lookup(newName); conflict != nil {
+				return conflict
+			}
+			if conflict := findCapture(obj, newName, file, pkgInfo); conflict != nil {
+				return conflict
+			}
+		}
+	}
+	return nil
+}
+
+// dotImports returns true iff the given file dot-imports the given package.
+func dotImports(file *ast.File, pkg *types.Package, pkgInfo *loader.PackageInfo) bool {
+	for _, spec := range file.Imports {
+		if spec.Name == nil || spec.Name.Name != "." {
+			continue
+		}
+		obj := pkgInfo.Defs[spec.Name]
+		if obj == nil {
+			obj = pkgInfo.Implicits[spec]
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok && pkgName.Imported() == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// findCapture returns a declaration of newName that is visible at a
+// reference to obj in the given file, or nil if there is none.
+func findCapture(obj types.Object, newName string, file *ast.File, pkgInfo *loader.PackageInfo) types.Object {
+	fileScope := pkgInfo.Scopes[file]
+	refs := []*ast.Ident{}
+	for id, used := range pkgInfo.Uses {
+		if used == obj && file.Pos() <= id.Pos() && id.Pos() < file.End() {
+			refs = append(refs, id)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Pos() < refs[j].Pos() })
+	for _, id := range refs {
+		scope := fileScope.Innermost(id.Pos())
+		if scope == nil {
+			scope = fileScope
+		}
+		if _, conflict := scope.LookupParent(newName, id.Pos()); conflict != nil {
+			return conflict
+		}
+	}
+	return nil
+}
+
+// sortedPackages returns the packages in the given program, sorted by path.
+func sortedPackages(prog *loader.Program) []*loader.PackageInfo {
+	result := []*loader.PackageInfo{}
+	for _, pkgInfo := range prog.AllPackages {
+		result = append(result, pkgInfo)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pkg.Path() < result[j].Pkg.Path()
+	})
+	return result
+}
@@ -14,37 +14,43 @@ import (
 // FindEmbeddedTypes finds each use of the given Object's type as an embedded
 // type and returns a set consisting of the given Object and all uses in
 // embedded types.
+//
+// An embedded type is matched by the type name it refers to, not by its type,
+// so if obj is a type alias, only fields embedding the alias are found (not
+// fields embedding the aliased type), and vice versa.
 func FindEmbeddedTypes(obj types.Object, program *loader.Program) map[types.Object]bool {
 	result := map[types.Object]bool{obj: true}
-	pkgInfo := program.AllPackages[obj.Pkg()]
-	for _, file := range pkgInfo.Files {
-		ast.Inspect(file, func(node ast.Node) bool {
-			if s, ok := node.(*ast.StructType); ok {
-				for _, field := range s.Fields.List {
-					fieldObj := match(field, obj, pkgInfo)
-					if fieldObj != nil {
-						result[fieldObj] = true
+	for pkgInfo := range packages(result, program) {
+		for _, file := range pkgInfo.Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				if s, ok := node.(*ast.StructType); ok {
+					for _, field := range s.Fields.List {
+						fieldObj := match(field, obj, pkgInfo)
+						if fieldObj != nil {
+							result[fieldObj] = true
+						}
 					}
 				}
-			}
-			return true
-		})
+				return true
+			})
+		}
 	}
 	return result
 }
 
+// match returns the field declared by the given field declaration, if it is
+// an embedded field whose type name refers to obj, and nil otherwise.
 func match(field *ast.Field, obj types.Object, pkgInfo *loader.PackageInfo) types.Object {
-	fieldType := pkgInfo.TypeOf(field.Type)
-	if fieldType != obj.Type() {
+	if len(field.Names) > 0 {
 		return nil
 	}
 
 	name := findName(field.Type)
-	if name == nil {
+	if name == nil || pkgInfo.Uses[name] != obj {
 		return nil
 	}
 
-	return pkgInfo.ObjectOf(name)
+	return pkgInfo.Defs[name]
 }
 
 // findName finds the identifier that determines the implicit name of an
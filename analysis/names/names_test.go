@@ -187,6 +187,26 @@ func TestFindOccurrences(t *testing.T) {
 			"testdata/src/foo/foo.go:285"}, t)
 }
 
+func TestFindAliases(t *testing.T) {
+	p := setup(t)
+	aliases := names.FindAliases(lookup(p, "bar", "I", t), p)
+	if len(aliases) != 2 || aliases[0].Name() != "J" ||
+		aliases[1].Name() != "K" {
+		t.Fatalf("FindAliases: Expected [J K], got %v", aliases)
+	}
+	if len(names.FindAliases(lookup(p, "bar", "t", t), p)) != 0 {
+		t.Fatal("FindAliases: Expected no aliases for t")
+	}
+
+	// The embedded field J is found for the alias J, not the type I
+	if len(names.FindEmbeddedTypes(lookup(p, "bar", "I", t), p)) != 1 {
+		t.Fatal("FindEmbeddedTypes: Expected only I itself")
+	}
+	if len(names.FindEmbeddedTypes(lookup(p, "bar", "J", t), p)) != 2 {
+		t.Fatal("FindEmbeddedTypes: Expected J and the embedded field J")
+	}
+}
+
 func check(actual, expect []string, t *testing.T) {
 	if !equals(actual, expect) {
 		t.Fatalf("FindOccurrences: Expected %v, got %v", expect, actual)
@@ -0,0 +1,12 @@
+package bar
+
+// Aliases of the interface type I
+type (
+	J = I
+	K = J
+)
+
+// An embedded alias
+type withAlias struct {
+	J
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package paramgroups finds groups of parameters that recur across several
+// functions in a package.  Such a group (e.g., x, y, z float64) usually
+// describes a single concept and is a candidate for being replaced by a
+// parameter object, i.e., a struct with a field for each parameter.
+package paramgroups
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// A Param is a parameter in a Group, identified by its name and type.
+type Param struct {
+	Name string
+	Type types.Type
+}
+
+// A Group is a sequence of consecutive parameters that several functions
+// declare with the same names and types, in the same order.
+type Group struct {
+	Params []Param
+	// The functions declaring the group, in source order
+	Funcs []*types.Func
+	// The index of the group's first parameter in the signature of each
+	// function in Funcs
+	Offsets []int
+}
+
+// IndexOf returns the index of the group's first parameter in the signature
+// of the given function, or -1 if the function does not declare the group.
+func (g *Group) IndexOf(fn *types.Func) int {
+	for i, f := range g.Funcs {
+		if f == fn {
+			return g.Offsets[i]
+		}
+	}
+	return -1
+}
+
+// String returns the group's parameters in the form they would be declared,
+// e.g., "x int, y int".
+func (g *Group) String() string {
+	params := []string{}
+	for _, p := range g.Params {
+		params = append(params, p.Name+" "+types.TypeString(p.Type, nil))
+	}
+	return strings.Join(params, ", ")
+}
+
+// Find returns the groups of at least minParams parameters that are declared
+// by at least minFuncs functions (or methods) with bodies in the given
+// package.
+//
+// A group is omitted if it is part of a larger group declared by the same
+// functions.  Groups declared by more functions are returned first, then
+// groups with more parameters, then groups whose first function is declared
+// earlier in the source.
+func Find(pkgInfo *loader.PackageInfo, minParams, minFuncs int) []*Group {
+	groups := map[string]*Group{}
+	for _, fn := range funcsWithBodies(pkgInfo) {
+		params := namedParams(fn)
+		for start := range params {
+			for end := start + 1; end <= len(params); end++ {
+				if params[end-1] == nil {
+					break
+				}
+				if end-start < minParams {
+					continue
+				}
+				key := keyOf(params[start:end])
+				g, ok := groups[key]
+				if !ok {
+					g = &Group{Params: copyParams(params[start:end])}
+					groups[key] = g
+				}
+				g.Funcs = append(g.Funcs, fn)
+				g.Offsets = append(g.Offsets, start)
+			}
+		}
+	}
+
+	result := []*Group{}
+	for _, g := range groups {
+		if len(g.Funcs) >= minFuncs && !isSubsumed(g, groups) {
+			result = append(result, g)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if len(a.Funcs) != len(b.Funcs) {
+			return len(a.Funcs) > len(b.Funcs)
+		}
+		if len(a.Params) != len(b.Params) {
+			return len(a.Params) > len(b.Params)
+		}
+		if a.Funcs[0] != b.Funcs[0] {
+			return a.Funcs[0].Pos() < b.Funcs[0].Pos()
+		}
+		return a.Offsets[0] < b.Offsets[0]
+	})
+	return result
+}
+
+// funcsWithBodies returns the non-generic functions and methods with bodies
+// declared in the given package, in source order.
+func funcsWithBodies(pkgInfo *loader.PackageInfo) []*types.Func {
+	result := []*types.Func{}
+	for _, file := range pkgInfo.Files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Body == nil || decl.Type.TypeParams != nil {
+				continue
+			}
+			if fn, ok := pkgInfo.Defs[decl.Name].(*types.Func); ok {
+				result = append(result, fn)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pos() < result[j].Pos()
+	})
+	return result
+}
+
+// namedParams returns the parameters of the given function.  Parameters that
+// cannot be part of a group (blank, unnamed, and variadic parameters) are nil.
+func namedParams(fn *types.Func) []*types.Var {
+	sig := fn.Type().(*types.Signature)
+	result := make([]*types.Var, sig.Params().Len())
+	for i := range result {
+		p := sig.Params().At(i)
+		if p.Name() == "" || p.Name() == "_" ||
+			(sig.Variadic() && i == len(result)-1) {
+			continue
+		}
+		result[i] = p
+	}
+	return result
+}
+
+// keyOf returns a string that is the same for two sequences of parameters if
+// and only if they have the same names and identical types.
+func keyOf(params []*types.Var) string {
+	var b strings.Builder
+	for _, p := range params {
+		b.WriteString(p.Name())
+		b.WriteByte(' ')
+		b.WriteString(types.TypeString(p.Type(), nil))
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// copyParams returns the names and types of the given parameters.
+func copyParams(params []*types.Var) []Param {
+	result := make([]Param, len(params))
+	for i, p := range params {
+		result[i] = Param{Name: p.Name(), Type: p.Type()}
+	}
+	return result
+}
+
+// isSubsumed returns true if a larger group in the given set is declared by
+// exactly the same functions and contains g in each of them.
+func isSubsumed(g *Group, groups map[string]*Group) bool {
+	for _, other := range groups {
+		if len(other.Params) <= len(g.Params) ||
+			len(other.Funcs) != len(g.Funcs) {
+			continue
+		}
+		contains := true
+		for i, fn := range g.Funcs {
+			offset := other.IndexOf(fn)
+			if offset < 0 || offset > g.Offsets[i] ||
+				offset+len(other.Params) < g.Offsets[i]+len(g.Params) {
+				contains = false
+				break
+			}
+		}
+		if contains {
+			return true
+		}
+	}
+	return false
+}
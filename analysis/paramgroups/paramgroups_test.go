@@ -0,0 +1,103 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package paramgroups_test
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/paramgroups"
+
+	"golang.org/x/tools/go/loader"
+)
+
+const src = `package p
+
+type T struct{}
+
+func move(x, y int, dx, dy int) {}
+func draw(name string, x, y int, dx, dy int) {}
+func (t *T) resize(x, y int, dx, dy int, keep bool) {}
+func at(x, y int) {}
+func other(y, x int) {}
+func blank(x, _ int, dx, dy int) {}
+func variadic(dx int, dy ...int) {}
+func external(x, y int, dx, dy int)
+`
+
+func load(t *testing.T) *loader.PackageInfo {
+	var lconfig loader.Config
+	lconfig.Fset = token.NewFileSet()
+	file, err := parser.ParseFile(lconfig.Fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lconfig.CreateFromFiles("p", file)
+	prog, err := lconfig.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog.Created[0]
+}
+
+// describe returns a description of each group, e.g.,
+// "x int, y int: move@0 draw@1".
+func describe(groups []*paramgroups.Group) []string {
+	result := []string{}
+	for _, g := range groups {
+		funcs := []string{}
+		for i, fn := range g.Funcs {
+			funcs = append(funcs, fmt.Sprintf("%s@%d", fn.Name(), g.Offsets[i]))
+		}
+		result = append(result, g.String()+": "+strings.Join(funcs, " "))
+	}
+	return result
+}
+
+func TestFind(t *testing.T) {
+	pkgInfo := load(t)
+	tests := []struct {
+		minParams, minFuncs int
+		expected            []string
+	}{
+		{2, 3, []string{
+			"x int, y int: move@0 draw@1 resize@0 at@0",
+			"dx int, dy int: move@2 draw@3 resize@2 blank@2",
+			"x int, y int, dx int, dy int: move@0 draw@1 resize@0",
+		}},
+		{4, 2, []string{
+			"x int, y int, dx int, dy int: move@0 draw@1 resize@0",
+		}},
+		{2, 5, []string{}},
+	}
+	for _, tst := range tests {
+		actual := describe(paramgroups.Find(pkgInfo, tst.minParams, tst.minFuncs))
+		if strings.Join(actual, "\n") != strings.Join(tst.expected, "\n") {
+			t.Errorf("Find(%d, %d): expected\n%s\ngot\n%s",
+				tst.minParams, tst.minFuncs,
+				strings.Join(tst.expected, "\n"),
+				strings.Join(actual, "\n"))
+		}
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	pkgInfo := load(t)
+	groups := paramgroups.Find(pkgInfo, 4, 2)
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	scope := pkgInfo.Pkg.Scope()
+	for name, expected := range map[string]int{"draw": 1, "at": -1} {
+		fn := scope.Lookup(name).(*types.Func)
+		if actual := groups[0].IndexOf(fn); actual != expected {
+			t.Errorf("IndexOf(%s): expected %d, got %d", name, expected, actual)
+		}
+	}
+}
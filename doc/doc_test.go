@@ -6,6 +6,7 @@ package doc_test
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"strings"
 	"testing"
@@ -17,18 +18,40 @@ func TestDoc(t *testing.T) {
 	fs := flag.NewFlagSet("test", flag.PanicOnError)
 	var b bytes.Buffer
 
-	doc.PrintManPage("about", fs, &b)
+	if err := doc.PrintManPage("about", fs, &b); err != nil {
+		t.Fatal(err)
+	}
 	if !strings.Contains(b.String(), ".TH") {
 		t.Fatal("PrintManPage output does not contain .TH")
 	}
 
-	doc.PrintVimdoc("about", fs, &b)
+	if err := doc.PrintVimdoc("about", fs, &b); err != nil {
+		t.Fatal(err)
+	}
 	if !strings.Contains(b.String(), ":GoRefactor") {
 		t.Fatal("PrintVimdoc output does not contain :GoRefactor")
 	}
 
-	doc.PrintUserGuide("about", fs, &b)
+	if err := doc.PrintUserGuide("about", fs, &b); err != nil {
+		t.Fatal(err)
+	}
 	if !strings.Contains(b.String(), "<html") {
 		t.Fatal("PrintUserGuide output does not contain <html")
 	}
 }
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestDocWriteError(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.PanicOnError)
+	if err := doc.PrintManPage("about", fs, failingWriter{}); err == nil {
+		t.Fatal("PrintManPage should return an error when output fails")
+	}
+	if err := doc.PrintInstallGuide("about", fs, failingWriter{}); err == nil {
+		t.Fatal("PrintInstallGuide should return an error when output fails")
+	}
+}
@@ -12,12 +12,10 @@ import (
 )
 
 // PrintInstallGuide outputs the (HTML) Installation Guide for the Go Doctor.
-func PrintInstallGuide(aboutText string, flags *flag.FlagSet, out io.Writer) {
+// It returns an error if the guide cannot be written to out.
+func PrintInstallGuide(aboutText string, flags *flag.FlagSet, out io.Writer) error {
 	tmpl := template.Must(template.New("installGuide").Parse(installGuide))
-	err := tmpl.Execute(out, struct{ AboutText string }{aboutText})
-	if err != nil {
-		panic(err)
-	}
+	return tmpl.Execute(out, struct{ AboutText string }{aboutText})
 }
 
 const installGuide = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
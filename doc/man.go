@@ -10,13 +10,11 @@ import (
 	"text/template"
 )
 
-// PrintManPage outputs a man page for the godoctor command line tool.
-func PrintManPage(aboutText string, flags *flag.FlagSet, out io.Writer) {
+// PrintManPage outputs a man page for the godoctor command line tool.  It
+// returns an error if the man page cannot be written to out.
+func PrintManPage(aboutText string, flags *flag.FlagSet, out io.Writer) error {
 	ctnt := prepare(aboutText, flags)
-	err := template.Must(template.New("man").Parse(man)).Execute(out, ctnt)
-	if err != nil {
-		panic(err)
-	}
+	return template.Must(template.New("man").Parse(man)).Execute(out, ctnt)
 }
 
 // For conventions for writing a man page, see
@@ -43,7 +41,7 @@ godoctor \- refactor Go source code
 .I ...
 .B ]
 .SH DESCRIPTION
-godoctor refactors Go Source code, outputting a patch file with the changes (unless the -w or -complete flag is specified).
+godoctor refactors Go Source code, outputting a patch file with the changes (unless the -w or -complete flag is specified).  If the -patchdir flag is specified, a separate patch is written for each modified file.  If the -gofmt flag is specified, the original and refactored files are formatted with gofmt before they are compared, so the patch shows only the changes made by the refactoring, not formatting changes (but it may not apply to files that were not formatted with gofmt).  If the -pipe flag is specified, a single file is read from standard input and the refactored file is written to standard output, like gofmt; changes to other files are discarded with a warning.  If the -scope flag is not specified, the scope consists of the package containing the file being refactored, along with the packages in the same module or repository (i.e., the nearest enclosing directory containing a go.mod file or version control metadata) that import it.
 .PP
 The Go Doctor can be run from the command line, but it is more easily used from an editor like Vim.
 .PP
@@ -79,6 +77,11 @@ Display a list of available refactorings:
 -list
 .PP
 .TP
+Output a description of every refactoring, including its parameters, as JSON:
+.B godoctor
+-list -json
+.PP
+.TP
 Display usage information for the Rename refactoring:
 .B godoctor
 rename
@@ -92,6 +95,14 @@ rename
 bar
 .PP
 .TP
+Rename the function f declared in main.go to g, selecting its name with a regular expression instead of a position:
+.B godoctor
+-pos '/func (f)\\(/'
+-file main.go
+rename
+g
+.PP
+.TP
 Toy example: Pipe a file to the godoctor and rename n to foo, displaying the result:
 echo 'package main; import "fmt"; func main() { n := 1; fmt.Println(n) }' | godoctor -pos 1,43:1,43 -w rename foo
 .PP
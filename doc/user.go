@@ -24,9 +24,10 @@ type UserGuideContent struct {
 //
 // Both the godoctor man page and the Vim plugin reference are generated and
 // included in the User's Guide.  The man page content is piped through groff
-// to convert it to HTML.
-func PrintUserGuide(aboutText string, flags *flag.FlagSet, out io.Writer) {
-	PrintUserGuideAsGiven(aboutText, flags, &UserGuideContent{}, out)
+// to convert it to HTML.  It returns an error if the guide cannot be written to
+// out or the man page cannot be written to groff.
+func PrintUserGuide(aboutText string, flags *flag.FlagSet, out io.Writer) error {
+	return PrintUserGuideAsGiven(aboutText, flags, &UserGuideContent{}, out)
 }
 
 // PrintUserGuideAsGiven outputs the User's Guide for the Go Doctor (in HTML).
@@ -35,11 +36,14 @@ func PrintUserGuide(aboutText string, flags *flag.FlagSet, out io.Writer) {
 // the online documentation, which cannot execute groff to convert the man page
 // to HTML (due to an App Engine restriction), and which uses a Vim-colored
 // version of the Vim plugin documentation.
-func PrintUserGuideAsGiven(aboutText string, flags *flag.FlagSet, ctnt *UserGuideContent, out io.Writer) {
+func PrintUserGuideAsGiven(aboutText string, flags *flag.FlagSet, ctnt *UserGuideContent, out io.Writer) error {
 	ctnt.docContent = prepare(aboutText, flags)
 	if ctnt.ManPageHTML == "" {
-		ctnt.ManPageHTML = extractBetween(convertManPage(aboutText, flags),
-			"<body>", "</body>")
+		manPage, err := convertManPage(aboutText, flags)
+		if err != nil {
+			return err
+		}
+		ctnt.ManPageHTML = extractBetween(manPage, "<body>", "</body>")
 	}
 	if ctnt.VimdocHTML == "" {
 		ctnt.VimdocHTML = fmt.Sprintf(
@@ -48,33 +52,38 @@ func PrintUserGuideAsGiven(aboutText string, flags *flag.FlagSet, ctnt *UserGuid
 	}
 
 	tmpl := template.Must(template.New("userGuide").Parse(userGuide))
-	err := tmpl.Execute(out, ctnt)
-	if err != nil {
-		panic(err)
-	}
+	return tmpl.Execute(out, ctnt)
 }
 
-func convertManPage(aboutText string, flags *flag.FlagSet) string {
+// convertManPage pipes the man page through groff to convert it to HTML.  If
+// groff cannot be run, the error message is returned in place of the HTML
+// (so the rest of the User's Guide can still be generated); an error is
+// returned if the man page cannot be written to groff.
+func convertManPage(aboutText string, flags *flag.FlagSet) (string, error) {
 	cmd := exec.Command("groff", "-t", "-mandoc", "-Thtml")
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return fmt.Sprintf("[ERROR] %s", err.Error())
+		return fmt.Sprintf("[ERROR] %s", err.Error()), nil
 	}
 
+	printErr := make(chan error, 1)
 	go func() {
-		defer func() {
-			recover()
-		}()
-		PrintManPage(aboutText, flags, stdin)
-		err = stdin.Close()
+		err := PrintManPage(aboutText, flags, stdin)
+		if closeErr := stdin.Close(); err == nil {
+			err = closeErr
+		}
+		printErr <- err
 	}()
 
 	result, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Sprintf("[ERROR] %s", err.Error())
+		return fmt.Sprintf("[ERROR] %s", err.Error()), nil
 	}
-	return string(result)
+	if err := <-printErr; err != nil {
+		return "", err
+	}
+	return string(result), nil
 }
 
 func extractBetween(s, from, to string) string {
@@ -92,11 +101,10 @@ func extractBetween(s, from, to string) string {
 }
 
 func printVimdoc(aboutText string, flags *flag.FlagSet) string {
-	defer func() {
-		recover()
-	}()
 	var b bytes.Buffer
-	PrintVimdoc(aboutText, flags, &b)
+	if err := PrintVimdoc(aboutText, flags, &b); err != nil {
+		return fmt.Sprintf("[ERROR] %s", err.Error())
+	}
 	return b.String()
 }
 
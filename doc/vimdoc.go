@@ -10,13 +10,11 @@ import (
 	"text/template"
 )
 
-// PrintVimdoc outputs vimdoc documentation for the Go Doctor Vim plugin.
-func PrintVimdoc(aboutText string, flags *flag.FlagSet, out io.Writer) {
+// PrintVimdoc outputs vimdoc documentation for the Go Doctor Vim plugin.  It
+// returns an error if the documentation cannot be written to out.
+func PrintVimdoc(aboutText string, flags *flag.FlagSet, out io.Writer) error {
 	ctnt := prepare(aboutText, flags)
-	err := template.Must(template.New("vim").Parse(vim)).Execute(out, ctnt)
-	if err != nil {
-		panic(err)
-	}
+	return template.Must(template.New("vim").Parse(vim)).Execute(out, ctnt)
 }
 
 const vim = `*godoctor-vim.txt*
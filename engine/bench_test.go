@@ -0,0 +1,139 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// These benchmarks measure the performance of refactorings on a large,
+// synthetic workspace.  Run them with
+//     go test -run=NONE -bench=. ./engine
+// Baseline results are recorded in the INTERNALS file.
+
+package engine_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+const (
+	benchPackages      = 50 // Number of packages importing the base package
+	benchFilesPerPkg   = 4  // Number of files in each of those packages
+	benchCallsPerFile  = 25 // Number of calls to base.Widely in each file
+	benchBaseFilename  = "base.go"
+	benchWidelyUsedPos = "5,6:5,6" // Position of Widely in base.go
+)
+
+// makeBenchWorkspace creates a GOPATH workspace in a temporary directory
+// containing a package named base, which declares a function named Widely, and
+// benchPackages packages that call it, along with a main package that imports
+// all of them.  It returns the GOPATH directory and the path to the main
+// package's main.go file.
+func makeBenchWorkspace(b *testing.B) (string, string) {
+	gopath, err := ioutil.TempDir("", "godoctor-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	write := func(path, contents string) {
+		path = filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			b.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	write(filepath.Join("base", benchBaseFilename),
+		"package base\n\n// Widely is called from every package\n\n"+
+			"func Widely(n int) int {\n\treturn n + 1\n}\n")
+
+	var mainSrc bytes.Buffer
+	mainSrc.WriteString("package main\n\nimport (\n")
+	for i := 0; i < benchPackages; i++ {
+		pkg := fmt.Sprintf("pkg%d", i)
+		fmt.Fprintf(&mainSrc, "\t%q\n", pkg)
+		for j := 0; j < benchFilesPerPkg; j++ {
+			var fileSrc bytes.Buffer
+			fmt.Fprintf(&fileSrc, "package %s\n\nimport \"base\"\n\n", pkg)
+			fmt.Fprintf(&fileSrc, "func F%d(n int) int {\n", j)
+			for k := 0; k < benchCallsPerFile; k++ {
+				fileSrc.WriteString("\tn = base.Widely(n)\n")
+			}
+			fileSrc.WriteString("\treturn n\n}\n")
+			write(filepath.Join(pkg, fmt.Sprintf("file%d.go", j)),
+				fileSrc.String())
+		}
+	}
+	mainSrc.WriteString(")\n\nfunc main() {\n")
+	for i := 0; i < benchPackages; i++ {
+		fmt.Fprintf(&mainSrc, "\tpkg%d.F0(%d)\n", i, i)
+	}
+	mainSrc.WriteString("}\n")
+	write(filepath.Join("main", "main.go"), mainSrc.String())
+
+	return gopath, filepath.Join(src, "main", "main.go")
+}
+
+// runBenchRefactoring runs the given refactoring on the Widely function in the
+// benchmark workspace, with the main package as the scope, and returns the
+// result.
+func runBenchRefactoring(b *testing.B, gopath, mainFile, shortName string, args ...string) *refactoring.Result {
+	baseFile := filepath.Join(gopath, "src", "base", benchBaseFilename)
+	selection, err := text.NewSelection(baseFile, benchWidelyUsedPos)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := engine.GetRefactoring(shortName)
+	result := r.Run(&refactoring.Config{
+		FileSystem: &filesystem.LocalFileSystem{},
+		Scope:      []string{mainFile},
+		Selection:  selection,
+		Args:       refactoring.InterpretArgs(args, r),
+		GoPath:     gopath,
+	})
+	if result.Log.ContainsErrors() {
+		b.Fatalf("%s", result.Log)
+	}
+	return result
+}
+
+// BenchmarkLoadWorkspace measures the time to load and type check the
+// benchmark workspace (the null refactoring does nothing else).
+func BenchmarkLoadWorkspace(b *testing.B) {
+	engine.AddDefaultRefactorings()
+	gopath, mainFile := makeBenchWorkspace(b)
+	defer os.RemoveAll(gopath)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runBenchRefactoring(b, gopath, mainFile, "null", "false")
+	}
+}
+
+// BenchmarkRenameWidelyUsed measures the time to rename a function that is
+// called from every package in the benchmark workspace.
+func BenchmarkRenameWidelyUsed(b *testing.B) {
+	engine.AddDefaultRefactorings()
+	gopath, mainFile := makeBenchWorkspace(b)
+	defer os.RemoveAll(gopath)
+
+	expected := 1 + benchPackages*benchFilesPerPkg
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := runBenchRefactoring(b, gopath, mainFile, "rename",
+			"Renamed")
+		if len(result.Edits) != expected {
+			b.Fatalf("Expected edits to %d files, got %d",
+				expected, len(result.Edits))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the refactoring catalog, a machine-readable description
+// of every available refactoring.
+
+package engine
+
+import "github.com/godoctor/godoctor/refactoring"
+
+// Stability levels reported in a CatalogEntry.  These match the quality
+// levels used by the OpenRefactory protocol's list command.
+const (
+	// The refactoring is intended for production use.
+	Production = "production"
+	// The refactoring is hidden, i.e., not intended for production use.
+	InDevelopment = "in_development"
+)
+
+// A CatalogEntry describes a refactoring in enough detail that a client
+// (e.g., an editor plug-in) can add it to a menu and prompt for its arguments
+// without any prior knowledge of it.
+type CatalogEntry struct {
+	// The unique name used to invoke the refactoring (e.g., rename)
+	ShortName string `json:"shortName"`
+	// The remaining fields are taken from the refactoring's Description;
+	// see refactoring.Description
+	Name      string `json:"name"`
+	Synopsis  string `json:"synopsis"`
+	Usage     string `json:"usage"`
+	Selection string `json:"selection"`
+	Multifile bool   `json:"multifile"`
+	// Production or InDevelopment
+	Stability string `json:"stability"`
+	// The refactoring's required parameters, followed by its optional
+	// parameters
+	Params []*CatalogParam `json:"params"`
+	// The presets with which the refactoring can be run (see Preset)
+	Presets []*CatalogPreset `json:"presets"`
+}
+
+// A CatalogParam describes one of a refactoring's parameters.
+type CatalogParam struct {
+	Label  string `json:"label"`
+	Prompt string `json:"prompt"`
+	// "bool" or "string"
+	Type     string      `json:"type"`
+	Default  interface{} `json:"default"`
+	Optional bool        `json:"optional"`
+}
+
+// A CatalogPreset describes one of the presets (see Preset).
+type CatalogPreset struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	RefuseOnWarning bool   `json:"refuseOnWarning"`
+	// "edit", "skip", or "fail" (see refactoring.GeneratedFilePolicy)
+	GeneratedFiles   string `json:"generatedFiles"`
+	PreserveComments bool   `json:"preserveComments"`
+}
+
+// Catalog returns a CatalogEntry for each available refactoring, including
+// hidden refactorings, in the order they should be displayed in a menu.
+func Catalog() []*CatalogEntry {
+	result := []*CatalogEntry{}
+	for _, shortName := range AllRefactoringNames() {
+		if entry := Describe(shortName); entry != nil {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Describe returns a CatalogEntry describing the refactoring with the given
+// short name, or nil if there is no such refactoring.
+func Describe(shortName string) *CatalogEntry {
+	refac := GetRefactoring(shortName)
+	if refac == nil {
+		return nil
+	}
+	d := refac.Description()
+	entry := &CatalogEntry{
+		ShortName: shortName,
+		Name:      d.Name,
+		Synopsis:  d.Synopsis,
+		Usage:     d.Usage,
+		Selection: d.Selection,
+		Multifile: d.Multifile,
+		Stability: Production,
+		Params:    []*CatalogParam{},
+		Presets:   catalogPresets(),
+	}
+	if d.Hidden {
+		entry.Stability = InDevelopment
+	}
+	for _, p := range d.Params {
+		entry.Params = append(entry.Params, catalogParam(p, false))
+	}
+	for _, p := range d.OptionalParams {
+		entry.Params = append(entry.Params, catalogParam(p, true))
+	}
+	return entry
+}
+
+// catalogParam returns a CatalogParam describing the given parameter.
+func catalogParam(p refactoring.Parameter, optional bool) *CatalogParam {
+	typ := "string"
+	if p.IsBoolean() {
+		typ = "bool"
+	}
+	return &CatalogParam{
+		Label:    p.Label,
+		Prompt:   p.Prompt,
+		Type:     typ,
+		Default:  p.DefaultValue,
+		Optional: optional,
+	}
+}
+
+// catalogPresets returns a CatalogPreset describing each available preset.
+func catalogPresets() []*CatalogPreset {
+	result := []*CatalogPreset{}
+	for _, name := range AllPresetNames() {
+		p := GetPreset(name)
+		result = append(result, &CatalogPreset{
+			Name:             p.Name,
+			Description:      p.Description,
+			RefuseOnWarning:  p.RefuseOnWarning,
+			GeneratedFiles:   p.GeneratedFiles.String(),
+			PreserveComments: p.PreserveComments,
+		})
+	}
+	return result
+}
@@ -0,0 +1,329 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the batch command, which applies the refactorings
+// requested by //doctor: directives in the source code.
+
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/engine/directive"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+// batchFlags are the names of the flags that cannot be used with the batch
+// command, since the directives determine the files and selections.
+var batchFlags = map[string]bool{
+	"file": true,
+	"pos":  true,
+	"pipe": true,
+	// Each refactoring's log is displayed as it is applied, so only the
+	// default text format is supported
+	"logformat": true,
+}
+
+// runBatch applies the refactorings requested by the //doctor: directives in
+// the Go files in the given files and directories (default: the current
+// directory), in order, deleting each directive as it is applied.  The
+// combined changes are output (or written to disk) as if they were made by
+// a single refactoring.  If any refactoring produces an error, nothing is
+// output or written.
+func runBatch(stdout, stderr io.Writer, flags *CLIFlags, args []string) int {
+	invalid := ""
+	flags.Visit(func(f *flag.Flag) {
+		if batchFlags[f.Name] && invalid == "" {
+			invalid = f.Name
+		}
+	})
+	if invalid != "" {
+		fmt.Fprintf(stderr, "Error: The -%s flag cannot be used with "+
+			"the batch command\n", invalid)
+		return 1
+	}
+
+	paths := args
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	filenames, err := goFiles(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	generatedFiles, err := refactoring.ParseGeneratedFilePolicy(*flags.generatedFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+	preset, err := parsePreset(flags)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	var scope []string
+	if *flags.scopeFlag != "" {
+		scope = strings.Split(*flags.scopeFlag, ",")
+	}
+	verbosity := 0
+	if *flags.verboseFlag {
+		verbosity = 1
+	}
+	if *flags.veryVerboseFlag {
+		verbosity = 2
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = ""
+	}
+
+	local := filesystem.NewLocalFileSystem()
+	var fs filesystem.FileSystem = local
+	changed := map[string]bool{}
+	// Checksums of the changed files' contents on disk when they were first
+	// changed, so that writeToDisk can detect concurrent modifications
+	checksums := map[string]string{}
+	applied := []string{}
+	refactorings := []*engine.Result{} // Notified if the changes are applied
+	var report *batchReport
+	if *flags.reportFlag != "" {
+		report = newBatchReport()
+	}
+	for {
+		d, err := nextDirective(filenames, fs)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		if d == nil {
+			break
+		}
+		summary := fmt.Sprintf("%s:%d: %s",
+			filepath.ToSlash(relativePath(d.Filename)), d.Line, d)
+		fmt.Fprintln(stderr, summary)
+		if engine.GetRefactoring(d.Refactoring) == nil {
+			fmt.Fprintf(stderr, "Error: There is no refactoring "+
+				"named \"%s\"\n", d.Refactoring)
+			return 1
+		}
+
+		// Delete the directive, then apply the refactoring
+		before := fs
+		removal := text.NewEditSet()
+		for _, extent := range d.Extents {
+			removal.Add(extent, "")
+		}
+		if !changed[d.Filename] {
+			if contents, err := readFile(d.Filename, local); err == nil {
+				checksums[d.Filename] = filesystem.Checksum(contents)
+			}
+		}
+		fs = filesystem.NewEditedFileSystem(fs,
+			map[string]*text.EditSet{d.Filename: removal})
+		changed[d.Filename] = true
+		workspace := &engine.Workspace{
+			FileSystem: fs,
+			Scope:      scope,
+			Include:    splitPatterns(*flags.includeFlag),
+			Exclude:    splitPatterns(*flags.excludeFlag),
+			CacheDir:   *flags.cacheDirFlag,
+		}
+		refactored, err := workspace.Refactor(&engine.Request{
+			Refactoring: d.Refactoring,
+			Selection: &text.OffsetLengthSelection{
+				Filename: d.Filename,
+				Offset:   removal.NewOffset(d.Offset),
+				Length:   d.Length,
+			},
+			Args:           d.Args,
+			Preset:         preset,
+			GeneratedFiles: generatedFiles,
+			Verbosity:      verbosity,
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		var logText bytes.Buffer
+		refactored.WriteMessages(&logText, "text", cwd)
+		stderr.Write(logText.Bytes())
+		if refactored.HasErrors() {
+			return 3
+		}
+		if fsChanges := refactored.FileSystemChanges(); len(fsChanges) > 0 {
+			fmt.Fprintf(stderr, "Error: The batch command cannot "+
+				"apply refactorings that require file system "+
+				"changes (%s)\n", fsChanges[0].String(cwd))
+			return 1
+		}
+		result := changesOf(refactored)
+		fs = filesystem.NewEditedFileSystem(fs, result.edits)
+		stepFiles := []string{d.Filename}
+		for filename := range result.edits {
+			if checksum, ok := result.checksums[filename]; ok &&
+				!changed[filename] {
+				checksums[filename] = checksum
+			}
+			changed[filename] = true
+			if filename != d.Filename {
+				stepFiles = append(stepFiles, filename)
+			}
+		}
+		log := splitLog(logText.String())
+		if report != nil {
+			err := report.addStep(d, log, stepFiles, before, fs)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %s\n", err)
+				return 1
+			}
+		}
+		refactorings = append(refactorings, refactored)
+		// The log is indented beneath the directive in -formatpatch output
+		applied = append(applied, strings.Join(append([]string{summary},
+			log...), "\n        "))
+	}
+	if len(applied) == 0 {
+		fmt.Fprintf(stderr, "No %s directives were found\n",
+			directive.Prefix)
+		return 0
+	}
+
+	// Combine the refactorings' changes into a single set of edits to
+	// each file
+	result := &changes{
+		edits:     map[string]*text.EditSet{},
+		checksums: checksums,
+	}
+	before := map[string][]byte{}
+	for filename := range changed {
+		original, err := readFile(filename, local)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		updated, err := readFile(filename, fs)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		before[filename] = original
+		result.edits[filename] = text.DiffBytes(original, updated)
+	}
+
+	if report != nil {
+		mp, err := filesystem.CreateMultiPatch(result.edits, local)
+		if err == nil {
+			err = report.addPatch(mp)
+		}
+		if err == nil {
+			err = report.write(*flags.reportFlag)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+	}
+
+	if *flags.writeFlag {
+		err = writeToDisk(result, local)
+		if err == nil {
+			for _, refactored := range refactorings {
+				refactored.Applied()
+			}
+		}
+		if err == nil {
+			err = recordInJournal(cwd, flags, "batch", args, nil,
+				result, before, local)
+		}
+	} else if *flags.completeFlag {
+		err = writeFileContents(stdout, result.edits, local)
+	} else if *flags.patchDirFlag != "" {
+		err = writePatchFiles(stdout, *flags.patchDirFlag, result.edits, local)
+	} else if *flags.formatPatchFlag {
+		_, err = writeFormatPatch(stdout,
+			fmt.Sprintf("Apply %s directives", directive.Prefix),
+			"Applied the following directives:\n\n    "+
+				strings.Join(applied, "\n    ")+"\n",
+			result.edits, nil, local)
+	} else if *flags.gitFlag {
+		_, err = writeGitDiff(stdout, result.edits, nil, local)
+	} else {
+		err = writeDiff(stdout, result.edits, local)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+	return 0
+}
+
+// goFiles returns the absolute paths of the given Go files and the Go files
+// in the given directories and their subdirectories, sorted, skipping
+// directories that the go tool ignores (testdata, vendor, and those whose
+// names begin with . or _).
+func goFiles(paths []string) ([]string, error) {
+	result := []string{}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if p != path && (name == "testdata" || name == "vendor" ||
+					strings.HasPrefix(name, ".") ||
+					strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if p == path || strings.HasSuffix(name, ".go") {
+				result = append(result, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// nextDirective returns the first directive in the given files, as they
+// appear in the given file system, or nil if there are none.
+func nextDirective(filenames []string, fs filesystem.FileSystem) (*directive.Directive, error) {
+	for _, filename := range filenames {
+		src, err := readFile(filename, fs)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(string(src), directive.Prefix) {
+			continue
+		}
+		directives, err := directive.Find(filename, src)
+		if err != nil {
+			return nil, err
+		}
+		if len(directives) > 0 {
+			return directives[0], nil
+		}
+	}
+	return nil, nil
+}
@@ -7,6 +7,7 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
@@ -14,10 +15,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"strings"
 
+	"github.com/godoctor/godoctor/analysis/fingerprint"
 	"github.com/godoctor/godoctor/doc"
 	"github.com/godoctor/godoctor/engine"
 	"github.com/godoctor/godoctor/engine/protocol"
@@ -67,16 +70,29 @@ Each <flag> must be one of the following:
 	} else {
 		Usage = `{{.AboutText}} - Go source code refactoring tool.
 
-Usage: {{.CommandName}} [<flag> ...] <refactoring> [<args> ...]
+Usage: {{.CommandName}} <command> [<flag> ...] [<args> ...]
 
-Each <flag> must be one of the following:
-{{.Flags}}
-The <refactoring> argument determines the refactoring to perform:
+The <command> must be one of the following:
+{{.Commands}}
+Use "{{.CommandName}} help <command>" for the flags and arguments each command
+accepts.
+
+The refactorings available to the run, analyze, and params commands are:
 {{.Refactorings}}
 The <args> following the refactoring name vary depending on the refactoring.
 If a refactoring requires arguments but none are supplied, a message will be
 displayed with a synopsis of the correct usage.
 
+The Go Doctor can also be invoked without a command, as
+    {{.CommandName}} [<flag> ...] <refactoring> [<args> ...]
+which is equivalent to the run command but accepts all of the following flags:
+{{.Flags}}
+Refactorings applied with -w are recorded in .godoctor/journal in the current
+directory; see the history, replay, and undo commands.
+
+The batch and diff commands also accept their flags before the command name
+(e.g., "{{.CommandName}} -formatpatch diff"), as in earlier versions.
+
 For complete usage information, see the user manual: http://gorefactor.org/doc.html
 `
 	}
@@ -87,6 +103,7 @@ func printHelp(cmdName, aboutText string, flags *flag.FlagSet, stderr io.Writer)
 		AboutText    string
 		CommandName  string
 		Flags        string
+		Commands     string
 		Refactorings string
 	}
 
@@ -109,6 +126,7 @@ func printHelp(cmdName, aboutText string, flags *flag.FlagSet, stderr io.Writer)
 		}
 	}
 	usageFields.Refactorings = refactorings.String()
+	usageFields.Commands = listCommands()
 
 	ensureUsageIsSet()
 
@@ -123,9 +141,22 @@ type CLIFlags struct {
 	*flag.FlagSet
 	fileFlag        *string
 	posFlag         *string
+	targetFlag      *string
 	scopeFlag       *string
 	completeFlag    *bool
 	writeFlag       *bool
+	patchDirFlag    *string
+	formatPatchFlag *bool
+	gitFlag         *bool
+	gofmtFlag       *bool
+	reportFlag      *string
+	pipeFlag        *bool
+	generatedFlag   *string
+	presetFlag      *string
+	includeFlag     *string
+	excludeFlag     *string
+	cacheDirFlag    *string
+	logFormatFlag   *string
 	verboseFlag     *bool
 	veryVerboseFlag *bool
 	listFlag        *bool
@@ -140,19 +171,45 @@ func Flags() *CLIFlags {
 	flags.fileFlag = flags.String("file", "",
 		"Filename containing an element to refactor (default: stdin)")
 	flags.posFlag = flags.String("pos", "1,1:1,1",
-		"Position of a syntax element to refactor (default: entire file)")
+		"Position of a syntax element to refactor, or /regexp/ to select the first match, /regexp/g every match (default: entire file)")
+	flags.targetFlag = flags.String("target", "",
+		"Fingerprint of a syntax element to refactor, from the journal (overrides -pos)")
 	flags.scopeFlag = flags.String("scope", "",
 		"Package name(s), or source file containing a program entrypoint")
 	flags.completeFlag = flags.Bool("complete", false,
 		"Output entire modified source files instead of displaying a diff")
 	flags.writeFlag = flags.Bool("w", false,
 		"Modify source files on disk (write) instead of displaying a diff")
+	flags.patchDirFlag = flags.String("patchdir", "",
+		"Write a separate patch for each modified file into this directory")
+	flags.formatPatchFlag = flags.Bool("formatpatch", false,
+		"Output a patch in git format-patch style (for git am) instead of a diff")
+	flags.gitFlag = flags.Bool("git", false,
+		"Output a diff with git-style headers (for git apply) instead of a diff")
+	flags.gofmtFlag = flags.Bool("gofmt", false,
+		"Diff: gofmt the original and refactored files first, hiding formatting changes")
+	flags.reportFlag = flags.String("report", "",
+		"Batch: write a JSON report mapping each hunk to the directives that produced it")
+	flags.pipeFlag = flags.Bool("pipe", false,
+		"Filter: read a file from stdin and write the refactored file to stdout")
+	flags.generatedFlag = flags.String("generated", "edit",
+		"Generated files: edit them, skip them, or fail (edit, skip, fail)")
+	flags.presetFlag = flags.String("preset", "",
+		"Preset: refuse risky changes, or make them with warnings (safe, aggressive)")
+	flags.includeFlag = flags.String("include", "",
+		"Only modify files matching these glob patterns (e.g., internal/,gen/*.go)")
+	flags.excludeFlag = flags.String("exclude", "",
+		"Do not modify files matching these glob patterns (e.g., vendor/,*.pb.go)")
+	flags.cacheDirFlag = flags.String("cachedir", "",
+		"Cache an index of the workspace's imports in this directory (default: no cache)")
+	flags.logFormatFlag = flags.String("logformat", "text",
+		"Format of errors and warnings (text, sarif, checkstyle, or junit)")
 	flags.verboseFlag = flags.Bool("v", false,
-		"Verbose: list affected files")
+		"Verbose: list affected files (and, with -w, summarize the changes)")
 	flags.veryVerboseFlag = flags.Bool("vv", false,
 		"Very verbose: list individual edits (implies -v)")
 	flags.listFlag = flags.Bool("list", false,
-		"List all refactorings and exit")
+		"List all refactorings (as JSON, with -json) and exit")
 	flags.jsonFlag = flags.Bool("json", false,
 		"Accept commands in OpenRefactory JSON protocol format")
 	flags.docFlag = flags.String("doc", "",
@@ -166,6 +223,19 @@ func Flags() *CLIFlags {
 func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer, args []string) int {
 	cmdName := args[0]
 
+	if len(engine.AllRefactoringNames()) != 1 && len(args) > 1 {
+		if cmd := getCommand(args[1]); cmd != nil {
+			// Invoked as "godoctor <command> [flags] [<args> ...]"
+			return runCommand(cmd, aboutText, stdin, stdout, stderr,
+				cmdName, args[2:])
+		}
+		if len(args) == 3 && args[1] == "help" && getCommand(args[2]) != nil {
+			// Invoked as "godoctor help <command>"
+			printCommandHelp(getCommand(args[2]), cmdName, stderr)
+			return 2
+		}
+	}
+
 	flags := Flags()
 	// Don't print full help unless -help was requested.
 	// Just gently remind users that it's there.
@@ -191,20 +261,25 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 				"be used with any other flags or arguments")
 			return 1
 		}
+		var err error
 		switch *flags.docFlag {
 		case "man":
-			doc.PrintManPage(aboutText, flags.FlagSet, stdout)
+			err = doc.PrintManPage(aboutText, flags.FlagSet, stdout)
 		case "install":
-			doc.PrintInstallGuide(aboutText, flags.FlagSet, stdout)
+			err = doc.PrintInstallGuide(aboutText, flags.FlagSet, stdout)
 		case "user":
-			doc.PrintUserGuide(aboutText, flags.FlagSet, stdout)
+			err = doc.PrintUserGuide(aboutText, flags.FlagSet, stdout)
 		case "vim":
-			doc.PrintVimdoc(aboutText, flags.FlagSet, stdout)
+			err = doc.PrintVimdoc(aboutText, flags.FlagSet, stdout)
 		default:
 			fmt.Fprintln(stderr, "Error: The -doc flag must be "+
 				"\"man\", \"install\", \"user\", or \"vim\"")
 			return 1
 		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
 		return 0
 	}
 
@@ -216,24 +291,20 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		}
 		if *flags.verboseFlag || *flags.veryVerboseFlag ||
 			*flags.writeFlag || *flags.completeFlag ||
-			*flags.jsonFlag {
+			*flags.patchDirFlag != "" || *flags.pipeFlag ||
+			*flags.formatPatchFlag || *flags.gitFlag {
 			fmt.Fprintln(stderr, "Error: The -list flag "+
 				"cannot be used with the -v, -vv, -w, "+
-				"-complete, or -json flags")
+				"-complete, -patchdir, -pipe, -formatpatch, "+
+				"or -git flags")
 			return 1
 		}
-		// Invoked: godoctor [-file=""] [-pos=""] [-scope=""] -list
-		fmt.Fprintf(stderr, "%-15s\t%-47s\t%s\n",
-			"Refactoring", "Description", "     Multifile?")
-		fmt.Fprintf(stderr, "--------------------------------------------------------------------------------\n")
-		for _, key := range engine.AllRefactoringNames() {
-			r := engine.GetRefactoring(key)
-			d := r.Description()
-			if !r.Description().Hidden {
-				fmt.Fprintf(stderr, "%-15s\t%-50s\t%v\n",
-					key, d.Synopsis, d.Multifile)
-			}
+		if *flags.jsonFlag {
+			// Invoked: godoctor -list -json
+			return printCatalog(stdout, stderr)
 		}
+		// Invoked: godoctor [-file=""] [-pos=""] [-scope=""] -list
+		printList(stderr)
 		return 0
 	}
 
@@ -244,13 +315,11 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 			return 1
 		}
 		// Invoked as "godoctor -json [args]
-		protocol.Run(os.Stdout, aboutText, args)
+		protocol.Run(stdout, aboutText, args)
 		return 0
 	}
 
-	if *flags.writeFlag && *flags.completeFlag {
-		fmt.Fprintln(stderr, "Error: The -w and -complete flags "+
-			"cannot both be present")
+	if !checkFlags(flags, stderr) {
 		return 1
 	}
 
@@ -260,6 +329,72 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		return 2
 	}
 
+	if len(args) > 0 && (args[0] == "history" || args[0] == "replay" ||
+		args[0] == "undo") {
+		if flags.NFlag() != 0 {
+			fmt.Fprintf(stderr, "Error: The %s command cannot "+
+				"be used with any flags\n", args[0])
+			return 1
+		}
+		switch args[0] {
+		case "history":
+			// Invoked as "godoctor history"
+			return runHistory(stdout, stderr, args[1:])
+		case "replay":
+			// Invoked as "godoctor replay n"
+			return runReplay(aboutText, stdin, stdout, stderr, cmdName, args[1:])
+		default:
+			// Invoked as "godoctor undo [n]"
+			return runUndo(stdout, stderr, cmdName, args[1:])
+		}
+	}
+
+	if len(args) > 0 && args[0] == "snapshot" {
+		if flags.NFlag() != 0 {
+			fmt.Fprintln(stderr, "Error: The snapshot command cannot "+
+				"be used with any flags")
+			return 1
+		}
+		// Invoked as "godoctor snapshot [<path> ...]"
+		return runSnapshot(stdout, stderr, cmdName, args[1:])
+	}
+
+	if *flags.reportFlag != "" && (len(args) == 0 || args[0] != "batch") {
+		fmt.Fprintln(stderr, "Error: The -report flag cannot be used "+
+			"without the apply or batch command")
+		return 1
+	}
+
+	if len(args) > 0 && args[0] == "diff" {
+		// Invoked as "godoctor [-patchdir=<dir>|-formatpatch|-git] diff"
+		return runDiff(stdout, stderr, flags, cmdName, args[1:])
+	}
+
+	if len(args) > 0 && args[0] == "debug-patch" {
+		if flags.NFlag() != 0 {
+			fmt.Fprintln(stderr, "Error: The debug-patch command cannot "+
+				"be used with any flags")
+			return 1
+		}
+		// Invoked as "godoctor debug-patch <file> <edits.json>"
+		return runDebugPatch(stdin, stdout, stderr, args[1:])
+	}
+
+	if len(args) > 0 && args[0] == "batch" {
+		// Invoked as "godoctor [flags] batch [<path> ...]"
+		return runBatch(stdout, stderr, flags, args[1:])
+	}
+
+	// Invoked as "godoctor [flags] <refactoring> [<args> ...]"
+	return runRefactoringCommand(stdin, stdout, stderr, cmdName, aboutText,
+		flags, args, false)
+}
+
+// runRefactoringCommand runs the refactoring named by the first argument
+// (unless only one refactoring is available) with the remaining arguments,
+// according to the given flags.  Its changes are output (or written to disk)
+// unless analyze is true, in which case only a summary is output.
+func runRefactoringCommand(stdin io.Reader, stdout, stderr io.Writer, cmdName, aboutText string, flags *CLIFlags, args []string, analyze bool) int {
 	var refacName string
 	if len(engine.AllRefactoringNames()) == 1 {
 		refacName = engine.AllRefactoringNames()[0]
@@ -281,7 +416,7 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		return 1
 	}
 
-	if flags.NFlag() == 0 && flags.NArg() == 1 &&
+	if flags.NFlag() == 0 && len(args) == 0 &&
 		len(engine.AllRefactoringNames()) != 1 &&
 		len(refac.Description().Params) > 0 {
 		// Invoked as "godoctor refactoring" but arguments are required
@@ -297,6 +432,11 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	if *flags.fileFlag != "" && *flags.fileFlag != "-" {
 		fileName = *flags.fileFlag
 		fileSystem = &filesystem.LocalFileSystem{}
+	} else if *flags.formatPatchFlag || *flags.gitFlag {
+		fmt.Fprintln(stderr, "Error: The -formatpatch and -git flags "+
+			"require the -file flag, since a patch cannot modify "+
+			"standard input")
+		return 1
 	} else {
 		// Filename is - or no filename given; read from standard input
 		var err error
@@ -306,7 +446,7 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 			return 1
 		}
 		fileName = stdinPath
-		if *flags.fileFlag == "" {
+		if *flags.fileFlag == "" && !*flags.pipeFlag {
 			fmt.Fprintln(stderr, "Reading Go source code from standard input...")
 		}
 		bytes, err := ioutil.ReadAll(stdin)
@@ -322,12 +462,20 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		}
 	}
 
-	selection, err := text.NewSelection(fileName, *flags.posFlag)
+	selections, err := parseSelections(fileName, *flags.posFlag, fileSystem)
 	if err != nil {
 		fmt.Fprintf(stderr, "Error: %s.\n", err)
 		return 1
 	}
 
+	var target *fingerprint.Fingerprint
+	if *flags.targetFlag != "" {
+		if target, err = fingerprint.Parse(*flags.targetFlag); err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
 	var scope []string
 	if *flags.scopeFlag == "" {
 		// If no scope provided, let refactoring.go guess the scope
@@ -340,6 +488,24 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		scope = strings.Split(*flags.scopeFlag, ",")
 	}
 
+	generatedFiles, err := refactoring.ParseGeneratedFilePolicy(*flags.generatedFlag)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+
+	preset, err := parsePreset(flags)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	if !isLogFormat(*flags.logFormatFlag) {
+		fmt.Fprintf(stderr, "Error: The -logformat flag must be %s\n",
+			quotedList(logFormats))
+		return 1
+	}
+
 	verbosity := 0
 	if *flags.verboseFlag {
 		verbosity = 1
@@ -348,83 +514,432 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		verbosity = 2
 	}
 
-	result := refac.Run(&refactoring.Config{
+	workspace := &engine.Workspace{
 		FileSystem: fileSystem,
 		Scope:      scope,
-		Selection:  selection,
-		Args:       refactoring.InterpretArgs(args, refac),
-		Verbosity:  verbosity})
-
-	// Display log in GNU-style 'file:line.col-line.col: message' format
+		Include:    splitPatterns(*flags.includeFlag),
+		Exclude:    splitPatterns(*flags.excludeFlag),
+		CacheDir:   *flags.cacheDirFlag,
+	}
+	request := &engine.Request{
+		Refactoring:    refacName,
+		Selection:      selections[0],
+		Target:         target,
+		Args:           args,
+		Preset:         preset,
+		GeneratedFiles: generatedFiles,
+		Verbosity:      verbosity,
+	}
 	cwd, err := os.Getwd()
 	if err != nil {
 		cwd = ""
 	}
-	result.Log.Write(stderr, cwd)
+	var result *changes
+	var apply func() error
+	var hasErrors bool
+	var debugOutput string
+	var selected *fingerprint.Fingerprint // Recorded in the journal
+	if len(selections) == 1 {
+		refactored, err := workspace.Refactor(request)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+		result, apply = changesOf(refactored), refactored.Apply
+		hasErrors = refactored.HasErrors()
+		debugOutput = refactored.DebugOutput()
+		selected = refactored.Target()
+
+		// Display log in GNU-style 'file:line.col-line.col: message'
+		// format, or in the format requested by -logformat
+		if err := refactored.WriteMessages(stderr, *flags.logFormatFlag, cwd); err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	} else {
+		// Invoked with -pos=/regexp/g
+		if *flags.logFormatFlag != "text" || target != nil {
+			fmt.Fprintln(stderr, "Error: The -logformat and -target "+
+				"flags cannot be used when a refactoring is applied "+
+				"to every match of a regular expression")
+			return 1
+		}
+		result, apply, err = refactorEach(stderr, workspace, request,
+			selections, cwd)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		} else if result == nil {
+			return 3
+		}
+	}
 
 	// If input was supplied on standard input, ensure that the refactoring
-	// makes changes only to that code (and does not affect any other files)
+	// makes changes only to that code (and does not affect any other files).
+	// In -pipe mode, changes to other files are discarded with a warning.
+	if *flags.pipeFlag {
+		discardOtherChanges(stderr, result, stdinPath, cwd)
+	}
 	if stdinPath != "" {
-		for f := range result.Edits {
+		for f := range result.edits {
 			if f != stdinPath {
 				fmt.Fprintf(stderr, "Error: When source code is given on standard input, refactorings are prohibited from changing any other files.  This refactoring would require modifying %s.\n", f)
 				return 1
 			}
 		}
+		if len(result.fsChanges) > 0 {
+			fmt.Fprintf(stderr, "Error: When source code is given on standard input, refactorings are prohibited from changing any other files.  This refactoring would require the following change: %s.\n", result.fsChanges[0].String(cwd))
+			return 1
+		}
 	}
 
-	debugOutput := result.DebugOutput.String()
 	if len(debugOutput) > 0 {
 		fmt.Fprintln(stdout, debugOutput)
 	}
 
-	if *flags.writeFlag {
-		err = writeToDisk(result, fileSystem)
+	if analyze {
+		err = writeAnalysis(stdout, result, hasErrors, fileSystem, cwd)
+	} else if *flags.pipeFlag {
+		if hasErrors {
+			// Like gofmt, output nothing if there are errors
+			return 3
+		}
+		err = writePipeOutput(stdout, result.edits[stdinPath], fileSystem, stdinPath)
+	} else if *flags.writeFlag {
+		var before map[string][]byte
+		var stats *text.EditStats
+		before, err = readFiles(result.edits, fileSystem)
+		if err == nil && verbosity > 0 {
+			stats, err = editStats(result.edits, fileSystem)
+		}
+		if err == nil {
+			err = apply()
+		}
+		if err == nil && stdinPath == "" {
+			err = recordInJournal(cwd, flags, refacName, args,
+				selected, result, before, fileSystem)
+		}
+		if err == nil && stats != nil {
+			fmt.Fprintln(stderr, stats)
+		}
 	} else if *flags.completeFlag {
-		err = writeFileContents(stdout, result.Edits, fileSystem)
+		err = writeFileContents(stdout, result.edits, fileSystem)
+		writeFSChanges(stderr, result.fsChanges, cwd)
+	} else if *flags.patchDirFlag != "" {
+		edits, diffFS := result.edits, fileSystem
+		if *flags.gofmtFlag {
+			edits, diffFS, err = gofmtEdits(edits, diffFS)
+		}
+		if err == nil {
+			err = writePatchFiles(stdout, *flags.patchDirFlag, edits, diffFS)
+		}
+		writeFSChanges(stderr, result.fsChanges, cwd)
+	} else if *flags.formatPatchFlag {
+		d := refac.Description()
+		var remaining []filesystem.Change
+		remaining, err = writeFormatPatch(stdout,
+			strings.Join(append([]string{d.Name}, args...), " "),
+			fmt.Sprintf("%s.\n\nThis change was made by running:\n\n    %s\n",
+				d.Synopsis, commandLine(cmdName, flags, refacName, args)),
+			result.edits, result.fsChanges, fileSystem)
+		writeFSChanges(stderr, remaining, cwd)
+	} else if *flags.gitFlag {
+		var remaining []filesystem.Change
+		remaining, err = writeGitDiff(stdout, result.edits,
+			result.fsChanges, fileSystem)
+		writeFSChanges(stderr, remaining, cwd)
 	} else {
-		err = writeDiff(stdout, result.Edits, fileSystem)
+		edits, diffFS := result.edits, fileSystem
+		if *flags.gofmtFlag {
+			edits, diffFS, err = gofmtEdits(edits, diffFS)
+		}
+		if err == nil {
+			err = writeDiff(stdout, edits, diffFS)
+		}
+		writeFSChanges(stderr, result.fsChanges, cwd)
 	}
 	if err != nil {
 		fmt.Fprintf(stderr, "Error: %s.\n", err)
 		return 1
 	}
 
-	if result.Log.ContainsErrors() {
+	if hasErrors {
 		return 3
 	} else {
 		return 0
 	}
 }
 
+// checkFlags returns true if the output flags (-w, -complete, -patchdir,
+// -pipe, -formatpatch, -git, and -gofmt) are compatible.  Otherwise, it outputs an
+// error message and returns false.
+func checkFlags(flags *CLIFlags, stderr io.Writer) bool {
+	if *flags.writeFlag && *flags.completeFlag {
+		fmt.Fprintln(stderr, "Error: The -w and -complete flags "+
+			"cannot both be present")
+		return false
+	}
+
+	if *flags.patchDirFlag != "" && (*flags.writeFlag || *flags.completeFlag) {
+		fmt.Fprintln(stderr, "Error: The -patchdir flag cannot be "+
+			"used with the -w or -complete flags")
+		return false
+	}
+
+	if *flags.pipeFlag && (*flags.writeFlag || *flags.completeFlag ||
+		*flags.patchDirFlag != "" ||
+		(*flags.fileFlag != "" && *flags.fileFlag != "-")) {
+		fmt.Fprintln(stderr, "Error: The -pipe flag cannot be used "+
+			"with the -w, -complete, -patchdir, or -file flags")
+		return false
+	}
+
+	if *flags.formatPatchFlag && (*flags.writeFlag || *flags.completeFlag ||
+		*flags.patchDirFlag != "" || *flags.pipeFlag) {
+		fmt.Fprintln(stderr, "Error: The -formatpatch flag cannot be "+
+			"used with the -w, -complete, -patchdir, or -pipe flags")
+		return false
+	}
+
+	if *flags.gitFlag && (*flags.writeFlag || *flags.completeFlag ||
+		*flags.patchDirFlag != "" || *flags.pipeFlag ||
+		*flags.formatPatchFlag) {
+		fmt.Fprintln(stderr, "Error: The -git flag cannot be used "+
+			"with the -w, -complete, -patchdir, -pipe, or "+
+			"-formatpatch flags")
+		return false
+	}
+
+	// A diff of the gofmt-formatted files may not apply to the original
+	// files, so -gofmt is only allowed when a diff is displayed
+	if *flags.gofmtFlag && (*flags.writeFlag || *flags.completeFlag ||
+		*flags.pipeFlag || *flags.formatPatchFlag || *flags.gitFlag) {
+		fmt.Fprintln(stderr, "Error: The -gofmt flag cannot be used "+
+			"with the -w, -complete, -pipe, -formatpatch, or -git "+
+			"flags")
+		return false
+	}
+	return true
+}
+
+// logFormats are the values accepted by the -logformat flag.
+var logFormats = []string{"text", "sarif", "checkstyle", "junit"}
+
+// isLogFormat returns true if the given string is one of the logFormats.
+func isLogFormat(format string) bool {
+	for _, f := range logFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedList returns the given strings, quoted and separated by commas, with
+// "or" before the last, e.g., "a", "b", or "c".
+func quotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	if len(quoted) < 3 {
+		return strings.Join(quoted, " or ")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + ", or " +
+		quoted[len(quoted)-1]
+}
+
+// splitPatterns splits a comma-separated list of glob patterns, as given to
+// the -include and -exclude flags.
+func splitPatterns(patterns string) []string {
+	if patterns == "" {
+		return nil
+	}
+	return strings.Split(patterns, ",")
+}
+
+// parsePreset returns the name of the preset given by the -preset flag, or
+// the empty string if the flag was not given.
+func parsePreset(flags *CLIFlags) (string, error) {
+	if *flags.presetFlag == "" {
+		return "", nil
+	}
+	if engine.GetPreset(*flags.presetFlag) == nil {
+		return "", fmt.Errorf("The -preset flag must be %s",
+			quotedList(engine.AllPresetNames()))
+	}
+	generated := false
+	flags.Visit(func(f *flag.Flag) {
+		generated = generated || f.Name == "generated"
+	})
+	if generated {
+		return "", fmt.Errorf("The -preset and -generated flags " +
+			"cannot both be present")
+	}
+	return *flags.presetFlag, nil
+}
+
+// discardOtherChanges removes any edits to files other than the given file
+// (which was read from standard input), as well as any other file system
+// changes, from the result, logging a warning for each, so that only the
+// given file is output in -pipe mode.
+func discardOtherChanges(stderr io.Writer, result *changes, stdinPath, cwd string) {
+	filenames := []string{}
+	for f := range result.edits {
+		if f != stdinPath {
+			filenames = append(filenames, f)
+		}
+	}
+	sort.Strings(filenames)
+	for _, f := range filenames {
+		fmt.Fprintf(stderr, "Warning: This refactoring would also modify %s, but only standard input can be modified when -pipe is used, so those changes were discarded.\n", relativePath(f))
+		delete(result.edits, f)
+	}
+	for _, change := range result.fsChanges {
+		fmt.Fprintf(stderr, "Warning: This refactoring would also make the following change, but it was discarded since -pipe is used: %s.\n", change.String(cwd))
+	}
+	result.fsChanges = nil
+}
+
+// writePipeOutput writes the complete contents of the given file, after the
+// given edits have been applied, to out.  If edits is nil, the file's
+// contents are written unchanged.
+func writePipeOutput(out io.Writer, edits *text.EditSet, fs filesystem.FileSystem, filename string) error {
+	if edits == nil {
+		edits = text.NewEditSet()
+	}
+	data, err := filesystem.ApplyEdits(edits, fs, filename)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
 // writeDiff outputs a multi-file unified diff describing this refactoring's
 // changes.  It can be applied using GNU patch.
 func writeDiff(out io.Writer, edits map[string]*text.EditSet, fs filesystem.FileSystem) error {
-	for f, e := range edits {
-		p, err := filesystem.CreatePatch(e, fs, f)
+	mp, err := filesystem.CreateMultiPatch(edits, fs)
+	if err != nil {
+		return err
+	}
+	for _, f := range mp.Filenames() {
+		if p := mp.Patch(f); !p.IsEmpty() {
+			if err := writePatch(out, f, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// editStats returns the number of files changed and lines inserted and
+// deleted by the given edits (as they would appear in a diff).
+func editStats(edits map[string]*text.EditSet, fs filesystem.FileSystem) (*text.EditStats, error) {
+	mp, err := filesystem.CreateMultiPatch(edits, fs)
+	if err != nil {
+		return nil, err
+	}
+	return mp.Stats()
+}
+
+// writePatch outputs a unified diff for a single file, including a "diff -u"
+// header line.  Hunks that move blocks of lines are annotated as such (see
+// text.Patch.DetectMoves).  If out is a terminal, the diff is colored.
+func writePatch(out io.Writer, filename string, p *text.Patch) error {
+	if _, err := p.DetectMoves(); err != nil {
+		return err
+	}
+	inFile := filename
+	outFile := filename
+	stdinPath, _ := filesystem.FakeStdinPath()
+	if filename == stdinPath {
+		inFile = os.Stdin.Name()
+		outFile = os.Stdout.Name()
+	} else {
+		rel := relativePath(filename)
+		inFile = rel
+		outFile = rel
+	}
+	header := fmt.Sprintf("diff -u %s %s\n", inFile, outFile)
+	if useColor(out) {
+		out.Write(text.ColorizeDiff([]byte(header)))
+		return p.WriteColored(inFile, outFile, time.Time{}, time.Time{}, out)
+	}
+	fmt.Fprint(out, header)
+	return p.Write(inFile, outFile, time.Time{}, time.Time{}, out)
+}
+
+// useColor returns true if diffs written to the given writer should be
+// colored, i.e., if it is a terminal, the NO_COLOR environment variable is not
+// set, and TERM is not "dumb".
+func useColor(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writePatchFiles writes a separate unified diff for each file affected by
+// this refactoring into the given directory (which is created if it does not
+// exist), so that the changes can be reviewed and applied one file at a time.
+// The name of each patch file is derived from the path of the file it
+// modifies; the names of the patch files are written to out.
+func writePatchFiles(out io.Writer, dir string, edits map[string]*text.EditSet, fs filesystem.FileSystem) error {
+	filenames := make([]string, 0, len(edits))
+	for f := range edits {
+		filenames = append(filenames, f)
+	}
+	sort.Strings(filenames)
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	for _, f := range filenames {
+		p, err := filesystem.CreatePatch(edits[f], fs, f)
 		if err != nil {
 			return err
 		}
+		if p.IsEmpty() {
+			continue
+		}
 
-		if !p.IsEmpty() {
-			inFile := f
-			outFile := f
-			stdinPath, _ := filesystem.FakeStdinPath()
-			if f == stdinPath {
-				inFile = os.Stdin.Name()
-				outFile = os.Stdout.Name()
-			} else {
-				rel := relativePath(f)
-				inFile = rel
-				outFile = rel
-			}
-			fmt.Fprintf(out, "diff -u %s %s\n", inFile, outFile)
-			p.Write(inFile, outFile, time.Time{}, time.Time{}, out)
+		name := patchFileName(f)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s.%d", patchFileName(f), i)
+		}
+		used[name] = true
+
+		var buf bytes.Buffer
+		if err := writePatch(&buf, f, p); err != nil {
+			return err
 		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, path)
 	}
 	return nil
 }
 
+// patchFileName returns the name of the patch file that will contain the
+// changes to the given file: its path relative to the current directory, with
+// path separators replaced by underscores, followed by ".patch".
+func patchFileName(filename string) string {
+	stdinPath, _ := filesystem.FakeStdinPath()
+	if filename == stdinPath {
+		return "stdin.patch"
+	}
+	rel := filepath.ToSlash(relativePath(filename))
+	rel = strings.TrimLeft(strings.Replace(rel, "../", "", -1), "/")
+	return strings.Replace(rel, "/", "_", -1) + ".patch"
+}
+
 // relativePath returns a relative path to fname, or fname if a relative path
 // cannot be computed due to an error
 func relativePath(fname string) string {
@@ -468,30 +983,78 @@ func writeFileContents(out io.Writer, edits map[string]*text.EditSet, fs filesys
 	return nil
 }
 
+// writeFSChanges describes the file system changes (other than edits to
+// existing files) that this refactoring requires, since these cannot be
+// expressed in a patch.
+func writeFSChanges(out io.Writer, changes []filesystem.Change, cwd string) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "This refactoring also requires the following file system changes (use -w to apply them):")
+	for _, change := range changes {
+		fmt.Fprintf(out, "    %s\n", change.String(cwd))
+	}
+}
+
+// changes are the changes a command outputs or writes to disk: the edits to
+// each file, keyed by absolute path, and any other changes to the file
+// system, either from a single refactoring (see changesOf) or combined from
+// several (see refactorEach and the batch command).
+type changes struct {
+	edits     map[string]*text.EditSet
+	fsChanges []filesystem.Change
+	// Checksums of the files' original contents (see writeToDisk)
+	checksums map[string]string
+}
+
+// changesOf returns the changes made by the given refactoring.
+func changesOf(refactored *engine.Result) *changes {
+	result := &changes{
+		edits:     map[string]*text.EditSet{},
+		fsChanges: refactored.FileSystemChanges(),
+		checksums: map[string]string{},
+	}
+	for _, filename := range refactored.Files() {
+		result.edits[filename] = refactored.Edits(filename)
+		if checksum, ok := refactored.Checksum(filename); ok {
+			result.checksums[filename] = checksum
+		}
+	}
+	return result
+}
+
 // writeToDisk overwrites existing files with their refactored versions and
 // applies any other changes to the file system that the refactoring requires
-// (e.g., renaming directories).
-func writeToDisk(result *refactoring.Result, fs filesystem.FileSystem) error {
-	for filename, edits := range result.Edits {
-		data, err := filesystem.ApplyEdits(edits, fs, filename)
-		if err != nil {
-			return err
-		}
+// (e.g., renaming directories).  If any file was modified after the
+// refactoring analyzed it (see engine.Result.Checksum), nothing is written,
+// and a *filesystem.ModifiedFileError is returned.
+func writeToDisk(result *changes, fs filesystem.FileSystem) error {
+	return filesystem.WriteChanges(fs, result.edits, result.fsChanges,
+		result.checksums)
+}
 
-		f, err := fs.OverwriteFile(filename)
-		if err != nil {
-			return err
-		}
-		n, err := f.Write(data)
-		if err == nil && n < len(data) {
-			err = io.ErrShortWrite
-		}
-		if err1 := f.Close(); err == nil {
-			err = err1
-		}
-		if err != nil {
-			return err
+// printList outputs a table listing the refactorings that are not hidden.
+func printList(out io.Writer) {
+	fmt.Fprintf(out, "%-15s\t%-47s\t%s\n",
+		"Refactoring", "Description", "     Multifile?")
+	fmt.Fprintf(out, "--------------------------------------------------------------------------------\n")
+	for _, key := range engine.AllRefactoringNames() {
+		d := engine.GetRefactoring(key).Description()
+		if !d.Hidden {
+			fmt.Fprintf(out, "%-15s\t%-50s\t%v\n",
+				key, d.Synopsis, d.Multifile)
 		}
 	}
-	return nil
+}
+
+// printCatalog outputs the refactoring catalog (see engine.Catalog) as JSON,
+// so that clients can generate menus for all of the available refactorings.
+func printCatalog(stdout, stderr io.Writer) int {
+	data, err := json.MarshalIndent(engine.Catalog(), "", "\t")
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\n", data)
+	return 0
 }
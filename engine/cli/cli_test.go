@@ -6,13 +6,17 @@ package cli_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/godoctor/godoctor/engine"
 	"github.com/godoctor/godoctor/engine/cli"
+	"github.com/godoctor/godoctor/engine/journal"
 	"github.com/godoctor/godoctor/refactoring"
 	"github.com/godoctor/godoctor/text"
 )
@@ -37,7 +41,9 @@ func main() {
  func main() {
 -	fmt.Println(こんにちはmsg)
 +	fmt.Println(renamedネーム)
- }`
+ }
+\ No newline at end of file
+`
 
 	complete = `@@@@@ /dev/stdin @@@@@ 119 @@@@@
 package main
@@ -124,13 +130,149 @@ func TestList(t *testing.T) {
 		t.Fatalf("-list expected refactoring list with exit 0")
 	}
 
-	for _, flag := range []string{"-doc=man", "-w", "-complete", "-json"} {
+	for _, flag := range []string{"-doc=man", "-w", "-complete"} {
 		exit, stdout, stderr = runCLI("", flag, "-list")
 		if exit != 1 || stdout != "" || !strings.Contains(stderr,
 			"cannot be used with") {
 			t.Fatalf("-list should fail and exit 1 if used with %s", flag)
 		}
 	}
+
+	exit, stdout, stderr = runCLI("", "-list", "-json")
+	if exit != 0 || stderr != "" {
+		t.Fatalf("-list -json expected refactoring catalog with exit 0")
+	}
+	var catalog []*engine.CatalogEntry
+	if err := json.Unmarshal([]byte(stdout), &catalog); err != nil {
+		t.Fatalf("-list -json produced invalid JSON: %s", err)
+	}
+	if len(catalog) == 0 || catalog[0].ShortName != "rename" ||
+		catalog[0].Selection == "" || len(catalog[0].Params) == 0 {
+		t.Fatalf("-list -json produced an incomplete catalog:\n%s", stdout)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	exit, stdout, _ := runCLI("", "list")
+	if exit != 0 || !strings.Contains(stdout, "rename") {
+		t.Fatalf("list expected refactoring list with exit 0; got %d\n%s", exit, stdout)
+	}
+	exit, stdout, _ = runCLI("", "list", "-json")
+	var catalog []*engine.CatalogEntry
+	if exit != 0 || json.Unmarshal([]byte(stdout), &catalog) != nil || len(catalog) == 0 {
+		t.Fatalf("list -json expected refactoring catalog with exit 0; got %d\n%s", exit, stdout)
+	}
+
+	exit, stdout, _ = runCLI("", "params", "rename")
+	if exit != 0 || !strings.Contains(stdout, "run [<flag> ...] rename <new_name>") ||
+		!strings.Contains(stdout, "New Name:") {
+		t.Fatalf("params rename expected usage and parameters; got %d\n%s", exit, stdout)
+	}
+	exit, stdout, _ = runCLI("", "params", "-json", "rename")
+	var entry engine.CatalogEntry
+	if exit != 0 || json.Unmarshal([]byte(stdout), &entry) != nil || entry.ShortName != "rename" {
+		t.Fatalf("params -json rename expected catalog entry; got %d\n%s", exit, stdout)
+	}
+	exit, _, stderr := runCLI("", "params", "nosuchrefactoring")
+	if exit != 1 || !strings.Contains(stderr, "There is no refactoring") {
+		t.Fatalf("params with an invalid refactoring expected exit 1; got %d\n%s", exit, stderr)
+	}
+
+	exit, stdout, stderr = runCLI(hello, "run", "-file=-", "-scope=-", pos, "rename", "renamedネーム")
+	if exit != 0 || stdout != diff {
+		t.Fatalf("run rename expected a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, stderr = runCLI(hello, "analyze", "-file=-", "-scope=-", pos, "rename", "renamedネーム")
+	if exit != 0 || !strings.Contains(stdout, "1 file changed, 2 insertions(+), 2 deletions(-)") {
+		t.Fatalf("analyze rename expected a summary; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, _ = runCLI(hello, "analyze", "-file=-", "-scope=-", pos, "rename", "fmt")
+	if exit != 3 || !strings.Contains(stdout, "cannot be applied") {
+		t.Fatalf("analyze with errors expected exit 3; got %d\n%s", exit, stdout)
+	}
+	exit, stdout, _ = runCLI("", "serve", `[{"command":"about"}]`)
+	if exit != 0 || stdout != `{"reply":"OK","text":"Go Doctor TEST"}`+"\n" {
+		t.Fatalf("serve expected a reply on stdout; got %d\n%s", exit, stdout)
+	}
+
+	for _, args := range [][]string{
+		{"run", "-list", "rename"},
+		{"analyze", "-w", "rename"},
+		{"apply", "-file=main.go"},
+		{"batch", "-pos=1,1:1,1"},
+		{"list", "-v"},
+		{"history", "-v"},
+		{"replay", "-w", "1"},
+		{"undo", "-w"},
+		{"snapshot", "-v"},
+		{"diff", "-w"},
+		{"debug-patch", "-v"},
+	} {
+		exit, stdout, stderr = runCLI("", args...)
+		if exit != 1 || stdout != "" || !strings.Contains(stderr, "flag provided but not defined") {
+			t.Fatalf("Expected %s to reject the flag; got %d\n%s", strings.Join(args, " "), exit, stderr)
+		}
+	}
+	for _, args := range [][]string{{"help", "run"}, {"run", "-help"}, {"run"}} {
+		exit, stdout, stderr = runCLI("", args...)
+		if exit != 2 || stdout != "" || !strings.Contains(stderr, "Usage: godoctor run [<flag> ...] <refactoring>") {
+			t.Fatalf("Expected help for the run command from %s; got %d\n%s", strings.Join(args, " "), exit, stderr)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		exit, stdout, stderr := runCLI("", "completion", shell)
+		if exit != 0 || !strings.Contains(stdout, "godoctor completion __complete") {
+			t.Fatalf("completion %s expected a script; got %d\n%s\n%s", shell, exit, stdout, stderr)
+		}
+	}
+	exit, _, stderr := runCLI("", "completion", "csh")
+	if exit != 1 || !strings.Contains(stderr, "The shell must be") {
+		t.Fatalf("completion with an invalid shell expected exit 1; got %d\n%s", exit, stderr)
+	}
+
+	expected := map[string][]string{
+		"run ren":          {"rename"},
+		"-list -js":        {"-json"},
+		"run -pre":         {"-preset"},
+		"run -preset=":     {"-preset=safe", "-preset=aggressive"},
+		"-generated s":     {"skip"},
+		"-file main.go -v": {"-v", "-vv"},
+		"help li":          {"list"},
+		"completion ":      {"bash", "zsh", "fish"},
+		"apply -l":         {},
+		"params rename ":   {},
+	}
+	for line, want := range expected {
+		args := append([]string{"completion", "__complete"}, strings.Split(line, " ")...)
+		exit, stdout, _ := runCLI("", args...)
+		got := []string{}
+		for _, l := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+			if l != "" {
+				got = append(got, strings.Split(l, "\t")[0])
+			}
+		}
+		if exit != 0 || strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Completing %q: expected %v, got %v", line, want, got)
+		}
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	kinds := []string{}
+	engine.AddObserver(func(e *engine.Event) {
+		kinds = append(kinds, e.Refactoring+" "+e.Kind.String())
+	})
+	defer engine.ClearObservers()
+	runCLI(hello, "-scope=-", pos, "rename", "renamedネーム")
+	runCLI(hello, "-scope=-", pos, "rename", "fmt")
+	expected := "rename started, rename editsComputed, " +
+		"rename started, rename preconditionsFailed"
+	if strings.Join(kinds, ", ") != expected {
+		t.Fatalf("Expected events %s; got %s", expected, strings.Join(kinds, ", "))
+	}
 }
 
 func TestInvalidCombos(t *testing.T) {
@@ -142,7 +284,6 @@ func TestInvalidCombos(t *testing.T) {
 		{"-complete", "-w"},
 		{"-file=-", "-json"},
 		{"-file=-", "-doc=man"},
-		{"-json", "-list"},
 		{"-json", "-doc=man"},
 		{"-json", "-pos=1,1:1,1"},
 		{"-json", "-scope=golang.org/x/tools"},
@@ -151,12 +292,27 @@ func TestInvalidCombos(t *testing.T) {
 		{"-list", "-doc=man"},
 		{"-list", "-v"},
 		{"-list", "-w"},
+		{"-list", "-patchdir=zz_patches"},
+		{"-patchdir=zz_patches", "-complete"},
+		{"-patchdir=zz_patches", "-w"},
+		{"-pipe", "-w"},
+		{"-pipe", "-complete"},
+		{"-pipe", "-file=main.go"},
+		{"-formatpatch", "-w"},
+		{"-formatpatch", "-patchdir=zz_patches"},
+		{"-git", "-w"},
+		{"-git", "-formatpatch"},
+		{"-list", "-formatpatch"},
+		{"-list", "-pipe"},
 		{"-list", "somearg"},
 		{"-doc=man", "-pos=1,1:1,1"},
 		{"-doc=man", "-scope=golang.org/x/tools"},
 		{"-doc=man", "-v"},
 		{"-doc=man", "-w"},
 		{"-doc=man", "somearg"},
+		{"-v", "history"},
+		{"-w", "replay", "1"},
+		{"-w", "undo"},
 	}
 	for _, flags := range invalid {
 		exit, stdout, stderr := runCLI("", flags...)
@@ -222,6 +378,390 @@ func TestRenameComplete(t *testing.T) {
 	}
 }
 
+func TestRenamePatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "patches")
+
+	exit, stdout, stderr := runCLI(hello, "-scope=-", pos, "-patchdir="+dir, "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d", exit)
+	}
+	patchFile := filepath.Join(dir, "stdin.patch")
+	if stdout != patchFile+"\n" {
+		t.Fatalf("Expected patch file name %s; got:\n%s\n%s",
+			patchFile, stdout, stderr)
+	}
+	contents, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != diff {
+		t.Fatalf("Patch file did not match expected diff:\n%s",
+			string(contents))
+	}
+}
+
+func TestRenameFormatPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("main.go", []byte(hello+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, stdout, stderr := runCLI("", "-file=main.go", "-scope=main.go", pos, "-formatpatch", "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	for _, line := range []string{
+		"From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001",
+		"Subject: [PATCH] Rename renamedネーム",
+		"    godoctor -file=main.go -pos=3,5:3,5 -scope=main.go rename renamedネーム",
+		"---",
+		" main.go | 4 ++--",
+		" 1 file changed, 2 insertions(+), 2 deletions(-)",
+		"diff --git a/main.go b/main.go",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"+var renamedネーム string = \"Hello, package\"",
+		"-- ",
+	} {
+		if !strings.Contains(stdout, "\n"+line+"\n") &&
+			!strings.HasPrefix(stdout, line+"\n") {
+			t.Fatalf("Expected patch to contain %q; got:\n%s", line, stdout)
+		}
+	}
+
+	exit, _, stderr = runCLI(hello, "-formatpatch", "rename", "renamedネーム")
+	if exit != 1 || !strings.Contains(stderr, "require the -file flag") {
+		t.Fatalf("-formatpatch with stdin expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestRunTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("main.go", []byte(hello+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, _, stderr := runCLI("", "run", "-file=main.go", "-scope=main.go", pos, "-w", "rename", "renamed")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	entries, err := journal.Load(".")
+	if err != nil || len(entries) != 1 || entries[0].Target == "" {
+		t.Fatalf("Expected a journal entry with a target (%v)", err)
+	}
+
+	// The journal records the variable's fingerprint before it was
+	// renamed; it is found even though the -pos flag is not given
+	target := "-target=" + strings.Replace(entries[0].Target, "こんにちはmsg", "renamed", 1)
+	exit, stdout, stderr := runCLI("", "run", "-file=main.go", "-scope=main.go", target, "rename", "again")
+	if exit != 0 || !strings.Contains(stdout, "+var again string") {
+		t.Fatalf("run -target expected exit code 0 and a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, stderr = runCLI("", "analyze", "-file=main.go", "-scope=main.go", target, "rename", "again")
+	if exit != 0 || !strings.Contains(stdout, "1 file changed") {
+		t.Fatalf("analyze -target expected exit code 0 and a summary; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+}
+
+func TestRenameGit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("main.go", []byte(hello+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, stdout, stderr := runCLI("", "-file=main.go", "-scope=main.go", pos, "-git", "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	expected := "diff --git a/main.go b/main.go\n" +
+		"index " + text.GitBlobID([]byte(hello + "\n"))[:7] + ".."
+	if !strings.HasPrefix(stdout, expected) {
+		t.Fatalf("Expected diff to begin with %q; got:\n%s", expected, stdout)
+	}
+	for _, line := range []string{
+		"--- a/main.go",
+		"+++ b/main.go",
+		"+var renamedネーム string = \"Hello, package\"",
+	} {
+		if !strings.Contains(stdout, "\n"+line+"\n") {
+			t.Fatalf("Expected diff to contain %q; got:\n%s", line, stdout)
+		}
+	}
+
+	exit, _, stderr = runCLI(hello, "-git", "rename", "renamedネーム")
+	if exit != 1 || !strings.Contains(stderr, "require the -file flag") {
+		t.Fatalf("-git with stdin expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	src := `package main
+
+func main() {
+	var x int = 3
+	println(x)
+}
+
+func broken() {
+	if {
+	}
+}
+`
+	// The syntax error is in a different function, so the refactoring
+	// proceeds, reporting the error as a warning
+	exit, stdout, stderr := runCLI(src, "-scope=-", "-pos=4,2:4,15", "toggle")
+	if exit != 0 || !strings.Contains(stdout, "+	x := 3") {
+		t.Fatalf("Toggle expected exit code 0 and a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "9:5: Warning: Syntax error: missing condition in if statement") {
+		t.Fatalf("Expected a syntax error warning with its position; got:\n%s", stderr)
+	}
+
+	// The syntax error is in the selected function, so the refactoring
+	// fails
+	exit, _, stderr = runCLI(src, "-scope=-", "-pos=9,2:9,2", "toggle")
+	if exit != 3 || !strings.Contains(stderr, "9:5: Error: Syntax error: missing condition in if statement") {
+		t.Fatalf("Toggle expected exit code 3 and a syntax error; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestRegexpPos(t *testing.T) {
+	src := `package main
+
+func main() {
+	var x int = 3
+	var y int = 4
+	println(x, y)
+}
+`
+	exit, stdout, stderr := runCLI(src, "-scope=-", `-pos=/var \w+ int = \d+/`, "-complete", "toggle")
+	if exit != 0 || !strings.Contains(stdout, "x := 3") || !strings.Contains(stdout, "var y int = 4") {
+		t.Fatalf("Toggle of the first match expected exit code 0 and x := 3; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exit, stdout, stderr = runCLI(src, "-scope=-", `-pos=/var \w+ int = \d+/g`, "-complete", "toggle")
+	if exit != 0 || !strings.Contains(stdout, "x := 3") || !strings.Contains(stdout, "y := 4") {
+		t.Fatalf("Toggle of every match expected exit code 0 and both declarations toggled; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "Match 2 of 2") {
+		t.Fatalf("Expected each match to be reported; got:\n%s", stderr)
+	}
+
+	// Only the parenthesized subexpression is selected
+	exit, stdout, stderr = runCLI(src, "-scope=-", "-pos=/(y) int/", "rename", "z")
+	if exit != 0 || !strings.Contains(stdout, "+	println(x, z)") {
+		t.Fatalf("Rename expected exit code 0 and a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	// Renaming the first match renames the others, so they are skipped
+	exit, stdout, stderr = runCLI(src, "-scope=-", "-pos=/x/g", "rename", "z")
+	if exit != 0 || !strings.Contains(stdout, "+	println(z, y)") {
+		t.Fatalf("Rename of every match expected exit code 0 and a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "Match 2 of 2: ") || !strings.Contains(stderr, "skipping") {
+		t.Fatalf("Expected the second match to be skipped; got:\n%s", stderr)
+	}
+
+	exit, _, stderr = runCLI(src, "-scope=-", "-pos=/nothing/", "rename", "z")
+	if exit != 1 || !strings.Contains(stderr, "does not match") {
+		t.Fatalf("Expected exit code 1 when the regexp does not match; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestGofmtDiff(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\tx, y := 1, \"s\"\n\tprintln(x,   y)\n}\n"
+	// Toggle reformats the file, so println's arguments are reformatted
+	exit, stdout, stderr := runCLI(src, "-scope=-", `-pos=/x, y := 1, "s"/`, "toggle")
+	if exit != 0 || !strings.Contains(stdout, "-\tprintln(x,   y)") {
+		t.Fatalf("Toggle expected exit code 0 and a formatting change; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exit, stdout, stderr = runCLI(src, "-scope=-", `-pos=/x, y := 1, "s"/`, "-gofmt", "toggle")
+	if exit != 0 || !strings.Contains(stdout, "+\tvar y string = \"s\"\n \tprintln(x, y)\n") {
+		t.Fatalf("Toggle with -gofmt expected exit code 0 and no formatting changes; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exit, _, stderr = runCLI(src, "-scope=-", "-pos=4,2:4,2", "-gofmt", "-complete", "toggle")
+	if exit != 1 || !strings.Contains(stderr, "-gofmt") {
+		t.Fatalf("Expected exit code 1 for -gofmt with -complete; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestRenameGenerated(t *testing.T) {
+	generated := "// Code generated by hand. DO NOT EDIT.\n\n" + hello
+	exit, stdout, stderr := runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-generated=skip", "rename", "renamedネーム")
+	if exit != 0 || stdout != "" {
+		t.Fatalf("Rename with -generated=skip expected exit code 0 and no output; got %d\n%s", exit, stdout)
+	}
+	if !strings.Contains(stderr, "generated file") {
+		t.Fatalf("Expected warning about generated file; got:\n%s", stderr)
+	}
+
+	exit, stdout, stderr = runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-generated=fail", "rename", "renamedネーム")
+	if exit != 3 || stdout != "" {
+		t.Fatalf("Rename with -generated=fail expected exit code 3 and no output; got %d\n%s", exit, stdout)
+	}
+
+	exit, stdout, stderr = runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-generated=edit", "rename", "renamedネーム")
+	if exit != 0 || !strings.Contains(stdout, "+var renamedネーム") {
+		t.Fatalf("Rename with -generated=edit expected a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exit, _, _ = runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-generated=maybe", "rename", "renamedネーム")
+	if exit != 1 {
+		t.Fatalf("Invalid -generated policy expected exit code 1; got %d", exit)
+	}
+}
+
+func TestRenamePreset(t *testing.T) {
+	generated := "// Code generated by hand. DO NOT EDIT.\n\n" + hello
+	exit, stdout, stderr := runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-preset=safe", "rename", "renamedネーム")
+	if exit != 0 || stdout != "" || !strings.Contains(stderr, "generated file, so it was not modified") {
+		t.Fatalf("Rename with -preset=safe expected a generated file to be skipped; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, stderr = runCLI(generated, "-scope=-", "-pos=5,5:5,5", "-preset=aggressive", "rename", "renamedネーム")
+	if exit != 0 || !strings.Contains(stdout, "+var renamedネーム") || !strings.Contains(stderr, "generated file, but it was modified") {
+		t.Fatalf("Rename with -preset=aggressive expected a diff and a warning; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	commented := strings.Replace(hello, "func main", "// Prints こんにちはmsg\nfunc main", 1)
+	exit, stdout, stderr = runCLI(commented, "-scope=-", pos, "-preset=safe", "rename", "renamedネーム")
+	if exit != 0 || !strings.Contains(stdout, "+var renamedネーム") || strings.Contains(stdout, "+// Prints") ||
+		!strings.Contains(stderr, "(line 4) was not modified") {
+		t.Fatalf("Rename with -preset=safe expected a diff not changing the comment; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, stderr = runCLI(commented, "-scope=-", pos, "-preset=aggressive", "rename", "renamedネーム")
+	if exit != 0 || !strings.Contains(stdout, "+// Prints renamedネーム") || !strings.Contains(stderr, "modified a comment in") {
+		t.Fatalf("Rename with -preset=aggressive expected a diff and a warning; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exported := strings.Replace(hello, "こんにちはmsg", "Msg", -1)
+	exit, stdout, stderr = runCLI(exported, "-scope=-", pos, "-preset=safe", "rename", "msg")
+	if exit != 3 || stdout != "" || !strings.Contains(stderr, "does not allow refactorings that produce warnings") {
+		t.Fatalf("Rename with a warning and -preset=safe expected exit code 3; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+	exit, stdout, stderr = runCLI(exported, "-scope=-", pos, "-preset=aggressive", "rename", "msg")
+	if exit != 0 || !strings.Contains(stdout, "+var msg") {
+		t.Fatalf("Rename with a warning and -preset=aggressive expected a diff; got %d\n%s\n%s", exit, stdout, stderr)
+	}
+
+	exit, _, stderr = runCLI(hello, "-scope=-", pos, "-preset=reckless", "rename", "renamedネーム")
+	if exit != 1 || !strings.Contains(stderr, `"safe" or "aggressive"`) {
+		t.Fatalf("Invalid -preset expected exit code 1; got %d\n%s", exit, stderr)
+	}
+	exit, _, stderr = runCLI(hello, "-scope=-", pos, "-preset=safe", "-generated=skip", "rename", "renamedネーム")
+	if exit != 1 || !strings.Contains(stderr, "cannot both be present") {
+		t.Fatalf("-preset with -generated expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestRenamePipe(t *testing.T) {
+	exit, stdout, stderr := runCLI(hello, "-scope=-", pos, "-pipe", "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	expected := strings.SplitN(complete, "\n", 2)[1]
+	if stdout != strings.TrimSuffix(expected, "\n") {
+		t.Fatalf("Output did not match expected output:\n%s\n%s",
+			stdout, stderr)
+	}
+
+	// Nothing is output if the refactoring produces errors
+	exit, stdout, _ = runCLI(hello, "-scope=-", pos, "-pipe", "rename", "fmt")
+	if exit != 3 || stdout != "" {
+		t.Fatalf("Rename with errors expected exit code 3 and no output; got %d\n%s", exit, stdout)
+	}
+}
+
+func TestRenameLogFormat(t *testing.T) {
+	exit, _, stderr := runCLI(hello, "-file=-", "-scope=-", pos, "-logformat=sarif", "rename", "fmt")
+	if exit != 3 {
+		t.Fatalf("Rename with errors expected exit code 3; got %d", exit)
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct{ RuleID, Level string }
+		}
+	}
+	if err := json.Unmarshal([]byte(stderr), &sarif); err != nil {
+		t.Fatalf("-logformat=sarif produced invalid JSON: %s\n%s", err, stderr)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 {
+		t.Fatalf("Incorrect SARIF output:\n%s", stderr)
+	}
+	errors := 0
+	for _, result := range sarif.Runs[0].Results {
+		if result.RuleID != "rename" {
+			t.Fatalf("Incorrect SARIF rule ID:\n%s", stderr)
+		}
+		if result.Level == "error" {
+			errors++
+		}
+	}
+	if errors == 0 {
+		t.Fatalf("Expected an error in SARIF output:\n%s", stderr)
+	}
+
+	exit, _, stderr = runCLI(hello, "-file=-", "-scope=-", pos, "-logformat=checkstyle", "rename", "fmt")
+	if exit != 3 || !strings.HasPrefix(stderr, "<?xml") ||
+		!strings.Contains(stderr, `severity="error"`) {
+		t.Fatalf("Expected Checkstyle output; got %d\n%s", exit, stderr)
+	}
+
+	exit, _, stderr = runCLI(hello, "-file=-", "-scope=-", pos, "-logformat=junit", "rename", "fmt")
+	if exit != 3 || !strings.HasPrefix(stderr, "<?xml") ||
+		!strings.Contains(stderr, "<failure ") {
+		t.Fatalf("Expected JUnit output; got %d\n%s", exit, stderr)
+	}
+
+	exit, _, stderr = runCLI(hello, "-file=-", "-scope=-", pos, "-logformat=xml", "rename", "fmt")
+	if exit != 1 || !strings.Contains(stderr, "-logformat flag must be") {
+		t.Fatalf("Invalid -logformat expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
 func TestRenameInvalidPos(t *testing.T) {
 	exit, stdout, stderr := runCLI(hello, "-pos=1000,", "rename", "x")
 	if exit != 1 || stderr == "" {
@@ -348,3 +888,314 @@ func TestOneRefactoringOneParam(t *testing.T) {
 		t.Fatal("One refactoring with one arg, no input expected exit 0")
 	}
 }
+
+// cacheDirRecorder records the cache directory it is run with.
+type cacheDirRecorder struct {
+	customNoParams
+	cacheDir *string
+}
+
+func (r *cacheDirRecorder) Run(config *refactoring.Config) *refactoring.Result {
+	*r.cacheDir = config.CacheDir
+	return r.customNoParams.Run(config)
+}
+
+func TestCacheDir(t *testing.T) {
+	cacheDir := "unset"
+	addRefactorings := func() {
+		engine.AddRefactoringFunc("custom", func() refactoring.Refactoring {
+			return &cacheDirRecorder{cacheDir: &cacheDir}
+		})
+	}
+	if exit, _, _ := addRefactoringsAndRunCLI(addRefactorings, "", "-file=-"); exit != 0 || cacheDir != "" {
+		t.Fatalf("Expected no cache directory by default; got %q (exit %d)",
+			cacheDir, exit)
+	}
+	dir := filepath.Join("some", "dir")
+	if exit, _, _ := addRefactoringsAndRunCLI(addRefactorings, "", "-cachedir="+dir, "-file=-"); exit != 0 || cacheDir != dir {
+		t.Fatalf("Expected cache directory %q; got %q (exit %d)",
+			dir, cacheDir, exit)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	src := `package main
+
+import "fmt"
+
+//doctor:rename greet
+func hello() string {
+	return "hello"
+}
+
+func main() {
+	//doctor:extract show
+	fmt.Println(hello())
+	fmt.Println("!")
+	//doctor:end
+}
+`
+	if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, stdout, stderr := runCLI("", "-scope="+filename, "batch", dir)
+	if exit != 0 {
+		t.Fatalf("Batch expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	exit, subcommandStdout, stderr := runCLI("", "batch", "-scope="+filename, dir)
+	if exit != 0 || subcommandStdout != stdout {
+		t.Fatalf("Batch with flags after the command expected the same diff; got %d\n%s%s", exit, subcommandStdout, stderr)
+	}
+	for _, line := range []string{
+		"-//doctor:rename greet",
+		"+func greet() string {",
+		"-	//doctor:extract show",
+		"+	show()",
+		"+func show() {",
+		"+	fmt.Println(greet())",
+	} {
+		if !strings.Contains(stdout, "\n"+line+"\n") {
+			t.Fatalf("Expected diff to contain %q; got:\n%s", line, stdout)
+		}
+	}
+
+	reportFile := filepath.Join(dir, "report.json")
+	exit, stdout, stderr = runCLI("", "-scope="+filename,
+		"-report="+reportFile, "batch", dir)
+	if exit != 0 {
+		t.Fatalf("Batch with -report expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	data, err := ioutil.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Patch string
+		Steps []struct {
+			Step      int
+			Line      int
+			Directive string
+		}
+		Hunks []struct {
+			Header string
+			Steps  []int
+		}
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Patch != stdout {
+		t.Fatalf("Expected report to contain the patch\n%s; got:\n%s", stdout, report.Patch)
+	}
+	if len(report.Steps) != 2 || report.Steps[0].Line != 5 ||
+		report.Steps[1].Directive != "doctor:extract show" {
+		t.Fatalf("Unexpected steps in report:\n%s", data)
+	}
+	// The refactorings change adjacent lines, so there is one hunk
+	if len(report.Hunks) != 1 || report.Hunks[0].Header != "@@ -2,14 +2,15 @@" ||
+		len(report.Hunks[0].Steps) != 2 {
+		t.Fatalf("Unexpected hunks in report:\n%s", data)
+	}
+
+	exit, _, stderr = runCLI("", "-report="+reportFile, "-pos=1,1:1,1", "rename", "x")
+	if exit != 1 || !strings.Contains(stderr, "-report flag cannot be used") {
+		t.Fatalf("Rename with -report expected exit code 1; got %d\n%s", exit, stderr)
+	}
+
+	exit, _, stderr = runCLI("", "-pos=1,1:1,1", "batch", dir)
+	if exit != 1 || !strings.Contains(stderr, "-pos flag cannot be used") {
+		t.Fatalf("Batch with -pos expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestDebugPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte(hello), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	edits := `[{"offset": 26, "length": 3, "replacement": "const"}]`
+	exit, stdout, stderr := runCLI(edits, "debug-patch", filename, "-")
+	if exit != 0 {
+		t.Fatalf("Expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	for _, expected := range []string{
+		"Patch with 1 hunk(s)\n",
+		"Edit: Replace offset 26 (file offset 26), length 3 with \"const\"\n",
+		"\n-var こんにちはmsg string = \"Hello, package\"\n",
+		"\n+const こんにちはmsg string = \"Hello, package\"\n",
+	} {
+		if !strings.Contains(stdout, expected) {
+			t.Fatalf("Expected output to contain %q; got:\n%s", expected, stdout)
+		}
+	}
+
+	edits = `[{"offset": 0, "length": 5}, {"offset": 2, "length": 5}]`
+	exit, _, stderr = runCLI(edits, "debug-patch", filename, "-")
+	if exit != 1 || !strings.Contains(stderr, "Edit 2:") {
+		t.Fatalf("Overlapping edits expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, _, stderr := runCLI("", "diff")
+	if exit != 1 || !strings.Contains(stderr, "No snapshot") {
+		t.Fatalf("Diff without snapshot expected exit code 1; got %d\n%s", exit, stderr)
+	}
+
+	if err := ioutil.WriteFile("main.go", []byte(hello+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exit, stdout, stderr := runCLI("", "snapshot")
+	if exit != 0 || !strings.Contains(stdout, "1 file(s)") {
+		t.Fatalf("Snapshot expected exit code 0; got %d\n%s%s", exit, stdout, stderr)
+	}
+
+	exit, stdout, stderr = runCLI("", "diff")
+	if exit != 0 || stdout != "" || !strings.Contains(stderr, "No files have changed") {
+		t.Fatalf("Diff expected no changes; got %d\n%s%s", exit, stdout, stderr)
+	}
+
+	// Apply two refactorings, then output their combined changes
+	for _, args := range [][]string{
+		{"-file=main.go", "-scope=main.go", pos, "-w", "rename", "renamed"},
+		{"-file=main.go", "-scope=main.go", "-pos=3,5:3,11", "-w", "rename", "message"},
+	} {
+		if exit, _, stderr := runCLI("", args...); exit != 0 {
+			t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+		}
+	}
+	if err := ioutil.WriteFile("new.go", []byte("package main\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exit, stdout, stderr = runCLI("", "diff")
+	if exit != 0 {
+		t.Fatalf("Diff expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	for _, line := range []string{
+		"-var こんにちはmsg string = \"Hello, package\"",
+		"+var message string = \"Hello, package\"",
+		"+	fmt.Println(message)",
+	} {
+		if !strings.Contains(stdout, "\n"+line+"\n") {
+			t.Fatalf("Expected diff to contain %q; got:\n%s", line, stdout)
+		}
+	}
+	if !strings.Contains(stderr, "new.go was created") {
+		t.Fatalf("Expected warning about new.go; got:\n%s", stderr)
+	}
+
+	exit, stdout, _ = runCLI("", "-formatpatch", "diff")
+	if exit != 0 || !strings.Contains(stdout, "Subject: [PATCH] Changes since snapshot") {
+		t.Fatalf("Diff with -formatpatch expected a patch; got %d\n%s", exit, stdout)
+	}
+	exit, stdout, _ = runCLI("", "diff", "-formatpatch")
+	if exit != 0 || !strings.Contains(stdout, "Subject: [PATCH] Changes since snapshot") {
+		t.Fatalf("Diff -formatpatch expected a patch; got %d\n%s", exit, stdout)
+	}
+
+	exit, _, stderr = runCLI("", "-w", "diff")
+	if exit != 1 || !strings.Contains(stderr, "-w flag cannot be used") {
+		t.Fatalf("Diff with -w expected exit code 1; got %d\n%s", exit, stderr)
+	}
+}
+
+// modifyingRename renames a variable, then overwrites the file being
+// refactored, simulating an editor saving the file after the refactoring has
+// analyzed it but before its changes are written.
+type modifyingRename struct {
+	refactoring.Rename
+	filename, contents string
+}
+
+func (r *modifyingRename) Run(config *refactoring.Config) *refactoring.Result {
+	result := r.Rename.Run(config)
+	if err := ioutil.WriteFile(r.filename, []byte(r.contents), 0666); err != nil {
+		result.Log.Error(err)
+	}
+	return result
+}
+
+func TestWriteVerboseSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("main.go", []byte(hello), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	exit, _, stderr := runCLI("", "-file=main.go", "-scope=main.go", pos, "-w", "-v", "rename", "renamed")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	summary := "1 file changed, 2 insertions(+), 2 deletions(-)\n"
+	if !strings.HasSuffix(stderr, summary) {
+		t.Fatalf("Expected summary %q; got:\n%s", summary, stderr)
+	}
+}
+
+func TestWriteModifiedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte(hello), 0666); err != nil {
+		t.Fatal(err)
+	}
+	modified := strings.Replace(hello, "package main", "package main\n\n// Modified", 1)
+
+	exit, _, stderr := addRefactoringsAndRunCLI(func() {
+		engine.AddRefactoring("rename", &modifyingRename{
+			filename: filename,
+			contents: modified,
+		})
+	}, "", "-file="+filename, "-scope="+filename, pos, "-w", "renamed")
+	if exit != 1 || !strings.Contains(stderr, filename+" was modified after it was analyzed") {
+		t.Fatalf("Expected modified file error with exit 1; got %d\n%s", exit, stderr)
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != modified {
+		t.Fatalf("Expected modified file to be unchanged; got:\n%s", contents)
+	}
+}
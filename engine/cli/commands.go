@@ -0,0 +1,452 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the subcommands of the command line interface (e.g.,
+// "godoctor run rename NewName"), each of which accepts only the flags that
+// are meaningful to it and has its own help.
+
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/engine/protocol"
+	"github.com/godoctor/godoctor/filesystem"
+)
+
+// A command is a subcommand of the command line interface.
+type command struct {
+	// The name used to invoke the command (e.g., run)
+	name string
+	// A synopsis of the command's arguments, with angle brackets
+	// surrounding argument names and square brackets surrounding optional
+	// arguments (e.g., <refactoring> [<args> ...])
+	usage string
+	// A brief phrase describing the command, with the first letter
+	// capitalized
+	synopsis string
+	// A longer description of the command, displayed in its help
+	description string
+	// The names of the flags (see Flags) accepted by the command
+	flags []string
+}
+
+// A commandContext contains the input and output streams, flags, and
+// arguments for a command.
+type commandContext struct {
+	cmd       *command
+	aboutText string
+	cmdName   string
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	flags     *CLIFlags
+	args      []string
+}
+
+// refactoringFlags are the names of the flags that determine which code is
+// refactored and how.
+var refactoringFlags = []string{"file", "pos", "target", "scope",
+	"generated", "preset", "include", "exclude", "logformat", "v", "vv"}
+
+// outputFlags are the names of the flags that determine how a refactoring's
+// changes are output or applied.
+var outputFlags = []string{"complete", "w", "patchdir", "formatpatch", "git"}
+
+// commands are the subcommands, in the order they are listed in the help.
+var commands = []*command{
+	{
+		name:     "list",
+		usage:    "",
+		synopsis: "List the available refactorings",
+		description: "Lists the available refactorings.  With -json, the " +
+			"refactoring catalog is output\ninstead, describing every " +
+			"refactoring and its parameters in JSON.",
+		flags: []string{"json"},
+	},
+	{
+		name:     "params",
+		usage:    "<refactoring>",
+		synopsis: "Describe the arguments of a refactoring",
+		description: "Describes what must be selected and what arguments " +
+			"must be supplied to run the\ngiven refactoring (as JSON, " +
+			"with -json).",
+		flags: []string{"json"},
+	},
+	{
+		name:     "run",
+		usage:    "<refactoring> [<args> ...]",
+		synopsis: "Run a refactoring",
+		description: "Runs the given refactoring on the code selected by " +
+			"-file and -pos, displaying\na diff of its changes (or " +
+			"writing them to disk, with -w).  The <args> vary\n" +
+			"depending on the refactoring; see the params command.",
+		flags: append(append(append([]string{}, refactoringFlags...),
+			outputFlags...), "pipe", "gofmt"),
+	},
+	{
+		name:     "apply",
+		usage:    "[<path> ...]",
+		synopsis: "Apply the refactorings requested by //doctor: comments",
+		description: "Applies the refactorings requested by //doctor: " +
+			"comments (e.g., //doctor:rename\nNewName) in the Go files " +
+			"in the given files and directories (default: the\n" +
+			"current directory), deleting each comment as it is applied.",
+		flags: append([]string{"scope", "generated", "preset", "include",
+			"exclude", "v", "vv", "report"}, outputFlags...),
+	},
+	{
+		name:     "batch",
+		usage:    "[<path> ...]",
+		synopsis: "Apply the refactorings requested by //doctor: comments (same as apply)",
+		description: "Applies the refactorings requested by //doctor: " +
+			"comments, like the apply command.\nWith -report=<file>, " +
+			"a JSON report is also written listing each refactoring\n" +
+			"applied (with its log) and the refactorings that produced " +
+			"each hunk.",
+		flags: append([]string{"scope", "generated", "preset", "include",
+			"exclude", "v", "vv", "report"}, outputFlags...),
+	},
+	{
+		name:     "history",
+		usage:    "",
+		synopsis: "List the refactorings recorded in the journal",
+		description: "Lists the refactorings applied with -w, which are " +
+			"recorded in .godoctor/journal\nin the current directory.",
+		flags: []string{},
+	},
+	{
+		name:     "replay",
+		usage:    "<n>",
+		synopsis: "Apply a refactoring recorded in the journal again",
+		description: "Applies the nth refactoring listed by the history " +
+			"command again (e.g., on a new\ncheckout).",
+		flags: []string{},
+	},
+	{
+		name:     "undo",
+		usage:    "[<n>]",
+		synopsis: "Revert the refactorings recorded in the journal",
+		description: "Reverts the last n refactorings listed by the " +
+			"history command (default 1).",
+		flags: []string{},
+	},
+	{
+		name:     "snapshot",
+		usage:    "[<path> ...]",
+		synopsis: "Record the contents of Go files for the diff command",
+		description: "Records the contents of the Go files in the given " +
+			"files and directories\n(default: the current directory), " +
+			"so the diff command can output every change\nmade to them " +
+			"since then (e.g., after a script applies many refactorings).",
+		flags: []string{},
+	},
+	{
+		name:     "diff",
+		usage:    "",
+		synopsis: "Output the changes made since the last snapshot",
+		description: "Outputs every change made to the files recorded by " +
+			"the snapshot command as a\nsingle patch (or, with " +
+			"-patchdir, one patch per file).",
+		flags: []string{"patchdir", "formatpatch", "git"},
+	},
+	{
+		name:     "debug-patch",
+		usage:    "<file> <edits.json>",
+		synopsis: "Show how edits to a file are divided into hunks",
+		description: "Displays how a list of edits to a file (in JSON, as " +
+			"recorded in the journal, or\n\"-\" for stdin) is divided " +
+			"into the hunks of a patch, for diagnosing malformed\ndiffs.",
+		flags: []string{},
+	},
+	{
+		name:     "serve",
+		usage:    "[<command> ...]",
+		synopsis: "Accept commands in the OpenRefactory JSON protocol",
+		description: "Reads commands in the OpenRefactory JSON protocol " +
+			"from standard input (or\nexecutes the commands given as " +
+			"arguments) and writes the replies to standard\noutput, " +
+			"e.g., for use by an editor plug-in.",
+		flags: []string{},
+	},
+	{
+		name:     "analyze",
+		usage:    "<refactoring> [<args> ...]",
+		synopsis: "Check a refactoring without changing any files",
+		description: "Runs the given refactoring, like the run command, " +
+			"but only outputs its log and\na summary of the files it " +
+			"would change.  The exit code is 3 if it cannot be\n" +
+			"applied.",
+		flags: refactoringFlags,
+	},
+	{
+		name:     "completion",
+		usage:    "<shell>",
+		synopsis: "Output a shell completion script",
+		description: "Outputs a script that adds completion of commands, " +
+			"refactorings, flags, and\narguments to the given shell " +
+			"(bash, zsh, or fish), e.g.,\n    source <(godoctor " +
+			"completion bash)",
+		flags: []string{},
+	},
+}
+
+// getCommand returns the subcommand with the given name, or nil if there is
+// no such command.
+func getCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// runCommand parses the flags for the given command from the given
+// arguments, then runs it.  Only the command's flags are accepted, although
+// their values are stored in a complete set of flags (see Flags), so the
+// command can be implemented like the equivalent invocation without a
+// subcommand.
+func runCommand(cmd *command, aboutText string, stdin io.Reader, stdout, stderr io.Writer, cmdName string, args []string) int {
+	all := Flags()
+	flags := flag.NewFlagSet(cmdName+" "+cmd.name, flag.ContinueOnError)
+	for _, name := range cmd.flags {
+		f := all.Lookup(name)
+		flags.Var(f.Value, f.Name, f.Usage)
+	}
+	flags.Usage = func() {}
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		// (err has already been printed)
+		if err == flag.ErrHelp {
+			// Invoked as "godoctor <command> [flags] -help"
+			printCommandHelp(cmd, cmdName, stderr)
+			return 2
+		}
+		fmt.Fprintf(stderr, "Run '%s help %s' for more information.\n",
+			cmdName, cmd.name)
+		return 1
+	}
+	flags.Visit(func(f *flag.Flag) {
+		all.Set(f.Name, f.Value.String())
+	})
+	c := &commandContext{
+		cmd:       cmd,
+		aboutText: aboutText,
+		cmdName:   cmdName,
+		stdin:     stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+		flags:     all,
+		args:      flags.Args(),
+	}
+	switch cmd.name {
+	case "list":
+		return runListCommand(c)
+	case "params":
+		return runParamsCommand(c)
+	case "run":
+		return runRunCommand(c)
+	case "apply", "batch":
+		return runApplyCommand(c)
+	case "history":
+		return runHistory(c.stdout, c.stderr, c.args)
+	case "replay":
+		return runReplay(c.aboutText, c.stdin, c.stdout, c.stderr,
+			c.cmdName, c.args)
+	case "undo":
+		return runUndo(c.stdout, c.stderr, c.cmdName, c.args)
+	case "snapshot":
+		return runSnapshot(c.stdout, c.stderr, c.cmdName, c.args)
+	case "diff":
+		return runDiff(c.stdout, c.stderr, c.flags, c.cmdName, c.args)
+	case "debug-patch":
+		return runDebugPatch(c.stdin, c.stdout, c.stderr, c.args)
+	case "serve":
+		return runServeCommand(c)
+	case "completion":
+		return runCompletionCommand(c)
+	default:
+		return runAnalyzeCommand(c)
+	}
+}
+
+// printCommandHelp outputs the usage, description, and flags of the given
+// command.
+func printCommandHelp(cmd *command, cmdName string, out io.Writer) {
+	usage := cmdName + " " + cmd.name
+	if len(cmd.flags) > 0 {
+		usage += " [<flag> ...]"
+	}
+	if cmd.usage != "" {
+		usage += " " + cmd.usage
+	}
+	fmt.Fprintf(out, "Usage: %s\n\n%s\n", usage, cmd.description)
+	if len(cmd.flags) > 0 {
+		fmt.Fprintf(out, "\nEach <flag> must be one of the following:\n")
+		all := Flags()
+		for _, name := range cmd.flags {
+			f := all.Lookup(name)
+			fmt.Fprintf(out, "    -%-8s %s\n", f.Name, f.Usage)
+		}
+	}
+}
+
+// listCommands returns the names and synopses of the commands, formatted
+// for display in the help.
+func listCommands() string {
+	result := ""
+	for _, c := range commands {
+		result += fmt.Sprintf("    %-15s %s\n", c.name, c.synopsis)
+	}
+	return result
+}
+
+// checkArgs outputs an error message and returns false if the command was
+// given fewer than min or more than max arguments (max < 0 denotes no
+// limit).
+func (c *commandContext) checkArgs(min, max int) bool {
+	if len(c.args) >= min && (max < 0 || len(c.args) <= max) {
+		return true
+	}
+	fmt.Fprintf(c.stderr, "Usage: %s %s %s\n", c.cmdName, c.cmd.name,
+		c.cmd.usage)
+	return false
+}
+
+// runListCommand implements "godoctor list [-json]".
+func runListCommand(c *commandContext) int {
+	if !c.checkArgs(0, 0) {
+		return 2
+	}
+	if *c.flags.jsonFlag {
+		return printCatalog(c.stdout, c.stderr)
+	}
+	printList(c.stdout)
+	return 0
+}
+
+// runParamsCommand implements "godoctor params [-json] <refactoring>".
+func runParamsCommand(c *commandContext) int {
+	if !c.checkArgs(1, 1) {
+		return 2
+	}
+	var entry *engine.CatalogEntry
+	for _, e := range engine.Catalog() {
+		if e.ShortName == c.args[0] {
+			entry = e
+		}
+	}
+	if entry == nil {
+		fmt.Fprintf(c.stderr, "There is no refactoring named \"%s\"\n",
+			c.args[0])
+		return 1
+	}
+
+	if *c.flags.jsonFlag {
+		data, err := json.MarshalIndent(entry, "", "\t")
+		if err != nil {
+			fmt.Fprintf(c.stderr, "Error: %s\n", err)
+			return 1
+		}
+		fmt.Fprintf(c.stdout, "%s\n", data)
+		return 0
+	}
+
+	fmt.Fprintf(c.stdout, "%s: %s\n\n", entry.Name, entry.Synopsis)
+	fmt.Fprintf(c.stdout, "Usage: %s run [<flag> ...] %s %s\n",
+		c.cmdName, entry.ShortName, entry.Usage)
+	if entry.Selection != "" {
+		fmt.Fprintf(c.stdout, "Selection: %s\n", entry.Selection)
+	}
+	if len(entry.Params) > 0 {
+		fmt.Fprintf(c.stdout, "\nArguments:\n")
+	}
+	for _, p := range entry.Params {
+		kind := "required"
+		if p.Optional {
+			kind = fmt.Sprintf("optional, default %v", p.Default)
+		}
+		fmt.Fprintf(c.stdout, "    %-20s %s (%s, %s)\n",
+			p.Label, p.Prompt, p.Type, kind)
+	}
+	return 0
+}
+
+// runRunCommand implements "godoctor run [flags] <refactoring> [<args> ...]".
+func runRunCommand(c *commandContext) int {
+	if len(c.args) == 0 {
+		printCommandHelp(c.cmd, c.cmdName, c.stderr)
+		return 2
+	}
+	if !checkFlags(c.flags, c.stderr) {
+		return 1
+	}
+	return runRefactoringCommand(c.stdin, c.stdout, c.stderr, c.cmdName,
+		c.aboutText, c.flags, c.args, false)
+}
+
+// runApplyCommand implements "godoctor apply [flags] [<path> ...]" (and
+// "godoctor batch [flags] [<path> ...]").
+func runApplyCommand(c *commandContext) int {
+	if !checkFlags(c.flags, c.stderr) {
+		return 1
+	}
+	return runBatch(c.stdout, c.stderr, c.flags, c.args)
+}
+
+// runServeCommand implements "godoctor serve [<command> ...]".
+func runServeCommand(c *commandContext) int {
+	protocol.Run(c.stdout, c.aboutText, c.args)
+	return 0
+}
+
+// runAnalyzeCommand implements
+// "godoctor analyze [flags] <refactoring> [<args> ...]".
+func runAnalyzeCommand(c *commandContext) int {
+	if len(c.args) == 0 {
+		printCommandHelp(c.cmd, c.cmdName, c.stderr)
+		return 2
+	}
+	return runRefactoringCommand(c.stdin, c.stdout, c.stderr, c.cmdName,
+		c.aboutText, c.flags, c.args, true)
+}
+
+// writeAnalysis outputs a summary of the files that would be changed by a
+// refactoring, for the analyze command.  If the refactoring logged errors,
+// it outputs only that the refactoring cannot be applied.
+func writeAnalysis(out io.Writer, result *changes, hasErrors bool, fs filesystem.FileSystem, cwd string) error {
+	if hasErrors {
+		fmt.Fprintln(out, "The refactoring cannot be applied")
+		return nil
+	}
+	mp, err := filesystem.CreateMultiPatch(result.edits, fs)
+	if err != nil {
+		return err
+	}
+	for _, filename := range mp.Filenames() {
+		stats, err := mp.Patch(filename).Stats()
+		if err != nil {
+			return err
+		}
+		if stats.Files > 0 {
+			fmt.Fprintf(out, "%s (+%d -%d)\n",
+				relativePath(filename), stats.Insertions,
+				stats.Deletions)
+		}
+	}
+	for _, change := range result.fsChanges {
+		fmt.Fprintf(out, "%s\n", change.String(cwd))
+	}
+	stats, err := mp.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, stats)
+	return nil
+}
@@ -0,0 +1,326 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the completion command, which outputs a script that
+// adds command line completion for the Go Doctor to bash, zsh, or fish.
+//
+// The scripts do not contain lists of refactorings or flags.  Instead, they
+// invoke "godoctor completion __complete <words>" to determine the candidates
+// for the last (partial) word on the command line, so completion is always
+// consistent with the refactorings and parameters in the registry.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+// completeArg is the first argument to the completion command when it is
+// invoked by a completion script to determine the candidates for a word.
+const completeArg = "__complete"
+
+// completionScripts are the completion scripts for each supported shell, in
+// the order they are listed in the help.  In each script, %[1]s is replaced
+// with the name of the command and %[2]s with a shell function name derived
+// from it.
+var completionScripts = []struct{ shell, script string }{
+	{"bash", `# bash completion for %[1]s
+# Add the following to ~/.bashrc:
+#     source <(%[1]s completion bash)
+_%[2]s_complete() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local -a words
+    read -r -a words <<< "$line"
+    if [[ "$line" == *[[:space:]] || ${#words[@]} -eq 0 ]]; then
+        words+=("")
+    fi
+    local cur="${words[${#words[@]}-1]}"
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(%[1]s completion __complete "${words[@]:1}" 2>/dev/null | cut -f1)" -- "$cur"))
+    if [[ "$cur" == *=* && "$COMP_WORDBREAKS" == *=* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#*=}")
+    fi
+}
+complete -o default -F _%[2]s_complete %[1]s
+`},
+	{"zsh", `#compdef %[1]s
+# zsh completion for %[1]s
+# Add the following to ~/.zshrc (after compinit):
+#     source <(%[1]s completion zsh)
+_%[2]s() {
+    local -a candidates
+    local line
+    for line in "${(@f)$(%[1]s completion __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -n "$line" ]] && candidates+=("${${line%%%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+    done
+    if (( ${#candidates} )); then
+        _describe '%[1]s' candidates
+    else
+        _files
+    fi
+}
+compdef _%[2]s %[1]s
+`},
+	{"fish", `# fish completion for %[1]s
+# Add the following to ~/.config/fish/config.fish:
+#     %[1]s completion fish | source
+function __%[2]s_complete
+    set -l args (commandline -opc)[2..-1] (commandline -ct)
+    %[1]s completion __complete $args 2>/dev/null
+end
+complete -c %[1]s -a '(__%[2]s_complete)'
+`},
+}
+
+// shellNames returns the names of the shells for which completion scripts
+// are available.
+func shellNames() []string {
+	result := []string{}
+	for _, s := range completionScripts {
+		result = append(result, s.shell)
+	}
+	return result
+}
+
+// runCompletionCommand implements "godoctor completion <shell>" and
+// "godoctor completion __complete [<word> ...]".
+func runCompletionCommand(c *commandContext) int {
+	if len(c.args) > 0 && c.args[0] == completeArg {
+		for _, cand := range completions(c.args[1:]) {
+			fmt.Fprintf(c.stdout, "%s\t%s\n", cand.text, cand.description)
+		}
+		return 0
+	}
+	if !c.checkArgs(1, 1) {
+		return 2
+	}
+	name := filepath.Base(c.cmdName)
+	funcName := regexp.MustCompile(`\W`).ReplaceAllString(name, "_")
+	for _, s := range completionScripts {
+		if s.shell == c.args[0] {
+			fmt.Fprintf(c.stdout, s.script, name, funcName)
+			return 0
+		}
+	}
+	fmt.Fprintf(c.stderr, "Error: The shell must be %s\n",
+		quotedList(shellNames()))
+	return 1
+}
+
+// A candidate is a possible completion of a word on the command line.
+type candidate struct {
+	// The completed word
+	text string
+	// A brief description, which some shells display next to the word
+	description string
+}
+
+// completions returns the candidates for the last word in the given list of
+// command line arguments (excluding the command name), which is the word
+// being completed and may be empty.  If there are no candidates, the shell
+// completes a filename.
+func completions(words []string) []candidate {
+	cur := ""
+	if len(words) > 0 {
+		cur = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	all := Flags()
+	positional := []string{}
+	valueOf := "" // Name of a flag whose value is the current word
+	skip := false
+	for i, word := range words {
+		if skip {
+			// The word is the value of the preceding flag
+			skip = false
+			continue
+		}
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			positional = append(positional, word)
+			continue
+		}
+		name := strings.TrimLeft(word, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := all.Lookup(name); f != nil && !isBoolFlag(f) {
+			if i == len(words)-1 {
+				valueOf = name
+			} else {
+				skip = true
+			}
+		}
+	}
+
+	switch {
+	case valueOf != "":
+		return matching(flagValues(valueOf), "", cur)
+	case strings.HasPrefix(cur, "-") && strings.Contains(cur, "="):
+		idx := strings.Index(cur, "=")
+		name := strings.TrimLeft(cur[:idx], "-")
+		return matching(flagValues(name), cur[:idx+1], cur)
+	case strings.HasPrefix(cur, "-"):
+		return matching(flagCandidates(all, positional), "", cur)
+	default:
+		return matching(argCandidates(positional), "", cur)
+	}
+}
+
+// matching returns the candidates whose text, when prefixed with the given
+// string, begins with cur.  The prefix is added to each candidate returned.
+func matching(candidates []candidate, prefix, cur string) []candidate {
+	result := []candidate{}
+	for _, c := range candidates {
+		c.text = prefix + c.text
+		if strings.HasPrefix(c.text, cur) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// isBoolFlag returns true iff the given flag does not require a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+// flagCandidates returns the flags accepted by the command in the given
+// positional arguments, or all flags if no command was given.
+func flagCandidates(all *CLIFlags, positional []string) []candidate {
+	result := []candidate{}
+	if len(positional) > 0 && getCommand(positional[0]) != nil &&
+		len(engine.AllRefactoringNames()) != 1 {
+		for _, name := range getCommand(positional[0]).flags {
+			f := all.Lookup(name)
+			result = append(result, candidate{"-" + f.Name, f.Usage})
+		}
+		return result
+	}
+	all.VisitAll(func(f *flag.Flag) {
+		result = append(result, candidate{"-" + f.Name, f.Usage})
+	})
+	return result
+}
+
+// flagValues returns the values accepted by the flag with the given name, or
+// an empty list if its value is arbitrary (e.g., a filename).
+func flagValues(name string) []candidate {
+	result := []candidate{}
+	switch name {
+	case "generated":
+		for _, p := range []refactoring.GeneratedFilePolicy{
+			refactoring.EditGeneratedFiles,
+			refactoring.SkipGeneratedFiles,
+			refactoring.FailOnGeneratedFiles,
+		} {
+			result = append(result, candidate{p.String(), ""})
+		}
+	case "preset":
+		for _, name := range engine.AllPresetNames() {
+			result = append(result, candidate{name,
+				engine.GetPreset(name).Description})
+		}
+	case "logformat":
+		for _, format := range logFormats {
+			result = append(result, candidate{format, ""})
+		}
+	case "doc":
+		for _, doc := range []string{"install", "user", "man", "vim"} {
+			result = append(result, candidate{doc, ""})
+		}
+	}
+	return result
+}
+
+// argCandidates returns the candidates for the next positional argument
+// following the given positional arguments.
+func argCandidates(positional []string) []candidate {
+	hasCommands := len(engine.AllRefactoringNames()) != 1
+	if len(positional) == 0 {
+		result := []candidate{}
+		if hasCommands {
+			for _, c := range commands {
+				result = append(result, candidate{c.name, c.synopsis})
+			}
+			result = append(result, candidate{"help",
+				"Describe a command"})
+		}
+		return append(result, refactoringCandidates()...)
+	}
+
+	switch cmd := positional[0]; {
+	case !hasCommands || getCommand(cmd) == nil && cmd != "help":
+		// Invoked as "godoctor [<flag> ...] <refactoring> [<args> ...]"
+		return paramCandidates(cmd, len(positional)-1)
+	case len(positional) == 1 && cmd == "help":
+		result := []candidate{}
+		for _, c := range commands {
+			result = append(result, candidate{c.name, c.synopsis})
+		}
+		return result
+	case len(positional) == 1 && cmd == "completion":
+		result := []candidate{}
+		for _, shell := range shellNames() {
+			result = append(result, candidate{shell, ""})
+		}
+		return result
+	case cmd == "run" || cmd == "analyze" || cmd == "params":
+		if len(positional) == 1 {
+			return refactoringCandidates()
+		}
+		if cmd != "params" {
+			return paramCandidates(positional[1], len(positional)-2)
+		}
+	}
+	return []candidate{}
+}
+
+// refactoringCandidates returns the names of the refactorings that are
+// listed in the help (i.e., those that are not hidden).
+func refactoringCandidates() []candidate {
+	result := []candidate{}
+	for _, name := range engine.AllRefactoringNames() {
+		d := engine.GetRefactoring(name).Description()
+		if !d.Hidden {
+			result = append(result, candidate{name, d.Synopsis})
+		}
+	}
+	return result
+}
+
+// paramCandidates returns the candidates for the ith argument of the
+// refactoring with the given name: true and false for a boolean parameter,
+// or the default value of a string parameter, if it has one.
+func paramCandidates(refacName string, i int) []candidate {
+	result := []candidate{}
+	refac := engine.GetRefactoring(refacName)
+	if refac == nil {
+		return result
+	}
+	d := refac.Description()
+	params := append(append([]refactoring.Parameter{}, d.Params...),
+		d.OptionalParams...)
+	if i < 0 || i >= len(params) {
+		return result
+	}
+	p := params[i]
+	if p.IsBoolean() {
+		return []candidate{{"true", p.Prompt}, {"false", p.Prompt}}
+	}
+	if s, ok := p.DefaultValue.(string); ok && s != "" {
+		result = append(result, candidate{s, p.Prompt})
+	}
+	return result
+}
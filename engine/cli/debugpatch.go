@@ -0,0 +1,99 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the debug-patch command, which displays how the
+// edits in an EditSet are grouped into the hunks of a patch.  It is intended
+// for diagnosing malformed diffs.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/godoctor/godoctor/engine/journal"
+	"github.com/godoctor/godoctor/text"
+)
+
+// runDebugPatch reads a file and a list of edits to it (encoded in JSON, as
+// in the journal, and read from standard input if the filename is "-"), then
+// outputs the EditSet, a description of each hunk of the resulting patch
+// (its boundaries, the context lines it includes, and the offsets of its
+// edits) before and after the hunks are coalesced, and the patch itself.
+func runDebugPatch(stdin io.Reader, stdout, stderr io.Writer, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(stderr, "Error: The debug-patch command requires "+
+			"two arguments: a file and a JSON file containing edits to it")
+		return 1
+	}
+	contents, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	var editsJSON []byte
+	if args[1] == "-" {
+		editsJSON, err = ioutil.ReadAll(stdin)
+	} else {
+		editsJSON, err = ioutil.ReadFile(args[1])
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	edits, err := readEditSet(editsJSON)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s\n", edits)
+	p, err := edits.CreatePatch(bytes.NewReader(contents))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\n", p)
+	if err := p.Coalesce(); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	if _, err := p.DetectMoves(); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "After coalescing: %s\n", p)
+	if p.IsEmpty() {
+		return 0
+	}
+	if err := writePatch(stdout, args[0], p); err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readEditSet returns an EditSet containing the edits in the given JSON,
+// which is an array of objects of the form
+// {"offset": 0, "length": 0, "replacement": ""}.
+func readEditSet(editsJSON []byte) (*text.EditSet, error) {
+	var edits []*journal.Edit
+	if err := json.Unmarshal(editsJSON, &edits); err != nil {
+		return nil, fmt.Errorf("Invalid list of edits: %s", err)
+	}
+	result := text.NewEditSet()
+	for i, e := range edits {
+		if e == nil {
+			return nil, fmt.Errorf("Edit %d is null", i+1)
+		}
+		extent := &text.Extent{Offset: e.Offset, Length: e.Length}
+		if err := result.Add(extent, e.Replacement); err != nil {
+			return nil, fmt.Errorf("Edit %d: %s", i+1, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file outputs a refactoring's changes in the format produced by
+// git format-patch, so they can be mailed or applied with git am.
+
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// maxStatBar is the maximum number of + and - characters in a line of the
+// diffstat; files with more changes are scaled to fit.
+const maxStatBar = 50
+
+// A diffStat summarizes the changes to a single file.
+type diffStat struct {
+	filename              string
+	insertions, deletions int
+}
+
+// writeFormatPatch outputs a single patch containing the given edits and file
+// system changes, in the format produced by git format-patch.  The subject
+// becomes the patch's Subject header (prefixed with [PATCH]), and the message
+// is its commit message.  The author is taken from the GIT_AUTHOR_NAME and
+// GIT_AUTHOR_EMAIL environment variables, if they are set.  The file system
+// changes that cannot be expressed in the patch (see gitDiffs) are returned.
+func writeFormatPatch(out io.Writer, subject, message string, edits map[string]*text.EditSet, changes []filesystem.Change, fs filesystem.FileSystem) ([]filesystem.Change, error) {
+	fileDiffs, remaining, err := gitDiffs(edits, changes, fs)
+	if err != nil {
+		return nil, err
+	}
+	var diffs bytes.Buffer
+	stats := []*diffStat{}
+	for _, d := range fileDiffs {
+		stats = append(stats, &diffStat{d.filename,
+			d.stats.Insertions, d.stats.Deletions})
+		diffs.Write(d.diff)
+	}
+	if len(stats) == 0 {
+		return remaining, nil
+	}
+
+	fmt.Fprintf(out, "From %s Mon Sep 17 00:00:00 2001\n", strings.Repeat("0", 40))
+	fmt.Fprintf(out, "From: %s\n", patchAuthor())
+	fmt.Fprintf(out, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(out, "Subject: [PATCH] %s\n\n", subject)
+	fmt.Fprintf(out, "%s\n---\n", strings.TrimRight(message, "\n"))
+	writeDiffStat(out, stats)
+	fmt.Fprintln(out)
+	if _, err := out.Write(diffs.Bytes()); err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprint(out, "-- \ngodoctor\n\n")
+	return remaining, err
+}
+
+// commandLine returns a command that runs the given refactoring with the
+// given flags and arguments, for display in a commit message.
+func commandLine(cmdName string, flags *CLIFlags, refacName string, args []string) string {
+	words := []string{filepath.Base(cmdName),
+		"-file=" + filepath.ToSlash(relativePath(*flags.fileFlag)),
+		"-pos=" + *flags.posFlag}
+	flags.Visit(func(f *flag.Flag) {
+		if journaledFlags[f.Name] {
+			words = append(words, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+	words = append(words, refacName)
+	return strings.Join(append(words, args...), " ")
+}
+
+// patchAuthor returns the name and e-mail address for the From header of a
+// patch.
+func patchAuthor() string {
+	name := os.Getenv("GIT_AUTHOR_NAME")
+	if name == "" {
+		name = "Go Doctor"
+	}
+	email := os.Getenv("GIT_AUTHOR_EMAIL")
+	if email == "" {
+		email = "godoctor@localhost"
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+// writeDiffStat outputs a summary of the changes to each file, followed by
+// the totals, like git diff --stat.
+func writeDiffStat(out io.Writer, stats []*diffStat) {
+	nameWidth, countWidth, maxChanges := 0, 0, 0
+	insertions, deletions := 0, 0
+	for _, s := range stats {
+		changes := s.insertions + s.deletions
+		if len(s.filename) > nameWidth {
+			nameWidth = len(s.filename)
+		}
+		if w := len(fmt.Sprint(changes)); w > countWidth {
+			countWidth = w
+		}
+		if changes > maxChanges {
+			maxChanges = changes
+		}
+		insertions += s.insertions
+		deletions += s.deletions
+	}
+	for _, s := range stats {
+		plus, minus := s.insertions, s.deletions
+		if maxChanges > maxStatBar {
+			plus = scaleStat(plus, maxChanges)
+			minus = scaleStat(minus, maxChanges)
+		}
+		fmt.Fprintf(out, " %-*s | %*d %s%s\n", nameWidth, s.filename,
+			countWidth, s.insertions+s.deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	summary := &text.EditStats{
+		Files:      len(stats),
+		Insertions: insertions,
+		Deletions:  deletions,
+	}
+	fmt.Fprintf(out, " %s\n", summary)
+}
+
+// scaleStat scales a number of changed lines so that maxChanges lines would
+// fit in maxStatBar characters, rounding nonzero counts up to at least 1.
+func scaleStat(n, maxChanges int) int {
+	if n == 0 {
+		return 0
+	}
+	if scaled := n * maxStatBar / maxChanges; scaled > 0 {
+		return scaled
+	}
+	return 1
+}
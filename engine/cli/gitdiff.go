@@ -0,0 +1,220 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file outputs a refactoring's changes as a diff with git-style headers,
+// so they can be applied with git apply.  Unlike a plain unified diff, such a
+// diff can also create, delete, and rename files.
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A gitFileDiff is the part of a git-style diff that changes a single file.
+type gitFileDiff struct {
+	filename string          // Path (relative, with slashes) after the change
+	diff     []byte          // Diff, including its "diff --git" header
+	stats    *text.EditStats // Lines inserted and deleted
+}
+
+// writeGitDiff outputs a diff with git-style headers describing the given
+// edits and file system changes (colored, if out is a terminal).  The changes
+// that cannot be expressed in such a diff (see gitDiffs) are returned.
+func writeGitDiff(out io.Writer, edits map[string]*text.EditSet, changes []filesystem.Change, fs filesystem.FileSystem) ([]filesystem.Change, error) {
+	diffs, remaining, err := gitDiffs(edits, changes, fs)
+	if err != nil {
+		return nil, err
+	}
+	color := useColor(out)
+	for _, d := range diffs {
+		diff := d.diff
+		if color {
+			diff = text.ColorizeDiff(diff)
+		}
+		if _, err := out.Write(diff); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// gitDiffs returns git-style diffs for the files modified by the given edits
+// and the files created, removed, or moved by the given file system changes,
+// sorted by filename.  Directories are created and removed implicitly when
+// files are added to or moved out of them, so those changes are omitted; any
+// other changes (e.g., moving a directory) cannot be expressed in a diff, so
+// they are returned.
+func gitDiffs(edits map[string]*text.EditSet, changes []filesystem.Change, fs filesystem.FileSystem) ([]*gitFileDiff, []filesystem.Change, error) {
+	// Determine the new name of each file that is moved, and the
+	// files that are created and removed
+	moved := map[string]string{}
+	created := map[string]string{}
+	removed := map[string]bool{}
+	dirChanges := []filesystem.Change{}
+	for _, change := range changes {
+		switch c := change.(type) {
+		case *filesystem.CreateFile:
+			created[c.Path] = c.Contents
+		case *filesystem.Move:
+			if _, err := fs.ReadDir(c.Path); err == nil {
+				dirChanges = append(dirChanges, c)
+			} else {
+				moved[c.Path] = c.NewPath
+			}
+		case *filesystem.Remove:
+			if _, err := fs.ReadDir(c.Path); err == nil {
+				dirChanges = append(dirChanges, c)
+			} else {
+				removed[c.Path] = true
+			}
+		default:
+			dirChanges = append(dirChanges, c)
+		}
+	}
+
+	result := []*gitFileDiff{}
+	add := func(origFile, newFile string, orig, updated []byte) error {
+		p, err := text.DiffBytes(orig, updated).CreatePatch(bytes.NewReader(orig))
+		if err == nil {
+			err = p.Coalesce()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := p.DetectMoves(); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := p.WriteGit(gitPath(origFile), gitPath(newFile), orig, updated, &buf); err != nil {
+			return err
+		}
+		if buf.Len() == 0 {
+			return nil
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		stats, err := p.Stats()
+		if err != nil {
+			return err
+		}
+		filename := newFile
+		if filename == "" {
+			filename = origFile
+		}
+		result = append(result, &gitFileDiff{gitPath(filename), buf.Bytes(), stats})
+		return nil
+	}
+
+	// Files that are edited (and possibly moved or removed)
+	for filename, es := range edits {
+		orig, err := readFile(filename, fs)
+		if err != nil {
+			return nil, nil, err
+		}
+		updated, err := text.ApplyToString(es, string(orig))
+		if err != nil {
+			return nil, nil, err
+		}
+		newFile := filename
+		if removed[filename] {
+			newFile = ""
+			updated = ""
+		} else if newPath, ok := moved[filename]; ok {
+			newFile = newPath
+		}
+		if err := add(filename, newFile, orig, []byte(updated)); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Files that are moved or removed without being edited
+	for path, newPath := range moved {
+		if _, ok := edits[path]; !ok {
+			contents, err := readFile(path, fs)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := add(path, newPath, contents, contents); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for path := range removed {
+		if _, ok := edits[path]; !ok {
+			contents, err := readFile(path, fs)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := add(path, "", contents, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for path, contents := range created {
+		if err := add("", path, nil, []byte(contents)); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].filename < result[j].filename
+	})
+
+	// Directories created for new files, and directories removed after
+	// all of their files are moved, need not be described
+	remaining := []filesystem.Change{}
+	for _, change := range dirChanges {
+		switch c := change.(type) {
+		case *filesystem.CreateDirectory:
+			if containsAny(c.Path, created) || containsAny(c.Path, invert(moved)) {
+				continue
+			}
+		case *filesystem.Remove:
+			if containsAny(c.Path, moved) {
+				continue
+			}
+		}
+		remaining = append(remaining, change)
+	}
+	return result, remaining, nil
+}
+
+// gitPath returns the given path relative to the current directory, with
+// forward slashes, as it is given in a git diff.  The empty string (denoting
+// a file that does not exist) is returned unchanged.
+func gitPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.ToSlash(relativePath(path))
+}
+
+// containsAny returns true if any of the keys of the given map is a path in
+// the given directory (or one of its subdirectories).
+func containsAny(dir string, paths map[string]string) bool {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) +
+		string(filepath.Separator)
+	for path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// invert returns a map from the values of the given map to its keys.
+func invert(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[v] = k
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the -gofmt flag, which formats the original and
+// refactored files with gofmt before comparing them.  Refactorings that
+// reprint the code they change (see RefactoringBase.FormatFileInEditor) also
+// reformat any code near it that was not formatted by gofmt; with -gofmt, the
+// diff shows only the changes the refactoring actually made.
+
+package cli
+
+import (
+	"go/format"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// gofmtEdits returns, for each file modified by the given edits, edits that
+// change the file's contents (formatted by gofmt) into the refactored contents
+// (formatted by gofmt), along with a file system in which the original files
+// have been formatted by gofmt, against which the returned edits apply.  A
+// file that cannot be formatted (e.g., because it is not a Go source file, or
+// the refactoring introduced a syntax error) is compared unformatted.
+func gofmtEdits(edits map[string]*text.EditSet, fs filesystem.FileSystem) (map[string]*text.EditSet, filesystem.FileSystem, error) {
+	result := map[string]*text.EditSet{}
+	formatted := map[string]*text.EditSet{}
+	for filename, es := range edits {
+		before, err := readFile(filename, fs)
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := filesystem.ApplyEdits(es, fs, filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		gofmtBefore, errBefore := format.Source(before)
+		gofmtAfter, errAfter := format.Source(after)
+		if errBefore != nil || errAfter != nil {
+			result[filename] = es
+			continue
+		}
+		formatted[filename] = text.DiffBytes(before, gofmtBefore)
+		result[filename] = text.DiffBytes(gofmtBefore, gofmtAfter)
+	}
+	return result, filesystem.NewEditedFileSystem(fs, formatted), nil
+}
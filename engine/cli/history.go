@@ -0,0 +1,323 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the history, replay, and undo commands, which list,
+// re-apply, and revert the refactorings recorded in the workspace's journal.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/godoctor/godoctor/analysis/fingerprint"
+	"github.com/godoctor/godoctor/engine/journal"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// journaledFlags are the names of the flags that affect the result of a
+// refactoring, so they are recorded in the journal and used when it is
+// replayed.
+var journaledFlags = map[string]bool{
+	"scope":     true,
+	"generated": true,
+	"include":   true,
+	"exclude":   true,
+}
+
+// readFiles returns the contents of every file modified by the given edits.
+func readFiles(edits map[string]*text.EditSet, fs filesystem.FileSystem) (map[string][]byte, error) {
+	result := map[string][]byte{}
+	for filename := range edits {
+		contents, err := readFile(filename, fs)
+		if err != nil {
+			return nil, err
+		}
+		result[filename] = contents
+	}
+	return result, nil
+}
+
+// readFile returns the contents of the given file.
+func readFile(filename string, fs filesystem.FileSystem) ([]byte, error) {
+	reader, err := fs.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// recordInJournal adds an entry to the journal in the workspace (the current
+// directory) describing a refactoring that was just written to disk.  before
+// contains the contents of each modified file before it was written, and
+// target is the node on which the refactoring was invoked, if known.
+func recordInJournal(workspace string, flags *CLIFlags, refacName string, args []string, target *fingerprint.Fingerprint, result *changes, before map[string][]byte, fs filesystem.FileSystem) error {
+	entry := &journal.Entry{
+		Time:        time.Now().UTC(),
+		Refactoring: refacName,
+		Args:        args,
+		File:        relativePath(*flags.fileFlag),
+		Pos:         *flags.posFlag,
+		Flags:       []string{},
+		Files:       []*journal.File{},
+		Changes:     []string{},
+	}
+	if target != nil {
+		entry.Target = target.String()
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if journaledFlags[f.Name] {
+			entry.Flags = append(entry.Flags,
+				fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+
+	filenames := make([]string, 0, len(result.edits))
+	for filename := range result.edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		after, err := readFile(filename, fs)
+		if err != nil {
+			return err
+		}
+		if string(before[filename]) == string(after) {
+			continue
+		}
+		if _, err := journal.SaveObject(workspace, before[filename]); err != nil {
+			return err
+		}
+		entry.Files = append(entry.Files, journal.NewFile(
+			relativePath(filename), result.edits[filename],
+			before[filename], after))
+	}
+	for _, change := range result.fsChanges {
+		entry.Changes = append(entry.Changes, change.String(workspace))
+	}
+	if len(entry.Files) == 0 && len(entry.Changes) == 0 {
+		return nil
+	}
+	return journal.Append(workspace, entry)
+}
+
+// runHistory lists the refactorings recorded in the journal for the
+// workspace (the current directory).
+func runHistory(stdout, stderr io.Writer, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, "Error: The history command does not "+
+			"accept any arguments")
+		return 1
+	}
+	entries, err := journal.Load(".")
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(stderr, "No refactorings have been recorded in "+
+			"this workspace")
+		return 0
+	}
+	for i, entry := range entries {
+		fmt.Fprintf(stdout, "%4d  %s\n", i+1, entry)
+	}
+	return 0
+}
+
+// runReplay applies the refactoring recorded in the given (1-based) entry of
+// the journal for the workspace (the current directory).  Warnings are given
+// if the modified files do not have the same contents they did when the
+// refactoring was recorded, or if the replayed refactoring produces different
+// results.
+func runReplay(aboutText string, stdin io.Reader, stdout, stderr io.Writer, cmdName string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(stderr, "Usage: %s replay <entry number>\n", cmdName)
+		return 1
+	}
+	entries, err := journal.Load(".")
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(entries) {
+		fmt.Fprintf(stderr, "Error: There is no journal entry %s "+
+			"(see '%s history')\n", args[0], cmdName)
+		return 1
+	}
+	entry := entries[n-1]
+	if entry.Undo != 0 {
+		fmt.Fprintf(stderr, "Error: Journal entry %d records an undo, "+
+			"so it cannot be replayed\n", n)
+		return 1
+	}
+	if entry.Refactoring == "batch" {
+		fmt.Fprintf(stderr, "Error: Journal entry %d records a batch "+
+			"of directives, which cannot be replayed\n", n)
+		return 1
+	}
+
+	for _, f := range entry.Files {
+		if contents, err := ioutil.ReadFile(filepath.FromSlash(f.Path)); err != nil {
+			fmt.Fprintf(stderr, "Warning: %s\n", err)
+		} else if journal.Hash(contents) != f.Before {
+			fmt.Fprintf(stderr, "Warning: %s has changed since "+
+				"this refactoring was recorded\n", f.Path)
+		}
+	}
+
+	fmt.Fprintf(stderr, "Replaying %s\n", entry)
+	exit := Run(aboutText, stdin, stdout, stderr,
+		append([]string{cmdName}, entry.Command()...))
+	if exit != 0 {
+		return exit
+	}
+
+	for _, f := range entry.Files {
+		if contents, err := ioutil.ReadFile(filepath.FromSlash(f.Path)); err == nil &&
+			journal.Hash(contents) != f.After {
+			fmt.Fprintf(stderr, "Warning: The replayed refactoring "+
+				"produced different results for %s\n", f.Path)
+		}
+	}
+	return 0
+}
+
+// runUndo reverts the given number of refactorings (default 1) recorded in
+// the journal for the workspace (the current directory), starting with the
+// most recently applied refactoring.
+func runUndo(stdout, stderr io.Writer, cmdName string, args []string) int {
+	n := 1
+	if len(args) > 1 {
+		fmt.Fprintf(stderr, "Usage: %s undo [<number of steps>]\n", cmdName)
+		return 1
+	} else if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			fmt.Fprintf(stderr, "Error: Invalid number of steps: %s\n",
+				args[0])
+			return 1
+		}
+	}
+
+	entries, err := journal.Load(".")
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	applied := journal.Applied(entries)
+	if n > len(applied) {
+		fmt.Fprintf(stderr, "Error: Cannot undo %d refactoring(s); "+
+			"only %d can be undone\n", n, len(applied))
+		return 1
+	}
+	for i := 0; i < n; i++ {
+		index := applied[len(applied)-1-i]
+		if err := undo(".", entries[index-1], index, stderr); err != nil {
+			fmt.Fprintf(stderr, "Error: Unable to undo journal entry "+
+				"%d: %s\n", index, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Undid %d  %s\n", index, entries[index-1])
+	}
+	return 0
+}
+
+// An undoneFile describes how a single file will be modified to undo a
+// refactoring.
+type undoneFile struct {
+	path             string
+	current, updated []byte
+	edits            *text.EditSet
+}
+
+// undo reverts the refactoring recorded in the given journal entry (with the
+// given number) and records the undo in the journal.  If a modified file has
+// not changed since the refactoring was applied, its original contents are
+// restored.  Otherwise, the inverse of the refactoring's edits is merged with
+// the changes made since then; if they conflict, or if the refactoring cannot
+// be undone for another reason, no files are modified.
+func undo(workspace string, entry *journal.Entry, index int, stderr io.Writer) error {
+	if len(entry.Changes) > 0 {
+		return fmt.Errorf("it made changes to the file system (%s), "+
+			"which cannot be undone", entry.Changes[0])
+	}
+
+	files := []*undoneFile{}
+	for _, f := range entry.Files {
+		before, err := journal.LoadObject(workspace, f.Before)
+		if err != nil {
+			return fmt.Errorf("the original contents of %s are "+
+				"not available: %s", f.Path, err)
+		}
+		path := filepath.FromSlash(f.Path)
+		current, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		inverse, err := f.EditSet().Invert(string(before))
+		if err != nil {
+			return err
+		}
+		if journal.Hash(current) != f.After {
+			// The file has changed since the refactoring was
+			// applied; rebase the inverse edits onto its current
+			// contents
+			after, err := text.ApplyToString(f.EditSet(), string(before))
+			if err != nil || journal.Hash([]byte(after)) != f.After {
+				return fmt.Errorf("the journal entry for %s "+
+					"is inconsistent", f.Path)
+			}
+			var conflicts []*text.Conflict
+			inverse, conflicts = text.Rebase(inverse, after, string(current))
+			if len(conflicts) > 0 {
+				return fmt.Errorf("%s has been modified since "+
+					"the refactoring was applied, and the "+
+					"modifications conflict with undoing it "+
+					"(%s)", f.Path, conflicts[0])
+			}
+			fmt.Fprintf(stderr, "Warning: %s has been modified since "+
+				"the refactoring was applied; merging changes\n",
+				f.Path)
+		}
+		updated, err := text.ApplyToString(inverse, string(current))
+		if err != nil {
+			return err
+		}
+		files = append(files, &undoneFile{path, current, []byte(updated), inverse})
+	}
+
+	undoEntry := &journal.Entry{
+		Time:        time.Now().UTC(),
+		Refactoring: entry.Refactoring,
+		Args:        entry.Args,
+		File:        entry.File,
+		Pos:         entry.Pos,
+		Flags:       entry.Flags,
+		Files:       []*journal.File{},
+		Undo:        index,
+	}
+	for _, f := range files {
+		if _, err := journal.SaveObject(workspace, f.current); err != nil {
+			return err
+		}
+		undoEntry.Files = append(undoEntry.Files,
+			journal.NewFile(f.path, f.edits, f.current, f.updated))
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f.path, f.updated, 0666); err != nil {
+			return err
+		}
+	}
+	return journal.Append(workspace, undoEntry)
+}
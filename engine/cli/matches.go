@@ -0,0 +1,148 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements -pos=/regexp/g, which applies a refactoring to every
+// match of a regular expression in a file (see text.NewRegexpSelections).
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// parseSelections returns the selection given by the -pos flag in the given
+// file, or for -pos=/regexp/ or -pos=/regexp/g, the selection of the first or
+// every match of the regular expression in the file's contents.
+func parseSelections(filename, pos string, fs filesystem.FileSystem) ([]text.Selection, error) {
+	if !text.IsRegexpPos(pos) {
+		selection, err := text.NewSelection(filename, pos)
+		if err != nil {
+			return nil, err
+		}
+		return []text.Selection{selection}, nil
+	}
+	contents, err := readFile(filename, fs)
+	if err != nil {
+		return nil, err
+	}
+	return text.NewRegexpSelections(filename, contents, pos)
+}
+
+// refactorEach runs the requested refactoring on each of the given selections
+// in turn, each on the code as modified by the refactorings before it.  The
+// selections are offsets in the original contents of the selected file; each
+// is mapped through the preceding refactorings' edits before it is used.
+// A match whose text was changed by the refactoring of an earlier match is
+// skipped.  Like the batch command, each refactoring's log is output as it is
+// run, and the changes are combined as if they were made by a single
+// refactoring.  If a refactoring logs an error, refactorEach stops and returns
+// a nil result.  Otherwise, it returns the combined result and a function that
+// writes its changes to disk.
+func refactorEach(stderr io.Writer, workspace *engine.Workspace, req *engine.Request, selections []text.Selection, cwd string) (*changes, func() error, error) {
+	original := workspace.FileSystem
+	fs := original
+	// Edits are keyed by absolute path
+	filename, err := filepath.Abs(selections[0].GetFilename())
+	if err != nil {
+		return nil, nil, err
+	}
+	changed := map[string]bool{}
+	checksums := map[string]string{}
+	refactorings := []*engine.Result{}
+	mapper := text.NewEditSet().Mapper()
+	oldContents, err := readFile(filename, fs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, sel := range selections {
+		if ol, ok := sel.(*text.OffsetLengthSelection); ok &&
+			mapper.Replaced(&text.Extent{Offset: ol.Offset, Length: ol.Length}) {
+			// E.g., every reference to a renamed identifier is
+			// renamed when the first reference is matched
+			fmt.Fprintf(stderr, "Match %d of %d: %s was changed by "+
+				"an earlier match; skipping\n", i+1,
+				len(selections), sel)
+			continue
+		}
+		current, err := readFile(filename, fs)
+		if err != nil {
+			return nil, nil, err
+		}
+		sel, err = text.MapSelection(sel, mapper, string(oldContents),
+			string(current))
+		if err != nil {
+			return nil, nil, err
+		}
+		fmt.Fprintf(stderr, "Match %d of %d: %s\n", i+1, len(selections),
+			sel)
+
+		step := *workspace
+		step.FileSystem = fs
+		stepReq := *req
+		stepReq.Selection = sel
+		refactored, err := step.Refactor(&stepReq)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := refactored.WriteMessages(stderr, "text", cwd); err != nil {
+			return nil, nil, err
+		}
+		if refactored.HasErrors() {
+			return nil, nil, nil
+		}
+		if fsChanges := refactored.FileSystemChanges(); len(fsChanges) > 0 {
+			return nil, nil, fmt.Errorf("A refactoring that requires "+
+				"file system changes (%s) cannot be applied to "+
+				"every match", fsChanges[0].String(cwd))
+		}
+		result := changesOf(refactored)
+		for name := range result.edits {
+			if checksum, ok := result.checksums[name]; ok &&
+				!changed[name] {
+				checksums[name] = checksum
+			}
+			changed[name] = true
+		}
+		if edits, ok := result.edits[filename]; ok {
+			mapper = mapper.Then(edits.Mapper())
+		}
+		fs = filesystem.NewEditedFileSystem(fs, result.edits)
+		refactorings = append(refactorings, refactored)
+	}
+
+	// Combine the refactorings' changes into a single set of edits to
+	// each file
+	combined := &changes{
+		edits:     map[string]*text.EditSet{},
+		fsChanges: []filesystem.Change{},
+		checksums: checksums,
+	}
+	for name := range changed {
+		before, err := readFile(name, original)
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := readFile(name, fs)
+		if err != nil {
+			return nil, nil, err
+		}
+		combined.edits[name] = text.DiffBytes(before, after)
+	}
+	apply := func() error {
+		if err := writeToDisk(combined, original); err != nil {
+			return err
+		}
+		for _, refactored := range refactorings {
+			refactored.Applied()
+		}
+		return nil
+	}
+	return combined, apply, nil
+}
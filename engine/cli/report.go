@@ -0,0 +1,261 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the report written by the batch command's -report
+// flag, which describes each refactoring the batch applied and maps each hunk
+// of the combined patch back to the refactorings that produced it.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/engine/directive"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A batchReport is a machine-readable description of the changes made by the
+// batch command.  It is written as JSON.
+type batchReport struct {
+	// Combined patch for all of the refactorings
+	Patch string `json:"patch"`
+	// Refactorings, in the order they were applied
+	Steps []*batchStep `json:"steps"`
+	// Hunks of Patch, in the order they appear
+	Hunks []*batchHunk `json:"hunks"`
+
+	// Changes made to each file so far, keyed by absolute path
+	history map[string]*lineHistory
+}
+
+// A batchStep describes a refactoring applied by the batch command.
+type batchStep struct {
+	Step      int      `json:"step"`      // 1-based index of this step
+	File      string   `json:"file"`      // File containing the directive
+	Line      int      `json:"line"`      // Line of the directive
+	Directive string   `json:"directive"` // e.g., "doctor:rename NewName"
+	Log       []string `json:"log"`       // Log output by the refactoring
+}
+
+// A batchHunk maps a hunk of a batchReport's patch to the steps whose
+// changes it contains.
+type batchHunk struct {
+	File   string `json:"file"`   // File modified by the hunk
+	Header string `json:"header"` // e.g., "@@ -1,3 +1,4 @@"
+	Steps  []int  `json:"steps"`  // Steps that changed lines in the hunk
+}
+
+// A lineHistory records which steps of a batch changed the lines of a file.
+type lineHistory struct {
+	lines   []string      // Current contents of the file, split into lines
+	steps   [][]int       // Steps that inserted each line (nil if original)
+	deleted map[int][]int // Steps that deleted each (0-based) original line
+	orig    []int         // Index of each line in the original (or -1)
+}
+
+// newBatchReport returns an empty batchReport.
+func newBatchReport() *batchReport {
+	return &batchReport{
+		Steps:   []*batchStep{},
+		Hunks:   []*batchHunk{},
+		history: map[string]*lineHistory{},
+	}
+}
+
+// addStep records that the given directive was applied, producing the given
+// log (one entry per line) and changing the given files from their contents in
+// the file system before to their contents in the file system after.
+func (r *batchReport) addStep(d *directive.Directive, log []string, filenames []string, before, after filesystem.FileSystem) error {
+	step := len(r.Steps) + 1
+	r.Steps = append(r.Steps, &batchStep{
+		Step:      step,
+		File:      filepath.ToSlash(relativePath(d.Filename)),
+		Line:      d.Line,
+		Directive: d.String(),
+		Log:       log,
+	})
+	for _, filename := range filenames {
+		h, ok := r.history[filename]
+		if !ok {
+			contents, err := readFile(filename, before)
+			if err != nil {
+				return err
+			}
+			h = newLineHistory(string(contents))
+			r.history[filename] = h
+		}
+		contents, err := readFile(filename, after)
+		if err != nil {
+			return err
+		}
+		h.update(string(contents), step)
+	}
+	return nil
+}
+
+// splitLog splits the text of a log into lines.
+func splitLog(log string) []string {
+	if log == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(log, "\n"), "\n")
+}
+
+// addPatch sets the combined patch for this report and determines which
+// steps produced each of its hunks.
+func (r *batchReport) addPatch(mp *text.MultiPatch) error {
+	var patch bytes.Buffer
+	for _, f := range mp.Filenames() {
+		p := mp.Patch(f)
+		if p.IsEmpty() {
+			continue
+		}
+		if err := writePatch(&patch, f, p); err != nil {
+			return err
+		}
+		ranges, err := p.HunkRanges()
+		if err != nil {
+			return err
+		}
+		for _, rng := range ranges {
+			r.Hunks = append(r.Hunks, &batchHunk{
+				File:   filepath.ToSlash(relativePath(f)),
+				Header: rng.String(),
+				Steps:  r.history[f].stepsIn(rng),
+			})
+		}
+	}
+	r.Patch = patch.String()
+	return nil
+}
+
+// write writes this report to the given file as JSON.
+func (r *batchReport) write(filename string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+// newLineHistory returns a lineHistory for a file with the given (original)
+// contents.
+func newLineHistory(contents string) *lineHistory {
+	lines := splitLines(contents)
+	h := &lineHistory{
+		lines:   lines,
+		steps:   make([][]int, len(lines)),
+		deleted: map[int][]int{},
+		orig:    make([]int, len(lines)),
+	}
+	for i := range lines {
+		h.orig[i] = i
+	}
+	return h
+}
+
+// update records that the given step changed the file's contents to the given
+// text.  Lines that replace lines inserted by earlier steps are attributed to
+// those steps as well.
+func (h *lineHistory) update(contents string, step int) {
+	// lineOffsets[i] is the offset of the ith line
+	lineOffsets := make([]int, len(h.lines)+1)
+	for i, line := range h.lines {
+		lineOffsets[i+1] = lineOffsets[i] + len(line)
+	}
+
+	lines := []string{}
+	steps := [][]int{}
+	orig := []int{}
+	next := 0       // Index of the next line not yet copied or deleted
+	var carry []int // Steps that inserted the lines just deleted
+	text.Diff(h.lines, splitLines(contents)).Iterate(
+		func(extent *text.Extent, replacement string) bool {
+			start := sort.SearchInts(lineOffsets, extent.Offset)
+			if start > next {
+				lines = append(lines, h.lines[next:start]...)
+				steps = append(steps, h.steps[next:start]...)
+				orig = append(orig, h.orig[next:start]...)
+				next = start
+				carry = nil
+			}
+			end := sort.SearchInts(lineOffsets, extent.OffsetPastEnd())
+			for ; next < end; next++ {
+				if h.orig[next] >= 0 {
+					h.deleted[h.orig[next]] = withStep(
+						h.deleted[h.orig[next]], step)
+				}
+				carry = union(carry, h.steps[next])
+			}
+			for _, line := range splitLines(replacement) {
+				lines = append(lines, line)
+				steps = append(steps, withStep(carry, step))
+				orig = append(orig, -1)
+			}
+			return true
+		})
+	h.lines = append(lines, h.lines[next:]...)
+	h.steps = append(steps, h.steps[next:]...)
+	h.orig = append(orig, h.orig[next:]...)
+}
+
+// stepsIn returns the steps that deleted the lines of the original file, or
+// inserted the lines of the new file, in the given range.
+func (h *lineHistory) stepsIn(r text.HunkRange) []int {
+	result := []int{}
+	if h == nil {
+		return result
+	}
+	for i := r.OrigStart - 1; i < r.OrigStart-1+r.OrigLines; i++ {
+		result = union(result, h.deleted[i])
+	}
+	for i := r.NewStart - 1; i < r.NewStart-1+r.NewLines && i < len(h.steps); i++ {
+		result = union(result, h.steps[i])
+	}
+	return result
+}
+
+// withStep returns a sorted list containing the given step and the steps in
+// the given sorted list.
+func withStep(steps []int, step int) []int {
+	return union(steps, []int{step})
+}
+
+// union returns a sorted list of the steps in two sorted lists.
+func union(a, b []int) []int {
+	result := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || i < len(a) && a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case i >= len(a) || b[j] < a[i]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// splitLines splits s into lines, each including its terminating newline
+// (except possibly the last).  Unlike strings.SplitAfter, it does not include
+// an empty final line when s ends with a newline (or is empty).
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the snapshot and diff commands, which record the
+// contents of the Go files in the workspace and later output every change
+// made to them since then as a single patch.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/engine/journal"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// diffFlags are the names of the flags that can be used with the diff
+// command.
+var diffFlags = map[string]bool{
+	"patchdir":    true,
+	"formatpatch": true,
+	"git":         true,
+}
+
+// runSnapshot records the contents of the Go files in the given files and
+// directories (default: the current directory), replacing any existing
+// snapshot of the workspace (the current directory).
+func runSnapshot(stdout, stderr io.Writer, cmdName string, args []string) int {
+	paths := args
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	filenames, err := workspaceGoFiles(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	snapshot, err := journal.TakeSnapshot(".", paths, filenames)
+	if err == nil {
+		err = journal.SaveSnapshot(".", snapshot)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Took a snapshot of %d file(s); use '%s diff' to "+
+		"display the changes made since then\n", len(filenames), cmdName)
+	return 0
+}
+
+// runDiff outputs the changes made to the files in the workspace's snapshot
+// since it was taken, as a single patch (or, with the -patchdir flag, one
+// patch per file).  Files that were created or deleted since then are
+// listed, since they cannot be included in the patch.
+func runDiff(stdout, stderr io.Writer, flags *CLIFlags, cmdName string, args []string) int {
+	invalid := ""
+	flags.Visit(func(f *flag.Flag) {
+		if !diffFlags[f.Name] && invalid == "" {
+			invalid = f.Name
+		}
+	})
+	if invalid != "" {
+		fmt.Fprintf(stderr, "Error: The -%s flag cannot be used with "+
+			"the diff command\n", invalid)
+		return 1
+	}
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, "Error: The diff command does not "+
+			"accept any arguments")
+		return 1
+	}
+
+	snapshot, err := journal.LoadSnapshot(".")
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	if snapshot == nil {
+		fmt.Fprintf(stderr, "Error: No snapshot has been taken "+
+			"(see '%s snapshot')\n", cmdName)
+		return 1
+	}
+
+	current, err := workspaceGoFiles(snapshot.Paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	for _, filename := range current {
+		if _, found := snapshot.Files[filepath.ToSlash(filename)]; !found {
+			fmt.Fprintf(stderr, "Warning: %s was created after the "+
+				"snapshot was taken, so it is not included\n",
+				filename)
+		}
+	}
+
+	paths := make([]string, 0, len(snapshot.Files))
+	for path := range snapshot.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Build a file system containing the files' contents when the
+	// snapshot was taken, and compute the edits that transform them into
+	// their current contents
+	revert := map[string]*text.EditSet{}
+	edits := map[string]*text.EditSet{}
+	for _, path := range paths {
+		filename, err := filepath.Abs(filepath.FromSlash(path))
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		after, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(stderr, "Warning: %s was deleted after the "+
+				"snapshot was taken, so it is not included\n",
+				path)
+			continue
+		} else if err != nil {
+			fmt.Fprintf(stderr, "Error: %s\n", err)
+			return 1
+		}
+		if journal.Hash(after) == snapshot.Files[path] {
+			continue
+		}
+		before, err := journal.LoadObject(".", snapshot.Files[path])
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: The contents of %s when the "+
+				"snapshot was taken are not available: %s\n",
+				path, err)
+			return 1
+		}
+		revert[filename] = text.DiffBytes(after, before)
+		edits[filename] = text.DiffBytes(before, after)
+	}
+	if len(edits) == 0 {
+		fmt.Fprintln(stderr, "No files have changed since the "+
+			"snapshot was taken")
+		return 0
+	}
+
+	fs := filesystem.NewEditedFileSystem(filesystem.NewLocalFileSystem(), revert)
+	if *flags.formatPatchFlag {
+		when := snapshot.Time.Local().Format("2006-01-02 15:04:05")
+		_, err = writeFormatPatch(stdout,
+			fmt.Sprintf("Changes since snapshot of %s", when),
+			fmt.Sprintf("Combined changes made since the snapshot "+
+				"taken at %s.\n", when),
+			edits, nil, fs)
+	} else if *flags.patchDirFlag != "" {
+		err = writePatchFiles(stdout, *flags.patchDirFlag, edits, fs)
+	} else if *flags.gitFlag {
+		_, err = writeGitDiff(stdout, edits, nil, fs)
+	} else {
+		err = writeDiff(stdout, edits, fs)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+	return 0
+}
+
+// workspaceGoFiles returns the paths, relative to the workspace (the current
+// directory), of the Go files in the given files and directories (see
+// goFiles).  It returns an error if any of them is outside the workspace.
+func workspaceGoFiles(paths []string) ([]string, error) {
+	filenames, err := goFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		rel, err := filepath.Rel(cwd, filename)
+		if err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is not in the workspace (%s)",
+				filename, cwd)
+		}
+		result = append(result, rel)
+	}
+	return result, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// These tests run refactorings concurrently; run them with
+//     go test -race
+// to check that refactorings do not share mutable state.
+
+package engine_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+const concurrentSource = `package main
+
+func main() {
+	x := 1
+	x++
+}
+`
+
+func TestGetRefactoringReturnsNewInstance(t *testing.T) {
+	engine.AddDefaultRefactorings()
+	for _, shortName := range engine.AllRefactoringNames() {
+		r := engine.GetRefactoring(shortName)
+		if _, ok := r.(*customRefactoring); ok {
+			// Pointers to zero-size values need not be distinct
+			continue
+		}
+		if r == engine.GetRefactoring(shortName) {
+			t.Fatalf("GetRefactoring(%q) returned a shared instance",
+				shortName)
+		}
+	}
+	if engine.GetRefactoring("no such refactoring") != nil {
+		t.Fatalf("GetRefactoring should return nil for an unknown name")
+	}
+}
+
+// renameConcurrently renames the variable x in concurrentSource to newName
+// and returns the resulting source code.
+func renameConcurrently(newName string) (string, error) {
+	stdinPath, err := filesystem.FakeStdinPath()
+	if err != nil {
+		return "", err
+	}
+	fs, err := filesystem.NewSingleEditedFileSystem(stdinPath, concurrentSource)
+	if err != nil {
+		return "", err
+	}
+	return renameInProgram(fs, nil, newName)
+}
+
+// renameInProgram renames the variable x in concurrentSource, which is stored
+// in the given file system, to newName and returns the resulting source code.
+// If prog is non-nil, it is refactored instead of loading the program again.
+func renameInProgram(fs filesystem.FileSystem, prog *refactoring.LoadedProgram, newName string) (string, error) {
+	stdinPath, err := filesystem.FakeStdinPath()
+	if err != nil {
+		return "", err
+	}
+	selection, err := text.NewSelection(stdinPath, "4,2:4,2")
+	if err != nil {
+		return "", err
+	}
+	r := engine.GetRefactoring("rename")
+	result := r.Run(&refactoring.Config{
+		FileSystem: fs,
+		Scope:      []string{stdinPath},
+		Selection:  selection,
+		Program:    prog,
+		Args:       refactoring.InterpretArgs([]string{newName}, r),
+	})
+	if result.Log.ContainsErrors() {
+		return "", fmt.Errorf("%s", result.Log)
+	}
+	return text.ApplyToString(result.Edits[stdinPath], concurrentSource)
+}
+
+func TestConcurrentRun(t *testing.T) {
+	engine.AddDefaultRefactorings()
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			newName := fmt.Sprintf("renamed%d", i)
+			output, err := renameConcurrently(newName)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			expected := fmt.Sprintf("package main\n\nfunc main() {\n"+
+				"\t%s := 1\n\t%s++\n}\n", newName, newName)
+			if output != expected {
+				errs[i] = fmt.Errorf("expected\n%s\ngot\n%s",
+					expected, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Rename %d: %s", i, err)
+		}
+	}
+}
+
+func TestConcurrentSharedProgram(t *testing.T) {
+	engine.AddDefaultRefactorings()
+
+	stdinPath, err := filesystem.FakeStdinPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := filesystem.NewSingleEditedFileSystem(stdinPath, concurrentSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := refactoring.LoadProgram(&refactoring.Config{
+		FileSystem: fs,
+		Scope:      []string{stdinPath},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			newName := fmt.Sprintf("renamed%d", i)
+			output, err := renameInProgram(fs, prog, newName)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			expected := fmt.Sprintf("package main\n\nfunc main() {\n"+
+				"\t%s := 1\n\t%s++\n}\n", newName, newName)
+			if output != expected {
+				errs[i] = fmt.Errorf("expected\n%s\ngot\n%s",
+					expected, output)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Rename %d: %s", i, err)
+		}
+	}
+
+	// The shared program must not have been modified
+	if output, err := renameInProgram(fs, prog, "y"); err != nil ||
+		output != "package main\n\nfunc main() {\n\ty := 1\n\ty++\n}\n" {
+		t.Fatalf("Rename after sharing program failed: %v\n%s", err, output)
+	}
+}
+
+func TestConcurrentRegistry(t *testing.T) {
+	engine.AddDefaultRefactorings()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			engine.AddRefactoring(fmt.Sprintf("concurrent%d", i),
+				&customRefactoring{})
+		}(i)
+		go func() {
+			defer wg.Done()
+			for _, shortName := range engine.AllRefactoringNames() {
+				if engine.GetRefactoring(shortName) == nil {
+					t.Errorf("GetRefactoring(%q) returned nil",
+						shortName)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,280 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package directive finds directives in Go source code that request
+// refactorings, so they can be reviewed like any other change before they
+// are applied.
+//
+// A directive is a line comment of the form
+//     //doctor:<refactoring> [<arg> ...]
+// on a line by itself, e.g., //doctor:rename NewName.  It applies to the
+// declaration, struct field, or statement that follows it:
+//   - For a function, type, variable, or constant declaration (or a struct
+//     field), the selection is the declared name.
+//   - For a statement, the selection is that statement.  If the directive is
+//     followed (later in the same block) by a //doctor:end comment, the
+//     selection extends to the last statement before it instead.
+//
+// Arguments are separated by white space.
+package directive
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// Prefix is the text that begins every directive.
+const Prefix = "//doctor:"
+
+// End is the name of the directive that ends a range of statements.
+const End = "end"
+
+// A Directive is a comment requesting a refactoring.
+type Directive struct {
+	// The short name of the refactoring (e.g., rename)
+	Refactoring string
+	// The arguments given to the refactoring
+	Args []string
+	// The file and (1-based) line containing the directive
+	Filename string
+	Line     int
+	// The byte offset and length of the selection
+	Offset, Length int
+	// The lines containing the directive and its //doctor:end comment (if
+	// any), which are deleted when the refactoring is applied
+	Extents []*text.Extent
+}
+
+// String returns the directive's comment text, without the leading slashes.
+func (d *Directive) String() string {
+	return strings.TrimPrefix(Prefix, "//") +
+		strings.Join(append([]string{d.Refactoring}, d.Args...), " ")
+}
+
+// Find returns the directives in the given Go source code, in the order they
+// appear.  It returns an error if the code cannot be parsed or a directive is
+// malformed.
+func Find(filename string, src []byte) ([]*Directive, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	f := &finder{fset: fset, file: file, src: src}
+
+	var comments []*ast.Comment
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, Prefix) {
+				comments = append(comments, c)
+			}
+		}
+	}
+
+	result := []*Directive{}
+	var ends []*ast.Comment
+	for i, c := range comments {
+		fields := strings.Fields(c.Text[len(Prefix):])
+		if len(fields) == 0 {
+			return nil, f.errorf(c, "%s must be followed by the name of "+
+				"a refactoring", Prefix)
+		}
+		if !f.isOnOwnLine(c) {
+			return nil, f.errorf(c, "%s%s must be on a line by itself",
+				Prefix, fields[0])
+		}
+		if fields[0] == End {
+			if !containsComment(ends, c) {
+				return nil, f.errorf(c, "%s%s does not end a "+
+					"directive", Prefix, End)
+			}
+			continue
+		}
+
+		var end *ast.Comment
+		if i+1 < len(comments) &&
+			strings.TrimSpace(comments[i+1].Text[len(Prefix):]) == End {
+			end = comments[i+1]
+			ends = append(ends, end)
+		}
+		d, err := f.directive(c, end)
+		if err != nil {
+			return nil, err
+		}
+		d.Refactoring, d.Args = fields[0], fields[1:]
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// A finder contains the state used to find the directives in a file.
+type finder struct {
+	fset *token.FileSet
+	file *ast.File
+	src  []byte
+}
+
+// errorf returns an error at the position of the given comment.
+func (f *finder) errorf(c *ast.Comment, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", f.fset.Position(c.Pos()),
+		fmt.Sprintf(format, args...))
+}
+
+// offset returns the byte offset of the given position.
+func (f *finder) offset(pos token.Pos) int {
+	return f.fset.Position(pos).Offset
+}
+
+// isOnOwnLine returns true if the given comment is preceded only by white
+// space on its line.
+func (f *finder) isOnOwnLine(c *ast.Comment) bool {
+	offset := f.offset(c.Pos())
+	start := bytes.LastIndexByte(f.src[:offset], '\n') + 1
+	return len(bytes.TrimSpace(f.src[start:offset])) == 0
+}
+
+// lineExtent returns the extent of the line containing the given comment,
+// including its newline.
+func (f *finder) lineExtent(c *ast.Comment) *text.Extent {
+	offset := f.offset(c.Pos())
+	start := bytes.LastIndexByte(f.src[:offset], '\n') + 1
+	end := len(f.src)
+	if i := bytes.IndexByte(f.src[offset:], '\n'); i >= 0 {
+		end = offset + i + 1
+	}
+	return &text.Extent{Offset: start, Length: end - start}
+}
+
+// directive returns a Directive (without its refactoring and arguments)
+// for the given comment, which may be followed by the given //doctor:end
+// comment.
+func (f *finder) directive(c, end *ast.Comment) (*Directive, error) {
+	pos := f.fset.Position(c.Pos())
+	d := &Directive{
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Extents:  []*text.Extent{f.lineExtent(c)},
+	}
+	list := f.enclosingList(c.Pos())
+	first := -1
+	for i, node := range list {
+		if node.Pos() > c.End() {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil, f.errorf(c, "%s is not followed by a declaration "+
+			"or statement", c.Text)
+	}
+
+	start, stop := list[first].Pos(), list[first].End()
+	if end != nil {
+		if _, ok := list[first].(ast.Stmt); !ok {
+			return nil, f.errorf(end, "%s%s can only follow statements",
+				Prefix, End)
+		}
+		last := first
+		for last+1 < len(list) && list[last+1].End() < end.Pos() {
+			last++
+		}
+		if list[last].End() > end.Pos() {
+			return nil, f.errorf(end, "%s%s must be in the same "+
+				"block as the directive it ends", Prefix, End)
+		}
+		stop = list[last].End()
+		d.Extents = append(d.Extents, f.lineExtent(end))
+	} else if name := declaredName(list[first]); name != nil {
+		start, stop = name.Pos(), name.End()
+	}
+	d.Offset = f.offset(start)
+	d.Length = f.offset(stop) - d.Offset
+	return d, nil
+}
+
+// enclosingList returns the innermost list of declarations, struct fields,
+// or statements that contains the given position.
+func (f *finder) enclosingList(pos token.Pos) []ast.Node {
+	var result []ast.Node
+	for _, decl := range f.file.Decls {
+		result = append(result, decl)
+	}
+	ast.Inspect(f.file, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos >= n.End() {
+			return n == f.file
+		}
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			result = stmtNodes(n.List)
+		case *ast.CaseClause:
+			result = stmtNodes(n.Body)
+		case *ast.CommClause:
+			result = stmtNodes(n.Body)
+		case *ast.StructType:
+			result = nil
+			for _, field := range n.Fields.List {
+				result = append(result, field)
+			}
+		case *ast.GenDecl:
+			if n.Lparen.IsValid() {
+				result = nil
+				for _, spec := range n.Specs {
+					result = append(result, spec)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// stmtNodes converts a list of statements to a list of nodes.
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	result := make([]ast.Node, 0, len(stmts))
+	for _, stmt := range stmts {
+		result = append(result, stmt)
+	}
+	return result
+}
+
+// declaredName returns the name declared by the given declaration, spec, or
+// field, or nil if it does not declare exactly one name (or is not a
+// declaration).
+func declaredName(node ast.Node) *ast.Ident {
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		return n.Name
+	case *ast.GenDecl:
+		if len(n.Specs) == 1 && !n.Lparen.IsValid() {
+			return declaredName(n.Specs[0])
+		}
+	case *ast.TypeSpec:
+		return n.Name
+	case *ast.ValueSpec:
+		if len(n.Names) == 1 {
+			return n.Names[0]
+		}
+	case *ast.Field:
+		if len(n.Names) == 1 {
+			return n.Names[0]
+		}
+	}
+	return nil
+}
+
+// containsComment returns true if the given comment is in the list.
+func containsComment(comments []*ast.Comment, c *ast.Comment) bool {
+	for _, comment := range comments {
+		if comment == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package directive
+
+import (
+	"strings"
+	"testing"
+)
+
+const src = `package p
+
+//doctor:rename Greet
+func hello() {
+	x := 1
+	//doctor:extract double
+	y := x * 2
+	z := y + 1
+	//doctor:end
+	println(z)
+}
+
+type T struct {
+	A int
+	//doctor:deletefield
+	B, C int
+	//doctor:deletefield
+	D int
+}
+`
+
+func TestFind(t *testing.T) {
+	directives, err := Find("p.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		directive, selection string
+		line, extents        int
+	}{
+		{"doctor:rename Greet", "hello", 3, 1},
+		{"doctor:extract double", "y := x * 2\n\tz := y + 1", 6, 2},
+		{"doctor:deletefield", "B, C int", 15, 1},
+		{"doctor:deletefield", "D", 17, 1},
+	}
+	if len(directives) != len(expected) {
+		t.Fatalf("Expected %d directives, found %d", len(expected),
+			len(directives))
+	}
+	for i, d := range directives {
+		exp := expected[i]
+		selection := src[d.Offset : d.Offset+d.Length]
+		if d.String() != exp.directive || selection != exp.selection ||
+			d.Line != exp.line || len(d.Extents) != exp.extents {
+			t.Errorf("Directive %d: expected %s (line %d) selecting "+
+				"%q with %d extents; found %s (line %d) selecting "+
+				"%q with %d extents", i, exp.directive, exp.line,
+				exp.selection, exp.extents, d, d.Line, selection,
+				len(d.Extents))
+		}
+	}
+}
+
+func TestFindErrors(t *testing.T) {
+	tests := map[string]string{
+		"package p\n\nvar x = 1 //doctor:rename y\n":             "must be on a line by itself",
+		"package p\n\nfunc f() {\n\t//doctor:end\n}\n":           "does not end a directive",
+		"package p\n\nvar x = 1\n\n//doctor:rename y\n":          "is not followed by",
+		"package p\n\n//doctor:\nvar x = 1\n":                    "must be followed by the name",
+		"package p\n\n//doctor:godoc\nvar x = 1\n//doctor:end\n": "can only follow statements",
+	}
+	for code, msg := range tests {
+		_, err := Find("p.go", []byte(code))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected error containing %q for\n%s\nfound %v",
+				msg, code, err)
+		}
+	}
+}
@@ -3,16 +3,36 @@
 // license that can be found in the LICENSE file.
 
 // Package engine is the programmatic entrypoint to the Go refactoring engine.
+//
+// Most clients should describe the code to refactor with a Workspace and run
+// refactorings using its Refactor method, which returns a Result.  These
+// types insulate clients from changes to the refactoring package, which
+// clients that need more control (e.g., sharing a loaded program between
+// refactorings) can use directly.
+//
+// The functions in this package may be called concurrently.  Each call to
+// GetRefactoring constructs a new Refactoring, so several refactorings (even
+// of the same kind) can be run at the same time, e.g., by a server handling
+// requests from several clients.
 package engine
 
 import (
 	"fmt"
+	"reflect"
+	"sync"
 
 	"github.com/godoctor/godoctor/refactoring"
 )
 
-// All available refactorings, keyed by a unique, one-word, all-lowercase name
-var refactorings map[string]refactoring.Refactoring
+// A Constructor returns a new instance of a refactoring.
+type Constructor func() refactoring.Refactoring
+
+// Guards refactorings and refactoringsInOrder
+var mutex sync.RWMutex
+
+// Constructors for all available refactorings, keyed by a unique, one-word,
+// all-lowercase name
+var refactorings map[string]Constructor
 
 // All available refactorings' keys, in the order the refactorings should be
 // displayed in a menu presented to the end user
@@ -22,7 +42,7 @@ func init() {
 	ClearRefactorings()
 }
 
-// AddDefaultRefactorings invokes AddRefactoring on each of the Go Doctor's
+// AddDefaultRefactorings invokes AddRefactoringFunc on each of the Go Doctor's
 // built-in refactorings.
 //
 // Clients implementing a custom Go Doctor may:
@@ -33,36 +53,198 @@ func init() {
 // refactorings are listed before or after the built-in refactorings when
 // "godoctor -list" is run.
 func AddDefaultRefactorings() {
-	AddRefactoring("rename", new(refactoring.Rename))
-	AddRefactoring("extract", new(refactoring.ExtractFunc))
-	AddRefactoring("var", new(refactoring.ExtractLocal))
-	AddRefactoring("toggle", new(refactoring.ToggleVar))
-	AddRefactoring("godoc", new(refactoring.AddGoDoc))
-	AddRefactoring("debug", new(refactoring.Debug))
-	AddRefactoring("null", new(refactoring.Null))
+	AddRefactoringFunc("rename", func() refactoring.Refactoring {
+		return new(refactoring.Rename)
+	})
+	AddRefactoringFunc("extract", func() refactoring.Refactoring {
+		return new(refactoring.ExtractFunc)
+	})
+	AddRefactoringFunc("var", func() refactoring.Refactoring {
+		return new(refactoring.ExtractLocal)
+	})
+	AddRefactoringFunc("toggle", func() refactoring.Refactoring {
+		return new(refactoring.ToggleVar)
+	})
+	AddRefactoringFunc("godoc", func() refactoring.Refactoring {
+		return new(refactoring.AddGoDoc)
+	})
+	AddRefactoringFunc("internal", func() refactoring.Refactoring {
+		return new(refactoring.MoveToInternal)
+	})
+	AddRefactoringFunc("imports", func() refactoring.Refactoring {
+		return new(refactoring.RewriteImports)
+	})
+	AddRefactoringFunc("sentinel", func() refactoring.Refactoring {
+		return new(refactoring.SentinelErrors)
+	})
+	AddRefactoringFunc("pkgerrors", func() refactoring.Refactoring {
+		return new(refactoring.MigratePkgErrors)
+	})
+	AddRefactoringFunc("ioutil", func() refactoring.Refactoring {
+		return new(refactoring.MigrateIoutil)
+	})
+	AddRefactoringFunc("any", func() refactoring.Refactoring {
+		return new(refactoring.ReplaceEmptyInterface)
+	})
+	AddRefactoringFunc("generic", func() refactoring.Refactoring {
+		return new(refactoring.MergeIntoGeneric)
+	})
+	AddRefactoringFunc("guardedmap", func() refactoring.Refactoring {
+		return new(refactoring.EncapsulateGuardedMap)
+	})
+	AddRefactoringFunc("donectx", func() refactoring.Refactoring {
+		return new(refactoring.DoneChannelToContext)
+	})
+	AddRefactoringFunc("handler", func() refactoring.Refactoring {
+		return new(refactoring.ExtractHandler)
+	})
+	AddRefactoringFunc("options", func() refactoring.Refactoring {
+		return new(refactoring.IntroduceOptions)
+	})
+	AddRefactoringFunc("paramobj", func() refactoring.Refactoring {
+		return new(refactoring.ExtractParameterObject)
+	})
+	AddRefactoringFunc("split", func() refactoring.Refactoring {
+		return new(refactoring.SplitFunction)
+	})
+	AddRefactoringFunc("movestmt", func() refactoring.Refactoring {
+		return new(refactoring.MoveStatement)
+	})
+	AddRefactoringFunc("swapargs", func() refactoring.Refactoring {
+		return new(refactoring.SwapArguments)
+	})
+	AddRefactoringFunc("keyed", func() refactoring.Refactoring {
+		return new(refactoring.KeyStructLiterals)
+	})
+	AddRefactoringFunc("addfield", func() refactoring.Refactoring {
+		return new(refactoring.AddField)
+	})
+	AddRefactoringFunc("deletefield", func() refactoring.Refactoring {
+		return new(refactoring.DeleteField)
+	})
+	AddRefactoringFunc("service", func() refactoring.Refactoring {
+		return new(refactoring.ExtractService)
+	})
+	AddRefactoringFunc("segregate", func() refactoring.Refactoring {
+		return new(refactoring.SegregateInterface)
+	})
+	AddRefactoringFunc("typeswitch", func() refactoring.Refactoring {
+		return new(refactoring.ReplaceTypeSwitch)
+	})
+	AddRefactoringFunc("removeresult", func() refactoring.Refactoring {
+		return new(refactoring.RemoveResult)
+	})
+	AddRefactoringFunc("nameresults", func() refactoring.Refactoring {
+		return new(refactoring.NameResults)
+	})
+	AddRefactoringFunc("unnameresults", func() refactoring.Refactoring {
+		return new(refactoring.UnnameResults)
+	})
+	AddRefactoringFunc("guard", func() refactoring.Refactoring {
+		return new(refactoring.IntroduceGuardClauses)
+	})
+	AddRefactoringFunc("exhaustive", func() refactoring.Refactoring {
+		return new(refactoring.CompleteSwitch)
+	})
+	AddRefactoringFunc("featureflag", func() refactoring.Refactoring {
+		return new(refactoring.WrapInFeatureFlag)
+	})
+	AddRefactoringFunc("testhelper", func() refactoring.Refactoring {
+		return new(refactoring.ExtractTestHelper)
+	})
+	AddRefactoringFunc("subtests", func() refactoring.Refactoring {
+		return new(refactoring.ConvertToSubtests)
+	})
+	AddRefactoringFunc("mock", func() refactoring.Refactoring {
+		return new(refactoring.GenerateMock)
+	})
+	AddRefactoringFunc("benchmark", func() refactoring.Refactoring {
+		return new(refactoring.GenerateBenchmark)
+	})
+	AddRefactoringFunc("examples", func() refactoring.Refactoring {
+		return new(refactoring.GenerateExamples)
+	})
+	AddRefactoringFunc("license", func() refactoring.Refactoring {
+		return new(refactoring.InsertLicenseHeader)
+	})
+	AddRefactoringFunc("debug", func() refactoring.Refactoring {
+		return new(refactoring.Debug)
+	})
+	AddRefactoringFunc("null", func() refactoring.Refactoring {
+		return new(refactoring.Null)
+	})
 }
 
 // AllRefactoringNames returns the short names of all refactorings in an
 // order suitable for display in a menu.
 func AllRefactoringNames() []string {
-	return refactoringsInOrder
+	mutex.RLock()
+	defer mutex.RUnlock()
+	result := make([]string, len(refactoringsInOrder))
+	copy(result, refactoringsInOrder)
+	return result
 }
 
-// GetRefactoring returns a Refactoring keyed by the given short name.  The
-// short name must be one of the keys in the map returned by AllRefactorings.
+// GetRefactoring returns a Refactoring keyed by the given short name, or nil
+// if there is no such refactoring.  The short name must be one of the names
+// returned by AllRefactoringNames.
+//
+// A new Refactoring is constructed on each call, so refactorings can store
+// the state of one run in their fields without affecting (or racing with) any
+// other.  A Refactoring needs no other setup: its selection and arguments are
+// all given in the Config passed to its Run method.
 func GetRefactoring(shortName string) refactoring.Refactoring {
-	return refactorings[shortName]
+	mutex.RLock()
+	newRefac := refactorings[shortName]
+	mutex.RUnlock()
+	if newRefac == nil {
+		return nil
+	}
+	return newRefac()
+}
+
+// newInstance returns a shallow copy of the given refactoring, which was
+// passed to AddRefactoring.  Refactorings are usually pointers to structs; if
+// r is not, it cannot retain state between runs, so it is returned as is.
+func newInstance(r refactoring.Refactoring) refactoring.Refactoring {
+	if r == nil {
+		return nil
+	}
+	v := reflect.ValueOf(r)
+	if v.Kind() != reflect.Ptr || v.IsNil() ||
+		v.Elem().Kind() != reflect.Struct {
+		return r
+	}
+	result := reflect.New(v.Elem().Type())
+	result.Elem().Set(v.Elem())
+	return result.Interface().(refactoring.Refactoring)
 }
 
 // AddRefactoring allows custom refactorings to be added to the refactoring
 // engine.  Invoke this method before starting the command line or protocol
 // driver.
+//
+// The given refactoring is not run directly; GetRefactoring returns a copy of
+// it, so it should not be modified after it is added.  AddRefactoringFunc
+// should be used instead if a refactoring cannot be copied.
 func AddRefactoring(shortName string, newRefac refactoring.Refactoring) error {
+	return AddRefactoringFunc(shortName, func() refactoring.Refactoring {
+		return newInstance(newRefac)
+	})
+}
+
+// AddRefactoringFunc allows custom refactorings to be added to the
+// refactoring engine.  GetRefactoring invokes the given Constructor to create
+// a new instance of the refactoring each time it is run.  Invoke this method
+// before starting the command line or protocol driver.
+func AddRefactoringFunc(shortName string, newRefac Constructor) error {
+	mutex.Lock()
+	defer mutex.Unlock()
 	if r, ok := refactorings[shortName]; ok {
 		return fmt.Errorf("The short name \"%s\" is already "+
 			"associated with a refactoring (%s)",
 			shortName,
-			r.Description().Name)
+			r().Description().Name)
 	}
 	refactorings[shortName] = newRefac
 	refactoringsInOrder = append(refactoringsInOrder, shortName)
@@ -72,6 +254,8 @@ func AddRefactoring(shortName string, newRefac refactoring.Refactoring) error {
 // ClearRefactorings removes all registered refactorings from the engine.
 // This should only be used for testing.
 func ClearRefactorings() {
-	refactorings = map[string]refactoring.Refactoring{}
+	mutex.Lock()
+	defer mutex.Unlock()
+	refactorings = map[string]Constructor{}
 	refactoringsInOrder = []string{}
 }
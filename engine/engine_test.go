@@ -5,9 +5,14 @@
 package engine_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/refactoring"
 	"github.com/godoctor/godoctor/text"
 )
@@ -52,3 +57,311 @@ func TestEngine(t *testing.T) {
 		t.Fatalf("The name zz_new should be unique and OK to add (?!)")
 	}
 }
+
+func TestAddRefactoringFunc(t *testing.T) {
+	calls := 0
+	err := engine.AddRefactoringFunc("zz_func", func() refactoring.Refactoring {
+		calls++
+		return &customRefactoring{}
+	})
+	if err != nil {
+		t.Fatalf("The name zz_func should be unique and OK to add (?!)")
+	}
+	if calls != 0 {
+		t.Fatalf("Constructor should not be invoked until the refactoring is needed")
+	}
+	engine.GetRefactoring("zz_func")
+	engine.GetRefactoring("zz_func")
+	if calls != 2 {
+		t.Fatalf("Expected 2 calls to constructor; got %d", calls)
+	}
+
+	err = engine.AddRefactoringFunc("zz_func", func() refactoring.Refactoring {
+		return &customRefactoring{}
+	})
+	if err == nil {
+		t.Fatalf("Should have forbidden adding with existing name")
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	engine.ClearRefactorings()
+	engine.AddDefaultRefactorings()
+	defer engine.ClearRefactorings()
+
+	catalog := engine.Catalog()
+	if len(catalog) != len(engine.AllRefactoringNames()) {
+		t.Fatalf("Expected %d catalog entries; got %d",
+			len(engine.AllRefactoringNames()), len(catalog))
+	}
+	for _, entry := range catalog {
+		d := engine.GetRefactoring(entry.ShortName).Description()
+		if entry.Name != d.Name || entry.Selection != d.Selection ||
+			entry.Multifile != d.Multifile {
+			t.Fatalf("Catalog entry for %s does not match its "+
+				"description", entry.ShortName)
+		}
+		if len(entry.Params) != len(d.Params)+len(d.OptionalParams) {
+			t.Fatalf("Catalog entry for %s has %d parameters",
+				entry.ShortName, len(entry.Params))
+		}
+		stability := engine.Production
+		if d.Hidden {
+			stability = engine.InDevelopment
+		}
+		if entry.Stability != stability {
+			t.Fatalf("Catalog entry for %s has stability %s",
+				entry.ShortName, entry.Stability)
+		}
+		if len(entry.Presets) != len(engine.AllPresetNames()) {
+			t.Fatalf("Catalog entry for %s has %d presets",
+				entry.ShortName, len(entry.Presets))
+		}
+	}
+
+	rename := catalog[0]
+	if rename.ShortName != "rename" || rename.Selection != "An identifier" {
+		t.Fatalf("Expected rename to be listed first")
+	}
+	if p := rename.Params[0]; p.Type != "string" || p.Optional {
+		t.Fatalf("Incorrect catalog entry for rename's first parameter")
+	}
+	if p := rename.Params[len(rename.Params)-1]; p.Type != "bool" || !p.Optional {
+		t.Fatalf("Incorrect catalog entry for rename's last parameter")
+	}
+	if p := rename.Presets[0]; p.Name != engine.SafePreset ||
+		!p.RefuseOnWarning || p.GeneratedFiles != "skip" || !p.PreserveComments {
+		t.Fatalf("Incorrect catalog entry for the safe preset")
+	}
+}
+
+func TestPresetCheck(t *testing.T) {
+	const src = "package p\n\n// Doc for x\nvar x int // trailing\n"
+	filename, err := filesystem.FakeStdinPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := filesystem.NewSingleEditedFileSystem(filename, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &refactoring.Config{FileSystem: fs}
+	check := func(preset string, edits *text.EditSet) *refactoring.Result {
+		result := &refactoring.Result{
+			Log:   refactoring.NewLog(),
+			Edits: map[string]*text.EditSet{filename: edits},
+		}
+		engine.GetPreset(preset).Check(config, result)
+		return result
+	}
+
+	// Replace "x" in the comment and the declaration
+	edits := text.NewEditSet()
+	edits.Add(&text.Extent{Offset: 22, Length: 1}, "y")
+	edits.Add(&text.Extent{Offset: 28, Length: 1}, "y")
+	result := check(engine.SafePreset, edits)
+	if result.Log.ContainsErrors() {
+		t.Fatalf("Unexpected errors: %s", result.Log)
+	}
+	updated, _ := text.ApplyToString(result.Edits[filename], src)
+	if updated != "package p\n\n// Doc for x\nvar y int // trailing\n" {
+		t.Fatalf("Expected the comment to be unchanged; got %q", updated)
+	}
+	result = check(engine.AggressivePreset, edits)
+	updated, _ = text.ApplyToString(result.Edits[filename], src)
+	if updated != "package p\n\n// Doc for y\nvar y int // trailing\n" ||
+		!strings.Contains(result.Log.String(), "(line 3)") {
+		t.Fatalf("Expected the comment to change, with a warning; got %q\n%s", updated, result.Log)
+	}
+
+	// Replace a line containing both code and a comment
+	edits = text.NewEditSet()
+	edits.Add(&text.Extent{Offset: 24, Length: 22}, "var y int\n")
+	result = check(engine.SafePreset, edits)
+	if !result.Log.ContainsErrors() || len(result.Edits) != 0 {
+		t.Fatalf("Expected the safe preset to refuse to change a comment")
+	}
+
+	// Any warning is an error with the safe preset
+	result = &refactoring.Result{Log: refactoring.NewLog(), Edits: map[string]*text.EditSet{}}
+	result.Log.Warn("Something odd")
+	engine.GetPreset(engine.SafePreset).Check(config, result)
+	if !result.Log.ContainsErrors() {
+		t.Fatalf("Expected the safe preset to refuse on a warning")
+	}
+
+	if engine.GetPreset("reckless") != nil {
+		t.Fatalf("Expected no preset named reckless")
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	events := []*engine.Event{}
+	engine.AddObserver(func(e *engine.Event) {
+		copy := *e
+		events = append(events, &copy)
+	})
+	defer engine.ClearObservers()
+
+	edits := text.NewEditSet()
+	edits.Add(&text.Extent{Offset: 0, Length: 1}, "a")
+	edits.Add(&text.Extent{Offset: 5, Length: 1}, "b")
+	result := &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{"x.go": edits, "y.go": text.NewEditSet()},
+	}
+	result.Log.Warn("Something odd")
+	run := engine.StartRun("rename")
+	run.Finished(result)
+	run.Applied()
+
+	result.Log.Error("Something wrong")
+	engine.StartRun("extract").Finished(result)
+
+	expected := []engine.Event{
+		{Kind: engine.RefactoringStarted, Refactoring: "rename"},
+		{Kind: engine.EditsComputed, Refactoring: "rename", Files: 1, Edits: 2, Warnings: 1},
+		{Kind: engine.EditsApplied, Refactoring: "rename", Files: 1, Edits: 2, Warnings: 1},
+		{Kind: engine.RefactoringStarted, Refactoring: "extract"},
+		{Kind: engine.PreconditionsFailed, Refactoring: "extract", Errors: 1, Warnings: 1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events; got %d", len(expected), len(events))
+	}
+	for i, e := range events {
+		if e.Time.IsZero() || e.Elapsed < 0 {
+			t.Fatalf("Event %d (%s) has invalid timing data", i, e.Kind)
+		}
+		e.Time, e.Elapsed = expected[i].Time, expected[i].Elapsed
+		if *e != expected[i] {
+			t.Fatalf("Event %d: expected %+v; got %+v", i, expected[i], *e)
+		}
+	}
+
+	engine.ClearObservers()
+	engine.StartRun("rename").Finished(result)
+	if len(events) != len(expected) {
+		t.Fatalf("Expected no events after ClearObservers")
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	engine.AddDefaultRefactorings()
+	dir, err := ioutil.TempDir("", "godoctor-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte(concurrentSource), 0666); err != nil {
+		t.Fatal(err)
+	}
+	selection, err := text.NewSelection(filename, "4,2:4,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry := engine.Describe("rename"); entry == nil || entry.Name != "Rename" {
+		t.Fatalf("Describe(\"rename\") returned %+v", entry)
+	}
+	if engine.Describe("nonexistent") != nil {
+		t.Fatalf("Describe should return nil for an unknown refactoring")
+	}
+
+	workspace := &engine.Workspace{Scope: []string{filename}}
+	if _, err := workspace.Refactor(&engine.Request{Refactoring: "nonexistent"}); err == nil {
+		t.Fatalf("Expected an error for an unknown refactoring")
+	}
+	if _, err := workspace.Refactor(&engine.Request{Refactoring: "rename", Preset: "reckless"}); err == nil {
+		t.Fatalf("Expected an error for an unknown preset")
+	}
+
+	result, err := workspace.Refactor(&engine.Request{
+		Refactoring: "rename",
+		Selection:   selection,
+		Args:        []string{"3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := result.Messages()
+	if !result.HasErrors() || len(messages) == 0 ||
+		messages[len(messages)-1].Severity != engine.ErrorMessage {
+		t.Fatalf("Expected an error renaming to 3; got %v", messages)
+	}
+
+	result, err = workspace.Refactor(&engine.Request{
+		Refactoring: "rename",
+		Selection:   selection,
+		Args:        []string{"y"},
+		Preset:      "safe",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasErrors() {
+		t.Fatalf("Unexpected errors: %v", result.Messages())
+	}
+	if files := result.Files(); len(files) != 1 || files[0] != filename {
+		t.Fatalf("Expected edits to %s; got %v", filename, files)
+	}
+	expected := strings.Replace(concurrentSource, "x", "y", -1)
+	contents, err := result.Contents(filename)
+	if err != nil || string(contents) != expected {
+		t.Fatalf("Expected contents:\n%s\nGot (%v):\n%s", expected, err, contents)
+	}
+	applied, err := text.ApplyToString(result.Edits(filename), concurrentSource)
+	if err != nil || applied != expected {
+		t.Fatalf("Expected edits producing:\n%s\nGot (%v):\n%s", expected, err, applied)
+	}
+	if result.Edits(filepath.Join(dir, "other.go")) != nil {
+		t.Fatalf("Expected no edits to a file the refactoring does not change")
+	}
+	if changes := result.FileSystemChanges(); len(changes) != 0 {
+		t.Fatalf("Expected no file system changes; got %v", changes)
+	}
+	if checksum, ok := result.Checksum(filename); !ok ||
+		checksum != filesystem.Checksum([]byte(concurrentSource)) {
+		t.Fatalf("Expected the checksum of the original contents; got %q", checksum)
+	}
+	if err := result.WriteMessages(ioutil.Discard, "unknown", dir); err == nil {
+		t.Fatalf("Expected an error for an unknown message format")
+	}
+	if err := result.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	contents, err = ioutil.ReadFile(filename)
+	if err != nil || string(contents) != expected {
+		t.Fatalf("Expected file contents:\n%s\nGot (%v):\n%s", expected, err, contents)
+	}
+
+	// The file has changed since the refactoring analyzed it
+	if err := result.Apply(); err == nil {
+		t.Fatalf("Expected Apply to fail after the file was modified")
+	}
+
+	// The Target identifies x even after the file is edited
+	target := result.Target()
+	if target == nil {
+		t.Fatalf("Expected a target for the selected identifier")
+	}
+	edited := "package main\n\n// main is edited\nfunc main() {\n\tprintln()\n\tx := 1\n\tx++\n}\n"
+	if err := ioutil.WriteFile(filename, []byte(edited), 0666); err != nil {
+		t.Fatal(err)
+	}
+	result, err = workspace.Refactor(&engine.Request{
+		Refactoring: "rename",
+		Selection:   selection,
+		Target:      target,
+		Args:        []string{"z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Replace(edited, "x", "z", -1)
+	contents, err = result.Contents(filename)
+	if result.HasErrors() || err != nil || string(contents) != expected {
+		t.Fatalf("Expected contents:\n%s\nGot (%v, %v):\n%s",
+			expected, err, result.Messages(), contents)
+	}
+}
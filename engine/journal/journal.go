@@ -0,0 +1,265 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package journal records the refactorings that have been applied to the
+// files in a workspace, so that they can be listed and replayed (e.g., to
+// reproduce a large-scale migration on a new checkout).
+//
+// The journal is stored in a file named .godoctor/journal in the workspace
+// directory.  Each line of the file is a JSON object describing one applied
+// (or undone) refactoring; entries are appended in the order the refactorings
+// were applied.  The contents of each file before it was modified are stored
+// in .godoctor/objects, named by their hashes, so that refactorings can be
+// undone.  A snapshot of the contents of the workspace's files (see Snapshot)
+// may also be stored, in .godoctor/snapshot.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// Dir is the name of the directory, relative to the workspace, containing the
+// journal.
+const Dir = ".godoctor"
+
+// Filename is the name of the journal file in Dir.
+const Filename = "journal"
+
+// ObjectsDir is the name of the directory in Dir containing the contents of
+// files before they were modified.
+const ObjectsDir = "objects"
+
+// An Entry records a single refactoring that was applied to the workspace.
+type Entry struct {
+	// When the refactoring was applied
+	Time time.Time `json:"time"`
+	// The short name of the refactoring (e.g., rename)
+	Refactoring string `json:"refactoring"`
+	// The arguments given to the refactoring
+	Args []string `json:"args,omitempty"`
+	// The file containing the selection, relative to the workspace
+	File string `json:"file"`
+	// The selection, in the format accepted by the -pos flag
+	Pos string `json:"pos"`
+	// A fingerprint of the selected node (see package fingerprint), which
+	// identifies it even if the file has been reformatted or edited since
+	// the refactoring was applied, or the empty string if the selection did
+	// not identify a single node
+	Target string `json:"target,omitempty"`
+	// Other command line flags that affect the result of the refactoring
+	// (e.g., -scope), in the form -name=value
+	Flags []string `json:"flags,omitempty"`
+	// The files that were modified
+	Files []*File `json:"files"`
+	// Other changes to the file system (e.g., files that were moved)
+	Changes []string `json:"changes,omitempty"`
+	// If nonzero, this entry records that the changes made by the given
+	// entry (numbered from 1) were undone
+	Undo int `json:"undo,omitempty"`
+}
+
+// A File describes the changes that a refactoring made to a single file.
+type File struct {
+	// The path of the file, relative to the workspace
+	Path string `json:"path"`
+	// The hash of the file's contents before the refactoring was applied
+	Before string `json:"before"`
+	// The hash of the file's contents after the refactoring was applied
+	After string `json:"after"`
+	// The edits that were applied to the file, in terms of its contents
+	// before the refactoring was applied
+	Edits []*Edit `json:"edits"`
+}
+
+// An Edit is a single replacement made to a file.
+type Edit struct {
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`
+	Replacement string `json:"replacement"`
+}
+
+// NewFile returns a File describing the given edits, which transformed a file
+// with the contents before into a file with the contents after.
+func NewFile(path string, edits *text.EditSet, before, after []byte) *File {
+	result := &File{
+		Path:   filepath.ToSlash(path),
+		Before: Hash(before),
+		After:  Hash(after),
+		Edits:  []*Edit{},
+	}
+	edits.Iterate(func(extent *text.Extent, replacement string) bool {
+		result.Edits = append(result.Edits, &Edit{
+			Offset:      extent.Offset,
+			Length:      extent.Length,
+			Replacement: replacement,
+		})
+		return true
+	})
+	return result
+}
+
+// EditSet returns an EditSet containing the edits that were applied to this
+// file.
+func (f *File) EditSet() *text.EditSet {
+	result := text.NewEditSet()
+	for _, e := range f.Edits {
+		result.Add(&text.Extent{Offset: e.Offset, Length: e.Length},
+			e.Replacement)
+	}
+	return result
+}
+
+// Hash returns a hexadecimal SHA-256 hash of the given file contents.
+func Hash(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Command returns the command line arguments (excluding the command name)
+// that will apply this refactoring to the workspace again.
+func (e *Entry) Command() []string {
+	args := []string{"-file=" + filepath.FromSlash(e.File), "-pos=" + e.Pos}
+	if e.Target != "" {
+		args = append(args, "-target="+e.Target)
+	}
+	args = append(args, e.Flags...)
+	args = append(args, "-w", e.Refactoring)
+	return append(args, e.Args...)
+}
+
+// String returns a one-line summary of this entry.
+func (e *Entry) String() string {
+	edits := 0
+	for _, f := range e.Files {
+		edits += len(f.Edits)
+	}
+	if e.Undo != 0 {
+		return fmt.Sprintf("%s  undo %d (%s)  (%d file(s), %d edit(s))",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Undo,
+			strings.Join(append([]string{e.Refactoring}, e.Args...), " "),
+			len(e.Files), edits)
+	}
+	return fmt.Sprintf("%s  %s  %s:%s  (%d file(s), %d edit(s))",
+		e.Time.Local().Format("2006-01-02 15:04:05"),
+		strings.Join(append([]string{e.Refactoring}, e.Args...), " "),
+		e.File, e.Pos, len(e.Files), edits)
+}
+
+// Applied returns the numbers (starting from 1) of the entries that record
+// refactorings that have been applied and not undone, in the order they were
+// applied.
+func Applied(entries []*Entry) []int {
+	undone := map[int]bool{}
+	for _, e := range entries {
+		if e.Undo != 0 {
+			undone[e.Undo] = true
+		}
+	}
+	result := []int{}
+	for i, e := range entries {
+		if e.Undo == 0 && !undone[i+1] {
+			result = append(result, i+1)
+		}
+	}
+	return result
+}
+
+// Path returns the path of the journal file for the given workspace.
+func Path(workspace string) string {
+	return filepath.Join(workspace, Dir, Filename)
+}
+
+// Load reads all of the entries in the journal for the given workspace, in
+// the order they were recorded.  If there is no journal, it returns an empty
+// slice.
+func Load(workspace string) ([]*Entry, error) {
+	f, err := os.Open(Path(workspace))
+	if os.IsNotExist(err) {
+		return []*Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", Path(workspace),
+				line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Append adds an entry to the end of the journal for the given workspace,
+// creating the journal if necessary.
+func Append(workspace string, entry *Entry) error {
+	if err := os.MkdirAll(filepath.Join(workspace, Dir), 0777); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(workspace),
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// SaveObject stores the given file contents in the workspace's object
+// directory (if they are not already stored there) and returns their hash.
+func SaveObject(workspace string, contents []byte) (string, error) {
+	hash := Hash(contents)
+	dir := filepath.Join(workspace, Dir, ObjectsDir)
+	path := filepath.Join(dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	return hash, ioutil.WriteFile(path, contents, 0666)
+}
+
+// LoadObject returns the file contents with the given hash from the
+// workspace's object directory.
+func LoadObject(workspace string, hash string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(
+		filepath.Join(workspace, Dir, ObjectsDir, hash))
+	if err != nil {
+		return nil, err
+	}
+	if Hash(contents) != hash {
+		return nil, fmt.Errorf("the stored contents for %s are corrupt", hash)
+	}
+	return contents, nil
+}
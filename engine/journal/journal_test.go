@@ -0,0 +1,158 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestNewFile(t *testing.T) {
+	es := text.NewEditSet()
+	es.Add(&text.Extent{Offset: 0, Length: 5}, "Goodbye")
+	before, after := []byte("Hello, world"), []byte("Goodbye, world")
+	f := NewFile("a/b.go", es, before, after)
+	if f.Path != "a/b.go" || f.Before != Hash(before) ||
+		f.After != Hash(after) || len(f.Edits) != 1 {
+		t.Fatalf("Unexpected File: %#v", f)
+	}
+	result, err := text.ApplyToString(f.EditSet(), string(before))
+	if err != nil || result != string(after) {
+		t.Fatalf("EditSet did not reproduce edits: %q", result)
+	}
+}
+
+func TestAppendLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries, err := Load(dir)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected empty journal; got %v (%v)", entries, err)
+	}
+
+	first := &Entry{
+		Time:        time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+		Refactoring: "rename",
+		Args:        []string{"newName"},
+		File:        "main.go",
+		Pos:         "3,5:3,5",
+		Flags:       []string{"-scope=main"},
+		Files: []*File{{
+			Path:   "main.go",
+			Before: "0",
+			After:  "1",
+			Edits:  []*Edit{{Offset: 1, Length: 2, Replacement: "x"}},
+		}},
+	}
+	second := &Entry{Refactoring: "godoc", File: "a.go", Pos: "1,1:1,1",
+		Target: "example.com/a#T@0123abcd"}
+	for _, e := range []*Entry{first, second} {
+		if err := Append(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err = Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries; got %d", len(entries))
+	}
+	if !reflect.DeepEqual(entries[0], first) {
+		t.Fatalf("Entry did not round trip:\n%#v\n%#v", entries[0], first)
+	}
+
+	expected := "-file=main.go -pos=3,5:3,5 -scope=main -w rename newName"
+	if actual := strings.Join(entries[0].Command(), " "); actual != expected {
+		t.Fatalf("Expected command %q; got %q", expected, actual)
+	}
+	expected = "-file=a.go -pos=1,1:1,1 -target=example.com/a#T@0123abcd -w godoc"
+	if actual := strings.Join(entries[1].Command(), " "); actual != expected {
+		t.Fatalf("Expected command %q; got %q", expected, actual)
+	}
+}
+
+func TestApplied(t *testing.T) {
+	entries := []*Entry{{}, {}, {Undo: 2}, {}, {Undo: 4}, {}}
+	expected := []int{1, 6}
+	if actual := Applied(entries); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v; got %v", expected, actual)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := []byte("package main\n")
+	hash, err := SaveObject(dir, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != Hash(contents) {
+		t.Fatalf("Expected hash %s; got %s", Hash(contents), hash)
+	}
+	// Saving the same contents again is a no-op
+	if _, err := SaveObject(dir, contents); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadObject(dir, hash)
+	if err != nil || string(loaded) != string(contents) {
+		t.Fatalf("Unable to load object: %v", err)
+	}
+	if _, err := LoadObject(dir, Hash([]byte("missing"))); err == nil {
+		t.Fatal("Expected error loading missing object")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if snapshot, err := LoadSnapshot(dir); err != nil || snapshot != nil {
+		t.Fatalf("Expected no snapshot; got %v, %v", snapshot, err)
+	}
+	contents := []byte("package main\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), contents, 0666); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := TakeSnapshot(dir, []string{"."}, []string{"main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSnapshot(dir, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Paths, []string{"."}) ||
+		!reflect.DeepEqual(loaded.Files, map[string]string{"main.go": Hash(contents)}) {
+		t.Fatalf("Unexpected snapshot: %#v", loaded)
+	}
+	if stored, err := LoadObject(dir, loaded.Files["main.go"]); err != nil ||
+		string(stored) != string(contents) {
+		t.Fatalf("Snapshot contents were not stored: %q, %v", stored, err)
+	}
+}
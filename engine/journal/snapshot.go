@@ -0,0 +1,96 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines snapshots, which record the contents of the files in a
+// workspace so that every change made since then (e.g., by a script that
+// applies many refactorings) can be combined into a single patch.
+
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotFilename is the name of the file in Dir containing the workspace's
+// snapshot.
+const SnapshotFilename = "snapshot"
+
+// A Snapshot records the contents of a set of files at a point in time.  The
+// contents themselves are stored in the workspace's object directory (see
+// SaveObject).
+type Snapshot struct {
+	// When the snapshot was taken
+	Time time.Time `json:"time"`
+	// The files and directories that were included in the snapshot,
+	// relative to the workspace
+	Paths []string `json:"paths"`
+	// The hash of each file's contents, keyed by its path relative to the
+	// workspace
+	Files map[string]string `json:"files"`
+}
+
+// SnapshotPath returns the path of the snapshot file for the given workspace.
+func SnapshotPath(workspace string) string {
+	return filepath.Join(workspace, Dir, SnapshotFilename)
+}
+
+// TakeSnapshot stores the contents of the given files (whose paths are
+// relative to the workspace) in the workspace's object directory and returns
+// a Snapshot of them.  The snapshot is not saved; see SaveSnapshot.
+func TakeSnapshot(workspace string, paths, filenames []string) (*Snapshot, error) {
+	result := &Snapshot{
+		Time:  time.Now().UTC(),
+		Paths: make([]string, 0, len(paths)),
+		Files: map[string]string{},
+	}
+	for _, path := range paths {
+		result.Paths = append(result.Paths, filepath.ToSlash(path))
+	}
+	for _, filename := range filenames {
+		contents, err := ioutil.ReadFile(filepath.Join(workspace, filename))
+		if err != nil {
+			return nil, err
+		}
+		hash, err := SaveObject(workspace, contents)
+		if err != nil {
+			return nil, err
+		}
+		result.Files[filepath.ToSlash(filename)] = hash
+	}
+	return result, nil
+}
+
+// SaveSnapshot saves the given snapshot in the given workspace, replacing any
+// existing snapshot.
+func SaveSnapshot(workspace string, snapshot *Snapshot) error {
+	if err := os.MkdirAll(filepath.Join(workspace, Dir), 0777); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(SnapshotPath(workspace), append(data, '\n'), 0666)
+}
+
+// LoadSnapshot returns the snapshot saved in the given workspace, or nil if
+// no snapshot has been taken.
+func LoadSnapshot(workspace string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(SnapshotPath(workspace))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %s", SnapshotPath(workspace), err)
+	}
+	return &snapshot, nil
+}
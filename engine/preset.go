@@ -0,0 +1,274 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines presets, named bundles of settings that determine how
+// cautiously refactorings are applied.
+
+package engine
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A Preset is a named bundle of settings that determines how cautiously a
+// refactoring is applied.  A client selects a preset (see GetPreset), calls
+// Configure before running a refactoring, and calls Check on its result.
+//
+// Presets are concerned with three risks: the refactoring may log warnings,
+// it may modify generated files, and it may modify comments.  A cautious
+// preset refuses to take these risks; an aggressive preset takes them but
+// logs a warning for each.
+type Preset struct {
+	// The name used to select this preset (e.g., safe)
+	Name string
+	// A brief phrase describing this preset, with the first letter
+	// capitalized
+	Description string
+	// If true, a refactoring that logs any warnings fails (i.e., the
+	// warnings are changed to errors and its changes are discarded)
+	RefuseOnWarning bool
+	// What to do if the refactoring would modify a generated file
+	GeneratedFiles refactoring.GeneratedFilePolicy
+	// If true, edits that change only the text of a comment are
+	// discarded, and a refactoring whose other edits would change a
+	// comment fails; otherwise, a warning is logged for each comment
+	// that is changed
+	PreserveComments bool
+}
+
+// Names of the available presets
+const (
+	// SafePreset refuses on any warning, skips generated files, and never
+	// modifies comments.
+	SafePreset = "safe"
+	// AggressivePreset makes best-effort changes, logging warnings when
+	// it modifies generated files or comments.
+	AggressivePreset = "aggressive"
+)
+
+var presets = []*Preset{
+	{
+		Name:             SafePreset,
+		Description:      "Refuse on any warning; never touch generated files or comments",
+		RefuseOnWarning:  true,
+		GeneratedFiles:   refactoring.SkipGeneratedFiles,
+		PreserveComments: true,
+	},
+	{
+		Name:             AggressivePreset,
+		Description:      "Make best-effort changes, with warnings",
+		RefuseOnWarning:  false,
+		GeneratedFiles:   refactoring.EditGeneratedFiles,
+		PreserveComments: false,
+	},
+}
+
+// AllPresetNames returns the names of all available presets.
+func AllPresetNames() []string {
+	result := make([]string, len(presets))
+	for i, p := range presets {
+		result[i] = p.Name
+	}
+	return result
+}
+
+// GetPreset returns the preset with the given name, or nil if there is no
+// such preset.  The name must be one of the names returned by AllPresetNames.
+func GetPreset(name string) *Preset {
+	for _, p := range presets {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Configure modifies the given configuration for a refactoring to be run
+// with this preset.
+//
+// Generated files are handled by Check rather than by the refactoring, so
+// the refactoring is configured to edit them.  (Otherwise, the warnings it
+// logged when skipping them would cause a preset that refuses on warnings to
+// refuse every change to a package containing a generated file.)
+func (p *Preset) Configure(config *refactoring.Config) {
+	config.GeneratedFiles = refactoring.EditGeneratedFiles
+}
+
+// Check examines the result of a refactoring that was run with the given
+// configuration (see Configure) and changes it according to this preset:
+// changes to generated files and comments that this preset does not allow are
+// discarded, and if the refactoring took any other risk this preset refuses
+// to take, errors are logged and all of its changes are discarded.  It should
+// be called after the refactoring is run, before its changes are applied.
+func (p *Preset) Check(config *refactoring.Config, result *refactoring.Result) {
+	if result.Log.ContainsErrors() {
+		return
+	}
+
+	if p.RefuseOnWarning {
+		refused := false
+		for _, entry := range result.Log.Entries {
+			if entry.Severity == refactoring.Warning {
+				entry.Severity = refactoring.Error
+				refused = true
+			}
+		}
+		if refused {
+			result.Log.Errorf("The %s preset does not allow refactorings that produce warnings", p.Name)
+			discardChanges(result)
+			return
+		}
+	}
+
+	filenames := []string{}
+	for filename := range result.Edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		src, err := readFile(config.FileSystem, filename)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if file == nil {
+			continue
+		}
+		edits := result.Edits[filename]
+
+		if refactoring.IsGenerated(file) && !isEmptyEditSet(edits) {
+			switch p.GeneratedFiles {
+			case refactoring.EditGeneratedFiles:
+				result.Log.Warnf("%s is a generated file, but it was modified", filename)
+			case refactoring.SkipGeneratedFiles:
+				result.Log.Warnf("%s is a generated file, so it was not modified", filename)
+				delete(result.Edits, filename)
+				continue
+			case refactoring.FailOnGeneratedFiles:
+				result.Log.Errorf("The refactoring would modify the generated file %s", filename)
+				continue
+			}
+		}
+
+		codeEdits, commentLines, mixedLines := splitCommentEdits(fset, file, edits)
+		if !p.PreserveComments {
+			for _, line := range union(commentLines, mixedLines) {
+				result.Log.Warnf("The refactoring modified a comment in %s (line %d)", filename, line)
+			}
+			continue
+		}
+		for _, line := range mixedLines {
+			result.Log.Errorf("The refactoring would modify a comment in %s (line %d)", filename, line)
+		}
+		if len(mixedLines) == 0 && len(commentLines) > 0 {
+			for _, line := range commentLines {
+				result.Log.Infof("The comment in %s (line %d) was not modified", filename, line)
+			}
+			if isEmptyEditSet(codeEdits) {
+				delete(result.Edits, filename)
+			} else {
+				result.Edits[filename] = codeEdits
+			}
+		}
+	}
+
+	if result.Log.ContainsErrors() {
+		discardChanges(result)
+	}
+}
+
+// discardChanges removes all of the edits and file system changes from the
+// given result.
+func discardChanges(result *refactoring.Result) {
+	result.Edits = map[string]*text.EditSet{}
+	result.FSChanges = []filesystem.Change{}
+}
+
+// splitCommentEdits divides the given edits into those that change only the
+// text of a comment and the remaining edits, which are returned.  It also
+// returns the (1-based) starting lines of the comments changed by the former
+// and of the comments changed by the latter, i.e., edits that change both a
+// comment and the surrounding code.
+func splitCommentEdits(fset *token.FileSet, file *ast.File, edits *text.EditSet) (*text.EditSet, []int, []int) {
+	comments := []*ast.Comment{}
+	for _, group := range file.Comments {
+		comments = append(comments, group.List...)
+	}
+	extents := []*text.Extent{}
+	replacements := []string{}
+	commentLines := []int{}
+	mixedLines := []int{}
+	edits.Iterate(func(extent *text.Extent, replacement string) bool {
+		inComment := false
+		for _, c := range comments {
+			start := fset.Position(c.Pos()).Offset
+			end := fset.Position(c.End()).Offset
+			line := fset.Position(c.Pos()).Line
+			switch {
+			case extent.Length == 0 && start < extent.Offset && extent.Offset < end,
+				extent.Length > 0 && start <= extent.Offset && extent.OffsetPastEnd() <= end:
+				inComment = true
+				commentLines = union(commentLines, []int{line})
+			case extent.Length > 0 && start < extent.OffsetPastEnd() && extent.Offset < end:
+				mixedLines = union(mixedLines, []int{line})
+			}
+		}
+		if !inComment {
+			extents = append(extents, extent)
+			replacements = append(replacements, replacement)
+		}
+		return true
+	})
+
+	// EditSet.Add places an insertion before any edits already added at
+	// the same offset, so add the edits in reverse to preserve their order
+	codeEdits := text.NewEditSet()
+	for i := len(extents) - 1; i >= 0; i-- {
+		codeEdits.Add(extents[i], replacements[i])
+	}
+	return codeEdits, commentLines, mixedLines
+}
+
+// union returns a sorted list of the distinct integers in two sorted lists.
+func union(a, b []int) []int {
+	result := append(append([]int{}, a...), b...)
+	sort.Ints(result)
+	n := 0
+	for i, x := range result {
+		if i == 0 || x != result[n-1] {
+			result[n] = x
+			n++
+		}
+	}
+	return result[:n]
+}
+
+// readFile returns the contents of the given file in the given file system.
+func readFile(fs filesystem.FileSystem, filename string) ([]byte, error) {
+	f, err := fs.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// isEmptyEditSet returns true iff the given EditSet contains no edits.
+func isEmptyEditSet(edits *text.EditSet) bool {
+	empty := true
+	edits.Iterate(func(*text.Extent, string) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
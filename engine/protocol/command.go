@@ -39,6 +39,25 @@ func aboutValidate(state *State, input map[string]interface{}) error {
 	}
 }
 
+// -=-= Catalog =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// catalog replies with a description of every refactoring (including its
+// parameters and what must be selected), so a client can build its menus and
+// dialogs without knowing about the refactorings in advance.
+func catalog(state *State, input map[string]interface{}) (Reply, error) {
+	if err := catalogValidate(state, input); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+	return Reply{map[string]interface{}{"reply": "OK", "refactorings": engine.Catalog()}}, nil
+}
+
+func catalogValidate(state *State, input map[string]interface{}) error {
+	if state.State < 1 {
+		return errors.New("The catalog command requires a state of non-zero")
+	}
+	return nil
+}
+
 // -=-= List =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
 // TODO add in implementation of fileselection and textselection keys
@@ -308,7 +327,8 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 	}
 
 	// get refactoring
-	refac := engine.GetRefactoring(input["transformation"].(string))
+	refacName := input["transformation"].(string)
+	refac := engine.GetRefactoring(refacName)
 
 	config := &refactoring.Config{
 		FileSystem: state.Filesystem,
@@ -318,7 +338,9 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 	}
 
 	// run
+	run := engine.StartRun(refacName)
 	result := refac.Run(config)
+	run.Finished(result)
 
 	// grab logs
 	limit, found := input["limit"].(int)
@@ -337,6 +359,15 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 			severity = "error"
 		}
 		log := map[string]interface{}{"severity": severity, "message": entry.Message}
+		if entry.Pos.IsValid() && result.Log.Fset != nil {
+			pos := result.Log.Fset.Position(entry.Pos)
+			log["file"] = pos.Filename
+			log["line"] = pos.Line
+			log["column"] = pos.Column
+		}
+		if entry.Arg != refactoring.NoArg {
+			log["argument"] = entry.Arg
+		}
 		logs = append(logs, log)
 	}
 
@@ -353,7 +384,7 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 			}
 			diffFile, err := os.Create(strings.Join([]string{f, ".diff"}, ""))
 			p.Write(f, f, time.Time{}, time.Time{}, diffFile)
-			changes = append(changes, map[string]string{"filename": f, "patchFile": diffFile.Name()})
+			changes = append(changes, map[string]string{"filename": f, "patchFile": diffFile.Name(), "checksum": result.Checksums[f]})
 			diffFile.Close()
 		}
 	} else {
@@ -362,11 +393,12 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 			if err != nil {
 				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
 			}
-			changes = append(changes, map[string]string{"filename": f, "content": string(content)})
+			changes = append(changes, map[string]string{"filename": f, "content": string(content), "checksum": result.Checksums[f]})
 		}
 	}
 
-	// return without filesystem changes
+	// return without filesystem changes; each file's checksum allows the
+	// client to verify that it has not changed before applying the changes
 	return Reply{map[string]interface{}{"reply": "OK", "description": refac.Description().Name, "log": logs, "files": changes}}, nil
 }
 
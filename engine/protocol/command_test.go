@@ -4,7 +4,12 @@
 
 package protocol
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/engine"
+)
 
 func TestAboutValidatePass(t *testing.T) {
 	// about requires state > 0 to pass validation
@@ -52,3 +57,30 @@ func TestAboutRunPass(t *testing.T) {
 		}
 	}
 }
+
+func TestReplyStringError(t *testing.T) {
+	// channels cannot be encoded as JSON
+	reply := Reply{map[string]interface{}{"reply": "OK", "c": make(chan int)}}
+	if s := reply.String(); !strings.HasPrefix(s, `{"message":`) ||
+		!strings.Contains(s, `"reply":"Error"`) {
+		t.Fatalf("Reply.String: expected an Error reply; got %s", s)
+	}
+}
+
+func TestCatalogRun(t *testing.T) {
+	engine.ClearRefactorings()
+	engine.AddDefaultRefactorings()
+	defer engine.ClearRefactorings()
+
+	if _, err := catalog(&State{State: 0}, nil); err == nil {
+		t.Fatal("Catalog.Run: should fail with state < 1")
+	}
+	reply, err := catalog(&State{State: 1}, nil)
+	if err != nil || reply.Params["reply"] != "OK" {
+		t.Fatal("Catalog.Run: should pass with state of 1")
+	}
+	entries := reply.Params["refactorings"].([]*engine.CatalogEntry)
+	if len(entries) == 0 || !strings.Contains(reply.String(), `"selection":"An identifier"`) {
+		t.Fatalf("Catalog.Run: incomplete catalog: %s", reply)
+	}
+}
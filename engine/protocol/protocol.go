@@ -22,8 +22,14 @@ type Reply struct {
 	Params map[string]interface{}
 }
 
+// String returns the JSON encoding of this reply.  If the reply cannot be
+// encoded, an Error reply describing the problem is returned instead.
 func (r Reply) String() string {
-	replyJson, _ := json.Marshal(r.Params)
+	replyJson, err := json.Marshal(r.Params)
+	if err != nil {
+		replyJson, _ = json.Marshal(map[string]interface{}{
+			"reply": "Error", "message": err.Error()})
+	}
 	return string(replyJson)
 }
 
@@ -140,6 +146,7 @@ func runList(writer io.Writer, aboutText string, argJson []map[string]interface{
 func setup() map[string]Command {
 	cmds := make(map[string]Command)
 	cmds["about"] = about
+	cmds["catalog"] = catalog
 	cmds["open"] = open
 	cmds["list"] = list
 	cmds["setdir"] = setdir
@@ -0,0 +1,165 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines opt-in telemetry hooks, which allow a host application
+// that embeds the engine (e.g., an editor plug-in) to collect performance and
+// success metrics.  No events are reported unless the host registers an
+// Observer.
+
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+// An EventKind identifies the step of a refactoring's run that an Event
+// describes.
+type EventKind int
+
+const (
+	// RefactoringStarted is reported when a refactoring begins running,
+	// before its program is loaded.
+	RefactoringStarted EventKind = iota
+	// PreconditionsFailed is reported when a refactoring finishes running
+	// but logged errors, so its changes cannot be applied.
+	PreconditionsFailed
+	// EditsComputed is reported when a refactoring finishes running
+	// without errors.
+	EditsComputed
+	// EditsApplied is reported when the client has applied a refactoring's
+	// changes (e.g., written them to disk).
+	EditsApplied
+)
+
+var eventKindNames = []string{"started", "preconditionsFailed",
+	"editsComputed", "applied"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+// An Event describes a step in a run of a refactoring, for telemetry.
+type Event struct {
+	Kind EventKind
+	// The short name of the refactoring (e.g., rename)
+	Refactoring string
+	// The time at which the step completed
+	Time time.Time
+	// The time elapsed since the refactoring started (zero for a
+	// RefactoringStarted event)
+	Elapsed time.Duration
+	// The number of files the refactoring changes (including file system
+	// changes, such as renaming a file) and the number of edits to those
+	// files; zero for a RefactoringStarted or PreconditionsFailed event
+	Files, Edits int
+	// The number of errors and warnings in the refactoring's log; zero for
+	// a RefactoringStarted event
+	Errors, Warnings int
+}
+
+// An Observer receives telemetry events.  Observers are invoked
+// synchronously, so they should return quickly; since refactorings may be
+// run concurrently, they must be safe to call from several goroutines.
+type Observer func(*Event)
+
+// Guards observers
+var observerMutex sync.RWMutex
+
+// Observers registered by AddObserver
+var observers []Observer
+
+// AddObserver registers an Observer to receive an Event for each step of
+// every refactoring that is run subsequently.
+func AddObserver(o Observer) {
+	observerMutex.Lock()
+	defer observerMutex.Unlock()
+	observers = append(observers, o)
+}
+
+// ClearObservers removes all Observers registered by AddObserver.
+func ClearObservers() {
+	observerMutex.Lock()
+	defer observerMutex.Unlock()
+	observers = nil
+}
+
+// A Run reports the events for one run of a refactoring to the registered
+// Observers.  A client running a refactoring calls StartRun before invoking
+// the refactoring's Run method, then calls Finished with its result; if the
+// client applies the result, it then calls Applied.
+type Run struct {
+	refactoring string
+	observers   []Observer
+	start       time.Time
+	event       Event // The event reported by Finished
+}
+
+// StartRun reports a RefactoringStarted event for the refactoring with the
+// given short name and returns a Run to report its subsequent events.
+func StartRun(shortName string) *Run {
+	observerMutex.RLock()
+	r := &Run{
+		refactoring: shortName,
+		observers:   append([]Observer{}, observers...),
+		start:       time.Now(),
+	}
+	observerMutex.RUnlock()
+	r.report(&Event{Kind: RefactoringStarted, Time: r.start})
+	return r
+}
+
+// Finished reports a PreconditionsFailed event if the refactoring's log
+// contains errors, or an EditsComputed event otherwise.
+func (r *Run) Finished(result *refactoring.Result) {
+	r.event = Event{Kind: EditsComputed, Time: time.Now()}
+	for _, entry := range result.Log.Entries {
+		switch entry.Severity {
+		case refactoring.Error:
+			r.event.Errors++
+		case refactoring.Warning:
+			r.event.Warnings++
+		}
+	}
+	if r.event.Errors > 0 {
+		r.event.Kind = PreconditionsFailed
+	} else {
+		for _, edits := range result.Edits {
+			stats := edits.Stats()
+			r.event.Files += stats.Files
+			r.event.Edits += stats.Edits
+		}
+		r.event.Files += len(result.FSChanges)
+	}
+	event := r.event
+	r.report(&event)
+}
+
+// Applied reports an EditsApplied event, describing the same changes as the
+// EditsComputed event reported by Finished.
+func (r *Run) Applied() {
+	event := r.event
+	event.Kind = EditsApplied
+	event.Time = time.Now()
+	r.report(&event)
+}
+
+// report sets the common fields of the given event and passes it to each
+// Observer.
+func (r *Run) report(event *Event) {
+	if len(r.observers) == 0 {
+		return
+	}
+	event.Refactoring = r.refactoring
+	event.Elapsed = event.Time.Sub(r.start)
+	for _, o := range r.observers {
+		o(event)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a small facade for clients that embed the Go Doctor (e.g.,
+// editor plug-ins and code review bots).  A client describes the code to
+// refactor with a Workspace, asks for a refactoring with a Request, and
+// receives a Result, without constructing a refactoring.Config or
+// interpreting a refactoring.Result directly.  These types are kept stable as
+// the refactoring package changes.
+
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/godoctor/godoctor/analysis/fingerprint"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A Workspace is a collection of Go code to be refactored.
+type Workspace struct {
+	// The file system from which files are read and to which changes are
+	// applied.  If this is nil, the local file system is used.
+	FileSystem filesystem.FileSystem
+	// The files and packages to load (see refactoring.Config.Scope).  If
+	// this is empty, the scope is determined from the selected file.
+	Scope []string
+	// Glob patterns restricting the files that refactorings may modify,
+	// and excluding files from modification (see refactoring.Config)
+	Include, Exclude []string
+	// The GOPATH and GOROOT; if empty, they are determined from the
+	// environment
+	GoPath, GoRoot string
+	// A directory in which analysis results are cached between
+	// refactorings; if empty, nothing is cached.  The index of the imports
+	// in a workspace is saved in this directory as imports-<hash>.json,
+	// where <hash> identifies the workspace's root directory.
+	CacheDir string
+}
+
+// A Request asks for a refactoring to be run on a Workspace.
+type Request struct {
+	// The short name of the refactoring (e.g., rename); see Describe
+	Refactoring string
+	// The range of text on which to invoke the refactoring
+	Selection text.Selection
+	// If non-nil, the node on which to invoke the refactoring, which
+	// overrides the position of the Selection (see refactoring.Config)
+	Target *fingerprint.Fingerprint
+	// The refactoring's arguments, as they would be given on the command
+	// line (e.g., "true" or "false" for a boolean parameter)
+	Args []string
+	// The name of a preset (see GetPreset), or the empty string to run the
+	// refactoring without a preset
+	Preset string
+	// What to do if the refactoring would modify a generated file.  This
+	// is ignored if a preset is given, since presets determine the policy.
+	GeneratedFiles refactoring.GeneratedFilePolicy
+	// How many informational messages to log (see
+	// refactoring.Config.Verbosity)
+	Verbosity int
+}
+
+// Severities of a Message.
+const (
+	InfoMessage    = "info"
+	WarningMessage = "warning"
+	ErrorMessage   = "error"
+)
+
+// A Message is an informational message, warning, or error logged by a
+// refactoring.
+type Message struct {
+	// InfoMessage, WarningMessage, or ErrorMessage
+	Severity string
+	Text     string
+	// The position the message describes, or the empty string and zeros
+	// if it is not associated with a position.  Line and Column are
+	// 1-based.
+	Filename     string
+	Line, Column int
+}
+
+func (m *Message) String() string {
+	if m.Filename == "" {
+		return fmt.Sprintf("%s: %s", m.Severity, m.Text)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", m.Filename, m.Line, m.Column,
+		m.Severity, m.Text)
+}
+
+// A Result is the outcome of running a refactoring on a Workspace.
+type Result struct {
+	// The short name of the refactoring that was run
+	Refactoring string
+
+	result *refactoring.Result
+	fs     filesystem.FileSystem
+	run    *Run
+}
+
+// Refactor runs the refactoring described by the given Request, reporting
+// its progress to any telemetry observers (see AddObserver).  It returns an
+// error only if the request is invalid (e.g., it names a refactoring that
+// does not exist); problems with the code being refactored are reported as
+// messages in the Result.
+func (w *Workspace) Refactor(req *Request) (*Result, error) {
+	refac := GetRefactoring(req.Refactoring)
+	if refac == nil {
+		return nil, fmt.Errorf("there is no refactoring named %q",
+			req.Refactoring)
+	}
+	var preset *Preset
+	if req.Preset != "" {
+		if preset = GetPreset(req.Preset); preset == nil {
+			return nil, fmt.Errorf("there is no preset named %q",
+				req.Preset)
+		}
+	}
+	fs := w.FileSystem
+	if fs == nil {
+		fs = filesystem.NewLocalFileSystem()
+	}
+	config := &refactoring.Config{
+		FileSystem:     fs,
+		Scope:          w.Scope,
+		Selection:      req.Selection,
+		Target:         req.Target,
+		Args:           refactoring.InterpretArgs(req.Args, refac),
+		Verbosity:      req.Verbosity,
+		GoPath:         w.GoPath,
+		GoRoot:         w.GoRoot,
+		GeneratedFiles: req.GeneratedFiles,
+		Include:        w.Include,
+		Exclude:        w.Exclude,
+		CacheDir:       w.CacheDir,
+	}
+
+	run := StartRun(req.Refactoring)
+	if preset != nil {
+		preset.Configure(config)
+	}
+	result := refac.Run(config)
+	if preset != nil {
+		preset.Check(config, result)
+	}
+	run.Finished(result)
+	return &Result{
+		Refactoring: req.Refactoring,
+		result:      result,
+		fs:          fs,
+		run:         run,
+	}, nil
+}
+
+// Messages returns the informational messages, warnings, and errors logged by
+// the refactoring, in the order they were logged.
+func (r *Result) Messages() []*Message {
+	log := r.result.Log
+	result := []*Message{}
+	for _, entry := range log.Entries {
+		m := &Message{Text: entry.Message}
+		switch entry.Severity {
+		case refactoring.Info:
+			m.Severity = InfoMessage
+		case refactoring.Warning:
+			m.Severity = WarningMessage
+		default:
+			m.Severity = ErrorMessage
+		}
+		if log.Fset != nil && entry.Pos.IsValid() {
+			pos := log.Fset.Position(entry.Pos)
+			m.Filename, m.Line, m.Column =
+				pos.Filename, pos.Line, pos.Column
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// HasErrors returns true if the refactoring logged any errors, in which case
+// its changes are incomplete (or absent) and should not be applied.
+func (r *Result) HasErrors() bool {
+	return r.result.Log.ContainsErrors()
+}
+
+// Target returns a Fingerprint of the node on which the refactoring was
+// invoked, which can be given in a later Request to invoke a refactoring on
+// the same node, or nil if the selection did not identify a single node.
+func (r *Result) Target() *fingerprint.Fingerprint {
+	return r.result.Target
+}
+
+// Files returns the names of the files the refactoring edits, in sorted
+// order.  Other changes to the file system (e.g., renaming a directory) are
+// not included.
+func (r *Result) Files() []string {
+	result := []string{}
+	for filename := range r.result.Edits {
+		result = append(result, filename)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Contents returns the contents of the given file after the refactoring's
+// edits are applied to it.
+func (r *Result) Contents(filename string) ([]byte, error) {
+	edits, ok := r.result.Edits[filename]
+	if !ok {
+		edits = text.NewEditSet()
+	}
+	return filesystem.ApplyEdits(edits, r.fs, filename)
+}
+
+// Apply writes the refactoring's changes to the Workspace's file system and
+// reports an EditsApplied event to any telemetry observers.  If any file was
+// modified after the refactoring analyzed it, nothing is written, and a
+// *filesystem.ModifiedFileError is returned.  Clients should check HasErrors
+// before calling Apply.
+func (r *Result) Apply() error {
+	if err := filesystem.WriteChanges(r.fs, r.result.Edits,
+		r.result.FSChanges, r.result.Checksums); err != nil {
+		return err
+	}
+	r.Applied()
+	return nil
+}
+
+// Applied reports an EditsApplied event to any telemetry observers.  Apply
+// does this automatically; a client only needs to call Applied if it applies
+// the refactoring's changes itself (e.g., after combining them with the
+// changes from other refactorings).
+func (r *Result) Applied() {
+	r.run.Applied()
+}
+
+// Edits returns the edits the refactoring makes to the given file, or nil if
+// it does not change the file.
+func (r *Result) Edits(filename string) *text.EditSet {
+	return r.result.Edits[filename]
+}
+
+// FileSystemChanges returns the changes other than edits to files (e.g.,
+// renaming a directory) that Apply makes to the file system, in the order
+// they are made.
+func (r *Result) FileSystemChanges() []filesystem.Change {
+	return r.result.FSChanges
+}
+
+// Checksum returns a checksum of the given file's contents when the
+// refactoring read it (see filesystem.Checksum), or false if it did not read
+// the file.  A client that applies the refactoring's changes itself can pass
+// these to filesystem.WriteChanges, as Apply does, so that nothing is written
+// if a file was modified after the refactoring analyzed it.
+func (r *Result) Checksum(filename string) (string, bool) {
+	checksum, ok := r.result.Checksums[filename]
+	return checksum, ok
+}
+
+// DebugOutput returns the output of a debugging refactoring (e.g., one that
+// displays the control flow graph of a function), or the empty string.
+func (r *Result) DebugOutput() string {
+	return r.result.DebugOutput.String()
+}
+
+// WriteMessages writes the refactoring's messages to out in the given format:
+// "sarif", "checkstyle", "junit", or "text" (GNU-style
+// 'file:line.col-line.col: message' lines).  Filenames are written relative
+// to the directory cwd, if possible.
+func (r *Result) WriteMessages(out io.Writer, format, cwd string) error {
+	log := r.result.Log
+	switch format {
+	case "sarif":
+		return log.WriteSARIF(out, "godoctor", r.Refactoring, cwd)
+	case "checkstyle":
+		return log.WriteCheckstyle(out, r.Refactoring, cwd)
+	case "junit":
+		return log.WriteJUnit(out, r.Refactoring, cwd)
+	case "text":
+		log.Write(out, cwd)
+		return nil
+	default:
+		return fmt.Errorf("unknown message format %q", format)
+	}
+}
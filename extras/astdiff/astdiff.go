@@ -0,0 +1,551 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package astdiff compares two versions of a Go source file at the level of
+// declarations and statements, rather than lines.  Differences are reported
+// as a list of structured Changes (e.g., "function renamed," "parameter
+// added," "statement inserted"), which is useful for validating the output of
+// a refactoring and for summarizing its effects.
+//
+// Nodes are compared by their pretty-printed source text, so changes to
+// formatting and comments are ignored.
+package astdiff
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"strconv"
+)
+
+// A Kind identifies the kind of a structural Change.
+type Kind int
+
+const (
+	ImportAdded Kind = iota
+	ImportRemoved
+	DeclAdded
+	DeclRemoved
+	DeclChanged
+	FuncRenamed
+	ParamAdded
+	ParamRemoved
+	ResultsChanged
+	StmtInserted
+	StmtDeleted
+	StmtChanged
+)
+
+var kindNames = []string{
+	ImportAdded:    "import added",
+	ImportRemoved:  "import removed",
+	DeclAdded:      "declaration added",
+	DeclRemoved:    "declaration removed",
+	DeclChanged:    "declaration changed",
+	FuncRenamed:    "function renamed",
+	ParamAdded:     "parameter added",
+	ParamRemoved:   "parameter removed",
+	ResultsChanged: "results changed",
+	StmtInserted:   "statement inserted",
+	StmtDeleted:    "statement deleted",
+	StmtChanged:    "statement changed",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Change describes a single structural difference between two versions of a
+// Go source file.
+type Change struct {
+	Kind Kind
+	// The declaration containing the change, e.g., "f" for a function or
+	// "T.m" for a method; for changes to imports, the import path
+	Decl string
+	// The source text of the affected node in the old file (empty if the
+	// node was added)
+	Old string
+	// The source text of the affected node in the new file (empty if the
+	// node was removed)
+	New string
+	// The location of the affected node in the old file (invalid if the
+	// node was added)
+	OldPos token.Position
+	// The location of the affected node in the new file (invalid if the
+	// node was removed)
+	NewPos token.Position
+}
+
+func (c *Change) String() string {
+	switch {
+	case c.Kind == FuncRenamed:
+		return fmt.Sprintf("%s: %s to %s", c.Decl, c.Kind, c.New)
+	case c.Old == "":
+		return fmt.Sprintf("%s: %s: %s", c.Decl, c.Kind, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: %s: %s", c.Decl, c.Kind, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s: %s -> %s",
+			c.Decl, c.Kind, c.Old, c.New)
+	}
+}
+
+// DiffSource parses two versions of a Go source file and returns the
+// structural changes necessary to transform the old version into the new
+// version (see Diff).  The filename is used only in positions.
+func DiffSource(filename string, old, new []byte) ([]*Change, error) {
+	fset := token.NewFileSet()
+	oldFile, err := parser.ParseFile(fset, filename, old, 0)
+	if err != nil {
+		return nil, err
+	}
+	newFile, err := parser.ParseFile(fset, filename, new, 0)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(fset, oldFile, newFile), nil
+}
+
+// Diff returns the structural changes necessary to transform the old file into
+// the new file.  Position information for both files is obtained from the
+// given FileSet.
+//
+// Imports are compared by path.  Top-level declarations are matched by name
+// (and receiver type, for methods); a function that is removed and another
+// that is added with the same receiver and body is reported as a rename.  The
+// parameters, results, and statements of matching functions are compared, and
+// statements are compared recursively when a block statement, if statement,
+// or loop differs only in its body.  Other differences are reported as
+// changes to the entire declaration.
+//
+// Changes are reported in the order of the declarations in the old file,
+// followed by the declarations added in the new file.
+func Diff(fset *token.FileSet, old, new *ast.File) []*Change {
+	d := &differ{fset: fset, changes: []*Change{}}
+	d.diffImports(old, new)
+	d.diffDecls(old, new)
+	return d.changes
+}
+
+// A differ accumulates the Changes between two files.
+type differ struct {
+	fset    *token.FileSet
+	changes []*Change
+}
+
+// add records a Change with the given kind.  Either the old or new node may
+// be nil.
+func (d *differ) add(kind Kind, decl string, old, new ast.Node) {
+	c := &Change{Kind: kind, Decl: decl}
+	if old != nil {
+		c.Old = d.text(old)
+		c.OldPos = d.fset.Position(old.Pos())
+	}
+	if new != nil {
+		c.New = d.text(new)
+		c.NewPos = d.fset.Position(new.Pos())
+	}
+	d.changes = append(d.changes, c)
+}
+
+// text returns the pretty-printed source text of the given node, or the empty
+// string if the node is nil (e.g., the missing results of a function).
+func (d *differ) text(node ast.Node) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, d.fset, node); err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+	return buf.String()
+}
+
+// diffImports reports imports that were added or removed.
+func (d *differ) diffImports(old, new *ast.File) {
+	oldImports := importsByPath(old)
+	newImports := importsByPath(new)
+	for _, spec := range old.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if newImports[path] == nil {
+			d.add(ImportRemoved, path, spec, nil)
+		}
+	}
+	for _, spec := range new.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if oldImports[path] == nil {
+			d.add(ImportAdded, path, nil, spec)
+		}
+	}
+}
+
+// importsByPath maps the paths imported by the given file to their
+// ImportSpecs.
+func importsByPath(file *ast.File) map[string]*ast.ImportSpec {
+	result := map[string]*ast.ImportSpec{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		result[path] = spec
+	}
+	return result
+}
+
+// A decl is a named top-level declaration: a function, method, or a single
+// spec of a const, type, or var declaration.
+type decl struct {
+	name string
+	node ast.Node
+}
+
+// decls returns the named top-level declarations in the given file, excluding
+// imports, in order.
+func decls(file *ast.File) []decl {
+	result := []decl{}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			result = append(result, decl{funcName(d), d})
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					result = append(result,
+						decl{spec.Name.Name, spec})
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						result = append(result,
+							decl{name.Name, spec})
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// funcName returns the name of a function, or for a method, the name of its
+// receiver type and the method name separated by a dot.
+func funcName(fn *ast.FuncDecl) string {
+	if recv := recvType(fn); recv != "" {
+		return recv + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// recvType returns the name of a method's receiver type, or the empty string
+// if fn is not a method.
+func recvType(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// diffDecls matches the top-level declarations of two files and reports the
+// differences between them.
+func (d *differ) diffDecls(old, new *ast.File) {
+	oldDecls := decls(old)
+	newDecls := decls(new)
+
+	newByName := map[string]decl{}
+	for _, nd := range newDecls {
+		newByName[nd.name] = nd
+	}
+	oldByName := map[string]decl{}
+	for _, od := range oldDecls {
+		oldByName[od.name] = od
+	}
+
+	// Removed functions may have been renamed to added functions
+	renamedTo := map[string]*ast.FuncDecl{}
+	renamedFrom := map[string]bool{}
+	for _, od := range oldDecls {
+		oldFn, ok := od.node.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if _, found := newByName[od.name]; found {
+			continue
+		}
+		for _, nd := range newDecls {
+			newFn, ok := nd.node.(*ast.FuncDecl)
+			if !ok || renamedFrom[nd.name] {
+				continue
+			}
+			if _, found := oldByName[nd.name]; found {
+				continue
+			}
+			if d.isRename(oldFn, newFn) {
+				renamedTo[od.name] = newFn
+				renamedFrom[nd.name] = true
+				break
+			}
+		}
+	}
+
+	for _, od := range oldDecls {
+		if newFn, ok := renamedTo[od.name]; ok {
+			oldFn := od.node.(*ast.FuncDecl)
+			d.changes = append(d.changes, &Change{
+				Kind:   FuncRenamed,
+				Decl:   od.name,
+				Old:    oldFn.Name.Name,
+				New:    newFn.Name.Name,
+				OldPos: d.fset.Position(oldFn.Name.Pos()),
+				NewPos: d.fset.Position(newFn.Name.Pos()),
+			})
+			d.diffFuncs(od.name, oldFn, newFn)
+			continue
+		}
+		nd, found := newByName[od.name]
+		if !found {
+			d.add(DeclRemoved, od.name, od.node, nil)
+			continue
+		}
+		oldFn, oldIsFunc := od.node.(*ast.FuncDecl)
+		newFn, newIsFunc := nd.node.(*ast.FuncDecl)
+		if oldIsFunc && newIsFunc {
+			d.diffFuncs(od.name, oldFn, newFn)
+		} else if d.text(od.node) != d.text(nd.node) {
+			d.add(DeclChanged, od.name, od.node, nd.node)
+		}
+	}
+	for _, nd := range newDecls {
+		if _, found := oldByName[nd.name]; !found && !renamedFrom[nd.name] {
+			d.add(DeclAdded, nd.name, nil, nd.node)
+		}
+	}
+}
+
+// isRename returns true iff oldFn may have been renamed to newFn, i.e., they
+// have the same receiver type and the same body (and, if the body is empty,
+// the same signature).
+func (d *differ) isRename(oldFn, newFn *ast.FuncDecl) bool {
+	if recvType(oldFn) != recvType(newFn) ||
+		oldFn.Body == nil || newFn.Body == nil ||
+		d.text(oldFn.Body) != d.text(newFn.Body) {
+		return false
+	}
+	return len(oldFn.Body.List) > 0 ||
+		d.text(oldFn.Type) == d.text(newFn.Type)
+}
+
+// diffFuncs reports the differences between the parameters, results, and
+// statements of two versions of a function.
+func (d *differ) diffFuncs(name string, oldFn, newFn *ast.FuncDecl) {
+	if d.text(oldFn.Recv) != d.text(newFn.Recv) {
+		d.add(DeclChanged, name, oldFn.Recv, newFn.Recv)
+	}
+	d.diffParams(name, params(oldFn.Type.Params), params(newFn.Type.Params))
+	if d.text(oldFn.Type.Results) != d.text(newFn.Type.Results) {
+		d.changes = append(d.changes, &Change{
+			Kind:   ResultsChanged,
+			Decl:   name,
+			Old:    d.text(oldFn.Type.Results),
+			New:    d.text(newFn.Type.Results),
+			OldPos: d.fset.Position(oldFn.Type.Pos()),
+			NewPos: d.fset.Position(newFn.Type.Pos()),
+		})
+	}
+	switch {
+	case oldFn.Body == nil && newFn.Body == nil:
+	case oldFn.Body == nil || newFn.Body == nil:
+		d.add(DeclChanged, name, oldFn, newFn)
+	default:
+		d.diffStmts(name, oldFn.Body.List, newFn.Body.List)
+	}
+}
+
+// A param is a single parameter of a function.  Parameters declared together
+// (e.g., x, y int) are separated.
+type param struct {
+	name *ast.Ident // nil if the parameter is unnamed
+	typ  ast.Expr
+}
+
+// params returns the parameters in the given field list.
+func params(fields *ast.FieldList) []param {
+	result := []param{}
+	if fields == nil {
+		return result
+	}
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			result = append(result, param{nil, field.Type})
+		}
+		for _, name := range field.Names {
+			result = append(result, param{name, field.Type})
+		}
+	}
+	return result
+}
+
+// diffParams reports parameters that were added or removed.  A parameter whose
+// name or type changed is reported as removed and then added.
+func (d *differ) diffParams(name string, old, new []param) {
+	oldText := make([]string, len(old))
+	for i, p := range old {
+		oldText[i] = d.paramText(p)
+	}
+	newText := make([]string, len(new))
+	for i, p := range new {
+		newText[i] = d.paramText(p)
+	}
+	i, j := 0, 0
+	for _, match := range lcs(oldText, newText) {
+		for ; i < match[0]; i++ {
+			d.addParam(ParamRemoved, name, old[i], oldText[i])
+		}
+		for ; j < match[1]; j++ {
+			d.addParam(ParamAdded, name, new[j], newText[j])
+		}
+		i, j = match[0]+1, match[1]+1
+	}
+}
+
+// paramText returns the source text of a parameter, e.g., "x int".
+func (d *differ) paramText(p param) string {
+	if p.name == nil {
+		return d.text(p.typ)
+	}
+	return p.name.Name + " " + d.text(p.typ)
+}
+
+// addParam records the addition or removal of a parameter.
+func (d *differ) addParam(kind Kind, name string, p param, text string) {
+	var pos token.Position
+	if p.name != nil {
+		pos = d.fset.Position(p.name.Pos())
+	} else {
+		pos = d.fset.Position(p.typ.Pos())
+	}
+	c := &Change{Kind: kind, Decl: name}
+	if kind == ParamRemoved {
+		c.Old, c.OldPos = text, pos
+	} else {
+		c.New, c.NewPos = text, pos
+	}
+	d.changes = append(d.changes, c)
+}
+
+// diffStmts reports the differences between two statement lists.  Statements
+// are matched by their source text; unmatched statements at the same position
+// are compared by diffStmt, and any others are reported as deleted or
+// inserted.
+func (d *differ) diffStmts(name string, old, new []ast.Stmt) {
+	oldText := make([]string, len(old))
+	for i, stmt := range old {
+		oldText[i] = d.text(stmt)
+	}
+	newText := make([]string, len(new))
+	for i, stmt := range new {
+		newText[i] = d.text(stmt)
+	}
+	i, j := 0, 0
+	for _, match := range lcs(oldText, newText) {
+		for ; i < match[0] && j < match[1]; i, j = i+1, j+1 {
+			d.diffStmt(name, old[i], new[j])
+		}
+		for ; i < match[0]; i++ {
+			d.add(StmtDeleted, name, old[i], nil)
+		}
+		for ; j < match[1]; j++ {
+			d.add(StmtInserted, name, nil, new[j])
+		}
+		i, j = match[0]+1, match[1]+1
+	}
+}
+
+// diffStmt reports the differences between two statements that occupy the
+// same position in a statement list.  If they are block statements, if
+// statements, or loops that differ only in their bodies, the bodies are
+// compared; otherwise, the statement is reported as changed.
+func (d *differ) diffStmt(name string, old, new ast.Stmt) {
+	switch old := old.(type) {
+	case *ast.BlockStmt:
+		if new, ok := new.(*ast.BlockStmt); ok {
+			d.diffStmts(name, old.List, new.List)
+			return
+		}
+	case *ast.IfStmt:
+		if new, ok := new.(*ast.IfStmt); ok &&
+			d.text(old.Init) == d.text(new.Init) &&
+			d.text(old.Cond) == d.text(new.Cond) &&
+			d.text(old.Else) == d.text(new.Else) {
+			d.diffStmts(name, old.Body.List, new.Body.List)
+			return
+		}
+	case *ast.ForStmt:
+		if new, ok := new.(*ast.ForStmt); ok &&
+			d.text(old.Init) == d.text(new.Init) &&
+			d.text(old.Cond) == d.text(new.Cond) &&
+			d.text(old.Post) == d.text(new.Post) {
+			d.diffStmts(name, old.Body.List, new.Body.List)
+			return
+		}
+	case *ast.RangeStmt:
+		if new, ok := new.(*ast.RangeStmt); ok &&
+			d.text(old.Key) == d.text(new.Key) &&
+			d.text(old.Value) == d.text(new.Value) &&
+			old.Tok == new.Tok &&
+			d.text(old.X) == d.text(new.X) {
+			d.diffStmts(name, old.Body.List, new.Body.List)
+			return
+		}
+	}
+	d.add(StmtChanged, name, old, new)
+}
+
+// lcs returns the indices of the elements of a longest common subsequence of
+// a and b, as pairs of indices into a and b, followed by the pair
+// (len(a), len(b)).
+func lcs(a, b []string) [][2]int {
+	// length[i][j] is the length of an LCS of a[i:] and b[j:]
+	length := make([][]int, len(a)+1)
+	for i := range length {
+		length[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				length[i][j] = length[i+1][j+1] + 1
+			} else if length[i+1][j] >= length[i][j+1] {
+				length[i][j] = length[i+1][j]
+			} else {
+				length[i][j] = length[i][j+1]
+			}
+		}
+	}
+
+	result := [][2]int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] == b[j] {
+			result = append(result, [2]int{i, j})
+			i++
+			j++
+		} else if length[i+1][j] >= length[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return append(result, [2]int{len(a), len(b)})
+}
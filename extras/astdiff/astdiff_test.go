@@ -0,0 +1,147 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astdiff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/extras/astdiff"
+)
+
+const oldSource = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const limit = 10
+
+func compute(x int) int {
+	return x * 2
+}
+
+func (t *T) m() {
+	for i := 0; i < limit; i++ {
+		fmt.Println(i)
+	}
+}
+
+func unused() {}
+
+type T struct{}
+
+func main() {
+	fmt.Println(compute(1))
+	os.Exit(0)
+}
+`
+
+const newSource = `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const limit = 20
+
+// double has been renamed
+func double(x int) int {
+	return x * 2
+}
+
+func (t *T) m(prefix string) {
+	for i := 0; i < limit; i++ {
+		fmt.Println(prefix, i)
+		i++
+	}
+}
+
+type T struct{}
+
+func main() {
+	fmt.Println(double(1))
+	fmt.Println(strings.ToUpper("done"))
+}
+
+func added() error { return nil }
+`
+
+func TestDiffSource(t *testing.T) {
+	changes, err := astdiff.DiffSource("main.go", []byte(oldSource),
+		[]byte(newSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, c := range changes {
+		actual = append(actual, c.String())
+	}
+	expected := []string{
+		`os: import removed: "os"`,
+		`strings: import added: "strings"`,
+		`limit: declaration changed: limit = 10 -> limit = 20`,
+		`compute: function renamed to double`,
+		`T.m: parameter added: prefix string`,
+		`T.m: statement changed: fmt.Println(i) -> fmt.Println(prefix, i)`,
+		`T.m: statement inserted: i++`,
+		`unused: declaration removed: func unused()	{}`,
+		`main: statement changed: fmt.Println(compute(1)) -> fmt.Println(double(1))`,
+		`main: statement changed: os.Exit(0) -> fmt.Println(strings.ToUpper("done"))`,
+		`added: declaration added: func added() error	{ return nil }`,
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected:\n%s\nActual:\n%s",
+			strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	if changes[3].OldPos.Line != 10 || changes[3].NewPos.Line != 11 {
+		t.Fatalf("Unexpected positions for rename: %s, %s",
+			changes[3].OldPos, changes[3].NewPos)
+	}
+	if changes[6].OldPos.IsValid() || changes[6].NewPos.Line != 18 {
+		t.Fatalf("Unexpected positions for insertion: %s, %s",
+			changes[6].OldPos, changes[6].NewPos)
+	}
+}
+
+func TestDiffParams(t *testing.T) {
+	changes, err := astdiff.DiffSource("main.go",
+		[]byte("package p\nfunc f(a, b int, c string) {}\n"),
+		[]byte("package p\nfunc f(a int, c string, d bool) (int, error) {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []astdiff.Kind{}
+	for _, c := range changes {
+		kinds = append(kinds, c.Kind)
+	}
+	expected := []astdiff.Kind{astdiff.ParamRemoved, astdiff.ParamAdded,
+		astdiff.ResultsChanged}
+	if len(kinds) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, kinds)
+	}
+	for i := range kinds {
+		if kinds[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, kinds)
+		}
+	}
+	if changes[0].Old != "b int" || changes[1].New != "d bool" {
+		t.Fatalf("Unexpected changes: %s; %s", changes[0], changes[1])
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	changes, err := astdiff.DiffSource("main.go", []byte(oldSource),
+		[]byte(strings.Replace(oldSource, "\t", "    ", -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %v", changes)
+	}
+}
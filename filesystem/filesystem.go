@@ -12,11 +12,14 @@ package filesystem
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -65,6 +68,10 @@ type FileSystem interface {
 	// permissions.
 	CreateFile(path, contents string) error
 
+	// CreateDirectory creates a new, empty directory with default
+	// permissions.  Its parent directory must already exist.
+	CreateDirectory(path string) error
+
 	// Rename changes the name of a file or directory.  newName should be a
 	// bare name, not including a directory prefix; the existing file will
 	// be renamed within its existing parent directory.
@@ -118,6 +125,13 @@ func (fs *LocalFileSystem) CreateFile(path, contents string) error {
 	return nil
 }
 
+func (fs *LocalFileSystem) CreateDirectory(path string) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return fmt.Errorf("Path already exists: %s", path)
+	}
+	return os.Mkdir(path, 0777)
+}
+
 func (fs *LocalFileSystem) Rename(oldPath, newName string) error {
 	if !isBareFilename(newName) {
 		return fmt.Errorf("newName must be a bare filename: %s",
@@ -317,10 +331,109 @@ func (fs *EditedFileSystem) Remove(path string) error {
 	panic("Remove unsupported")
 }
 
+/* -=-=- File System Changes -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// A Change is a change to the file system (other than editing the contents of
+// an existing file) that a refactoring requires, such as creating a directory
+// or moving a file.
+type Change interface {
+	// ExecuteUsing applies this change to the given file system.
+	ExecuteUsing(FileSystem) error
+	// String returns a human-readable description of this change, where
+	// paths are given relative to the given directory (if possible).
+	String(cwd string) string
+}
+
+// CreateDirectory is a Change that creates a new, empty directory.
+type CreateDirectory struct {
+	Path string
+}
+
+func (c *CreateDirectory) ExecuteUsing(fs FileSystem) error {
+	return fs.CreateDirectory(c.Path)
+}
+
+func (c *CreateDirectory) String(cwd string) string {
+	return fmt.Sprintf("create directory %s", relativeTo(cwd, c.Path))
+}
+
+// CreateFile is a Change that creates a new text file with the given contents.
+type CreateFile struct {
+	Path     string
+	Contents string
+}
+
+func (c *CreateFile) ExecuteUsing(fs FileSystem) error {
+	return fs.CreateFile(c.Path, c.Contents)
+}
+
+func (c *CreateFile) String(cwd string) string {
+	return fmt.Sprintf("create %s", relativeTo(cwd, c.Path))
+}
+
+// Move is a Change that moves a file to a new path, possibly in a different
+// directory.  The file is copied to NewPath (which must not exist), and then
+// the original file is removed.
+type Move struct {
+	Path    string
+	NewPath string
+}
+
+func (c *Move) ExecuteUsing(fs FileSystem) error {
+	if filepath.Dir(c.Path) == filepath.Dir(c.NewPath) {
+		return fs.Rename(c.Path, filepath.Base(c.NewPath))
+	}
+	reader, err := fs.OpenFile(c.Path)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	if err := fs.CreateFile(c.NewPath, string(contents)); err != nil {
+		return err
+	}
+	return fs.Remove(c.Path)
+}
+
+func (c *Move) String(cwd string) string {
+	return fmt.Sprintf("move %s to %s",
+		relativeTo(cwd, c.Path), relativeTo(cwd, c.NewPath))
+}
+
+// Remove is a Change that deletes a file or an empty directory.
+type Remove struct {
+	Path string
+}
+
+func (c *Remove) ExecuteUsing(fs FileSystem) error {
+	return fs.Remove(c.Path)
+}
+
+func (c *Remove) String(cwd string) string {
+	return fmt.Sprintf("remove %s", relativeTo(cwd, c.Path))
+}
+
+// relativeTo returns a path to the given file relative to the directory cwd,
+// or the path unchanged if a relative path cannot be computed.
+func relativeTo(cwd, path string) string {
+	if cwd == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(cwd, path); err == nil {
+		return rel
+	}
+	return path
+}
+
 /* -=-=- Utility Functions -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
 // CreatePatch reads bytes from a file, applying the edits in an EditSet and
-// returning a Patch.
+// returning a Patch.  The Patch's hunks are coalesced (see
+// text.Patch.Coalesce), so it has the same structure as the output of
+// diff -u.
 func CreatePatch(es *text.EditSet, fs FileSystem, filename string) (*text.Patch, error) {
 	file, err := fs.OpenFile(filename)
 	if err != nil {
@@ -329,7 +442,29 @@ func CreatePatch(es *text.EditSet, fs FileSystem, filename string) (*text.Patch,
 
 	defer file.Close()
 
-	return es.CreatePatch(file)
+	p, err := es.CreatePatch(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Coalesce(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateMultiPatch reads the files modified by the given EditSets (keyed by
+// filename), returning a MultiPatch containing one (coalesced) Patch per file.
+func CreateMultiPatch(edits map[string]*text.EditSet, fs FileSystem) (*text.MultiPatch, error) {
+	mp, err := text.CreateMultiPatch(edits, fs.OpenFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range mp.Filenames() {
+		if err := mp.Patch(f).Coalesce(); err != nil {
+			return nil, err
+		}
+	}
+	return mp, nil
 }
 
 // ApplyEdits reads bytes from a file, applying the edits in an EditSet and
@@ -344,3 +479,98 @@ func ApplyEdits(es *text.EditSet, fs FileSystem, filename string) ([]byte, error
 
 	return text.ApplyToReader(es, file)
 }
+
+// Checksum returns a hexadecimal SHA-256 hash of the given file contents.
+func Checksum(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// A ModifiedFileError indicates that a file was modified (or deleted) after a
+// refactoring analyzed it, so the refactoring's edits cannot be applied to it
+// safely: they were computed against the file's old contents.
+type ModifiedFileError struct {
+	// The path of the file that was modified
+	Path string
+	// The checksum of the file's contents when it was analyzed, and of its
+	// current contents (empty if it was deleted or cannot be read)
+	Expected, Found string
+}
+
+func (e *ModifiedFileError) Error() string {
+	if e.Found == "" {
+		return fmt.Sprintf("%s was deleted or became unreadable after it "+
+			"was analyzed, so no changes were applied; run the "+
+			"refactoring again", e.Path)
+	}
+	return fmt.Sprintf("%s was modified after it was analyzed (its "+
+		"SHA-256 checksum was %.12s but is now %.12s), so no changes "+
+		"were applied; run the refactoring again", e.Path, e.Expected,
+		e.Found)
+}
+
+// VerifyChecksums compares each of the given checksums (see Checksum), which
+// are keyed by path, against the current contents of the file in the given
+// file system.  It returns a *ModifiedFileError describing the first file (in
+// order by path) whose contents differ, or nil if none do.  Clients should
+// call this before applying a refactoring's edits (see
+// refactoring.Result.Checksums), so that concurrent modifications to a file
+// between analysis and apply are detected rather than corrupting the file.
+func VerifyChecksums(fs FileSystem, checksums map[string]string) error {
+	paths := make([]string, 0, len(checksums))
+	for path := range checksums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		found := ""
+		if file, err := fs.OpenFile(path); err == nil {
+			contents, err := ioutil.ReadAll(file)
+			file.Close()
+			if err == nil {
+				found = Checksum(contents)
+			}
+		}
+		if found != checksums[path] {
+			return &ModifiedFileError{path, checksums[path], found}
+		}
+	}
+	return nil
+}
+
+// WriteChanges applies a refactoring's changes to the given file system: it
+// verifies the given checksums (see VerifyChecksums), overwrites each file
+// with the result of applying its edits, then executes the given Changes in
+// order.  If the checksums do not match, no changes are made.
+func WriteChanges(fs FileSystem, edits map[string]*text.EditSet, changes []Change, checksums map[string]string) error {
+	if err := VerifyChecksums(fs, checksums); err != nil {
+		return err
+	}
+	for filename, es := range edits {
+		data, err := ApplyEdits(es, fs, filename)
+		if err != nil {
+			return err
+		}
+
+		f, err := fs.OverwriteFile(filename)
+		if err != nil {
+			return err
+		}
+		n, err := f.Write(data)
+		if err == nil && n < len(data) {
+			err = io.ErrShortWrite
+		}
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, change := range changes {
+		if err := change.ExecuteUsing(fs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
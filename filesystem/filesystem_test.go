@@ -99,6 +99,52 @@ func TestRenameFile(t *testing.T) {
 	}
 }
 
+func TestChanges(t *testing.T) {
+	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+	subdir := fmt.Sprintf("%s/%s", testDir, testDir)
+	path := fmt.Sprintf("%s/%s", testDir, testFile)
+	newPath := fmt.Sprintf("%s/%s", subdir, testFile2)
+	changes := []Change{
+		&CreateDirectory{testDir},
+		&CreateFile{path, "contents"},
+		&CreateDirectory{subdir},
+		&Move{path, newPath},
+	}
+	expected := []string{
+		"create directory zz_test",
+		"create zz_test/zz_test.txt",
+		"create directory zz_test/zz_test",
+		"move zz_test/zz_test.txt to zz_test/zz_test/zz_test2.txt",
+	}
+	fs := NewLocalFileSystem()
+	for i, change := range changes {
+		if change.String("") != expected[i] {
+			t.Fatalf("Expected %s, got %s", expected[i],
+				change.String(""))
+		}
+		if err := change.ExecuteUsing(fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("%s should have been removed", path)
+	}
+	bytes, err := ioutil.ReadFile(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != "contents" {
+		t.Fatal("Incorrect file contents:\n", string(bytes))
+	}
+	if err := fs.CreateDirectory(subdir); err == nil {
+		t.Fatal("Create over existing directory should have failed")
+	}
+	if err := (&Remove{subdir}).ExecuteUsing(fs); err == nil {
+		t.Fatal("Remove of nonempty directory should have failed")
+	}
+}
+
 func TestEditedFileSystem(t *testing.T) {
 	contents := "123456789\nABCDEFGHIJ"
 	lfs := NewLocalFileSystem()
@@ -130,6 +176,36 @@ func TestEditedFileSystem(t *testing.T) {
 	}
 }
 
+func TestVerifyChecksums(t *testing.T) {
+	contents := "123456789\nABCDEFGHIJ"
+	fs := NewLocalFileSystem()
+	if err := fs.CreateFile(testFile, contents); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	checksums := map[string]string{testFile: Checksum([]byte(contents))}
+	if err := VerifyChecksums(fs, checksums); err != nil {
+		t.Fatal(err)
+	}
+
+	es := text.NewEditSet()
+	es.Add(&text.Extent{3, 5}, "xyz")
+	edited := NewEditedFileSystem(fs, map[string]*text.EditSet{testFile: es})
+	err := VerifyChecksums(edited, checksums)
+	if err, ok := err.(*ModifiedFileError); !ok || err.Path != testFile ||
+		err.Found != Checksum([]byte("123xyz9\nABCDEFGHIJ")) {
+		t.Fatalf("Expected ModifiedFileError for %s; got %v", testFile, err)
+	}
+
+	if err := os.Remove(testFile); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyChecksums(fs, checksums)
+	if err, ok := err.(*ModifiedFileError); !ok || err.Found != "" {
+		t.Fatalf("Expected ModifiedFileError for deleted file; got %v", err)
+	}
+}
+
 func TestPatchOnFile(t *testing.T) {
 	// Insert "Before line 1" at the top of testdata/diff/lines.txt
 	testfile := "testdata/lines.txt"
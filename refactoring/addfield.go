@@ -0,0 +1,425 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that adds a field to a struct type and
+// initializes it in the struct's composite literals.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/godoctor/godoctor/analysis/members"
+)
+
+// AddField is a refactoring that adds a field to the end of the selected
+// struct type and initializes it with a given default value in every keyed
+// composite literal of that type in the scope.
+//
+// A function named NewT or newT (for a struct type T) that returns a T or *T
+// is treated as a constructor: a parameter is added to it for the new
+// field's value, literals of T in its body initialize the field with that
+// parameter, and every call to it passes the default value.  (Variadic
+// functions are not treated as constructors.)
+//
+// Unkeyed literals of the struct type cannot be updated safely, so the
+// refactoring fails if it finds any; Convert to Keyed Literals can convert
+// them first.
+type AddField struct {
+	RefactoringBase
+	// The name, type, and default value of the new field, as entered
+	name, typ, value string
+	// The struct type to which the field is added and its declaration
+	target     *types.TypeName
+	pkgInfo    *loader.PackageInfo
+	structType *ast.StructType
+	// Constructors of the struct type, each mapped to the name of the
+	// parameter added to it
+	constructors map[*ast.FuncDecl]string
+}
+
+func (r *AddField) Description() *Description {
+	return &Description{
+		Name:      "Add Field",
+		Synopsis:  "Adds a field to a struct type and initializes it in its literals",
+		Usage:     "<name> <type> <default>",
+		Selection: "The name of a struct type",
+		HTMLDoc:   addFieldDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Field Name:",
+			Prompt:       "Name of the new field.",
+			DefaultValue: "",
+		}, {
+			Label:        "Field Type:",
+			Prompt:       "Type of the new field.",
+			DefaultValue: "",
+		}, {
+			Label:        "Default Value:",
+			Prompt:       "Expression initializing the field in existing literals.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *AddField) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.name = strings.TrimSpace(config.Args[0].(string))
+	r.typ = strings.TrimSpace(config.Args[1].(string))
+	r.value = strings.TrimSpace(config.Args[2].(string))
+	r.constructors = map[*ast.FuncDecl]string{}
+
+	if !r.findStruct() || !r.checkArgs() || !r.findConstructors() {
+		return &r.Result
+	}
+	r.Log.Infof("Adding field %s %s to %s", r.name, r.typ, r.target.Name())
+
+	if !r.addFieldDecl(config) {
+		return &r.Result
+	}
+	r.updateConstructors(config)
+	r.updateLiterals(config)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findStruct finds the declaration of the selected struct type, returning
+// false (after logging an error) if there is none.
+func (r *AddField) findStruct() bool {
+	r.target = r.selectedStructType()
+	if r.target == nil {
+		r.Log.Error("Please select the name of a struct type.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	r.pkgInfo, r.structType = r.structDecl(r.target)
+	if r.structType == nil {
+		r.Log.Errorf("%s is not declared in the code being refactored, "+
+			"so it cannot be changed", r.target.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// structDecl returns the package declaring the given struct type and the
+// struct type expression in its declaration, or nil if it is not declared
+// in a type declaration outside $GOROOT.
+func (r *RefactoringBase) structDecl(tn *types.TypeName) (*loader.PackageInfo, *ast.StructType) {
+	pkgInfo := r.Program.AllPackages[tn.Pkg()]
+	if pkgInfo == nil || isInGoRoot(r.Program.Fset.Position(tn.Pos()).Filename) {
+		return nil, nil
+	}
+	file := fileContaining(pkgInfo, tn.Pos())
+	if file == nil {
+		return nil, nil
+	}
+	path, _ := astutil.PathEnclosingInterval(file, tn.Pos(), tn.Pos())
+	for _, node := range path {
+		if spec, ok := node.(*ast.TypeSpec); ok && spec.Name.Pos() == tn.Pos() {
+			st, _ := spec.Type.(*ast.StructType)
+			return pkgInfo, st
+		}
+	}
+	return nil, nil
+}
+
+// checkArgs returns false (after logging an error) if the field's name,
+// type, or default value is invalid, or if the name is already used.
+func (r *AddField) checkArgs() bool {
+	if !isIdentifierValid(r.name) || isReservedWord(r.name) || r.name == "_" {
+		r.Log.Errorf("The field name \"%s\" is not a valid Go identifier",
+			r.name)
+		r.Log.AssociateArg(0)
+		return false
+	}
+	if obj := members.Lookup(r.target.Type(), r.target.Pkg(), r.name); obj != nil {
+		r.Log.Errorf("%s already has a field or method named %s",
+			r.target.Name(), r.name)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+	if _, err := parser.ParseExpr(r.typ); err != nil || r.typ == "" {
+		r.Log.Errorf("\"%s\" is not a valid type", r.typ)
+		r.Log.AssociateArg(1)
+		return false
+	}
+	if _, err := parser.ParseExpr(r.value); err != nil || r.value == "" {
+		r.Log.Errorf("\"%s\" is not a valid expression", r.value)
+		r.Log.AssociateArg(2)
+		return false
+	}
+	return true
+}
+
+// findConstructors finds the constructors of the struct type and chooses
+// the name of the parameter added to each, returning false (after logging
+// an error) if that name is already used in one of them.
+func (r *AddField) findConstructors() bool {
+	paramName := strings.ToLower(r.name[:1]) + r.name[1:]
+	names := map[string]bool{
+		"New" + capitalize(r.target.Name()): true,
+		"new" + capitalize(r.target.Name()): true,
+	}
+	for _, file := range r.pkgInfo.Files {
+		for _, d := range file.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok || decl.Recv != nil || decl.Body == nil ||
+				!names[decl.Name.Name] || !r.isConstructor(decl) {
+				continue
+			}
+			if isReservedWord(paramName) || usesName(decl, paramName) {
+				r.Log.Errorf("%s already uses the name %s",
+					decl.Name.Name, paramName)
+				r.Log.AssociateNode(decl.Name)
+				return false
+			}
+			r.constructors[decl] = paramName
+		}
+	}
+	return true
+}
+
+// isConstructor returns true if the given function is not variadic and
+// returns the struct type or a pointer to it.
+func (r *AddField) isConstructor(decl *ast.FuncDecl) bool {
+	fn, ok := r.pkgInfo.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Variadic() {
+		return false
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		if structTypeOf(sig.Results().At(i).Type(), r.target) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// addFieldDecl adds the field's declaration to the end of the struct type,
+// returning false (after logging an error) if the file cannot be read.
+func (r *AddField) addFieldDecl(config *Config) bool {
+	m := r.migration(config, r.pkgInfo, fileContaining(r.pkgInfo, r.structType.Pos()))
+	if m == nil {
+		return false
+	}
+	decl := r.name + " " + r.typ
+	fields := r.structType.Fields
+	prev := fields.Opening
+	if n := len(fields.List); n > 0 {
+		prev = fields.List[n-1].End()
+	}
+	unit := DetectIndentStyle(m.src).Unit
+	switch {
+	case r.line(fields.Closing) > r.line(prev):
+		// Insert a line before the closing brace
+		indent := Indentation(m.src, m.offset(fields.Closing))
+		start := fields.Closing - token.Pos(len(indent))
+		m.replace(start, start, indent+unit+decl+"\n")
+	case len(fields.List) == 0:
+		indent := Indentation(m.src, m.offset(fields.Opening))
+		m.replace(r.structType.Pos(), r.structType.End(),
+			"struct {\n"+indent+unit+decl+"\n"+indent+"}")
+	default:
+		m.replace(prev, prev, "; "+decl)
+	}
+	return true
+}
+
+// updateConstructors adds a parameter for the field to each constructor and
+// passes the default value in each call to it.
+func (r *AddField) updateConstructors(config *Config) {
+	funcs := map[types.Object]bool{}
+	for decl, paramName := range r.constructors {
+		funcs[r.pkgInfo.Defs[decl.Name]] = true
+		m := r.migration(config, r.pkgInfo, fileContaining(r.pkgInfo, decl.Pos()))
+		if m == nil {
+			return
+		}
+		params := decl.Type.Params
+		param := paramName + " " + r.typ
+		if n := len(params.List); n > 0 {
+			m.replace(params.List[n-1].End(), params.List[n-1].End(), ", "+param)
+		} else {
+			m.replace(params.Opening+1, params.Opening+1, param)
+		}
+	}
+
+	for _, pkgInfo := range r.Program.AllPackages {
+		ids := []*ast.Ident{}
+		for id, obj := range pkgInfo.Uses {
+			if funcs[obj] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		for _, id := range ids {
+			file := fileContaining(pkgInfo, id.Pos())
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			call := callOf(&reference{pkgInfo, file, id, path[1:]})
+			if call == nil {
+				r.Log.Errorf("%s is used here without being called, so "+
+					"the default value cannot be passed to it", id.Name)
+				r.Log.AssociateNode(id)
+				continue
+			}
+			m := r.migration(config, pkgInfo, file)
+			if m == nil {
+				return
+			}
+			if n := len(call.Args); n > 0 {
+				m.replace(call.Args[n-1].End(), call.Args[n-1].End(), ", "+r.value)
+			} else {
+				m.replace(call.Rparen, call.Rparen, r.value)
+			}
+		}
+	}
+}
+
+// updateLiterals initializes the field in every literal of the struct type.
+func (r *AddField) updateLiterals(config *Config) {
+	exported := ast.IsExported(r.name)
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		for _, file := range pkgInfo.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				lit, ok := n.(*ast.CompositeLit)
+				if !ok || structTypeOf(pkgInfo.TypeOf(lit), r.target) == nil {
+					return true
+				}
+				if len(lit.Elts) > 0 {
+					if _, ok := lit.Elts[0].(*ast.KeyValueExpr); !ok {
+						r.Log.Errorf("This literal of %s is not keyed, so "+
+							"the field cannot be added to it; convert it "+
+							"to a keyed literal first", r.target.Name())
+						r.Log.AssociateNode(lit)
+						return true
+					}
+				}
+				if !exported && pkgInfo.Pkg != r.target.Pkg() {
+					r.Log.Warnf("%s is not exported, so it cannot be "+
+						"initialized here and will have its zero value",
+						r.name)
+					r.Log.AssociateNode(lit)
+					return true
+				}
+				m := r.migration(config, pkgInfo, file)
+				if m == nil {
+					return false
+				}
+				r.updateLiteral(m, lit, r.valueAt(lit.Pos()))
+				return true
+			})
+		}
+	}
+}
+
+// valueAt returns the expression that initializes the field in a literal at
+// the given position: a constructor's parameter, or the default value.
+func (r *AddField) valueAt(pos token.Pos) string {
+	for decl, paramName := range r.constructors {
+		if pos >= decl.Body.Lbrace && pos < decl.Body.Rbrace {
+			return paramName
+		}
+	}
+	return r.value
+}
+
+// updateLiteral adds an element initializing the field to the given keyed
+// literal.
+func (r *AddField) updateLiteral(m *fileMigration, lit *ast.CompositeLit, value string) {
+	elt := r.name + ": " + value
+	n := len(lit.Elts)
+	switch {
+	case n == 0:
+		m.replace(lit.Lbrace+1, lit.Lbrace+1, elt)
+	case r.line(lit.Rbrace) > r.line(lit.Elts[n-1].End()):
+		// Insert a line before the closing brace
+		indent := Indentation(m.src, m.offset(lit.Elts[n-1].Pos()))
+		start := lit.Rbrace - token.Pos(len(Indentation(m.src, m.offset(lit.Rbrace))))
+		m.replace(start, start, indent+elt+",\n")
+	default:
+		m.replace(lit.Elts[n-1].End(), lit.Elts[n-1].End(), ", "+elt)
+	}
+}
+
+const addFieldDoc = `
+  <h4>Purpose</h4>
+  <p>The Add Field refactoring adds a new field to a struct type and
+  initializes it with a default value in every composite literal of that
+  type, so adding a field to a widely used struct does not require finding
+  and updating each of its literals by hand.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a struct type.</li>
+    <li>Activate the Add Field refactoring.</li>
+    <li>Enter the name and type of the new field, and an expression giving its
+    default value.</li>
+  </ol>
+
+  <p>The field is added at the end of the struct.  A function named
+  <tt>New<i>T</i></tt> or <tt>new<i>T</i></tt> that returns a <i>T</i> or
+  *<i>T</i> is treated as a constructor: it receives the field's value as a
+  new parameter, and each call to it passes the default value.  The
+  refactoring fails if the struct has any unkeyed literals; the Convert to
+  Keyed Literals transformation can convert them first.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of adding a field
+  <tt>Retries int</tt> with the default value <tt>3</tt> to
+  <tt>Config</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type <span class="highlight">Config</span> struct {
+    Addr string
+}
+
+func NewConfig(addr string) *Config {
+    return &Config{Addr: addr}
+}
+
+var local = Config{Addr: "localhost"}
+var remote = NewConfig("example.com")</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Config struct {
+    Addr string
+    Retries int
+}
+
+func NewConfig(addr string, retries int) *Config {
+    return &Config{Addr: addr, Retries: retries}
+}
+
+var local = Config{Addr: "localhost", Retries: 3}
+var remote = NewConfig("example.com", 3)</pre>
+      </td>
+    </tr>
+  </table>
+`
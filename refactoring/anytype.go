@@ -0,0 +1,193 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that replaces the empty interface type,
+// interface{}, with the predeclared alias any (or vice versa).
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// ReplaceEmptyInterface is a transformation that replaces interface{} with any
+// in every file in the scope, or, if its optional argument is true, replaces
+// any with interface{} (e.g., so code can be compiled with Go versions prior
+// to 1.18).
+//
+// An occurrence is not replaced if any does not refer to the predeclared
+// identifier at that location (e.g., because a local variable named any is in
+// scope), or if the empty interface contains a comment.  Generated files are
+// modified, skipped, or cause the transformation to fail according to
+// Config.GeneratedFiles.
+type ReplaceEmptyInterface struct {
+	RefactoringBase
+}
+
+func (r *ReplaceEmptyInterface) Description() *Description {
+	return &Description{
+		Name:      "Replace interface{} with any",
+		Synopsis:  "Replaces interface{} with any (or vice versa) throughout the scope",
+		Usage:     "[<reverse?>]",
+		Selection: "",
+		HTMLDoc:   replaceEmptyInterfaceDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Replace any with interface{}",
+			Prompt:       "Replace any with interface{}, rather than interface{} with any?",
+			DefaultValue: false,
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *ReplaceEmptyInterface) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	reverse := len(config.Args) > 0 && config.Args[0].(bool)
+	from, to := "interface{}", "any"
+	if reverse {
+		from, to = to, from
+	}
+
+	count := 0
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		for _, file := range pkgInfo.Files {
+			if reverse {
+				count += r.replaceAny(pkgInfo, file)
+			} else {
+				count += r.replaceEmptyInterfaces(pkgInfo, file)
+			}
+		}
+	}
+	if count == 0 {
+		r.Log.Errorf("No occurrences of %s were found", from)
+		return &r.Result
+	}
+	r.Log.Infof("%d occurrence(s) of %s will be replaced with %s",
+		count, from, to)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// replaceEmptyInterfaces replaces each occurrence of interface{} in the given
+// file with any, returning the number of occurrences replaced.
+func (r *ReplaceEmptyInterface) replaceEmptyInterfaces(pkgInfo *loader.PackageInfo, file *ast.File) int {
+	universeAny := types.Universe.Lookup("any")
+	if universeAny == nil {
+		return 0
+	}
+	count := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		iface, ok := n.(*ast.InterfaceType)
+		if !ok || len(iface.Methods.List) > 0 || containsComment(file, iface) {
+			return true
+		}
+		if scope := pkgInfo.Pkg.Scope().Innermost(iface.Pos()); scope != nil {
+			if _, obj := scope.LookupParent("any", iface.Pos()); obj != universeAny {
+				r.Log.Warn("any does not refer to the predeclared " +
+					"identifier here, so interface{} will not be replaced")
+				r.Log.AssociateNode(iface)
+				return true
+			}
+		}
+		r.replaceNode(iface, "any")
+		count++
+		return true
+	})
+	return count
+}
+
+// replaceAny replaces each occurrence of the predeclared identifier any in
+// the given file with interface{}, returning the number of occurrences
+// replaced.
+func (r *ReplaceEmptyInterface) replaceAny(pkgInfo *loader.PackageInfo, file *ast.File) int {
+	universeAny := types.Universe.Lookup("any")
+	count := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && universeAny != nil &&
+			pkgInfo.Uses[id] == universeAny {
+			r.replaceNode(id, "interface{}")
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// containsComment returns true if a comment in the given file lies within the
+// given node.
+func containsComment(file *ast.File, node ast.Node) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= node.Pos() && group.End() <= node.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceNode adds an edit replacing the given node with the given text.
+func (r *ReplaceEmptyInterface) replaceNode(node ast.Node, replacement string) {
+	filename := r.Program.Fset.Position(node.Pos()).Filename
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	if err := r.Edits[filename].Add(r.Extent(node), replacement); err != nil {
+		r.Log.Error(err)
+	}
+}
+
+const replaceEmptyInterfaceDoc = `
+  <h4>Purpose</h4>
+  <p>The Replace interface{} with any transformation replaces every occurrence
+  of the empty interface type, <tt>interface{}</tt>, with the predeclared
+  alias <tt>any</tt> (introduced in Go 1.18) in every file in the refactoring
+  scope.  It can also do the reverse, so code can be compiled with older
+  versions of Go.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Activate the Replace interface{} with any transformation.</li>
+    <li>Optionally, indicate that <tt>any</tt> should be replaced with
+    <tt>interface{}</tt>.</li>
+  </ol>
+
+  <p>An occurrence of <tt>interface{}</tt> is not replaced if the name
+  <tt>any</tt> refers to something else at that location (e.g., a local
+  variable), or if it contains a comment.  Generated files are modified,
+  skipped, or cause the transformation to fail according to the generated file
+  policy.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of the transformation.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func Print(values ...interface{}) {
+    m := map[string]interface{}{}
+    ...
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func Print(values ...any) {
+    m := map[string]any{}
+    ...
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,405 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that generates a benchmark for a function.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// GenerateBenchmark is a refactoring that generates a skeleton benchmark for
+// the selected function or method: it constructs example arguments based on
+// the types of the parameters (and a receiver, for a method), calls
+// b.ReportAllocs, and calls the function b.N times.  Arguments whose types
+// have no obvious example value (e.g., interfaces and functions) are left nil,
+// with a comment reminding the user to initialize them.
+//
+// The benchmark is added to the end of the output file, which is created if
+// it does not exist.  By default, the output file is the _test.go file
+// corresponding to the file declaring the function (e.g., parse_test.go for
+// parse.go).
+type GenerateBenchmark struct {
+	RefactoringBase
+	// The selected function or method, and its signature
+	fn  *types.Func
+	sig *types.Signature
+	// The name of the benchmark
+	benchName string
+	// The file the benchmark is added to
+	out *outputFile
+}
+
+func (r *GenerateBenchmark) Description() *Description {
+	return &Description{
+		Name:      "Generate Benchmark",
+		Synopsis:  "Generates a benchmark for a function or method",
+		Usage:     "[<output_file> [<benchmark_name>]]",
+		Selection: "The name of a function or method",
+		HTMLDoc:   generateBenchmarkDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Output File:",
+			Prompt:       "File to add the benchmark to, relative to the directory containing the function (leave blank for the corresponding _test.go file).",
+			DefaultValue: "",
+		}, {
+			Label:        "Benchmark Name:",
+			Prompt:       "Name for the benchmark (leave blank for Benchmark followed by the function's name).",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *GenerateBenchmark) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.findFunc() {
+		return &r.Result
+	}
+	output, benchName := "", ""
+	if len(config.Args) > 0 {
+		output = strings.TrimSpace(config.Args[0].(string))
+	}
+	if len(config.Args) > 1 {
+		benchName = strings.TrimSpace(config.Args[1].(string))
+	}
+
+	output = r.testFilename(r.fn, output)
+	if r.out = r.outputFile(config, output, 0); r.out == nil {
+		return &r.Result
+	}
+	if !r.checkAccess() || !r.chooseName(benchName) {
+		return &r.Result
+	}
+	r.out.add(config, r.benchmarkCode(r.out.qualifier()))
+	r.Log.Infof("Adding %s to %s", r.benchName,
+		filepath.Base(r.out.filename))
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findFunc finds the function or method whose name is selected, returning
+// false (after logging an error) if there is none or if it cannot be
+// benchmarked.
+func (r *GenerateBenchmark) findFunc() bool {
+	r.fn, r.sig = nil, nil
+	if id, ok := r.SelectedNode.(*ast.Ident); ok && r.SelectedNodePkg != nil {
+		r.fn, _ = r.SelectedNodePkg.ObjectOf(id).(*types.Func)
+	}
+	if r.fn == nil {
+		r.Log.Error("Please select the name of a function or method.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	r.fn = r.fn.Origin()
+	r.sig = r.fn.Type().(*types.Signature)
+	var recvType types.Type
+	if r.sig.Recv() != nil {
+		recvType = r.sig.Recv().Type()
+	}
+	switch {
+	case r.sig.TypeParams().Len() > 0 || r.sig.RecvTypeParams().Len() > 0:
+		r.Log.Errorf("%s is generic, so a benchmark cannot be generated",
+			r.fn.Name())
+	case recvType != nil && types.IsInterface(recvType):
+		r.Log.Errorf("%s is an interface method, so a benchmark cannot "+
+			"be generated", r.fn.Name())
+	case recvType == nil && r.fn.Name() == "init":
+		r.Log.Error("An init function cannot be called, so a " +
+			"benchmark cannot be generated")
+	default:
+		return true
+	}
+	r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+	return false
+}
+
+// recvNamed returns the named type of the method's receiver (without a
+// pointer), or nil if it is not a method.
+func (r *GenerateBenchmark) recvNamed() *types.Named {
+	if r.sig.Recv() == nil {
+		return nil
+	}
+	t := r.sig.Recv().Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, _ := types.Unalias(t).(*types.Named)
+	return named
+}
+
+// checkAccess returns false (after logging an error) if the output file is in
+// a different package than the function, and the function, its receiver type,
+// or a type in its signature is not exported.
+func (r *GenerateBenchmark) checkAccess() bool {
+	pkg := r.fn.Pkg()
+	if pkg == nil || (r.out.pkg != nil && r.out.pkg.Path() == pkg.Path()) {
+		return true
+	}
+	if !r.fn.Exported() {
+		r.Log.Errorf("%s is not exported, so it cannot be called outside "+
+			"package %s", r.fn.Name(), pkg.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if named := r.recvNamed(); named != nil && !named.Obj().Exported() {
+		r.Log.Errorf("%s is not exported, so %s cannot be called outside "+
+			"package %s", named.Obj().Name(), r.fn.Name(), pkg.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if tn := unexportedType(r.sig.Params(), r.out.pkg); tn != nil {
+		r.Log.Errorf("The signature of %s refers to %s, which is not "+
+			"exported from package %s", r.fn.Name(), tn.Name(),
+			tn.Pkg().Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// chooseName determines the name of the benchmark, returning false (after
+// logging an error) if it is invalid or conflicts with an existing
+// declaration.  By default, the name is Benchmark followed by the function's
+// name, e.g., BenchmarkParse or (for a method) BenchmarkParser_Parse.
+func (r *GenerateBenchmark) chooseName(name string) bool {
+	if name == "" {
+		name = "Benchmark" + capitalize(r.fn.Name())
+		if named := r.recvNamed(); named != nil {
+			name = "Benchmark" + capitalize(named.Obj().Name()) + "_" +
+				r.fn.Name()
+		}
+	}
+	if !isIdentifierValid(name) || !strings.HasPrefix(name, "Benchmark") {
+		r.Log.Errorf("The name \"%s\" is not a valid benchmark name (it "+
+			"must be an identifier beginning with Benchmark)", name)
+		r.Log.AssociateArg(1)
+		return false
+	}
+	if r.out.declares(name) {
+		r.Log.Errorf("%s is already declared in %s", name,
+			filepath.Base(r.out.filename))
+		r.Log.AssociateArg(1)
+		return false
+	}
+	r.benchName = name
+	return true
+}
+
+// benchmarkCode returns the declaration of the benchmark, using the given
+// qualifier to refer to other packages.
+func (r *GenerateBenchmark) benchmarkCode(qualifier types.Qualifier) string {
+	callee := r.fn.Name()
+	reserved := []string{"b", "i"}
+	if r.sig.Recv() == nil && r.fn.Pkg() != nil {
+		if q := qualifier(r.fn.Pkg()); q != "" {
+			callee = q + "." + callee
+			reserved = append(reserved, q)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(b *%s.B) {\n", r.benchName,
+		qualifier(types.NewPackage("testing", "testing")))
+	if r.sig.Recv() != nil {
+		recvName := strings.ToLower(r.recvNamed().Obj().Name()[:1])
+		if recvName == "b" || recvName == "i" {
+			recvName = "recv"
+		}
+		reserved = append(reserved, recvName)
+		b.WriteString("\t" + declareExample(recvName, r.sig.Recv().Type(),
+			qualifier) + "\n")
+		callee = recvName + "." + callee
+	}
+	names := paramNames(r.sig, qualifier, reserved...)
+	args := []string{}
+	for i, name := range names {
+		b.WriteString("\t" + declareExample(name,
+			r.sig.Params().At(i).Type(), qualifier) + "\n")
+		args = append(args, name)
+	}
+	if r.sig.Variadic() {
+		args[len(args)-1] += "..."
+	}
+	b.WriteString("\tb.ReportAllocs()\n")
+	if len(names) > 0 || r.sig.Recv() != nil {
+		b.WriteString("\tb.ResetTimer()\n")
+	}
+	fmt.Fprintf(&b, "\tfor i := 0; i < b.N; i++ {\n\t\t%s(%s)\n\t}\n}",
+		callee, strings.Join(args, ", "))
+	return b.String()
+}
+
+// declareExample returns a statement declaring a variable with the given name
+// and type, initialized to an example value.  If there is no obvious example
+// value, the variable is declared with its zero value and a comment
+// reminding the user to initialize it.
+func declareExample(name string, t types.Type, qualifier types.Qualifier) string {
+	if value := exampleValue(t, qualifier, 0); value != "" {
+		return name + " := " + value
+	}
+	return fmt.Sprintf("var %s %s // TODO: Initialize %s", name,
+		types.TypeString(t, qualifier), name)
+}
+
+// exampleValue returns an expression of the given type to use as an example
+// argument (e.g., "example" for a string, or a slice containing one example
+// element), or "" if there is no obvious example value.  The depth limits the
+// nesting of composite literals.
+func exampleValue(t types.Type, qualifier types.Qualifier, depth int) string {
+	if depth > 2 {
+		return ""
+	}
+	typeString := types.TypeString(t, qualifier)
+	if named, ok := types.Unalias(t).(*types.Named); ok &&
+		named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" &&
+		named.Obj().Name() == "Context" {
+		return qualifier(named.Obj().Pkg()) + ".Background()"
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		value := basicExample(u)
+		if value == "" || t == types.Default(types.Typ[untypedKind(u)]) {
+			return value
+		}
+		return typeString + "(" + value + ")"
+	case *types.Slice:
+		if elem, ok := u.Elem().(*types.Basic); ok &&
+			elem.Kind() == types.Byte {
+			return typeString + `("example")`
+		}
+		return typeString + "{" + exampleElement(u.Elem(), qualifier, depth) + "}"
+	case *types.Map:
+		key := exampleElement(u.Key(), qualifier, depth)
+		elem := exampleElement(u.Elem(), qualifier, depth)
+		if key == "" || elem == "" {
+			return typeString + "{}"
+		}
+		return typeString + "{" + key + ": " + elem + "}"
+	case *types.Struct, *types.Array:
+		return typeString + "{}"
+	case *types.Pointer:
+		if _, ok := u.Elem().Underlying().(*types.Struct); ok {
+			return "&" + types.TypeString(u.Elem(), qualifier) + "{}"
+		}
+		return "new(" + types.TypeString(u.Elem(), qualifier) + ")"
+	case *types.Chan:
+		return "make(" + typeString + ", 1)"
+	}
+	return ""
+}
+
+// exampleElement returns an example value of the given type for use as an
+// element of a composite literal, where a constant need not be converted to
+// the element type, or "" if there is no obvious example value.
+func exampleElement(t types.Type, qualifier types.Qualifier, depth int) string {
+	if basic, ok := t.Underlying().(*types.Basic); ok {
+		return basicExample(basic)
+	}
+	return exampleValue(t, qualifier, depth+1)
+}
+
+// basicExample returns an untyped constant to use as an example value of the
+// given basic type, or "" if there is none.
+func basicExample(t *types.Basic) string {
+	switch info := t.Info(); {
+	case info&types.IsBoolean != 0:
+		return "true"
+	case info&types.IsString != 0:
+		return `"example"`
+	case info&types.IsInteger != 0:
+		return "10"
+	case info&types.IsFloat != 0:
+		return "1.5"
+	case info&types.IsComplex != 0:
+		return "1i"
+	}
+	return ""
+}
+
+// untypedKind returns the kind of the untyped constants whose default type
+// has the same kind of values as the given basic type (e.g., UntypedInt for
+// int64).
+func untypedKind(t *types.Basic) types.BasicKind {
+	switch info := t.Info(); {
+	case info&types.IsBoolean != 0:
+		return types.UntypedBool
+	case info&types.IsString != 0:
+		return types.UntypedString
+	case info&types.IsInteger != 0:
+		return types.UntypedInt
+	case info&types.IsFloat != 0:
+		return types.UntypedFloat
+	case info&types.IsComplex != 0:
+		return types.UntypedComplex
+	}
+	return types.Invalid
+}
+
+const generateBenchmarkDoc = `
+  <h4>Purpose</h4>
+  <p>The Generate Benchmark refactoring generates a skeleton benchmark for a
+  function or method, which constructs example arguments and calls the
+  function <tt>b.N</tt> times.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a function or method (in its declaration or in a
+    call).</li>
+    <li>Activate the Generate Benchmark refactoring.</li>
+    <li>Optionally, enter the name of the file to add the benchmark to,
+    relative to the directory containing the function.  By default, it is the
+    <tt>_test.go</tt> file corresponding to the file declaring the function
+    (e.g., <tt>parse_test.go</tt> for <tt>parse.go</tt>).  The file is created
+    if it does not exist.</li>
+    <li>Optionally, enter a name for the benchmark.  By default, it is
+    <tt>Benchmark</tt> followed by the function's name (or, for a method, the
+    receiver type's name, an underscore, and the method's name).</li>
+  </ol>
+
+  <p>Example arguments are constructed based on the types of the parameters:
+  e.g., <tt>"example"</tt> for a string, <tt>10</tt> for an integer, a slice
+  or map containing one example element, an empty composite literal for a
+  struct, and <tt>context.Background()</tt> for a context.  Arguments whose
+  types have no obvious example value (such as interfaces and functions) are
+  left nil, with a comment reminding you to initialize them.  The benchmark
+  calls <tt>b.ReportAllocs</tt>, so it reports memory allocations, and
+  <tt>b.ResetTimer</tt>, so constructing the arguments is not measured.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of generating a benchmark for
+  <tt>Repeat</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func Repeat(s string, count int) string {
+    ...
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func BenchmarkRepeat(b *testing.B) {
+    s := "example"
+    count := 10
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        Repeat(s, count)
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,64 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file records checksums of the files that a refactoring analyzes, so
+// that clients can detect files that are modified (e.g., by an editor) after
+// the refactoring is run but before its edits are applied.
+
+package refactoring
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/godoctor/godoctor/filesystem"
+)
+
+// A checksumFileSystem is a FileSystem that records a checksum of each file
+// that is read from it (other than files in $GOROOT, which are never
+// modified).  It is safe for concurrent use, since go/loader reads files
+// concurrently.
+type checksumFileSystem struct {
+	filesystem.FileSystem
+	mutex     sync.Mutex
+	checksums map[string]string
+}
+
+func (fs *checksumFileSystem) OpenFile(path string) (io.ReadCloser, error) {
+	if isInGoRoot(path) {
+		return fs.FileSystem.OpenFile(path)
+	}
+	reader, err := fs.FileSystem.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	fs.mutex.Lock()
+	fs.checksums[path] = filesystem.Checksum(contents)
+	fs.mutex.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// recordChecksums adds the checksum of each file with edits to r.Checksums:
+// the checksum of its contents when the Program was loaded, or (for a file
+// that was not read then, e.g., a _test.go file outside the scope) of its
+// current contents.
+func (r *RefactoringBase) recordChecksums(config *Config) {
+	if r.Checksums == nil {
+		r.Checksums = map[string]string{}
+	}
+	for filename := range r.Edits {
+		if checksum, ok := r.loadChecksums[filename]; ok {
+			r.Checksums[filename] = checksum
+		} else if contents := readFile(config, filename); contents != nil {
+			r.Checksums[filename] = filesystem.Checksum(contents)
+		}
+	}
+}
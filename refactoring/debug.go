@@ -20,7 +20,6 @@ import (
 	"go/token"
 	"go/types"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -31,6 +30,7 @@ import (
 
 	"github.com/godoctor/godoctor/analysis/cfg"
 	"github.com/godoctor/godoctor/analysis/dataflow"
+	"github.com/godoctor/godoctor/analysis/imports"
 	"github.com/godoctor/godoctor/analysis/names"
 )
 
@@ -41,6 +41,7 @@ Information about the entire file:
     showast           Show the abstract syntax tree for the selected file
     showidentifiers   Show name references (ast.Object) in initial packages
     showpackages      List all packages loaded (due to --scope)
+    showcycles        List import cycles in the scope and how to break them
 
 If anything is selected:
     fmt               Format the node enclosing the selection using go/printer
@@ -67,6 +68,7 @@ func (r *Debug) Description() *Description {
 		Name:      "Debug Refactoring",
 		Synopsis:  "Provides assorted debugging outputs",
 		Usage:     "<command>",
+		Selection: "",
 		HTMLDoc:   "",
 		Multifile: false,
 		Params:    nil,
@@ -109,12 +111,15 @@ func (r *Debug) Run(config *Config) *Result {
 		r.showLiveVars(&r.DebugOutput)
 	case "showidentifiers":
 		r.showIdentifiers(&r.DebugOutput)
+	case "showcycles":
+		r.showImportCycles(config, &r.DebugOutput)
 	case "showpackages":
 		r.showLoadedPackagesAndFiles(&r.DebugOutput)
 	case "showreferences":
 		r.showReferences(&r.DebugOutput)
 	default:
 		r.Log.Errorf("Unknown option %s", command)
+		r.Log.AssociateArg(0)
 	}
 	return &r.Result
 }
@@ -335,7 +340,7 @@ func (r *Debug) showIdentifiers(out io.Writer) {
 func (r *Debug) showIdentifiersInFile(pkgInfo *loader.PackageInfo, file *ast.File, out io.Writer) {
 	filename, err := r.getRelativeFilename(file)
 	if err != nil {
-		log.Fatal(err)
+		r.Log.Error(err)
 		return
 	}
 
@@ -382,6 +387,31 @@ func (r *Debug) showLoadedPackagesAndFiles(out io.Writer) {
 	}
 }
 
+func (r *Debug) showImportCycles(config *Config, out io.Writer) {
+	graph, err := imports.NewGraph(newBuildContext(config), config.Scope)
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	cycles := graph.Cycles()
+	if len(cycles) == 0 {
+		fmt.Fprintln(out, "No import cycles found.")
+		return
+	}
+	for _, cycle := range cycles {
+		fmt.Fprintf(out, "Import cycle: %s -> %s\n",
+			strings.Join(cycle, " -> "), cycle[0])
+		suggestions, err := graph.SuggestBreaks(cycle)
+		if err != nil {
+			r.Log.Error(err)
+			return
+		}
+		for _, s := range suggestions {
+			fmt.Fprintf(out, "\t%s\n", s)
+		}
+	}
+}
+
 func (r *Debug) showReferences(out io.Writer) {
 	errorMsg := "Please select an identifier for showreferences"
 
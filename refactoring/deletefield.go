@@ -0,0 +1,403 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that deletes a field from a struct type,
+// along with the places where the field is initialized or assigned.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// DeleteField is a refactoring that deletes the selected field from a struct
+// type.  Its entries are deleted from composite literals (keyed or unkeyed)
+// and statements that only assign it are deleted; if the assigned value may
+// have side effects, the field is replaced by the blank identifier instead.
+//
+// Any other reference to the field (e.g., a read) cannot be removed
+// automatically; each one is reported with a warning, so it can be rewritten
+// by hand.
+type DeleteField struct {
+	RefactoringBase
+	// The field to delete and its declaration
+	field   *types.Var
+	pkgInfo *loader.PackageInfo
+	decl    *ast.Field
+	fields  *ast.FieldList
+	// The number of references that must be removed by hand
+	remaining int
+}
+
+func (r *DeleteField) Description() *Description {
+	return &Description{
+		Name:           "Delete Field",
+		Synopsis:       "Deletes a struct field and the places it is initialized or assigned",
+		Usage:          "",
+		Selection:      "The name of a struct field",
+		HTMLDoc:        deleteFieldDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *DeleteField) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.remaining = 0
+
+	if !r.findField() {
+		return &r.Result
+	}
+	r.Log.Infof("Deleting field %s", r.field.Name())
+
+	if !r.deleteFieldDecl(config) {
+		return &r.Result
+	}
+	r.deleteReferences(config)
+	r.deleteUnkeyedValues(config)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	// The remaining references will not type check, and they have already
+	// been reported
+	r.UpdateLog(config, r.remaining == 0)
+	return &r.Result
+}
+
+// findField finds the selected field and its declaration, returning false
+// (after logging an error) if there is none.
+func (r *DeleteField) findField() bool {
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		if v, ok := r.SelectedNodePkg.ObjectOf(id).(*types.Var); ok && v.IsField() {
+			r.field = v.Origin()
+		}
+	}
+	if r.field == nil {
+		r.Log.Error("Please select the name of a struct field.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if r.field.Embedded() {
+		r.Log.Errorf("%s is an embedded field, which cannot be deleted",
+			r.field.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	r.pkgInfo = r.Program.AllPackages[r.field.Pkg()]
+	if r.pkgInfo != nil && !isInGoRoot(r.Program.Fset.Position(r.field.Pos()).Filename) {
+		if file := fileContaining(r.pkgInfo, r.field.Pos()); file != nil {
+			path, _ := astutil.PathEnclosingInterval(file, r.field.Pos(), r.field.Pos())
+			for i, node := range path {
+				if field, ok := node.(*ast.Field); ok && i+1 < len(path) {
+					r.decl = field
+					r.fields, _ = path[i+1].(*ast.FieldList)
+					break
+				}
+			}
+		}
+	}
+	if r.fields == nil {
+		r.Log.Errorf("%s is not declared in the code being refactored, "+
+			"so it cannot be deleted", r.field.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// deleteFieldDecl deletes the field's name from its declaration, or the
+// entire declaration if it declares no other fields, returning false (after
+// logging an error) if the file cannot be read.
+func (r *DeleteField) deleteFieldDecl(config *Config) bool {
+	m := r.migration(config, r.pkgInfo, fileContaining(r.pkgInfo, r.decl.Pos()))
+	if m == nil {
+		return false
+	}
+	if len(r.decl.Names) > 1 {
+		names := r.decl.Names
+		for i, name := range names {
+			if name.Pos() != r.field.Pos() {
+				continue
+			}
+			prev, next := token.NoPos, token.NoPos
+			if i > 0 {
+				prev = names[i-1].End()
+			}
+			if i+1 < len(names) {
+				next = names[i+1].Pos()
+			}
+			deleteElement(m, name.Pos(), name.End(), prev, next)
+		}
+		return true
+	}
+	start := r.decl.Pos()
+	if r.decl.Doc != nil {
+		start = r.decl.Doc.Pos()
+	}
+	list := r.fields.List
+	for i, field := range list {
+		if field != r.decl {
+			continue
+		}
+		prev, next := token.NoPos, token.NoPos
+		if i > 0 {
+			prev = list[i-1].End()
+		}
+		if i+1 < len(list) {
+			next = list[i+1].Pos()
+		}
+		deleteElement(m, start, r.decl.End(), prev, next)
+	}
+	return true
+}
+
+// deleteReferences deletes each keyed literal element and assignment that
+// refers to the field, and reports every other reference.
+func (r *DeleteField) deleteReferences(config *Config) {
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		ids := []*ast.Ident{}
+		for id, obj := range pkgInfo.Uses {
+			if v, ok := obj.(*types.Var); ok && v.Origin() == r.field {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		for _, id := range ids {
+			file := fileContaining(pkgInfo, id.Pos())
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			m := r.migration(config, pkgInfo, file)
+			if m == nil {
+				return
+			}
+			if !r.deleteReference(m, id, path[1:]) {
+				r.Log.Warnf("%s is still used here, so this reference "+
+					"must be removed by hand", id.Name)
+				r.Log.AssociateNode(id)
+				r.remaining++
+			}
+		}
+	}
+}
+
+// deleteReference deletes the literal element or assignment containing the
+// given reference to the field, returning false if it is neither.
+func (r *DeleteField) deleteReference(m *fileMigration, id *ast.Ident, path []ast.Node) bool {
+	if kv, ok := path[0].(*ast.KeyValueExpr); ok && kv.Key == id {
+		lit, ok := path[1].(*ast.CompositeLit)
+		if !ok || effectsOf(m.pkgInfo, kv.Value).effects {
+			return false
+		}
+		r.deleteLiteralElement(m, lit, kv)
+		return true
+	}
+
+	sel, ok := path[0].(*ast.SelectorExpr)
+	if !ok || sel.Sel != id || len(path) < 3 ||
+		effectsOf(m.pkgInfo, sel.X).effects {
+		return false
+	}
+	switch stmt := path[1].(type) {
+	case *ast.AssignStmt:
+		if stmt.Tok == token.DEFINE || !containsExpr(stmt.Lhs, sel) {
+			return false
+		}
+		effects := false
+		for _, rhs := range stmt.Rhs {
+			effects = effects || effectsOf(m.pkgInfo, rhs).effects
+		}
+		switch {
+		case len(stmt.Lhs) == 1 && !effects && isInStmtList(path[2]):
+			deleteElement(m, stmt.Pos(), stmt.End(), token.NoPos, token.NoPos)
+		case stmt.Tok == token.ASSIGN:
+			m.replace(sel.Pos(), sel.End(), "_")
+		default:
+			return false
+		}
+		return true
+	case *ast.IncDecStmt:
+		if !isInStmtList(path[2]) {
+			return false
+		}
+		deleteElement(m, stmt.Pos(), stmt.End(), token.NoPos, token.NoPos)
+		return true
+	}
+	return false
+}
+
+// deleteUnkeyedValues deletes the field's value from each unkeyed literal of
+// a struct type containing it.
+func (r *DeleteField) deleteUnkeyedValues(config *Config) {
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		for _, file := range pkgInfo.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				lit, ok := n.(*ast.CompositeLit)
+				if !ok || len(lit.Elts) == 0 {
+					return true
+				}
+				if _, ok := lit.Elts[0].(*ast.KeyValueExpr); ok {
+					return true
+				}
+				st := structTypeOf(pkgInfo.TypeOf(lit), nil)
+				if st == nil || st.NumFields() != len(lit.Elts) {
+					return true
+				}
+				for i := 0; i < st.NumFields(); i++ {
+					if st.Field(i).Origin() != r.field {
+						continue
+					}
+					if effectsOf(pkgInfo, lit.Elts[i]).effects {
+						r.Log.Errorf("The value of %s in this literal may "+
+							"have side effects, so it cannot be deleted",
+							r.field.Name())
+						r.Log.AssociateNode(lit.Elts[i])
+						return true
+					}
+					m := r.migration(config, pkgInfo, file)
+					if m == nil {
+						return false
+					}
+					r.deleteLiteralElement(m, lit, lit.Elts[i])
+				}
+				return true
+			})
+		}
+	}
+}
+
+// deleteLiteralElement deletes the given element of a composite literal.
+func (r *DeleteField) deleteLiteralElement(m *fileMigration, lit *ast.CompositeLit, elt ast.Expr) {
+	for i, e := range lit.Elts {
+		if e != elt {
+			continue
+		}
+		prev, next := token.NoPos, token.NoPos
+		if i > 0 {
+			prev = lit.Elts[i-1].End()
+		}
+		if i+1 < len(lit.Elts) {
+			next = lit.Elts[i+1].Pos()
+		}
+		deleteElement(m, elt.Pos(), elt.End(), prev, next)
+	}
+}
+
+// containsExpr returns true if the given expression is in the list.
+func containsExpr(exprs []ast.Expr, expr ast.Expr) bool {
+	for _, e := range exprs {
+		if e == expr {
+			return true
+		}
+	}
+	return false
+}
+
+// isInStmtList returns true if the given node contains a list of statements
+// (so a statement in it can be deleted).
+func isInStmtList(parent ast.Node) bool {
+	switch parent.(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+		return true
+	}
+	return false
+}
+
+// deleteElement deletes the text from start to end, which is an element of a
+// list whose previous element (if any) ends at prevEnd and whose next element
+// (if any) begins at nextStart.  If the element is on lines by itself, those
+// lines are deleted, along with a separator and comment following it;
+// otherwise, the separator between it and an adjacent element is deleted.
+func deleteElement(m *fileMigration, start, end, prevEnd, nextStart token.Pos) {
+	s, e := m.offset(start), m.offset(end)
+	lineStart := bytes.LastIndexByte(m.src[:s], '\n') + 1
+	lineEnd := len(m.src)
+	if i := bytes.IndexByte(m.src[e:], '\n'); i >= 0 {
+		lineEnd = e + i + 1
+	}
+	rest := strings.TrimSpace(string(m.src[e:lineEnd]))
+	rest = strings.TrimSpace(strings.TrimLeft(rest, ",;"))
+	if len(bytes.TrimSpace(m.src[lineStart:s])) == 0 &&
+		(rest == "" || strings.HasPrefix(rest, "//")) {
+		m.addEdit(&text.Extent{Offset: lineStart, Length: lineEnd - lineStart}, "")
+		return
+	}
+	switch {
+	case nextStart.IsValid():
+		m.replace(start, nextStart, "")
+	case prevEnd.IsValid():
+		m.replace(prevEnd, end, "")
+	default:
+		m.replace(start, end, "")
+	}
+}
+
+const deleteFieldDoc = `
+  <h4>Purpose</h4>
+  <p>The Delete Field refactoring deletes a field from a struct type, along
+  with its entries in composite literals and the statements that assign it.
+  Any other references to the field are reported, so they can be rewritten
+  by hand, rather than leaving them to be found by the compiler.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a struct field, either in its declaration or where
+    it is used.</li>
+    <li>Activate the Delete Field refactoring.</li>
+  </ol>
+
+  <p>The field's entries are deleted from both keyed and unkeyed composite
+  literals.  A statement that assigns the field (or increments or decrements
+  it) is deleted; if the assigned value may have side effects, the field is
+  replaced by the blank identifier instead.  Every other reference, such as a
+  read of the field, produces a warning.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of deleting the field
+  <tt>Legacy</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type Config struct {
+    Addr   string
+    <span class="highlight">Legacy</span> bool
+}
+
+func main() {
+    c := Config{Addr: "localhost", Legacy: true}
+    c.Legacy = false
+    fmt.Println(c.Addr)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Config struct {
+    Addr   string
+}
+
+func main() {
+    c := Config{Addr: "localhost"}
+    fmt.Println(c.Addr)
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,661 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that replaces a done channel (a chan
+// struct{} that is closed to signal cancellation) with a context.Context.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+
+	"github.com/godoctor/godoctor/analysis/members"
+)
+
+// DoneChannelToContext is a refactoring that replaces a done channel with
+// context-based cancellation.  The selected identifier must be either a
+// parameter of type chan struct{} (or <-chan struct{}) or a struct field of
+// that type.
+//
+// A parameter is replaced by a ctx context.Context parameter, which becomes
+// the first parameter.  Receives from the channel become receives from
+// ctx.Done().  At each call site, the argument must be nil (which becomes
+// context.Background()) or a local variable initialized with
+// make(chan struct{}) that is only closed, received from, or passed to the
+// function; the variable is replaced by a context and cancel function created
+// by context.WithCancel, and closing it becomes calling cancel().
+//
+// A field is replaced by ctx and cancel fields.  Assigning make(chan struct{})
+// to the field becomes assigning the result of context.WithCancel, closing it
+// becomes calling cancel, and receives from it become receives from
+// ctx.Done().
+//
+// If any use of the channel cannot be converted, the refactoring fails.
+type DoneChannelToContext struct {
+	RefactoringBase
+}
+
+func (r *DoneChannelToContext) Description() *Description {
+	return &Description{
+		Name:           "Convert Done Channel to Context",
+		Synopsis:       "Replaces a chan struct{} used for cancellation with a context.Context",
+		Usage:          "",
+		Selection:      "A parameter or field of type chan struct{}",
+		HTMLDoc:        doneChannelToContextDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *DoneChannelToContext) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	id, ok := r.SelectedNode.(*ast.Ident)
+	var v *types.Var
+	if ok {
+		v, _ = r.SelectedNodePkg.Defs[id].(*types.Var)
+	}
+	if v == nil || !isDoneChannel(v.Type()) {
+		r.Log.Error("Please select the declaration of a parameter or " +
+			"struct field whose type is chan struct{}.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+
+	if v.IsField() {
+		r.convertField(config, id, v)
+	} else if fn := r.enclosingFuncDecl(); fn != nil && isParamOf(id, fn) {
+		r.convertParam(config, fn, id, v)
+	} else {
+		r.Log.Errorf("%s must be a parameter of a function or method, "+
+			"or a struct field", id.Name)
+		r.Log.AssociateNode(id)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// isDoneChannel returns true if the given type is a channel of struct{}.
+func isDoneChannel(t types.Type) bool {
+	ch, ok := t.Underlying().(*types.Chan)
+	if !ok {
+		return false
+	}
+	st, ok := ch.Elem().Underlying().(*types.Struct)
+	return ok && st.NumFields() == 0
+}
+
+// enclosingFuncDecl returns the function declaration enclosing the selection,
+// or nil.
+func (r *DoneChannelToContext) enclosingFuncDecl() *ast.FuncDecl {
+	for _, node := range r.PathEnclosingSelection {
+		if fn, ok := node.(*ast.FuncDecl); ok {
+			return fn
+		}
+	}
+	return nil
+}
+
+// isParamOf returns true if the given identifier names a parameter of the
+// given function.
+func isParamOf(id *ast.Ident, fn *ast.FuncDecl) bool {
+	for _, field := range fn.Type.Params.List {
+		for _, name := range field.Names {
+			if name == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A reference is an identifier in a particular file and package.
+type reference struct {
+	pkgInfo *loader.PackageInfo
+	file    *ast.File
+	id      *ast.Ident
+	// The nodes enclosing id, starting with its parent
+	path []ast.Node
+}
+
+// referencesTo returns every use of the given object in the program.
+func (r *DoneChannelToContext) referencesTo(obj types.Object) []*reference {
+	result := []*reference{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for id, used := range pkgInfo.Uses {
+			if used != obj {
+				continue
+			}
+			file := fileContaining(pkgInfo, id.Pos())
+			if file == nil {
+				continue
+			}
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			result = append(result, &reference{pkgInfo, file, id, path[1:]})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id.Pos() < result[j].id.Pos()
+	})
+	return result
+}
+
+// isReceive returns true if the given expression is the operand of a receive
+// operation (<-expr), the parent of which is the first node in path.
+func isReceive(expr ast.Expr, path []ast.Node) bool {
+	if len(path) == 0 {
+		return false
+	}
+	unary, ok := path[0].(*ast.UnaryExpr)
+	return ok && unary.Op == token.ARROW && unary.X == expr
+}
+
+// builtinCall returns the call to the named builtin function whose first
+// argument is the given expression (the parent of which is the first node in
+// path), or nil.
+func builtinCall(pkgInfo *loader.PackageInfo, name string, expr ast.Expr, path []ast.Node) *ast.CallExpr {
+	if len(path) == 0 {
+		return nil
+	}
+	call, ok := path[0].(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 || call.Args[0] != expr {
+		return nil
+	}
+	fn, ok := call.Fun.(*ast.Ident)
+	if !ok || fn.Name != name {
+		return nil
+	}
+	if _, ok := pkgInfo.Uses[fn].(*types.Builtin); !ok {
+		return nil
+	}
+	return call
+}
+
+// isMakeDoneChannel returns true if the given expression is a call to make
+// creating an unbuffered channel of struct{}.
+func isMakeDoneChannel(pkgInfo *loader.PackageInfo, expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return false
+	}
+	fn, ok := call.Fun.(*ast.Ident)
+	if !ok || fn.Name != "make" {
+		return false
+	}
+	_, isBuiltin := pkgInfo.Uses[fn].(*types.Builtin)
+	return isBuiltin && isDoneChannel(pkgInfo.TypeOf(call))
+}
+
+// convertField replaces the given struct field with ctx and cancel fields.
+func (r *DoneChannelToContext) convertField(config *Config, id *ast.Ident, v *types.Var) {
+	var field *ast.Field
+	var named *types.Named
+	for _, node := range r.PathEnclosingSelection {
+		switch node := node.(type) {
+		case *ast.Field:
+			if field == nil {
+				field = node
+			}
+		case *ast.TypeSpec:
+			if named == nil {
+				if tn, ok := r.SelectedNodePkg.Defs[node.Name].(*types.TypeName); ok {
+					named, _ = tn.Type().(*types.Named)
+				}
+			}
+		}
+	}
+	if field == nil || named == nil || len(field.Names) != 1 {
+		r.Log.Errorf("%s must be declared by itself in a named struct type",
+			id.Name)
+		r.Log.AssociateNode(id)
+		return
+	}
+	for _, name := range []string{"ctx", "cancel"} {
+		if obj := members.Lookup(named, r.SelectedNodePkg.Pkg, name); obj != nil {
+			r.Log.Errorf("%s already has a field or method named %s",
+				named.Obj().Name(), name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return
+		}
+	}
+
+	m := r.migration(config, r.SelectedNodePkg, r.File)
+	if m == nil {
+		return
+	}
+	indent := Indentation(r.FileContents, r.OffsetOfPos(field.Pos()))
+	m.replace(field.Pos(), field.Type.End(), fmt.Sprintf(
+		"ctx    %s\n%scancel %s",
+		m.qualify("context", "context", "Context", field.Pos()), indent,
+		m.qualify("context", "context", "CancelFunc", field.Pos())))
+
+	for _, ref := range r.referencesTo(v) {
+		m := r.migration(config, ref.pkgInfo, ref.file)
+		if m == nil {
+			return
+		}
+		sel, ok := ref.path[0].(*ast.SelectorExpr)
+		if !ok || sel.Sel != ref.id {
+			r.Log.Errorf("%s cannot be converted here; initialize it by "+
+				"assigning make(chan struct{}) instead", id.Name)
+			r.Log.AssociateNode(ref.id)
+			continue
+		}
+		recv := m.textOf(sel.X)
+		path := ref.path[1:]
+		if isReceive(sel, path) {
+			m.replace(ref.id.Pos(), ref.id.End(), "ctx.Done()")
+		} else if call := builtinCall(ref.pkgInfo, "close", sel, path); call != nil {
+			m.replace(call.Pos(), call.End(), recv+".cancel()")
+		} else if assign, ok := path[0].(*ast.AssignStmt); ok &&
+			assign.Tok == token.ASSIGN && len(assign.Lhs) == 1 &&
+			assign.Lhs[0] == sel && isMakeDoneChannel(ref.pkgInfo, assign.Rhs[0]) {
+			m.replace(assign.Pos(), assign.End(), fmt.Sprintf(
+				"%s.ctx, %s.cancel = %s(%s())", recv, recv,
+				m.qualify("context", "context", "WithCancel", assign.Pos()),
+				m.qualify("context", "context", "Background", assign.Pos())))
+		} else {
+			r.Log.Errorf("%s can only be received from, closed, or "+
+				"assigned make(chan struct{})", id.Name)
+			r.Log.AssociateNode(ref.id)
+		}
+	}
+}
+
+// convertParam replaces the given parameter of the given function with a
+// context parameter and updates the function's callers.
+func (r *DoneChannelToContext) convertParam(config *Config, fn *ast.FuncDecl, id *ast.Ident, v *types.Var) {
+	pkgInfo := r.SelectedNodePkg
+	fnObj, _ := pkgInfo.Defs[fn.Name].(*types.Func)
+	if fnObj == nil || fn.Body == nil {
+		r.Log.Errorf("%s must be a parameter of a function with a body",
+			id.Name)
+		r.Log.AssociateNode(id)
+		return
+	}
+	if usesName(fn, "ctx") {
+		r.Log.Errorf("%s already uses the name ctx", fn.Name.Name)
+		r.Log.AssociateNode(fn.Name)
+		return
+	}
+	index := paramIndex(fn, id)
+
+	m := r.migration(config, pkgInfo, r.File)
+	if m == nil {
+		return
+	}
+	r.removeParam(m, fn, id)
+
+	// Receives from the channel in the function
+	for _, ref := range r.referencesTo(v) {
+		if isReceive(ref.id, ref.path) {
+			m.replace(ref.id.Pos(), ref.id.End(), "ctx.Done()")
+		} else if !r.isArgument(ref, fnObj, index) {
+			r.Log.Errorf("%s can only be received from or passed to %s",
+				id.Name, fn.Name.Name)
+			r.Log.AssociateNode(ref.id)
+		}
+	}
+
+	// Calls to the function
+	channels := map[*types.Var]bool{}
+	for _, ref := range r.referencesTo(fnObj) {
+		call := callOf(ref)
+		if call == nil || call.Ellipsis.IsValid() || index >= len(call.Args) {
+			r.Log.Errorf("%s can only be called directly", fn.Name.Name)
+			r.Log.AssociateNode(ref.id)
+			continue
+		}
+		m := r.migration(config, ref.pkgInfo, ref.file)
+		if m == nil {
+			return
+		}
+		arg := astutil.Unparen(call.Args[index])
+		argID, _ := arg.(*ast.Ident)
+		var ctx string
+		switch obj := ref.pkgInfo.ObjectOf(argID).(type) {
+		case *types.Nil:
+			ctx = m.qualify("context", "context", "Background", call.Pos()) + "()"
+		case *types.Var:
+			if obj == v {
+				ctx = "ctx"
+			} else if r.isLocalChannel(ref, obj) {
+				channels[obj] = true
+				ctx = "ctx"
+			}
+		}
+		if ctx == "" {
+			r.Log.Errorf("The argument for %s must be nil or a local "+
+				"variable initialized with make(chan struct{})", id.Name)
+			r.Log.AssociateNode(call.Args[index])
+			continue
+		}
+		r.moveArgument(m, call, index, ctx)
+	}
+	if r.Log.ContainsErrors() {
+		return
+	}
+
+	for ch := range channels {
+		r.convertLocalChannel(config, ch, fnObj, index)
+	}
+}
+
+// usesName returns true if any identifier in the given node has the given
+// name.
+func usesName(node ast.Node, name string) bool {
+	result := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			result = true
+		}
+		return !result
+	})
+	return result
+}
+
+// paramIndex returns the index of the given parameter among the parameters
+// of the given function.
+func paramIndex(fn *ast.FuncDecl, id *ast.Ident) int {
+	index := 0
+	for _, field := range fn.Type.Params.List {
+		for _, name := range field.Names {
+			if name == id {
+				return index
+			}
+			index++
+		}
+	}
+	return -1
+}
+
+// removeParam removes the given parameter from the function's parameter list
+// and inserts a ctx context.Context parameter at the beginning.
+func (r *DoneChannelToContext) removeParam(m *fileMigration, fn *ast.FuncDecl, id *ast.Ident) {
+	ctx := "ctx " + m.qualify("context", "context", "Context", fn.Pos())
+	fields := fn.Type.Params.List
+	for i, field := range fields {
+		for j, name := range field.Names {
+			if name != id {
+				continue
+			}
+			switch {
+			case len(field.Names) > 1 && j > 0:
+				m.replace(field.Names[j-1].End(), name.End(), "")
+			case len(field.Names) > 1:
+				m.replace(name.Pos(), field.Names[1].Pos(), "")
+			case i > 0:
+				m.replace(fields[i-1].End(), field.End(), "")
+			default:
+				m.replace(field.Pos(), field.End(), ctx)
+				return
+			}
+			m.replace(fields[0].Pos(), fields[0].Pos(), ctx+", ")
+			return
+		}
+	}
+}
+
+// callOf returns the call whose function is the given reference, or nil.
+func callOf(ref *reference) *ast.CallExpr {
+	var fun ast.Expr = ref.id
+	path := ref.path
+	if len(path) > 0 {
+		if sel, ok := path[0].(*ast.SelectorExpr); ok && sel.Sel == ref.id {
+			fun, path = sel, path[1:]
+		}
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	if call, ok := path[0].(*ast.CallExpr); ok && call.Fun == fun {
+		return call
+	}
+	return nil
+}
+
+// isArgument returns true if the given reference is the argument at the
+// given index in a call to the given function.
+func (r *DoneChannelToContext) isArgument(ref *reference, fn *types.Func, index int) bool {
+	if len(ref.path) == 0 {
+		return false
+	}
+	call, ok := ref.path[0].(*ast.CallExpr)
+	if !ok || index >= len(call.Args) || astutil.Unparen(call.Args[index]) != ref.id {
+		return false
+	}
+	fun := astutil.Unparen(call.Fun)
+	if sel, ok := fun.(*ast.SelectorExpr); ok {
+		fun = sel.Sel
+	}
+	id, ok := fun.(*ast.Ident)
+	return ok && ref.pkgInfo.Uses[id] == fn
+}
+
+// moveArgument removes the argument at the given index from the call and
+// inserts the given context argument at the beginning.
+func (r *DoneChannelToContext) moveArgument(m *fileMigration, call *ast.CallExpr, index int, ctx string) {
+	args := call.Args
+	if index == 0 {
+		m.replace(args[0].Pos(), args[0].End(), ctx)
+		return
+	}
+	m.replace(args[index-1].End(), args[index].End(), "")
+	m.replace(args[0].Pos(), args[0].Pos(), ctx+", ")
+}
+
+// isLocalChannel returns true if the given variable, referenced by the
+// argument of a call, is declared in the body of the function containing the
+// call.
+func (r *DoneChannelToContext) isLocalChannel(ref *reference, v *types.Var) bool {
+	for _, node := range ref.path {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			return v.Pos() >= node.Body.Pos() && v.Pos() < node.Body.End()
+		case *ast.FuncLit:
+			return v.Pos() >= node.Body.Pos() && v.Pos() < node.Body.End()
+		}
+	}
+	return false
+}
+
+// convertLocalChannel replaces the declaration of the given local variable,
+// which is passed to the function at the given index, with a context and
+// cancel function, and converts its other uses.
+func (r *DoneChannelToContext) convertLocalChannel(config *Config, ch *types.Var, fn *types.Func, index int) {
+	pkgInfo, path, _ := r.Program.PathEnclosingInterval(ch.Pos(), ch.Pos())
+	if pkgInfo == nil || len(path) < 3 {
+		return
+	}
+	file := path[len(path)-1].(*ast.File)
+	m := r.migration(config, pkgInfo, file)
+	if m == nil {
+		return
+	}
+	var body ast.Node
+	for _, node := range path {
+		if fn, ok := node.(*ast.FuncDecl); ok {
+			body = fn
+			break
+		}
+		if fn, ok := node.(*ast.FuncLit); ok {
+			body = fn
+			break
+		}
+	}
+
+	parent := m.qualify("context", "context", "Background", ch.Pos()) + "()"
+	if scope := pkgInfo.Pkg.Scope().Innermost(ch.Pos()); scope != nil {
+		if _, obj := scope.LookupParent("ctx", ch.Pos()); obj != nil &&
+			isContext(obj.Type()) {
+			parent = "ctx"
+		} else if body != nil && usesName(body, "ctx") {
+			r.Log.Errorf("%s cannot be replaced by ctx, since that name is "+
+				"already used", ch.Name())
+			r.Log.AssociatePos(ch.Pos(), ch.Pos())
+			return
+		}
+	}
+	if body != nil && usesName(body, "cancel") {
+		r.Log.Errorf("%s cannot be replaced by a cancel function, since "+
+			"the name cancel is already used", ch.Name())
+		r.Log.AssociatePos(ch.Pos(), ch.Pos())
+		return
+	}
+	newDecl := fmt.Sprintf("ctx, cancel := %s(%s)",
+		m.qualify("context", "context", "WithCancel", ch.Pos()), parent)
+
+	// The declaration: ch := make(chan struct{}) or var ch = make(...)
+	switch decl := path[1].(type) {
+	case *ast.AssignStmt:
+		if decl.Tok != token.DEFINE || len(decl.Lhs) != 1 ||
+			!isMakeDoneChannel(pkgInfo, decl.Rhs[0]) {
+			r.logChannelDeclError(ch)
+			return
+		}
+		m.replace(decl.Pos(), decl.End(), newDecl)
+	case *ast.ValueSpec:
+		gen, ok := path[2].(*ast.GenDecl)
+		if !ok || len(gen.Specs) != 1 || len(decl.Names) != 1 ||
+			len(decl.Values) != 1 || !isMakeDoneChannel(pkgInfo, decl.Values[0]) {
+			r.logChannelDeclError(ch)
+			return
+		}
+		m.replace(gen.Pos(), gen.End(), newDecl)
+	default:
+		r.logChannelDeclError(ch)
+		return
+	}
+
+	closed := false
+	for _, ref := range r.referencesTo(ch) {
+		if isReceive(ref.id, ref.path) {
+			m.replace(ref.id.Pos(), ref.id.End(), "ctx.Done()")
+		} else if call := builtinCall(pkgInfo, "close", ref.id, ref.path); call != nil {
+			m.replace(call.Pos(), call.End(), "cancel()")
+			closed = true
+		} else if !r.isArgument(ref, fn, index) {
+			r.Log.Errorf("%s can only be received from, closed, or passed "+
+				"to %s", ch.Name(), fn.Name())
+			r.Log.AssociateNode(ref.id)
+		}
+	}
+	if !closed {
+		r.Log.Errorf("%s is never closed", ch.Name())
+		r.Log.AssociatePos(ch.Pos(), ch.Pos())
+	}
+}
+
+// logChannelDeclError logs an error indicating that the given variable is
+// not declared in a way that can be converted.
+func (r *DoneChannelToContext) logChannelDeclError(ch *types.Var) {
+	r.Log.Errorf("%s must be declared by itself and initialized with "+
+		"make(chan struct{})", ch.Name())
+	r.Log.AssociatePos(ch.Pos(), ch.Pos())
+}
+
+// isContext returns true if the given type is context.Context.
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+const doneChannelToContextDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert Done Channel to Context refactoring replaces a done channel
+  (a <tt>chan struct{}</tt> that is closed to signal cancellation) with a
+  <tt>context.Context</tt>.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a parameter or struct field whose type is
+    <tt>chan struct{}</tt> or <tt>&lt;-chan struct{}</tt>.</li>
+    <li>Activate the Convert Done Channel to Context refactoring.</li>
+  </ol>
+
+  <p>A parameter is replaced by a <tt>ctx context.Context</tt> parameter,
+  which becomes the first parameter, and receives from the channel (including
+  in <tt>select</tt> statements) become receives from <tt>ctx.Done()</tt>.  At
+  each call site, the argument must be <tt>nil</tt> (which becomes
+  <tt>context.Background()</tt>) or a local variable initialized with
+  <tt>make(chan struct{})</tt>.  Such a variable is replaced by the context and
+  cancel function returned by <tt>context.WithCancel</tt> (derived from a
+  <tt>ctx</tt> in scope, if there is one), and closing it becomes calling
+  <tt>cancel()</tt>.</p>
+
+  <p>A struct field is replaced by <tt>ctx</tt> and <tt>cancel</tt> fields.
+  Assigning <tt>make(chan struct{})</tt> to the field becomes assigning the
+  results of <tt>context.WithCancel</tt>, and closing it becomes calling
+  <tt>cancel()</tt>.</p>
+
+  <p>If the channel is used in any other way (e.g., sent to, or stored in
+  another variable), the refactoring fails.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of converting the
+  <tt>done</tt> parameter.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func worker(jobs &lt;-chan int, <span class="highlight">done</span> &lt;-chan struct{}) {
+    for {
+        select {
+        case j := &lt;-jobs:
+            process(j)
+        case &lt;-done:
+            return
+        }
+    }
+}
+
+func main() {
+    stop := make(chan struct{})
+    go worker(jobs, stop)
+    ...
+    close(stop)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func worker(ctx context.Context, jobs &lt;-chan int) {
+    for {
+        select {
+        case j := &lt;-jobs:
+            process(j)
+        case &lt;-ctx.Done():
+            return
+        }
+    }
+}
+
+func main() {
+    ctx, cancel := context.WithCancel(context.Background())
+    go worker(ctx, jobs)
+    ...
+    cancel()
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,355 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that generates examples from the code
+// blocks in a function's doc comment.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// GenerateExamples is a refactoring that converts the code blocks in the doc
+// comment of the selected function or method into runnable examples (i.e.,
+// ExampleXxx functions) in a _test.go file.
+//
+// A code block is either a fenced block (a span of lines between two lines
+// beginning with ```, optionally followed by "go") or an indented block, as in
+// gofmt'd doc comments.  Only code blocks consisting of Go statements are
+// converted; others (e.g., grammars and shell commands) are skipped.  The first
+// block becomes ExampleXxx, and subsequent blocks become ExampleXxx_block2,
+// ExampleXxx_block3, etc.
+//
+// If an example already exists, it is replaced, so running the refactoring
+// again after changing the doc comment brings the examples back in sync.
+type GenerateExamples struct {
+	RefactoringBase
+	// The selected function or method and its declaration
+	fn      *types.Func
+	decl    *ast.FuncDecl
+	pkgInfo *loader.PackageInfo
+	// The file the examples are added to
+	out *outputFile
+}
+
+func (r *GenerateExamples) Description() *Description {
+	return &Description{
+		Name:      "Generate Examples from Doc Comment",
+		Synopsis:  "Converts the code blocks in a function's doc comment into examples",
+		Usage:     "[<output_file>]",
+		Selection: "The name of a function or method",
+		HTMLDoc:   generateExamplesDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Output File:",
+			Prompt:       "File to add the examples to, relative to the directory containing the function (leave blank for the corresponding _test.go file).",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *GenerateExamples) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.findFunc() {
+		return &r.Result
+	}
+	output := ""
+	if len(config.Args) > 0 {
+		output = strings.TrimSpace(config.Args[0].(string))
+	}
+	output = r.testFilename(r.fn, output)
+	if r.out = r.outputFile(config, output, 0); r.out == nil {
+		return &r.Result
+	}
+
+	blocks := codeBlocks(r.decl.Doc.Text())
+	if len(blocks) == 0 {
+		r.Log.Errorf("The doc comment for %s does not contain any code "+
+			"blocks", r.fn.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	qualifier := r.out.qualifier()
+	var added bytes.Buffer
+	count, inSync, skipped := 0, 0, []int{}
+	for i, block := range blocks {
+		name := r.exampleName(count)
+		code, ok := r.exampleCode(name, block, qualifier)
+		if !ok {
+			skipped = append(skipped, i+1)
+			continue
+		}
+		count++
+		switch existing := r.out.funcDecl(name); {
+		case existing != nil && r.out.textOf(existing) == code:
+			inSync++
+		case existing != nil:
+			r.out.replaceDecl(existing, code)
+			r.Log.Infof("Updating %s", name)
+		case r.out.declares(name):
+			r.Log.Errorf("%s is already declared in %s, so code block %d "+
+				"cannot be converted into an example", name,
+				filepath.Base(r.out.filename), i+1)
+			r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+			return &r.Result
+		default:
+			if added.Len() > 0 {
+				added.WriteString("\n\n")
+			}
+			added.WriteString(code)
+			r.Log.Infof("Adding %s", name)
+		}
+	}
+	if count == 0 {
+		r.Log.Errorf("The doc comment for %s does not contain any code "+
+			"blocks consisting of Go statements", r.fn.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	for _, i := range skipped {
+		r.Log.Infof("Skipping code block %d, which does not consist of Go "+
+			"statements", i)
+	}
+	if inSync == count {
+		r.Log.Infof("The examples in %s are already in sync with the doc "+
+			"comment", filepath.Base(r.out.filename))
+	} else {
+		r.out.add(config, added.String())
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findFunc finds the function or method whose name is selected and its
+// declaration, returning false (after logging an error) if there is none or
+// if it does not have a doc comment.
+func (r *GenerateExamples) findFunc() bool {
+	r.fn, r.decl, r.pkgInfo = nil, nil, nil
+	if id, ok := r.SelectedNode.(*ast.Ident); ok && r.SelectedNodePkg != nil {
+		r.fn, _ = r.SelectedNodePkg.ObjectOf(id).(*types.Func)
+	}
+	if r.fn != nil {
+		r.fn = r.fn.Origin()
+		r.pkgInfo = r.Program.AllPackages[r.fn.Pkg()]
+	}
+	if r.pkgInfo != nil {
+		if file := fileContaining(r.pkgInfo, r.fn.Pos()); file != nil {
+			for _, decl := range file.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok &&
+					decl.Name.Pos() == r.fn.Pos() {
+					r.decl = decl
+				}
+			}
+		}
+	}
+	if r.decl == nil {
+		r.Log.Error("Please select the name of a function or method.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if r.decl.Doc == nil {
+		r.Log.Errorf("%s does not have a doc comment", r.fn.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// exampleName returns the name of the example for the code block with the
+// given index (counting only blocks that are converted), e.g., ExampleParse,
+// ExampleParse_block2, or (for a method) ExampleParser_Parse.
+func (r *GenerateExamples) exampleName(index int) string {
+	name := "Example" + r.fn.Name()
+	if recv := r.fn.Type().(*types.Signature).Recv(); recv != nil {
+		t := recv.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		if named, ok := types.Unalias(t).(*types.Named); ok {
+			name = "Example" + named.Obj().Name() + "_" + r.fn.Name()
+		}
+	}
+	if index > 0 {
+		name += fmt.Sprintf("_block%d", index+1)
+	}
+	return name
+}
+
+// exampleCode returns the declaration of an example with the given name whose
+// body is the given code block, formatted with gofmt, or false if the block
+// does not consist of Go statements.  Packages that the block refers to are
+// imported (see qualifier) if the file declaring the function imports them.
+func (r *GenerateExamples) exampleCode(name, block string, qualifier types.Qualifier) (string, bool) {
+	const header = "package p\n\n"
+	src := header + "func " + name + "() {\n" + block + "\n}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil || len(file.Decls) != 1 {
+		return "", false
+	}
+
+	unresolved := map[*ast.Ident]bool{}
+	for _, id := range file.Unresolved {
+		unresolved[id] = true
+	}
+	imported := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && unresolved[id] &&
+			!imported[id.Name] {
+			imported[id.Name] = true
+			if pkg := r.importedPackage(id.Name); pkg != nil {
+				if q := qualifier(pkg); q != id.Name {
+					r.Log.Warnf("%s is imported as %s, so references to "+
+						"it in the examples must be updated", pkg.Path(), q)
+				}
+			}
+		}
+		return true
+	})
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(formatted[len(header):])), true
+}
+
+// importedPackage returns the package with the given name that is imported by
+// the file declaring the function (or the function's own package, if the
+// examples are in another package, e.g., an external test package), or nil if
+// there is none.
+func (r *GenerateExamples) importedPackage(name string) *types.Package {
+	pkg := r.fn.Pkg()
+	if name == pkg.Name() {
+		if r.out.pkg != nil && r.out.pkg.Path() == pkg.Path() {
+			return nil
+		}
+		return pkg
+	}
+	file := fileContaining(r.pkgInfo, r.fn.Pos())
+	for _, spec := range file.Imports {
+		pkgName := importedPkgName(r.pkgInfo, spec)
+		if pkgName != nil && pkgName.Name() == name {
+			return pkgName.Imported()
+		}
+	}
+	return nil
+}
+
+// codeBlocks returns the code blocks in the given doc comment text (with the
+// comment markers removed): spans of lines between ``` fences (if the fence
+// does not name a language other than Go) and spans of indented lines.
+func codeBlocks(doc string) []string {
+	blocks := []string{}
+	lines := strings.Split(doc, "\n")
+	isIndented := func(line string) bool {
+		return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+	}
+	for i := 0; i < len(lines); i++ {
+		fence := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(fence, "```") {
+			lang := strings.TrimSpace(strings.TrimLeft(fence, "`"))
+			end := i + 1
+			for end < len(lines) &&
+				!strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+				end++
+			}
+			if lang == "" || lang == "go" {
+				blocks = append(blocks, strings.Join(lines[i+1:end], "\n"))
+			}
+			i = end
+		} else if isIndented(lines[i]) {
+			end := i
+			for end < len(lines) && (isIndented(lines[end]) ||
+				strings.TrimSpace(lines[end]) == "") {
+				end++
+			}
+			// Trailing blank lines are not part of the block
+			last := end - 1
+			for strings.TrimSpace(lines[last]) == "" {
+				last--
+			}
+			blocks = append(blocks, strings.Join(lines[i:last+1], "\n"))
+			i = last
+		}
+	}
+	return blocks
+}
+
+const generateExamplesDoc = `
+  <h4>Purpose</h4>
+  <p>The Generate Examples from Doc Comment refactoring converts the code
+  blocks in a function's doc comment into runnable examples, i.e.,
+  <tt>Example</tt> functions in a <tt>_test.go</tt> file.  Running it again
+  after the doc comment changes updates the examples, keeping the
+  documentation and the examples in sync.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a function or method (in its declaration or in a
+    call).</li>
+    <li>Activate the Generate Examples from Doc Comment refactoring.</li>
+    <li>Optionally, enter the name of the file to add the examples to,
+    relative to the directory containing the function.  By default, it is the
+    <tt>_test.go</tt> file corresponding to the file declaring the function
+    (e.g., <tt>parse_test.go</tt> for <tt>parse.go</tt>).  The file is created
+    if it does not exist.</li>
+  </ol>
+
+  <p>A code block is either a fenced block (lines between two
+  <tt>&#96;&#96;&#96;</tt> lines) or an indented block.  Only code blocks consisting of Go
+  statements are converted; others are skipped.  The first block becomes
+  <tt>Example</tt> followed by the function's name (or, for a method, the
+  receiver type's name, an underscore, and the method's name), and subsequent
+  blocks are given the suffixes <tt>_block2</tt>, <tt>_block3</tt>, etc.
+  Existing examples with these names are replaced.  An <tt>// Output:</tt>
+  comment in a code block is retained, so the example's output is
+  checked by <tt>go test</tt>.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of generating examples for
+  <tt>Reverse</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>// Reverse reverses a string:
+//
+//     fmt.Println(Reverse("abc"))
+//     // Output: cba
+func Reverse(s string) string {
+    ...
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func ExampleReverse() {
+    fmt.Println(Reverse("abc"))
+    // Output: cba
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
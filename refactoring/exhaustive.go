@@ -0,0 +1,331 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that adds the missing cases to a switch
+// over an enumerated type or a type switch over an interface.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// CompleteSwitch is a refactoring that adds a case clause for each value or
+// type that a switch statement does not handle, so the switch is exhaustive.
+//
+// For an expression switch, the tag must have a named type with an
+// underlying basic type, and the constants of that type declared in the same
+// package are considered its values (as in an enumeration declared with
+// iota).  For a type switch, the types that implement the interface being
+// switched on are found among the package-level types in the program
+// (outside $GOROOT).  Each new case panics, to mark it as unimplemented.
+type CompleteSwitch struct {
+	RefactoringBase
+	// The selected switch statement, and its body
+	stmt ast.Stmt
+	body *ast.BlockStmt
+	// The default clause of the switch, or nil
+	defaultCase *ast.CaseClause
+}
+
+func (r *CompleteSwitch) Description() *Description {
+	return &Description{
+		Name:           "Complete Switch",
+		Synopsis:       "Adds the missing cases to a switch over an enumerated type or an interface",
+		Usage:          "",
+		Selection:      "A switch or type switch statement",
+		HTMLDoc:        completeSwitchDoc,
+		Multifile:      false,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *CompleteSwitch) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.findSwitch() {
+		return &r.Result
+	}
+	m := r.newFileMigration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, r.stmt.Pos()))
+	if m == nil {
+		return &r.Result
+	}
+
+	var cases []string
+	switch stmt := r.stmt.(type) {
+	case *ast.SwitchStmt:
+		cases = r.missingValues(m, stmt)
+	case *ast.TypeSwitchStmt:
+		cases = r.missingTypes(m, stmt)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if len(cases) == 0 {
+		r.Log.Error("The switch statement already handles every case")
+		r.Log.AssociateNode(r.stmt)
+		return &r.Result
+	}
+	r.Log.Infof("Adding %d case(s) to the switch statement", len(cases))
+
+	indent := Indentation(m.src, m.offset(r.stmt.Pos()))
+	inner := indent + DetectIndentStyle(m.src).Unit
+	var b strings.Builder
+	for _, c := range cases {
+		fmt.Fprintf(&b, "case %s:\n%spanic(%q)\n%s", c, inner,
+			"TODO: handle "+c, indent)
+	}
+	pos := r.body.Rbrace
+	if r.defaultCase != nil {
+		// Keep the default clause last
+		pos = r.defaultCase.Pos()
+	} else if r.line(r.body.Lbrace) == r.line(r.body.Rbrace) {
+		m.replace(r.body.Lbrace+1, r.body.Rbrace, "\n"+indent)
+	}
+	m.replace(pos, pos, b.String())
+
+	m.finish()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findSwitch finds the innermost switch or type switch statement enclosing
+// the selection, returning false (after logging an error) if there is none.
+func (r *CompleteSwitch) findSwitch() bool {
+	r.stmt, r.body, r.defaultCase = nil, nil, nil
+	for _, node := range r.PathEnclosingSelection {
+		if r.stmt != nil {
+			break
+		}
+		switch node := node.(type) {
+		case *ast.SwitchStmt:
+			r.stmt, r.body = node, node.Body
+		case *ast.TypeSwitchStmt:
+			r.stmt, r.body = node, node.Body
+		}
+	}
+	if r.stmt == nil {
+		r.Log.Error("Please select a switch or type switch statement.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	for _, stmt := range r.body.List {
+		if clause := stmt.(*ast.CaseClause); clause.List == nil {
+			r.defaultCase = clause
+		}
+	}
+	return true
+}
+
+// missingValues returns the names of the constants of the switch tag's type
+// whose values are not handled by a case of the given switch, logging an
+// error if the tag does not have an enumerated type.
+func (r *CompleteSwitch) missingValues(m *fileMigration, stmt *ast.SwitchStmt) []string {
+	var named *types.Named
+	if stmt.Tag != nil {
+		named, _ = types.Unalias(r.SelectedNodePkg.TypeOf(stmt.Tag)).(*types.Named)
+	}
+	if named == nil {
+		r.Log.Error("The switch must have a tag whose type is a named " +
+			"type with constants (e.g., an enumeration declared with iota)")
+		r.Log.AssociateNode(stmt)
+		return nil
+	}
+	pkg := named.Obj().Pkg()
+	consts := []*types.Const{}
+	if _, ok := named.Underlying().(*types.Basic); ok && pkg != nil {
+		for _, name := range pkg.Scope().Names() {
+			if c, ok := pkg.Scope().Lookup(name).(*types.Const); ok &&
+				types.Identical(c.Type(), named) {
+				consts = append(consts, c)
+			}
+		}
+	}
+	if len(consts) == 0 {
+		r.Log.Errorf("%s is not an enumerated type: no constants of type "+
+			"%s are declared in package %s", named.Obj().Name(),
+			named.Obj().Name(), pkg.Name())
+		r.Log.AssociateNode(stmt.Tag)
+		return nil
+	}
+	sort.Slice(consts, func(i, j int) bool {
+		return consts[i].Pos() < consts[j].Pos()
+	})
+
+	handled := map[string]bool{}
+	for _, clause := range r.body.List {
+		for _, expr := range clause.(*ast.CaseClause).List {
+			if tv, ok := r.SelectedNodePkg.Types[expr]; ok && tv.Value != nil {
+				handled[tv.Value.ExactString()] = true
+			}
+		}
+	}
+	result := []string{}
+	for _, c := range consts {
+		value := c.Val().ExactString()
+		if handled[value] {
+			continue
+		}
+		// Constants with the same value (e.g., aliases) are only
+		// handled once, since duplicate cases are not allowed
+		handled[value] = true
+		if pkg != r.SelectedNodePkg.Pkg && !c.Exported() {
+			r.Log.Warnf("%s is not handled, but it is not exported "+
+				"from package %s", c.Name(), pkg.Name())
+			r.Log.AssociateNode(stmt)
+			continue
+		}
+		result = append(result,
+			m.qualify(pkg.Path(), pkg.Name(), c.Name(), stmt.Pos()))
+	}
+	return result
+}
+
+// missingTypes returns the names of the types that implement the interface
+// being switched on but are not handled by a case of the given type switch,
+// logging an error if the value being switched on is not an interface.
+func (r *CompleteSwitch) missingTypes(m *fileMigration, stmt *ast.TypeSwitchStmt) []string {
+	var assert *ast.TypeAssertExpr
+	switch s := stmt.Assign.(type) {
+	case *ast.AssignStmt:
+		assert = s.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		assert = s.X.(*ast.TypeAssertExpr)
+	}
+	it, _ := r.SelectedNodePkg.TypeOf(assert.X).Underlying().(*types.Interface)
+	if it == nil || it.Empty() {
+		r.Log.Errorf("The type of %s must be a non-empty interface, so "+
+			"the types that implement it can be determined",
+			types.ExprString(assert.X))
+		r.Log.AssociateNode(assert.X)
+		return nil
+	}
+
+	caseTypes := []types.Type{}
+	for _, clause := range r.body.List {
+		for _, expr := range clause.(*ast.CaseClause).List {
+			if t := r.SelectedNodePkg.TypeOf(expr); t != nil &&
+				t != types.Typ[types.UntypedNil] {
+				caseTypes = append(caseTypes, t)
+			}
+		}
+	}
+	result := []string{}
+	for _, t := range r.implementers(it) {
+		if handlesType(caseTypes, t) {
+			continue
+		}
+		named, _ := t.(*types.Named)
+		if ptr, ok := t.(*types.Pointer); ok {
+			named = ptr.Elem().(*types.Named)
+		}
+		obj := named.Obj()
+		if obj.Pkg() != r.SelectedNodePkg.Pkg && !obj.Exported() {
+			r.Log.Warnf("%s is not handled, but it is not exported "+
+				"from package %s", obj.Name(), obj.Pkg().Name())
+			r.Log.AssociateNode(stmt)
+			continue
+		}
+		result = append(result,
+			types.TypeString(t, m.imports.Qualifier(stmt.Pos())))
+	}
+	return result
+}
+
+// handlesType returns true if a case listing one of the given types would
+// handle a value with the given dynamic type.
+func handlesType(caseTypes []types.Type, t types.Type) bool {
+	for _, caseType := range caseTypes {
+		if types.Identical(caseType, t) {
+			return true
+		}
+		if it, ok := caseType.Underlying().(*types.Interface); ok &&
+			types.Implements(t, it) {
+			return true
+		}
+	}
+	return false
+}
+
+const completeSwitchDoc = `
+  <h4>Purpose</h4>
+  <p>The Complete Switch refactoring adds a case to a switch statement for
+  each value or type that it does not handle, so the switch is
+  exhaustive.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a switch statement or type switch statement (or any code
+    inside it).</li>
+    <li>Activate the Complete Switch refactoring.</li>
+  </ol>
+
+  <p>For a switch statement, the tag must have a named type, such as an
+  enumeration declared with <tt>iota</tt>; the constants of that type declared
+  in the same package are its possible values.  For a type switch, the value
+  switched on must be an interface; the package-level types in the program
+  (outside $GOROOT) that implement it are the possible types.  A case is added
+  for each value or type that is not handled, before the default case (if
+  any).  Each new case panics, to mark it as unimplemented.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of completing the switch
+  statement in <tt>name</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type Color int
+
+const (
+    Red Color = iota
+    Green
+    Blue
+)
+
+func name(c Color) string {
+    switch c {
+    case Red:
+        return "red"
+    default:
+        return "unknown"
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Color int
+
+const (
+    Red Color = iota
+    Green
+    Blue
+)
+
+func name(c Color) string {
+    switch c {
+    case Red:
+        return "red"
+    case Green:
+        panic("TODO: handle Green")
+    case Blue:
+        panic("TODO: handle Blue")
+    default:
+        return "unknown"
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
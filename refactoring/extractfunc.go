@@ -589,6 +589,10 @@ type ExtractFunc struct {
 	RefactoringBase
 	funcName  string     // name of the extracted function
 	stmtRange *stmtRange // selected statements (to be extracted)
+	// Whether constant-valued variables are passed as arguments rather
+	// than redeclared in the extracted function (which leaves them unused
+	// if the selection was their only use)
+	passConstants bool
 }
 
 func (r *ExtractFunc) Description() *Description {
@@ -596,6 +600,7 @@ func (r *ExtractFunc) Description() *Description {
 		Name:      "Extract Function",
 		Synopsis:  "Extracts statements to a new function/method",
 		Usage:     "<new_name>",
+		Selection: "A sequence of statements",
 		HTMLDoc:   extractFuncDoc,
 		Multifile: false,
 		Params: []Parameter{{
@@ -617,6 +622,7 @@ func (r *ExtractFunc) Run(config *Config) *Result {
 	if !isIdentifierValid(r.funcName) {
 		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
 			r.funcName)
+		r.Log.AssociateArg(0)
 		return &r.Result
 	}
 
@@ -680,7 +686,8 @@ func (r *ExtractFunc) Run(config *Config) *Result {
 // addEdits updates r.Edits, adding edits to insert a new function declaration
 // and replace the selected statements with a call to that function.
 func (r *ExtractFunc) addEdits() {
-	funcDecl, funcCall := r.createExtractedFunc().SourceCode()
+	imports := r.ImportResolver()
+	funcDecl, funcCall := r.createExtractedFunc(imports).SourceCode()
 
 	// Replace the selected statements with a function call
 	offset := r.Program.Fset.Position(r.stmtRange.Pos()).Offset
@@ -691,12 +698,20 @@ func (r *ExtractFunc) addEdits() {
 
 	// Insert the new function declaration
 	r.Edits[r.Filename].Add(&text.Extent{next, 0}, funcDecl)
+
+	// Import any packages needed by the new function's signature
+	if err := imports.AddEdits(r.Edits[r.Filename]); err != nil {
+		r.Log.Error(err)
+	}
 }
 
 // createExtractedFunc returns an extractedFunc, which contains information
 // about the extracted function and how it should be called.  Source code can
-// be obtained from the extractedFunc object.
-func (r *ExtractFunc) createExtractedFunc() *extractedFunc {
+// be obtained from the extractedFunc object.  Types from other packages are
+// qualified as they must be in the new function's declaration, which is
+// inserted after the enclosing function; imports is updated with any imports
+// this requires.
+func (r *ExtractFunc) createExtractedFunc(imports *ImportResolver) *extractedFunc {
 	recv, params, returns, locals, localInits, declareResult := r.analyzeVars()
 
 	startOffset := r.Program.Fset.Position(r.stmtRange.Pos()).Offset
@@ -712,23 +727,7 @@ func (r *ExtractFunc) createExtractedFunc() *extractedFunc {
 		localInits: localInits,
 		define:     declareResult,
 		code:       code,
-		pkgFmt:     pkgUseFmt(r.SelectedNodePkg.Pkg),
-	}
-}
-
-// pkgUseFmt returns a types.Qualifier similar to types.RelativeTo,
-// but instead of returning full paths, it returns only the package's base
-// name, i.e. 'github.com/some/pkg' -> 'pkg'. The current package's name
-// is also omitted (since it would be a circular dependency on itself).
-func pkgUseFmt(pkg *types.Package) types.Qualifier {
-	if pkg == nil {
-		return nil // wat
-	}
-	return func(other *types.Package) string {
-		if pkg == other {
-			return "" // same package; unqualified
-		}
-		return other.Name()
+		pkgFmt:     imports.Qualifier(r.stmtRange.enclosingFunc.End()),
 	}
 }
 
@@ -784,7 +783,10 @@ func (r *ExtractFunc) analyzeVars() (recv *types.Var,
 	// If an argument always has a constant value, there is no reason to
 	// pass it as an argument.  Instead, make it a local variable, and
 	// set it equal to its constant value.
-	constants := r.constantValues(params)
+	constants := map[*types.Var]ast.Expr{}
+	if !r.passConstants {
+		constants = r.constantValues(params)
+	}
 	for param := range constants {
 		params = difference(params, []*types.Var{param})
 		locals = append(locals, param)
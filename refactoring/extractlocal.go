@@ -26,6 +26,7 @@ func (r *ExtractLocal) Description() *Description {
 		Name:      "Extract Local Variable",
 		Synopsis:  "Extracts an expression, assigning it to a variable",
 		Usage:     "<new_name>",
+		Selection: "An expression",
 		HTMLDoc:   extractLocalDoc,
 		Multifile: false,
 		Params: []Parameter{{
@@ -49,6 +50,7 @@ func (r *ExtractLocal) Run(config *Config) *Result {
 	if !isIdentifierValid(r.varName) {
 		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
 			r.varName)
+		r.Log.AssociateArg(0)
 		return &r.Result
 	}
 
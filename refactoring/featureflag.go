@@ -0,0 +1,474 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that wraps a sequence of statements in an
+// if statement that tests a feature flag.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// featureFlagFunc is the name of the function that determines whether a
+// feature flag is enabled.  It must have the signature func(string) bool.
+const featureFlagFunc = "featureFlag"
+
+// WrapInFeatureFlag is a refactoring that wraps the selected statements in
+//     if featureFlag("name") {
+//             ...
+//     }
+// so they can be enabled and disabled incrementally.
+//
+// Variables declared by the statements that are used after them are declared
+// before the if statement instead, so they remain in scope (a short variable
+// declaration becomes an assignment).  Likewise, constant and type
+// declarations used after the statements are moved before the if statement.
+// If the package does not declare featureFlag, a stub that always returns
+// true is added, so the behavior of the program does not change.
+type WrapInFeatureFlag struct {
+	RefactoringBase
+	m *fileMigration
+	// The selected statements and the function containing them
+	stmts []ast.Stmt
+	body  *ast.BlockStmt
+	// Declarations to insert before the if statement
+	hoisted []string
+	// Edits to the selected statements
+	edits []regionEdit
+	// Objects declared by the selected statements that are moved before
+	// the if statement
+	moved map[types.Object]bool
+	// True if featureFlag is not declared, so a stub must be added
+	addStub bool
+}
+
+// A regionEdit replaces the text from start to end in the selected statements.
+type regionEdit struct {
+	start, end  token.Pos
+	replacement string
+}
+
+// applyEdits returns the given code, which begins at the given position, with
+// the given edits applied.
+func applyEdits(code string, start token.Pos, edits []regionEdit) string {
+	edits = append([]regionEdit{}, edits...)
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, e := range edits {
+		from, to := int(e.start-start), int(e.end-start)
+		code = code[:from] + e.replacement + code[to:]
+	}
+	return code
+}
+
+func (r *WrapInFeatureFlag) Description() *Description {
+	return &Description{
+		Name:      "Wrap in Feature Flag",
+		Synopsis:  "Wraps statements in an if statement that tests a feature flag",
+		Usage:     "<flag>",
+		Selection: "A sequence of statements",
+		HTMLDoc:   wrapInFeatureFlagDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Flag Name:",
+			Prompt:       "Name of the feature flag.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *WrapInFeatureFlag) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	flag := strings.TrimSpace(config.Args[0].(string))
+	if flag == "" {
+		r.Log.Error("Please enter the name of the feature flag")
+		r.Log.AssociateArg(0)
+		return &r.Result
+	}
+	r.hoisted, r.edits, r.addStub = nil, nil, false
+	r.moved = map[types.Object]bool{}
+
+	rng, err := newStmtRange(r.File, r.SelectionStart, r.SelectionEnd, r.SelectedNodePkg)
+	if err != nil {
+		r.Log.Error(err)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	r.stmts, r.body = rng.selectedStmts(), rng.enclosingFunc.Body
+	start, end := r.stmts[0].Pos(), r.stmts[len(r.stmts)-1].End()
+
+	r.m = r.newFileMigration(config, r.SelectedNodePkg, r.File)
+	if r.m == nil {
+		return &r.Result
+	}
+	if !r.checkJumps() || !r.checkFlagFunc(start) {
+		return &r.Result
+	}
+	for _, stmt := range r.stmts {
+		if !r.hoist(stmt, start) {
+			return &r.Result
+		}
+	}
+	if !r.checkShadowing() {
+		return &r.Result
+	}
+
+	// Include a comment at the end of the last statement
+	for _, cg := range r.File.Comments {
+		if cg.Pos() >= end && r.line(cg.Pos()) == r.line(end) {
+			end = maxPos(end, cg.End())
+		}
+	}
+	indent := Indentation(r.m.src, r.m.offset(start))
+	inner := indent + DetectIndentStyle(r.m.src).Unit
+	var b strings.Builder
+	for _, decl := range r.hoisted {
+		b.WriteString(shiftIndentation(decl, indent, indent) + "\n" + indent)
+	}
+	b.WriteString("if " + featureFlagFunc + "(" + strconv.Quote(flag) + ") {\n")
+	b.WriteString(inner + shiftIndentation(r.regionText(start, end), indent, inner))
+	b.WriteString("\n" + indent + "}")
+	r.m.replace(start, end, b.String())
+
+	if r.addStub {
+		r.Log.Infof("%s is not declared, so a stub that always returns "+
+			"true was added", featureFlagFunc)
+		r.m.replace(r.File.End(), r.File.End(), "\n\n"+
+			"// "+featureFlagFunc+" returns true if the feature with "+
+			"the given name is enabled.\n"+
+			"// TODO: Look up the flag in the program's configuration.\n"+
+			"func "+featureFlagFunc+"(name string) bool {\n"+
+			DetectIndentStyle(r.m.src).Unit+"return true\n"+
+			"}")
+	}
+	r.m.finish()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// checkJumps returns false (after logging an error) if the selected
+// statements contain a label or a fallthrough statement, which cannot be
+// moved into a block.
+func (r *WrapInFeatureFlag) checkJumps() bool {
+	for _, stmt := range r.stmts {
+		if br, ok := stmt.(*ast.BranchStmt); ok && br.Tok == token.FALLTHROUGH {
+			r.Log.Error("A fallthrough statement cannot be wrapped in " +
+				"an if statement")
+			r.Log.AssociateNode(br)
+			return false
+		}
+		var label *ast.LabeledStmt
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if l, ok := n.(*ast.LabeledStmt); ok && label == nil {
+				label = l
+			}
+			return label == nil
+		})
+		if label != nil {
+			r.Log.Error("Statements containing a label cannot be " +
+				"wrapped in an if statement")
+			r.Log.AssociateNode(label)
+			return false
+		}
+	}
+	return true
+}
+
+// checkFlagFunc returns false (after logging an error) if featureFlag is
+// declared at the given position but is not a func(string) bool.  If it is
+// not declared, a stub must be added.
+func (r *WrapInFeatureFlag) checkFlagFunc(pos token.Pos) bool {
+	scope := r.SelectedNodePkg.Pkg.Scope().Innermost(pos)
+	if scope == nil {
+		scope = r.SelectedNodePkg.Pkg.Scope()
+	}
+	_, obj := scope.LookupParent(featureFlagFunc, pos)
+	if obj == nil {
+		r.addStub = true
+		return true
+	}
+	want := types.NewSignatureType(nil, nil, nil,
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", types.Typ[types.String])),
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", types.Typ[types.Bool])),
+		false)
+	if _, isType := obj.(*types.TypeName); isType ||
+		!types.Identical(obj.Type().Underlying(), want) {
+		r.Log.Errorf("%s must be a func(string) bool", featureFlagFunc)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+	return true
+}
+
+// hoist determines whether the given selected statement declares anything
+// that is used after the selected statements and, if so, records how to move
+// the declaration before the if statement, which begins at the given
+// position.  It returns false (after logging an error) if the declaration
+// cannot be moved.
+func (r *WrapInFeatureFlag) hoist(stmt ast.Stmt, pos token.Pos) bool {
+	qualifier := r.m.imports.Qualifier(pos)
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmt.Tok != token.DEFINE {
+			return true
+		}
+		vars := []types.Object{}
+		used := false
+		for _, lhs := range stmt.Lhs {
+			if obj := r.SelectedNodePkg.Defs[lhs.(*ast.Ident)]; obj != nil &&
+				obj.Name() != "_" {
+				vars = append(vars, obj)
+				used = used || r.usedAfter(obj)
+			}
+		}
+		if !used {
+			return true
+		}
+		// x, y := f()  =>  var x T; var y U ... x, y = f()
+		for _, obj := range vars {
+			r.moved[obj] = true
+			r.hoisted = append(r.hoisted, "var "+obj.Name()+" "+
+				types.TypeString(obj.Type(), qualifier))
+		}
+		r.edits = append(r.edits, regionEdit{stmt.TokPos,
+			stmt.TokPos + token.Pos(len(token.DEFINE.String())), "="})
+
+	case *ast.DeclStmt:
+		decl := stmt.Decl.(*ast.GenDecl)
+		used := false
+		hasValues := false
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					if obj := r.SelectedNodePkg.Defs[name]; obj != nil {
+						used = used || r.usedAfter(obj)
+					}
+				}
+				hasValues = hasValues || len(spec.Values) > 0
+			case *ast.TypeSpec:
+				obj := r.SelectedNodePkg.Defs[spec.Name]
+				used = used || r.usedAfter(obj)
+			}
+		}
+		if !used {
+			return true
+		}
+		if decl.Tok == token.VAR && hasValues {
+			return r.hoistVar(stmt, decl, qualifier)
+		}
+		// Declarations without initial values are moved as is
+		if r.usesSelection(decl) {
+			r.Log.Error("The declaration is used after the selected " +
+				"statements but refers to declarations in them, so it " +
+				"cannot be moved")
+			r.Log.AssociateNode(decl)
+			return false
+		}
+		for _, spec := range decl.Specs {
+			for _, id := range specNames(spec) {
+				r.moved[r.SelectedNodePkg.Defs[id]] = true
+			}
+		}
+		r.hoisted = append(r.hoisted, r.m.textOf(decl))
+		r.edits = append(r.edits, regionEdit{stmt.Pos(), stmt.End(), ""})
+	}
+	return true
+}
+
+// hoistVar records how to move a var declaration with initial values before
+// the if statement, replacing it with an assignment, returning false (after
+// logging an error) if it declares more than one group of variables.
+func (r *WrapInFeatureFlag) hoistVar(stmt *ast.DeclStmt, decl *ast.GenDecl, qualifier types.Qualifier) bool {
+	if len(decl.Specs) != 1 {
+		r.Log.Error("The variables are used after the selected " +
+			"statements, but they cannot be moved because the " +
+			"declaration contains more than one group of variables")
+		r.Log.AssociateNode(decl)
+		return false
+	}
+	// var x, y T = a, b  =>  var x, y T ... x, y = a, b
+	spec := decl.Specs[0].(*ast.ValueSpec)
+	names := []string{}
+	for _, name := range spec.Names {
+		names = append(names, name.Name)
+		obj := r.SelectedNodePkg.Defs[name]
+		r.moved[obj] = true
+		if spec.Type == nil && obj != nil && obj.Name() != "_" {
+			r.hoisted = append(r.hoisted, "var "+name.Name+" "+
+				types.TypeString(obj.Type(), qualifier))
+		}
+	}
+	if spec.Type != nil {
+		r.hoisted = append(r.hoisted, "var "+strings.Join(names, ", ")+
+			" "+r.m.textOf(spec.Type))
+	}
+	r.edits = append(r.edits, regionEdit{stmt.Pos(), spec.Values[0].Pos(),
+		strings.Join(names, ", ") + " = "})
+	return true
+}
+
+// specNames returns the names declared by the given spec.
+func specNames(spec ast.Spec) []*ast.Ident {
+	switch spec := spec.(type) {
+	case *ast.ValueSpec:
+		return spec.Names
+	case *ast.TypeSpec:
+		return []*ast.Ident{spec.Name}
+	}
+	return nil
+}
+
+// usedAfter returns true if the given object is used after the selected
+// statements.
+func (r *WrapInFeatureFlag) usedAfter(obj types.Object) bool {
+	end := r.stmts[len(r.stmts)-1].End()
+	found := false
+	ast.Inspect(r.body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Pos() >= end &&
+			r.SelectedNodePkg.Uses[id] == obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// usesSelection returns true if the given node refers to an object declared
+// in the selected statements.
+func (r *WrapInFeatureFlag) usesSelection(node ast.Node) bool {
+	start, end := r.stmts[0].Pos(), r.stmts[len(r.stmts)-1].End()
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := r.SelectedNodePkg.Uses[id]; obj != nil &&
+				start <= obj.Pos() && obj.Pos() < end {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// checkShadowing returns false (after logging an error) if a declaration
+// moved before the if statement would change the meaning of a reference in
+// the selected statements, i.e., a statement before the declaration refers to
+// a different object with the same name.
+func (r *WrapInFeatureFlag) checkShadowing() bool {
+	for obj := range r.moved {
+		if obj == nil {
+			continue
+		}
+		for _, stmt := range r.stmts {
+			var conflict *ast.Ident
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && id.Name == obj.Name() &&
+					id.Pos() < obj.Pos() && conflict == nil {
+					if use := r.SelectedNodePkg.Uses[id]; use != nil &&
+						use != obj {
+						conflict = id
+					}
+				}
+				return conflict == nil
+			})
+			if conflict != nil {
+				r.Log.Errorf("The declaration of %s cannot be moved "+
+					"before the if statement, since it would change "+
+					"the meaning of this reference", obj.Name())
+				r.Log.AssociateNode(conflict)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// regionText returns the source code from start to end with the edits to the
+// selected statements applied.  A statement that is removed is deleted along
+// with the line break before it.
+func (r *WrapInFeatureFlag) regionText(start, end token.Pos) string {
+	sort.Slice(r.edits, func(i, j int) bool {
+		return r.edits[i].start > r.edits[j].start
+	})
+	code := r.m.text(start, end)
+	for _, e := range r.edits {
+		from, to := int(e.start-start), int(e.end-start)
+		if e.replacement == "" {
+			if i := strings.LastIndex(code[:from], "\n"); i >= 0 {
+				from = i
+			} else if j := strings.Index(code[to:], "\n"); j >= 0 {
+				to += j + 1
+				for to < len(code) && (code[to] == ' ' || code[to] == '\t') {
+					to++
+				}
+			}
+		}
+		code = code[:from] + e.replacement + code[to:]
+	}
+	return code
+}
+
+const wrapInFeatureFlagDoc = `
+  <h4>Purpose</h4>
+  <p>The Wrap in Feature Flag refactoring wraps a sequence of statements in an
+  if statement that tests a feature flag, so the code can be enabled and
+  disabled incrementally (e.g., during a gradual rollout).</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a sequence of statements inside a function.</li>
+    <li>Activate the Wrap in Feature Flag refactoring.</li>
+    <li>Enter the name of the feature flag.</li>
+  </ol>
+
+  <p>The statements are wrapped in <tt>if featureFlag("<i>name</i>") { ...
+  }</tt>.  If the package does not declare a <tt>featureFlag</tt> function, a
+  stub that always returns true is added to the file.  Variables declared by
+  the statements that are used after them are declared before the if
+  statement instead, and their short variable declarations become
+  assignments; constant and type declarations that are used after the
+  statements are moved before the if statement.  Note that if the flag is
+  disabled, these variables will retain their zero values.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of wrapping the first two
+  statements of <tt>greet</tt> in the <tt>fancy-greeting</tt> flag.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func greet(name string) {
+    fmt.Println("Welcome!")
+    msg := "Hello, " + name
+    fmt.Println(msg)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func greet(name string) {
+    var msg string
+    if featureFlag("fancy-greeting") {
+        fmt.Println("Welcome!")
+        msg = "Hello, " + name
+    }
+    fmt.Println(msg)
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
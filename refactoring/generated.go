@@ -0,0 +1,129 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file detects generated files and determines what happens when a
+// refactoring would modify them.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A GeneratedFilePolicy determines what happens when a refactoring would
+// modify a generated file, i.e., a file containing a comment of the form
+//     // Code generated ... DO NOT EDIT.
+// before its package clause.  (This is the convention described in
+// https://golang.org/s/generatedcode.)
+type GeneratedFilePolicy int
+
+const (
+	// EditGeneratedFiles modifies generated files like any other file.
+	EditGeneratedFiles GeneratedFilePolicy = iota
+	// SkipGeneratedFiles discards the edits to generated files and logs a
+	// warning for each file that was skipped.
+	SkipGeneratedFiles
+	// FailOnGeneratedFiles logs an error for each generated file that would
+	// be modified and discards all of the refactoring's changes.
+	FailOnGeneratedFiles
+)
+
+var generatedFilePolicyNames = []string{"edit", "skip", "fail"}
+
+func (p GeneratedFilePolicy) String() string {
+	if p < 0 || int(p) >= len(generatedFilePolicyNames) {
+		return fmt.Sprintf("GeneratedFilePolicy(%d)", int(p))
+	}
+	return generatedFilePolicyNames[p]
+}
+
+// ParseGeneratedFilePolicy returns the GeneratedFilePolicy with the given name
+// (edit, skip, or fail).
+func ParseGeneratedFilePolicy(name string) (GeneratedFilePolicy, error) {
+	for i, n := range generatedFilePolicyNames {
+		if n == name {
+			return GeneratedFilePolicy(i), nil
+		}
+	}
+	return EditGeneratedFiles, fmt.Errorf("invalid generated file policy %q (must be edit, skip, or fail)", name)
+}
+
+var generatedRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// IsGenerated returns true iff the given file contains a comment indicating
+// that it was generated by a tool.  The file must have been parsed with the
+// parser.ParseComments flag.
+func IsGenerated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if generatedRegexp.MatchString(comment.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGeneratedFile returns true iff the given file (which is read from the
+// refactoring's file system) is a generated file.
+func isGeneratedFile(config *Config, filename string) bool {
+	file, err := parseImports(config, token.NewFileSet(), filename)
+	if err != nil {
+		return false
+	}
+	return IsGenerated(file)
+}
+
+// applyGeneratedFilePolicy checks whether any of the files modified by this
+// refactoring are generated files and, if so, skips them or fails according
+// to config.GeneratedFiles.
+func (r *RefactoringBase) applyGeneratedFilePolicy(config *Config) {
+	if config.GeneratedFiles == EditGeneratedFiles {
+		return
+	}
+
+	generated := []string{}
+	for filename, edits := range r.Edits {
+		if !isEmpty(edits) && isGeneratedFile(config, filename) {
+			generated = append(generated, filename)
+		}
+	}
+	sort.Strings(generated)
+
+	switch config.GeneratedFiles {
+	case SkipGeneratedFiles:
+		for _, filename := range generated {
+			r.Log.Warnf("%s is a generated file, so it was not modified", filename)
+			delete(r.Edits, filename)
+		}
+	case FailOnGeneratedFiles:
+		for _, filename := range generated {
+			r.Log.Errorf("The refactoring would modify the generated file %s", filename)
+		}
+		if len(generated) > 0 {
+			r.Edits = map[string]*text.EditSet{}
+			r.FSChanges = []filesystem.Change{}
+		}
+	}
+}
+
+// isEmpty returns true iff the given EditSet contains no edits.
+func isEmpty(edits *text.EditSet) bool {
+	empty := true
+	edits.Iterate(func(*text.Extent, string) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		src       string
+		generated bool
+	}{
+		{"package p", false},
+		{"// Code generated by stringer. DO NOT EDIT.\n\npackage p", true},
+		{"// Copyright 2018\n\n// Code generated by hand. DO NOT EDIT.\npackage p", true},
+		{"/* Code generated by stringer. DO NOT EDIT. */\npackage p", false},
+		{"// Code generated by stringer. DO NOT EDIT\npackage p", false},
+		{"package p\n\n// Code generated by stringer. DO NOT EDIT.\n", false},
+	}
+	for _, test := range tests {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", test.src,
+			parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsGenerated(file) != test.generated {
+			t.Fatalf("IsGenerated: expected %t for:\n%s",
+				test.generated, test.src)
+		}
+	}
+}
+
+func TestParseGeneratedFilePolicy(t *testing.T) {
+	for _, p := range []GeneratedFilePolicy{EditGeneratedFiles, SkipGeneratedFiles, FailOnGeneratedFiles} {
+		parsed, err := ParseGeneratedFilePolicy(p.String())
+		if err != nil || parsed != p {
+			t.Fatalf("Unable to parse %s", p)
+		}
+	}
+	if _, err := ParseGeneratedFilePolicy("maybe"); err == nil {
+		t.Fatal("Expected error parsing invalid policy")
+	}
+}
@@ -0,0 +1,748 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that merges a family of functions that
+// differ only by a concrete type (e.g., MinInt and MinFloat64) into a single
+// generic function.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// MergeIntoGeneric is a refactoring that finds the functions in a package
+// that are identical to the selected function except for a single concrete
+// type, and replaces them with one generic function whose type parameter is
+// constrained to the union of those types.  References to the functions are
+// updated to refer to the generic function, with an explicit type argument
+// where it cannot be inferred.
+type MergeIntoGeneric struct {
+	RefactoringBase
+	pkgInfo *loader.PackageInfo
+	// The family of functions to merge, starting with the selected function
+	family *funcFamily
+	// The name of the generic function
+	newName string
+	// The name of its type parameter
+	typeParam string
+	// Import resolvers for the files containing references
+	imports map[string]*ImportResolver
+}
+
+// A funcFamily is a set of functions that are identical except for one type.
+type funcFamily struct {
+	// The members of the family, starting with the selected function
+	members []*familyMember
+	// The positions of the references to the varying type in the selected
+	// function
+	positions []token.Pos
+}
+
+// A familyMember is a function in a funcFamily, together with the type it
+// uses where the other members use different types.
+type familyMember struct {
+	decl *ast.FuncDecl
+	obj  *types.Func
+	typ  *types.TypeName
+}
+
+func (r *MergeIntoGeneric) Description() *Description {
+	return &Description{
+		Name:      "Merge into Generic Function",
+		Synopsis:  "Merges functions that differ only by a type into a generic function",
+		Usage:     "[<new_name>]",
+		Selection: "A function declaration",
+		HTMLDoc:   mergeIntoGenericDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Generic Function Name:",
+			Prompt:       "Name for the generic function (leave blank to derive it from the existing names).",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *MergeIntoGeneric) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.pkgInfo = r.SelectedNodePkg
+	r.imports = map[string]*ImportResolver{}
+
+	decl := r.selectedFunc()
+	if decl == nil {
+		r.Log.Error("Please select a function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if decl.Recv != nil || decl.Type.TypeParams != nil || decl.Body == nil {
+		r.Log.Errorf("%s must be a non-generic function with a body, not "+
+			"a method or an external or generic function", decl.Name.Name)
+		r.Log.AssociateNode(decl.Name)
+		return &r.Result
+	}
+
+	r.family = r.findFamily(decl)
+	if r.family == nil {
+		r.Log.Errorf("No other function in package %s differs from %s "+
+			"only by a type", r.pkgInfo.Pkg.Name(), decl.Name.Name)
+		r.Log.AssociateNode(decl.Name)
+		return &r.Result
+	}
+
+	r.newName = ""
+	if len(config.Args) > 0 {
+		r.newName = config.Args[0].(string)
+	}
+	if r.newName == "" {
+		r.newName = r.family.genericName()
+	}
+	if !r.checkNewName() {
+		return &r.Result
+	}
+	r.typeParam = r.chooseTypeParam()
+
+	r.Log.Infof("Merging %s into %s", r.family.names(), r.newName)
+	r.rewriteDecl()
+	r.deleteOtherMembers(config)
+	r.updateReferences(config)
+	for filename, imports := range r.imports {
+		if r.Edits[filename] == nil {
+			continue
+		}
+		if err := imports.AddEdits(r.Edits[filename]); err != nil {
+			r.Log.Error(err)
+			return &r.Result
+		}
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedFunc returns the function declaration enclosing the selection, or
+// nil if the selection is not in a function declaration.
+func (r *MergeIntoGeneric) selectedFunc() *ast.FuncDecl {
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			return decl
+		}
+	}
+	return nil
+}
+
+// findFamily returns the family of functions in the package that differ from
+// the given function only by a single type, or nil if there are no other
+// such functions.  A function is only included if the references to the type
+// that vary appear at the same positions as in the other members.
+func (r *MergeIntoGeneric) findFamily(decl *ast.FuncDecl) *funcFamily {
+	base := &familyMember{decl: decl, obj: r.funcObj(decl)}
+	family := &funcFamily{members: []*familyMember{base}}
+	for _, file := range r.pkgInfo.Files {
+		for _, d := range file.Decls {
+			other, ok := d.(*ast.FuncDecl)
+			if !ok || other == decl || other.Recv != nil ||
+				other.Type.TypeParams != nil || other.Body == nil {
+				continue
+			}
+			c := &funcComparison{
+				pkgInfo: r.pkgInfo,
+				base:    base,
+				other:   &familyMember{decl: other, obj: r.funcObj(other)},
+			}
+			if !c.compare() || c.other.typ == nil {
+				continue
+			}
+			if base.typ == nil {
+				base.typ = c.baseType
+				family.positions = c.positions
+			} else if base.typ != c.baseType ||
+				!samePositions(family.positions, c.positions) {
+				continue
+			}
+			family.members = append(family.members, c.other)
+		}
+	}
+	if len(family.members) < 2 {
+		return nil
+	}
+	return family
+}
+
+// funcObj returns the object for the function declared by the given
+// declaration.
+func (r *MergeIntoGeneric) funcObj(decl *ast.FuncDecl) *types.Func {
+	obj, _ := r.pkgInfo.Defs[decl.Name].(*types.Func)
+	return obj
+}
+
+// samePositions returns true if the two slices contain the same positions.
+func samePositions(a, b []token.Pos) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A funcComparison determines whether two function declarations are
+// identical except for references to a single type.
+type funcComparison struct {
+	pkgInfo     *loader.PackageInfo
+	base, other *familyMember
+	// The type referenced by base where other references other.typ
+	baseType *types.TypeName
+	// The positions of the references to baseType in base that vary
+	positions []token.Pos
+}
+
+var (
+	identType        = reflect.TypeOf((*ast.Ident)(nil))
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// compare returns true if the signatures and bodies of the two functions are
+// identical, except that base may refer to one type where other refers to
+// another.  On return, other.typ is the type that varies (or nil if the
+// functions are identical).
+func (c *funcComparison) compare() bool {
+	return c.match(reflect.ValueOf(c.base.decl.Type), reflect.ValueOf(c.other.decl.Type)) &&
+		c.match(reflect.ValueOf(c.base.decl.Body), reflect.ValueOf(c.other.decl.Body))
+}
+
+// match compares two AST values structurally, ignoring positions and
+// comments.
+func (c *funcComparison) match(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return c.match(a.Elem(), b.Elem())
+
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		if a.Type() == identType {
+			return c.matchIdents(a.Interface().(*ast.Ident),
+				b.Interface().(*ast.Ident))
+		}
+		return c.match(a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			switch a.Type().Field(i).Type {
+			case posType, objectType, commentGroupType:
+				continue
+			}
+			if !c.match(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !c.match(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
+
+// matchIdents returns true if the two identifiers refer to corresponding
+// objects: the same object, local objects with the same name, the functions
+// themselves (in a recursive call), or the type that varies.
+func (c *funcComparison) matchIdents(x, y *ast.Ident) bool {
+	ox, oy := c.pkgInfo.ObjectOf(x), c.pkgInfo.ObjectOf(y)
+	switch {
+	case ox == oy:
+		return x.Name == y.Name
+	case ox == nil || oy == nil:
+		return false
+	case ox == c.base.obj && oy == c.other.obj:
+		return true
+	case isLocalTo(ox, c.base.decl) && isLocalTo(oy, c.other.decl):
+		return ox.Name() == oy.Name()
+	case isLocalTo(ox, c.base.decl) || isLocalTo(oy, c.other.decl):
+		return false
+	}
+
+	tx, ok := ox.(*types.TypeName)
+	if !ok || types.IsInterface(tx.Type()) {
+		return false
+	}
+	ty, ok := oy.(*types.TypeName)
+	if !ok || types.IsInterface(ty.Type()) {
+		return false
+	}
+	if c.baseType == nil {
+		c.baseType, c.other.typ = tx, ty
+	} else if c.baseType != tx || c.other.typ != ty {
+		return false
+	}
+	c.positions = append(c.positions, x.Pos())
+	return true
+}
+
+// isLocalTo returns true if the given object is declared in the given
+// function declaration.
+func isLocalTo(obj types.Object, decl *ast.FuncDecl) bool {
+	return obj.Pos() >= decl.Pos() && obj.Pos() < decl.End()
+}
+
+// names returns a comma-separated list of the names of the members.
+func (f *funcFamily) names() string {
+	names := []string{}
+	for _, m := range f.members {
+		names = append(names, m.decl.Name.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// genericName returns the name shared by all members after removing the name
+// of the type from the end of each (e.g., Min for MinInt and MinFloat64), or
+// "" if there is no such name.
+func (f *funcFamily) genericName() string {
+	result := ""
+	for _, m := range f.members {
+		typeName := m.typ.Name()
+		suffix := strings.ToUpper(typeName[:1]) + typeName[1:]
+		name := m.decl.Name.Name
+		if !strings.HasSuffix(name, suffix) || name == suffix {
+			return ""
+		}
+		name = strings.TrimSuffix(name, suffix)
+		if result != "" && result != name {
+			return ""
+		}
+		result = name
+	}
+	return result
+}
+
+// isMember returns true if the given object is one of the functions in the
+// family.
+func (f *funcFamily) isMember(obj types.Object) bool {
+	return f.member(obj) != nil
+}
+
+// member returns the member of the family declaring the given object, or nil.
+func (f *funcFamily) member(obj types.Object) *familyMember {
+	for _, m := range f.members {
+		if m.obj == obj {
+			return m
+		}
+	}
+	return nil
+}
+
+// constraint returns the constraint for the type parameter: a union of the
+// types used by the members, in the order the members are declared.
+func (f *funcFamily) constraint() string {
+	members := append([]*familyMember{}, f.members...)
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].decl.Pos() < members[j].decl.Pos()
+	})
+	terms := []string{}
+	seen := map[*types.TypeName]bool{}
+	for _, m := range members {
+		if !seen[m.typ] {
+			seen[m.typ] = true
+			terms = append(terms, m.typ.Name())
+		}
+	}
+	return strings.Join(terms, " | ")
+}
+
+// checkNewName logs an error and returns false if the name chosen for the
+// generic function is invalid or would conflict with an existing declaration.
+func (r *MergeIntoGeneric) checkNewName() bool {
+	if r.newName == "" {
+		r.Log.Errorf("A name for the generic function could not be "+
+			"derived from %s; please provide one", r.family.names())
+		r.Log.AssociateArg(0)
+		return false
+	}
+	if !isIdentifierValid(r.newName) || isReservedWord(r.newName) {
+		r.Log.Errorf("The new name \"%s\" is not a valid Go identifier",
+			r.newName)
+		r.Log.AssociateArg(0)
+		return false
+	}
+	if obj := r.pkgInfo.Pkg.Scope().Lookup(r.newName); obj != nil &&
+		!r.family.isMember(obj) {
+		r.Log.Errorf("The name %s is already declared in package %s",
+			r.newName, r.pkgInfo.Pkg.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+	for _, ref := range r.references() {
+		if ref.pkgInfo != r.pkgInfo {
+			if !ast.IsExported(r.newName) {
+				r.Log.Errorf("%s is referenced from package %s, so the "+
+					"generic function's name must be exported",
+					ref.id.Name, ref.pkgInfo.Pkg.Name())
+				r.Log.AssociateNode(ref.id)
+				return false
+			}
+			continue
+		}
+		scope := r.pkgInfo.Pkg.Scope().Innermost(ref.id.Pos())
+		if scope == nil {
+			continue
+		}
+		if _, obj := scope.LookupParent(r.newName, ref.id.Pos()); obj != nil &&
+			obj.Parent() != r.pkgInfo.Pkg.Scope() {
+			r.Log.Errorf("The name %s would refer to a different "+
+				"declaration here", r.newName)
+			r.Log.AssociateNode(ref.id)
+			return false
+		}
+	}
+	return true
+}
+
+// chooseTypeParam returns a name for the type parameter that is not used in
+// the selected function.
+func (r *MergeIntoGeneric) chooseTypeParam() string {
+	used := map[string]bool{r.newName: true}
+	ast.Inspect(r.family.members[0].decl, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	name := "T"
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("T%d", i)
+	}
+	return name
+}
+
+// rewriteDecl replaces the selected function with the generic function.
+func (r *MergeIntoGeneric) rewriteDecl() {
+	base := r.family.members[0]
+	r.replace(base.decl.Name.Pos(), base.decl.Name.End(),
+		fmt.Sprintf("%s[%s %s]", r.newName, r.typeParam, r.family.constraint()))
+	for _, pos := range r.family.positions {
+		r.replace(pos, pos+token.Pos(len(base.typ.Name())), r.typeParam)
+	}
+}
+
+// deleteOtherMembers removes the declarations of the members of the family
+// other than the selected function.
+func (r *MergeIntoGeneric) deleteOtherMembers(config *Config) {
+	for _, m := range r.family.members[1:] {
+		filename := r.Program.Fset.Position(m.decl.Pos()).Filename
+		src := readFile(config, filename)
+		if src == nil {
+			r.Log.Errorf("%s could not be read", filename)
+			return
+		}
+		r.deleteDecl(filename, src, m.decl)
+	}
+}
+
+// deleteDecl adds an edit removing the given declaration (and its doc
+// comment) from the given file, whose contents are src, along with a blank
+// line preceding it.
+func (r *MergeIntoGeneric) deleteDecl(filename string, src []byte, decl *ast.FuncDecl) {
+	var start token.Pos = decl.Pos()
+	if decl.Doc != nil {
+		start = decl.Doc.Pos()
+	}
+	startOffset := r.Program.Fset.Position(start).Offset
+	endOffset := r.Program.Fset.Position(decl.End()).Offset
+
+	startOffset = bytes.LastIndexByte(src[:startOffset], '\n') + 1
+	if lineEnd := bytes.IndexByte(src[endOffset:], '\n'); lineEnd < 0 {
+		endOffset = len(src)
+	} else {
+		endOffset += lineEnd + 1
+	}
+	if startOffset >= 2 && src[startOffset-2] == '\n' {
+		startOffset--
+	} else if endOffset < len(src) && src[endOffset] == '\n' {
+		endOffset++
+	}
+	r.addEdit(filename, &text.Extent{
+		Offset: startOffset,
+		Length: endOffset - startOffset,
+	}, "")
+}
+
+// A funcReference is a reference to a member of the family.
+type funcReference struct {
+	pkgInfo *loader.PackageInfo
+	file    *ast.File
+	id      *ast.Ident
+	member  *familyMember
+}
+
+// references returns the references to members of the family throughout the
+// program, excluding those in members that will be deleted, sorted by
+// position.
+func (r *MergeIntoGeneric) references() []*funcReference {
+	result := []*funcReference{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for id, obj := range pkgInfo.Uses {
+			m := r.family.member(obj)
+			if m == nil || r.inDeletedMember(id.Pos()) {
+				continue
+			}
+			result = append(result, &funcReference{
+				pkgInfo: pkgInfo,
+				file:    fileContaining(pkgInfo, id.Pos()),
+				id:      id,
+				member:  m,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id.Pos() < result[j].id.Pos()
+	})
+	return result
+}
+
+// inDeletedMember returns true if the given position is in the declaration
+// of a member of the family other than the selected function.
+func (r *MergeIntoGeneric) inDeletedMember(pos token.Pos) bool {
+	for _, m := range r.family.members[1:] {
+		if pos >= m.decl.Pos() && pos < m.decl.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// fileContaining returns the file in the given package containing the given
+// position, or nil.
+func fileContaining(pkgInfo *loader.PackageInfo, pos token.Pos) *ast.File {
+	for _, file := range pkgInfo.Files {
+		if pos >= file.Pos() && pos <= file.End() {
+			return file
+		}
+	}
+	return nil
+}
+
+// updateReferences replaces each reference to a member of the family with a
+// reference to the generic function, instantiating it explicitly unless the
+// reference is a call from which the type argument can be inferred.
+func (r *MergeIntoGeneric) updateReferences(config *Config) {
+	base := r.family.members[0]
+	for _, ref := range r.references() {
+		replacement := r.newName
+		if !r.canInfer(ref) {
+			var typeArg string
+			if ref.id.Pos() >= base.decl.Pos() && ref.id.Pos() < base.decl.End() {
+				typeArg = r.typeParam
+			} else if imports := r.importResolver(config, ref); imports != nil {
+				typeArg = types.TypeString(ref.member.typ.Type(),
+					imports.Qualifier(ref.id.Pos()))
+			} else {
+				return
+			}
+			replacement = fmt.Sprintf("%s[%s]", r.newName, typeArg)
+		}
+		r.replace(ref.id.Pos(), ref.id.End(), replacement)
+	}
+}
+
+// importResolver returns the ImportResolver for the file containing the
+// given reference, or nil (after logging an error) if the file cannot be
+// read.
+func (r *MergeIntoGeneric) importResolver(config *Config, ref *funcReference) *ImportResolver {
+	filename := r.Program.Fset.Position(ref.file.Package).Filename
+	if imports, ok := r.imports[filename]; ok {
+		return imports
+	}
+	src := readFile(config, filename)
+	if src == nil {
+		r.Log.Errorf("%s could not be read", filename)
+		return nil
+	}
+	imports := NewImportResolver(r.Program.Fset, ref.file, ref.pkgInfo, src)
+	r.imports[filename] = imports
+	return imports
+}
+
+// canInfer returns true if the given reference is the function in a call
+// with at least one non-constant argument whose parameter's type refers to
+// the type that varies, so the type argument of the generic function can be
+// inferred.
+func (r *MergeIntoGeneric) canInfer(ref *funcReference) bool {
+	path, _ := astutil.PathEnclosingInterval(ref.file, ref.id.Pos(), ref.id.End())
+	var fun ast.Expr = ref.id
+	path = path[1:]
+	if len(path) > 0 {
+		if sel, ok := path[0].(*ast.SelectorExpr); ok && sel.Sel == ref.id {
+			fun, path = sel, path[1:]
+		}
+	}
+	if len(path) == 0 {
+		return false
+	}
+	call, ok := path[0].(*ast.CallExpr)
+	if !ok || call.Fun != fun {
+		return false
+	}
+	for i, arg := range call.Args {
+		if !r.paramUsesTypeParam(i) {
+			continue
+		}
+		// The recorded type of an untyped constant is the type it was
+		// converted to, so constant arguments are never used for inference
+		if tv, ok := ref.pkgInfo.Types[arg]; ok && tv.Value == nil &&
+			!tv.IsNil() {
+			return true
+		}
+	}
+	return false
+}
+
+// paramUsesTypeParam returns true if the type of the parameter corresponding
+// to the i-th argument of a call refers to the type that varies.
+func (r *MergeIntoGeneric) paramUsesTypeParam(i int) bool {
+	params := r.family.members[0].decl.Type.Params.List
+	var field *ast.Field
+	for _, f := range params {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		if i < n {
+			field = f
+			break
+		}
+		i -= n
+	}
+	if field == nil {
+		if len(params) == 0 {
+			return false
+		}
+		if _, ok := params[len(params)-1].Type.(*ast.Ellipsis); !ok {
+			return false
+		}
+		field = params[len(params)-1]
+	}
+	for _, pos := range r.family.positions {
+		if pos >= field.Type.Pos() && pos < field.Type.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// replace adds an edit replacing the text from start to end with the given
+// string.
+func (r *MergeIntoGeneric) replace(start, end token.Pos, replacement string) {
+	filename := r.Program.Fset.Position(start).Filename
+	offset := r.OffsetOfPos(start)
+	r.addEdit(filename, &text.Extent{
+		Offset: offset,
+		Length: r.OffsetOfPos(end) - offset,
+	}, replacement)
+}
+
+const mergeIntoGenericDoc = `
+  <h4>Purpose</h4>
+  <p>The Merge into Generic Function refactoring finds functions that are
+  identical to the selected function except for a single concrete type (e.g.,
+  <tt>MinInt</tt> and <tt>MinFloat64</tt>) and replaces them with one generic
+  function whose type parameter is constrained to the union of those
+  types.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration.</li>
+    <li>Activate the Merge into Generic Function refactoring.</li>
+    <li>Optionally, enter a name for the generic function.  By default, the
+    name is derived by removing the type names from the ends of the existing
+    names (e.g., <tt>Min</tt>).</li>
+  </ol>
+
+  <p>Functions are merged only if their signatures and bodies are identical
+  except for references to one type, and those references appear in the same
+  places.  References to the merged functions are updated to call the generic
+  function, with an explicit type argument where it cannot be inferred (e.g.,
+  when every argument is an untyped constant).  The resulting code requires Go
+  1.18 or later.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of merging <tt>MinInt</tt> and
+  <tt>MinFloat64</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func <span class="highlight">MinInt</span>(a, b int) int {
+    if a &lt; b {
+        return a
+    }
+    return b
+}
+
+func MinFloat64(a, b float64) float64 {
+    if a &lt; b {
+        return a
+    }
+    return b
+}
+
+func main() {
+    fmt.Println(MinInt(x, 2))
+    fmt.Println(MinFloat64(1, 2))
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func Min[T int | float64](a, b T) T {
+    if a &lt; b {
+        return a
+    }
+    return b
+}
+
+func main() {
+    fmt.Println(Min(x, 2))
+    fmt.Println(Min[float64](1, 2))
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -25,6 +25,7 @@ func (r *AddGoDoc) Description() *Description {
 		Name:           "Add GoDoc",
 		Synopsis:       "Adds stub GoDoc comments where they are missing",
 		Usage:          "",
+		Selection:      "",
 		HTMLDoc:        godocDoc,
 		Multifile:      false,
 		Params:         nil,
@@ -42,7 +43,10 @@ func (r *AddGoDoc) Run(config *Config) *Result {
 
 	r.removeSemicolons()
 	r.addComments()
-	r.FormatFileInEditor()
+	r.GofmtFileInEditor()
+	r.removeExcludedEdits(config)
+	r.applyGeneratedFilePolicy(config)
+	r.recordChecksums(config)
 	return &r.Result
 }
 
@@ -0,0 +1,517 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that flattens nested if statements into
+// guard clauses with early returns.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/cfg"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// IntroduceGuardClauses is a refactoring that reduces the nesting depth of a
+// function by replacing if statements at the end of its body with guard
+// clauses that return early.  For example,
+//     if ok {
+//             ... long body ...
+//     }
+// at the end of a function without results becomes
+//     if !ok {
+//             return
+//     }
+//     ... long body ...
+// An else branch is removed when the other branch cannot complete normally.
+// The control flow graph of the function is used to verify that a branch
+// cannot complete normally before the statements following it are moved.
+type IntroduceGuardClauses struct {
+	RefactoringBase
+	m     *fileMigration
+	cfg   *cfg.CFG
+	style IndentStyle
+	// True if the function has results, so bare returns cannot be added
+	results bool
+	// Names declared in the outermost block of the function's body
+	declared map[string]bool
+	// The number of if statements that were flattened
+	count int
+}
+
+func (r *IntroduceGuardClauses) Description() *Description {
+	return &Description{
+		Name:           "Introduce Guard Clauses",
+		Synopsis:       "Flattens nested if statements into guard clauses with early returns",
+		Usage:          "",
+		Selection:      "A function declaration or function literal",
+		HTMLDoc:        introduceGuardClausesDoc,
+		Multifile:      false,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *IntroduceGuardClauses) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	funcType, body, fn := r.enclosingFunc()
+	if funcType == nil {
+		r.Log.Error("Please select a function declaration or function " +
+			"literal.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if containsGoto(body) {
+		r.Log.Error("Guard clauses cannot be introduced in a function " +
+			"that contains a goto statement")
+		r.Log.AssociateNode(body)
+		return &r.Result
+	}
+
+	r.m = r.newFileMigration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, fn.Pos()))
+	if r.m == nil {
+		return &r.Result
+	}
+	r.cfg = cfg.FromStmts(body.List)
+	r.style = DetectIndentStyle(r.m.src)
+	r.results = funcType.Results != nil && len(funcType.Results.List) > 0
+	r.declared = map[string]bool{}
+	if scope := r.SelectedNodePkg.Scopes[funcType]; scope != nil {
+		for _, name := range scope.Names() {
+			r.declared[name] = true
+		}
+	}
+	r.count = 0
+
+	outer := Indentation(r.m.src, r.m.offset(body.Rbrace))
+	code := r.flatten(r.chunks(body), outer+r.style.Unit)
+	if r.count == 0 {
+		r.Log.Error("There are no nested if statements at the end of " +
+			"the function that can be replaced with guard clauses")
+		r.Log.AssociateNode(body)
+		return &r.Result
+	}
+	r.m.replace(body.Lbrace+1, body.Rbrace, "\n"+code+outer)
+	r.Log.Infof("Introduced guard clauses for %d if statement(s)", r.count)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// containsGoto returns true if the given node contains a goto statement.
+// Moving declarations into an outer block could make a goto statement jump
+// over them, so such functions are not changed.
+func containsGoto(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if br, ok := n.(*ast.BranchStmt); ok && br.Tok == token.GOTO {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// A stmtChunk is a statement in a block, along with the comments before it
+// (and after it, on the same line or before the end of the block).
+type stmtChunk struct {
+	stmt       ast.Stmt
+	start, end token.Pos
+	// The indentation of the line on which the statement starts
+	indent string
+	// True if a blank line precedes the chunk
+	blank bool
+}
+
+// chunks returns a chunk for each statement in the given block.
+func (r *IntroduceGuardClauses) chunks(block *ast.BlockStmt) []stmtChunk {
+	result := []stmtChunk{}
+	prev := block.Lbrace + 1
+	for i, stmt := range block.List {
+		next := block.Rbrace
+		if i+1 < len(block.List) {
+			next = block.List[i+1].Pos()
+		}
+		c := stmtChunk{stmt: stmt, start: stmt.Pos(), end: stmt.End()}
+		for _, cg := range r.m.file.Comments {
+			if cg.Pos() >= prev && cg.End() <= stmt.Pos() {
+				c.start = minPos(c.start, cg.Pos())
+			}
+			if cg.Pos() >= stmt.End() && cg.End() <= next &&
+				(r.line(cg.Pos()) == r.line(stmt.End()) ||
+					i == len(block.List)-1) {
+				c.end = maxPos(c.end, cg.End())
+			}
+		}
+		c.indent = Indentation(r.m.src, r.m.offset(stmt.Pos()))
+		c.blank = i > 0 && r.line(c.start) > r.line(prev)+1
+		result = append(result, c)
+		prev = c.end
+	}
+	return result
+}
+
+// text returns the source code from start to end, moved from a line with the
+// given indentation to a line with the given new indentation.
+func (r *IntroduceGuardClauses) text(start, end token.Pos, from, to string) string {
+	return shiftIndentation(r.m.text(start, end), from, to)
+}
+
+// flatten returns the source code for the given statements, placed at the
+// given indentation, which are the last statements in the function.  If the
+// last statement is an if statement that can be replaced by a guard clause,
+// it is replaced, and the statements moved out of its body are flattened as
+// well.
+func (r *IntroduceGuardClauses) flatten(chunks []stmtChunk, indent string) string {
+	var b strings.Builder
+	for i, c := range chunks {
+		if i > 0 && c.blank {
+			b.WriteString("\n")
+		}
+		if ifStmt, ok := c.stmt.(*ast.IfStmt); ok {
+			if code, moved, ok := r.flattenIf(c, ifStmt, chunks[i+1:], indent); ok {
+				r.count++
+				b.WriteString(code)
+				b.WriteString(r.flatten(moved, indent))
+				return b.String()
+			}
+		}
+		b.WriteString(indent + r.text(c.start, c.end, c.indent, indent) + "\n")
+	}
+	return b.String()
+}
+
+// flattenIf returns the source code for a guard clause replacing the given if
+// statement, which is followed by the given statements at the end of the
+// function, and the statements that follow the guard clause.  It returns
+// false if the if statement cannot (or should not) be replaced.
+func (r *IntroduceGuardClauses) flattenIf(c stmtChunk, ifStmt *ast.IfStmt, rest []stmtChunk, indent string) (string, []stmtChunk, bool) {
+	restStmts := []ast.Stmt{}
+	for _, c := range rest {
+		restStmts = append(restStmts, c.stmt)
+	}
+	elseBlock, _ := ifStmt.Else.(*ast.BlockStmt)
+
+	var cond string
+	var guard, moved []stmtChunk
+	var guardBlock, movedBlock *ast.BlockStmt
+	switch {
+	case ifStmt.Else == nil:
+		// if c { body }; rest  =>  if !c { rest }; body
+		if len(rest) == 0 && isSimple(ifStmt.Body.List) ||
+			len(rest) > 0 && (!r.terminates(ifStmt.Body.List) ||
+				r.lines(ifStmt.Body.List) <= r.lines(restStmts)) {
+			return "", nil, false
+		}
+		cond = r.negate(ifStmt.Cond)
+		guard, moved = rest, r.chunks(ifStmt.Body)
+		movedBlock = ifStmt.Body
+	case r.terminates(ifStmt.Body.List):
+		// if c { body } else { other }; rest  =>  if c { body }; other; rest
+		cond = r.m.textOf(ifStmt.Cond)
+		guard, guardBlock = r.chunks(ifStmt.Body), ifStmt.Body
+		if elseBlock != nil {
+			moved, movedBlock = r.chunks(elseBlock), elseBlock
+		} else {
+			moved = []stmtChunk{{
+				stmt:   ifStmt.Else,
+				start:  ifStmt.Else.Pos(),
+				end:    ifStmt.Else.End(),
+				indent: c.indent,
+			}}
+		}
+		moved = append(moved, rest...)
+	case elseBlock != nil && (r.terminates(elseBlock.List) ||
+		len(rest) == 0 && !r.results &&
+			r.lines(elseBlock.List) < r.lines(ifStmt.Body.List)):
+		// if c { body } else { other }; rest  =>  if !c { other }; body; rest
+		cond = r.negate(ifStmt.Cond)
+		guard, guardBlock = r.chunks(elseBlock), elseBlock
+		moved, movedBlock = r.chunks(ifStmt.Body), ifStmt.Body
+		moved = append(moved, rest...)
+	case elseBlock != nil && len(rest) == 0 && !r.results:
+		// if c { body } else { other }  =>  if c { body; return }; other
+		cond = r.m.textOf(ifStmt.Cond)
+		guard, guardBlock = r.chunks(ifStmt.Body), ifStmt.Body
+		moved, movedBlock = r.chunks(elseBlock), elseBlock
+	default:
+		return "", nil, false
+	}
+
+	// Move the initialization statement out of the if statement if the
+	// statements moved out of its body refer to the variables it declares
+	var init string
+	if ifStmt.Init != nil {
+		scope := r.SelectedNodePkg.Scopes[ifStmt]
+		for _, m := range moved {
+			for _, name := range scope.Names() {
+				if usesObject(r.SelectedNodePkg, m.stmt, scope.Lookup(name)) {
+					init = r.text(ifStmt.Init.Pos(), ifStmt.Init.End(),
+						c.indent, indent)
+				}
+			}
+		}
+		if init != "" && !r.canMove(scope, restStmts) {
+			return "", nil, false
+		}
+	}
+	if movedBlock != nil && !r.canMove(r.SelectedNodePkg.Scopes[movedBlock], restStmts) {
+		return "", nil, false
+	}
+
+	var b strings.Builder
+	if c.start < ifStmt.Pos() {
+		b.WriteString(indent + r.text(c.start, ifStmt.Pos(), c.indent, indent))
+	} else {
+		b.WriteString(indent)
+	}
+	switch {
+	case init != "":
+		b.WriteString(init + "\n" + indent + "if ")
+	case ifStmt.Init != nil:
+		b.WriteString("if " + r.m.textOf(ifStmt.Init) + "; ")
+	default:
+		b.WriteString("if ")
+	}
+	b.WriteString(cond + " {\n")
+	inner := indent + r.style.Unit
+	guardStmts := []ast.Stmt{}
+	for i, g := range guard {
+		if i > 0 && g.blank {
+			b.WriteString("\n")
+		}
+		b.WriteString(inner + r.text(g.start, g.end, g.indent, inner) + "\n")
+		guardStmts = append(guardStmts, g.stmt)
+	}
+	if guardBlock != nil && len(guard) == 0 {
+		// Keep any comments in an empty block
+		if code := strings.TrimSpace(r.m.text(guardBlock.Lbrace+1,
+			guardBlock.Rbrace)); code != "" {
+			b.WriteString(inner + code + "\n")
+		}
+	}
+	if !r.terminates(guardStmts) {
+		if r.results {
+			return "", nil, false
+		}
+		b.WriteString(inner + "return\n")
+	}
+	b.WriteString(indent + "}")
+	if c.end > ifStmt.End() {
+		b.WriteString(r.m.text(ifStmt.End(), c.end))
+	}
+	b.WriteString("\n")
+	return b.String(), moved, true
+}
+
+// isSimple returns true if the given statements are a single statement that
+// does not contain a block, so moving it out of a block would not reduce its
+// nesting depth.
+func isSimple(stmts []ast.Stmt) bool {
+	if len(stmts) != 1 {
+		return false
+	}
+	simple := true
+	ast.Inspect(stmts[0], func(n ast.Node) bool {
+		if _, ok := n.(*ast.BlockStmt); ok {
+			simple = false
+		}
+		return simple
+	})
+	return simple
+}
+
+// lines returns the number of lines spanned by the given statements.
+func (r *IntroduceGuardClauses) lines(stmts []ast.Stmt) int {
+	if len(stmts) == 0 {
+		return 0
+	}
+	return r.line(stmts[len(stmts)-1].End()) - r.line(stmts[0].Pos()) + 1
+}
+
+// canMove returns true if the names declared in the given scope can be moved
+// into the outermost block of the function without conflicting with the
+// names declared there or changing the meaning of the given statements, which
+// will follow the declarations.  If so, the names are recorded as declared in
+// the outermost block.
+func (r *IntroduceGuardClauses) canMove(scope *types.Scope, following []ast.Stmt) bool {
+	if scope == nil {
+		return true
+	}
+	for _, name := range scope.Names() {
+		if r.declared[name] {
+			return false
+		}
+		for _, stmt := range following {
+			if usesName(stmt, name) {
+				return false
+			}
+		}
+	}
+	for _, name := range scope.Names() {
+		r.declared[name] = true
+	}
+	return true
+}
+
+// terminates returns true if control cannot flow past the end of the given
+// statements, i.e., every path through the statements in the control flow
+// graph ends in a return statement or a call to panic.
+func (r *IntroduceGuardClauses) terminates(stmts []ast.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	inCFG := map[ast.Stmt]bool{}
+	for _, stmt := range r.cfg.Blocks() {
+		inCFG[stmt] = true
+	}
+	inside := map[ast.Stmt]bool{}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if s, ok := n.(ast.Stmt); ok && inCFG[s] {
+				inside[s] = true
+			}
+			_, isFuncLit := n.(*ast.FuncLit)
+			return !isFuncLit
+		})
+	}
+	for stmt := range inside {
+		if r.isPanic(stmt) {
+			continue
+		}
+		for _, succ := range r.cfg.Succs(stmt) {
+			if succ == r.cfg.Exit {
+				if _, isReturn := stmt.(*ast.ReturnStmt); !isReturn {
+					return false
+				}
+			} else if !inside[succ] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPanic returns true if the given statement is a call to the built-in
+// panic function.
+func (r *IntroduceGuardClauses) isPanic(stmt ast.Stmt) bool {
+	expr, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := astutil.Unparen(expr.X).(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	b, ok := r.SelectedNodePkg.Uses[id].(*types.Builtin)
+	return ok && b.Name() == "panic"
+}
+
+// negate returns source code for the negation of the given boolean
+// expression.
+func (r *IntroduceGuardClauses) negate(cond ast.Expr) string {
+	inverse := map[token.Token]token.Token{
+		token.EQL: token.NEQ, token.NEQ: token.EQL,
+		token.LSS: token.GEQ, token.GEQ: token.LSS,
+		token.GTR: token.LEQ, token.LEQ: token.GTR,
+	}
+	switch e := cond.(type) {
+	case *ast.ParenExpr:
+		return r.negate(e.X)
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return r.m.textOf(astutil.Unparen(e.X))
+		}
+	case *ast.BinaryExpr:
+		op, ok := inverse[e.Op]
+		// !(x < y) is not x >= y if x or y is NaN
+		if t, isBasic := r.SelectedNodePkg.TypeOf(e.X).Underlying().(*types.Basic); ok &&
+			(op == token.EQL || op == token.NEQ || !isBasic ||
+				t.Info()&(types.IsFloat|types.IsComplex) == 0) {
+			return r.m.textOf(e.X) + " " + op.String() + " " +
+				r.m.textOf(e.Y)
+		}
+		return "!(" + r.m.textOf(e) + ")"
+	case *ast.Ident, *ast.SelectorExpr, *ast.CallExpr, *ast.IndexExpr:
+		return "!" + r.m.textOf(e)
+	}
+	return "!(" + r.m.textOf(cond) + ")"
+}
+
+const introduceGuardClausesDoc = `
+  <h4>Purpose</h4>
+  <p>The Introduce Guard Clauses refactoring reduces the nesting depth of a
+  function by replacing if statements at the end of its body with guard
+  clauses: if statements that return early, after which the remainder of the
+  function is no longer nested.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration or function literal (or any code
+    inside it).</li>
+    <li>Activate the Introduce Guard Clauses refactoring.</li>
+  </ol>
+
+  <p>The refactoring repeatedly examines the last if statement in the
+  function's body:</p>
+  <ul>
+    <li>If it has no else branch, and it is the last statement in a function
+    with no results, its condition is negated, and its body (unless it is a
+    single, simple statement) is moved after a guard clause that returns.</li>
+    <li>If it has no else branch, its body always returns (or panics), and its
+    body is longer than the statements following it, its condition is
+    negated and the following statements become the guard clause.</li>
+    <li>If it has an else branch, and one of the branches always returns (or
+    panics), the other branch is moved out of the if statement.</li>
+  </ul>
+  <p>The function's control flow graph is used to determine whether a branch
+  always returns.  Statements are not moved if a variable they declare would
+  conflict with another variable declared in the function.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of introducing guard clauses
+  in <tt>save</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func save(d *Doc) error {
+    if d != nil {
+        if d.Dirty {
+            return d.Write()
+        } else {
+            return nil
+        }
+    }
+    return errors.New("no doc")
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func save(d *Doc) error {
+    if d == nil {
+        return errors.New("no doc")
+    }
+    if d.Dirty {
+        return d.Write()
+    }
+    return nil
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
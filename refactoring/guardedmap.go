@@ -0,0 +1,591 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that encapsulates a map guarded by a mutex
+// in accessor methods that acquire the lock.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/members"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// EncapsulateGuardedMap is a refactoring that generates accessor methods for
+// a map field of a struct that is guarded by a sync.Mutex or sync.RWMutex
+// field of the same struct, and replaces direct accesses to the map's entries
+// in the package with calls to those methods.
+//
+// The mutex guarding the map is the nearest mutex field declared before it
+// (or, if there is none, after it).  Accesses in functions that lock the mutex
+// themselves are not replaced, since calling an accessor there would
+// deadlock; nor are accesses that cannot be expressed using the accessors
+// (e.g., ranging over the map).  A warning is logged for each such access.
+type EncapsulateGuardedMap struct {
+	RefactoringBase
+	pkgInfo *loader.PackageInfo
+	// The struct type containing the map
+	typeName *types.TypeName
+	// The map field and the mutex field guarding it
+	field, mutex *types.Var
+	// Whether the mutex is a sync.RWMutex
+	rw bool
+	// The names of the accessor methods
+	methods guardedMapMethods
+	// The contents of the files in the package, by filename
+	src map[string][]byte
+}
+
+// guardedMapMethods contains the names of the accessor methods generated for
+// a map field.
+type guardedMapMethods struct {
+	get, lookup, set, delete, len string
+}
+
+func (r *EncapsulateGuardedMap) Description() *Description {
+	return &Description{
+		Name:           "Encapsulate Guarded Map",
+		Synopsis:       "Generates accessors that lock the mutex guarding a map field",
+		Usage:          "",
+		Selection:      "A map field in a struct type",
+		HTMLDoc:        encapsulateGuardedMapDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *EncapsulateGuardedMap) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.pkgInfo = r.SelectedNodePkg
+	r.src = map[string][]byte{r.Filename: r.FileContents}
+
+	decl := r.findField()
+	if decl == nil || r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.findMutex() || !r.chooseMethodNames() {
+		return &r.Result
+	}
+
+	imports := r.ImportResolver()
+	r.addMethods(decl, imports)
+	r.rewriteAccesses(config)
+	if err := imports.AddEdits(r.Edits[r.Filename]); err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findField determines the selected map field and the struct type containing
+// it, returning the declaration of the struct type, or nil (after logging an
+// error) if a map field in a struct type is not selected.
+func (r *EncapsulateGuardedMap) findField() *ast.GenDecl {
+	var field *ast.Field
+	var spec *ast.TypeSpec
+	var decl *ast.GenDecl
+	for _, node := range r.PathEnclosingSelection {
+		switch node := node.(type) {
+		case *ast.Field:
+			if field == nil {
+				field = node
+			}
+		case *ast.TypeSpec:
+			if spec == nil {
+				spec = node
+			}
+		case *ast.GenDecl:
+			if decl == nil {
+				decl = node
+			}
+		}
+	}
+	if field == nil || spec == nil || decl == nil || len(field.Names) == 0 {
+		r.Log.Error("Please select a map field in a struct type declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return nil
+	}
+	if _, ok := spec.Type.(*ast.StructType); !ok {
+		r.Log.Error("Please select a map field in a struct type declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return nil
+	}
+
+	name := field.Names[0]
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		for _, n := range field.Names {
+			if n == id {
+				name = id
+			}
+		}
+	}
+	r.field, _ = r.pkgInfo.Defs[name].(*types.Var)
+	r.typeName, _ = r.pkgInfo.Defs[spec.Name].(*types.TypeName)
+	if r.field == nil || r.typeName == nil {
+		r.Log.Error("The selected field could not be type checked.")
+		r.Log.AssociateNode(name)
+		return nil
+	}
+	if _, ok := r.field.Type().Underlying().(*types.Map); !ok {
+		r.Log.Errorf("The field %s is not a map (its type is %s)",
+			r.field.Name(), r.field.Type())
+		r.Log.AssociateNode(name)
+		return nil
+	}
+	if _, ok := r.typeName.Type().(*types.Named); !ok {
+		r.Log.Errorf("Methods cannot be declared on %s", r.typeName.Name())
+		r.Log.AssociateNode(spec.Name)
+		return nil
+	}
+	return decl
+}
+
+// findMutex finds the sync.Mutex or sync.RWMutex field guarding the map,
+// returning false (after logging an error) if there is none.
+func (r *EncapsulateGuardedMap) findMutex() bool {
+	st := r.typeName.Type().Underlying().(*types.Struct)
+	index := 0
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i) == r.field {
+			index = i
+		}
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		kind := mutexKind(f.Type())
+		if kind == "" || r.mutex != nil && i > index {
+			continue
+		}
+		r.mutex, r.rw = f, kind == "RWMutex"
+	}
+	if r.mutex == nil {
+		r.Log.Errorf("%s has no sync.Mutex or sync.RWMutex field to "+
+			"guard %s", r.typeName.Name(), r.field.Name())
+		r.Log.AssociatePos(r.field.Pos(), r.field.Pos())
+		return false
+	}
+	return true
+}
+
+// mutexKind returns "Mutex" or "RWMutex" if the given type is sync.Mutex or
+// sync.RWMutex (or a pointer to one), and "" otherwise.
+func mutexKind(t types.Type) string {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "sync" {
+		return ""
+	}
+	switch named.Obj().Name() {
+	case "Mutex", "RWMutex":
+		return named.Obj().Name()
+	default:
+		return ""
+	}
+}
+
+// chooseMethodNames determines the names of the accessor methods, returning
+// false (after logging an error) if any would conflict with an existing field
+// or method.  The methods are exported if and only if the field is.
+func (r *EncapsulateGuardedMap) chooseMethodNames() bool {
+	base := strings.ToUpper(r.field.Name()[:1]) + r.field.Name()[1:]
+	r.methods = guardedMapMethods{
+		get:    "Get" + base,
+		lookup: "Lookup" + base,
+		set:    "Set" + base,
+		delete: "Delete" + base,
+		len:    base + "Len",
+	}
+	if !r.field.Exported() {
+		for _, name := range []*string{&r.methods.get, &r.methods.lookup,
+			&r.methods.set, &r.methods.delete, &r.methods.len} {
+			*name = strings.ToLower((*name)[:1]) + (*name)[1:]
+		}
+	}
+	for _, name := range []string{r.methods.get, r.methods.lookup,
+		r.methods.set, r.methods.delete, r.methods.len} {
+		if obj := members.Lookup(r.typeName.Type(), r.pkgInfo.Pkg, name); obj != nil {
+			r.Log.Errorf("%s already has a field or method named %s",
+				r.typeName.Name(), name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+	}
+	return true
+}
+
+// receiverName returns the receiver name used by existing methods of the
+// struct type, or its first letter (in lower case) if it has none.
+func (r *EncapsulateGuardedMap) receiverName() string {
+	named := r.typeName.Type().(*types.Named)
+	for _, file := range r.pkgInfo.Files {
+		for _, d := range file.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 ||
+				len(fn.Recv.List[0].Names) == 0 {
+				continue
+			}
+			recv := fn.Recv.List[0].Names[0]
+			v, ok := r.pkgInfo.Defs[recv].(*types.Var)
+			if !ok || recv.Name == "_" || recv.Name == "key" ||
+				recv.Name == "value" {
+				continue
+			}
+			t := v.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if t == named {
+				return recv.Name
+			}
+		}
+	}
+	name := strings.ToLower(r.typeName.Name()[:1])
+	if name == "_" {
+		return "m"
+	}
+	return name
+}
+
+// addMethods adds the accessor methods following the given declaration of
+// the struct type.
+func (r *EncapsulateGuardedMap) addMethods(decl *ast.GenDecl, imports *ImportResolver) {
+	mapType := r.field.Type().Underlying().(*types.Map)
+	qualifier := imports.Qualifier(decl.End())
+	key := types.TypeString(mapType.Key(), qualifier)
+	value := types.TypeString(mapType.Elem(), qualifier)
+	recv := r.receiverName()
+	recvDecl := fmt.Sprintf("(%s *%s)", recv, r.typeName.Name())
+	field := recv + "." + r.field.Name()
+	lock, unlock := r.lockCalls(recv, false)
+	rlock, runlock := r.lockCalls(recv, true)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "\n\n// %s returns the value associated with key in %s.\n",
+		r.methods.get, r.field.Name())
+	fmt.Fprintf(&b, "func %s %s(key %s) %s {\n", recvDecl, r.methods.get,
+		key, value)
+	fmt.Fprintf(&b, "\t%s\n\tdefer %s\n\treturn %s[key]\n}\n", rlock,
+		runlock, field)
+
+	fmt.Fprintf(&b, "\n// %s returns the value associated with key in %s "+
+		"and\n// whether it is present.\n", r.methods.lookup, r.field.Name())
+	fmt.Fprintf(&b, "func %s %s(key %s) (%s, bool) {\n", recvDecl,
+		r.methods.lookup, key, value)
+	fmt.Fprintf(&b, "\t%s\n\tdefer %s\n\tvalue, ok := %s[key]\n"+
+		"\treturn value, ok\n}\n", rlock, runlock, field)
+
+	fmt.Fprintf(&b, "\n// %s associates value with key in %s.\n",
+		r.methods.set, r.field.Name())
+	fmt.Fprintf(&b, "func %s %s(key %s, value %s) {\n", recvDecl,
+		r.methods.set, key, value)
+	fmt.Fprintf(&b, "\t%s\n\tdefer %s\n\t%s[key] = value\n}\n", lock,
+		unlock, field)
+
+	fmt.Fprintf(&b, "\n// %s removes key from %s.\n", r.methods.delete,
+		r.field.Name())
+	fmt.Fprintf(&b, "func %s %s(key %s) {\n", recvDecl, r.methods.delete,
+		key)
+	fmt.Fprintf(&b, "\t%s\n\tdefer %s\n\tdelete(%s, key)\n}\n", lock,
+		unlock, field)
+
+	fmt.Fprintf(&b, "\n// %s returns the number of entries in %s.\n",
+		r.methods.len, r.field.Name())
+	fmt.Fprintf(&b, "func %s %s() int {\n", recvDecl, r.methods.len)
+	fmt.Fprintf(&b, "\t%s\n\tdefer %s\n\treturn len(%s)\n}", rlock,
+		runlock, field)
+
+	code := DetectIndentStyle(r.FileContents).Reindent(b.String(), "")
+	r.addEdit(r.Filename, &text.Extent{
+		Offset: r.OffsetOfPos(decl.End()),
+		Length: 0,
+	}, code)
+}
+
+// lockCalls returns the calls that lock and unlock the mutex, using the
+// read lock of a sync.RWMutex if read is true.
+func (r *EncapsulateGuardedMap) lockCalls(recv string, read bool) (string, string) {
+	mutex := recv + "." + r.mutex.Name()
+	if read && r.rw {
+		return mutex + ".RLock()", mutex + ".RUnlock()"
+	}
+	return mutex + ".Lock()", mutex + ".Unlock()"
+}
+
+// rewriteAccesses replaces direct accesses to the map's entries throughout
+// the package with calls to the accessor methods.
+func (r *EncapsulateGuardedMap) rewriteAccesses(config *Config) {
+	for _, file := range r.pkgInfo.Files {
+		filename := r.Program.Fset.Position(file.Package).Filename
+		var src []byte
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if s, ok := r.pkgInfo.Selections[sel]; !ok || s.Obj() != r.field {
+				return true
+			}
+			if src == nil {
+				if src = r.fileContents(config, filename); src == nil {
+					return false
+				}
+			}
+			r.rewriteAccess(file, filename, sel)
+			return true
+		})
+	}
+}
+
+// fileContents returns the contents of the given file, or nil (after logging
+// an error) if it cannot be read.
+func (r *EncapsulateGuardedMap) fileContents(config *Config, filename string) []byte {
+	if src, ok := r.src[filename]; ok {
+		return src
+	}
+	src := readFile(config, filename)
+	if src == nil {
+		r.Log.Errorf("%s could not be read", filename)
+	}
+	r.src[filename] = src
+	return src
+}
+
+// rewriteAccess replaces the given reference to the map field with a call to
+// an accessor method, if possible.
+func (r *EncapsulateGuardedMap) rewriteAccess(file *ast.File, filename string, sel *ast.SelectorExpr) {
+	path, _ := astutil.PathEnclosingInterval(file, sel.Pos(), sel.End())
+	for len(path) > 0 && path[0] != sel {
+		path = path[1:]
+	}
+	if len(path) < 2 {
+		return
+	}
+	if assign, ok := path[1].(*ast.AssignStmt); ok && isLhs(sel, assign) {
+		// Initializing the map, as in s.m = make(map[string]int)
+		return
+	}
+	if r.holdsLock(path) {
+		r.Log.Warnf("%s is accessed while %s is locked, so this access "+
+			"will not be changed", r.field.Name(), r.mutex.Name())
+		r.Log.AssociateNode(sel)
+		return
+	}
+
+	recv := r.textOf(filename, sel.X)
+	call := func(method string, args ...ast.Expr) string {
+		strs := []string{}
+		for _, arg := range args {
+			strs = append(strs, r.textOf(filename, arg))
+		}
+		return fmt.Sprintf("%s.%s(%s)", recv, method, strings.Join(strs, ", "))
+	}
+
+	switch parent := path[1].(type) {
+	case *ast.IndexExpr:
+		if parent.X != sel || len(path) < 3 {
+			break
+		}
+		switch grand := path[2].(type) {
+		case *ast.AssignStmt:
+			if grand.Tok == token.ASSIGN && len(grand.Lhs) == 1 &&
+				grand.Lhs[0] == parent && len(grand.Rhs) == 1 {
+				r.replace(filename, grand,
+					call(r.methods.set, parent.Index, grand.Rhs[0]))
+				return
+			}
+			if len(grand.Lhs) == 2 && len(grand.Rhs) == 1 &&
+				grand.Rhs[0] == parent {
+				r.replace(filename, parent,
+					call(r.methods.lookup, parent.Index))
+				return
+			}
+			if isLhs(parent, grand) {
+				break
+			}
+			r.replace(filename, parent, call(r.methods.get, parent.Index))
+			return
+		case *ast.ValueSpec:
+			if len(grand.Names) == 2 && len(grand.Values) == 1 {
+				r.replace(filename, parent,
+					call(r.methods.lookup, parent.Index))
+				return
+			}
+			r.replace(filename, parent, call(r.methods.get, parent.Index))
+			return
+		case *ast.IncDecStmt, *ast.UnaryExpr:
+			break
+		default:
+			r.replace(filename, parent, call(r.methods.get, parent.Index))
+			return
+		}
+
+	case *ast.CallExpr:
+		fn, ok := parent.Fun.(*ast.Ident)
+		if !ok || len(parent.Args) == 0 || parent.Args[0] != sel {
+			break
+		}
+		if _, ok := r.pkgInfo.Uses[fn].(*types.Builtin); !ok {
+			break
+		}
+		switch fn.Name {
+		case "delete":
+			r.replace(filename, parent, call(r.methods.delete, parent.Args[1]))
+			return
+		case "len":
+			r.replace(filename, parent, call(r.methods.len))
+			return
+		}
+	}
+
+	r.Log.Warnf("This use of %s cannot be replaced by a call to an "+
+		"accessor method", r.field.Name())
+	r.Log.AssociateNode(sel)
+}
+
+// isLhs returns true if the given expression is on the left-hand side of the
+// given assignment.
+func isLhs(expr ast.Expr, assign *ast.AssignStmt) bool {
+	for _, lhs := range assign.Lhs {
+		if lhs == expr {
+			return true
+		}
+	}
+	return false
+}
+
+// holdsLock returns true if the function enclosing the given path locks the
+// mutex guarding the map.
+func (r *EncapsulateGuardedMap) holdsLock(path []ast.Node) bool {
+	var body *ast.BlockStmt
+	for _, node := range path {
+		if fn, ok := node.(*ast.FuncDecl); ok {
+			body = fn.Body
+			break
+		}
+		if fn, ok := node.(*ast.FuncLit); ok {
+			body = fn.Body
+			break
+		}
+	}
+	if body == nil {
+		return false
+	}
+	result := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return !result
+		}
+		method, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || method.Sel.Name != "Lock" && method.Sel.Name != "RLock" {
+			return true
+		}
+		if mutex, ok := method.X.(*ast.SelectorExpr); ok {
+			if s, ok := r.pkgInfo.Selections[mutex]; ok && s.Obj() == r.mutex {
+				result = true
+			}
+		}
+		return !result
+	})
+	return result
+}
+
+// textOf returns the source text of the given node in the given file.
+func (r *EncapsulateGuardedMap) textOf(filename string, node ast.Node) string {
+	src := r.src[filename]
+	return string(src[r.OffsetOfPos(node.Pos()):r.OffsetOfPos(node.End())])
+}
+
+// replace adds an edit replacing the given node with the given text.
+func (r *EncapsulateGuardedMap) replace(filename string, node ast.Node, replacement string) {
+	r.addEdit(filename, r.Extent(node), replacement)
+}
+
+const encapsulateGuardedMapDoc = `
+  <h4>Purpose</h4>
+  <p>The Encapsulate Guarded Map refactoring generates accessor methods for a
+  map field of a struct that is guarded by a <tt>sync.Mutex</tt> or
+  <tt>sync.RWMutex</tt> field, so the locking is done in one place, and
+  replaces direct accesses to the map in the package with calls to those
+  methods.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the map field in the struct type declaration.</li>
+    <li>Activate the Encapsulate Guarded Map refactoring.</li>
+  </ol>
+
+  <p>For a field named <tt>cache</tt>, the methods <tt>getCache</tt>,
+  <tt>lookupCache</tt> (which also returns whether the key is present),
+  <tt>setCache</tt>, <tt>deleteCache</tt>, and <tt>cacheLen</tt> are generated
+  (their names are capitalized if the field is exported).  The mutex guarding
+  the map is the nearest mutex field declared before it; if it is a
+  <tt>sync.RWMutex</tt>, the read lock is used by methods that do not modify
+  the map.</p>
+
+  <p>Accesses in functions that lock the mutex themselves are not changed,
+  since calling an accessor there would deadlock.  Accesses that cannot be
+  expressed using the accessors (e.g., ranging over the map, or
+  <tt>m[k]++</tt>) are not changed either.  A warning is reported for each
+  access that is not changed.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of encapsulating the
+  <tt>users</tt> field.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type Registry struct {
+    mu    sync.RWMutex
+    <span class="highlight">users</span> map[string]int
+}
+
+func register(r *Registry) {
+    r.users["bob"] = 1
+    fmt.Println(len(r.users))
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Registry struct {
+    mu    sync.RWMutex
+    users map[string]int
+}
+
+// setUsers associates value with key in users.
+func (r *Registry) setUsers(key string, value int) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.users[key] = value
+}
+
+...
+
+func register(r *Registry) {
+    r.setUsers("bob", 1)
+    fmt.Println(r.usersLen())
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,380 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that extracts an HTTP handler from a
+// function literal passed to a route registration call.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/members"
+	"github.com/godoctor/godoctor/text"
+)
+
+// ExtractHandler is a refactoring that replaces a function literal with the
+// signature of an http.HandlerFunc (usually passed to http.HandleFunc or a
+// similar route registration method) with a reference to a new, named
+// handler.
+//
+// If the literal appears in a method, the handler becomes a method with the
+// same receiver (e.g., a method of the server struct), so the literal may
+// refer to the receiver; otherwise, it becomes a top-level function.  The
+// literal may not refer to any other local variables of the enclosing
+// function.  If the literal is converted to an http.HandlerFunc and passed to
+// Handle, the registration is simplified to a call to HandleFunc.
+type ExtractHandler struct {
+	RefactoringBase
+	// The function literal to extract
+	lit *ast.FuncLit
+	// The function declaration enclosing it
+	enclosing *ast.FuncDecl
+	// The receiver of the enclosing method, or nil
+	recv *types.Var
+}
+
+func (r *ExtractHandler) Description() *Description {
+	return &Description{
+		Name:      "Extract HTTP Handler",
+		Synopsis:  "Extracts an HTTP handler function literal into a named handler",
+		Usage:     "<new_name>",
+		Selection: "A function literal that handles HTTP requests",
+		HTMLDoc:   extractHandlerDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Handler Name:",
+			Prompt:       "Enter a name for the new handler.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *ExtractHandler) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	name := config.Args[0].(string)
+	if !isIdentifierValid(name) || isReservedWord(name) {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier", name)
+		r.Log.AssociateArg(0)
+		return &r.Result
+	}
+
+	r.findLiteral()
+	if r.lit == nil {
+		r.Log.Error("Please select a function literal with the signature " +
+			"func(http.ResponseWriter, *http.Request).")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if r.enclosing.Recv != nil && len(r.enclosing.Recv.List) > 0 &&
+		len(r.enclosing.Recv.List[0].Names) > 0 {
+		r.recv, _ = r.SelectedNodePkg.Defs[r.enclosing.Recv.List[0].Names[0]].(*types.Var)
+	}
+	if !r.checkName(name) || !r.checkFreeVariables() {
+		return &r.Result
+	}
+
+	r.addHandler(name)
+	r.replaceLiteral(name)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findLiteral finds the innermost function literal enclosing the selection
+// whose signature is that of an http.HandlerFunc, and the function
+// declaration enclosing it.
+func (r *ExtractHandler) findLiteral() {
+	for _, node := range r.PathEnclosingSelection {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			if r.lit == nil && isHandlerFunc(r.SelectedNodePkg.TypeOf(node)) {
+				r.lit = node
+			}
+		case *ast.FuncDecl:
+			if r.lit != nil {
+				r.enclosing = node
+				return
+			}
+		}
+	}
+	r.lit = nil
+}
+
+// isHandlerFunc returns true if the given type is the signature
+// func(http.ResponseWriter, *http.Request).
+func isHandlerFunc(t types.Type) bool {
+	sig, ok := t.(*types.Signature)
+	if !ok || sig.Params().Len() != 2 || sig.Results().Len() != 0 {
+		return false
+	}
+	ptr, ok := sig.Params().At(1).Type().(*types.Pointer)
+	return ok && isNamed(sig.Params().At(0).Type(), "net/http", "ResponseWriter") &&
+		isNamed(ptr.Elem(), "net/http", "Request")
+}
+
+// isNamed returns true if the given type is the named type with the given
+// name in the package with the given import path.
+func isNamed(t types.Type, path, name string) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == path && named.Obj().Name() == name
+}
+
+// checkName logs an error and returns false if the new handler's name would
+// conflict with an existing declaration.
+func (r *ExtractHandler) checkName(name string) bool {
+	if r.recv != nil {
+		if obj := members.Lookup(r.recv.Type(), r.SelectedNodePkg.Pkg, name); obj != nil {
+			r.Log.Errorf("The receiver already has a field or method "+
+				"named %s", name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+		return true
+	}
+	if obj := r.SelectedNodePkg.Pkg.Scope().Lookup(name); obj != nil {
+		r.Log.Errorf("The name %s is already declared in package %s",
+			name, r.SelectedNodePkg.Pkg.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+	if scope := r.SelectedNodePkg.Pkg.Scope().Innermost(r.lit.Pos()); scope != nil {
+		if _, obj := scope.LookupParent(name, r.lit.Pos()); obj != nil {
+			r.Log.Errorf("The name %s would refer to a different "+
+				"declaration where the handler is registered", name)
+			r.Log.AssociateNode(r.lit)
+			return false
+		}
+	}
+	return true
+}
+
+// checkFreeVariables logs an error and returns false if the literal refers
+// to any local declarations of the enclosing function (other than the
+// receiver of a method).
+func (r *ExtractHandler) checkFreeVariables() bool {
+	free := map[string]bool{}
+	ast.Inspect(r.lit.Body, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := r.SelectedNodePkg.Uses[id]
+		if obj == nil || obj == types.Object(r.recv) {
+			return true
+		}
+		if _, isLabel := obj.(*types.Label); isLabel {
+			return true
+		}
+		pos := obj.Pos()
+		if pos >= r.enclosing.Pos() && pos < r.enclosing.End() &&
+			(pos < r.lit.Pos() || pos >= r.lit.End()) {
+			free[obj.Name()] = true
+		}
+		return true
+	})
+	if len(free) == 0 {
+		return true
+	}
+	names := []string{}
+	for name := range free {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.Log.Errorf("The handler cannot be extracted because it refers to "+
+		"local declarations of %s: %s", r.enclosing.Name.Name,
+		strings.Join(names, ", "))
+	r.Log.AssociateNode(r.lit)
+	return false
+}
+
+// addHandler adds a declaration of the new handler following the enclosing
+// function declaration.
+func (r *ExtractHandler) addHandler(name string) {
+	var b bytes.Buffer
+	b.WriteString("\n\n")
+	if path := r.routePath(); path != "" {
+		fmt.Fprintf(&b, "// %s handles requests to %s.\n", name, path)
+	}
+	b.WriteString("func ")
+	if r.recv != nil {
+		fmt.Fprintf(&b, "(%s) ", r.TextFromPosRange(r.enclosing.Recv.Opening+1,
+			r.enclosing.Recv.Closing))
+	}
+	b.WriteString(name)
+	b.WriteString(r.TextFromPosRange(r.lit.Type.Params.Pos(), r.lit.Body.Pos()))
+
+	// Remove the indentation of the line containing the literal from the
+	// lines of its body
+	indent := Indentation(r.FileContents, r.OffsetOfPos(r.lit.Pos()))
+	lines := strings.SplitAfter(r.Text(r.lit.Body), "\n")
+	for i, line := range lines {
+		if i > 0 {
+			lines[i] = strings.TrimPrefix(line, indent)
+		}
+	}
+	b.WriteString(strings.Join(lines, ""))
+
+	r.Edits[r.Filename].Add(&text.Extent{
+		Offset: r.OffsetOfPos(r.enclosing.End()),
+		Length: 0,
+	}, b.String())
+}
+
+// routePath returns the route the handler is registered for, if the literal
+// is passed to a registration call whose first argument is a string literal,
+// and "" otherwise.
+func (r *ExtractHandler) routePath() string {
+	call, _ := r.registration()
+	if call == nil || len(call.Args) < 2 {
+		return ""
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	path, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// registration returns the call the literal is passed to, if any, and the
+// conversion of the literal to http.HandlerFunc it is passed as, if any.
+func (r *ExtractHandler) registration() (*ast.CallExpr, *ast.CallExpr) {
+	var conversion *ast.CallExpr
+	var arg ast.Expr = r.lit
+	for i, node := range r.PathEnclosingSelection {
+		if node != r.lit {
+			continue
+		}
+		for _, parent := range r.PathEnclosingSelection[i+1:] {
+			if paren, ok := parent.(*ast.ParenExpr); ok {
+				arg = paren
+				continue
+			}
+			call, ok := parent.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 || call.Args[len(call.Args)-1] != arg {
+				return nil, nil
+			}
+			if conversion == nil && len(call.Args) == 1 &&
+				isNamed(r.SelectedNodePkg.TypeOf(call), "net/http", "HandlerFunc") {
+				if tv, ok := r.SelectedNodePkg.Types[call.Fun]; ok && tv.IsType() {
+					conversion, arg = call, call
+					continue
+				}
+			}
+			return call, conversion
+		}
+	}
+	return nil, nil
+}
+
+// replaceLiteral replaces the literal with a reference to the new handler.
+// If the literal is converted to an http.HandlerFunc and passed to a Handle
+// function or method, the conversion is removed and HandleFunc is called
+// instead.
+func (r *ExtractHandler) replaceLiteral(name string) {
+	ref := name
+	if r.recv != nil {
+		ref = r.recv.Name() + "." + name
+	}
+	call, conversion := r.registration()
+	if call != nil && conversion != nil {
+		var fun *ast.Ident
+		switch f := call.Fun.(type) {
+		case *ast.Ident:
+			fun = f
+		case *ast.SelectorExpr:
+			fun = f.Sel
+		}
+		if fun != nil && fun.Name == "Handle" && r.hasHandleFunc(call.Fun) {
+			r.Edits[r.Filename].Add(r.Extent(fun), "HandleFunc")
+			r.Edits[r.Filename].Add(r.Extent(conversion), ref)
+			return
+		}
+	}
+	r.Edits[r.Filename].Add(r.Extent(r.lit), ref)
+}
+
+// hasHandleFunc returns true if the given function is http.Handle or a Handle
+// method whose receiver also has a HandleFunc method (e.g., that of
+// http.ServeMux).
+func (r *ExtractHandler) hasHandleFunc(fun ast.Expr) bool {
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if selection, ok := r.SelectedNodePkg.Selections[sel]; ok {
+		return members.Lookup(selection.Recv(), r.SelectedNodePkg.Pkg,
+			"HandleFunc") != nil
+	}
+	obj := r.SelectedNodePkg.Uses[sel.Sel]
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == "net/http"
+}
+
+const extractHandlerDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract HTTP Handler refactoring replaces a function literal with the
+  signature <tt>func(http.ResponseWriter, *http.Request)</tt>, such as one
+  passed to <tt>http.HandleFunc</tt>, with a reference to a new, named
+  handler.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the function literal (or any part of it).</li>
+    <li>Activate the Extract HTTP Handler refactoring.</li>
+    <li>Enter a name for the new handler.</li>
+  </ol>
+
+  <p>If the literal appears in a method (e.g., a method of a server struct
+  that registers its routes), the handler becomes a method with the same
+  receiver; otherwise, it becomes a top-level function.  The literal may refer
+  to the receiver, but not to other local variables of the enclosing
+  function.  If the literal is converted to an <tt>http.HandlerFunc</tt> and
+  passed to <tt>Handle</tt>, the registration is changed to call
+  <tt>HandleFunc</tt> instead.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of extracting a handler named
+  <tt>handleHealth</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func (s *Server) routes() {
+    s.mux.HandleFunc("/health", <span class="highlight">func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintln(w, s.status)
+    }</span>)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func (s *Server) routes() {
+    s.mux.HandleFunc("/health", s.handleHealth)
+}
+
+// handleHealth handles requests to /health.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+    fmt.Fprintln(w, s.status)
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,250 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains utility methods for refactorings that change the import
+// paths of packages or remove imports that are no longer used.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// importCommentRegexp matches an import comment, i.e., a comment of the form
+// // import "path" or /* import "path" */ following a package clause.  The
+// first subexpression matches the quoted import path.
+var importCommentRegexp = regexp.MustCompile(`^(?://|/\*)\s*import\s+("[^"]*")`)
+
+// rewriteImportPaths adds edits to r.Edits that change the import paths in
+// the given file.  For each import path in the file (including the path in the
+// import comment, if any), rewrite is invoked; if it returns true, the path is
+// replaced by the returned path.  Local names given to imports (e.g., import
+// x "path") are unaffected.  rewriteImportPaths returns the import specs whose
+// paths were changed.
+func (r *RefactoringBase) rewriteImportPaths(fset *token.FileSet, file *ast.File, rewrite func(path string) (string, bool)) []*ast.ImportSpec {
+	filename := fset.Position(file.Package).Filename
+	changed := []*ast.ImportSpec{}
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if newPath, ok := rewrite(path); ok && newPath != path {
+			r.replaceImportPath(filename, &text.Extent{
+				Offset: fset.Position(spec.Path.Pos()).Offset,
+				Length: len(spec.Path.Value),
+			}, newPath)
+			changed = append(changed, spec)
+		}
+	}
+
+	if comment := importComment(fset, file); comment != nil {
+		match := importCommentRegexp.FindStringSubmatchIndex(comment.Text)
+		path, err := strconv.Unquote(comment.Text[match[2]:match[3]])
+		if err == nil {
+			if newPath, ok := rewrite(path); ok && newPath != path {
+				r.replaceImportPath(filename, &text.Extent{
+					Offset: fset.Position(comment.Pos()).Offset + match[2],
+					Length: match[3] - match[2],
+				}, newPath)
+			}
+		}
+	}
+	return changed
+}
+
+// rewriteImportsInProgram invokes rewriteImportPaths on every file in the
+// program (excluding files in $GOROOT), as well as on any other .go files in
+// the same directories that are not part of the program (e.g., test files).
+// If changed is non-nil, it is invoked for each import spec in the program
+// whose path was changed, along with the package and file containing it.
+func (r *RefactoringBase) rewriteImportsInProgram(config *Config, rewrite func(path string) (string, bool), changed func(pkgInfo *loader.PackageInfo, filename string, spec *ast.ImportSpec)) {
+	seen := map[string]bool{}
+	dirs := []string{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for _, file := range pkgInfo.Files {
+			filename := r.Program.Fset.Position(file.Package).Filename
+			if isInGoRoot(filename) {
+				continue
+			}
+			seen[filename] = true
+			if dir := filepath.Dir(filename); !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+			for _, spec := range r.rewriteImportPaths(r.Program.Fset, file, rewrite) {
+				if changed != nil {
+					changed(pkgInfo, filename, spec)
+				}
+			}
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		fileInfos, err := config.FileSystem.ReadDir(dir)
+		if err != nil {
+			r.Log.Error(err)
+			return
+		}
+		for _, fi := range fileInfos {
+			filename := filepath.Join(dir, fi.Name())
+			if fi.IsDir() || !strings.HasSuffix(filename, ".go") || seen[filename] {
+				continue
+			}
+			file, err := parseImports(config, fset, filename)
+			if err != nil {
+				r.Log.Warnf("Import paths in %s could not be updated: %s",
+					fi.Name(), err)
+				continue
+			}
+			r.rewriteImportPaths(fset, file, rewrite)
+		}
+	}
+}
+
+func (r *RefactoringBase) replaceImportPath(filename string, extent *text.Extent, newPath string) {
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	r.Edits[filename].Add(extent, strconv.Quote(newPath))
+}
+
+// importComment returns the import comment following the package clause in
+// the given file, or nil if there is no import comment.
+func importComment(fset *token.FileSet, file *ast.File) *ast.Comment {
+	line := fset.Position(file.Name.End()).Line
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Pos() < file.Name.End() {
+				continue
+			}
+			if fset.Position(comment.Pos()).Line != line {
+				return nil
+			}
+			if importCommentRegexp.MatchString(comment.Text) {
+				return comment
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseImports parses the package clause and imports of the given file (which
+// is read from the refactoring's file system), along with its comments.  It
+// is used to find imports in files that are not part of the loaded program,
+// such as external test files.
+func parseImports(config *Config, fset *token.FileSet, filename string) (*ast.File, error) {
+	reader, err := config.FileSystem.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	src, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseFile(fset, filename, src,
+		parser.ImportsOnly|parser.ParseComments)
+}
+
+// importedPkgName returns the PkgName declared by the given import spec, or
+// nil if it could not be type checked.
+func importedPkgName(pkgInfo *loader.PackageInfo, spec *ast.ImportSpec) *types.PkgName {
+	var obj types.Object
+	if spec.Name != nil {
+		obj = pkgInfo.Defs[spec.Name]
+	} else {
+		obj = pkgInfo.Implicits[spec]
+	}
+	pkgName, _ := obj.(*types.PkgName)
+	return pkgName
+}
+
+// unusedImports returns the import specs in the given file that would no
+// longer be used if the identifiers in removed were deleted.  Blank and dot
+// imports are never considered unused.
+func unusedImports(pkgInfo *loader.PackageInfo, file *ast.File, removed map[*ast.Ident]bool) []*ast.ImportSpec {
+	used := map[*types.PkgName]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !removed[id] {
+			if pkgName, ok := pkgInfo.Uses[id].(*types.PkgName); ok {
+				used[pkgName] = true
+			}
+		}
+		return true
+	})
+	result := []*ast.ImportSpec{}
+	for _, spec := range file.Imports {
+		pkgName := importedPkgName(pkgInfo, spec)
+		if pkgName == nil || pkgName.Name() == "_" || pkgName.Name() == "." {
+			continue
+		}
+		if !used[pkgName] {
+			result = append(result, spec)
+		}
+	}
+	return result
+}
+
+// deleteImport adds an edit to r.Edits that removes the given import spec from
+// the given file, whose contents are src.  If the spec is the only one in its
+// import declaration, the entire declaration is removed.  Lines that would be
+// left empty are removed as well.
+func (r *RefactoringBase) deleteImport(fset *token.FileSet, file *ast.File, src []byte, spec *ast.ImportSpec) {
+	var node ast.Node = spec
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT &&
+			len(decl.Specs) == 1 && decl.Specs[0] == spec {
+			node = decl
+		}
+	}
+	start := fset.Position(node.Pos()).Offset
+	end := fset.Position(node.End()).Offset
+	if spec.Comment != nil && node == spec {
+		end = fset.Position(spec.Comment.End()).Offset
+	}
+
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	lineEnd := bytes.IndexByte(src[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += end + 1
+	}
+	if len(bytes.TrimSpace(src[lineStart:start])) == 0 &&
+		len(bytes.TrimSpace(src[end:lineEnd])) == 0 {
+		// Remove entire lines, and avoid leaving two blank lines
+		start, end = lineStart, lineEnd
+		if start >= 2 && src[start-2] == '\n' &&
+			end < len(src) && src[end] == '\n' {
+			end++
+		}
+	} else {
+		// Remove a trailing semicolon, as in import ("a"; "b")
+		rest := bytes.TrimLeft(src[end:lineEnd], " \t")
+		if len(rest) > 0 && rest[0] == ';' {
+			end = lineEnd - len(rest) + 1
+		}
+	}
+
+	filename := fset.Position(file.Package).Filename
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	r.Edits[filename].Add(&text.Extent{Offset: start, Length: end - start}, "")
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains utilities for emitting source code that matches the
+// indentation style of the file it is inserted into, rather than go/printer's
+// default (tab) indentation.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// An IndentStyle describes the indentation used in a Go source file.
+type IndentStyle struct {
+	// The text used for one level of indentation: a tab (as in gofmt'ed
+	// code) or some number of spaces
+	Unit string
+}
+
+// GofmtStyle is the indentation style used by gofmt and go/printer.
+var GofmtStyle = IndentStyle{Unit: "\t"}
+
+// DetectIndentStyle determines the indentation style of the given Go source
+// code.  If most indented lines are indented with spaces, the unit of
+// indentation is the most common increase in indentation from one line to the
+// next; otherwise (or if there are no indented lines), it is GofmtStyle.
+func DetectIndentStyle(src []byte) IndentStyle {
+	tabLines, spaceLines := 0, 0
+	increments := map[int]int{}
+	prev := 0
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		spaces := len(line) - len(bytes.TrimLeft(line, " "))
+		switch {
+		case line[0] == '\t':
+			tabLines++
+		case spaces > 0:
+			spaceLines++
+			if spaces > prev {
+				increments[spaces-prev]++
+			}
+		}
+		prev = spaces
+	}
+	if spaceLines <= tabLines {
+		return GofmtStyle
+	}
+	unit, count := 0, 0
+	for increment, n := range increments {
+		if n > count || n == count && increment < unit {
+			unit, count = increment, n
+		}
+	}
+	if unit == 0 {
+		return GofmtStyle
+	}
+	return IndentStyle{Unit: strings.Repeat(" ", unit)}
+}
+
+// Reindent converts Go source code indented with tabs (e.g., the output of
+// go/printer) to this indentation style.  Each line except the first is also
+// prefixed with the given indentation, so code can be inserted at a position
+// that is already indented (see Indentation).  Lines inside raw string
+// literals are not modified.  If the code cannot be tokenized, it is
+// reindented as if it contained no raw string literals.
+func (style IndentStyle) Reindent(code string, prefix string) string {
+	if style == GofmtStyle && prefix == "" {
+		return code
+	}
+	inRawString := rawStringLines(code)
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if inRawString[i] {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			lines[i] = strings.TrimLeft(line, " \t")
+			continue
+		}
+		tabs := len(line) - len(strings.TrimLeft(line, "\t"))
+		indent := strings.Repeat(style.Unit, tabs)
+		if i > 0 {
+			indent = prefix + indent
+		}
+		lines[i] = indent + line[tabs:]
+	}
+	return strings.Join(lines, "")
+}
+
+// shiftIndentation moves Go source code from a line with the given
+// indentation to a line with the given new indentation: each line except the
+// first that begins with the old indentation has it replaced with the new
+// indentation.  Lines inside raw string literals are not modified.
+func shiftIndentation(code string, from, to string) string {
+	inRawString := rawStringLines(code)
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if i > 0 && !inRawString[i] && strings.HasPrefix(line, from) {
+			lines[i] = to + line[len(from):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// rawStringLines returns the (0-based) indices of the lines of the given
+// source code that begin inside a raw string literal.
+func rawStringLines(code string) map[int]bool {
+	result := map[int]bool{}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(code))
+	var s scanner.Scanner
+	s.Init(file, []byte(code), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING && strings.HasPrefix(lit, "`") {
+			start := file.Line(pos)
+			end := start + strings.Count(lit, "\n")
+			for line := start + 1; line <= end; line++ {
+				result[line-1] = true
+			}
+		}
+	}
+	return result
+}
+
+// Indentation returns the whitespace at the beginning of the line containing
+// the given offset in the given source code.
+func Indentation(src []byte, offset int) string {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
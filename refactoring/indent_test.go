@@ -0,0 +1,48 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import "testing"
+
+func TestDetectIndentStyle(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"package p", "\t"},
+		{"package p\n\nfunc f() {\n\tx := 1\n}\n", "\t"},
+		{"package p\n\nfunc f() {\n    if x {\n        y()\n    }\n}\n", "    "},
+		{"package p\n\nfunc f() {\n  if x {\n    y()\n  }\n}\n", "  "},
+		{"package p\n\nvar x = []int{\n    1,\n    2,\n}\n\nfunc f() {\n\tx()\n}\n", "    "},
+	}
+	for _, tst := range tests {
+		if actual := DetectIndentStyle([]byte(tst.src)).Unit; actual != tst.expected {
+			t.Errorf("DetectIndentStyle(%q) = %q, expected %q",
+				tst.src, actual, tst.expected)
+		}
+	}
+}
+
+func TestReindent(t *testing.T) {
+	code := "func f() {\n\tif x {\n\t\ty(`a\n\tb`)\n\t}\n\n}"
+	expected := "func f() {\n      if x {\n          y(`a\n\tb`)\n      }\n\n  }"
+	actual := IndentStyle{Unit: "    "}.Reindent(code, "  ")
+	if actual != expected {
+		t.Fatalf("Expected:\n%s\nActual:\n%s", expected, actual)
+	}
+	if actual := GofmtStyle.Reindent(code, ""); actual != code {
+		t.Fatalf("Expected:\n%s\nActual:\n%s", code, actual)
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	src := []byte("package p\n\nfunc f() {\n    x := 1\n}\n")
+	if actual := Indentation(src, 22); actual != "    " {
+		t.Fatalf("Expected four spaces, got %q", actual)
+	}
+	if actual := Indentation(src, 0); actual != "" {
+		t.Fatalf("Expected no indentation, got %q", actual)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that moves a package into an internal
+// directory, restricting which packages are allowed to import it.
+
+package refactoring
+
+import (
+	"go/ast"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"golang.org/x/tools/go/loader"
+)
+
+// MoveToInternal is a refactoring that moves the package containing the
+// selected file into an internal/ directory and updates the import paths of
+// all packages in the scope that import it.
+//
+// By default, the internal/ directory is created in the parent of the
+// package's directory, so moving the package a/b/c produces a/b/internal/c.
+// Optionally, the import path of an ancestor package can be given, in which
+// case the package is moved under that ancestor's internal/ directory (e.g.,
+// moving a/b/c with the argument a produces a/internal/b/c).
+type MoveToInternal struct {
+	RefactoringBase
+}
+
+func (r *MoveToInternal) Description() *Description {
+	return &Description{
+		Name:      "Move to Internal",
+		Synopsis:  "Moves a package into an internal directory",
+		Usage:     "[<parent_package>]",
+		Selection: "",
+		HTMLDoc:   internalDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Parent Package:",
+			Prompt:       "Import path of the package that will contain internal/ (default: the parent directory)",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *MoveToInternal) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	for _, pkgInfo := range r.Program.Created {
+		if pkgInfo == r.SelectedNodePkg {
+			r.Log.Error("Please select a file in a package that is imported by another package in the scope.")
+			return &r.Result
+		}
+	}
+
+	oldPath := r.SelectedNodePkg.Pkg.Path()
+	for _, elt := range strings.Split(oldPath, "/") {
+		if elt == "internal" {
+			r.Log.Errorf("The package %s is already internal.", oldPath)
+			return &r.Result
+		}
+	}
+
+	parent := path.Dir(oldPath)
+	if len(config.Args) > 0 && config.Args[0].(string) != "" {
+		parent = strings.TrimSuffix(config.Args[0].(string), "/")
+	}
+	if parent == "." || !strings.HasPrefix(oldPath, parent+"/") {
+		r.Log.Errorf("%s is not in a subdirectory of %s, so it cannot be moved into %s/internal.",
+			oldPath, parent, parent)
+		if len(config.Args) > 0 && config.Args[0].(string) != "" {
+			r.Log.AssociateArg(0)
+		}
+		return &r.Result
+	}
+	newPath := parent + "/internal/" + strings.TrimPrefix(oldPath, parent+"/")
+
+	// Determine the directories corresponding to the old and new paths
+	oldDir := filepath.Dir(r.Filename)
+	if !strings.HasSuffix(filepath.ToSlash(oldDir), "/"+oldPath) {
+		r.Log.Errorf("The directory %s does not correspond to the import path %s", oldDir, oldPath)
+		return &r.Result
+	}
+	srcDir := filepath.Clean(oldDir[:len(oldDir)-len(oldPath)])
+	newDir := filepath.Join(srcDir, filepath.FromSlash(newPath))
+	parentDir := filepath.Join(srcDir, filepath.FromSlash(parent))
+	if _, err := config.FileSystem.ReadDir(newDir); err == nil {
+		r.Log.Errorf("The package cannot be moved to %s because that directory already exists.", newPath)
+		return &r.Result
+	}
+
+	r.Log.Infof("Moving %s to %s", oldPath, newPath)
+	r.updateImporters(config, oldPath, newPath, parent, parentDir)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.moveFiles(config, oldDir, newDir, srcDir)
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// updateImporters changes the import path of the moved package in every file
+// in the program that imports it, as well as in any import comment in the
+// package itself.  Warnings are logged for importers that are not in the
+// directory tree rooted at parentDir (the directory of the package parent),
+// since the Go toolchain will not allow them to import the package after it
+// has been moved.
+func (r *MoveToInternal) updateImporters(config *Config, oldPath, newPath, parent, parentDir string) {
+	rewrite := func(path string) (string, bool) {
+		return newPath, path == oldPath
+	}
+	r.rewriteImportsInProgram(config, rewrite, func(_ *loader.PackageInfo, filename string, spec *ast.ImportSpec) {
+		if !isInDir(filepath.Dir(filename), parentDir) {
+			r.Log.Warnf("%s imports %s, but only packages in %s will be allowed to import it once it is internal",
+				filepath.Base(filename), oldPath, parent)
+			r.Log.AssociateNode(spec)
+		}
+	})
+}
+
+// moveFiles adds file system changes that create the new package directory
+// (and any missing parent directories), move all of the files in the package
+// directory into it, and remove the old directory if it is empty.
+func (r *MoveToInternal) moveFiles(config *Config, oldDir, newDir, srcDir string) {
+	dirsToCreate := []string{}
+	for dir := newDir; dir != srcDir && len(dir) > len(srcDir); dir = filepath.Dir(dir) {
+		if _, err := config.FileSystem.ReadDir(dir); err == nil {
+			break
+		}
+		dirsToCreate = append([]string{dir}, dirsToCreate...)
+	}
+	for _, dir := range dirsToCreate {
+		r.FSChanges = append(r.FSChanges, &filesystem.CreateDirectory{Path: dir})
+	}
+
+	fileInfos, err := config.FileSystem.ReadDir(oldDir)
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	hasSubdirectories := false
+	for _, fi := range fileInfos {
+		if fi.IsDir() {
+			hasSubdirectories = true
+			continue
+		}
+		r.FSChanges = append(r.FSChanges, &filesystem.Move{
+			Path:    filepath.Join(oldDir, fi.Name()),
+			NewPath: filepath.Join(newDir, fi.Name()),
+		})
+	}
+	if hasSubdirectories {
+		r.Log.Warnf("%s contains subdirectories, which will not be moved", oldDir)
+	} else {
+		r.FSChanges = append(r.FSChanges, &filesystem.Remove{Path: oldDir})
+	}
+}
+
+// isInDir returns true iff the path is the directory dir or a subdirectory of
+// it.
+func isInDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+const internalDoc = `
+  <h4>Purpose</h4>
+  <p>The Move to Internal refactoring moves a package into an
+  <tt>internal/</tt> directory, so that it can only be imported by packages in
+  the directory tree rooted at the parent of <tt>internal/</tt>.  Every import
+  of the package in the refactoring scope is updated to use the new import
+  path.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Open a file in the package to be moved.</li>
+    <li>Activate the Move to Internal refactoring.</li>
+    <li>Optionally, enter the import path of an ancestor package in which
+    <tt>internal/</tt> should be created.  By default, it is created in the
+    parent directory of the package.</li>
+  </ol>
+
+  <p>All of the files in the package directory are moved into the new
+  directory.  If any package in the scope imports the moved package but is
+  outside the directory tree that is allowed to import it, a warning is
+  reported, since that import will no longer compile.  Importers outside the
+  refactoring scope are not updated.</p>
+
+  <h4>Example</h4>
+  <p>Moving the package <tt>example.com/lib/util</tt> produces the package
+  <tt>example.com/lib/internal/util</tt>.  A file in
+  <tt>example.com/lib</tt> that imports it is changed as follows.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>package lib
+
+import "example.com/lib/util"</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>package lib
+
+import "example.com/lib/internal/util"</pre>
+      </td>
+    </tr>
+  </table>
+`
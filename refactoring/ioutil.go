@@ -0,0 +1,301 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that replaces uses of the deprecated
+// io/ioutil package with their equivalents in the io and os packages.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// An ioutilReplacement describes the replacement for a member of io/ioutil.
+type ioutilReplacement struct {
+	path, name string
+}
+
+// ioutilReplacements maps each member of io/ioutil to its replacement.
+var ioutilReplacements = map[string]ioutilReplacement{
+	"Discard":   {"io", "Discard"},
+	"NopCloser": {"io", "NopCloser"},
+	"ReadAll":   {"io", "ReadAll"},
+	"ReadDir":   {"os", "ReadDir"},
+	"ReadFile":  {"os", "ReadFile"},
+	"TempDir":   {"os", "MkdirTemp"},
+	"TempFile":  {"os", "CreateTemp"},
+	"WriteFile": {"os", "WriteFile"},
+}
+
+// dirEntryMethods contains the names of the methods that os.DirEntry and
+// os.FileInfo have in common.
+var dirEntryMethods = map[string]bool{
+	"Name":  true,
+	"IsDir": true,
+}
+
+// MigrateIoutil is a transformation that replaces every reference to a member
+// of the deprecated io/ioutil package in the scope with its replacement in the
+// io or os package (e.g., ioutil.ReadFile becomes os.ReadFile), adjusting
+// imports accordingly.
+//
+// ioutil.ReadDir returns a []os.FileInfo, while os.ReadDir returns a
+// []os.DirEntry.  A call to ioutil.ReadDir is only replaced if its result is
+// assigned to a new variable whose elements are only used to call methods the
+// two types have in common (Name and IsDir); otherwise, a warning is logged,
+// and the call is left unchanged.
+type MigrateIoutil struct {
+	RefactoringBase
+	// Whether any file imported io/ioutil
+	found bool
+}
+
+func (r *MigrateIoutil) Description() *Description {
+	return &Description{
+		Name:           "Migrate io/ioutil",
+		Synopsis:       "Replaces uses of the deprecated io/ioutil package with io and os",
+		Usage:          "",
+		Selection:      "",
+		HTMLDoc:        migrateIoutilDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *MigrateIoutil) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	for _, pkgInfo := range r.migrationCandidates(isIoutil) {
+		for _, file := range pkgInfo.Files {
+			r.migrateFile(config, pkgInfo, file)
+		}
+	}
+	if !r.found {
+		r.Log.Error("No files import io/ioutil")
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// isIoutil returns true if the given import path is io/ioutil.
+func isIoutil(path string) bool {
+	return path == "io/ioutil"
+}
+
+// An ioutilMigration contains the state used to migrate a single file.
+type ioutilMigration struct {
+	*fileMigration
+}
+
+// migrateFile replaces references to io/ioutil in the given file.
+func (r *MigrateIoutil) migrateFile(config *Config, pkgInfo *loader.PackageInfo, file *ast.File) {
+	if !importsPackage(pkgInfo, file, isIoutil) {
+		return
+	}
+	r.found = true
+	fm := r.newFileMigration(config, pkgInfo, file)
+	if fm == nil {
+		return
+	}
+	m := &ioutilMigration{fm}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			m.migrateReference(sel)
+		}
+		return true
+	})
+	for _, spec := range unusedImports(m.pkgInfo, m.file, m.removed) {
+		if isIoutil(importedPkgName(m.pkgInfo, spec).Imported().Path()) {
+			m.removeImport(spec)
+		}
+	}
+	m.finish()
+}
+
+// migrateReference replaces the given selector expression with a reference
+// to the replacement for the member of io/ioutil it refers to, if any.
+func (m *ioutilMigration) migrateReference(sel *ast.SelectorExpr) {
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return
+	}
+	pkgName, ok := m.pkgInfo.Uses[id].(*types.PkgName)
+	if !ok || !isIoutil(pkgName.Imported().Path()) {
+		return
+	}
+	replacement, ok := ioutilReplacements[sel.Sel.Name]
+	if !ok {
+		return
+	}
+	if sel.Sel.Name == "ReadDir" && !m.canReplaceReadDir(sel) {
+		m.r.Log.Warn("The result of ioutil.ReadDir is used as a " +
+			"[]os.FileInfo, so it cannot be replaced by os.ReadDir, " +
+			"which returns a []os.DirEntry")
+		m.r.Log.AssociateNode(sel)
+		return
+	}
+	m.replace(sel.Pos(), sel.End(), m.qualify(replacement.path,
+		replacement.path, replacement.name, sel.Pos()))
+	m.removed[id] = true
+}
+
+// canReplaceReadDir determines whether the given reference to ioutil.ReadDir
+// can be replaced by os.ReadDir, i.e., whether it is called, the first result
+// is assigned to a new variable (as in entries, err := ioutil.ReadDir(dir)),
+// and that variable is only used in len(entries), range entries, and
+// entries[i], where each element is only used to call Name or IsDir.
+func (m *ioutilMigration) canReplaceReadDir(sel *ast.SelectorExpr) bool {
+	path, _ := astutil.PathEnclosingInterval(m.file, sel.Pos(), sel.End())
+	if len(path) < 3 {
+		return false
+	}
+	call, ok := path[1].(*ast.CallExpr)
+	if !ok || call.Fun != sel {
+		return false
+	}
+	assign, ok := path[2].(*ast.AssignStmt)
+	if !ok || len(assign.Rhs) != 1 || len(assign.Lhs) == 0 {
+		return false
+	}
+	id, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if id.Name == "_" {
+		return true
+	}
+	v, ok := m.pkgInfo.Defs[id].(*types.Var)
+	if !ok {
+		return false
+	}
+	for _, use := range m.usesOf(v) {
+		if !m.isDirEntriesUse(use) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDirEntriesUse returns true if the given use of a variable holding the
+// result of os.ReadDir would also be valid for the result of ioutil.ReadDir.
+func (m *ioutilMigration) isDirEntriesUse(use *ast.Ident) bool {
+	path, _ := astutil.PathEnclosingInterval(m.file, use.Pos(), use.End())
+	if len(path) < 2 {
+		return false
+	}
+	switch parent := path[1].(type) {
+	case *ast.CallExpr:
+		// len(entries)
+		fn, ok := parent.Fun.(*ast.Ident)
+		if !ok || len(parent.Args) != 1 {
+			return false
+		}
+		_, isBuiltin := m.pkgInfo.Uses[fn].(*types.Builtin)
+		return isBuiltin && fn.Name == "len"
+
+	case *ast.RangeStmt:
+		// for _, entry := range entries
+		if parent.X != use {
+			return false
+		}
+		value, ok := parent.Value.(*ast.Ident)
+		if !ok {
+			return parent.Value == nil
+		}
+		v, ok := m.pkgInfo.Defs[value].(*types.Var)
+		if !ok {
+			return value.Name == "_"
+		}
+		for _, elementUse := range m.usesOf(v) {
+			elementPath, _ := astutil.PathEnclosingInterval(m.file,
+				elementUse.Pos(), elementUse.End())
+			if !m.isDirEntryMethodCall(elementUse, elementPath[1:]) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.IndexExpr:
+		// entries[i]
+		return parent.X == use && m.isDirEntryMethodCall(parent, path[2:])
+
+	default:
+		return false
+	}
+}
+
+// isDirEntryMethodCall returns true if the given expression (whose enclosing
+// nodes are given by path, starting with its parent) is the receiver in a call
+// to a method that os.DirEntry and os.FileInfo have in common.
+func (m *ioutilMigration) isDirEntryMethodCall(expr ast.Expr, path []ast.Node) bool {
+	if len(path) < 2 {
+		return false
+	}
+	sel, ok := path[0].(*ast.SelectorExpr)
+	if !ok || sel.X != expr || !dirEntryMethods[sel.Sel.Name] {
+		return false
+	}
+	call, ok := path[1].(*ast.CallExpr)
+	return ok && call.Fun == sel
+}
+
+// usesOf returns the identifiers in the file that refer to the given
+// variable.
+func (m *ioutilMigration) usesOf(v *types.Var) []*ast.Ident {
+	result := []*ast.Ident{}
+	ast.Inspect(m.file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && m.pkgInfo.Uses[id] == v {
+			result = append(result, id)
+		}
+		return true
+	})
+	return result
+}
+
+const migrateIoutilDoc = `
+  <h4>Purpose</h4>
+  <p>The Migrate io/ioutil transformation replaces uses of the deprecated
+  <tt>io/ioutil</tt> package with their equivalents in the <tt>io</tt> and
+  <tt>os</tt> packages, in every file in the refactoring scope.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Activate the Migrate io/ioutil transformation.</li>
+  </ol>
+
+  <p>References are replaced as follows:</p>
+  <table cellspacing="5" cellpadding="5" style="border: 0;">
+    <tr><th>Before</th><th>After</th></tr>
+    <tr><td><tt>ioutil.Discard</tt></td><td><tt>io.Discard</tt></td></tr>
+    <tr><td><tt>ioutil.NopCloser</tt></td><td><tt>io.NopCloser</tt></td></tr>
+    <tr><td><tt>ioutil.ReadAll</tt></td><td><tt>io.ReadAll</tt></td></tr>
+    <tr><td><tt>ioutil.ReadDir</tt></td><td><tt>os.ReadDir</tt></td></tr>
+    <tr><td><tt>ioutil.ReadFile</tt></td><td><tt>os.ReadFile</tt></td></tr>
+    <tr><td><tt>ioutil.TempDir</tt></td><td><tt>os.MkdirTemp</tt></td></tr>
+    <tr><td><tt>ioutil.TempFile</tt></td><td><tt>os.CreateTemp</tt></td></tr>
+    <tr><td><tt>ioutil.WriteFile</tt></td><td><tt>os.WriteFile</tt></td></tr>
+  </table>
+
+  <p>Imports are updated accordingly.</p>
+
+  <p><tt>ioutil.ReadDir</tt> returns a slice of <tt>os.FileInfo</tt>, while
+  <tt>os.ReadDir</tt> returns a slice of <tt>os.DirEntry</tt>, which only has
+  the <tt>Name</tt> and <tt>IsDir</tt> methods in common with
+  <tt>os.FileInfo</tt>.  A call to <tt>ioutil.ReadDir</tt> is only replaced if
+  its result is assigned to a new variable that is only used to call those
+  methods on its elements (or to get its length).  Otherwise, a warning is
+  reported, and the call is left unchanged.  The resulting code requires Go
+  1.16 or later.</p>
+`
@@ -0,0 +1,201 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that converts unkeyed struct literals
+// into keyed literals.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// KeyStructLiterals is a transformation that adds field names to unkeyed
+// composite literals of struct types (e.g., Point{1, 2} becomes
+// Point{X: 1, Y: 2}), so the literals remain correct if fields are later
+// added to or reordered in the struct.
+//
+// If the selection is the name of a struct type, only literals of that type
+// are changed; otherwise, unkeyed literals of every struct type are changed
+// in every file in the scope.  The values in the literals are not changed, so
+// comments and formatting within them are preserved.
+type KeyStructLiterals struct {
+	RefactoringBase
+	// The type whose literals are changed, or nil to change all literals
+	target *types.TypeName
+}
+
+func (r *KeyStructLiterals) Description() *Description {
+	return &Description{
+		Name:           "Convert to Keyed Literals",
+		Synopsis:       "Adds field names to unkeyed struct literals",
+		Usage:          "",
+		Selection:      "The name of a struct type (optional)",
+		HTMLDoc:        keyStructLiteralsDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *KeyStructLiterals) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.target = r.selectedStructType()
+
+	count := 0
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		for _, file := range pkgInfo.Files {
+			count += r.keyLiterals(pkgInfo, file)
+		}
+	}
+	if count == 0 {
+		if r.target != nil {
+			r.Log.Errorf("No unkeyed literals of %s were found",
+				r.target.Name())
+			r.Log.AssociateNode(r.SelectedNode)
+		} else {
+			r.Log.Error("No unkeyed struct literals were found")
+		}
+		return &r.Result
+	}
+	r.Log.Infof("%d literal(s) will be converted to keyed literals", count)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedStructType returns the struct type whose name (or the name of an
+// alias for it) is selected, or nil if the selection is not the name of a
+// struct type.
+func (r *RefactoringBase) selectedStructType() *types.TypeName {
+	if r.SelectedNodePkg == nil {
+		return nil
+	}
+	id, ok := r.SelectedNode.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	obj := r.SelectedNodePkg.ObjectOf(id)
+	if tn, ok := obj.(*types.TypeName); ok {
+		// The type denoted by an alias is changed, not the alias
+		if named, ok := types.Unalias(tn.Type()).(*types.Named); ok {
+			tn = named.Obj()
+		}
+		if _, ok := tn.Type().Underlying().(*types.Struct); ok {
+			return tn
+		}
+	}
+	return nil
+}
+
+// keyLiterals adds field names to each unkeyed struct literal in the given
+// file, returning the number of literals changed.
+func (r *KeyStructLiterals) keyLiterals(pkgInfo *loader.PackageInfo, file *ast.File) int {
+	count := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || len(lit.Elts) == 0 {
+			return true
+		}
+		if _, ok := lit.Elts[0].(*ast.KeyValueExpr); ok {
+			return true
+		}
+		st := structTypeOf(pkgInfo.TypeOf(lit), r.target)
+		if st == nil || st.NumFields() != len(lit.Elts) {
+			return true
+		}
+		for i, elt := range lit.Elts {
+			r.insert(elt, st.Field(i).Name()+": ")
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// structTypeOf returns the struct type underlying the given type of a
+// composite literal, or nil if it is not a struct type or (if target is
+// non-nil) not the named type declared by target.
+func structTypeOf(t types.Type, target *types.TypeName) *types.Struct {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	t = types.Unalias(t)
+	if target != nil {
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj() != target {
+			return nil
+		}
+	}
+	st, _ := t.Underlying().(*types.Struct)
+	return st
+}
+
+// insert adds an edit inserting the given text before the given node.
+func (r *KeyStructLiterals) insert(node ast.Node, s string) {
+	filename := r.Program.Fset.Position(node.Pos()).Filename
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	extent := &text.Extent{Offset: r.OffsetOfPos(node.Pos()), Length: 0}
+	if err := r.Edits[filename].Add(extent, s); err != nil {
+		r.Log.Error(err)
+	}
+}
+
+const keyStructLiteralsDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert to Keyed Literals transformation adds field names to
+  composite literals of struct types that list their values positionally.
+  Keyed literals remain correct when fields are added to a struct or
+  reordered, so this is a useful first step before making such changes.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Optionally, select the name of a struct type, either in its
+    declaration or where it is used.</li>
+    <li>Activate the Convert to Keyed Literals transformation.</li>
+  </ol>
+
+  <p>If the name of a struct type is selected, only literals of that type are
+  changed; otherwise, every unkeyed struct literal in the refactoring scope is
+  changed.  The values in each literal are left as they are, so comments and
+  line breaks within the literal are preserved.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of the transformation when
+  <tt>Point</tt> is selected.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type <span class="highlight">Point</span> struct {
+    X, Y int
+}
+
+var origin = Point{0, 0}
+var corners = []Point{{0, 1}, {1, 0}}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Point struct {
+    X, Y int
+}
+
+var origin = Point{X: 0, Y: 0}
+var corners = []Point{{X: 0, Y: 1}, {X: 1, Y: 0}}</pre>
+      </td>
+    </tr>
+  </table>
+`
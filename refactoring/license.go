@@ -0,0 +1,256 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that inserts or updates a copyright or
+// license header in every file in the scope.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// InsertLicenseHeader is a transformation that adds a copyright or license
+// header to the beginning of every file in the scope.  If a file already has
+// a header (i.e., a comment before the package clause that mentions a
+// copyright or license and is not the package's doc comment), it is replaced
+// instead.  Build constraints (//go:build and // +build lines) and other
+// directives are never moved, so they remain before the package clause, and
+// generated files are skipped.
+//
+// The header may be given as plain text, in which case each line is made into
+// a line comment, or as one or more comments.  Since it is often entered on a
+// command line, the two-character sequence \n is treated as a line break.
+type InsertLicenseHeader struct {
+	RefactoringBase
+	// The header, as it should appear in each file
+	header string
+}
+
+func (r *InsertLicenseHeader) Description() *Description {
+	return &Description{
+		Name:      "Insert License Header",
+		Synopsis:  "Inserts or updates a copyright/license header in every file",
+		Usage:     "<header>",
+		Selection: "",
+		HTMLDoc:   insertLicenseHeaderDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Header:",
+			Prompt:       "Copyright/license header to insert (lines may be separated by \\n).",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *InsertLicenseHeader) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if r.header = licenseComment(config.Args[0].(string)); r.header == "" {
+		r.Log.Error("The header cannot be empty")
+		r.Log.AssociateArg(0)
+		return &r.Result
+	}
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", r.header+"\n\npackage p\n",
+		parser.PackageClauseOnly); err != nil {
+		r.Log.Error("The header must be plain text or a sequence of Go " +
+			"comments")
+		r.Log.AssociateArg(0)
+		return &r.Result
+	}
+	if !isLicenseText(r.header) {
+		r.Log.Warn("The header does not mention a copyright or license, so " +
+			"it will not be recognized (and updated) if this transformation " +
+			"is run again")
+	}
+
+	added, updated := 0, 0
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		for _, file := range pkgInfo.Files {
+			if IsGenerated(file) {
+				continue
+			}
+			switch r.updateHeader(config, pkgInfo, file) {
+			case headerAdded:
+				added++
+			case headerUpdated:
+				updated++
+			}
+		}
+	}
+	if added == 0 && updated == 0 {
+		r.Log.Info("Every file in the scope already has the header")
+	} else {
+		r.Log.Infof("The header will be added to %d file(s) and updated in "+
+			"%d file(s)", added, updated)
+	}
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// The possible results of updateHeader
+const (
+	headerUnchanged = iota
+	headerAdded
+	headerUpdated
+)
+
+// updateHeader adds the header to the given file or replaces its existing
+// header, returning headerAdded, headerUpdated, or (if the file already has
+// the header, or it cannot be read) headerUnchanged.
+func (r *InsertLicenseHeader) updateHeader(config *Config, pkgInfo *loader.PackageInfo, file *ast.File) int {
+	m := r.newFileMigration(config, pkgInfo, file)
+	if m == nil {
+		return headerUnchanged
+	}
+	start, end := existingHeader(file)
+	switch {
+	case !start.IsValid():
+		m.addEdit(&text.Extent{Offset: 0, Length: 0}, r.header+"\n\n")
+		return headerAdded
+	case m.text(start, end) == r.header:
+		return headerUnchanged
+	default:
+		m.replace(start, end, r.header)
+		return headerUpdated
+	}
+}
+
+// existingHeader returns the positions of the beginning and end of the
+// copyright or license header in the given file, or token.NoPos if it does
+// not have one.  The header is the first comment group before the package
+// clause (other than the package's doc comment) whose leading comments
+// mention a copyright or license.  Directives following those comments in the
+// same group (e.g., a //go:build line with no blank line before it) are not
+// part of the header.
+func existingHeader(file *ast.File) (token.Pos, token.Pos) {
+	for _, cg := range file.Comments {
+		if cg.Pos() >= file.Package {
+			break
+		}
+		if cg == file.Doc {
+			continue
+		}
+		n := 0
+		for n < len(cg.List) && !isDirectiveComment(cg.List[n].Text) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		var b strings.Builder
+		for _, c := range cg.List[:n] {
+			b.WriteString(c.Text + "\n")
+		}
+		if isLicenseText(b.String()) {
+			return cg.List[0].Pos(), cg.List[n-1].End()
+		}
+	}
+	return token.NoPos, token.NoPos
+}
+
+// isDirectiveComment returns true if the given comment is a build constraint
+// or other directive (e.g., //go:build, // +build, or //line), which must not
+// be moved or replaced.
+func isDirectiveComment(text string) bool {
+	return strings.HasPrefix(text, "//go:") ||
+		strings.HasPrefix(text, "// +build") ||
+		strings.HasPrefix(text, "//line ")
+}
+
+// isLicenseText returns true if the given text mentions a copyright or
+// license.
+func isLicenseText(text string) bool {
+	text = strings.ToLower(text)
+	return strings.Contains(text, "copyright") ||
+		strings.Contains(text, "license") ||
+		strings.Contains(text, "licence") ||
+		strings.Contains(text, "spdx-license-identifier")
+}
+
+// licenseComment returns the given header as it should appear in a file: if
+// it is plain text, each line is made into a line comment.  The sequence \n
+// is treated as a line break, and trailing spaces and blank lines are
+// removed.  It returns "" if the header is blank.
+func licenseComment(header string) string {
+	header = strings.ReplaceAll(header, `\n`, "\n")
+	lines := strings.Split(strings.Trim(header, "\r\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	header = strings.TrimSpace(strings.Join(lines, "\n"))
+	if header == "" || strings.HasPrefix(header, "//") ||
+		strings.HasPrefix(header, "/*") {
+		return header
+	}
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "//"
+		} else {
+			lines[i] = "// " + line
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+const insertLicenseHeaderDoc = `
+  <h4>Purpose</h4>
+  <p>The Insert License Header transformation adds a copyright or license
+  header to the beginning of every file in the scope, or updates the header
+  in files that already have one.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Activate the Insert License Header transformation.  No selection is
+    necessary.</li>
+    <li>Enter the header.  It may be plain text, in which case each line is
+    made into a line comment, or one or more comments.  Lines may be
+    separated by <tt>\n</tt>.</li>
+  </ol>
+
+  <p>A file already has a header if a comment before its package clause
+  (other than the package's doc comment) mentions a copyright or license; in
+  that case, the comment is replaced.  Otherwise, the header is inserted at
+  the beginning of the file, followed by a blank line.  Build constraints
+  (<tt>//go:build</tt> and <tt>// +build</tt> lines) are never moved, so they
+  remain before the package clause, and generated files are skipped.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of inserting the header
+  <tt>Copyright 2018 Example Inc.\nUse is subject to the LICENSE file.</tt> in
+  a file with a build constraint.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>//go:build linux
+
+package main</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>// Copyright 2018 Example Inc.
+// Use is subject to the LICENSE file.
+
+//go:build linux
+
+package main</pre>
+      </td>
+    </tr>
+  </table>
+`
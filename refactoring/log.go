@@ -38,18 +38,29 @@ const (
 	Error                   // the refactoring transformation is, or might be, invalid
 )
 
+// NoArg is the value of an Entry's Arg field when the entry does not describe
+// a particular argument to the refactoring.
+const NoArg = -1
+
 // A Entry constitutes a single entry in a Log.  Every Entry has a
 // severity and a message.  If the filename is a nonempty string, the Entry
 // is associated with a particular position in the given file.  Some log
 // entries are marked as "initial."  These indicate semantic errors that were
 // present in the input file (e.g., unresolved identifiers, unnecessary
-// imports, etc.) before the refactoring was started.
+// imports, etc.) before the refactoring was started.  Initial entries that
+// describe syntax (parse) errors are also marked as syntax errors.
+//
+// An entry describing a problem with one of the arguments supplied to the
+// refactoring (e.g., an invalid name) is associated with that argument: Arg
+// is its index in Config.Args.  Otherwise, Arg is NoArg.
 type Entry struct {
 	isInitial bool
+	isSyntax  bool
 	Severity  Severity
 	Message   string
 	Pos       token.Pos
 	End       token.Pos
+	Arg       int
 }
 
 func (entry *Entry) String() string {
@@ -133,7 +144,8 @@ func (log *Log) log(severity Severity, format string, v ...interface{}) {
 		Severity:  severity,
 		Message:   fmt.Sprintf(format, v...),
 		Pos:       token.NoPos,
-		End:       token.NoPos})
+		End:       token.NoPos,
+		Arg:       NoArg})
 }
 
 /*
@@ -157,6 +169,15 @@ func (log *Log) AssociatePos(start, end token.Pos) {
 	entry.End = end
 }
 
+// AssociateArg associates the most recently-logged entry with the argument
+// at the given index in Config.Args.
+func (log *Log) AssociateArg(index int) {
+	if len(log.Entries) == 0 {
+		return
+	}
+	log.Entries[len(log.Entries)-1].Arg = index
+}
+
 // AssociateNode associates the most recently-logged entry with the region of
 // source code corresponding to the given AST Node.
 func (log *Log) AssociateNode(node ast.Node) {
@@ -278,3 +299,57 @@ func (log *Log) ChangeInitialErrorsToWarnings() {
 	}
 	log.Entries = newEntries
 }
+
+// ChangeInitialErrorsToWarningsOutside changes the severity of initial errors
+// to Warning severity, except for errors in the given files (i.e., the files
+// a refactoring depends on) and errors that are not associated with a file.
+// It returns the number of errors that were changed.
+func (log *Log) ChangeInitialErrorsToWarningsOutside(filenames map[string]bool) int {
+	if log.Fset == nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range log.Entries {
+		if entry.isInitial && entry.Severity == Error && entry.Pos.IsValid() &&
+			!filenames[log.Fset.Position(entry.Pos).Filename] {
+			entry.Severity = Warning
+			count++
+		}
+	}
+	return count
+}
+
+// ChangeSyntaxErrorsToWarningsOutside changes the severity of initial syntax
+// errors to Warning severity, except for errors between the given positions
+// (i.e., in the region of code a refactoring depends on).  It returns the
+// number of errors that were changed.
+func (log *Log) ChangeSyntaxErrorsToWarningsOutside(start, end token.Pos) int {
+	count := 0
+	for _, entry := range log.Entries {
+		if entry.isInitial && entry.isSyntax && entry.Severity == Error &&
+			entry.Pos.IsValid() && (entry.Pos < start || entry.Pos > end) {
+			entry.Severity = Warning
+			count++
+		}
+	}
+	return count
+}
+
+// containsInitialSyntaxError returns true if the log contains an initial
+// syntax error with the given message.
+func (log *Log) containsInitialSyntaxError(message string) bool {
+	return log.contains(func(entry *Entry) bool {
+		return entry.isInitial && entry.isSyntax &&
+			entry.Message == message
+	})
+}
+
+// containsInitial returns true if the log contains an initial entry with the
+// given message and position, i.e., if a problem with that message was
+// present before the refactoring was started.
+func (log *Log) containsInitial(message string, pos token.Pos) bool {
+	return log.contains(func(entry *Entry) bool {
+		return entry.isInitial && entry.Message == message &&
+			entry.Pos == pos
+	})
+}
@@ -5,17 +5,19 @@
 package refactoring
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"go/token"
 )
 
 func TestEntry(t *testing.T) {
-	e := Entry{false, Info, "Message", token.NoPos, token.NoPos}
+	e := Entry{false, false, Info, "Message", token.NoPos, token.NoPos, NoArg}
 	assertEquals("Message", e.String(), t)
-	e = Entry{false, Warning, "Message", token.NoPos, token.NoPos}
+	e = Entry{false, false, Warning, "Message", token.NoPos, token.NoPos, NoArg}
 	assertEquals("Warning: Message", e.String(), t)
-	e = Entry{false, Error, "Message", token.NoPos, token.NoPos}
+	e = Entry{false, false, Error, "Message", token.NoPos, token.NoPos, NoArg}
 	assertEquals("Error: Message", e.String(), t)
 }
 
@@ -57,6 +59,160 @@ file2:2:1: Error: Another error
 	assertEquals(expected, log.String(), t)
 }
 
+func TestAssociateArg(t *testing.T) {
+	log := NewLog()
+	log.AssociateArg(0) // No entries; should be ignored
+	log.Info("Info")
+	log.Error("An error")
+	log.AssociateArg(1)
+	if log.Entries[0].Arg != NoArg || log.Entries[1].Arg != 1 {
+		t.Fatalf("Expected args %d, 1; got %d, %d", NoArg,
+			log.Entries[0].Arg, log.Entries[1].Arg)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("dir/file.go", fset.Base(), 20)
+	file.AddLine(10)
+
+	log := NewLog()
+	log.Fset = fset
+	log.Info("Info")
+	log.Warn("A warning")
+	log.AssociatePos(file.Pos(12), file.Pos(15))
+
+	var buf bytes.Buffer
+	if err := log.WriteSARIF(&buf, "godoctor", "rename", ""); err != nil {
+		t.Fatal(err)
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct {
+							StartLine, StartColumn int
+							EndLine, EndColumn     int
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 ||
+		sarif.Runs[0].Tool.Driver.Name != "godoctor" ||
+		sarif.Runs[0].Tool.Driver.Rules[0].ID != "rename" {
+		t.Fatalf("Incorrect SARIF run:\n%s", buf.String())
+	}
+	results := sarif.Runs[0].Results
+	if len(results) != 2 ||
+		results[0].Level != "note" || results[0].Message.Text != "Info" ||
+		len(results[0].Locations) != 0 ||
+		results[1].Level != "warning" || results[1].RuleID != "rename" ||
+		len(results[1].Locations) != 1 {
+		t.Fatalf("Incorrect SARIF results:\n%s", buf.String())
+	}
+	loc := results[1].Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "dir/file.go" ||
+		loc.Region.StartLine != 2 || loc.Region.StartColumn != 3 ||
+		loc.Region.EndLine != 2 || loc.Region.EndColumn != 6 {
+		t.Fatalf("Incorrect SARIF location:\n%s", buf.String())
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("file.go", fset.Base(), 20)
+	file.AddLine(10)
+
+	log := NewLog()
+	log.Fset = fset
+	log.Info("Info")
+	log.Error("An <error>")
+	log.AssociatePos(file.Pos(12), file.Pos(15))
+
+	var buf bytes.Buffer
+	if err := log.WriteCheckstyle(&buf, "rename", ""); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(`<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="">
+    <error line="0" severity="info" message="Info" source="rename"></error>
+  </file>
+  <file name="file.go">
+    <error line="2" column="3" severity="error" message="An &lt;error&gt;" source="rename"></error>
+  </file>
+</checkstyle>
+`, buf.String(), t)
+
+	buf.Reset()
+	if err := log.WriteJUnit(&buf, "rename", ""); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="rename" tests="1" failures="0" errors="0">
+    <testcase name="rename" classname="rename">
+      <system-out>Info</system-out>
+    </testcase>
+  </testsuite>
+  <testsuite name="file.go" tests="1" failures="1" errors="0">
+    <testcase name="file.go:2:3" classname="rename">
+      <failure message="An &lt;error&gt;" type="error">Error: An &lt;error&gt;</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`, buf.String(), t)
+}
+
+func TestChangeInitialErrorsToWarningsOutside(t *testing.T) {
+	fset := token.NewFileSet()
+	file1 := fset.AddFile("file1", fset.Base(), 10)
+	file2 := fset.AddFile("file2", fset.Base(), 10)
+	log := NewLog()
+	log.Fset = fset
+	log.Error("In file1")
+	log.AssociatePos(file1.Pos(1), file1.Pos(1))
+	log.Error("In file2")
+	log.AssociatePos(file2.Pos(1), file2.Pos(1))
+	log.Error("No position")
+	log.MarkInitial()
+	log.Error("Not initial")
+	log.AssociatePos(file2.Pos(2), file2.Pos(2))
+
+	n := log.ChangeInitialErrorsToWarningsOutside(map[string]bool{"file1": true})
+	if n != 1 {
+		t.Fatalf("Expected 1 error to be changed, got %d", n)
+	}
+	expected := []Severity{Error, Warning, Error, Error}
+	for i, entry := range log.Entries {
+		if entry.Severity != expected[i] {
+			t.Fatalf("Entry %d (%s) has the wrong severity", i,
+				entry.Message)
+		}
+	}
+	if !log.containsInitial("In file2", file2.Pos(1)) ||
+		log.containsInitial("Not initial", file2.Pos(2)) {
+		t.Fatal("containsInitial returned the wrong result")
+	}
+}
+
 // assertEquals is a utility method for unit tests that marks a function as
 // having failed if expected != actual
 // TODO(jeff): Copied from util_test.go
@@ -0,0 +1,182 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains utilities for transformations that migrate code from one
+// package to another (e.g., from io/ioutil to io and os) throughout the scope.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// A fileMigration contains the state used to migrate references to a package
+// in a single file.
+type fileMigration struct {
+	r        *RefactoringBase
+	pkgInfo  *loader.PackageInfo
+	file     *ast.File
+	filename string
+	src      []byte
+	// Determines how to refer to packages that are now used
+	imports *ImportResolver
+	// Package names whose references have been replaced
+	removed map[*ast.Ident]bool
+}
+
+// newFileMigration returns a fileMigration for the given file, or nil (after
+// logging a warning) if the file cannot be read.
+func (r *RefactoringBase) newFileMigration(config *Config, pkgInfo *loader.PackageInfo, file *ast.File) *fileMigration {
+	filename := r.Program.Fset.Position(file.Package).Filename
+	src := readFile(config, filename)
+	if src == nil {
+		r.Log.Warnf("%s could not be read, so it will not be migrated",
+			filename)
+		return nil
+	}
+	return &fileMigration{
+		r:        r,
+		pkgInfo:  pkgInfo,
+		file:     file,
+		filename: filename,
+		src:      src,
+		imports:  NewImportResolver(r.Program.Fset, file, pkgInfo, src),
+		removed:  map[*ast.Ident]bool{},
+	}
+}
+
+// migration returns the migration state for the given file, creating it the
+// first time the file is migrated, or nil (after logging an error) if it
+// cannot be read.  Refactorings that change several files use it to make all
+// of their changes to each file through a single fileMigration, then call
+// finishMigrations.
+func (r *RefactoringBase) migration(config *Config, pkgInfo *loader.PackageInfo, file *ast.File) *fileMigration {
+	if m, ok := r.migrations[file]; ok {
+		return m
+	}
+	m := r.newFileMigration(config, pkgInfo, file)
+	if m == nil {
+		r.Log.Errorf("%s could not be read",
+			r.Program.Fset.Position(file.Package).Filename)
+		return nil
+	}
+	r.migrations[file] = m
+	return m
+}
+
+// finishMigrations finishes the migration of each file returned by migration.
+func (r *RefactoringBase) finishMigrations() {
+	for _, m := range r.migrations {
+		m.finish()
+	}
+}
+
+// migrationCandidates returns the packages in the program whose files should
+// be migrated, sorted by import path, excluding packages in $GOROOT and
+// packages for which exclude returns true.
+func (r *RefactoringBase) migrationCandidates(exclude func(path string) bool) []*loader.PackageInfo {
+	pkgs := []*loader.PackageInfo{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		if len(pkgInfo.Files) == 0 || exclude(pkgInfo.Pkg.Path()) {
+			continue
+		}
+		filename := r.Program.Fset.Position(pkgInfo.Files[0].Package).Filename
+		if !isInGoRoot(filename) {
+			pkgs = append(pkgs, pkgInfo)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Pkg.Path() < pkgs[j].Pkg.Path()
+	})
+	return pkgs
+}
+
+// importsPackage returns true if the given file imports a package whose path
+// satisfies the given predicate.
+func importsPackage(pkgInfo *loader.PackageInfo, file *ast.File, match func(path string) bool) bool {
+	for _, spec := range file.Imports {
+		pkgName := importedPkgName(pkgInfo, spec)
+		if pkgName != nil && match(pkgName.Imported().Path()) {
+			return true
+		}
+	}
+	return false
+}
+
+// importsOf returns the import specs in the file whose imported packages'
+// paths satisfy the given predicate.
+func (m *fileMigration) importsOf(match func(path string) bool) []*ast.ImportSpec {
+	result := []*ast.ImportSpec{}
+	for _, spec := range m.file.Imports {
+		pkgName := importedPkgName(m.pkgInfo, spec)
+		if pkgName != nil && match(pkgName.Imported().Path()) {
+			result = append(result, spec)
+		}
+	}
+	return result
+}
+
+// qualify returns the name that should be used at the given position to
+// refer to the member with the given name in the package with the given
+// path and name, e.g., fmt.Errorf.
+func (m *fileMigration) qualify(path, pkgName, member string, pos token.Pos) string {
+	qualifier, _ := m.imports.Qualify(types.NewPackage(path, pkgName), pos)
+	if qualifier == "" {
+		return member
+	}
+	return qualifier + "." + member
+}
+
+// removeImport removes the given import spec.  If any imports must be added
+// to the file, the spec is replaced by them; otherwise, it is deleted.
+func (m *fileMigration) removeImport(spec *ast.ImportSpec) {
+	if extent, replacement := m.imports.ReplaceImport(spec); extent != nil {
+		m.addEdit(extent, replacement)
+		return
+	}
+	m.r.deleteImport(m.r.Program.Fset, m.file, m.src, spec)
+}
+
+// finish adds edits for any imports that must be added to the file.
+func (m *fileMigration) finish() {
+	if m.r.Edits[m.filename] != nil {
+		if err := m.imports.AddEdits(m.r.Edits[m.filename]); err != nil {
+			m.r.Log.Error(err)
+		}
+	}
+}
+
+// replace adds an edit replacing the text from start to end in the file with
+// the given string.
+func (m *fileMigration) replace(start, end token.Pos, replacement string) {
+	offset := m.offset(start)
+	m.addEdit(&text.Extent{Offset: offset, Length: m.offset(end) - offset},
+		replacement)
+}
+
+// addEdit adds an edit to the file, logging an error if it cannot be added.
+func (m *fileMigration) addEdit(extent *text.Extent, replacement string) {
+	m.r.addEdit(m.filename, extent, replacement)
+}
+
+// offset returns the offset of the given position in the file.
+func (m *fileMigration) offset(pos token.Pos) int {
+	return m.r.Program.Fset.Position(pos).Offset
+}
+
+// text returns the source text from start to end in the file.
+func (m *fileMigration) text(start, end token.Pos) string {
+	return string(m.src[m.offset(start):m.offset(end)])
+}
+
+// textOf returns the source text of the given node.
+func (m *fileMigration) textOf(node ast.Node) string {
+	return m.text(node.Pos(), node.End())
+}
@@ -0,0 +1,513 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that generates a mock implementation of an
+// interface.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// GenerateMock is a refactoring that generates a mock implementation of the
+// selected interface, for use in tests.  For each method M of the interface,
+// the mock has a field MFunc, a function that supplies the results of M (if
+// it is nil, M returns zero values), and a field MCalls that records the
+// arguments of each call to M.  A mutex guards the recorded calls, so the
+// mock can be used by concurrent goroutines.
+//
+// The mock is added to the end of the output file, which is created if it
+// does not exist.  By default, the output file is mock_name_test.go (where
+// name is the interface's name in lower case) in the directory containing
+// the selection.
+type GenerateMock struct {
+	RefactoringBase
+	// The selected interface, and its underlying type
+	iface *types.TypeName
+	it    *types.Interface
+	// The name of the mock type
+	mockName string
+	// The file the mock is added to
+	out *outputFile
+}
+
+func (r *GenerateMock) Description() *Description {
+	return &Description{
+		Name:      "Generate Mock",
+		Synopsis:  "Generates a mock implementation of an interface",
+		Usage:     "[<output_file> [<mock_name>]]",
+		Selection: "The name of an interface type",
+		HTMLDoc:   generateMockDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Output File:",
+			Prompt:       "File to add the mock to, relative to the directory containing the selection (leave blank for mock_name_test.go).",
+			DefaultValue: "",
+		}, {
+			Label:        "Mock Name:",
+			Prompt:       "Name for the mock type (leave blank for Mock followed by the interface's name).",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *GenerateMock) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.findInterface() {
+		return &r.Result
+	}
+	output, mockName := "", ""
+	if len(config.Args) > 0 {
+		output = strings.TrimSpace(config.Args[0].(string))
+	}
+	if len(config.Args) > 1 {
+		mockName = strings.TrimSpace(config.Args[1].(string))
+	}
+	if output == "" {
+		output = "mock_" + strings.ToLower(r.iface.Name()) + "_test.go"
+	}
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(filepath.Dir(r.Filename), output)
+	}
+	if r.out = r.outputFile(config, output, 0); r.out == nil {
+		return &r.Result
+	}
+	if !r.checkAccess() || !r.chooseName(mockName) {
+		return &r.Result
+	}
+	r.out.add(config, r.mockCode(r.out.qualifier()))
+	r.Log.Infof("Adding %s, a mock implementation of %s, to %s",
+		r.mockName, r.iface.Name(), filepath.Base(r.out.filename))
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findInterface finds the named interface type whose name is selected,
+// returning false (after logging an error) if there is none or if it cannot
+// be mocked.
+func (r *GenerateMock) findInterface() bool {
+	r.iface, r.it = nil, nil
+	if id, ok := r.SelectedNode.(*ast.Ident); ok && r.SelectedNodePkg != nil {
+		if tn, ok := r.SelectedNodePkg.ObjectOf(id).(*types.TypeName); ok {
+			if named, ok := types.Unalias(tn.Type()).(*types.Named); ok {
+				if it, ok := named.Underlying().(*types.Interface); ok {
+					r.iface, r.it = named.Obj(), it
+				}
+			}
+		}
+	}
+	switch {
+	case r.iface == nil:
+		r.Log.Error("Please select the name of an interface type.")
+	case r.iface.Type().(*types.Named).TypeParams().Len() > 0:
+		r.Log.Errorf("%s is generic, so a mock cannot be generated",
+			r.iface.Name())
+	case !r.it.IsMethodSet():
+		r.Log.Errorf("%s is a constraint, not an ordinary interface, so "+
+			"a mock cannot be generated", r.iface.Name())
+	case r.it.NumMethods() == 0:
+		r.Log.Errorf("%s has no methods, so a mock is unnecessary",
+			r.iface.Name())
+	default:
+		return true
+	}
+	r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+	return false
+}
+
+// samePackage returns true if the output file belongs to the package
+// declaring the interface.
+func (r *GenerateMock) samePackage() bool {
+	return r.out.pkg != nil && r.iface.Pkg() != nil &&
+		r.out.pkg.Path() == r.iface.Pkg().Path()
+}
+
+// checkAccess returns false (after logging an error) if the output file is in
+// a different package than the interface, and the interface, one of its
+// methods, or a type in the signature of one of its methods is not exported.
+func (r *GenerateMock) checkAccess() bool {
+	if r.samePackage() || r.iface.Pkg() == nil {
+		return true
+	}
+	if !r.iface.Exported() {
+		r.Log.Errorf("%s is not exported, so it cannot be implemented "+
+			"outside package %s", r.iface.Name(), r.iface.Pkg().Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	for i := 0; i < r.it.NumMethods(); i++ {
+		method := r.it.Method(i)
+		if !method.Exported() {
+			r.Log.Errorf("%s has an unexported method (%s), so it "+
+				"cannot be implemented outside package %s",
+				r.iface.Name(), method.Name(), method.Pkg().Name())
+			r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+			return false
+		}
+		if tn := unexportedType(method.Type(), r.out.pkg); tn != nil {
+			r.Log.Errorf("The signature of %s refers to %s, which is "+
+				"not exported from package %s", method.Name(),
+				tn.Name(), tn.Pkg().Name())
+			r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+			return false
+		}
+	}
+	return true
+}
+
+// unexportedType returns a named type that the given type refers to, which
+// is not exported from its package and so cannot be referred to in the
+// given package (which may be nil, for a package that does not exist yet),
+// or nil if there is none.
+func unexportedType(t types.Type, pkg *types.Package) *types.TypeName {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		tn := t.Obj()
+		if tn.Pkg() != nil && !tn.Exported() &&
+			(pkg == nil || tn.Pkg().Path() != pkg.Path()) {
+			return tn
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if tn := unexportedType(t.TypeArgs().At(i), pkg); tn != nil {
+				return tn
+			}
+		}
+	case *types.Pointer:
+		return unexportedType(t.Elem(), pkg)
+	case *types.Slice:
+		return unexportedType(t.Elem(), pkg)
+	case *types.Array:
+		return unexportedType(t.Elem(), pkg)
+	case *types.Chan:
+		return unexportedType(t.Elem(), pkg)
+	case *types.Map:
+		if tn := unexportedType(t.Key(), pkg); tn != nil {
+			return tn
+		}
+		return unexportedType(t.Elem(), pkg)
+	case *types.Signature:
+		if tn := unexportedType(t.Params(), pkg); tn != nil {
+			return tn
+		}
+		return unexportedType(t.Results(), pkg)
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if tn := unexportedType(t.At(i).Type(), pkg); tn != nil {
+				return tn
+			}
+		}
+	}
+	return nil
+}
+
+// chooseName determines the name of the mock type, returning false (after
+// logging an error) if it, or the name of one of the types recording calls,
+// is invalid or conflicts with an existing declaration.
+func (r *GenerateMock) chooseName(name string) bool {
+	if name == "" {
+		if r.iface.Exported() {
+			name = "Mock" + r.iface.Name()
+		} else {
+			name = "mock" + capitalize(r.iface.Name())
+		}
+	}
+	if !isIdentifierValid(name) {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier", name)
+		r.Log.AssociateArg(1)
+		return false
+	}
+	r.mockName = name
+	names := []string{name}
+	for i := 0; i < r.it.NumMethods(); i++ {
+		names = append(names, r.callTypeName(r.it.Method(i)))
+	}
+	for _, name := range names {
+		if r.out.declares(name) {
+			r.Log.Errorf("%s is already declared in %s", name,
+				filepath.Base(r.out.filename))
+			r.Log.AssociateArg(1)
+			return false
+		}
+	}
+	return true
+}
+
+// callTypeName returns the name of the struct that records the arguments of a
+// call to the given method, e.g., MockStoreGetCall.
+func (r *GenerateMock) callTypeName(method *types.Func) string {
+	return r.mockName + capitalize(method.Name()) + "Call"
+}
+
+// mockCode returns the declarations of the mock type, the types recording
+// calls to its methods, and its methods, using the given qualifier to refer to
+// other packages.
+func (r *GenerateMock) mockCode(qualifier types.Qualifier) string {
+	mutex := qualifier(types.NewPackage("sync", "sync")) + ".Mutex"
+	ifaceName := r.iface.Name()
+	if r.iface.Pkg() != nil {
+		if q := qualifier(r.iface.Pkg()); q != "" {
+			ifaceName = q + "." + ifaceName
+		}
+	}
+	methods := []*types.Func{}
+	for i := 0; i < r.it.NumMethods(); i++ {
+		methods = append(methods, r.it.Method(i))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s is a mock implementation of %s.  Each method "+
+		"records its\n// arguments and returns the results of the "+
+		"corresponding function field\n// (e.g., %sFunc), or zero values "+
+		"if that field is nil.\n", r.mockName, ifaceName, methods[0].Name())
+	fmt.Fprintf(&b, "type %s struct {\n\tmu %s\n", r.mockName, mutex)
+	for _, method := range methods {
+		sig := method.Type().(*types.Signature)
+		fmt.Fprintf(&b, "\n\t%sFunc %s\n\t%sCalls []%s\n", method.Name(),
+			r.signature(sig, paramNames(sig, qualifier, "m"), qualifier),
+			method.Name(), r.callTypeName(method))
+	}
+	b.WriteString("}\n")
+
+	for _, method := range methods {
+		sig := method.Type().(*types.Signature)
+		params := paramNames(sig, qualifier, "m")
+		fields := r.fieldNames(params)
+		callType := r.callTypeName(method)
+
+		fmt.Fprintf(&b, "\n// %s records the arguments of a call to "+
+			"%s.%s.\ntype %s struct", callType, r.mockName,
+			method.Name(), callType)
+		if len(fields) == 0 {
+			b.WriteString("{}\n")
+		} else {
+			b.WriteString(" {\n")
+			for i, field := range fields {
+				fmt.Fprintf(&b, "\t%s %s\n", field, types.TypeString(
+					sig.Params().At(i).Type(), qualifier))
+			}
+			b.WriteString("}\n")
+		}
+
+		values := []string{}
+		args := []string{}
+		for i, field := range fields {
+			values = append(values, field+": "+params[i])
+			args = append(args, params[i])
+		}
+		if sig.Variadic() {
+			args[len(args)-1] += "..."
+		}
+		if sig.Results().Len() == 0 {
+			fmt.Fprintf(&b, "\n// %s records the call and calls %sFunc.\n",
+				method.Name(), method.Name())
+		} else {
+			fmt.Fprintf(&b, "\n// %s records the call and returns the "+
+				"results of %sFunc.\n", method.Name(), method.Name())
+		}
+		fmt.Fprintf(&b, "func (m *%s) %s%s {\n", r.mockName, method.Name(),
+			strings.TrimPrefix(r.signature(sig, params, qualifier), "func"))
+		fmt.Fprintf(&b, "\tm.mu.Lock()\n\tm.%sCalls = append(m.%sCalls, "+
+			"%s{%s})\n\tm.mu.Unlock()\n", method.Name(), method.Name(),
+			callType, strings.Join(values, ", "))
+		call := fmt.Sprintf("m.%sFunc(%s)", method.Name(),
+			strings.Join(args, ", "))
+		if sig.Results().Len() == 0 {
+			fmt.Fprintf(&b, "\tif m.%sFunc != nil {\n\t\t%s\n\t}\n",
+				method.Name(), call)
+		} else {
+			zeros := []string{}
+			for i := 0; i < sig.Results().Len(); i++ {
+				zeros = append(zeros,
+					zeroValue(sig.Results().At(i).Type(), qualifier))
+			}
+			fmt.Fprintf(&b, "\tif m.%sFunc != nil {\n\t\treturn %s\n\t}\n"+
+				"\treturn %s\n", method.Name(), call,
+				strings.Join(zeros, ", "))
+		}
+		b.WriteString("}\n")
+	}
+	// Align the fields of the structs, as gofmt would
+	const header = "package p\n\n"
+	formatted, err := format.Source([]byte(header + b.String()))
+	if err != nil {
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return strings.TrimSuffix(string(formatted[len(header):]), "\n")
+}
+
+// paramNames returns names for the parameters of the given signature: the
+// names they are declared with, except that a parameter that is unnamed or
+// blank, or whose name would conflict with one of the given reserved names or
+// a package referred to in the signature, is named argN.
+func paramNames(sig *types.Signature, qualifier types.Qualifier, reserved ...string) []string {
+	used := map[string]bool{"_": true}
+	for _, name := range reserved {
+		used[name] = true
+	}
+	types.TypeString(sig, func(pkg *types.Package) string {
+		name := qualifier(pkg)
+		used[name] = true
+		return name
+	})
+	names := []string{}
+	for i := 0; i < sig.Params().Len(); i++ {
+		name := sig.Params().At(i).Name()
+		if name == "" || used[name] {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		names = append(names, name)
+		used[name] = true
+	}
+	return names
+}
+
+// fieldNames returns the names of the fields recording the given parameters,
+// which are the parameters' names with the first letter in upper case.
+func (r *GenerateMock) fieldNames(params []string) []string {
+	names := []string{}
+	used := map[string]bool{}
+	for i, param := range params {
+		name := capitalize(param)
+		if used[name] {
+			name = fmt.Sprintf("Arg%d", i)
+		}
+		names = append(names, name)
+		used[name] = true
+	}
+	return names
+}
+
+// signature returns the source code for a function type with the given
+// signature, giving its parameters the given names.
+func (r *GenerateMock) signature(sig *types.Signature, names []string, qualifier types.Qualifier) string {
+	params := []string{}
+	for i, name := range names {
+		t := sig.Params().At(i).Type()
+		if sig.Variadic() && i == len(names)-1 {
+			params = append(params, name+" ..."+types.TypeString(
+				t.(*types.Slice).Elem(), qualifier))
+		} else {
+			params = append(params, name+" "+types.TypeString(t, qualifier))
+		}
+	}
+	results := []string{}
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results,
+			types.TypeString(sig.Results().At(i).Type(), qualifier))
+	}
+	result := "func(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+		return result
+	case 1:
+		return result + " " + results[0]
+	default:
+		return result + " (" + strings.Join(results, ", ") + ")"
+	}
+}
+
+// zeroValue returns an expression for the zero value of the given type.
+func zeroValue(t types.Type, qualifier types.Qualifier) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+		return "nil"
+	case *types.Struct, *types.Array:
+		return types.TypeString(t, qualifier) + "{}"
+	}
+	return "nil"
+}
+
+const generateMockDoc = `
+  <h4>Purpose</h4>
+  <p>The Generate Mock refactoring generates a mock implementation of an
+  interface, which records the calls to its methods and returns configurable
+  results, for use in tests.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of an interface type (in its declaration or in a
+    reference to it).</li>
+    <li>Activate the Generate Mock refactoring.</li>
+    <li>Optionally, enter the name of the file to add the mock to, relative to
+    the directory containing the selection.  By default, it is
+    <tt>mock_<i>name</i>_test.go</tt>, where <i>name</i> is the name of the
+    interface in lower case.  The file is created if it does not
+    exist.</li>
+    <li>Optionally, enter a name for the mock type.  By default, it is
+    <tt>Mock</tt> followed by the name of the interface.</li>
+  </ol>
+
+  <p>For each method <tt>M</tt> of the interface, the mock has a field
+  <tt>MFunc</tt>, a function that supplies the results of <tt>M</tt> (if it
+  is nil, <tt>M</tt> returns zero values), and a field <tt>MCalls</tt> that
+  records the arguments of each call to <tt>M</tt>.  The recorded calls are
+  guarded by a mutex, so the mock can be shared by concurrent goroutines.  If
+  the output file is in a different package than the interface, the
+  interface, its methods, and the types in their signatures must be
+  exported.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of generating a mock of
+  <tt>Store</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type Store interface {
+    Get(key string) (string, error)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Store interface {
+    Get(key string) (string, error)
+}
+
+// MockStore is a mock implementation of Store.  ...
+type MockStore struct {
+    mu sync.Mutex
+
+    GetFunc  func(key string) (string, error)
+    GetCalls []MockStoreGetCall
+}
+
+// MockStoreGetCall records the arguments of a call to MockStore.Get.
+type MockStoreGetCall struct {
+    Key string
+}
+
+// Get records the call and returns the results of GetFunc.
+func (m *MockStore) Get(key string) (string, error) {
+    m.mu.Lock()
+    m.GetCalls = append(m.GetCalls, MockStoreGetCall{Key: key})
+    m.mu.Unlock()
+    if m.GetFunc != nil {
+        return m.GetFunc(key)
+    }
+    return "", nil
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
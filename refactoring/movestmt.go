@@ -0,0 +1,398 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that moves a statement above or below the
+// adjacent statement, together with the analysis used to determine whether
+// two statements (or expressions) can be reordered.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// MoveStatement is a refactoring that swaps the selected statement with the
+// statement before it (or, if its optional argument is true, after it) in
+// the same block.  Comments on the lines before each statement, and at the
+// end of its last line, move with it.
+//
+// The statements are not swapped if they may depend on each other: if either
+// declares or assigns a local variable that the other uses, if both may have
+// side effects (e.g., function calls or channel operations), or if one may
+// have side effects and the other reads memory that could be affected (e.g.,
+// fields or package variables).  Statements containing labels, return
+// statements, or branch statements that leave them are never moved.
+type MoveStatement struct {
+	RefactoringBase
+}
+
+func (r *MoveStatement) Description() *Description {
+	return &Description{
+		Name:      "Move Statement",
+		Synopsis:  "Moves a statement above or below the adjacent statement",
+		Usage:     "[<down?>]",
+		Selection: "A statement in a block",
+		HTMLDoc:   moveStatementDoc,
+		Multifile: false,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Move Down:",
+			Prompt:       "Move the statement down rather than up?",
+			DefaultValue: false,
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *MoveStatement) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	down := len(config.Args) > 0 && config.Args[0].(bool)
+
+	stmts, index, start := r.selectedStmt()
+	if stmts == nil {
+		r.Log.Error("Please select a statement in a block.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	other := index - 1
+	if down {
+		other = index + 1
+	}
+	if other < 0 || other >= len(stmts) {
+		direction := "before"
+		if down {
+			direction = "after"
+		}
+		r.Log.Errorf("There is no statement %s the selected statement "+
+			"in the same block", direction)
+		r.Log.AssociateNode(stmts[index])
+		return &r.Result
+	}
+
+	a, b := effectsOf(r.SelectedNodePkg, stmts[index]),
+		effectsOf(r.SelectedNodePkg, stmts[other])
+	if reason := a.conflict(b); reason != "" {
+		r.Log.Errorf("The statements cannot be swapped because %s", reason)
+		r.Log.AssociateNode(stmts[index])
+		return &r.Result
+	}
+
+	first, second := index, other
+	if other < index {
+		first, second = other, index
+	}
+	extentA := r.stmtExtent(stmts, first, start)
+	extentB := r.stmtExtent(stmts, second, stmts[first].End())
+	textA := string(r.FileContents[r.OffsetOfPos(extentA[0]):r.OffsetOfPos(extentA[1])])
+	textB := string(r.FileContents[r.OffsetOfPos(extentB[0]):r.OffsetOfPos(extentB[1])])
+	r.replace(extentA[0], extentA[1], textB)
+	r.replace(extentB[0], extentB[1], textA)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedStmt returns the list of statements in the block containing the
+// innermost statement enclosing the selection, the index of that statement
+// in the list, and the position after which the list begins (e.g., the
+// block's opening brace).  If the selection is not in a block, the list is
+// nil.
+func (r *MoveStatement) selectedStmt() ([]ast.Stmt, int, token.Pos) {
+	path := r.PathEnclosingSelection
+	for i := 0; i+1 < len(path); i++ {
+		stmt, ok := path[i].(ast.Stmt)
+		if !ok {
+			continue
+		}
+		var stmts []ast.Stmt
+		var start token.Pos
+		switch parent := path[i+1].(type) {
+		case *ast.BlockStmt:
+			stmts, start = parent.List, parent.Lbrace
+		case *ast.CaseClause:
+			stmts, start = parent.Body, parent.Colon
+		case *ast.CommClause:
+			stmts, start = parent.Body, parent.Colon
+		default:
+			continue
+		}
+		for j, s := range stmts {
+			if s == stmt {
+				return stmts, j, start
+			}
+		}
+	}
+	return nil, -1, token.NoPos
+}
+
+// stmtExtent returns the start and end positions of the statement at the
+// given index, extended to include comments on the lines before it (after
+// the given position) and a comment at the end of its last line.
+func (r *MoveStatement) stmtExtent(stmts []ast.Stmt, index int, after token.Pos) [2]token.Pos {
+	stmt := stmts[index]
+	start, end := stmt.Pos(), stmt.End()
+	fset := r.Program.Fset
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	for _, cg := range r.File.Comments {
+		if cg.Pos() > after && cg.End() <= stmt.Pos() &&
+			line(cg.Pos()) > line(after) && cg.Pos() < start {
+			start = cg.Pos()
+		}
+		if cg.Pos() >= stmt.End() && line(cg.Pos()) == line(stmt.End()) &&
+			(index+1 == len(stmts) || cg.End() <= stmts[index+1].Pos()) {
+			end = cg.End()
+		}
+	}
+	return [2]token.Pos{start, end}
+}
+
+// replace adds an edit replacing the text from start to end in the file.
+func (r *MoveStatement) replace(start, end token.Pos, replacement string) {
+	offset := r.OffsetOfPos(start)
+	if err := r.Edits[r.Filename].Add(&text.Extent{
+		Offset: offset,
+		Length: r.OffsetOfPos(end) - offset,
+	}, replacement); err != nil {
+		r.Log.Error(err)
+	}
+}
+
+/* -=-=- stmtEffects -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// stmtEffects summarizes the local declarations a statement or expression
+// reads and writes, and whether it may have other effects, to determine
+// whether it can be evaluated in a different order relative to another.
+type stmtEffects struct {
+	// Local variables (and other local declarations) that are used, and
+	// that are declared or assigned
+	reads, writes map[types.Object]bool
+	// Whether it may have side effects other than assigning local
+	// variables (calls, channel operations, writes to fields, etc.)
+	effects bool
+	// Whether it reads memory that other code may change (fields, slice
+	// elements, pointers, and package variables)
+	readsShared bool
+	// Whether it contains a label, a return statement, or a branch
+	// statement that may leave it
+	jumps bool
+}
+
+// effectsOf analyzes the given statement or expression in the given package.
+func effectsOf(pkgInfo *loader.PackageInfo, node ast.Node) *stmtEffects {
+	e := &stmtEffects{
+		reads:  map[types.Object]bool{},
+		writes: map[types.Object]bool{},
+	}
+	// Identifiers that are assigned but not read
+	assigned := map[*ast.Ident]bool{}
+	// The number of enclosing statements that unlabeled break (and
+	// continue) statements may target
+	breakTargets, continueTargets := 0, 0
+	stack := []ast.Node{}
+	write := func(expr ast.Expr, read bool) {
+		id, ok := astutil.Unparen(expr).(*ast.Ident)
+		if !ok {
+			e.effects = true
+			return
+		}
+		obj := pkgInfo.ObjectOf(id)
+		if obj == nil {
+			return
+		}
+		if isLocal(obj) {
+			e.writes[obj] = true
+			if !read {
+				assigned[id] = true
+			}
+		} else {
+			e.effects = true
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			breakTargets -= isBranchTarget(stack[len(stack)-1], token.BREAK)
+			continueTargets -= isBranchTarget(stack[len(stack)-1], token.CONTINUE)
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		breakTargets += isBranchTarget(n, token.BREAK)
+		continueTargets += isBranchTarget(n, token.CONTINUE)
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				write(lhs, n.Tok != token.ASSIGN && n.Tok != token.DEFINE)
+			}
+		case *ast.IncDecStmt:
+			write(n.X, true)
+		case *ast.RangeStmt:
+			for _, expr := range []ast.Expr{n.Key, n.Value} {
+				if expr != nil {
+					write(expr, false)
+				}
+			}
+		case *ast.CallExpr:
+			if !isPureCall(pkgInfo, n) {
+				e.effects = true
+			}
+		case *ast.SendStmt, *ast.GoStmt, *ast.DeferStmt:
+			e.effects = true
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				e.effects = true
+			}
+		case *ast.ReturnStmt, *ast.LabeledStmt:
+			e.jumps = true
+		case *ast.BranchStmt:
+			if n.Label != nil || n.Tok == token.GOTO ||
+				n.Tok == token.FALLTHROUGH ||
+				(n.Tok == token.BREAK && breakTargets == 0) ||
+				(n.Tok == token.CONTINUE && continueTargets == 0) {
+				e.jumps = true
+			}
+		case *ast.SelectorExpr:
+			if sel := pkgInfo.Selections[n]; sel != nil &&
+				sel.Kind() == types.FieldVal {
+				e.readsShared = true
+			}
+		case *ast.IndexExpr, *ast.StarExpr:
+			e.readsShared = true
+		case *ast.Ident:
+			if obj := pkgInfo.Defs[n]; obj != nil {
+				if isLocal(obj) {
+					e.writes[obj] = true
+				}
+			} else if obj := pkgInfo.Uses[n]; obj != nil && !assigned[n] {
+				if isLocal(obj) {
+					e.reads[obj] = true
+				} else if v, ok := obj.(*types.Var); ok && !v.IsField() {
+					e.readsShared = true
+				}
+			}
+		}
+		return true
+	})
+	return e
+}
+
+// isBranchTarget returns 1 if the given node is a statement that an
+// unlabeled branch statement with the given token (break or continue) may
+// target, and 0 otherwise.
+func isBranchTarget(n ast.Node, tok token.Token) int {
+	switch n.(type) {
+	case *ast.ForStmt, *ast.RangeStmt:
+		return 1
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		if tok == token.BREAK {
+			return 1
+		}
+	}
+	return 0
+}
+
+// isLocal returns true if the given object is declared in a function.
+func isLocal(obj types.Object) bool {
+	return obj.Parent() != nil && obj.Pkg() != nil &&
+		obj.Parent() != obj.Pkg().Scope() && obj.Parent() != types.Universe
+}
+
+// isPureCall returns true if the given call is a conversion or a call to a
+// builtin function without side effects (e.g., len).
+func isPureCall(pkgInfo *loader.PackageInfo, call *ast.CallExpr) bool {
+	if tv, ok := pkgInfo.Types[call.Fun]; ok && tv.IsType() {
+		return true
+	}
+	id, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if _, ok := pkgInfo.Uses[id].(*types.Builtin); !ok {
+		return false
+	}
+	switch id.Name {
+	case "append", "cap", "complex", "imag", "len", "make", "max", "min",
+		"new", "real":
+		return true
+	}
+	return false
+}
+
+// conflict returns a description of why the two statements (or expressions)
+// may not be reordered, or "" if they may.
+func (e *stmtEffects) conflict(other *stmtEffects) string {
+	switch {
+	case e.jumps || other.jumps:
+		return "one of them contains a label, a return statement, or " +
+			"a branch statement"
+	case e.effects && other.effects:
+		return "both of them may have side effects"
+	case e.effects && other.readsShared, other.effects && e.readsShared:
+		return "one of them may have side effects that affect the other"
+	}
+	for obj := range e.writes {
+		if other.reads[obj] || other.writes[obj] {
+			return "both of them refer to " + obj.Name()
+		}
+	}
+	for obj := range other.writes {
+		if e.reads[obj] {
+			return "both of them refer to " + obj.Name()
+		}
+	}
+	return ""
+}
+
+const moveStatementDoc = `
+  <h4>Purpose</h4>
+  <p>The Move Statement refactoring swaps a statement with the statement
+  before or after it in the same block, when doing so cannot change the
+  behavior of the code.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a statement.</li>
+    <li>Activate the Move Statement refactoring.</li>
+    <li>Optionally, indicate that the statement should be moved down rather
+    than up.</li>
+  </ol>
+
+  <p>Comments on the lines before each statement, and at the end of its last
+  line, move with it.  The statements are not swapped if either assigns a
+  local variable that the other uses, if both may have side effects (such as
+  function calls), if one may have side effects and the other reads fields,
+  slice elements, pointers, or package variables, or if either contains a
+  label, a <tt>return</tt> statement, or a branch statement that leaves
+  it.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of moving the selected
+  statement up.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>width := 3
+height := 4
+<span class="highlight">name := "box"</span>
+fmt.Println(name, width*height)</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>width := 3
+name := "box"
+height := 4
+fmt.Println(name, width*height)</pre>
+      </td>
+    </tr>
+  </table>
+`
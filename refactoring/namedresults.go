@@ -0,0 +1,441 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a pair of refactorings that convert a function between
+// named results with bare return statements and unnamed results with
+// explicit return values.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// enclosingFunc returns the type and body of the innermost function
+// declaration or function literal enclosing the selection, and the node
+// itself, or nils if there is none.
+func (r *RefactoringBase) enclosingFunc() (*ast.FuncType, *ast.BlockStmt, ast.Node) {
+	for _, node := range r.PathEnclosingSelection {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			return node.Type, node.Body, node
+		case *ast.FuncDecl:
+			if node.Body != nil {
+				return node.Type, node.Body, node
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// NameResults is a refactoring that gives names to the results of a function
+// and replaces each of its return statements with an assignment to the named
+// results followed by a bare return.  Since the new names must not be used
+// anywhere in the function, deferred functions cannot observe the change.
+type NameResults struct {
+	RefactoringBase
+}
+
+func (r *NameResults) Description() *Description {
+	return &Description{
+		Name:      "Name Results",
+		Synopsis:  "Names a function's results and uses bare return statements",
+		Usage:     "<names>",
+		Selection: "A function declaration or function literal",
+		HTMLDoc:   nameResultsDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Result Names:",
+			Prompt:       "Names for the results, separated by commas or spaces (e.g., n, err).",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *NameResults) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	funcType, body, fn := r.enclosingFunc()
+	if funcType == nil || funcType.Results == nil ||
+		len(funcType.Results.List) == 0 {
+		r.Log.Error("Please select a function that returns one or more " +
+			"results.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if len(funcType.Results.List[0].Names) > 0 {
+		r.Log.Error("The function's results are already named")
+		r.Log.AssociateNode(funcType.Results)
+		return &r.Result
+	}
+
+	names := strings.FieldsFunc(config.Args[0].(string), func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	if !r.checkNames(names, len(funcType.Results.List), fn) {
+		return &r.Result
+	}
+
+	m := r.newFileMigration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, fn.Pos()))
+	if m == nil {
+		return &r.Result
+	}
+	fields := []string{}
+	for i, field := range funcType.Results.List {
+		fields = append(fields, names[i]+" "+m.textOf(field.Type))
+	}
+	m.replace(funcType.Results.Pos(), funcType.Results.End(),
+		"("+strings.Join(fields, ", ")+")")
+
+	lhs := strings.Join(names, ", ")
+	for _, ret := range returnStmts(body) {
+		if len(ret.Results) == 0 {
+			continue
+		}
+		indent := Indentation(m.src, m.offset(ret.Pos()))
+		m.replace(ret.Pos(), ret.End(), fmt.Sprintf("%s = %s\n%sreturn",
+			lhs, m.text(ret.Results[0].Pos(), ret.End()), indent))
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// checkNames returns false (after logging an error) if the given names for
+// the results are invalid or already used in the given function.
+func (r *NameResults) checkNames(names []string, count int, fn ast.Node) bool {
+	if len(names) != count {
+		r.Log.Errorf("The function has %d result(s), but %d name(s) "+
+			"were given", count, len(names))
+		r.Log.AssociateArg(0)
+		return false
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !isIdentifierValid(name) || isReservedWord(name) || name == "_" {
+			r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+				name)
+			r.Log.AssociateArg(0)
+			return false
+		}
+		if seen[name] {
+			r.Log.Errorf("The name %s is given more than once", name)
+			r.Log.AssociateArg(0)
+			return false
+		}
+		seen[name] = true
+		if usesName(fn, name) {
+			r.Log.Errorf("The name %s is already used in the function",
+				name)
+			r.Log.AssociateArg(0)
+			return false
+		}
+	}
+	return true
+}
+
+// UnnameResults is a refactoring that removes the names of a function's
+// results, declaring them as local variables instead, and adds the values
+// returned to each bare return statement.
+//
+// If a deferred function refers to a named result, each return statement
+// assigns the returned values to the variables before returning them, so the
+// deferred function still observes them.  However, a deferred function that
+// assigns a named result can no longer change the value returned, so a
+// warning is logged.
+type UnnameResults struct {
+	RefactoringBase
+}
+
+func (r *UnnameResults) Description() *Description {
+	return &Description{
+		Name:           "Unname Results",
+		Synopsis:       "Replaces named results and bare returns with explicit return values",
+		Usage:          "",
+		Selection:      "A function declaration or function literal",
+		HTMLDoc:        unnameResultsDoc,
+		Multifile:      false,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *UnnameResults) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	funcType, body, fn := r.enclosingFunc()
+	if funcType == nil || funcType.Results == nil ||
+		len(funcType.Results.List) == 0 ||
+		len(funcType.Results.List[0].Names) == 0 {
+		r.Log.Error("Please select a function with named results.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+
+	vars := []*types.Var{}
+	names := []string{}
+	for _, field := range funcType.Results.List {
+		for _, name := range field.Names {
+			if name.Name == "_" {
+				r.Log.Error("A result named _ cannot be converted " +
+					"to a local variable")
+				r.Log.AssociateNode(name)
+				return &r.Result
+			}
+			v, _ := r.SelectedNodePkg.Defs[name].(*types.Var)
+			vars = append(vars, v)
+			names = append(names, name.Name)
+		}
+	}
+
+	returns := returnStmts(body)
+	bare := false
+	for _, ret := range returns {
+		bare = bare || len(ret.Results) == 0
+	}
+	preserve := r.checkDefers(body, vars)
+	effects := effectsOf(r.SelectedNodePkg, body)
+	declared := []bool{}
+	for _, v := range vars {
+		used := bare || preserve || usesObject(r.SelectedNodePkg, body, v)
+		if used && !bare && !preserve && !effects.reads[v] {
+			r.Log.Errorf("The result %s is assigned but never returned, "+
+				"so it cannot be converted to a local variable",
+				v.Name())
+			r.Log.AssociatePos(v.Pos(), v.Pos())
+			return &r.Result
+		}
+		declared = append(declared, used)
+	}
+
+	m := r.newFileMigration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, fn.Pos()))
+	if m == nil {
+		return &r.Result
+	}
+
+	// Declare the results as local variables
+	var b bytes.Buffer
+	inner := Indentation(m.src, m.offset(funcType.Pos())) +
+		DetectIndentStyle(m.src).Unit
+	resultTypes := []string{}
+	i := 0
+	for _, field := range funcType.Results.List {
+		declNames := []string{}
+		for _, name := range field.Names {
+			resultTypes = append(resultTypes, m.textOf(field.Type))
+			if declared[i] {
+				declNames = append(declNames, name.Name)
+			}
+			i++
+		}
+		if len(declNames) > 0 {
+			fmt.Fprintf(&b, "\n%svar %s %s", inner,
+				strings.Join(declNames, ", "), m.textOf(field.Type))
+		}
+	}
+	if b.Len() > 0 {
+		if line := r.Program.Fset.Position(body.Lbrace).Line; len(body.List) > 0 &&
+			r.Program.Fset.Position(body.List[0].Pos()).Line == line {
+			b.WriteString("\n" + inner)
+		}
+		m.replace(body.Lbrace+1, body.Lbrace+1, b.String())
+	}
+
+	if len(resultTypes) == 1 {
+		m.replace(funcType.Results.Pos(), funcType.Results.End(),
+			resultTypes[0])
+	} else {
+		m.replace(funcType.Results.Pos(), funcType.Results.End(),
+			"("+strings.Join(resultTypes, ", ")+")")
+	}
+
+	list := strings.Join(names, ", ")
+	for _, ret := range returns {
+		switch {
+		case len(ret.Results) == 0:
+			m.replace(ret.Pos(), ret.End(), "return "+list)
+		case preserve:
+			indent := Indentation(m.src, m.offset(ret.Pos()))
+			m.replace(ret.Pos(), ret.End(), fmt.Sprintf("%s = %s\n%sreturn %s",
+				list, m.text(ret.Results[0].Pos(), ret.End()), indent, list))
+		}
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// checkDefers returns true if a deferred call in the given function body
+// refers to one of the given results, so the results must be assigned before
+// each return statement.  It logs a warning for each deferred call that may
+// assign a result, since the assignment will no longer change the value
+// returned.
+func (r *UnnameResults) checkDefers(body *ast.BlockStmt, results []*types.Var) bool {
+	isResult := map[types.Object]bool{}
+	for _, v := range results {
+		isResult[v] = true
+	}
+	refers := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.DeferStmt)
+		if !ok {
+			return true
+		}
+		warned := map[types.Object]bool{}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			var obj types.Object
+			assigned := false
+			switch n := n.(type) {
+			case *ast.Ident:
+				obj = r.SelectedNodePkg.Uses[n]
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					if id, ok := astutil.Unparen(lhs).(*ast.Ident); ok &&
+						isResult[r.SelectedNodePkg.Uses[id]] {
+						obj, assigned = r.SelectedNodePkg.Uses[id], true
+					}
+				}
+			case *ast.IncDecStmt:
+				if id, ok := astutil.Unparen(n.X).(*ast.Ident); ok {
+					obj, assigned = r.SelectedNodePkg.Uses[id], true
+				}
+			case *ast.UnaryExpr:
+				if id, ok := astutil.Unparen(n.X).(*ast.Ident); ok &&
+					n.Op == token.AND {
+					obj, assigned = r.SelectedNodePkg.Uses[id], true
+				}
+			}
+			if !isResult[obj] {
+				return true
+			}
+			refers = true
+			if assigned && !warned[obj] {
+				warned[obj] = true
+				r.Log.Warnf("The deferred call may assign %s, which "+
+					"will no longer change the value returned",
+					obj.Name())
+				r.Log.AssociateNode(stmt)
+			}
+			return true
+		})
+		return true
+	})
+	return refers
+}
+
+const nameResultsDoc = `
+  <h4>Purpose</h4>
+  <p>The Name Results refactoring gives names to the results of a function
+  and replaces its return statements with assignments to those results
+  followed by bare return statements.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration or function literal (or any code
+    inside it).</li>
+    <li>Activate the Name Results refactoring.</li>
+    <li>Enter a name for each result, separated by commas or spaces.</li>
+  </ol>
+
+  <p>The names must not already be used anywhere in the function.  This is
+  the inverse of the Unname Results refactoring.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of naming the results of
+  <tt>parse</tt> <tt>n, err</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func parse(s string) (int, error) {
+    if s == "" {
+        return 0, errors.New("empty")
+    }
+    return strconv.Atoi(s)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func parse(s string) (n int, err error) {
+    if s == "" {
+        n, err = 0, errors.New("empty")
+        return
+    }
+    n, err = strconv.Atoi(s)
+    return
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
+
+const unnameResultsDoc = `
+  <h4>Purpose</h4>
+  <p>The Unname Results refactoring removes the names of a function's
+  results, declaring them as local variables instead, and replaces each bare
+  return statement with one that lists the values returned.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration or function literal (or any code
+    inside it).</li>
+    <li>Activate the Unname Results refactoring.</li>
+  </ol>
+
+  <p>A named result is only declared as a local variable if it is used.  If
+  a deferred call refers to a named result, every return statement assigns
+  the returned values to the local variables before returning them, so the
+  deferred call observes the same values as before.  However, a deferred
+  call that assigns a named result (e.g., to return an error after
+  recovering from a panic) can no longer change the value returned; a
+  warning is reported for each such call.  This is the inverse of the Name
+  Results refactoring.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of unnaming the results of
+  <tt>count</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func count(s string) (n int, ok bool) {
+    for range s {
+        n++
+    }
+    ok = n > 0
+    return
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func count(s string) (int, bool) {
+    var n int
+    var ok bool
+    for range s {
+        n++
+    }
+    ok = n > 0
+    return n, ok
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
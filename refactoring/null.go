@@ -18,6 +18,7 @@ func (r *Null) Description() *Description {
 		Name:      "Null Refactoring",
 		Synopsis:  "Refactoring that makes no changes to a program",
 		Usage:     "<allow_errors?>",
+		Selection: "",
 		HTMLDoc:   "",
 		Multifile: false,
 		Params: []Parameter{{
@@ -0,0 +1,477 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that replaces the parameters of a function
+// with an options struct or functional options.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// IntroduceOptions is a refactoring that replaces the parameters of the
+// selected function (except a leading context.Context) with a single
+// parameter whose type is a new struct containing a field for each of them,
+// or, if its optional argument is true, with variadic functional options.
+// The struct (and option functions) are declared before the function, and
+// every call is rewritten to pass them, omitting arguments that are zero
+// values (nil, false, 0, or "").
+//
+// For a function F, the struct is named FOptions; for a method M of type T,
+// it is named TMOptions.  Functional options are of type FOption and are
+// created by functions named With followed by the parameter's name (e.g.,
+// WithTimeout).  All of these are exported if and only if F is.
+type IntroduceOptions struct {
+	RefactoringBase
+	// The function whose parameters are replaced
+	decl *ast.FuncDecl
+	fn   *types.Func
+	// The parameters that are replaced (excluding a leading context)
+	params []*types.Var
+	// The names of the generated declarations
+	names optionsNames
+	// Whether functional options are generated
+	functional bool
+}
+
+// optionsNames contains the names of the declarations generated by
+// IntroduceOptions.
+type optionsNames struct {
+	// The options struct, the functional option type, and the parameter
+	// (or local variable) holding the options
+	structType, optionType, variable string
+	// The name of the field and option function for each parameter
+	fields, withFuncs []string
+}
+
+func (r *IntroduceOptions) Description() *Description {
+	return &Description{
+		Name:      "Introduce Options",
+		Synopsis:  "Replaces a function's parameters with an options struct or functional options",
+		Usage:     "[<functional?>]",
+		Selection: "A function declaration",
+		HTMLDoc:   introduceOptionsDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Functional Options",
+			Prompt:       "Generate functional options rather than an options struct?",
+			DefaultValue: false,
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *IntroduceOptions) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.functional = len(config.Args) > 0 && config.Args[0].(bool)
+
+	if !r.findFunction() || !r.chooseNames() {
+		return &r.Result
+	}
+
+	m := r.migration(config, r.SelectedNodePkg, r.File)
+	if m == nil {
+		return &r.Result
+	}
+	r.addDeclarations(m)
+	r.rewriteSignature(m)
+	r.rewriteBody(m)
+	r.rewriteCalls(config)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findFunction finds the selected function and the parameters to replace,
+// returning false (after logging an error) if they cannot be replaced.
+func (r *IntroduceOptions) findFunction() bool {
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			r.decl = decl
+			break
+		}
+	}
+	if r.decl == nil || r.decl.Body == nil {
+		r.Log.Error("Please select a function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	r.fn, _ = r.SelectedNodePkg.Defs[r.decl.Name].(*types.Func)
+	if r.fn == nil {
+		r.Log.Errorf("%s could not be type checked", r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+
+	sig := r.fn.Type().(*types.Signature)
+	if sig.Variadic() {
+		r.Log.Errorf("The parameters of %s cannot be replaced because it "+
+			"is variadic", r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		if i == 0 && isContext(p.Type()) &&
+			len(r.decl.Type.Params.List[0].Names) == 1 {
+			continue
+		}
+		if p.Name() == "" || p.Name() == "_" {
+			r.Log.Errorf("The parameters of %s must be named",
+				r.decl.Name.Name)
+			r.Log.AssociateNode(r.decl.Name)
+			return false
+		}
+		r.params = append(r.params, p)
+	}
+	if len(r.params) < 2 {
+		r.Log.Errorf("%s has fewer than two parameters to replace",
+			r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+	return true
+}
+
+// hasContext returns true if the first parameter of the function is a
+// context.Context, which is not replaced.
+func (r *IntroduceOptions) hasContext() bool {
+	return r.fn.Type().(*types.Signature).Params().Len() > len(r.params)
+}
+
+// chooseNames determines the names of the generated declarations, returning
+// false (after logging an error) if any would conflict with an existing
+// declaration.
+func (r *IntroduceOptions) chooseNames() bool {
+	base := r.decl.Name.Name
+	if r.decl.Recv != nil && len(r.decl.Recv.List) > 0 {
+		if recv := recvTypeName(r.decl.Recv.List[0].Type); recv != "" {
+			base = recv + capitalize(base)
+		}
+	}
+	exported := ast.IsExported(r.decl.Name.Name)
+	export := func(name string) string {
+		if exported {
+			return capitalize(name)
+		}
+		return strings.ToLower(name[:1]) + name[1:]
+	}
+
+	r.names.structType = export(base + "Options")
+	r.names.optionType = export(base + "Option")
+	r.names.variable = "opts"
+	if r.functional {
+		// The struct is an implementation detail
+		r.names.structType = strings.ToLower(base[:1]) + base[1:] + "Options"
+		r.names.variable = "o"
+	}
+	for _, p := range r.params {
+		if exported && !r.functional {
+			r.names.fields = append(r.names.fields, capitalize(p.Name()))
+		} else {
+			r.names.fields = append(r.names.fields, p.Name())
+		}
+		r.names.withFuncs = append(r.names.withFuncs,
+			export("With"+capitalize(p.Name())))
+	}
+
+	declared := []string{r.names.structType}
+	if r.functional {
+		declared = append(declared, r.names.optionType)
+		declared = append(declared, r.names.withFuncs...)
+	}
+	scope := r.SelectedNodePkg.Pkg.Scope()
+	for _, name := range declared {
+		if obj := scope.Lookup(name); obj != nil {
+			r.Log.Errorf("The name %s is already declared in package %s",
+				name, r.SelectedNodePkg.Pkg.Name())
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+	}
+	locals := []string{r.names.variable}
+	if r.functional {
+		locals = append(locals, "opts", "opt")
+	}
+	for _, name := range locals {
+		if usesName(r.decl, name) {
+			r.Log.Errorf("%s already uses the name %s", r.decl.Name.Name,
+				name)
+			r.Log.AssociateNode(r.decl.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// capitalize returns the given name with its first letter in upper case.
+func capitalize(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// recvTypeName returns the name of the type in the given receiver type
+// expression (e.g., T in *T), or "".
+func recvTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.IndexExpr:
+		return recvTypeName(e.X)
+	case *ast.IndexListExpr:
+		return recvTypeName(e.X)
+	}
+	return ""
+}
+
+// paramFields returns the fields of the function's parameter list that
+// declare the parameters being replaced.
+func (r *IntroduceOptions) paramFields() []*ast.Field {
+	fields := r.decl.Type.Params.List
+	if r.hasContext() {
+		fields = fields[1:]
+	}
+	return fields
+}
+
+// addDeclarations adds the options struct (and, for functional options, the
+// option type and functions) before the function.
+func (r *IntroduceOptions) addDeclarations(m *fileMigration) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s contains the parameters of %s.\n",
+		r.names.structType, r.decl.Name.Name)
+	fmt.Fprintf(&b, "type %s struct {\n", r.names.structType)
+	names := []string{}
+	width := 0
+	i := 0
+	for _, field := range r.paramFields() {
+		names = append(names, strings.Join(r.names.fields[i:i+len(field.Names)], ", "))
+		i += len(field.Names)
+		if len(names[len(names)-1]) > width {
+			width = len(names[len(names)-1])
+		}
+	}
+	for i, field := range r.paramFields() {
+		fmt.Fprintf(&b, "\t%-*s %s\n", width, names[i], m.textOf(field.Type))
+	}
+	b.WriteString("}\n\n")
+
+	if r.functional {
+		fmt.Fprintf(&b, "// %s sets a parameter of %s.\n",
+			r.names.optionType, r.decl.Name.Name)
+		fmt.Fprintf(&b, "type %s func(*%s)\n\n", r.names.optionType,
+			r.names.structType)
+		i := 0
+		for _, field := range r.paramFields() {
+			for _, name := range field.Names {
+				fmt.Fprintf(&b, "// %s sets the %s parameter of %s.\n",
+					r.names.withFuncs[i], name.Name, r.decl.Name.Name)
+				fmt.Fprintf(&b, "func %s(%s %s) %s {\n", r.names.withFuncs[i],
+					name.Name, m.textOf(field.Type), r.names.optionType)
+				fmt.Fprintf(&b, "\treturn func(o *%s) {\n\t\to.%s = %s\n\t}\n}\n\n",
+					r.names.structType, r.names.fields[i], name.Name)
+				i++
+			}
+		}
+	}
+
+	var start ast.Node = r.decl
+	if r.decl.Doc != nil {
+		start = r.decl.Doc
+	}
+	code := DetectIndentStyle(r.FileContents).Reindent(b.String(), "")
+	m.replace(start.Pos(), start.Pos(), code)
+}
+
+// rewriteSignature replaces the parameters with the options parameter.
+func (r *IntroduceOptions) rewriteSignature(m *fileMigration) {
+	fields := r.paramFields()
+	param := r.names.variable + " " + r.names.structType
+	if r.functional {
+		param = "opts ..." + r.names.optionType
+	}
+	m.replace(fields[0].Pos(), fields[len(fields)-1].End(), param)
+
+	if r.functional {
+		// Apply the options at the beginning of the body
+		indent := Indentation(r.FileContents, r.OffsetOfPos(r.decl.Pos())) +
+			DetectIndentStyle(r.FileContents).Unit
+		unit := DetectIndentStyle(r.FileContents).Unit
+		m.replace(r.decl.Body.Lbrace+1, r.decl.Body.Lbrace+1, fmt.Sprintf(
+			"\n%svar o %s\n%sfor _, opt := range opts {\n%s%sopt(&o)\n%s}",
+			indent, r.names.structType, indent, indent, unit, indent))
+	}
+}
+
+// rewriteBody replaces references to the parameters in the body with
+// references to the corresponding fields of the options.
+func (r *IntroduceOptions) rewriteBody(m *fileMigration) {
+	fields := map[types.Object]string{}
+	for i, p := range r.params {
+		fields[p] = r.names.fields[i]
+	}
+	ast.Inspect(r.decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if field, ok := fields[r.SelectedNodePkg.Uses[id]]; ok {
+				m.replace(id.Pos(), id.End(), r.names.variable+"."+field)
+			}
+		}
+		return true
+	})
+}
+
+// rewriteCalls rewrites each call to the function to pass the options.
+func (r *IntroduceOptions) rewriteCalls(config *Config) {
+	first := 0
+	if r.hasContext() {
+		first = 1
+	}
+	for _, pkgInfo := range r.Program.AllPackages {
+		ids := []*ast.Ident{}
+		for id, obj := range pkgInfo.Uses {
+			if obj == r.fn {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		for _, id := range ids {
+			file := fileContaining(pkgInfo, id.Pos())
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			call := callOf(&reference{pkgInfo, file, id, path[1:]})
+			if call == nil || len(call.Args) != first+len(r.params) {
+				r.Log.Errorf("%s can only be called directly, with one "+
+					"argument for each parameter", r.decl.Name.Name)
+				r.Log.AssociateNode(id)
+				continue
+			}
+			m := r.migration(config, pkgInfo, file)
+			if m == nil {
+				return
+			}
+			r.rewriteCall(m, call, call.Args[first:])
+		}
+	}
+}
+
+// rewriteCall replaces the given arguments of the call with the options.
+func (r *IntroduceOptions) rewriteCall(m *fileMigration, call *ast.CallExpr, args []ast.Expr) {
+	values := []string{}
+	for i, arg := range args {
+		if isZeroValue(m.pkgInfo, arg) {
+			continue
+		}
+		if r.functional {
+			values = append(values, fmt.Sprintf("%s(%s)",
+				m.qualify(r.fn.Pkg().Path(), r.fn.Pkg().Name(),
+					r.names.withFuncs[i], call.Pos()), m.textOf(arg)))
+		} else {
+			values = append(values, fmt.Sprintf("%s: %s",
+				r.names.fields[i], m.textOf(arg)))
+		}
+	}
+	replacement := strings.Join(values, ", ")
+	if !r.functional {
+		replacement = fmt.Sprintf("%s{%s}", m.qualify(r.fn.Pkg().Path(),
+			r.fn.Pkg().Name(), r.names.structType, call.Pos()), replacement)
+	}
+	m.replace(args[0].Pos(), args[len(args)-1].End(), replacement)
+}
+
+// isZeroValue returns true if the given expression is nil, false, or a
+// literal 0 or "".
+func isZeroValue(pkgInfo *loader.PackageInfo, expr ast.Expr) bool {
+	switch e := astutil.Unparen(expr).(type) {
+	case *ast.Ident:
+		switch obj := pkgInfo.Uses[e].(type) {
+		case *types.Nil:
+			return true
+		case *types.Const:
+			return obj.Parent() == types.Universe && e.Name == "false"
+		}
+	case *ast.BasicLit:
+		return e.Value == "0" || e.Value == `""` || e.Value == "``"
+	}
+	return false
+}
+
+const introduceOptionsDoc = `
+  <h4>Purpose</h4>
+  <p>The Introduce Options refactoring replaces the parameters of a function
+  with a single parameter whose type is a new struct with a field for each of
+  them (or with variadic functional options), and updates every call to the
+  function.  This makes calls to functions with long parameter lists easier to
+  read and allows parameters to be added later without changing every
+  call.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration.</li>
+    <li>Activate the Introduce Options refactoring.</li>
+    <li>Optionally, indicate that functional options should be generated
+    instead of an options struct.</li>
+  </ol>
+
+  <p>A leading <tt>context.Context</tt> parameter is not replaced.  For a
+  function <tt>F</tt>, the options struct is named <tt>FOptions</tt>; for a
+  method <tt>M</tt> of a type <tt>T</tt>, it is named <tt>TMOptions</tt>.
+  Functional options have the type <tt>FOption</tt> and are created by
+  functions named <tt>With</tt> followed by the parameter's name.  Arguments
+  that are zero values (<tt>nil</tt>, <tt>false</tt>, <tt>0</tt>, or
+  <tt>""</tt>) are omitted from calls.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of introducing an options
+  struct.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func <span class="highlight">Dial</span>(addr string, timeout time.Duration, retries int) {
+    connect(addr, timeout, retries)
+}
+
+func main() {
+    Dial("localhost", time.Second, 0)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>// DialOptions contains the parameters of Dial.
+type DialOptions struct {
+    Addr    string
+    Timeout time.Duration
+    Retries int
+}
+
+func Dial(opts DialOptions) {
+    connect(opts.Addr, opts.Timeout, opts.Retries)
+}
+
+func main() {
+    Dial(DialOptions{Addr: "localhost", Timeout: time.Second})
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
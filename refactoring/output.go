@@ -0,0 +1,359 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains utilities for refactorings that generate code (e.g., a
+// mock or a benchmark) and add it to a file, which may be part of the program,
+// an existing file that is not part of the program (e.g., a _test.go file),
+// or a new file.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// An outputFile is a file that generated code is added to.
+type outputFile struct {
+	r        *RefactoringBase
+	filename string
+	// The name of the package the file belongs to (or will belong to), and
+	// that package, if it is part of the program (otherwise, nil)
+	pkgName string
+	pkg     *types.Package
+	// If the file is part of the program, the migration state used to add
+	// code to it
+	m *fileMigration
+	// If the file is not part of the program, its contents and syntax tree
+	// (nil if it does not exist), how it refers to imported packages (keyed
+	// by path), and the packages that must be imported, in the order they
+	// were added
+	src     []byte
+	fset    *token.FileSet
+	file    *ast.File
+	ir      *ImportResolver
+	imports map[string]string
+	added   []*types.Package
+	// The names of the imports and top-level declarations in the file, if
+	// it is not part of the program
+	names map[string]bool
+	// Declarations in the file to replace (see replaceDecl)
+	replaced []regionEdit
+}
+
+// outputFile returns an outputFile for the file with the given name, or nil
+// (after logging an error) if code cannot be added to it.  The file is part
+// of the package in the same directory, if there is one; otherwise, a new
+// package named after the directory.  The given index identifies the
+// argument that determined the filename, for error messages.
+func (r *RefactoringBase) outputFile(config *Config, filename string, arg int) *outputFile {
+	o := &outputFile{
+		r:        r,
+		filename: filepath.Clean(filename),
+		imports:  map[string]string{},
+		names:    map[string]bool{},
+	}
+	if filepath.Ext(o.filename) != ".go" {
+		r.Log.Errorf("The output file (%s) must be a Go source file",
+			o.filename)
+		r.Log.AssociateArg(arg)
+		return nil
+	}
+	if isInGoRoot(o.filename) {
+		r.Log.Errorf("%s is in $GOROOT, so code cannot be added to it",
+			o.filename)
+		r.Log.AssociateArg(arg)
+		return nil
+	}
+
+	dir := filepath.Dir(o.filename)
+	for _, pkgInfo := range r.Program.AllPackages {
+		for _, file := range pkgInfo.Files {
+			filename := r.Program.Fset.Position(file.Package).Filename
+			if filename == o.filename {
+				o.pkg, o.pkgName = pkgInfo.Pkg, pkgInfo.Pkg.Name()
+				if o.m = r.newFileMigration(config, pkgInfo, file); o.m == nil {
+					return nil
+				}
+				return o
+			}
+			if filepath.Dir(filename) == dir && o.pkg == nil {
+				o.pkg, o.pkgName = pkgInfo.Pkg, pkgInfo.Pkg.Name()
+			}
+		}
+	}
+
+	if o.src = readFile(config, o.filename); o.src != nil {
+		o.fset = token.NewFileSet()
+		file, err := parser.ParseFile(o.fset, o.filename, o.src,
+			parser.ParseComments)
+		if err != nil {
+			r.Log.Error(err)
+			r.Log.AssociateArg(arg)
+			return nil
+		}
+		o.file = file
+		o.ir = NewImportResolver(o.fset, file, nil, o.src)
+		if file.Name.Name != o.pkgName {
+			// An external test package, e.g., package p_test
+			o.pkg, o.pkgName = nil, file.Name.Name
+		}
+		o.findNames(file)
+		return o
+	}
+
+	if o.pkg == nil {
+		o.pkgName = filepath.Base(dir)
+		if !isIdentifierValid(o.pkgName) {
+			r.Log.Errorf("%s is not a valid package name, so %s cannot "+
+				"be created", o.pkgName, o.filename)
+			r.Log.AssociateArg(arg)
+			return nil
+		}
+	}
+	return o
+}
+
+// testFilename returns the name of the file that tests for the given object
+// should be added to: the file with the given name, relative to the directory
+// containing the object's declaration, or (if the name is empty) the _test.go
+// file corresponding to the file containing its declaration.  If the object
+// is declared in $GOROOT, the selected file is used instead.
+func (r *RefactoringBase) testFilename(obj types.Object, filename string) string {
+	home := r.Program.Fset.Position(obj.Pos()).Filename
+	if home == "" || isInGoRoot(home) {
+		home = r.Filename
+	}
+	if filename == "" {
+		filename = strings.TrimSuffix(filepath.Base(home), ".go") + "_test.go"
+	}
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(home), filename)
+	}
+	return filename
+}
+
+// findNames records the packages imported by the given file (which is not
+// part of the program) and the names of its imports and top-level
+// declarations.
+func (o *outputFile) findNames(file *ast.File) {
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		// Assume the package's name is the last element of its path,
+		// unless it is renamed
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != "_" && name != "." {
+			o.imports[importPath] = name
+			o.names[name] = true
+		}
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				o.names[decl.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				for _, id := range specNames(spec) {
+					o.names[id.Name] = true
+				}
+			}
+		}
+	}
+}
+
+// declares returns true if the given name is declared at the top level of the
+// file or its package (as far as can be determined).
+func (o *outputFile) declares(name string) bool {
+	return o.names[name] ||
+		(o.pkg != nil && o.pkg.Scope().Lookup(name) != nil)
+}
+
+// funcDecl returns the declaration of the top-level function with the given
+// name in the file, or nil if there is none (or the file does not exist).
+func (o *outputFile) funcDecl(name string) *ast.FuncDecl {
+	file := o.file
+	if o.m != nil {
+		file = o.m.file
+	}
+	if file == nil {
+		return nil
+	}
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil &&
+			decl.Name.Name == name {
+			return decl
+		}
+	}
+	return nil
+}
+
+// textOf returns the source text of the given node, which must be part of
+// the file.
+func (o *outputFile) textOf(node ast.Node) string {
+	if o.m != nil {
+		return o.m.textOf(node)
+	}
+	return string(o.src[o.offset(node.Pos()):o.offset(node.End())])
+}
+
+// offset returns the offset of the given position in the file, which must
+// not be part of the program.
+func (o *outputFile) offset(pos token.Pos) int {
+	return o.fset.Position(pos).Offset
+}
+
+// replaceDecl replaces the given declaration, which must be part of the file
+// (see funcDecl), with the given code when the file is updated (see add).  The
+// declaration's doc comment is retained.
+func (o *outputFile) replaceDecl(decl *ast.FuncDecl, code string) {
+	o.replaced = append(o.replaced, regionEdit{decl.Pos(), decl.End(), code})
+}
+
+// qualifier returns a types.Qualifier that determines how generated code
+// should refer to members of other packages, recording any imports that must
+// be added to the file.
+func (o *outputFile) qualifier() types.Qualifier {
+	if o.m != nil {
+		return o.m.imports.Qualifier(o.m.file.End())
+	}
+	return func(pkg *types.Package) string {
+		if o.pkg != nil && pkg.Path() == o.pkg.Path() {
+			return ""
+		}
+		if name, ok := o.imports[pkg.Path()]; ok {
+			return name
+		}
+		name := pkg.Name()
+		for i := 2; o.declares(name) || name == o.pkgName; i++ {
+			name = fmt.Sprintf("%s%d", pkg.Name(), i)
+		}
+		o.imports[pkg.Path()], o.names[name] = name, true
+		o.added = append(o.added, pkg)
+		return name
+	}
+}
+
+// add adds the given code, which should consist of top-level declarations,
+// to the end of the file, along with any imports that it needs (see
+// qualifier), and replaces any declarations passed to replaceDecl.  If the
+// file does not exist, it is created.  The code may be empty, in which case
+// only the replacements are made.
+func (o *outputFile) add(config *Config, code string) {
+	switch {
+	case o.m != nil:
+		style := DetectIndentStyle(o.m.src)
+		for _, edit := range o.replaced {
+			o.m.replace(edit.start, edit.end,
+				style.Reindent(edit.replacement, ""))
+		}
+		if code != "" {
+			pos := o.m.file.End()
+			o.m.replace(pos, pos, "\n\n"+style.Reindent(code, ""))
+		}
+		o.m.finish()
+
+	case o.src != nil:
+		for _, pkg := range o.added {
+			o.ir.edits = append(o.ir.edits,
+				o.ir.importEdit(o.imports[pkg.Path()], pkg))
+		}
+		edits := text.NewEditSet()
+		if err := o.ir.AddEdits(edits); err != nil {
+			o.r.Log.Error(err)
+			return
+		}
+		style := DetectIndentStyle(o.src)
+		for _, edit := range o.replaced {
+			offset := o.offset(edit.start)
+			extent := &text.Extent{Offset: offset,
+				Length: o.offset(edit.end) - offset}
+			replacement := style.Reindent(edit.replacement, "")
+			if err := edits.Add(extent, replacement); err != nil {
+				o.r.Log.Error(err)
+				return
+			}
+		}
+		if code != "" {
+			prefix := "\n"
+			if !bytes.HasSuffix(o.src, []byte("\n")) {
+				prefix = "\n\n"
+			}
+			code = style.Reindent(code, "")
+			if err := edits.Add(&text.Extent{Offset: len(o.src), Length: 0},
+				prefix+code+"\n"); err != nil {
+				o.r.Log.Error(err)
+				return
+			}
+		}
+		o.r.Edits[o.filename] = edits
+
+	default:
+		o.create(config, code)
+	}
+}
+
+// create adds file system changes that create the file, containing the given
+// code and the imports it needs (and the directory containing it, if
+// necessary).
+func (o *outputFile) create(config *Config, code string) {
+	dir := filepath.Dir(o.filename)
+	if _, err := config.FileSystem.ReadDir(dir); err != nil {
+		o.r.FSChanges = append(o.r.FSChanges,
+			&filesystem.CreateDirectory{Path: dir})
+	}
+
+	// Group the standard library packages before the others, as goimports
+	// does
+	isStd := func(path string) bool {
+		return !strings.Contains(strings.Split(path, "/")[0], ".")
+	}
+	paths := []string{}
+	for _, pkg := range o.added {
+		paths = append(paths, pkg.Path())
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if isStd(paths[i]) != isStd(paths[j]) {
+			return isStd(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n", o.pkgName)
+	if len(paths) > 0 {
+		b.WriteString("\nimport (\n")
+		for i, path := range paths {
+			if i > 0 && isStd(paths[i-1]) && !isStd(path) {
+				b.WriteString("\n")
+			}
+			b.WriteString("\t")
+			for _, pkg := range o.added {
+				if pkg.Path() == path && o.imports[path] != pkg.Name() {
+					b.WriteString(o.imports[path] + " ")
+				}
+			}
+			b.WriteString(strconv.Quote(path) + "\n")
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString("\n" + code + "\n")
+	o.r.FSChanges = append(o.r.FSChanges,
+		&filesystem.CreateFile{Path: o.filename, Contents: b.String()})
+}
@@ -0,0 +1,496 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that replaces a group of parameters shared
+// by several functions with a parameter object.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/paramgroups"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ExtractParameterObject is a refactoring that finds the largest group of
+// consecutive parameters of the selected function that other functions in
+// the same package also declare (with the same names and types, in the same
+// order), declares a struct with a field for each of them, and replaces the
+// group with a single parameter of that type in every function declaring it.
+// Each call to those functions is rewritten to pass a composite literal.
+//
+// The struct's fields are named after the parameters, capitalized if the
+// struct is exported.  The new parameter is named after the struct, with its
+// first letter in lower case (or, if the struct is unexported, the first
+// letter of its name).
+type ExtractParameterObject struct {
+	RefactoringBase
+	// The group of parameters being replaced
+	group *paramgroups.Group
+	// The declarations of the functions in the group, in the same order
+	decls []*ast.FuncDecl
+	// The name of the struct, the parameter, and the field for each
+	// parameter in the group
+	structName, paramName string
+	fields                []string
+	// The replacement for each reference to a parameter in the group
+	fieldRefs map[*ast.Ident]string
+}
+
+func (r *ExtractParameterObject) Description() *Description {
+	return &Description{
+		Name:      "Extract Parameter Object",
+		Synopsis:  "Replaces a group of parameters shared by several functions with a struct",
+		Usage:     "<struct_name>",
+		Selection: "A function declaration",
+		HTMLDoc:   extractParameterObjectDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Struct Name:",
+			Prompt:       "Name for the struct containing the parameters.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *ExtractParameterObject) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.structName = config.Args[0].(string)
+	r.fieldRefs = map[*ast.Ident]string{}
+
+	if !r.findGroup() || !r.chooseNames() {
+		return &r.Result
+	}
+	r.Log.Infof("Replacing %s in %s with %s", r.group, r.funcNames(),
+		r.structName)
+
+	if !r.addStruct(config) {
+		return &r.Result
+	}
+	for i, decl := range r.decls {
+		file := fileContaining(r.SelectedNodePkg, decl.Pos())
+		m := r.migration(config, r.SelectedNodePkg, file)
+		if m == nil {
+			return &r.Result
+		}
+		r.rewriteSignature(m, decl, r.group.Offsets[i])
+		r.findFieldRefs(decl, r.group.Funcs[i], r.group.Offsets[i])
+	}
+	r.rewriteCalls(config)
+	r.replaceFieldRefs(config)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findGroup finds the group of parameters of the selected function to
+// replace, returning false (after logging an error) if there is none.
+func (r *ExtractParameterObject) findGroup() bool {
+	var decl *ast.FuncDecl
+	for _, node := range r.PathEnclosingSelection {
+		if d, ok := node.(*ast.FuncDecl); ok {
+			decl = d
+			break
+		}
+	}
+	if decl == nil || decl.Body == nil {
+		r.Log.Error("Please select a function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	fn, _ := r.SelectedNodePkg.Defs[decl.Name].(*types.Func)
+	if fn == nil {
+		r.Log.Errorf("%s could not be type checked", decl.Name.Name)
+		r.Log.AssociateNode(decl.Name)
+		return false
+	}
+
+	var best *paramgroups.Group
+	for _, g := range paramgroups.Find(r.SelectedNodePkg, 2, 2) {
+		if g.IndexOf(fn) >= 0 &&
+			(best == nil || len(g.Params) > len(best.Params)) {
+			best = g
+		}
+	}
+	if best == nil {
+		r.Log.Errorf("No other function in package %s declares two or "+
+			"more of the parameters of %s", r.SelectedNodePkg.Pkg.Name(),
+			decl.Name.Name)
+		r.Log.AssociateNode(decl.Name)
+		return false
+	}
+	r.group = best
+
+	decls := map[*types.Func]*ast.FuncDecl{}
+	for _, file := range r.SelectedNodePkg.Files {
+		for _, d := range file.Decls {
+			if d, ok := d.(*ast.FuncDecl); ok {
+				if fn, ok := r.SelectedNodePkg.Defs[d.Name].(*types.Func); ok {
+					decls[fn] = d
+				}
+			}
+		}
+	}
+	for _, fn := range r.group.Funcs {
+		r.decls = append(r.decls, decls[fn])
+	}
+	return true
+}
+
+// funcNames returns the names of the functions declaring the group, e.g.,
+// "f, g, and h".
+func (r *ExtractParameterObject) funcNames() string {
+	names := []string{}
+	for _, fn := range r.group.Funcs {
+		names = append(names, fn.Name())
+	}
+	if len(names) == 2 {
+		return names[0] + " and " + names[1]
+	}
+	last := len(names) - 1
+	return strings.Join(names[:last], ", ") + ", and " + names[last]
+}
+
+// chooseNames determines the names of the struct's fields and the new
+// parameter, returning false (after logging an error) if the struct's name is
+// invalid or any name would conflict with an existing declaration.
+func (r *ExtractParameterObject) chooseNames() bool {
+	if !isIdentifierValid(r.structName) || isReservedWord(r.structName) ||
+		r.structName == "_" {
+		r.Log.Errorf("The struct name \"%s\" is not a valid Go identifier",
+			r.structName)
+		r.Log.AssociateArg(0)
+		return false
+	}
+	scope := r.SelectedNodePkg.Pkg.Scope()
+	if obj := scope.Lookup(r.structName); obj != nil {
+		r.Log.Errorf("The name %s is already declared in package %s",
+			r.structName, r.SelectedNodePkg.Pkg.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+
+	exported := ast.IsExported(r.structName)
+	r.paramName = strings.ToLower(r.structName[:1]) + r.structName[1:]
+	if !exported {
+		r.paramName = r.structName[:1]
+	}
+	for _, p := range r.group.Params {
+		if exported {
+			r.fields = append(r.fields, capitalize(p.Name))
+		} else {
+			r.fields = append(r.fields, p.Name)
+		}
+	}
+
+	for _, decl := range r.decls {
+		for _, name := range []string{r.paramName, r.structName} {
+			if usesName(decl, name) {
+				r.Log.Errorf("%s already uses the name %s",
+					decl.Name.Name, name)
+				r.Log.AssociateNode(decl.Name)
+				return false
+			}
+		}
+		if !r.refersToStruct(decl.Type.Params.Opening) {
+			return false
+		}
+	}
+	return true
+}
+
+// refersToStruct returns true if the struct's name would refer to the new
+// struct at the given position in the selected package; otherwise, it logs
+// an error and returns false.
+func (r *ExtractParameterObject) refersToStruct(pos token.Pos) bool {
+	scope := r.SelectedNodePkg.Pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return true
+	}
+	if _, obj := scope.LookupParent(r.structName, pos); obj != nil {
+		r.Log.Errorf("The name %s would refer to a different "+
+			"declaration here", r.structName)
+		r.Log.AssociatePos(pos, pos)
+		return false
+	}
+	return true
+}
+
+// paramIdents returns the identifiers declaring the parameters of the given
+// function, together with the field declaring each.
+func paramIdents(decl *ast.FuncDecl) ([]*ast.Ident, []*ast.Field) {
+	ids, fields := []*ast.Ident{}, []*ast.Field{}
+	for _, field := range decl.Type.Params.List {
+		for _, name := range field.Names {
+			ids = append(ids, name)
+			fields = append(fields, field)
+		}
+	}
+	return ids, fields
+}
+
+// addStruct declares the struct before the first function declaring the
+// group, returning false (after logging an error) if its file cannot be read.
+func (r *ExtractParameterObject) addStruct(config *Config) bool {
+	decl := r.decls[0]
+	m := r.migration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, decl.Pos()))
+	if m == nil {
+		return false
+	}
+	_, fields := paramIdents(decl)
+	offset := r.group.Offsets[0]
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s contains parameters shared by %s.\n",
+		r.structName, r.funcNames())
+	fmt.Fprintf(&b, "type %s struct {\n", r.structName)
+	width := 0
+	for _, field := range r.fields {
+		if len(field) > width {
+			width = len(field)
+		}
+	}
+	for i, field := range r.fields {
+		fmt.Fprintf(&b, "\t%-*s %s\n", width, field,
+			m.textOf(fields[offset+i].Type))
+	}
+	b.WriteString("}\n\n")
+
+	var start ast.Node = decl
+	if decl.Doc != nil {
+		start = decl.Doc
+	}
+	code := DetectIndentStyle(m.src).Reindent(b.String(), "")
+	m.replace(start.Pos(), start.Pos(), code)
+	return true
+}
+
+// rewriteSignature replaces the group's parameters, starting at the given
+// index, with the new parameter.  Parameters declared in the same field as
+// the first or last parameter of the group, but not in the group, are
+// retained.
+func (r *ExtractParameterObject) rewriteSignature(m *fileMigration, decl *ast.FuncDecl, offset int) {
+	ids, fields := paramIdents(decl)
+	first, last := offset, offset+len(r.group.Params)-1
+	firstField, lastField := fields[first], fields[last]
+
+	var b bytes.Buffer
+	before := []string{}
+	for i := first - 1; i >= 0 && fields[i] == firstField; i-- {
+		before = append([]string{ids[i].Name}, before...)
+	}
+	if len(before) > 0 {
+		fmt.Fprintf(&b, "%s %s, ", strings.Join(before, ", "),
+			m.textOf(firstField.Type))
+	}
+	fmt.Fprintf(&b, "%s %s", r.paramName, r.structName)
+	after := []string{}
+	for i := last + 1; i < len(ids) && fields[i] == lastField; i++ {
+		after = append(after, ids[i].Name)
+	}
+	if len(after) > 0 {
+		fmt.Fprintf(&b, ", %s %s", strings.Join(after, ", "),
+			m.textOf(lastField.Type))
+	}
+	m.replace(firstField.Pos(), lastField.End(), b.String())
+}
+
+// findFieldRefs records the references to the group's parameters in the body
+// of the given function, which will be replaced by references to the
+// corresponding fields.
+func (r *ExtractParameterObject) findFieldRefs(decl *ast.FuncDecl, fn *types.Func, offset int) {
+	sig := fn.Type().(*types.Signature)
+	fields := map[types.Object]string{}
+	for i, field := range r.fields {
+		fields[sig.Params().At(offset+i)] = field
+	}
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if field, ok := fields[r.SelectedNodePkg.Uses[id]]; ok {
+				r.fieldRefs[id] = r.paramName + "." + field
+			}
+		}
+		return true
+	})
+}
+
+// textOf returns the source text of the given node, replacing any references
+// to the group's parameters in it (which are then no longer replaced
+// separately).
+func (r *ExtractParameterObject) textOf(m *fileMigration, node ast.Node) string {
+	ids := []*ast.Ident{}
+	for id := range r.fieldRefs {
+		if id.Pos() >= node.Pos() && id.End() <= node.End() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+	var b bytes.Buffer
+	pos := node.Pos()
+	for _, id := range ids {
+		b.WriteString(m.text(pos, id.Pos()))
+		b.WriteString(r.fieldRefs[id])
+		pos = id.End()
+		delete(r.fieldRefs, id)
+	}
+	b.WriteString(m.text(pos, node.End()))
+	return b.String()
+}
+
+// replaceFieldRefs replaces the remaining references to the group's
+// parameters.
+func (r *ExtractParameterObject) replaceFieldRefs(config *Config) {
+	for id, replacement := range r.fieldRefs {
+		m := r.migration(config, r.SelectedNodePkg,
+			fileContaining(r.SelectedNodePkg, id.Pos()))
+		if m == nil {
+			return
+		}
+		m.replace(id.Pos(), id.End(), replacement)
+	}
+}
+
+// rewriteCalls rewrites each call to a function declaring the group to pass
+// a composite literal in place of the group's arguments.
+func (r *ExtractParameterObject) rewriteCalls(config *Config) {
+	offsets := map[types.Object]int{}
+	for i, fn := range r.group.Funcs {
+		offsets[fn] = r.group.Offsets[i]
+	}
+	for _, pkgInfo := range r.Program.AllPackages {
+		ids := []*ast.Ident{}
+		for id, obj := range pkgInfo.Uses {
+			if _, ok := offsets[obj]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		for _, id := range ids {
+			fn := pkgInfo.Uses[id].(*types.Func)
+			offset := offsets[fn]
+			file := fileContaining(pkgInfo, id.Pos())
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			call := callOf(&reference{pkgInfo, file, id, path[1:]})
+			if call == nil || len(call.Args) < offset+len(r.fields) {
+				r.Log.Errorf("%s can only be called directly, with one "+
+					"argument for each parameter", fn.Name())
+				r.Log.AssociateNode(id)
+				continue
+			}
+			if pkgInfo != r.SelectedNodePkg && !ast.IsExported(r.structName) {
+				r.Log.Errorf("%s is called from package %s, so the "+
+					"struct's name must be exported", fn.Name(),
+					pkgInfo.Pkg.Name())
+				r.Log.AssociateNode(id)
+				continue
+			}
+			if pkgInfo == r.SelectedNodePkg && !r.refersToStruct(call.Lparen) {
+				continue
+			}
+			m := r.migration(config, pkgInfo, file)
+			if m == nil {
+				return
+			}
+			r.rewriteCall(m, call, call.Args[offset:offset+len(r.fields)])
+		}
+	}
+}
+
+// rewriteCall replaces the given arguments of the call with a composite
+// literal of the struct type.
+func (r *ExtractParameterObject) rewriteCall(m *fileMigration, call *ast.CallExpr, args []ast.Expr) {
+	values := []string{}
+	for i, arg := range args {
+		values = append(values, fmt.Sprintf("%s: %s", r.fields[i],
+			r.textOf(m, arg)))
+	}
+	pkg := r.SelectedNodePkg.Pkg
+	m.replace(args[0].Pos(), args[len(args)-1].End(), fmt.Sprintf("%s{%s}",
+		m.qualify(pkg.Path(), pkg.Name(), r.structName, call.Pos()),
+		strings.Join(values, ", ")))
+}
+
+const extractParameterObjectDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Parameter Object refactoring finds a group of parameters
+  that several functions in a package declare together, replaces the group
+  with a single parameter whose type is a new struct with a field for each
+  parameter, and updates every call to those functions.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration.</li>
+    <li>Activate the Extract Parameter Object refactoring.</li>
+    <li>Enter a name for the new struct.</li>
+  </ol>
+
+  <p>A group consists of two or more consecutive parameters that at least one
+  other function in the same package also declares, with the same names and
+  types, in the same order.  If the selected function declares several such
+  groups, the one with the most parameters is replaced.  The struct's fields
+  are named after the parameters (capitalized if the struct is exported),
+  and the new parameter is named after the struct.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of extracting a parameter
+  object named <tt>Point</tt> from <tt>Move</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func <span class="highlight">Move</span>(x, y int, dx int) {
+    draw(x+dx, y)
+}
+
+func Mark(label string, x, y int) {
+    fmt.Println(label, x, y)
+}
+
+func main() {
+    Move(1, 2, 3)
+    Mark("origin", 0, 0)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>// Point contains parameters shared by Move and Mark.
+type Point struct {
+    X int
+    Y int
+}
+
+func Move(point Point, dx int) {
+    draw(point.X+dx, point.Y)
+}
+
+func Mark(label string, point Point) {
+    fmt.Println(label, point.X, point.Y)
+}
+
+func main() {
+    Move(Point{X: 1, Y: 2}, 3)
+    Mark("origin", Point{X: 0, Y: 0})
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
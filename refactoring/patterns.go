@@ -0,0 +1,146 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the include and exclude patterns that restrict which
+// files a refactoring analyzes and modifies.
+
+package refactoring
+
+import (
+	"go/build"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// matchesPattern returns true iff the given file matches the given glob
+// pattern.  Patterns use the syntax of path.Match and are interpreted as
+// follows.
+//
+// A pattern ending with a slash matches directories: a file matches if any
+// directory containing it matches.  For example, vendor/ matches every file in
+// every directory named vendor (and its subdirectories), and a/b/ matches
+// every file under any directory b whose parent is named a.
+//
+// Any other pattern matches files.  If the pattern does not contain a slash,
+// it is matched against the file's base name (e.g., *.pb.go); otherwise, it is
+// matched against the trailing elements of the file's path (e.g., gen/*.go
+// matches every .go file in a directory named gen).
+func matchesPattern(pattern, filename string) bool {
+	elems := strings.Split(filepath.ToSlash(filename), "/")
+	if strings.HasSuffix(pattern, "/") {
+		parts := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+		dirs := elems[:len(elems)-1]
+		for i := 0; i+len(parts) <= len(dirs); i++ {
+			if matchesElems(parts, dirs[i:i+len(parts)]) {
+				return true
+			}
+		}
+		return false
+	}
+	parts := strings.Split(pattern, "/")
+	if len(parts) > len(elems) {
+		return false
+	}
+	return matchesElems(parts, elems[len(elems)-len(parts):])
+}
+
+// matchesElems returns true iff each path element matches the corresponding
+// pattern.  Both slices must have the same length.
+func matchesElems(patterns, elems []string) bool {
+	for i, p := range patterns {
+		if ok, err := path.Match(p, elems[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny returns true iff the given file matches at least one of the given
+// patterns.
+func matchesAny(patterns []string, filename string) bool {
+	for _, pattern := range patterns {
+		if matchesPattern(pattern, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExcluded returns true iff the given file should not be modified by a
+// refactoring according to config.Include and config.Exclude.  A file is
+// excluded if it matches any of the Exclude patterns or if Include patterns
+// are given and it does not match any of them.
+func IsExcluded(config *Config, filename string) bool {
+	if matchesAny(config.Exclude, filename) {
+		return true
+	}
+	return len(config.Include) > 0 && !matchesAny(config.Include, filename)
+}
+
+// isDirExcluded returns true iff every file in the given directory is excluded
+// by a directory pattern (i.e., a pattern ending with a slash).  Function
+// bodies in such directories are not type checked.
+func isDirExcluded(config *Config, dir string) bool {
+	// A hypothetical file in dir matches a directory pattern iff dir does
+	filename := filepath.Join(dir, "_")
+	for _, pattern := range config.Exclude {
+		if strings.HasSuffix(pattern, "/") &&
+			matchesPattern(pattern, filename) {
+			return true
+		}
+	}
+	included := false
+	for _, pattern := range config.Include {
+		if !strings.HasSuffix(pattern, "/") ||
+			matchesPattern(pattern, filename) {
+			included = true
+		}
+	}
+	return len(config.Include) > 0 && !included
+}
+
+// typeCheckFuncBodies returns a predicate, suitable for use as the loader's
+// TypeCheckFuncBodies function, that returns false for packages in excluded
+// directories (except the package containing the selection).  This avoids
+// analyzing excluded code in detail; consequently, references in the function
+// bodies of excluded packages are not found.  If no patterns are given, it
+// returns nil, so all function bodies are type checked.
+func typeCheckFuncBodies(config *Config, ctxt *build.Context) func(string) bool {
+	if len(config.Include) == 0 && len(config.Exclude) == 0 {
+		return nil
+	}
+	selectedDir := ""
+	if config.Selection != nil {
+		selectedDir, _ = filepath.Abs(filepath.Dir(config.Selection.GetFilename()))
+	}
+	return func(importPath string) bool {
+		pkg, err := ctxt.Import(importPath, "", build.FindOnly)
+		if err != nil || pkg.Goroot {
+			return true
+		}
+		dir, err := filepath.Abs(pkg.Dir)
+		if err != nil || dir == selectedDir {
+			return true
+		}
+		return !isDirExcluded(config, dir)
+	}
+}
+
+// removeExcludedEdits discards the edits to files that are excluded according
+// to config.Include and config.Exclude, logging a warning for each such file.
+func (r *RefactoringBase) removeExcludedEdits(config *Config) {
+	excluded := []string{}
+	for filename, edits := range r.Edits {
+		if !isEmpty(edits) && IsExcluded(config, filename) {
+			excluded = append(excluded, filename)
+		}
+	}
+	sort.Strings(excluded)
+	for _, filename := range excluded {
+		r.Log.Warnf("%s is excluded, so it was not modified", filename)
+		delete(r.Edits, filename)
+	}
+}
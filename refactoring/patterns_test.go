@@ -0,0 +1,66 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import "testing"
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		pattern, filename string
+		matches           bool
+	}{
+		{"*.pb.go", "/src/a/b.pb.go", true},
+		{"*.pb.go", "/src/a/b.go", false},
+		{"*.pb.go", "b.pb.go", true},
+		{"gen/*.go", "/src/a/gen/b.go", true},
+		{"gen/*.go", "/src/gen/a/b.go", false},
+		{"a/gen/*.go", "gen/b.go", false},
+		{"vendor/", "/src/a/vendor/b/c.go", true},
+		{"vendor/", "/src/a/vendor/c.go", true},
+		{"vendor/", "/src/a/b/vendor.go", false},
+		{"a/b/", "/src/a/b/c/d.go", true},
+		{"a/b/", "/src/b/a/d.go", false},
+		{"third_*/", "/src/third_party/x.go", true},
+		{"[", "/src/a.go", false},
+	}
+	for _, test := range tests {
+		if matchesPattern(test.pattern, test.filename) != test.matches {
+			t.Fatalf("matchesPattern(%q, %q): expected %t",
+				test.pattern, test.filename, test.matches)
+		}
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	config := &Config{
+		Include: []string{"a/", "main.go"},
+		Exclude: []string{"*_test.go", "a/internal/"},
+	}
+	tests := []struct {
+		filename string
+		excluded bool
+	}{
+		{"/src/main.go", false},
+		{"/src/a/a.go", false},
+		{"/src/a/a_test.go", true},
+		{"/src/a/internal/b.go", true},
+		{"/src/b/b.go", true},
+	}
+	for _, test := range tests {
+		if IsExcluded(config, test.filename) != test.excluded {
+			t.Fatalf("IsExcluded(%q): expected %t",
+				test.filename, test.excluded)
+		}
+	}
+
+	if !isDirExcluded(config, "/src/a/internal") ||
+		isDirExcluded(config, "/src/a") ||
+		isDirExcluded(config, "/src/b") {
+		t.Fatal("isDirExcluded returned incorrect result")
+	}
+	if IsExcluded(&Config{}, "/src/main.go") {
+		t.Fatal("No files should be excluded without patterns")
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that migrates code from the
+// github.com/pkg/errors package to the standard library's errors and fmt
+// packages.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// pkgErrorsPath is the import path of the github.com/pkg/errors package.
+const pkgErrorsPath = "github.com/pkg/errors"
+
+// stdlibCompatible contains the names of the functions in github.com/pkg/errors
+// that behave the same as the functions with the same names in the standard
+// library's errors package.
+var stdlibCompatible = map[string]bool{
+	"New":    true,
+	"Is":     true,
+	"As":     true,
+	"Unwrap": true,
+}
+
+// MigratePkgErrors is a transformation that replaces uses of the
+// github.com/pkg/errors package with their equivalents in the standard
+// library, in every file in the scope:
+//
+//     errors.Wrap(err, "msg")             fmt.Errorf("msg: %w", err)
+//     errors.Wrapf(err, "f %d", x)        fmt.Errorf("f %d: %w", x, err)
+//     errors.WithMessage(err, "msg")      fmt.Errorf("msg: %w", err)
+//     errors.WithMessagef(err, "f %d", x) fmt.Errorf("f %d: %w", x, err)
+//     errors.WithStack(err)               err
+//     errors.Errorf("f %d", x)            fmt.Errorf("f %d", x)
+//     errors.Cause(err) == target         errors.Is(err, target)
+//
+// The functions New, Is, As, and Unwrap are unchanged, since the standard
+// library's errors package provides them.  If a file does not use anything
+// else from github.com/pkg/errors, its import is changed to (or replaced by)
+// the standard library's errors package; otherwise, it is retained, and a
+// warning is logged for each remaining use.
+type MigratePkgErrors struct {
+	RefactoringBase
+	// Whether any file imported github.com/pkg/errors
+	found bool
+}
+
+func (r *MigratePkgErrors) Description() *Description {
+	return &Description{
+		Name:           "Migrate pkg/errors to Standard Library",
+		Synopsis:       "Replaces github.com/pkg/errors with the standard errors and fmt packages",
+		Usage:          "",
+		Selection:      "",
+		HTMLDoc:        migratePkgErrorsDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *MigratePkgErrors) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	for _, pkgInfo := range r.migrationCandidates(isPkgErrors) {
+		for _, file := range pkgInfo.Files {
+			r.migrateFile(config, pkgInfo, file)
+		}
+	}
+	if !r.found {
+		r.Log.Errorf("No files import %s", pkgErrorsPath)
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// isPkgErrors returns true if the given import path is that of
+// github.com/pkg/errors or a vendored copy of it.
+func isPkgErrors(path string) bool {
+	return path == pkgErrorsPath ||
+		strings.HasSuffix(path, "/vendor/"+pkgErrorsPath)
+}
+
+// A pkgErrorsMigration contains the state used to migrate a single file.
+type pkgErrorsMigration struct {
+	*fileMigration
+}
+
+// migrateFile migrates uses of github.com/pkg/errors in the given file.
+func (r *MigratePkgErrors) migrateFile(config *Config, pkgInfo *loader.PackageInfo, file *ast.File) {
+	if !importsPackage(pkgInfo, file, isPkgErrors) {
+		return
+	}
+	r.found = true
+	fm := r.newFileMigration(config, pkgInfo, file)
+	if fm == nil {
+		return
+	}
+	m := &pkgErrorsMigration{fm}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			m.migrateCauseComparison(n)
+		case *ast.CallExpr:
+			m.migrateCall(n)
+		}
+		return true
+	})
+	for _, spec := range m.importsOf(isPkgErrors) {
+		m.migrateImport(spec)
+	}
+	m.finish()
+}
+
+// pkgErrorsFunc determines whether the given expression refers to a function
+// (or other member) of github.com/pkg/errors, e.g., errors.Wrap.  If so, it
+// returns the package name (errors) and the member's name (Wrap).
+func (m *pkgErrorsMigration) pkgErrorsFunc(expr ast.Expr) (*ast.Ident, string) {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return nil, ""
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || m.removed[id] {
+		return nil, ""
+	}
+	pkgName, ok := m.pkgInfo.Uses[id].(*types.PkgName)
+	if !ok || !isPkgErrors(pkgName.Imported().Path()) {
+		return nil, ""
+	}
+	return id, sel.Sel.Name
+}
+
+// migrateCauseComparison replaces errors.Cause(err) == target with
+// errors.Is(err, target), and errors.Cause(err) != target with
+// !errors.Is(err, target).
+func (m *pkgErrorsMigration) migrateCauseComparison(binary *ast.BinaryExpr) {
+	if binary.Op != token.EQL && binary.Op != token.NEQ {
+		return
+	}
+	call, ok := binary.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return
+	}
+	if _, name := m.pkgErrorsFunc(call.Fun); name != "Cause" {
+		return
+	}
+	not := ""
+	if binary.Op == token.NEQ {
+		not = "!"
+	}
+	sel := call.Fun.(*ast.SelectorExpr)
+	m.replace(binary.Pos(), sel.Sel.Pos(), not+m.text(sel.X.Pos(), sel.Sel.Pos()))
+	m.replace(sel.Sel.Pos(), sel.Sel.End(), "Is")
+	m.replace(call.Args[0].End(), binary.Y.Pos(), ", ")
+	m.replace(binary.Y.End(), binary.Y.End(), ")")
+	m.removed[sel.Sel] = true
+}
+
+// migrateCall replaces a call to a function in github.com/pkg/errors with its
+// standard library equivalent, if necessary.
+func (m *pkgErrorsMigration) migrateCall(call *ast.CallExpr) {
+	id, name := m.pkgErrorsFunc(call.Fun)
+	if id == nil || call.Ellipsis.IsValid() {
+		return
+	}
+	if len(call.Args) > 1 && (strings.HasPrefix(name, "Wrap") ||
+		strings.HasPrefix(name, "WithMessage")) {
+		for _, arg := range call.Args[1:] {
+			if m.containsPkgErrorsCall(arg) {
+				// The argument's text will be moved, so calls
+				// inside it cannot be migrated
+				return
+			}
+		}
+	}
+
+	switch name {
+	case "Errorf":
+		m.replace(call.Fun.Pos(), call.Fun.End(), m.qualify("fmt", "fmt", "Errorf", call.Pos()))
+
+	case "Wrap", "WithMessage":
+		if len(call.Args) != 2 {
+			return
+		}
+		format, args := `"%s: %w"`, m.textOf(call.Args[1])+", "
+		if lit, ok := call.Args[1].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			msg, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return
+			}
+			format = strconv.Quote(strings.Replace(msg, "%", "%%", -1) + ": %w")
+			args = ""
+		}
+		m.replace(call.Pos(), call.Args[0].Pos(),
+			m.qualify("fmt", "fmt", "Errorf", call.Pos())+"("+format+", "+args)
+		m.replace(call.Args[0].End(), call.Rparen, "")
+		m.checkNilGuard(call, name)
+
+	case "Wrapf", "WithMessagef":
+		if len(call.Args) < 2 {
+			return
+		}
+		format := m.textOf(call.Args[1]) + ` + ": %w"`
+		if lit, ok := call.Args[1].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			msg, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return
+			}
+			format = strconv.Quote(msg + ": %w")
+		}
+		args := ""
+		for _, arg := range call.Args[2:] {
+			args += m.textOf(arg) + ", "
+		}
+		m.replace(call.Pos(), call.Args[0].Pos(),
+			m.qualify("fmt", "fmt", "Errorf", call.Pos())+"("+format+", "+args)
+		m.replace(call.Args[0].End(), call.Rparen, "")
+		m.checkNilGuard(call, name)
+
+	case "WithStack":
+		if len(call.Args) != 1 {
+			return
+		}
+		m.replace(call.Pos(), call.Args[0].Pos(), "")
+		m.replace(call.Args[0].End(), call.End(), "")
+
+	default:
+		return
+	}
+	m.removed[id] = true
+}
+
+// containsPkgErrorsCall returns true if the given node contains a call to a
+// function in github.com/pkg/errors, other than one that is unchanged by this
+// transformation.
+func (m *pkgErrorsMigration) containsPkgErrorsCall(node ast.Node) bool {
+	result := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if id, name := m.pkgErrorsFunc(call.Fun); id != nil && !stdlibCompatible[name] {
+				result = true
+			}
+		}
+		return !result
+	})
+	return result
+}
+
+// checkNilGuard logs a warning if the given call to errors.Wrap (or a similar
+// function) is not inside an if statement that checks that its error argument
+// is non-nil, since Wrap returns nil if its argument is nil, but fmt.Errorf
+// never returns nil.
+func (m *pkgErrorsMigration) checkNilGuard(call *ast.CallExpr, name string) {
+	if id, ok := call.Args[0].(*ast.Ident); ok {
+		obj := m.pkgInfo.ObjectOf(id)
+		path, _ := astutil.PathEnclosingInterval(m.file, call.Pos(), call.End())
+		for i := 1; i < len(path); i++ {
+			ifStmt, ok := path[i].(*ast.IfStmt)
+			if !ok || path[i-1] != ifStmt.Body {
+				continue
+			}
+			if m.isNonNilCheck(ifStmt.Cond, obj) {
+				return
+			}
+		}
+	}
+	r := m.r
+	r.Log.Warnf("errors.%s returns nil if its argument is nil, but "+
+		"fmt.Errorf does not", name)
+	r.Log.AssociatePos(call.Pos(), call.End())
+}
+
+// isNonNilCheck returns true if the given expression has the form x != nil or
+// nil != x, where x refers to the given object.
+func (m *pkgErrorsMigration) isNonNilCheck(cond ast.Expr, obj types.Object) bool {
+	binary, ok := cond.(*ast.BinaryExpr)
+	if !ok || binary.Op != token.NEQ {
+		return false
+	}
+	isNil := func(expr ast.Expr) bool {
+		id, ok := expr.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		_, ok = m.pkgInfo.Uses[id].(*types.Nil)
+		return ok
+	}
+	isObj := func(expr ast.Expr) bool {
+		id, ok := expr.(*ast.Ident)
+		return ok && m.pkgInfo.ObjectOf(id) == obj
+	}
+	return isObj(binary.X) && isNil(binary.Y) || isNil(binary.X) && isObj(binary.Y)
+}
+
+// migrateImport changes the given import of github.com/pkg/errors to an
+// import of the standard library's errors package if the remaining uses of
+// the package are compatible with the standard library, or removes it if it
+// is no longer used.  If an import of fmt is needed, it replaces an import
+// that is removed (see fileMigration.removeImport).
+func (m *pkgErrorsMigration) migrateImport(spec *ast.ImportSpec) {
+	r := m.r
+	pkgName := importedPkgName(m.pkgInfo, spec)
+	used, compatible := false, true
+	ast.Inspect(m.file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok || m.removed[id] || m.pkgInfo.Uses[id] != pkgName {
+			return true
+		}
+		used = true
+		if !stdlibCompatible[sel.Sel.Name] && !m.removed[sel.Sel] {
+			compatible = false
+			r.Log.Warnf("%s.%s has no equivalent in the standard "+
+				"library, so %s is still imported", pkgName.Name(),
+				sel.Sel.Name, pkgErrorsPath)
+			r.Log.AssociateNode(sel)
+		}
+		return true
+	})
+
+	if !compatible {
+		return
+	}
+
+	if used && !m.importsStdlibErrors(pkgName.Name()) {
+		r.replaceImportPath(m.filename, &text.Extent{
+			Offset: m.offset(spec.Path.Pos()),
+			Length: len(spec.Path.Value),
+		}, "errors")
+		return
+	}
+
+	m.removeImport(spec)
+}
+
+// importsStdlibErrors returns true if the file imports the standard library's
+// errors package with the given name.
+func (m *pkgErrorsMigration) importsStdlibErrors(name string) bool {
+	for _, spec := range m.file.Imports {
+		pkgName := importedPkgName(m.pkgInfo, spec)
+		if pkgName != nil && pkgName.Imported().Path() == "errors" &&
+			pkgName.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+const migratePkgErrorsDoc = `
+  <h4>Purpose</h4>
+  <p>The Migrate pkg/errors to Standard Library transformation replaces uses of
+  the <tt>github.com/pkg/errors</tt> package with the equivalent functionality
+  in the standard library's <tt>errors</tt> and <tt>fmt</tt> packages, in every
+  file in the refactoring scope.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Activate the Migrate pkg/errors to Standard Library transformation.</li>
+  </ol>
+
+  <p>Calls are replaced as follows:</p>
+  <table cellspacing="5" cellpadding="5" style="border: 0;">
+    <tr><th>Before</th><th>After</th></tr>
+    <tr><td><tt>errors.Wrap(err, "msg")</tt></td>
+        <td><tt>fmt.Errorf("msg: %w", err)</tt></td></tr>
+    <tr><td><tt>errors.Wrapf(err, "f %d", x)</tt></td>
+        <td><tt>fmt.Errorf("f %d: %w", x, err)</tt></td></tr>
+    <tr><td><tt>errors.WithMessage(err, "msg")</tt></td>
+        <td><tt>fmt.Errorf("msg: %w", err)</tt></td></tr>
+    <tr><td><tt>errors.WithStack(err)</tt></td>
+        <td><tt>err</tt></td></tr>
+    <tr><td><tt>errors.Errorf("f %d", x)</tt></td>
+        <td><tt>fmt.Errorf("f %d", x)</tt></td></tr>
+    <tr><td><tt>errors.Cause(err) == target</tt></td>
+        <td><tt>errors.Is(err, target)</tt></td></tr>
+  </table>
+
+  <p><tt>errors.New</tt>, <tt>errors.Is</tt>, <tt>errors.As</tt>, and
+  <tt>errors.Unwrap</tt> are provided by the standard library, so they are
+  unchanged.  Imports are updated accordingly.  If a file uses anything else
+  from <tt>github.com/pkg/errors</tt> (e.g., <tt>errors.Cause</tt> outside a
+  comparison, or <tt>errors.StackTrace</tt>), its import is retained, and a
+  warning is reported for each such use.</p>
+
+  <p>Note that <tt>errors.Wrap</tt> returns <tt>nil</tt> if the error it is
+  given is <tt>nil</tt>, while <tt>fmt.Errorf</tt> never returns
+  <tt>nil</tt>.  A warning is reported for each call that is not inside an
+  <tt>if err != nil</tt> block.  Also, the standard library does not record
+  stack traces.</p>
+`
@@ -0,0 +1,179 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines LoadedProgram, which allows a parsed and type-checked
+// program to be shared by several refactorings (e.g., refactorings requested
+// by several clients of a server), rather than each refactoring loading the
+// same program again.
+
+package refactoring
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/loader"
+
+	"github.com/godoctor/godoctor/filesystem"
+)
+
+// A LoadedProgram is a parsed and type-checked Program that may be shared by
+// any number of refactorings, including refactorings that run concurrently.
+// It is immutable: neither refactorings nor their clients may modify its
+// FileSet, ASTs, or type information.
+//
+// A LoadedProgram reflects the contents of the file system at the time it was
+// loaded; once any of its files change (e.g., after a refactoring's edits are
+// applied), a new LoadedProgram must be loaded.
+type LoadedProgram struct {
+	// The Program that was loaded
+	Program *loader.Program
+	// The scope from which the Program was loaded (see Config.Scope)
+	Scope []string
+	// Errors (e.g., type errors) reported while the Program was loaded;
+	// these are copied into the Log of each refactoring that uses it
+	entries []*Entry
+	// Checksums of the files that were read while the Program was loaded
+	checksums map[string]string
+}
+
+// LoadProgram loads the Program given by config.Scope from config.FileSystem,
+// so it can be shared by refactorings whose Configs have the same FileSystem
+// and Scope (see Config.Program).  Only the FileSystem, Scope, GoPath, GoRoot,
+// and Exclude fields of the Config are used; the Scope must not be nil.
+func LoadProgram(config *Config) (*LoadedProgram, error) {
+	if config.FileSystem == nil {
+		return nil, errors.New("null Config.FileSystem")
+	}
+	if config.Scope == nil {
+		return nil, errors.New("a scope is required to load a program")
+	}
+	log := NewLog()
+	prog, checksums, err := loadProgram(config, log)
+	if err != nil {
+		return nil, err
+	} else if prog == nil {
+		return nil, errors.New("loader failed")
+	}
+	return &LoadedProgram{
+		Program:   prog,
+		Scope:     append([]string{}, config.Scope...),
+		entries:   log.Entries,
+		checksums: checksums,
+	}, nil
+}
+
+// initialEntries returns copies of the entries logged while this program was
+// loaded, since refactorings modify the entries in their logs.
+func (p *LoadedProgram) initialEntries() []*Entry {
+	result := make([]*Entry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		copy := *entry
+		result = append(result, &copy)
+	}
+	return result
+}
+
+// hasScope returns true if this program was loaded from the given scope.
+func (p *LoadedProgram) hasScope(scope []string) bool {
+	if len(scope) != len(p.Scope) {
+		return false
+	}
+	for i := range scope {
+		if scope[i] != p.Scope[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadProgram loads the Program given by config.Scope from config.FileSystem,
+// logging the errors (e.g., type errors) reported while it is loaded, up to a
+// total of maxInitialErrors entries in the log.  Syntax errors are logged
+// individually, after the other errors, so each one is associated with its
+// position (see logSyntaxErrors).  It also returns checksums of the files
+// that were read (other than those in $GOROOT), keyed by filename, so that
+// clients can detect files that change before a refactoring's edits are
+// applied (see Result.Checksums).
+func loadProgram(config *Config, log *Log) (*loader.Program, map[string]string, error) {
+	fs := &checksumFileSystem{
+		FileSystem: config.FileSystem,
+		checksums:  map[string]string{},
+	}
+	oldFS := config.FileSystem
+	defer func() { config.FileSystem = oldFS }()
+	config.FileSystem = fs
+
+	stdin, _ := filesystem.FakeStdinPath()
+	mutex := &sync.Mutex{}
+	syntaxErrors := scanner.ErrorList{}
+	prog, err := createLoader(config, func(err error) {
+		message := strings.Replace(err.Error(), stdin+":", "<stdin>:", -1)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch err := err.(type) {
+		case scanner.ErrorList:
+			syntaxErrors = append(syntaxErrors, err...)
+			return
+		case *scanner.Error:
+			syntaxErrors = append(syntaxErrors, err)
+			return
+		}
+		// TODO: This is temporary until go/loader handles cgo
+		if !strings.Contains(message, cgoError1) &&
+			!strings.HasSuffix(message, cgoError2) {
+			if len(log.Entries) >= maxInitialErrors {
+				return
+			}
+			if err, ok := err.(types.Error); ok {
+				log.Error(err.Msg)
+				log.AssociatePos(err.Pos, err.Pos)
+			} else {
+				log.Error(message)
+			}
+		}
+	})
+	if prog != nil {
+		logSyntaxErrors(log, prog.Fset, syntaxErrors)
+	}
+	return prog, fs.checksums, err
+}
+
+// logSyntaxErrors logs each of the given syntax errors as a separate entry,
+// associated with the position of the error in the given FileSet, so that
+// clients can report the file, line, and column of each error.
+func logSyntaxErrors(log *Log, fset *token.FileSet, errs scanner.ErrorList) {
+	files := map[string]*token.File{}
+	fset.Iterate(func(f *token.File) bool {
+		files[f.Name()] = f
+		return true
+	})
+	errs.Sort()
+	for _, e := range errs {
+		log.Error(syntaxErrorMessage(e.Msg))
+		log.Entries[len(log.Entries)-1].isSyntax = true
+		if pos := filePos(files[e.Pos.Filename], e.Pos); pos.IsValid() {
+			log.AssociatePos(pos, pos)
+		}
+	}
+}
+
+// syntaxErrorMessage returns the message logged for a syntax error.
+func syntaxErrorMessage(msg string) string {
+	return fmt.Sprintf("Syntax error: %s", msg)
+}
+
+// filePos returns the Pos in the given File corresponding to the given
+// Position, or token.NoPos if the File is nil or does not contain it.
+func filePos(file *token.File, position token.Position) token.Pos {
+	if file == nil || position.Offset < 0 || position.Offset > file.Size() {
+		return token.NoPos
+	}
+	return file.Pos(position.Offset)
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains utilities for refactorings that insert code referring to
+// other packages (e.g., types in the signature of an extracted function).  An
+// ImportResolver determines whether the file already imports a package under a
+// name that is visible where the code will be inserted; if not, it chooses a
+// name that does not collide with any other identifier and describes the
+// import that must be added to the file.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// An ImportResolver determines how code inserted into a particular file should
+// refer to other packages.
+type ImportResolver struct {
+	fset    *token.FileSet
+	file    *ast.File
+	pkgInfo *loader.PackageInfo
+	src     []byte
+	// Names of imports added by Qualify, keyed by import path
+	added map[string]string
+	// Edits returned by Qualify, in the order they were created
+	edits []*ImportEdit
+}
+
+// An ImportEdit describes an import declaration that must be added to a file
+// so that inserted code can refer to a package.
+type ImportEdit struct {
+	// The name used to refer to the package.  The import declaration gives
+	// the package this name unless it is the package's own name.
+	Name string
+	// The import path of the package
+	Path string
+	// The location where the import should be inserted (of length zero)
+	Extent *text.Extent
+	// The text to insert
+	Replacement string
+	// The import spec, e.g., "fmt" or fmt2 "fmt"
+	spec string
+}
+
+// AddTo adds this edit to the given EditSet.
+func (e *ImportEdit) AddTo(edits *text.EditSet) error {
+	return edits.Add(e.Extent, e.Replacement)
+}
+
+// NewImportResolver returns an ImportResolver for the given file, which is
+// part of the given package; src is the file's contents.
+func NewImportResolver(fset *token.FileSet, file *ast.File, pkgInfo *loader.PackageInfo, src []byte) *ImportResolver {
+	return &ImportResolver{
+		fset:    fset,
+		file:    file,
+		pkgInfo: pkgInfo,
+		src:     src,
+		added:   map[string]string{},
+	}
+}
+
+// ImportResolver returns an ImportResolver for the file containing the user's
+// selection.
+func (r *RefactoringBase) ImportResolver() *ImportResolver {
+	return NewImportResolver(r.Program.Fset, r.File, r.SelectedNodePkg,
+		r.FileContents)
+}
+
+// Qualify returns the qualifier that code inserted at the given position
+// should use to refer to members of pkg: "" if pkg is the file's own package
+// (or is dot-imported), the local name of an existing import if that name is
+// visible at pos, or a new name otherwise.  In the last case, Qualify also
+// returns an ImportEdit that adds the necessary import to the file; subsequent
+// calls for the same package return the same name and no edit.
+//
+// The new name is the package's name, if that does not conflict with any
+// declaration in the package or file or any declaration visible at pos;
+// otherwise, a number is appended to make it unique (e.g., fmt2).
+func (ir *ImportResolver) Qualify(pkg *types.Package, pos token.Pos) (string, *ImportEdit) {
+	if pkg == nil || pkg.Path() == ir.pkgInfo.Pkg.Path() {
+		return "", nil
+	}
+
+	for _, spec := range ir.file.Imports {
+		pkgName := importedPkgName(ir.pkgInfo, spec)
+		if pkgName == nil || pkgName.Imported().Path() != pkg.Path() {
+			continue
+		}
+		switch name := pkgName.Name(); name {
+		case "_":
+			continue
+		case ".":
+			return "", nil
+		default:
+			if _, obj := ir.scopeAt(pos).LookupParent(name, pos); obj == pkgName {
+				return name, nil
+			}
+		}
+	}
+
+	if name, ok := ir.added[pkg.Path()]; ok {
+		return name, nil
+	}
+	name := pkg.Name()
+	for i := 2; ir.conflicts(name, pos); i++ {
+		name = fmt.Sprintf("%s%d", pkg.Name(), i)
+	}
+	ir.added[pkg.Path()] = name
+	edit := ir.importEdit(name, pkg)
+	ir.edits = append(ir.edits, edit)
+	return name, edit
+}
+
+// Qualifier returns a types.Qualifier (for use with types.TypeString, etc.)
+// that qualifies package members as code inserted at the given position
+// should.  Imports that must be added are available from Edits.
+func (ir *ImportResolver) Qualifier(pos token.Pos) types.Qualifier {
+	return func(pkg *types.Package) string {
+		name, _ := ir.Qualify(pkg, pos)
+		return name
+	}
+}
+
+// Edits returns the ImportEdits returned by all previous calls to Qualify.
+func (ir *ImportResolver) Edits() []*ImportEdit {
+	return ir.edits
+}
+
+// AddEdits adds the ImportEdits returned by all previous calls to Qualify to
+// the given EditSet.  Imports inserted at the same location are combined into
+// a single edit, so they appear in the order they were created.
+func (ir *ImportResolver) AddEdits(edits *text.EditSet) error {
+	offsets := []int{}
+	replacements := map[int]string{}
+	for _, edit := range ir.edits {
+		offset := edit.Extent.Offset
+		if _, found := replacements[offset]; !found {
+			offsets = append(offsets, offset)
+		}
+		replacements[offset] += edit.Replacement
+	}
+	for _, offset := range offsets {
+		extent := &text.Extent{Offset: offset, Length: 0}
+		if err := edits.Add(extent, replacements[offset]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeAt returns the innermost scope in the file containing pos, or the
+// file scope if pos is not in the file.
+func (ir *ImportResolver) scopeAt(pos token.Pos) *types.Scope {
+	fileScope := ir.pkgInfo.Scopes[ir.file]
+	if fileScope == nil {
+		return ir.pkgInfo.Pkg.Scope()
+	}
+	if scope := fileScope.Innermost(pos); scope != nil {
+		return scope
+	}
+	return fileScope
+}
+
+// conflicts returns true if importing a package under the given name would
+// conflict with a declaration in the file or its package, or would not be
+// visible at pos.
+func (ir *ImportResolver) conflicts(name string, pos token.Pos) bool {
+	for _, added := range ir.added {
+		if added == name {
+			return true
+		}
+	}
+	if ir.pkgInfo.Pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	if fileScope := ir.pkgInfo.Scopes[ir.file]; fileScope != nil && fileScope.Lookup(name) != nil {
+		return true
+	}
+	_, obj := ir.scopeAt(pos).LookupParent(name, pos)
+	return obj != nil
+}
+
+// ReplaceImport returns an edit that replaces the given import spec with the
+// imports that must be added to the file (according to previous calls to
+// Qualify), for use when the given import is no longer needed.  Those imports
+// are then no longer returned by Edits or added by AddEdits.  If there are no
+// imports to add, ReplaceImport returns nil and "".
+func (ir *ImportResolver) ReplaceImport(spec *ast.ImportSpec) (*text.Extent, string) {
+	if len(ir.edits) == 0 {
+		return nil, ""
+	}
+	specs := []string{}
+	for _, edit := range ir.edits {
+		specs = append(specs, edit.spec)
+	}
+	ir.edits = nil
+
+	start := ir.fset.Position(spec.Pos()).Offset
+	end := ir.fset.Position(spec.End()).Offset
+	extent := &text.Extent{Offset: start, Length: end - start}
+	if len(specs) == 1 {
+		return extent, specs[0]
+	}
+	for _, decl := range ir.file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT || decl.Lparen.IsValid() ||
+			decl.Specs[0] != spec {
+			continue
+		}
+		// The import is not parenthesized, so add parentheses
+		unit := DetectIndentStyle(ir.src).Unit
+		return extent, "(\n" + unit +
+			strings.Join(specs, "\n"+unit) + "\n)"
+	}
+	return extent, strings.Join(specs, "\n"+Indentation(ir.src, start))
+}
+
+// importEdit returns an ImportEdit that adds an import of pkg, with the given
+// local name, to the file.  If the last import declaration in the file is
+// parenthesized, the import is added to it; otherwise, a new import
+// declaration is added after the existing imports (or the package clause).
+func (ir *ImportResolver) importEdit(name string, pkg *types.Package) *ImportEdit {
+	spec := strconv.Quote(pkg.Path())
+	if name != pkg.Name() {
+		spec = name + " " + spec
+	}
+	edit := &ImportEdit{Name: name, Path: pkg.Path(), spec: spec}
+
+	var lastImport *ast.GenDecl
+	for _, decl := range ir.file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			lastImport = decl
+		}
+	}
+
+	switch {
+	case lastImport != nil && lastImport.Rparen.IsValid():
+		offset := ir.fset.Position(lastImport.Rparen).Offset
+		lineStart := bytes.LastIndexByte(ir.src[:offset], '\n') + 1
+		if len(bytes.TrimSpace(ir.src[lineStart:offset])) == 0 {
+			unit := DetectIndentStyle(ir.src).Unit
+			edit.Extent = &text.Extent{Offset: lineStart, Length: 0}
+			edit.Replacement = unit + spec + "\n"
+		} else {
+			edit.Extent = &text.Extent{Offset: offset, Length: 0}
+			edit.Replacement = "; " + spec
+		}
+
+	case lastImport != nil:
+		offset := ir.fset.Position(lastImport.End()).Offset
+		edit.Extent = &text.Extent{Offset: offset, Length: 0}
+		edit.Replacement = "\nimport " + spec
+
+	default:
+		// Insert after the end of the line containing the package clause,
+		// so an import comment remains on that line
+		offset := ir.fset.Position(ir.file.Name.End()).Offset
+		if eol := bytes.IndexByte(ir.src[offset:], '\n'); eol >= 0 {
+			offset += eol
+		} else {
+			offset = len(ir.src)
+		}
+		edit.Extent = &text.Extent{Offset: offset, Length: 0}
+		edit.Replacement = "\n\nimport " + spec
+	}
+	return edit
+}
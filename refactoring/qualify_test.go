@@ -0,0 +1,125 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// loadResolver type checks the given source code as package p and returns an
+// ImportResolver for it.
+func loadResolver(t *testing.T, src string) (*ImportResolver, *ast.File) {
+	var config loader.Config
+	f, err := config.ParseFile("p.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.CreateFromFiles("p", f)
+	prog, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewImportResolver(prog.Fset, f, prog.Created[0], []byte(src)), f
+}
+
+func TestQualify(t *testing.T) {
+	const src = `package p
+
+import (
+	"fmt"
+	str "strings"
+)
+
+var bytes = str.ToUpper
+
+func f() {
+	fmt.Println()
+	fmt := 2
+	_ = fmt // here
+}
+`
+	ir, f := loadResolver(t, src)
+	here := f.Package + token.Pos(strings.Index(src, "_ = fmt"))
+	top := f.End()
+	tests := []struct {
+		pkg       *types.Package
+		pos       token.Pos
+		qualifier string
+		edit      bool
+	}{
+		{ir.pkgInfo.Pkg, here, "", false},
+		{types.NewPackage("strings", "strings"), top, "str", false},
+		{types.NewPackage("fmt", "fmt"), top, "fmt", false},
+		// fmt is shadowed by a local variable, so it is imported again
+		{types.NewPackage("fmt", "fmt"), here, "fmt2", true},
+		{types.NewPackage("fmt", "fmt"), here, "fmt2", false},
+		// bytes conflicts with a package-level variable
+		{types.NewPackage("bytes", "bytes"), top, "bytes2", true},
+		{types.NewPackage("go/ast", "ast"), top, "ast", true},
+	}
+	for _, test := range tests {
+		qualifier, edit := ir.Qualify(test.pkg, test.pos)
+		if qualifier != test.qualifier || (edit != nil) != test.edit {
+			t.Fatalf("Qualify(%s): expected %q (edit: %t), got %q "+
+				"(edit: %t)", test.pkg.Path(), test.qualifier,
+				test.edit, qualifier, edit != nil)
+		}
+	}
+
+	edits := text.NewEditSet()
+	if err := ir.AddEdits(edits); err != nil {
+		t.Fatal(err)
+	}
+	result, err := text.ApplyToString(edits, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `import (
+	"fmt"
+	str "strings"
+	fmt2 "fmt"
+	bytes2 "bytes"
+	"go/ast"
+)`
+	if !strings.Contains(result, expected) {
+		t.Fatalf("Expected imports:\n%s\nResult:\n%s", expected, result)
+	}
+}
+
+func TestImportEditPlacement(t *testing.T) {
+	tests := []struct{ src, expected string }{
+		{"package p // import \"x/p\"\n",
+			"package p // import \"x/p\"\n\nimport \"bytes\"\n"},
+		{"package p\n\nimport \"fmt\"\n\nvar _ = fmt.Println\n",
+			"package p\n\nimport \"fmt\"\nimport \"bytes\"\n\nvar _ = fmt.Println\n"},
+		{"package p\n\nimport (\"fmt\")\n\nvar _ = fmt.Println\n",
+			"package p\n\nimport (\"fmt\"; \"bytes\")\n\nvar _ = fmt.Println\n"},
+		{"package p\n\nimport (\n    \"fmt\"\n)\n\nvar _ = fmt.Println\n",
+			"package p\n\nimport (\n    \"fmt\"\n    \"bytes\"\n)\n\nvar _ = fmt.Println\n"},
+	}
+	for _, test := range tests {
+		ir, f := loadResolver(t, test.src)
+		_, edit := ir.Qualify(types.NewPackage("bytes", "bytes"), f.End())
+		if edit == nil {
+			t.Fatalf("Expected an import to be added to\n%s", test.src)
+		}
+		edits := text.NewEditSet()
+		edit.AddTo(edits)
+		result, err := text.ApplyToString(edits, test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != test.expected {
+			t.Fatalf("Expected\n%s\nResult:\n%s", test.expected, result)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"go/build"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
 	"go/types"
 	"io/ioutil"
@@ -27,6 +28,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/godoctor/godoctor/analysis/fingerprint"
+	"github.com/godoctor/godoctor/analysis/imports"
 	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/text"
 	"golang.org/x/tools/go/loader"
@@ -86,6 +89,11 @@ type Description struct {
 	//     ----+----1----+----2----+----3----+----4----+----5
 	//     <new_name> [<rename_in_comments?>]
 	Usage string
+	// A brief phrase (≤50 characters) describing what must be selected
+	// when this refactoring is invoked, with the first letter capitalized
+	// (e.g., "An identifier"), or "" if the selection only determines the
+	// file or package to refactor.
+	Selection string
 	// HTML doumentation for this refactoring, which can be embedded into
 	// the User's Guide.
 	HTMLDoc string
@@ -121,6 +129,18 @@ type Config struct {
 	Scope []string
 	// The range of text on which to invoke the refactoring.
 	Selection text.Selection
+	// If non-nil, the node on which to invoke the refactoring, which
+	// overrides the position of the Selection (but not its filename,
+	// which is still used to guess the Scope).  Typically, this is a
+	// Result.Target recorded by an earlier run, so the refactoring can be
+	// repeated after the code has been reformatted or edited.
+	Target *fingerprint.Fingerprint
+	// A previously loaded Program to refactor (see LoadProgram), which
+	// may be shared with other refactorings.  If this is nil, the Program
+	// is loaded from the FileSystem.  Otherwise, it must have been loaded
+	// from the same FileSystem, whose contents must not have changed
+	// since then, and Scope must be nil or equal to its scope.
+	Program *LoadedProgram
 	// Refactoring-specific arguments.  To determine what arguments are
 	// required for each refactoring, see Refactoring.Description().Params.
 	// For example, for the Rename refactoring, you must specify a new name
@@ -140,6 +160,22 @@ type Config struct {
 	// The GOROOT.  If this is set to the empty string, the GOROOT is
 	// determined from the environment.
 	GoRoot string
+	// What to do if the refactoring would modify a generated file.  By
+	// default, generated files are modified like any other file.
+	GeneratedFiles GeneratedFilePolicy
+	// Glob patterns restricting the files that will be modified by the
+	// refactoring (e.g., gen/*.go, or internal/ to match every file in a
+	// directory named internal).  If this is empty, all files may be
+	// modified.  See IsExcluded.
+	Include []string
+	// Glob patterns for files that will not be modified by the refactoring
+	// (e.g., *.pb.go, or vendor/ to match every file in a directory named
+	// vendor).  Function bodies in excluded directories are not analyzed.
+	Exclude []string
+	// A directory in which analysis results (e.g., an index of the imports
+	// in the workspace, used to determine the default scope) are cached
+	// between refactorings.  If this is empty, nothing is cached.
+	CacheDir string
 }
 
 // The Refactoring interface identifies methods common to all refactorings.
@@ -155,6 +191,12 @@ type Config struct {
 //     4. If Result.Log is not empty, display the log to the user.
 //     5. If Result.Edits is non-nil, the edits may be applied to complete the
 //        transformation.
+//
+// All of the input to a refactoring is given in the Config, and all of its
+// output is returned in the Result.  However, a refactoring may store the
+// state of a run in its fields, so a Refactoring should be run only once, and
+// it must not be run concurrently with itself.  The engine package constructs
+// a new Refactoring for each run.
 type Refactoring interface {
 	Description() *Description
 	Run(*Config) *Result
@@ -169,10 +211,24 @@ type Result struct {
 	// Maps filenames to the text edits that should be applied to those
 	// files.
 	Edits map[string]*text.EditSet
+	// Changes to the file system other than text edits (e.g., moving
+	// files), which should be applied in order after the Edits have been
+	// applied.  Edits are always given in terms of the original filenames.
+	FSChanges []filesystem.Change
 	// DebugOutput is used by the debug refactoring to output additional
 	// information (e.g., the description of the AST or control flow graph)
 	// that doesn't belong in the log or the output file
 	DebugOutput bytes.Buffer
+	// Maps the name of each file with Edits to a checksum of its contents
+	// when the refactoring analyzed it (see filesystem.Checksum).  Clients
+	// should pass these to filesystem.VerifyChecksums before applying the
+	// Edits, since they are incorrect if a file has changed in the meantime.
+	Checksums map[string]string
+	// A Fingerprint of the selected node, which can be recorded and given
+	// as Config.Target to invoke the refactoring on the same node later,
+	// or nil if the selection does not exactly enclose a node that can be
+	// fingerprinted.
+	Target *fingerprint.Fingerprint
 }
 
 const cgoError1 = "could not import C ("
@@ -202,6 +258,11 @@ type RefactoringBase struct {
 	SelectedNodePkg *loader.PackageInfo
 	// The Result of this refactoring, returned to the client invoking it
 	Result
+	// Checksums of the files that were read when the Program was loaded,
+	// keyed by filename (see recordChecksums)
+	loadChecksums map[string]string
+	// The migration state for each file that is changed (see migration)
+	migrations map[*ast.File]*fileMigration
 }
 
 // Setup code for a Run method.  Most refactorings should invoke this
@@ -211,45 +272,49 @@ type RefactoringBase struct {
 func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 	r.Log = NewLog()
 	r.Edits = map[string]*text.EditSet{}
+	r.FSChanges = []filesystem.Change{}
 	r.DebugOutput.Reset()
+	r.Checksums = map[string]string{}
+	r.Target = nil
+	r.migrations = map[*ast.File]*fileMigration{}
 
 	if config.FileSystem == nil {
 		r.Log.Error("INTERNAL ERROR: null Config.FileSystem")
 		return &r.Result
 	}
 
-	if !validateArgs(config, desc, r.Log) {
+	if err := ValidateArgs(desc, config.Args); err != nil {
+		r.Log.Error(err)
+		r.Log.AssociateArg(err.(*ArgError).Arg)
 		return &r.Result
 	}
 
+	if config.Scope == nil && config.Program != nil {
+		config.Scope = config.Program.Scope
+	}
 	if config.Scope == nil {
 		var msg string
 		config.Scope, msg = r.guessScope(config)
-		r.Log.Infof(msg)
+		r.Log.Info(msg)
 	} else {
 		r.Log.Infof("Scope is %s", strings.Join(config.Scope, " "))
 	}
 
-	stdin, _ := filesystem.FakeStdinPath()
-
 	var err error
-	mutex := &sync.Mutex{}
-	r.Program, err = createLoader(config, func(err error) {
-		message := strings.Replace(err.Error(), stdin+":", "<stdin>:", -1)
-		// TODO: This is temporary until go/loader handles cgo
-		if !strings.Contains(message, cgoError1) &&
-			!strings.HasSuffix(message, cgoError2) &&
-			len(r.Log.Entries) < maxInitialErrors {
-			mutex.Lock()
-			if err, ok := err.(types.Error); ok {
-				r.Log.Error(err.Msg)
-				r.Log.AssociatePos(err.Pos, err.Pos)
-			} else {
-				r.Log.Error(message)
-			}
-			mutex.Unlock()
+	if config.Program != nil {
+		if !config.Program.hasScope(config.Scope) {
+			r.Log.Errorf("INTERNAL ERROR: The scope (%s) does not "+
+				"match the scope of the loaded program (%s)",
+				strings.Join(config.Scope, " "),
+				strings.Join(config.Program.Scope, " "))
+			return &r.Result
 		}
-	})
+		r.Program = config.Program.Program
+		r.loadChecksums = config.Program.checksums
+		r.Log.Append(config.Program.initialEntries())
+	} else {
+		r.Program, r.loadChecksums, err = loadProgram(config, r.Log)
+	}
 
 	r.Log.MarkInitial()
 	if err != nil {
@@ -262,7 +327,11 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 
 	r.Log.Fset = r.Program.Fset
 
-	r.SelectionStart, r.SelectionEnd, err = config.Selection.Convert(r.Program.Fset)
+	if config.Target != nil {
+		r.SelectionStart, r.SelectionEnd, err = r.resolveTarget(config.Target)
+	} else {
+		r.SelectionStart, r.SelectionEnd, err = config.Selection.Convert(r.Program.Fset)
+	}
 	if err != nil {
 		r.Log.Error(err)
 		return &r.Result
@@ -280,8 +349,14 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 	}
 	r.SelectedNode = r.PathEnclosingSelection[0]
 	r.File = r.PathEnclosingSelection[len(r.PathEnclosingSelection)-1].(*ast.File)
+	if _, isIdent := r.SelectedNode.(*ast.Ident); r.SelectionIsExact || isIdent {
+		r.Target = fingerprint.Of(r.SelectedNodePkg, r.Program.Fset,
+			r.PathEnclosingSelection)
+	}
 
 	r.Filename = r.Program.Fset.Position(r.File.Package).Filename
+	r.tolerateErrorsOutsidePackage()
+	r.tolerateSyntaxErrorsOutsideDecl()
 
 	reader, err := config.FileSystem.OpenFile(r.Filename)
 	if err != nil {
@@ -308,7 +383,9 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 	return &r.Result
 }
 
-func createLoader(config *Config, errorHandler func(error)) (*loader.Program, error) {
+// newBuildContext returns a build.Context based on build.Default, but with the
+// GOPATH, GOROOT, and file system given by the Config.
+func newBuildContext(config *Config) *build.Context {
 	buildContext := build.Default
 	if os.Getenv("GOPATH") != "" {
 		// The test runner may change the GOPATH environment variable
@@ -331,13 +408,17 @@ func createLoader(config *Config, errorHandler func(error)) (*loader.Program, er
 	}
 	buildContext.ReadDir = config.FileSystem.ReadDir
 	buildContext.OpenFile = config.FileSystem.OpenFile
+	return &buildContext
+}
 
+func createLoader(config *Config, errorHandler func(error)) (*loader.Program, error) {
 	var lconfig loader.Config
-	lconfig.Build = &buildContext
+	lconfig.Build = newBuildContext(config)
 	lconfig.ParserMode = parser.ParseComments | parser.DeclarationErrors
 	lconfig.AllowErrors = true
 	//lconfig.SourceImports = true
 	lconfig.TypeChecker.Error = errorHandler
+	lconfig.TypeCheckFuncBodies = typeCheckFuncBodies(config, lconfig.Build)
 
 	rest, err := lconfig.FromArgs(config.Scope, true)
 	if len(rest) > 0 {
@@ -350,11 +431,71 @@ func createLoader(config *Config, errorHandler func(error)) (*loader.Program, er
 	return lconfig.Load()
 }
 
+// tolerateErrorsOutsidePackage allows a refactoring to proceed when the
+// program contains errors (e.g., type errors) only in files outside the
+// package containing the selection, since editors frequently invoke
+// refactorings on code that does not compile.  Those errors are changed to
+// warnings, and a warning is logged noting that the results may be unreliable
+// in code affected by them.  Errors in the selected package remain errors.
+// resolveTarget returns the positions of the node identified by the given
+// Fingerprint, logging a warning if the signature of its declaration has
+// changed since the Fingerprint was computed.
+func (r *RefactoringBase) resolveTarget(fp *fingerprint.Fingerprint) (token.Pos, token.Pos, error) {
+	target, err := fingerprint.Resolve(fp, r.Program)
+	if err != nil {
+		return token.NoPos, token.NoPos,
+			fmt.Errorf("The target %s could not be found: %s", fp, err)
+	}
+	if target.SignatureChanged {
+		r.Log.Warnf("The type of %s has changed since the target "+
+			"was recorded", strings.Join(fp.Decl, "."))
+		r.Log.AssociateNode(target.Node)
+	}
+	return target.Node.Pos(), target.Node.End(), nil
+}
+
+func (r *RefactoringBase) tolerateErrorsOutsidePackage() {
+	filenames := map[string]bool{}
+	for _, file := range r.SelectedNodePkg.Files {
+		filenames[r.Program.Fset.Position(file.Package).Filename] = true
+	}
+	if n := r.Log.ChangeInitialErrorsToWarningsOutside(filenames); n > 0 {
+		r.Log.Warnf("Ignoring %d error(s) outside package %s; the "+
+			"refactoring may be incomplete or incorrect in code "+
+			"affected by them", n, r.SelectedNodePkg.Pkg.Path())
+	}
+}
+
+// tolerateSyntaxErrorsOutsideDecl allows a refactoring to proceed when the
+// selected package contains syntax errors, provided none of them is in the
+// top-level declaration containing the selection (or, if the selection is not
+// in a declaration, in the selected file).  The parser recovers from syntax
+// errors, so the remaining declarations are still parsed and type checked.
+func (r *RefactoringBase) tolerateSyntaxErrorsOutsideDecl() {
+	file := r.Program.Fset.File(r.File.Package)
+	start := token.Pos(file.Base())
+	end := token.Pos(file.Base() + file.Size())
+	if len(r.PathEnclosingSelection) >= 2 {
+		decl := r.PathEnclosingSelection[len(r.PathEnclosingSelection)-2]
+		start, end = decl.Pos(), decl.End()
+	}
+	if n := r.Log.ChangeSyntaxErrorsToWarningsOutside(start, end); n > 0 {
+		r.Log.Warnf("Ignoring %d syntax error(s) outside the selected "+
+			"declaration; the refactoring may be incomplete or "+
+			"incorrect in code affected by them", n)
+	}
+}
+
 // guessScope makes a reasonable guess at the refactoring scope if the user
 // does not provide an explicit scope.  It guesses as follows:
 //     1. If Filename is not in $GOPATH/src, Filename is used as the scope.
 //     2. If Filename is in $GOPATH/src, a package name is guessed by stripping
-//        $GOPATH/src/ from the Filename, and that package is used as the scope.
+//        $GOPATH/src/ from the Filename.  If that package is in a workspace
+//        (a module or a version-controlled repository; see
+//        imports.FindWorkspace), the scope consists of that package and all
+//        of the packages in the workspace that depend on it.  Otherwise, that
+//        package alone is used as the scope.
+// It returns the scope, along with a message describing the scope chosen.
 func (r *RefactoringBase) guessScope(config *Config) ([]string, string) {
 	fname := config.Selection.GetFilename()
 	fnameScope := []string{fname}
@@ -395,6 +536,10 @@ func (r *RefactoringBase) guessScope(config *Config) ([]string, string) {
 	}
 
 	if strings.HasPrefix(relFilename, "..") {
+		ctxt := newBuildContext(config)
+		if ws := imports.FindWorkspace(ctxt, filepath.Dir(absFilename)); ws != "" && isModule(ctxt, ws) {
+			fnameMsg = fmt.Sprintf("Defaulting to file scope %s for refactoring, since the module in %s is not in $GOPATH/src, so its other packages cannot be loaded (provide an explicit scope to change this)", fname, ws)
+		}
 		return fnameScope, fnameMsg
 	}
 
@@ -404,19 +549,81 @@ func (r *RefactoringBase) guessScope(config *Config) ([]string, string) {
 	}
 
 	pkg := filepath.ToSlash(dir)
-	return []string{pkg},
-		fmt.Sprintf("Defaulting to package scope %s for refactoring (provide an explicit scope to change this)", pkg)
+	pkgMsg := fmt.Sprintf("Defaulting to package scope %s for refactoring (provide an explicit scope to change this)", pkg)
+
+	ctxt := newBuildContext(config)
+	ws := imports.FindWorkspace(ctxt, filepath.Dir(absFilename))
+	if ws == "" {
+		return []string{pkg}, pkgMsg
+	}
+	index := r.workspaceIndex(config, ctxt, ws)
+	if index == nil {
+		return []string{pkg}, pkgMsg
+	}
+	scope := append([]string{pkg}, index.Dependents(pkg)...)
+	if len(scope) == 1 {
+		return scope, fmt.Sprintf("Defaulting to package scope %s for refactoring; no other packages in %s import it (provide an explicit scope to change this)", pkg, ws)
+	}
+	return scope, fmt.Sprintf("Defaulting to scope %s for refactoring: package %s and the %d package(s) in %s that import it (provide an explicit scope to change this)", strings.Join(scope, " "), pkg, len(scope)-1, ws)
 }
 
-// validateArgs determines whether the arguments supplied in the given Config
-// match the parameters required by the given Description.  If they mismatch in
-// either type or number, a fatal error is logged to the given Log, and the
-// function returns false; otherwise, no error is logged, and the function
-// returns true.
-func validateArgs(config *Config, desc *Description, log *Log) bool {
+// workspaceIndex returns an index of the imports in the workspace rooted at
+// the given directory, or nil if it cannot be built.  If config.CacheDir is
+// set, the index is cached there, so only the packages that have changed
+// since the previous refactoring need to be read.
+func (r *RefactoringBase) workspaceIndex(config *Config, ctxt *build.Context, ws string) *imports.Index {
+	var old *imports.Index
+	filename := ""
+	if config.CacheDir != "" {
+		filename = imports.IndexFilename(config.CacheDir, ws)
+		// If the cached index is missing or corrupt, it is rebuilt
+		old, _ = imports.LoadIndex(filename)
+	}
+	index, err := imports.BuildIndex(ctxt, ws, old)
+	if err != nil {
+		r.Log.Warn(err)
+		return nil
+	}
+	if filename != "" && !reflect.DeepEqual(old, index) {
+		if err := index.Save(filename); err != nil {
+			r.Log.Warnf("Unable to cache the import index: %s", err)
+		}
+	}
+	return index
+}
+
+// isModule returns true iff the given directory contains a go.mod file.
+func isModule(ctxt *build.Context, dir string) bool {
+	f, err := ctxt.OpenFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// An ArgError describes an argument supplied to a refactoring that does not
+// match the refactoring's parameters.
+type ArgError struct {
+	// The index of the invalid argument in Config.Args, or NoArg if the
+	// wrong number of arguments was supplied
+	Arg int
+	// A description of the problem, suitable for display to the user
+	Message string
+}
+
+func (err *ArgError) Error() string {
+	return err.Message
+}
+
+// ValidateArgs determines whether the given arguments match the parameters
+// required by the given Description.  If they mismatch in either type or
+// number, it returns an *ArgError; otherwise, it returns nil.  Front ends may
+// use this to check arguments before running a refactoring.
+func ValidateArgs(desc *Description, args []interface{}) error {
 	minArgsExpected := len(desc.Params)
 	maxArgsExpected := len(desc.Params) + len(desc.OptionalParams)
-	numArgsSupplied := len(config.Args)
+	numArgsSupplied := len(args)
 	if numArgsSupplied < minArgsExpected {
 		atLeast := ""
 		if maxArgsExpected > minArgsExpected {
@@ -430,14 +637,14 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 		if numArgsSupplied == 1 {
 			wasWere = "was"
 		}
-		log.Errorf("This refactoring requires%s %d argument%s, "+
-			"but %d %s supplied.",
+		return &ArgError{NoArg, fmt.Sprintf(
+			"This refactoring requires%s %d argument%s, "+
+				"but %d %s supplied.",
 			atLeast,
 			minArgsExpected,
 			expectedPlural,
 			numArgsSupplied,
-			wasWere)
-		return false
+			wasWere)}
 	}
 	if numArgsSupplied > maxArgsExpected {
 		atMost := ""
@@ -452,36 +659,26 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 		if numArgsSupplied == 1 {
 			wasWere = "was"
 		}
-		log.Errorf("This refactoring requires%s %d argument%s, "+
-			"but %d %s supplied.",
+		return &ArgError{NoArg, fmt.Sprintf(
+			"This refactoring requires%s %d argument%s, "+
+				"but %d %s supplied.",
 			atMost,
 			maxArgsExpected,
 			expectedPlural,
 			numArgsSupplied,
-			wasWere)
-		return false
+			wasWere)}
 	}
 
-	for i, arg := range config.Args {
-		if i < minArgsExpected {
-			expected := reflect.TypeOf(desc.Params[i].DefaultValue)
-			if reflect.TypeOf(arg) != expected {
-				paramName := desc.Params[i].Label
-				log.Errorf("%s must be a %s", paramName, expected)
-				return false
-			}
-		} else {
-			index := i - minArgsExpected
-			expected := reflect.TypeOf(desc.OptionalParams[index].DefaultValue)
-			if reflect.TypeOf(arg) != expected {
-				paramName := desc.OptionalParams[index].Label
-				log.Errorf("%s must be a %s", paramName, expected)
-				return false
-			}
+	params := append(append([]Parameter{}, desc.Params...), desc.OptionalParams...)
+	for i, arg := range args {
+		expected := reflect.TypeOf(params[i].DefaultValue)
+		if reflect.TypeOf(arg) != expected {
+			return &ArgError{i, fmt.Sprintf("%s must be a %s",
+				params[i].Label, expected)}
 		}
 	}
 
-	return true
+	return nil
 }
 
 // lineColToPos converts a line/column position (where the first character in a
@@ -509,7 +706,22 @@ func (r *RefactoringBase) lineColToPos(file *ast.File, line int, column int) tok
 	return file.Pos()
 }
 
+// FormatFileInEditor formats the file being refactored (with r.Edits applied)
+// using go/printer, replacing r.Edits with the edits necessary to produce the
+// formatted file.  The file's existing indentation style is retained (see
+// DetectIndentStyle), so code inserted by a refactoring is indented like the
+// surrounding code.
 func (r *RefactoringBase) FormatFileInEditor() {
+	r.formatFileInEditor(DetectIndentStyle(r.FileContents))
+}
+
+// GofmtFileInEditor is like FormatFileInEditor, but it formats the entire file
+// using gofmt's indentation style.
+func (r *RefactoringBase) GofmtFileInEditor() {
+	r.formatFileInEditor(GofmtStyle)
+}
+
+func (r *RefactoringBase) formatFileInEditor(style IndentStyle) {
 	oldFileContents := string(r.FileContents)
 	string, err := text.ApplyToString(r.Edits[r.Filename], oldFileContents)
 	if err != nil {
@@ -534,20 +746,48 @@ func (r *RefactoringBase) FormatFileInEditor() {
 		r.Log.Error(err)
 		return
 	}
-	newFileContents := b.String()
+	// go/printer uses Unix line endings and omits any byte order mark.
+	// These are not restored here, since converting the whole file would
+	// change the lines the refactoring did not touch in a file with mixed
+	// line endings; preserveFileFormats adjusts only the edited text.
+	newFileContents := style.Reindent(b.String(), "")
 
-	editSet := text.Diff(
-		strings.SplitAfter(oldFileContents, "\n"),
-		strings.SplitAfter(newFileContents, "\n"))
-	r.Edits[r.Filename] = editSet
+	r.Edits[r.Filename] = text.DiffStrings(oldFileContents, newFileContents)
+}
+
+// preserveFileFormats adjusts the edits to each file so that the file's byte
+// order mark, line endings, and final newline are preserved (see
+// text.PreserveFileFormat).
+func (r *RefactoringBase) preserveFileFormats(config *Config) {
+	for filename, edits := range r.Edits {
+		contents := readFile(config, filename)
+		if contents == nil || isEmpty(edits) {
+			continue
+		}
+		preserved, err := text.PreserveFileFormat(edits, contents)
+		if err != nil {
+			r.Log.Errorf("Transformation produced invalid EditSet: %v",
+				err.Error())
+			return
+		}
+		r.Edits[filename] = preserved
+	}
 }
 
 // UpdateLog applies the edits in r.Edits and updates existing error messages
-// in r.Log to reflect their locations in the resulting Program.  If
+// in r.Log to reflect their locations in the resulting Program.  Edits to
+// excluded files are first discarded, edits to generated files are handled
+// according to config.GeneratedFiles, and edits are adjusted to preserve each
+// file's line endings (see preserveFileFormats).  If
 // checkForErrors is true, and if the log does not contain any initial errors,
 // the resulting Program will be type checked, and any new errors introduced by
-// the refactoring will be logged.
+// the refactoring will be logged.  (Initial errors that were changed to
+// warnings are not reported again.)
 func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
+	r.removeExcludedEdits(config)
+	r.applyGeneratedFilePolicy(config)
+	r.preserveFileFormats(config)
+	r.recordChecksums(config)
 	if r.Edits == nil || len(r.Edits) == 0 {
 		return
 	}
@@ -610,26 +850,47 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 		if !checkForErrors {
 			return
 		}
+		if list, ok := err.(scanner.ErrorList); ok {
+			// Report only the syntax errors that were not present
+			// before the refactoring
+			introduced := scanner.ErrorList{}
+			for _, e := range list {
+				if !r.Log.containsInitialSyntaxError(syntaxErrorMessage(e.Msg)) {
+					introduced = append(introduced, e)
+				}
+			}
+			if len(introduced) == 0 {
+				return
+			}
+			err = introduced
+		}
 		message := strings.Replace(err.Error(), stdin+":", "<stdin>:", -1)
 		// TODO: This is temporary until go/loader handles cgo
 		if !strings.Contains(message, cgoError1) &&
 			!strings.HasSuffix(message, cgoError2) &&
 			errors < maxInitialErrors {
 			mutex.Lock()
-			errors++
-			msg := fmt.Sprintf("Completing the transformation will introduce the following error: %s", message)
+			defer mutex.Unlock()
+			// Errors that were present before the refactoring
+			// (e.g., initial errors changed to warnings) were not
+			// introduced by it
 			if err, ok := err.(types.Error); ok {
+				oldPos := mapPos(err.Fset, err.Pos, r.Edits, programFiles, true)
+				if r.Log.containsInitial(err.Msg, oldPos) {
+					return
+				}
+				errors++
 				newLogOldPos.Error(err.Msg)
 				newLogNewPos.Error(err.Msg)
-				oldPos := mapPos(err.Fset, err.Pos, r.Edits, programFiles, true)
 				newLogOldPos.AssociatePos(oldPos, oldPos)
 				newLogNewPos.Fset = err.Fset
 				newLogNewPos.AssociatePos(err.Pos, err.Pos)
-			} else {
+			} else if !r.Log.containsInitial(message, token.NoPos) {
+				errors++
+				msg := fmt.Sprintf("Completing the transformation will introduce the following error: %s", message)
 				newLogOldPos.Error(msg)
 				newLogNewPos.Error(msg)
 			}
-			mutex.Unlock()
 		}
 	})
 	if newProg == nil || err != nil {
@@ -711,8 +972,13 @@ func mapPos(from *token.FileSet, pos token.Pos, edits map[string]*text.EditSet,
 
 /* -=-=- Utility Methods -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
+// InterpretArgs converts command line arguments to the types expected by the
+// given refactoring's parameters.  Arguments corresponding to boolean
+// parameters (including optional parameters) are converted to bools if they
+// are "true" or "false"; all other arguments are left as strings.
 func InterpretArgs(args []string, r Refactoring) []interface{} {
-	params := r.Description().Params
+	desc := r.Description()
+	params := append(append([]Parameter{}, desc.Params...), desc.OptionalParams...)
 	result := []interface{}{}
 	for i, opt := range args {
 		if i < len(params) && params[i].IsBoolean() {
@@ -731,10 +997,26 @@ func InterpretArgs(args []string, r Refactoring) []interface{} {
 	return result
 }
 
+// addEdit adds an edit to the given file, logging an error if it cannot be
+// added (e.g., because it overlaps another edit).
+func (r *RefactoringBase) addEdit(filename string, extent *text.Extent, replacement string) {
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	if err := r.Edits[filename].Add(extent, replacement); err != nil {
+		r.Log.Error(err)
+	}
+}
+
 func (r *RefactoringBase) OffsetOfPos(pos token.Pos) int {
 	return r.Program.Fset.Position(pos).Offset
 }
 
+// line returns the line number of the given position.
+func (r *RefactoringBase) line(pos token.Pos) int {
+	return r.Program.Fset.Position(pos).Line
+}
+
 func (r *RefactoringBase) OffsetLength(node ast.Node) (int, int) {
 	offset := r.OffsetOfPos(node.Pos())
 	end := r.OffsetOfPos(node.End())
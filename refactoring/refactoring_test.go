@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/refactoring"
 	"github.com/godoctor/godoctor/refactoring/testutil"
 )
 
@@ -13,3 +14,42 @@ func TestRefactorings(t *testing.T) {
 	engine.AddDefaultRefactorings()
 	testutil.TestRefactorings(directory, t)
 }
+
+func TestValidateArgs(t *testing.T) {
+	desc := &refactoring.Description{
+		Params: []refactoring.Parameter{{
+			Label:        "Name:",
+			DefaultValue: "",
+		}},
+		OptionalParams: []refactoring.Parameter{{
+			Label:        "Preview:",
+			DefaultValue: false,
+		}},
+	}
+	tests := []struct {
+		args []interface{}
+		arg  int // expected ArgError.Arg, or -2 if valid
+	}{
+		{[]interface{}{"x"}, -2},
+		{[]interface{}{"x", true}, -2},
+		{[]interface{}{}, refactoring.NoArg},
+		{[]interface{}{"x", true, "y"}, refactoring.NoArg},
+		{[]interface{}{false}, 0},
+		{[]interface{}{"x", "true"}, 1},
+	}
+	for _, tst := range tests {
+		err := refactoring.ValidateArgs(desc, tst.args)
+		if tst.arg == -2 {
+			if err != nil {
+				t.Fatalf("ValidateArgs(%v): unexpected error %s",
+					tst.args, err)
+			}
+			continue
+		}
+		argErr, ok := err.(*refactoring.ArgError)
+		if !ok || argErr.Arg != tst.arg {
+			t.Fatalf("ValidateArgs(%v): expected error for "+
+				"argument %d; got %#v", tst.args, tst.arg, err)
+		}
+	}
+}
@@ -0,0 +1,604 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that removes a result from a function's
+// signature, along with the corresponding values in its return statements
+// and the variables that receive it at its call sites.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// RemoveResult is a refactoring that removes the selected result from the
+// signature of a function or method.  This is possible if the result is
+// never used (every call site ignores it, or assigns it to the blank
+// identifier) or if it is always nil (every return statement returns nil for
+// it).  In the latter case, a variable that received the result at a call
+// site is set to nil instead.
+//
+// The function may only be called directly (not used as a function value),
+// and a method may not be used to implement an interface, since its
+// signature would no longer match the interface's method.
+type RemoveResult struct {
+	RefactoringBase
+	// The function declaring the result and the index of the result
+	decl  *ast.FuncDecl
+	fn    *types.Func
+	index int
+	// The number of results before the result is removed
+	numResults int
+	// The name of the result, or nil if it is unnamed
+	name *ast.Ident
+	// True if every return statement returns nil for the result
+	alwaysNil bool
+}
+
+func (r *RemoveResult) Description() *Description {
+	return &Description{
+		Name:           "Remove Result",
+		Synopsis:       "Removes an unused or always-nil result from a function",
+		Usage:          "",
+		Selection:      "A result in a function declaration's signature",
+		HTMLDoc:        removeResultDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *RemoveResult) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	if !r.findResult() || !r.checkInterfaces() || !r.checkReturns() {
+		return &r.Result
+	}
+	calls := r.findCalls()
+	if calls == nil || !r.checkCalls(calls) {
+		return &r.Result
+	}
+	if r.alwaysNil {
+		r.Log.Infof("Removing result %d of %s, which is always nil",
+			r.index+1, r.fn.Name())
+	} else {
+		r.Log.Infof("Removing result %d of %s, which is never used",
+			r.index+1, r.fn.Name())
+	}
+
+	if !r.updateDecl(config) {
+		return &r.Result
+	}
+	for _, call := range calls {
+		if !r.updateCall(config, call) {
+			return &r.Result
+		}
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findResult finds the selected result and the function declaring it,
+// returning false (after logging an error) if the selection is not a result
+// in a function declaration.
+func (r *RemoveResult) findResult() bool {
+	r.decl, r.fn, r.name = nil, nil, nil
+	path := r.PathEnclosingSelection
+	var field *ast.Field
+	for i, node := range path {
+		if f, ok := node.(*ast.Field); ok && i+2 < len(path) {
+			// The path may omit the declaration's FuncType
+			decl, _ := path[i+2].(*ast.FuncDecl)
+			if _, ok := path[i+2].(*ast.FuncType); ok && i+3 < len(path) {
+				decl, _ = path[i+3].(*ast.FuncDecl)
+			}
+			if decl != nil && decl.Type.Results == path[i+1] {
+				field, r.decl = f, decl
+			}
+			break
+		}
+	}
+	if r.decl == nil {
+		r.Log.Error("Please select a result in the signature of a " +
+			"function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	r.fn, _ = r.SelectedNodePkg.Defs[r.decl.Name].(*types.Func)
+	if r.fn == nil || r.decl.Body == nil {
+		r.Log.Errorf("The result of %s cannot be removed", r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+
+	r.index, r.numResults = -1, 0
+	for _, f := range r.decl.Type.Results.List {
+		if f == field {
+			switch len(f.Names) {
+			case 0:
+				r.index = r.numResults
+			case 1:
+				r.index, r.name = r.numResults, f.Names[0]
+			default:
+				for i, name := range f.Names {
+					if name.Pos() <= r.SelectionStart &&
+						r.SelectionEnd <= name.End() {
+						r.index, r.name = r.numResults+i, name
+					}
+				}
+			}
+		}
+		r.numResults += max(1, len(f.Names))
+	}
+	if r.index < 0 {
+		r.Log.Error("Please select the name of one of the results " +
+			"declared together.")
+		r.Log.AssociateNode(field)
+		return false
+	}
+	if r.name != nil && r.name.Name != "_" {
+		if v := r.SelectedNodePkg.Defs[r.name]; v != nil &&
+			usesObject(r.SelectedNodePkg, r.decl.Body, v) {
+			r.Log.Errorf("The result %s is used in the body of %s, so "+
+				"it cannot be removed", r.name.Name, r.fn.Name())
+			r.Log.AssociateNode(r.name)
+			return false
+		}
+	}
+	return true
+}
+
+// checkInterfaces returns false (after logging an error) if the function is
+// a method whose receiver type implements an interface with a method of the
+// same name, so removing the result may prevent it from implementing the
+// interface.
+func (r *RemoveResult) checkInterfaces() bool {
+	recv := r.fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return true
+	}
+	scopes := []*types.Scope{types.Universe}
+	for _, pkgInfo := range r.Program.AllPackages {
+		scopes = append(scopes, pkgInfo.Pkg.Scope())
+	}
+	for _, scope := range scopes {
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			it, ok := tn.Type().Underlying().(*types.Interface)
+			if !ok || it.NumMethods() == 0 {
+				continue
+			}
+			hasMethod := false
+			for i := 0; i < it.NumMethods(); i++ {
+				hasMethod = hasMethod || it.Method(i).Name() == r.fn.Name()
+			}
+			t := recv.Type()
+			if _, isPtr := t.(*types.Pointer); !isPtr {
+				t = types.NewPointer(t)
+			}
+			if hasMethod && types.Implements(t, it) {
+				iface := tn.Name()
+				if tn.Pkg() != nil {
+					iface = tn.Pkg().Name() + "." + iface
+				}
+				r.Log.Errorf("%s implements %s, so its results "+
+					"cannot be changed", r.fn.Name(), iface)
+				r.Log.AssociateNode(r.decl.Name)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// returnStmts returns the return statements in the given function body,
+// excluding those in function literals.
+func returnStmts(body *ast.BlockStmt) []*ast.ReturnStmt {
+	result := []*ast.ReturnStmt{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			result = append(result, n)
+		}
+		return true
+	})
+	return result
+}
+
+// checkReturns determines whether the result is always nil, returning false
+// (after logging an error) if a return statement cannot be updated.
+func (r *RemoveResult) checkReturns() bool {
+	r.alwaysNil = true
+	for _, ret := range returnStmts(r.decl.Body) {
+		if len(ret.Results) == 0 {
+			// A bare return returns the (unused) named result, which
+			// is the zero value
+			t := r.fn.Type().(*types.Signature).Results().At(r.index).Type()
+			r.alwaysNil = r.alwaysNil && isNillable(t)
+			continue
+		}
+		if len(ret.Results) != r.numResults {
+			r.Log.Errorf("The results of %s cannot be removed because "+
+				"this return statement returns the results of a "+
+				"call", r.fn.Name())
+			r.Log.AssociateNode(ret)
+			return false
+		}
+		expr := ret.Results[r.index]
+		if effectsOf(r.SelectedNodePkg, expr).effects {
+			r.Log.Error("The result cannot be removed because the " +
+				"value returned for it may have side effects")
+			r.Log.AssociateNode(expr)
+			return false
+		}
+		r.alwaysNil = r.alwaysNil && isNil(r.SelectedNodePkg, expr)
+	}
+	return true
+}
+
+// isNil returns true if the given expression is the predeclared identifier
+// nil.
+func isNil(pkgInfo *loader.PackageInfo, expr ast.Expr) bool {
+	id, ok := astutil.Unparen(expr).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = pkgInfo.Uses[id].(*types.Nil)
+	return ok
+}
+
+// isNillable returns true if nil is a value of the given type.
+func isNillable(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Interface, *types.Slice, *types.Map,
+		*types.Chan, *types.Signature:
+		return true
+	}
+	return false
+}
+
+// A resultCall is a call to the function, with the file and package
+// containing it and the nodes enclosing it.
+type resultCall struct {
+	pkgInfo *loader.PackageInfo
+	file    *ast.File
+	call    *ast.CallExpr
+	path    []ast.Node
+}
+
+// findCalls returns the calls to the function, or nil (after logging an
+// error) if it is used in any other way.
+func (r *RemoveResult) findCalls() []*resultCall {
+	calls := []*resultCall{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for id, obj := range pkgInfo.Uses {
+			if obj != r.fn {
+				continue
+			}
+			file := fileContaining(pkgInfo, id.Pos())
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			// Find the call whose callee is the identifier
+			var call *ast.CallExpr
+			var callee ast.Node = id
+			for _, node := range path[1:] {
+				switch node := node.(type) {
+				case *ast.SelectorExpr, *ast.ParenExpr, *ast.IndexExpr,
+					*ast.IndexListExpr:
+					callee = node
+					continue
+				case *ast.CallExpr:
+					if node.Fun == callee {
+						call = node
+					}
+				}
+				break
+			}
+			if call == nil {
+				r.Log.Errorf("%s is used as a value, so its results "+
+					"cannot be changed", r.fn.Name())
+				r.Log.AssociateNode(id)
+				return nil
+			}
+			path, _ = astutil.PathEnclosingInterval(file, call.Pos(), call.End())
+			for len(path) > 0 && path[0] != ast.Node(call) {
+				path = path[1:]
+			}
+			calls = append(calls, &resultCall{pkgInfo, file, call, path})
+		}
+	}
+	return calls
+}
+
+// checkCalls returns false (after logging an error) if a call site uses the
+// result (and it is not always nil) or uses the results in a way that cannot
+// be updated.
+func (r *RemoveResult) checkCalls(calls []*resultCall) bool {
+	for _, c := range calls {
+		switch parent := c.path[1].(type) {
+		case *ast.ExprStmt, *ast.GoStmt, *ast.DeferStmt:
+			continue
+		case *ast.AssignStmt:
+			if len(parent.Lhs) == r.numResults && len(parent.Rhs) == 1 {
+				if r.checkReceiver(c, parent.Lhs[r.index], parent) {
+					continue
+				}
+				return false
+			}
+		case *ast.ValueSpec:
+			if len(parent.Names) == r.numResults && len(parent.Values) == 1 &&
+				r.numResults > 1 {
+				if r.checkReceiver(c, parent.Names[r.index], nil) {
+					continue
+				}
+				return false
+			}
+		}
+		r.Log.Errorf("The results of %s are used here in a way that "+
+			"cannot be updated", r.fn.Name())
+		r.Log.AssociateNode(c.call)
+		return false
+	}
+	return true
+}
+
+// checkReceiver returns true if the given expression, which receives the
+// result at a call site, can be removed; otherwise, it logs an error and
+// returns false.  The assignment is nil if the result is received by a
+// variable declaration.
+func (r *RemoveResult) checkReceiver(c *resultCall, lhs ast.Expr, assign *ast.AssignStmt) bool {
+	if id, ok := lhs.(*ast.Ident); ok && id.Name == "_" {
+		return true
+	}
+	if !r.alwaysNil {
+		r.Log.Errorf("The result is used here, and it is not always "+
+			"nil, so it cannot be removed from %s", r.fn.Name())
+		r.Log.AssociateNode(lhs)
+		return false
+	}
+	if _, ok := c.path[2].(*ast.BlockStmt); !ok && assign != nil {
+		if _, ok := c.path[2].(*ast.CaseClause); !ok {
+			if _, ok := c.path[2].(*ast.CommClause); !ok {
+				r.Log.Error("The result is assigned in a statement " +
+					"that cannot be followed by another " +
+					"assignment, so it cannot be removed")
+				r.Log.AssociateNode(lhs)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// updateDecl removes the result from the function's signature and its return
+// statements, returning false (after logging an error) if the file cannot be
+// read.
+func (r *RemoveResult) updateDecl(config *Config) bool {
+	m := r.migration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, r.decl.Pos()))
+	if m == nil {
+		return false
+	}
+
+	// Rebuild the result list without the result
+	results := r.decl.Type.Results
+	fields, named := []string{}, false
+	i := 0
+	for _, field := range results.List {
+		typ := m.textOf(field.Type)
+		if len(field.Names) == 0 {
+			if i != r.index {
+				fields = append(fields, typ)
+			}
+			i++
+			continue
+		}
+		names := []string{}
+		for _, name := range field.Names {
+			if i != r.index {
+				names = append(names, name.Name)
+			}
+			i++
+		}
+		if len(names) > 0 {
+			fields = append(fields, strings.Join(names, ", ")+" "+typ)
+			named = true
+		}
+	}
+	switch {
+	case len(fields) == 0:
+		m.replace(r.decl.Type.Params.End(), results.End(), "")
+	case len(fields) == 1 && !named:
+		m.replace(results.Pos(), results.End(), fields[0])
+	default:
+		m.replace(results.Pos(), results.End(),
+			"("+strings.Join(fields, ", ")+")")
+	}
+
+	for _, ret := range returnStmts(r.decl.Body) {
+		if len(ret.Results) == 0 {
+			continue
+		}
+		values := []string{}
+		for i, expr := range ret.Results {
+			if i != r.index {
+				values = append(values, m.textOf(expr))
+			}
+		}
+		if len(values) == 0 {
+			m.replace(ret.Pos(), ret.End(), "return")
+		} else {
+			m.replace(ret.Results[0].Pos(), ret.End(),
+				strings.Join(values, ", "))
+		}
+	}
+	return true
+}
+
+// updateCall removes the expression that receives the result at the given
+// call site, if any, returning false (after logging an error) if the file
+// cannot be read.  If the result was received by a variable other than the
+// blank identifier (so it is always nil), the variable is declared or set to
+// nil instead.
+func (r *RemoveResult) updateCall(config *Config, c *resultCall) bool {
+	var lhs []ast.Expr
+	var stmt ast.Node
+	define := false
+	switch parent := c.path[1].(type) {
+	case *ast.AssignStmt:
+		lhs, stmt = parent.Lhs, parent
+		define = parent.Tok == token.DEFINE
+	case *ast.ValueSpec:
+		for _, name := range parent.Names {
+			lhs = append(lhs, name)
+		}
+		stmt, define = parent, true
+		if _, ok := c.path[2].(*ast.GenDecl); ok {
+			stmt = c.path[2]
+		}
+		if _, ok := c.path[3].(*ast.DeclStmt); ok {
+			stmt = c.path[3]
+		}
+	default:
+		return true
+	}
+	m := r.migration(config, c.pkgInfo, c.file)
+	if m == nil {
+		return false
+	}
+
+	remaining, isNew, allBlank := []string{}, false, true
+	for i, expr := range lhs {
+		if i == r.index {
+			continue
+		}
+		remaining = append(remaining, m.textOf(expr))
+		id, ok := expr.(*ast.Ident)
+		if !ok || id.Name != "_" {
+			allBlank = false
+		}
+		if ok && id.Name != "_" && c.pkgInfo.Defs[id] != nil {
+			isNew = true
+		}
+	}
+	// If the result was received by a new variable, it is declared before
+	// the statement; if it was assigned, it is set to nil after it
+	removed := lhs[r.index]
+	before, after := "", ""
+	indent := Indentation(m.src, m.offset(stmt.Pos()))
+	if id, ok := removed.(*ast.Ident); ok && id.Name == "_" {
+		// Nothing is needed
+	} else if ok && define && c.pkgInfo.Defs[id] != nil {
+		qualifier := m.imports.Qualifier(stmt.Pos())
+		t := types.TypeString(c.pkgInfo.Defs[id].Type(), qualifier)
+		before = fmt.Sprintf("var %s %s\n%s", id.Name, t, indent)
+	} else {
+		after = fmt.Sprintf("\n%s%s = nil", indent, m.textOf(removed))
+	}
+
+	if _, ok := stmt.(*ast.AssignStmt); ok && allBlank {
+		// No results are assigned, so the call is a statement
+		m.replace(stmt.Pos(), c.call.Pos(), before)
+	} else if assign, ok := stmt.(*ast.AssignStmt); ok {
+		tok := assign.Tok.String()
+		if define && !isNew {
+			tok = "="
+		}
+		m.replace(assign.Pos(), assign.TokPos+token.Pos(len(assign.Tok.String())),
+			before+strings.Join(remaining, ", ")+" "+tok)
+	} else {
+		spec := c.path[1].(*ast.ValueSpec)
+		if before != "" {
+			m.replace(stmt.Pos(), stmt.Pos(), before)
+		}
+		m.replace(spec.Pos(), spec.Names[len(spec.Names)-1].End(),
+			strings.Join(remaining, ", "))
+	}
+	if after != "" {
+		m.replace(stmt.End(), stmt.End(), after)
+	}
+	return true
+}
+
+const removeResultDoc = `
+  <h4>Purpose</h4>
+  <p>The Remove Result refactoring removes a result from a function's
+  signature.  This is useful when a result is never used by the function's
+  callers, or when it is always nil (e.g., a function that once could fail
+  but no longer can still returns an error).</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a result in the signature of a function or method declaration
+    (if several results are declared together, select its name).</li>
+    <li>Activate the Remove Result refactoring.</li>
+  </ol>
+
+  <p>The result is removed from the signature and from every return
+  statement, and the expressions that receive it are removed from every call
+  site.  The refactoring is only performed if every call site ignores the
+  result (or assigns it to the blank identifier), or if every return
+  statement returns nil for it.  In the latter case, a variable that received
+  the result is declared (or set to nil) instead, so the code that checks it
+  continues to compile; such checks can then be removed by hand.</p>
+
+  <p>An error is reported if the function is used as a value (rather than
+  being called), if it is a method that implements an interface, or if a
+  return statement returns the results of another call.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of removing the
+  <tt>error</tt> result of <tt>parse</tt>, which is always nil.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func parse(s string) (int, <span class="highlight">error</span>) {
+    return len(s), nil
+}
+
+func main() {
+    n, err := parse("abc")
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(n)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func parse(s string) int {
+    return len(s)
+}
+
+func main() {
+    var err error
+    n := parse("abc")
+    if err != nil {
+        panic(err)
+    }
+    fmt.Println(n)
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -8,14 +8,17 @@
 package refactoring
 
 import (
+	"bytes"
 	"go/ast"
 	"go/token"
 	"go/types"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/loader"
@@ -31,6 +34,24 @@ import (
 type Rename struct {
 	RefactoringBase
 	newName string // New name to be given to the selected identifier
+	preview bool   // Whether to log every reference that will be renamed
+	// Whether to check preconditions only, without computing edits
+	checkOnly bool
+	// Whether to add struct tags preserving a renamed field's serialized name
+	preserveTags bool
+	// Number of references found, and number of files containing them
+	refCount, fileCount int
+	// References that will be renamed (or were skipped), for preview
+	references []*renamedReference
+}
+
+// A renamedReference is an occurrence of the name being renamed, which is
+// logged when a preview is requested.
+type renamedReference struct {
+	filename string
+	extent   *text.Extent
+	// Reason why this reference will not be renamed, or "" if it will
+	skipReason string
 }
 
 func (r *Rename) Description() *Description {
@@ -38,6 +59,7 @@ func (r *Rename) Description() *Description {
 		Name:      "Rename",
 		Synopsis:  "Changes the name of an identifier",
 		Usage:     "<new_name>",
+		Selection: "An identifier",
 		HTMLDoc:   renameDoc,
 		Multifile: true,
 		Params: []Parameter{{
@@ -45,8 +67,20 @@ func (r *Rename) Description() *Description {
 			Prompt:       "What to rename this identifier to.",
 			DefaultValue: "",
 		}},
-		OptionalParams: nil,
-		Hidden:         false,
+		OptionalParams: []Parameter{{
+			Label:        "Preview:",
+			Prompt:       "List every reference that will be renamed.",
+			DefaultValue: false,
+		}, {
+			Label:        "Check Only:",
+			Prompt:       "Only check whether the identifier can be renamed.",
+			DefaultValue: false,
+		}, {
+			Label:        "Preserve Tags:",
+			Prompt:       "Add json/xml tags preserving a renamed field's serialized name.",
+			DefaultValue: false,
+		}},
+		Hidden: false,
 	}
 }
 
@@ -57,23 +91,35 @@ func (r *Rename) Run(config *Config) *Result {
 		return &r.Result
 	}
 
+	r.newName = config.Args[0].(string)
+	r.preview = len(config.Args) > 1 && config.Args[1].(bool)
+	r.checkOnly = len(config.Args) > 2 && config.Args[2].(bool)
+	r.preserveTags = len(config.Args) > 3 && config.Args[3].(bool)
+	r.references = nil
+	r.refCount, r.fileCount = 0, 0
+	if r.checkOnly {
+		defer r.logVerdict()
+	}
+
 	if r.SelectedNode == nil {
 		r.Log.Error("Please select an identifier to rename.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
 		return &r.Result
 	}
 
-	r.newName = config.Args[0].(string)
 	if r.newName == "" {
 		r.Log.Error("newName cannot be empty")
+		r.Log.AssociateArg(0)
 		return &r.Result
 	}
 	if !isIdentifierValid(r.newName) {
 		r.Log.Errorf("The new name \"%s\" is not a valid Go identifier", r.newName)
+		r.Log.AssociateArg(0)
 		return &r.Result
 	}
 	if isReservedWord(r.newName) {
 		r.Log.Errorf("The new name \"%s\" is a reserved word", r.newName)
+		r.Log.AssociateArg(0)
 		return &r.Result
 	}
 
@@ -108,7 +154,18 @@ func (r *Rename) Run(config *Config) *Result {
 		r.Log.Warn("Renaming an exported name to an unexported name will introduce errors outside the package in which it is declared.")
 	}
 
-	r.rename(ident, r.SelectedNodePkg)
+	r.rename(config, ident, r.SelectedNodePkg)
+	if r.checkOnly {
+		return &r.Result
+	}
+	if r.preview {
+		// Log positions refer to the original source code, so the
+		// log is not updated to reflect the renamed source code
+		r.removeExcludedEdits(config)
+		r.applyGeneratedFilePolicy(config)
+		r.logPreview(config)
+		return &r.Result
+	}
 	r.UpdateLog(config, false)
 	return &r.Result
 
@@ -129,7 +186,7 @@ func isReservedWord(newName string) bool {
 	return b
 }
 
-func (r *Rename) rename(ident *ast.Ident, pkgInfo *loader.PackageInfo) {
+func (r *Rename) rename(config *Config, ident *ast.Ident, pkgInfo *loader.PackageInfo) {
 	obj := pkgInfo.ObjectOf(ident)
 
 	if obj == nil && r.selectedTypeSwitchVar(ident) == nil {
@@ -149,6 +206,12 @@ func (r *Rename) rename(ident *ast.Ident, pkgInfo *loader.PackageInfo) {
 	if conflict := names.FindConflict(obj, r.newName); conflict != nil {
 		r.Log.Errorf("Renaming %s to %s may cause conflicts with an existing declaration", ident.Name, r.newName)
 		r.Log.AssociatePos(conflict.Pos(), conflict.Pos())
+	} else if conflict := names.FindDotImportConflict(obj, r.newName, r.Program); conflict != nil {
+		r.Log.Errorf("Renaming %s to %s may cause conflicts in a file that dot-imports package %s", ident.Name, r.newName, obj.Pkg().Name())
+		r.Log.AssociatePos(conflict.Pos(), conflict.Pos())
+	}
+	if tn, ok := obj.(*types.TypeName); ok {
+		r.logAliases(tn)
 	}
 	var scope *types.Scope
 	var idents map[*ast.Ident]bool
@@ -161,8 +224,34 @@ func (r *Rename) rename(ident *ast.Ident, pkgInfo *loader.PackageInfo) {
 		}
 		idents = names.FindOccurrences(obj, r.Program)
 	}
+	idents = r.removeCgoOccurrences(config, idents)
+
+	if r.checkOnly {
+		r.checkOccurrences(config, obj, idents)
+		return
+	}
+	r.addOccurrences(config, ident.Name, scope, r.extents(idents, r.Program.Fset))
+	if r.preserveTags && obj != nil {
+		r.preserveWireName(config, obj, ident.Name)
+	}
+}
 
-	r.addOccurrences(ident.Name, scope, r.extents(idents, r.Program.Fset))
+// logAliases reports the type aliases related to the type name being
+// renamed, since references through an alias are not renamed: if tn is an
+// alias, the aliased type keeps its name, and if it is not, the aliases
+// denoting it keep theirs.
+func (r *Rename) logAliases(tn *types.TypeName) {
+	if tn.IsAlias() {
+		r.Log.Infof("%s is an alias for %s, which will not be renamed",
+			tn.Name(), types.TypeString(types.Unalias(tn.Type()),
+				types.RelativeTo(tn.Pkg())))
+		return
+	}
+	for _, alias := range names.FindAliases(tn, r.Program) {
+		r.Log.Infof("%s is also denoted by the alias %s, which will "+
+			"not be renamed", tn.Name(), alias.Name())
+		r.Log.AssociatePos(alias.Pos(), alias.Pos())
+	}
 }
 
 func (r *Rename) selectedTypeSwitchVar(ident *ast.Ident) *ast.TypeSwitchStmt {
@@ -206,31 +295,260 @@ func (r *Rename) extents(ids map[*ast.Ident]bool, fset *token.FileSet) map[strin
 	return sorted
 }
 
-func (r *Rename) addOccurrences(name string, scope *types.Scope, allOccurrences map[string][]*text.Extent) {
+func (r *Rename) addOccurrences(config *Config, name string, scope *types.Scope, allOccurrences map[string][]*text.Extent) {
 	hasOccsInGoRoot := false
+	excluded := []string{}
 	for filename, occurrences := range allOccurrences {
 		if isInGoRoot(filename) {
 			hasOccsInGoRoot = true
+			for _, occurrence := range occurrences {
+				r.addReference(filename, occurrence, "in $GOROOT")
+			}
+		} else if IsExcluded(config, filename) {
+			excluded = append(excluded, filename)
+			for _, occurrence := range occurrences {
+				r.addReference(filename, occurrence, "excluded")
+			}
 		} else {
 			if r.Edits[filename] == nil {
 				r.Edits[filename] = text.NewEditSet()
 			}
 			for _, occurrence := range occurrences {
 				r.Edits[filename].Add(occurrence, r.newName)
+				r.addReference(filename, occurrence, "")
 			}
 			_, file := r.fileNamed(filename)
 			commentOccurrences := names.FindInComments(
 				name, file, scope, r.Program.Fset)
 			for _, occurrence := range commentOccurrences {
 				r.Edits[filename].Add(occurrence, r.newName)
+				r.addReference(filename, occurrence, "")
+			}
+		}
+	}
+	if hasOccsInGoRoot {
+		r.Log.Warnf("Occurrences were found in files under $GOROOT, but these will not be renamed")
+	}
+	sort.Strings(excluded)
+	for _, filename := range excluded {
+		r.Log.Warnf("Occurrences were found in %s, but it is excluded, so these will not be renamed",
+			filename)
+	}
+}
+
+// removeCgoOccurrences removes identifiers in cgo files (i.e., files that
+// import "C") from the given set and logs a warning for each.
+//
+// The loader type checks the files generated by cgo rather than the original
+// files.  The generated files are given the names of the original files, and
+// line numbers are reported relative to the original files, but byte offsets
+// refer to the generated files and cannot be used to edit the originals.
+func (r *Rename) removeCgoOccurrences(config *Config, idents map[*ast.Ident]bool) map[*ast.Ident]bool {
+	result := make(map[*ast.Ident]bool, len(idents))
+	isCgo := map[string]bool{}
+	for _, id := range sortedIdents(idents) {
+		pos := r.Program.Fset.Position(id.Pos())
+		if _, ok := isCgo[pos.Filename]; !ok {
+			isCgo[pos.Filename] = isCgoFile(config, pos.Filename)
+		}
+		if !isCgo[pos.Filename] {
+			result[id] = idents[id]
+			continue
+		}
+		r.Log.Warnf("This reference to %s cannot be renamed because %s uses cgo; it must be renamed manually",
+			id.Name, filepath.Base(pos.Filename))
+		r.Log.AssociateNode(id)
+	}
+	return result
+}
+
+// isCgoFile returns true iff the given file imports "C".
+func isCgoFile(config *Config, filename string) bool {
+	if isInGoRoot(filename) {
+		return false
+	}
+	file, err := parseImports(config, token.NewFileSet(), filename)
+	if err != nil {
+		return false
+	}
+	for _, spec := range file.Imports {
+		if spec.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOccurrences analyzes the impact of renaming the given occurrences of
+// obj without computing any edits.  A warning is logged for each reference
+// outside obj's package that will no longer be accessible after an exported
+// name is renamed to an unexported name, and for each excluded file containing
+// references.
+func (r *Rename) checkOccurrences(config *Config, obj types.Object, idents map[*ast.Ident]bool) {
+	unexporting := obj != nil && obj.Exported() && !ast.IsExported(r.newName)
+	files := map[string]bool{}
+	excluded := map[string]bool{}
+	hasOccsInGoRoot := false
+	for _, id := range sortedIdents(idents) {
+		filename := r.Program.Fset.Position(id.Pos()).Filename
+		if isInGoRoot(filename) {
+			hasOccsInGoRoot = true
+			continue
+		}
+		if IsExcluded(config, filename) {
+			if !excluded[filename] {
+				r.Log.Warnf("Occurrences were found in %s, but it is excluded, so these will not be renamed",
+					filename)
+				excluded[filename] = true
+			}
+			continue
+		}
+		r.refCount++
+		files[filename] = true
+		if unexporting {
+			if pkgInfo, _ := r.fileNamed(filename); pkgInfo != nil &&
+				pkgInfo.Pkg != obj.Pkg() {
+				r.Log.Warnf("The reference to %s in package %s will not be accessible after it is renamed to %s",
+					id.Name, pkgInfo.Pkg.Path(), r.newName)
+				r.Log.AssociateNode(id)
 			}
 		}
 	}
+	r.fileCount = len(files)
 	if hasOccsInGoRoot {
 		r.Log.Warnf("Occurrences were found in files under $GOROOT, but these will not be renamed")
 	}
 }
 
+// sortedIdents returns the given identifiers sorted by position.
+func sortedIdents(idents map[*ast.Ident]bool) []*ast.Ident {
+	result := make([]*ast.Ident, 0, len(idents))
+	for id := range idents {
+		result = append(result, id)
+	}
+	sort.Sort(byPos(result))
+	return result
+}
+
+// byPos sorts identifiers by position.
+type byPos []*ast.Ident
+
+func (s byPos) Len() int           { return len(s) }
+func (s byPos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPos) Less(i, j int) bool { return s[i].Pos() < s[j].Pos() }
+
+// logVerdict summarizes the result of a check: the identifier can be renamed
+// if no errors were logged.  The errors and warnings in the log are the
+// obstacles to (or possible problems with) the renaming.
+func (r *Rename) logVerdict() {
+	errors, warnings := 0, 0
+	for _, entry := range r.Log.Entries {
+		switch entry.Severity {
+		case Error:
+			errors++
+		case Warning:
+			warnings++
+		}
+	}
+	switch {
+	case errors > 0:
+		r.Log.Infof("Check failed: the identifier cannot be renamed (%d error(s), %d warning(s))",
+			errors, warnings)
+	case warnings > 0:
+		r.Log.Infof("Check passed with %d warning(s): %d reference(s) in %d file(s) will be renamed",
+			warnings, r.refCount, r.fileCount)
+	default:
+		r.Log.Infof("Check passed: %d reference(s) in %d file(s) will be renamed",
+			r.refCount, r.fileCount)
+	}
+}
+
+// addReference records a reference to be listed in a preview.
+func (r *Rename) addReference(filename string, extent *text.Extent, skipReason string) {
+	if r.preview {
+		r.references = append(r.references,
+			&renamedReference{filename, extent, skipReason})
+	}
+}
+
+// logPreview adds an informational message to the log for every reference
+// that will be renamed, and a warning for every reference that will not,
+// sorted by filename and offset.  Each entry includes the line of source code
+// containing the reference.
+func (r *Rename) logPreview(config *Config) {
+	sort.Sort(byFilenameAndOffset(r.references))
+	files := map[string]*token.File{}
+	r.Program.Fset.Iterate(func(f *token.File) bool {
+		files[f.Name()] = f
+		return true
+	})
+	contents := map[string][]byte{}
+	renamed, skipped := 0, 0
+	for _, ref := range r.references {
+		if _, ok := contents[ref.filename]; !ok {
+			contents[ref.filename] = readFile(config, ref.filename)
+		}
+		snippet := lineContaining(contents[ref.filename], ref.extent.Offset)
+		if ref.skipReason == "" {
+			r.Log.Infof("Rename: %s", snippet)
+			renamed++
+		} else {
+			r.Log.Warnf("Skip (%s): %s", ref.skipReason, snippet)
+			skipped++
+		}
+		if file, ok := files[ref.filename]; ok &&
+			ref.extent.OffsetPastEnd() <= file.Size() {
+			r.Log.AssociatePos(file.Pos(ref.extent.Offset),
+				file.Pos(ref.extent.OffsetPastEnd()))
+		}
+	}
+	r.Log.Infof("%d reference(s) will be renamed; %d will be skipped",
+		renamed, skipped)
+}
+
+// byFilenameAndOffset sorts renamedReferences by filename, then by offset.
+type byFilenameAndOffset []*renamedReference
+
+func (s byFilenameAndOffset) Len() int      { return len(s) }
+func (s byFilenameAndOffset) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byFilenameAndOffset) Less(i, j int) bool {
+	if s[i].filename != s[j].filename {
+		return s[i].filename < s[j].filename
+	}
+	return s[i].extent.Offset < s[j].extent.Offset
+}
+
+// readFile returns the contents of the given file, or nil if it cannot be
+// read.
+func readFile(config *Config, filename string) []byte {
+	reader, err := config.FileSystem.OpenFile(filename)
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+	return contents
+}
+
+// lineContaining returns the line of text containing the given offset, with
+// leading and trailing whitespace removed.
+func lineContaining(contents []byte, offset int) string {
+	if offset > len(contents) {
+		return ""
+	}
+	start := bytes.LastIndexByte(contents[:offset], '\n') + 1
+	end := bytes.IndexByte(contents[offset:], '\n')
+	if end < 0 {
+		end = len(contents)
+	} else {
+		end += offset
+	}
+	return strings.TrimSpace(string(contents[start:end]))
+}
+
 func isInGoRoot(absPath string) bool {
 	goRoot := os.Getenv("GOROOT")
 	if goRoot == "" {
@@ -275,8 +593,33 @@ const renameDoc = `
     same name).</li>
     <li>The necessary changes cannot be made (e.g., the renaming would change 
     the name of a function in the Go standard library).</li>
+    <li>A reference is in a file that uses cgo (i.e., imports <tt>"C"</tt>).
+    Such references are not renamed, since their locations in the file cannot
+    be determined precisely; a warning identifies each one so that it can be
+    renamed manually.</li>
   </ul>
 
+  <p>If the optional Preview argument is true, the log additionally lists
+  every reference that will be renamed (including occurrences in comments),
+  along with the line of source code containing it, and every reference that
+  will be skipped, along with the reason it will be skipped.  Positions in the
+  log refer to the original source code.  This allows a large renaming to be
+  audited before it is applied.</p>
+
+  <p>If the optional Check Only argument is true, no edits are computed.
+  Instead, the preconditions for the renaming are checked, references outside
+  the declaring package that would become inaccessible are reported, and the
+  log ends with a verdict stating whether the identifier can be renamed.  Since
+  this is faster than computing the renaming, it is suitable for validating a
+  new name as it is typed.</p>
+
+  <p>Renaming an exported struct field changes its name in the JSON and XML
+  encodings, unless a struct tag gives it an explicit name.  If the optional
+  Preserve Tags argument is true, <tt>json</tt> and <tt>xml</tt> tags giving
+  the field's old name are added to the field (or, if the field already has a
+  tag with options but no name, such as <tt>json:",omitempty"</tt>, the old
+  name is inserted), so that serialized data remains compatible.</p>
+
   <h4>Example</h4>
   <p>The example below demonstrates the effect of renaming the highlighted
   occurrence of <tt>hello</tt> to <tt>goodnight</tt>.  Note that there are two
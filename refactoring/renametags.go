@@ -0,0 +1,165 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file adds struct tags that preserve the serialized (wire) name of a
+// struct field when the Rename refactoring renames it.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// wireNameKeys are the struct tag keys for encodings that, by default, use a
+// field's name as its serialized name.
+var wireNameKeys = []string{"json", "xml"}
+
+// preserveWireName adds or updates the tag of the struct field obj, which is
+// being renamed from oldName, so that its serialized name remains oldName.  A
+// tag is added for each of the wireNameKeys that does not already give the
+// field an explicit name.  Unexported fields are not serialized, so their tags
+// are not changed.
+func (r *Rename) preserveWireName(config *Config, obj types.Object, oldName string) {
+	v, ok := obj.(*types.Var)
+	if !ok || !v.IsField() || v.Anonymous() || !ast.IsExported(oldName) {
+		return
+	}
+	filename := r.Program.Fset.Position(obj.Pos()).Filename
+	if isInGoRoot(filename) || IsExcluded(config, filename) {
+		return
+	}
+	_, file := r.fileNamed(filename)
+	field := findField(file, obj)
+	if field == nil {
+		return
+	}
+	if len(field.Names) > 1 {
+		r.Log.Warnf("A tag preserving the serialized name of %s cannot "+
+			"be added, since it is declared together with other "+
+			"fields", oldName)
+		r.Log.AssociateNode(field)
+		return
+	}
+
+	tag := ""
+	if field.Tag != nil {
+		var err error
+		if tag, err = strconv.Unquote(field.Tag.Value); err != nil {
+			return
+		}
+	}
+	newTag, changed := addWireNames(tag, oldName)
+	if !changed {
+		return
+	}
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	if field.Tag == nil {
+		offset := r.OffsetOfPos(field.Type.End())
+		r.Edits[filename].Add(&text.Extent{Offset: offset, Length: 0},
+			" "+quoteTag(newTag, true))
+	} else {
+		raw := strings.HasPrefix(field.Tag.Value, "`")
+		r.Edits[filename].Add(r.Extent(field.Tag), quoteTag(newTag, raw))
+	}
+	r.Log.Infof("Updated the tag of %s to preserve its serialized name",
+		oldName)
+	r.Log.AssociateNode(field)
+}
+
+// findField returns the field in the given file that declares obj, or nil if
+// there is none.
+func findField(file *ast.File, obj types.Object) *ast.Field {
+	if file == nil {
+		return nil
+	}
+	var result *ast.Field
+	ast.Inspect(file, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			for _, name := range field.Names {
+				if name.Pos() == obj.Pos() {
+					result = field
+				}
+			}
+		}
+		return result == nil
+	})
+	return result
+}
+
+// addWireNames returns the given struct tag, modified so that each of the
+// wireNameKeys gives the serialized name name, unless the tag already gives
+// an explicit name (or "-") for that key.  The second result is true if the
+// tag was changed.
+func addWireNames(tag, name string) (string, bool) {
+	changed := false
+	for _, key := range wireNameKeys {
+		value, ok := reflect.StructTag(tag).Lookup(key)
+		if !ok {
+			tag = strings.TrimSpace(tag + " " + key + ":" + strconv.Quote(name))
+			changed = true
+		} else if value == "" || strings.HasPrefix(value, ",") {
+			// The name is empty, with or without options
+			if start, end, ok := tagValueExtent(tag, key); ok {
+				tag = tag[:start] + strconv.Quote(name+value) + tag[end:]
+				changed = true
+			}
+		}
+	}
+	return tag, changed
+}
+
+// tagValueExtent returns the start and end offsets of the quoted value for
+// the given key in a struct tag, which is assumed to have the conventional
+// format parsed by reflect.StructTag.
+func tagValueExtent(tag, key string) (int, int, bool) {
+	i := 0
+	for i < len(tag) {
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' &&
+			tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == nameStart || i+1 >= len(tag) ||
+			tag[i] != ':' || tag[i+1] != '"' {
+			return 0, 0, false
+		}
+		name := tag[nameStart:i]
+		i++
+		start := i
+		for i++; i < len(tag) && tag[i] != '"'; i++ {
+			if tag[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(tag) {
+			return 0, 0, false
+		}
+		i++
+		if name == key {
+			return start, i, true
+		}
+	}
+	return 0, 0, false
+}
+
+// quoteTag returns a Go string literal for the given struct tag: a raw string
+// literal if raw is true and the tag does not contain a backquote, and an
+// interpreted string literal otherwise.
+func quoteTag(tag string, raw bool) string {
+	if raw && !strings.Contains(tag, "`") {
+		return "`" + tag + "`"
+	}
+	return strconv.Quote(tag)
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a transformation that rewrites import paths, e.g., when a
+// dependency is forked, moved to a vanity domain, or vendored.
+
+package refactoring
+
+import (
+	"go/ast"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/imports"
+	"golang.org/x/tools/go/loader"
+)
+
+// RewriteImports is a transformation that replaces one import path prefix
+// with another in every file in the scope.  An import path is rewritten if it
+// is equal to the old prefix or begins with the old prefix followed by a
+// slash, so the prefix github.com/a/b matches github.com/a/b and
+// github.com/a/b/c but not github.com/a/bc.  Import comments are rewritten as
+// well, and local names given to imports are preserved.
+type RewriteImports struct {
+	RefactoringBase
+}
+
+func (r *RewriteImports) Description() *Description {
+	return &Description{
+		Name:      "Rewrite Import Paths",
+		Synopsis:  "Replaces an import path prefix throughout the scope",
+		Usage:     "<old_prefix> <new_prefix>",
+		Selection: "",
+		HTMLDoc:   rewriteImportsDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Old Prefix:",
+			Prompt:       "Import path prefix to replace.",
+			DefaultValue: "",
+		}, {
+			Label:        "New Prefix:",
+			Prompt:       "Import path prefix to replace it with.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *RewriteImports) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	oldPrefix := strings.TrimSuffix(config.Args[0].(string), "/")
+	newPrefix := strings.TrimSuffix(config.Args[1].(string), "/")
+	if oldPrefix == "" || newPrefix == "" {
+		r.Log.Error("The old and new import path prefixes cannot be empty")
+		if oldPrefix == "" {
+			r.Log.AssociateArg(0)
+		} else {
+			r.Log.AssociateArg(1)
+		}
+		return &r.Result
+	}
+	if oldPrefix == newPrefix {
+		r.Log.Error("The old and new import path prefixes are the same")
+		r.Log.AssociateArg(1)
+		return &r.Result
+	}
+
+	// Import paths that were rewritten, mapped to their replacements
+	rewritten := map[string]string{}
+	rewrite := func(path string) (string, bool) {
+		newPath, ok := replacePathPrefix(path, oldPrefix, newPrefix)
+		if ok {
+			rewritten[path] = newPath
+		}
+		return newPath, ok
+	}
+	// The first rewritten import spec adding each import edge, and the
+	// import edges that are removed
+	added := map[importEdge]*ast.ImportSpec{}
+	removed := map[importEdge]bool{}
+	r.rewriteImportsInProgram(config, rewrite, func(pkgInfo *loader.PackageInfo, filename string, spec *ast.ImportSpec) {
+		oldPath := strings.Trim(spec.Path.Value, `"`)
+		edge := importEdge{
+			from: pkgInfo.Pkg.Path(),
+			to:   rewritten[oldPath],
+		}
+		if added[edge] == nil {
+			added[edge] = spec
+		}
+		removed[importEdge{from: edge.from, to: oldPath}] = true
+		if spec.Name == nil {
+			if pkg := r.Program.Package(oldPath); pkg != nil {
+				newPath := rewritten[pkg.Pkg.Path()]
+				if pkg.Pkg.Name() != lastPathElement(newPath) &&
+					pkg.Pkg.Name() == lastPathElement(pkg.Pkg.Path()) {
+					r.Log.Infof("The package %s is imported without a name, so references to it will still use the name %s",
+						newPath, pkg.Pkg.Name())
+					r.Log.AssociateNode(spec)
+				}
+			}
+		}
+	})
+	if len(rewritten) == 0 {
+		r.Log.Errorf("No imports with the prefix %s were found", oldPrefix)
+		return &r.Result
+	}
+	r.checkNewPaths(config, rewritten)
+	r.checkImportCycles(config, added, removed)
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// checkNewPaths logs a warning for each rewritten import path that does not
+// correspond to a package in the workspace, since such imports will not
+// compile until the package is made available (e.g., by forking or vendoring
+// it).
+func (r *RewriteImports) checkNewPaths(config *Config, rewritten map[string]string) {
+	newPaths := []string{}
+	for _, newPath := range rewritten {
+		newPaths = append(newPaths, newPath)
+	}
+	sort.Strings(newPaths)
+	ctxt := newBuildContext(config)
+	for _, newPath := range newPaths {
+		if _, err := ctxt.Import(newPath, "", 0); err != nil {
+			r.Log.Warnf("The package %s was not found", newPath)
+		}
+	}
+}
+
+// An importEdge is an import of the package to by the package from.
+type importEdge struct {
+	from, to string
+}
+
+// checkImportCycles logs an error for each rewritten import that is part of an
+// import cycle once all of the imports are rewritten, associated with the
+// import spec that adds it.  The cycle is checked in the import graph with
+// every removed edge deleted and every added edge inserted, since two
+// rewritten imports can form a cycle even if neither one does alone.
+func (r *RewriteImports) checkImportCycles(config *Config, added map[importEdge]*ast.ImportSpec, removed map[importEdge]bool) {
+	// Packages that cannot be found (e.g., a new path that has not been
+	// vendored yet) cannot be part of a cycle
+	ctxt := newBuildContext(config)
+	edges := []importEdge{}
+	roots := []string{}
+	for edge := range added {
+		edges = append(edges, edge)
+		for _, path := range []string{edge.from, edge.to} {
+			if _, err := ctxt.Import(path, "", 0); err == nil {
+				roots = append(roots, path)
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	graph, err := imports.NewGraph(ctxt, roots)
+	if err != nil {
+		r.Log.Warnf("Import cycles could not be detected: %s", err)
+		return
+	}
+	for from, paths := range graph.Imports {
+		kept := []string{}
+		for _, to := range paths {
+			if !removed[importEdge{from, to}] {
+				kept = append(kept, to)
+			}
+		}
+		graph.Imports[from] = kept
+	}
+	for _, edge := range edges {
+		paths := graph.Imports[edge.from]
+		i := sort.SearchStrings(paths, edge.to)
+		if _, ok := graph.Imports[edge.to]; ok && (i == len(paths) || paths[i] != edge.to) {
+			paths = append(paths, "")
+			copy(paths[i+1:], paths[i:])
+			paths[i] = edge.to
+			graph.Imports[edge.from] = paths
+		}
+	}
+	for _, edge := range edges {
+		// The edge is in the graph now, so it is on a cycle iff
+		// adding it again would introduce one
+		if cycle := graph.WouldCycle(edge.from, edge.to); cycle != nil {
+			r.Log.Errorf("Importing %s in %s would introduce an import cycle: %s -> %s",
+				edge.to, edge.from, strings.Join(cycle, " -> "), cycle[0])
+			r.Log.AssociateNode(added[edge])
+		}
+	}
+}
+
+// replacePathPrefix replaces the prefix oldPrefix in path with newPrefix, if
+// path is equal to oldPrefix or begins with oldPrefix followed by a slash.
+// It returns the new path and true if the prefix was replaced, or the original
+// path and false otherwise.
+func replacePathPrefix(path, oldPrefix, newPrefix string) (string, bool) {
+	if path == oldPrefix {
+		return newPrefix, true
+	}
+	if strings.HasPrefix(path, oldPrefix+"/") {
+		return newPrefix + strings.TrimPrefix(path, oldPrefix), true
+	}
+	return path, false
+}
+
+// lastPathElement returns the last element of a slash-separated import path.
+func lastPathElement(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+const rewriteImportsDoc = `
+  <h4>Purpose</h4>
+  <p>The Rewrite Import Paths refactoring replaces one import path prefix with
+  another in every file in the refactoring scope.  This is useful when a
+  dependency is forked, moved to a vanity domain, or vendored.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Activate the Rewrite Import Paths refactoring.</li>
+    <li>Enter the import path prefix to replace.</li>
+    <li>Enter the import path prefix to replace it with.</li>
+  </ol>
+
+  <p>An import path is rewritten if it is equal to the old prefix or begins
+  with the old prefix followed by a slash; e.g., the prefix
+  <tt>github.com/a/b</tt> matches <tt>github.com/a/b</tt> and
+  <tt>github.com/a/b/c</tt> but not <tt>github.com/a/bc</tt>.  Import comments
+  (e.g., <tt>package b // import "github.com/a/b"</tt>) are rewritten as well.
+  If an import has a local name, the name is preserved.</p>
+
+  <p>A warning is reported if a rewritten import path does not correspond to a
+  package in the workspace, and an error is reported if a rewritten import
+  would introduce an import cycle.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of replacing the prefix
+  <tt>github.com/user/lib</tt> with <tt>example.com/lib</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>package main
+
+import (
+    "github.com/user/lib"
+    s "github.com/user/lib/strings"
+)</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>package main
+
+import (
+    "example.com/lib"
+    s "example.com/lib/strings"
+)</pre>
+      </td>
+    </tr>
+  </table>
+`
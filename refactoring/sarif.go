@@ -0,0 +1,148 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file outputs a Log in the Static Analysis Results Interchange Format
+// (SARIF) 2.1.0, which can be uploaded to code scanning services.
+
+package refactoring
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string       `json:"name"`
+	Rules []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifLevels maps each Severity to the corresponding SARIF result level.
+var sarifLevels = map[Severity]string{
+	Info:    "note",
+	Warning: "warning",
+	Error:   "error",
+}
+
+// WriteSARIF outputs this log as a SARIF 2.1.0 document describing a single
+// run of the named tool.  Every entry becomes a result of the given rule
+// (typically the short name of the refactoring that produced the log).
+// Filenames are given relative to the given directory, if possible.  As
+// elsewhere in the Go Doctor, columns are counted in bytes.
+func (log *Log) WriteSARIF(out io.Writer, tool, ruleID, cwd string) error {
+	run := &sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:  tool,
+			Rules: []*sarifRule{{ID: ruleID}},
+		}},
+		Results: []*sarifResult{},
+	}
+	for _, entry := range log.Entries {
+		result := &sarifResult{
+			RuleID:  ruleID,
+			Level:   sarifLevels[entry.Severity],
+			Message: sarifMessage{Text: entry.Message},
+		}
+		if location := log.sarifLocation(entry, cwd); location != nil {
+			result.Locations = []*sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	data, err := json.MarshalIndent(&sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []*sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+// sarifLocation returns the location of the given entry, or nil if it is not
+// associated with a position in a file on disk.
+func (log *Log) sarifLocation(entry *Entry, cwd string) *sarifLocation {
+	if log.Fset == nil || !entry.Pos.IsValid() {
+		return nil
+	}
+	start := log.Fset.Position(entry.Pos)
+	if stdin, _ := filesystem.FakeStdinPath(); start.Filename == stdin {
+		return nil
+	}
+	uri := filepath.ToSlash(displayablePath(start.Filename, cwd))
+	if filepath.IsAbs(start.Filename) && uri == filepath.ToSlash(start.Filename) {
+		uri = "file:///" + strings.TrimPrefix(uri, "/")
+	}
+	region := sarifRegion{StartLine: start.Line, StartColumn: start.Column}
+	if entry.End.IsValid() {
+		if end := log.Fset.Position(entry.End); end.Filename == start.Filename &&
+			end.Offset >= start.Offset {
+			region.EndLine, region.EndColumn = end.Line, end.Column
+		}
+	}
+	return &sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: uri},
+		Region:           region,
+	}}
+}
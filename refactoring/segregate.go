@@ -0,0 +1,555 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that splits an interface into smaller
+// interfaces containing the methods used by each function that accepts it.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// SegregateInterface is a refactoring that splits the selected interface
+// into smaller interfaces, based on the methods that its consumers use.  A
+// consumer is a parameter of the interface type whose only uses are calls to
+// (or method values of) the interface's methods.  For each distinct set of
+// methods used by consumers (other than the full method set), a new interface
+// is declared containing exactly those methods, and the consumers' parameter
+// types are changed to it.
+//
+// The original interface is rewritten to embed the new interfaces (together
+// with any methods not used by a consumer), so it has the same method set as
+// before and every existing implementation and use of it remains valid.
+//
+// Only the parameters of functions and methods whose signatures can be
+// changed safely are considered: they must not be generic, they must only be
+// called directly (not used as function values), and a method must not have
+// the same name as a method of any named interface in the program, since
+// changing its signature could prevent its receiver type from implementing
+// that interface.
+type SegregateInterface struct {
+	RefactoringBase
+	// The interface being split and its declaration
+	iface   *types.TypeName
+	pkgInfo *loader.PackageInfo
+	decl    *ast.GenDecl
+	spec    *ast.TypeSpec
+	// The declarations of its methods, in order, and their names
+	methods     []*ast.Field
+	methodNames []string
+	// The parameters whose types are changed
+	consumers []*ifaceConsumer
+	// The interfaces added, in the order they are declared
+	parts []*ifacePart
+	// The identifiers that are the callee of a call expression
+	callees map[*ast.Ident]bool
+}
+
+// An ifaceConsumer is a parameter whose type can be narrowed to one of the
+// new interfaces.
+type ifaceConsumer struct {
+	pkgInfo *loader.PackageInfo
+	file    *ast.File
+	// The function declaring the parameter and the parameter's declaration
+	funcDecl *ast.FuncDecl
+	field    *ast.Field
+	// The names of the methods used, in declaration order
+	methods []string
+	// The interface the parameter's type is changed to
+	part *ifacePart
+}
+
+// An ifacePart is an interface added to contain a subset of the methods of the
+// original interface.
+type ifacePart struct {
+	name    string
+	methods []string
+	// The names of the functions whose parameters are changed to it
+	users []string
+}
+
+func (r *SegregateInterface) Description() *Description {
+	return &Description{
+		Name:           "Segregate Interface",
+		Synopsis:       "Splits an interface into smaller interfaces used by its consumers",
+		Usage:          "",
+		Selection:      "The name of an interface type",
+		HTMLDoc:        segregateInterfaceDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *SegregateInterface) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.methods, r.methodNames = nil, nil
+	r.consumers, r.parts = nil, nil
+	r.callees = map[*ast.Ident]bool{}
+
+	if !r.findInterface() {
+		return &r.Result
+	}
+	r.findConsumers()
+	if len(r.consumers) == 0 {
+		r.Log.Errorf("No function uses a proper subset of the methods "+
+			"of %s, so it cannot be split", r.iface.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if !r.chooseParts() {
+		return &r.Result
+	}
+	for _, part := range r.parts {
+		r.Log.Infof("Adding interface %s with method(s) %s, used by %s",
+			part.name, strings.Join(part.methods, ", "),
+			joinNames(part.users))
+	}
+
+	if !r.rewriteInterface(config) {
+		return &r.Result
+	}
+	for _, c := range r.consumers {
+		m := r.migration(config, c.pkgInfo, c.file)
+		if m == nil {
+			return &r.Result
+		}
+		name := c.part.name
+		if c.pkgInfo != r.pkgInfo {
+			name = m.qualify(r.iface.Pkg().Path(), r.iface.Pkg().Name(),
+				name, c.field.Type.Pos())
+		}
+		m.replace(c.field.Type.Pos(), c.field.Type.End(), name)
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findInterface finds the selected interface and its declaration, returning
+// false (after logging an error) if the selection is not the name of an
+// interface that can be split.
+func (r *SegregateInterface) findInterface() bool {
+	if id, ok := r.SelectedNode.(*ast.Ident); ok && r.SelectedNodePkg != nil {
+		if tn, ok := r.SelectedNodePkg.ObjectOf(id).(*types.TypeName); ok {
+			if named, ok := types.Unalias(tn.Type()).(*types.Named); ok {
+				if types.IsInterface(named) {
+					r.iface = named.Obj()
+				}
+			}
+		}
+	}
+	if r.iface == nil {
+		r.Log.Error("Please select the name of an interface type.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	r.pkgInfo = r.Program.AllPackages[r.iface.Pkg()]
+	if r.pkgInfo != nil && !isInGoRoot(r.Program.Fset.Position(r.iface.Pos()).Filename) {
+		if file := fileContaining(r.pkgInfo, r.iface.Pos()); file != nil {
+			path, _ := astutil.PathEnclosingInterval(file, r.iface.Pos(), r.iface.Pos())
+			for i, node := range path {
+				if spec, ok := node.(*ast.TypeSpec); ok && i+1 < len(path) {
+					r.spec = spec
+					r.decl, _ = path[i+1].(*ast.GenDecl)
+					break
+				}
+			}
+		}
+	}
+	if r.decl == nil {
+		r.Log.Errorf("%s is not declared in the code being refactored, "+
+			"so it cannot be split", r.iface.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if r.spec.TypeParams != nil {
+		r.Log.Errorf("%s is generic, so it cannot be split",
+			r.iface.Name())
+		r.Log.AssociateNode(r.spec.Name)
+		return false
+	}
+	it, ok := r.spec.Type.(*ast.InterfaceType)
+	if !ok {
+		r.Log.Errorf("%s is not declared by an interface type literal, "+
+			"so it cannot be split", r.iface.Name())
+		r.Log.AssociateNode(r.spec.Name)
+		return false
+	}
+	for _, field := range it.Methods.List {
+		if len(field.Names) == 0 {
+			r.Log.Errorf("%s embeds %s; only interfaces declaring "+
+				"methods directly can be split", r.iface.Name(),
+				types.ExprString(field.Type))
+			r.Log.AssociateNode(field)
+			return false
+		}
+		r.methods = append(r.methods, field)
+		r.methodNames = append(r.methodNames, field.Names[0].Name)
+	}
+	return true
+}
+
+// findConsumers finds the parameters of the interface type that use a proper
+// subset of its methods.
+func (r *SegregateInterface) findConsumers() {
+	pkgs := r.migrationCandidates(func(string) bool { return false })
+	for _, pkgInfo := range pkgs {
+		r.findCallees(pkgInfo)
+	}
+	for _, pkgInfo := range pkgs {
+		for _, file := range pkgInfo.Files {
+			for _, d := range file.Decls {
+				decl, ok := d.(*ast.FuncDecl)
+				if !ok || decl.Body == nil || !r.canChange(pkgInfo, decl) {
+					continue
+				}
+				for _, field := range decl.Type.Params.List {
+					methods := r.methodsUsed(pkgInfo, decl, field)
+					if len(methods) > 0 && len(methods) < len(r.methods) {
+						r.consumers = append(r.consumers, &ifaceConsumer{
+							pkgInfo:  pkgInfo,
+							file:     file,
+							funcDecl: decl,
+							field:    field,
+							methods:  methods,
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// findCallees records the identifiers in the given package that are the
+// callee of a call expression (i.e., f in f(x) or x.f(y)).
+func (r *SegregateInterface) findCallees(pkgInfo *loader.PackageInfo) {
+	for _, file := range pkgInfo.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				switch fun := astutil.Unparen(call.Fun).(type) {
+				case *ast.Ident:
+					r.callees[fun] = true
+				case *ast.SelectorExpr:
+					r.callees[fun.Sel] = true
+				}
+			}
+			return true
+		})
+	}
+}
+
+// canChange returns true if the parameter types of the given function can be
+// changed without affecting anything but its callers, which can continue to
+// pass the same arguments.
+func (r *SegregateInterface) canChange(pkgInfo *loader.PackageInfo, decl *ast.FuncDecl) bool {
+	fn, ok := pkgInfo.Defs[decl.Name].(*types.Func)
+	if !ok || decl.Type.TypeParams != nil {
+		return false
+	}
+	if sig := fn.Type().(*types.Signature); sig.RecvTypeParams().Len() > 0 {
+		return false
+	}
+	if decl.Recv != nil && r.isInterfaceMethodName(fn.Name()) {
+		return false
+	}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for id, obj := range pkgInfo.Uses {
+			if obj == fn && !r.callees[id] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isInterfaceMethodName returns true if a named interface type in the program
+// has a method with the given name.
+func (r *SegregateInterface) isInterfaceMethodName(name string) bool {
+	for _, pkgInfo := range r.Program.AllPackages {
+		scope := pkgInfo.Pkg.Scope()
+		for _, n := range scope.Names() {
+			tn, ok := scope.Lookup(n).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			if it, ok := tn.Type().Underlying().(*types.Interface); ok {
+				for i := 0; i < it.NumMethods(); i++ {
+					if it.Method(i).Name() == name {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// methodsUsed returns the names of the interface's methods used by the
+// parameters declared by the given field, in declaration order, or nil if
+// they do not have the interface type or are used in any other way (e.g.,
+// passed to another function or assigned).
+func (r *SegregateInterface) methodsUsed(pkgInfo *loader.PackageInfo, decl *ast.FuncDecl, field *ast.Field) []string {
+	if t := pkgInfo.TypeOf(field.Type); t == nil || types.Unalias(t) != r.iface.Type() {
+		return nil
+	}
+	params := map[types.Object]bool{}
+	for _, name := range field.Names {
+		if obj := pkgInfo.Defs[name]; obj != nil && name.Name != "_" {
+			params[obj] = true
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+
+	used := map[string]bool{}
+	selected := map[*ast.Ident]bool{}
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && params[pkgInfo.Uses[x]] {
+			if s := pkgInfo.Selections[sel]; s != nil && s.Kind() == types.MethodVal {
+				used[sel.Sel.Name] = true
+				selected[x] = true
+			}
+		}
+		return true
+	})
+	for id, obj := range pkgInfo.Uses {
+		if params[obj] && !selected[id] {
+			return nil
+		}
+	}
+
+	result := []string{}
+	for _, name := range r.methodNames {
+		if used[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// chooseParts determines the interfaces to add and the interface each
+// consumer will use, returning false (after logging an error) if the name of
+// a new interface conflicts with an existing declaration.
+func (r *SegregateInterface) chooseParts() bool {
+	parts := map[string]*ifacePart{}
+	for _, c := range r.consumers {
+		name := r.iface.Name() + strings.Join(c.methods, "")
+		part, ok := parts[name]
+		if !ok {
+			if obj := r.iface.Pkg().Scope().Lookup(name); obj != nil {
+				r.Log.Errorf("The name %s is already declared in "+
+					"package %s", name, r.iface.Pkg().Name())
+				r.Log.AssociatePos(obj.Pos(), obj.Pos())
+				return false
+			}
+			part = &ifacePart{name: name, methods: c.methods}
+			parts[name] = part
+			r.parts = append(r.parts, part)
+		}
+		c.part = part
+		user := consumerName(c.funcDecl)
+		if len(part.users) == 0 || part.users[len(part.users)-1] != user {
+			part.users = append(part.users, user)
+		}
+	}
+	sort.SliceStable(r.parts, func(i, j int) bool {
+		return len(r.parts[i].methods) < len(r.parts[j].methods)
+	})
+	return true
+}
+
+// consumerName returns the name of the given function, or T.m for a method m
+// with receiver type T or *T.
+func consumerName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	t := decl.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	return types.ExprString(t) + "." + decl.Name.Name
+}
+
+// joinNames returns the given names as an English list, e.g., "f, g, and h".
+func joinNames(names []string) string {
+	switch len(names) {
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " and " + names[1]
+	}
+	last := len(names) - 1
+	return strings.Join(names[:last], ", ") + ", and " + names[last]
+}
+
+// rewriteInterface replaces the body of the original interface with the new
+// interfaces it embeds, followed by the methods none of them contain, and adds
+// the declarations of the new interfaces after it.  It returns false (after
+// logging an error) if the file cannot be read.
+func (r *SegregateInterface) rewriteInterface(config *Config) bool {
+	m := r.migration(config, r.pkgInfo, fileContaining(r.pkgInfo, r.decl.Pos()))
+	if m == nil {
+		return false
+	}
+
+	// Only embed the interfaces not contained in another one
+	covered := map[string]bool{}
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, part := range r.parts {
+		if !r.isContained(part, r.parts[i+1:]) {
+			fmt.Fprintf(&b, "\t%s\n", part.name)
+			for _, name := range part.methods {
+				covered[name] = true
+			}
+		}
+	}
+	for i, method := range r.methods {
+		if !covered[r.methodNames[i]] {
+			fmt.Fprintf(&b, "\t%s\n", r.methodText(m, method))
+		}
+	}
+	b.WriteString("}")
+	style := DetectIndentStyle(m.src)
+	it := r.spec.Type.(*ast.InterfaceType)
+	m.replace(it.Methods.Opening, it.Methods.Closing+1,
+		style.Reindent(b.String(), ""))
+
+	b.Reset()
+	for _, part := range r.parts {
+		fmt.Fprintf(&b, "\n\n// %s is the part of %s used by %s.\n",
+			part.name, r.iface.Name(), joinNames(part.users))
+		fmt.Fprintf(&b, "type %s interface {\n", part.name)
+		for i, method := range r.methods {
+			for _, name := range part.methods {
+				if name == r.methodNames[i] {
+					fmt.Fprintf(&b, "\t%s\n", r.methodText(m, method))
+				}
+			}
+		}
+		b.WriteString("}")
+	}
+	m.replace(r.decl.End(), r.decl.End(), style.Reindent(b.String(), ""))
+	return true
+}
+
+// isContained returns true if every method of the given interface is also
+// in one of the other interfaces.
+func (r *SegregateInterface) isContained(part *ifacePart, others []*ifacePart) bool {
+	for _, other := range others {
+		contained := true
+		for _, name := range part.methods {
+			found := false
+			for _, n := range other.methods {
+				found = found || n == name
+			}
+			contained = contained && found
+		}
+		if contained {
+			return true
+		}
+	}
+	return false
+}
+
+// methodText returns the source text of the given method declaration,
+// including its doc comment and line comment, if any.
+func (r *SegregateInterface) methodText(m *fileMigration, method *ast.Field) string {
+	start, end := method.Pos(), method.End()
+	if method.Doc != nil {
+		start = method.Doc.Pos()
+	}
+	if method.Comment != nil {
+		end = method.Comment.End()
+	}
+	return m.text(start, end)
+}
+
+const segregateInterfaceDoc = `
+  <h4>Purpose</h4>
+  <p>The Segregate Interface refactoring splits a large interface into
+  smaller interfaces, each containing only the methods used by some of the
+  functions that accept the interface as a parameter.  Functions that depend
+  on fewer methods are easier to reuse and to test, since they can be passed
+  any value that implements those methods.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of an interface type.</li>
+    <li>Activate the Segregate Interface refactoring.</li>
+  </ol>
+
+  <p>A parameter of the interface type is a <i>consumer</i> if the only
+  thing done with it is calling the interface's methods.  For each distinct
+  set of methods used by a consumer (other than all of them), a new interface
+  is added containing those methods; its name is the name of the original
+  interface followed by the names of the methods.  The consumer's type is
+  changed to the new interface.</p>
+
+  <p>The original interface is rewritten to embed the new interfaces, so it
+  still has the same methods, and all existing code that uses or implements it
+  is unaffected.</p>
+
+  <p>Parameters of functions that are used as values (rather than only being
+  called), generic functions, and methods that might implement an interface
+  are not changed.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of segregating the
+  <tt>Store</tt> interface.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type <span class="highlight">Store</span> interface {
+    Get(key string) string
+    Put(key, value string)
+}
+
+func show(s Store, key string) {
+    fmt.Println(s.Get(key))
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Store interface {
+    StoreGet
+    Put(key, value string)
+}
+
+// StoreGet is the part of Store used by show.
+type StoreGet interface {
+    Get(key string) string
+}
+
+func show(s StoreGet, key string) {
+    fmt.Println(s.Get(key))
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
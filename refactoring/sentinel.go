@@ -0,0 +1,554 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that replaces repeated error messages with
+// package-level sentinel errors.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// SentinelErrors is a refactoring that finds calls to errors.New and
+// fmt.Errorf that create errors with identical literal messages in several
+// places in a package, declares a package-level variable (a "sentinel error")
+// for each such message, and replaces the calls with references to the
+// variables.  Comparisons of the form err.Error() == "message" are replaced by
+// comparisons with the sentinel error.
+//
+// If the package already declares a variable initialized to an error with one
+// of the messages, that variable is used instead of declaring a new one, and
+// even a single call creating an error with its message is replaced.
+type SentinelErrors struct {
+	RefactoringBase
+	// The package being refactored
+	pkgInfo *loader.PackageInfo
+}
+
+// An errorMessage is a message for which a sentinel error will be used.
+type errorMessage struct {
+	// The message
+	text string
+	// Calls that create an error with this message
+	calls []*ast.CallExpr
+	// Comparisons of the form err.Error() == "message"
+	comparisons []*ast.BinaryExpr
+	// An existing package-level variable initialized to an error with
+	// this message, or nil
+	existing *types.Var
+	// The name of the sentinel error
+	name string
+}
+
+func (r *SentinelErrors) Description() *Description {
+	return &Description{
+		Name:           "Introduce Sentinel Errors",
+		Synopsis:       "Replaces repeated error messages with package-level error variables",
+		Usage:          "",
+		Selection:      "",
+		HTMLDoc:        sentinelErrorsDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *SentinelErrors) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.pkgInfo = r.SelectedNodePkg
+
+	messages := r.findMessages()
+	if len(messages) == 0 {
+		r.Log.Errorf("No error messages are repeated in package %s",
+			r.pkgInfo.Pkg.Name())
+		return &r.Result
+	}
+	r.findComparisons(messages)
+	r.chooseNames(messages)
+
+	imports := r.ImportResolver()
+	qualifier := r.addDeclarations(messages, imports)
+	removed := r.replaceCalls(messages)
+	r.replaceComparisons(messages)
+	r.removeUnusedImports(config, removed, qualifier)
+	if err := imports.AddEdits(r.Edits[r.Filename]); err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findMessages returns the error messages in the package for which sentinel
+// errors should be used, in the order they first appear.
+func (r *SentinelErrors) findMessages() []*errorMessage {
+	byText := map[string]*errorMessage{}
+	result := []*errorMessage{}
+	message := func(text string) *errorMessage {
+		if byText[text] == nil {
+			byText[text] = &errorMessage{text: text}
+			result = append(result, byText[text])
+		}
+		return byText[text]
+	}
+
+	// Find existing sentinel errors, which are not replaced
+	initializers := map[*ast.CallExpr]bool{}
+	for _, file := range r.pkgInfo.Files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if len(spec.Names) != len(spec.Values) {
+					continue
+				}
+				for i, value := range spec.Values {
+					call, ok := value.(*ast.CallExpr)
+					if !ok {
+						continue
+					}
+					text, ok := r.errorMessage(call)
+					v, isVar := r.pkgInfo.Defs[spec.Names[i]].(*types.Var)
+					if ok && isVar && spec.Names[i].Name != "_" {
+						initializers[call] = true
+						if m := message(text); m.existing == nil {
+							m.existing = v
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, file := range r.pkgInfo.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && !initializers[call] {
+				if text, ok := r.errorMessage(call); ok {
+					m := message(text)
+					m.calls = append(m.calls, call)
+				}
+			}
+			return true
+		})
+	}
+
+	repeated := []*errorMessage{}
+	for _, m := range result {
+		if len(m.calls) >= 2 || m.existing != nil && len(m.calls) >= 1 {
+			repeated = append(repeated, m)
+		}
+	}
+	return repeated
+}
+
+// errorMessage determines whether the given call is a call to errors.New or
+// fmt.Errorf with a constant message (which, for fmt.Errorf, contains no
+// formatting verbs).  If so, it returns the message and true.
+func (r *SentinelErrors) errorMessage(call *ast.CallExpr) (string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	fn, ok := r.pkgInfo.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return "", false
+	}
+	isErrorf := false
+	switch fn.Pkg().Path() + "." + fn.Name() {
+	case "errors.New":
+	case "fmt.Errorf":
+		isErrorf = true
+	default:
+		return "", false
+	}
+	tv := r.pkgInfo.Types[call.Args[0]]
+	if tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	text := constant.StringVal(tv.Value)
+	if isErrorf && strings.Contains(text, "%") {
+		return "", false
+	}
+	return text, true
+}
+
+// findComparisons finds comparisons of the form err.Error() == "message" or
+// err.Error() != "message" (with the operands in either order) for each of the
+// given messages.
+func (r *SentinelErrors) findComparisons(messages []*errorMessage) {
+	byText := map[string]*errorMessage{}
+	for _, m := range messages {
+		byText[m.text] = m
+	}
+	for _, file := range r.pkgInfo.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			binary, ok := n.(*ast.BinaryExpr)
+			if !ok || binary.Op != token.EQL && binary.Op != token.NEQ {
+				return true
+			}
+			_, lit := r.errorMethodCall(binary)
+			if lit == nil {
+				return true
+			}
+			tv := r.pkgInfo.Types[lit]
+			if tv.Value == nil || tv.Value.Kind() != constant.String {
+				return true
+			}
+			if m := byText[constant.StringVal(tv.Value)]; m != nil {
+				m.comparisons = append(m.comparisons, binary)
+			}
+			return true
+		})
+	}
+}
+
+// errorMethodCall determines whether one operand of the given binary
+// expression is a call to the Error method of a value implementing the error
+// interface.  If so, it returns that call and the other operand; otherwise,
+// it returns nil, nil.
+func (r *SentinelErrors) errorMethodCall(binary *ast.BinaryExpr) (*ast.CallExpr, ast.Expr) {
+	errorType := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	for _, operands := range [][2]ast.Expr{
+		{binary.X, binary.Y},
+		{binary.Y, binary.X},
+	} {
+		call, ok := operands[0].(*ast.CallExpr)
+		if !ok || len(call.Args) != 0 {
+			continue
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Error" {
+			continue
+		}
+		selection := r.pkgInfo.Selections[sel]
+		if selection == nil || selection.Kind() != types.MethodVal {
+			continue
+		}
+		if types.Implements(selection.Recv(), errorType) {
+			return call, operands[1]
+		}
+	}
+	return nil, nil
+}
+
+// chooseNames sets the name of each sentinel error.  An existing sentinel
+// error keeps its name.  For a new sentinel error, the name is derived from the
+// message (e.g., "file not found" becomes errFileNotFound) and, if necessary,
+// a number is appended so it does not conflict with any other name in the
+// package or any local name where it is used.
+func (r *SentinelErrors) chooseNames(messages []*errorMessage) {
+	chosen := map[string]bool{}
+	for _, m := range messages {
+		if m.existing != nil {
+			m.name = m.existing.Name()
+			continue
+		}
+		base := sentinelName(m.text)
+		m.name = base
+		for i := 2; chosen[m.name] || r.nameConflicts(m.name, m); i++ {
+			m.name = fmt.Sprintf("%s%d", base, i)
+		}
+		chosen[m.name] = true
+	}
+}
+
+// nameConflicts returns true if a package-level variable with the given name
+// would conflict with an existing declaration or would be shadowed where the
+// given message's sentinel error is used.
+func (r *SentinelErrors) nameConflicts(name string, m *errorMessage) bool {
+	if r.pkgInfo.Pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	for _, file := range r.pkgInfo.Files {
+		if scope := r.pkgInfo.Scopes[file]; scope != nil && scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	for _, pos := range m.positions() {
+		if scope := r.pkgInfo.Pkg.Scope().Innermost(pos); scope != nil {
+			if _, obj := scope.LookupParent(name, pos); obj != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// positions returns the positions of the calls and comparisons that will be
+// replaced by references to the sentinel error for this message.
+func (m *errorMessage) positions() []token.Pos {
+	result := []token.Pos{}
+	for _, call := range m.calls {
+		result = append(result, call.Pos())
+	}
+	for _, binary := range m.comparisons {
+		result = append(result, binary.Pos())
+	}
+	return result
+}
+
+// sentinelName returns a name for a sentinel error with the given message,
+// consisting of "err" followed by (up to) the first four words of the message
+// in camel case.
+func sentinelName(message string) string {
+	words := strings.FieldsFunc(message, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	if len(words) > 4 {
+		words = words[:4]
+	}
+	name := "err"
+	for _, word := range words {
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+	if name == "err" {
+		return "errSentinel"
+	}
+	return name
+}
+
+// addDeclarations adds a declaration of each new sentinel error to the file
+// containing the selection, following its imports.  It returns the name used
+// to refer to the errors package in that file.
+func (r *SentinelErrors) addDeclarations(messages []*errorMessage, imports *ImportResolver) string {
+	errorsPkg := types.NewPackage("errors", "errors")
+	qualifier, _ := imports.Qualify(errorsPkg, token.NoPos)
+
+	specs := []string{}
+	for _, m := range messages {
+		if m.existing == nil {
+			specs = append(specs, fmt.Sprintf("%s = %s.New(%s)",
+				m.name, qualifier, strconv.Quote(m.text)))
+		}
+	}
+	if len(specs) == 0 {
+		return qualifier
+	}
+
+	var decl bytes.Buffer
+	if len(specs) == 1 {
+		decl.WriteString("\n\nvar " + specs[0])
+	} else {
+		unit := DetectIndentStyle(r.FileContents).Unit
+		decl.WriteString("\n\nvar (\n")
+		for _, spec := range specs {
+			decl.WriteString(unit + spec + "\n")
+		}
+		decl.WriteString(")")
+	}
+
+	offset := r.OffsetOfPos(r.File.Name.End())
+	for _, d := range r.File.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			offset = r.OffsetOfPos(d.End())
+		}
+	}
+	if offset == r.OffsetOfPos(r.File.Name.End()) {
+		// Keep an import comment on the package clause line
+		if eol := bytes.IndexByte(r.FileContents[offset:], '\n'); eol >= 0 {
+			offset += eol
+		} else {
+			offset = len(r.FileContents)
+		}
+	}
+	r.addEdit(r.Filename, &text.Extent{Offset: offset, Length: 0},
+		decl.String())
+	return qualifier
+}
+
+// replaceCalls replaces each call creating an error with one of the given
+// messages with a reference to its sentinel error.  It returns the package
+// names (e.g., errors in errors.New) that are removed from the code as a
+// result.
+func (r *SentinelErrors) replaceCalls(messages []*errorMessage) map[*ast.Ident]bool {
+	removed := map[*ast.Ident]bool{}
+	for _, m := range messages {
+		for _, call := range m.calls {
+			if !r.isVisible(m, call.Pos()) {
+				continue
+			}
+			r.replace(call.Pos(), call.End(), m.name)
+			if id, ok := call.Fun.(*ast.SelectorExpr).X.(*ast.Ident); ok {
+				removed[id] = true
+			}
+		}
+	}
+	return removed
+}
+
+// replaceComparisons replaces comparisons of the form err.Error() == "message"
+// with err == sentinel.
+func (r *SentinelErrors) replaceComparisons(messages []*errorMessage) {
+	count := 0
+	for _, m := range messages {
+		for _, binary := range m.comparisons {
+			if !r.isVisible(m, binary.Pos()) {
+				continue
+			}
+			call, lit := r.errorMethodCall(binary)
+			receiver := call.Fun.(*ast.SelectorExpr).X
+			r.replace(receiver.End(), call.End(), "")
+			r.replace(lit.Pos(), lit.End(), m.name)
+			if count == 0 {
+				r.Log.Info("Error messages will be compared by identity; " +
+					"errors from other packages with the same message " +
+					"will no longer match")
+				r.Log.AssociateNode(binary)
+			}
+			count++
+		}
+	}
+}
+
+// isVisible returns true if the sentinel error for the given message can be
+// referred to at the given position.  This is always true for new sentinel
+// errors (see chooseNames); an existing sentinel error may be shadowed, in
+// which case a warning is logged.
+func (r *SentinelErrors) isVisible(m *errorMessage, pos token.Pos) bool {
+	if m.existing == nil {
+		return true
+	}
+	if scope := r.pkgInfo.Pkg.Scope().Innermost(pos); scope != nil {
+		if _, obj := scope.LookupParent(m.name, pos); obj != m.existing {
+			r.Log.Warnf("%s is not visible here, so it will not be used",
+				m.name)
+			r.Log.AssociatePos(pos, pos)
+			return false
+		}
+	}
+	return true
+}
+
+// removeUnusedImports removes imports that are no longer used after the
+// identifiers in removed are deleted.  In the file containing the selection,
+// the import named qualifier is retained, since it is used by the new
+// declarations.
+func (r *SentinelErrors) removeUnusedImports(config *Config, removed map[*ast.Ident]bool, qualifier string) {
+	for _, file := range r.pkgInfo.Files {
+		unused := unusedImports(r.pkgInfo, file, removed)
+		if len(unused) == 0 {
+			continue
+		}
+		filename := r.Program.Fset.Position(file.Package).Filename
+		src := readFile(config, filename)
+		if src == nil {
+			r.Log.Warnf("Unused imports could not be removed from %s",
+				filename)
+			continue
+		}
+		for _, spec := range unused {
+			pkgName := importedPkgName(r.pkgInfo, spec)
+			if file == r.File && pkgName.Name() == qualifier &&
+				pkgName.Imported().Path() == "errors" {
+				continue
+			}
+			r.deleteImport(r.Program.Fset, file, src, spec)
+		}
+	}
+}
+
+// replace adds an edit replacing the text from start to end with the given
+// string.
+func (r *SentinelErrors) replace(start, end token.Pos, replacement string) {
+	filename := r.Program.Fset.Position(start).Filename
+	offset := r.Program.Fset.Position(start).Offset
+	length := r.Program.Fset.Position(end).Offset - offset
+	r.addEdit(filename, &text.Extent{Offset: offset, Length: length},
+		replacement)
+}
+
+const sentinelErrorsDoc = `
+  <h4>Purpose</h4>
+  <p>The Introduce Sentinel Errors refactoring finds error messages that are
+  created in several places in a package (by calling <tt>errors.New</tt> or
+  <tt>fmt.Errorf</tt> with identical literal messages) and replaces them with
+  package-level error variables, which callers can compare errors against.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select any code in the package.</li>
+    <li>Activate the Introduce Sentinel Errors refactoring.</li>
+  </ol>
+
+  <p>A variable is declared for each repeated message in the file containing
+  the selection; its name is derived from the message.  Calls creating an error
+  with the message are replaced by references to the variable, and comparisons
+  of the form <tt>err.Error() == "message"</tt> are replaced by
+  <tt>err == variable</tt>.  If the package already declares a variable
+  initialized to an error with one of the messages, that variable is used
+  instead.  Calls to <tt>fmt.Errorf</tt> are only replaced if their messages
+  contain no formatting verbs.  Imports that are no longer used are
+  removed.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of the refactoring.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>package store
+
+import "errors"
+
+func Get(key string) error {
+    if key == "" {
+        return errors.New("empty key")
+    }
+    return nil
+}
+
+func Put(key string) error {
+    if key == "" {
+        return errors.New("empty key")
+    }
+    return nil
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>package store
+
+import "errors"
+
+var errEmptyKey = errors.New("empty key")
+
+func Get(key string) error {
+    if key == "" {
+        return errEmptyKey
+    }
+    return nil
+}
+
+func Put(key string) error {
+    if key == "" {
+        return errEmptyKey
+    }
+    return nil
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
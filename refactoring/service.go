@@ -0,0 +1,528 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that moves package-level variables into a
+// struct and converts the functions that use them into methods.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ExtractService is a refactoring that replaces the package-level variables
+// declared in the selected var declaration with the fields of a new struct,
+// converts every function in the package that refers to them into a method
+// of that struct, and declares a package-level instance of the struct (named
+// after it, e.g., defaultService for Service) that holds the variables'
+// initial values.
+//
+// References to the variables and calls to the converted functions are
+// rewritten to go through the receiver (within the converted functions) or
+// the package-level instance (elsewhere).
+type ExtractService struct {
+	RefactoringBase
+	// The selected var declaration
+	decl *ast.GenDecl
+	// The variables being replaced by fields
+	vars map[types.Object]bool
+	// The declarations of the functions being converted into methods, and
+	// the objects they declare, sorted by position
+	funcDecls []*ast.FuncDecl
+	funcs     map[types.Object]*ast.FuncDecl
+	// The names of the struct, its package-level instance, and the
+	// receiver of each method
+	structName, instanceName, recvName string
+}
+
+func (r *ExtractService) Description() *Description {
+	return &Description{
+		Name:      "Extract Service Struct",
+		Synopsis:  "Moves package-level variables and the functions using them into a struct",
+		Usage:     "<struct_name>",
+		Selection: "A package-level var declaration",
+		HTMLDoc:   extractServiceDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Struct Name:",
+			Prompt:       "Name for the struct holding the variables.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *ExtractService) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.structName = config.Args[0].(string)
+	r.vars = map[types.Object]bool{}
+	r.funcDecls = nil
+	r.funcs = map[types.Object]*ast.FuncDecl{}
+
+	if !r.findState() || !r.findFuncs() || !r.chooseNames() ||
+		!r.checkReferences() {
+		return &r.Result
+	}
+	r.Log.Infof("Converting %s to methods of %s", r.funcNames(),
+		r.structName)
+
+	if !r.replaceDecl(config) {
+		return &r.Result
+	}
+	for _, decl := range r.funcDecls {
+		m := r.migration(config, r.SelectedNodePkg,
+			fileContaining(r.SelectedNodePkg, decl.Pos()))
+		if m == nil {
+			return &r.Result
+		}
+		m.replace(decl.Name.Pos(), decl.Name.Pos(),
+			fmt.Sprintf("(%s *%s) ", r.recvName, r.structName))
+	}
+	r.rewriteReferences(config)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findState finds the selected var declaration and the variables it
+// declares, returning false (after logging an error) if the selection is not
+// a package-level var declaration whose variables can be moved into a struct.
+func (r *ExtractService) findState() bool {
+	for i, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.VAR {
+			if i+1 < len(r.PathEnclosingSelection) {
+				if _, ok := r.PathEnclosingSelection[i+1].(*ast.File); ok {
+					r.decl = decl
+				}
+			}
+			break
+		}
+	}
+	if r.decl == nil {
+		r.Log.Error("Please select a package-level var declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	for _, spec := range r.decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if len(spec.Values) != 0 && len(spec.Values) != len(spec.Names) {
+			r.Log.Error("Variables initialized by a function call " +
+				"returning multiple values cannot be moved into a " +
+				"struct")
+			r.Log.AssociateNode(spec)
+			return false
+		}
+		for _, name := range spec.Names {
+			obj := r.SelectedNodePkg.Defs[name]
+			if obj == nil || name.Name == "_" {
+				r.Log.Errorf("%s cannot be moved into a struct",
+					name.Name)
+				r.Log.AssociateNode(name)
+				return false
+			}
+			if obj.Exported() {
+				r.Log.Errorf("%s is exported, so it may be used by "+
+					"other packages; it cannot be moved into a "+
+					"struct", name.Name)
+				r.Log.AssociateNode(name)
+				return false
+			}
+			r.vars[obj] = true
+		}
+	}
+	return true
+}
+
+// findFuncs finds the functions in the package that refer to the variables,
+// returning false (after logging an error) if there are none or if any of
+// them cannot be converted into a method.
+func (r *ExtractService) findFuncs() bool {
+	for _, file := range r.SelectedNodePkg.Files {
+		for _, d := range file.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok || decl.Recv != nil || decl.Body == nil ||
+				!r.refersToVars(decl.Body) {
+				continue
+			}
+			if decl.Name.Name == "init" || decl.Name.Name == "main" {
+				continue
+			}
+			if decl.Type.TypeParams != nil {
+				r.Log.Errorf("%s is generic, so it cannot be "+
+					"converted into a method", decl.Name.Name)
+				r.Log.AssociateNode(decl.Name)
+				return false
+			}
+			r.funcDecls = append(r.funcDecls, decl)
+			r.funcs[r.SelectedNodePkg.Defs[decl.Name]] = decl
+		}
+	}
+	if len(r.funcDecls) == 0 {
+		r.Log.Error("No functions that could be converted into " +
+			"methods refer to the selected variables")
+		r.Log.AssociateNode(r.decl)
+		return false
+	}
+	sort.Slice(r.funcDecls, func(i, j int) bool {
+		return r.funcDecls[i].Pos() < r.funcDecls[j].Pos()
+	})
+	return true
+}
+
+// refersToVars returns true if the given node contains a reference to one of
+// the variables.
+func (r *ExtractService) refersToVars(node ast.Node) bool {
+	result := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && r.vars[r.SelectedNodePkg.Uses[id]] {
+			result = true
+		}
+		return !result
+	})
+	return result
+}
+
+// funcNames returns the names of the functions being converted, e.g.,
+// "f, g, and h".
+func (r *ExtractService) funcNames() string {
+	names := []string{}
+	for _, decl := range r.funcDecls {
+		names = append(names, decl.Name.Name)
+	}
+	switch len(names) {
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " and " + names[1]
+	}
+	last := len(names) - 1
+	return strings.Join(names[:last], ", ") + ", and " + names[last]
+}
+
+// chooseNames determines the names of the instance and the receiver,
+// returning false (after logging an error) if the struct's name is invalid or
+// any name would conflict with an existing declaration.
+func (r *ExtractService) chooseNames() bool {
+	if !isIdentifierValid(r.structName) || isReservedWord(r.structName) ||
+		r.structName == "_" {
+		r.Log.Errorf("The struct name \"%s\" is not a valid Go identifier",
+			r.structName)
+		r.Log.AssociateArg(0)
+		return false
+	}
+	r.instanceName = "default" + capitalize(r.structName)
+	r.recvName = strings.ToLower(r.structName[:1])
+	if r.recvName == "_" {
+		r.recvName = "s"
+	}
+
+	scope := r.SelectedNodePkg.Pkg.Scope()
+	for _, name := range []string{r.structName, r.instanceName} {
+		if obj := scope.Lookup(name); obj != nil {
+			r.Log.Errorf("The name %s is already declared in package %s",
+				name, r.SelectedNodePkg.Pkg.Name())
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+	}
+	for _, decl := range r.funcDecls {
+		if usesName(decl, r.recvName) {
+			r.Log.Errorf("%s already uses the name %s",
+				decl.Name.Name, r.recvName)
+			r.Log.AssociateNode(decl.Name)
+			return false
+		}
+	}
+	return true
+}
+
+// checkReferences returns false (after logging an error) if any of the
+// converted functions is used outside the package, or if the initial value
+// of a variable refers to another variable or a converted function (which
+// would not be accessible in the instance's composite literal).
+func (r *ExtractService) checkReferences() bool {
+	for _, pkgInfo := range r.Program.AllPackages {
+		if pkgInfo == r.SelectedNodePkg {
+			continue
+		}
+		for id, obj := range pkgInfo.Uses {
+			if _, ok := r.funcs[obj]; ok {
+				r.Log.Errorf("%s is used in package %s, so it cannot "+
+					"be converted into a method", id.Name,
+					pkgInfo.Pkg.Name())
+				r.Log.AssociateNode(id)
+				return false
+			}
+		}
+	}
+	for _, spec := range r.decl.Specs {
+		for _, value := range spec.(*ast.ValueSpec).Values {
+			ok := true
+			ast.Inspect(value, func(n ast.Node) bool {
+				if id, isIdent := n.(*ast.Ident); isIdent && ok {
+					obj := r.SelectedNodePkg.Uses[id]
+					if _, isFunc := r.funcs[obj]; isFunc || r.vars[obj] {
+						r.Log.Errorf("The initial value refers to "+
+							"%s, so it cannot be moved into the "+
+							"struct", id.Name)
+						r.Log.AssociateNode(id)
+						ok = false
+					}
+				}
+				return ok
+			})
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// replaceDecl replaces the var declaration with the declarations of the
+// struct and its package-level instance, returning false (after logging an
+// error) if its file cannot be read.
+func (r *ExtractService) replaceDecl(config *Config) bool {
+	m := r.migration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, r.decl.Pos()))
+	if m == nil {
+		return false
+	}
+	qualifier := m.imports.Qualifier(r.decl.Pos())
+
+	fields, values := [][]string{}, [][]string{}
+	for _, spec := range r.decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Doc != nil {
+			for _, c := range spec.Doc.List {
+				fields = append(fields, []string{c.Text})
+			}
+		}
+		// Without an explicit type, each variable may have a different
+		// type, so each is declared as a separate field
+		var specFields [][]string
+		if spec.Type != nil {
+			names := []string{}
+			for _, name := range spec.Names {
+				names = append(names, name.Name)
+			}
+			specFields = append(specFields, []string{
+				strings.Join(names, ", "), m.textOf(spec.Type)})
+		} else {
+			for _, name := range spec.Names {
+				t := r.SelectedNodePkg.Defs[name].Type()
+				specFields = append(specFields, []string{name.Name,
+					types.TypeString(types.Default(t), qualifier)})
+			}
+		}
+		if spec.Comment != nil {
+			last := len(specFields) - 1
+			specFields[last] = append(specFields[last],
+				m.textOf(spec.Comment))
+		}
+		fields = append(fields, specFields...)
+		for i, value := range spec.Values {
+			text := m.textOf(value)
+			if !r.decl.Lparen.IsValid() {
+				// Indent continuation lines as if in a var block
+				text = strings.Replace(text, "\n", "\n\t", -1)
+			}
+			values = append(values, []string{spec.Names[i].Name + ":",
+				text + ","})
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s holds the state used by %s.\n", r.structName,
+		r.funcNames())
+	fmt.Fprintf(&b, "type %s struct {\n", r.structName)
+	writeColumns(&b, "\t", fields)
+	b.WriteString("}\n\n")
+	fmt.Fprintf(&b, "var %s = &%s{", r.instanceName, r.structName)
+	if len(values) > 0 {
+		b.WriteString("\n")
+		writeColumns(&b, "\t", values)
+	}
+	b.WriteString("}")
+
+	var start ast.Node = r.decl
+	if r.decl.Doc != nil {
+		start = r.decl.Doc
+	}
+	code := DetectIndentStyle(m.src).Reindent(b.String(), "")
+	m.replace(start.Pos(), r.decl.End(), code)
+	return true
+}
+
+// writeColumns writes each row of cells on a separate line, preceded by the
+// given indentation, aligning the cells in columns as gofmt would.  A row
+// containing a multi-line cell is written without alignment, and only its
+// first line is indented.
+func writeColumns(b *bytes.Buffer, indent string, rows [][]string) {
+	var aligned bytes.Buffer
+	w := tabwriter.NewWriter(&aligned, 0, 8, 1, ' ', 0)
+	flush := func() {
+		w.Flush()
+		for _, line := range strings.SplitAfter(aligned.String(), "\n") {
+			if line != "" {
+				b.WriteString(indent + line)
+			}
+		}
+		aligned.Reset()
+	}
+	for _, row := range rows {
+		if line := strings.Join(row, "\t"); !strings.Contains(line, "\n") {
+			fmt.Fprintf(w, "%s\n", line)
+			continue
+		}
+		flush()
+		fmt.Fprintf(b, "%s%s\n", indent, strings.Join(row, " "))
+	}
+	flush()
+}
+
+// rewriteReferences replaces each reference to a variable or a converted
+// function in the package with a selector, through the receiver if the
+// reference is in a converted function and through the package-level instance
+// otherwise.
+func (r *ExtractService) rewriteReferences(config *Config) {
+	ids := []*ast.Ident{}
+	for id, obj := range r.SelectedNodePkg.Uses {
+		if _, ok := r.funcs[obj]; ok || r.vars[obj] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+	for _, id := range ids {
+		if id.Pos() >= r.decl.Pos() && id.End() <= r.decl.End() {
+			continue
+		}
+		qualifier := r.instanceName
+		for _, decl := range r.funcDecls {
+			if id.Pos() >= decl.Pos() && id.End() <= decl.End() {
+				qualifier = r.recvName
+			}
+		}
+		if qualifier == r.instanceName && !r.refersToInstance(id.Pos()) {
+			continue
+		}
+		m := r.migration(config, r.SelectedNodePkg,
+			fileContaining(r.SelectedNodePkg, id.Pos()))
+		if m == nil {
+			return
+		}
+		m.replace(id.Pos(), id.Pos(), qualifier+".")
+	}
+}
+
+// refersToInstance returns true if the instance's name would refer to the
+// package-level instance at the given position; otherwise, it logs an error
+// and returns false.
+func (r *ExtractService) refersToInstance(pos token.Pos) bool {
+	scope := r.SelectedNodePkg.Pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return true
+	}
+	if _, obj := scope.LookupParent(r.instanceName, pos); obj != nil {
+		r.Log.Errorf("The name %s would refer to a different "+
+			"declaration here", r.instanceName)
+		r.Log.AssociatePos(pos, pos)
+		return false
+	}
+	return true
+}
+
+const extractServiceDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Service Struct refactoring moves a group of package-level
+  variables into a new struct and converts the functions that use them into
+  methods of that struct.  This is a common first step in replacing a design
+  based on package-level (global) state with one in which the state can be
+  instantiated, e.g., so that it can be replaced in tests.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a package-level <tt>var</tt> declaration.  (To move several
+    variables, group them in a single <tt>var ( ... )</tt> declaration.)</li>
+    <li>Activate the Extract Service Struct refactoring.</li>
+    <li>Enter a name for the new struct.</li>
+  </ol>
+
+  <p>The variables become fields of the struct, and the declaration is
+  replaced by the struct's declaration and a package-level instance of it
+  (e.g., <tt>defaultService</tt> for a struct named <tt>Service</tt>), which
+  holds the variables' initial values.  Every function in the package that
+  refers to the variables (other than <tt>init</tt> and <tt>main</tt>) becomes
+  a method.  References within those methods go through the receiver;
+  references elsewhere in the package go through the package-level
+  instance.</p>
+
+  <p>An error is reported if a variable is exported, if one of the functions
+  is used by another package, or if a variable's initial value refers to
+  another of the variables or to one of the functions.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of extracting a service struct
+  named <tt>Counter</tt> from the highlighted declaration.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre><span class="highlight">var (
+    mu     sync.Mutex
+    counts = map[string]int{}
+)</span>
+
+func Add(key string) {
+    mu.Lock()
+    defer mu.Unlock()
+    counts[key]++
+}
+
+func main() {
+    Add("x")
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>// Counter holds the state used by Add.
+type Counter struct {
+    mu     sync.Mutex
+    counts map[string]int
+}
+
+var defaultCounter = &Counter{
+    counts: map[string]int{},
+}
+
+func (c *Counter) Add(key string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.counts[key]++
+}
+
+func main() {
+    defaultCounter.Add("x")
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,353 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that extracts each comment-delimited
+// section of a function's body into a new function.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+
+	"github.com/godoctor/godoctor/analysis/members"
+	"github.com/godoctor/godoctor/text"
+)
+
+// SplitFunction is a refactoring that extracts each section of the selected
+// function's body into a new function, as if Extract Function were applied
+// to each section in turn.  A section begins with a comment on a line by
+// itself, directly in the function's body (not in a nested block), and ends
+// just before the next such comment or at the end of the body.  Statements
+// before the first such comment remain in the function.
+//
+// Each new function is named after the words of its section's comment,
+// omitting articles (e.g., "// Read the config file" becomes readConfigFile).
+// The comments are left in place, above the calls that replace the sections.
+//
+// If the optional argument is true, the proposed decomposition is logged,
+// but the function is not changed.
+type SplitFunction struct {
+	ExtractFunc
+	decl     *ast.FuncDecl
+	sections []*funcSection
+	preview  bool
+}
+
+// A funcSection is a comment-delimited section of a function's body.
+type funcSection struct {
+	comment *ast.CommentGroup
+	// The statements in the section
+	stmts []ast.Stmt
+	// The name of the function the section is extracted into
+	name string
+}
+
+func (r *SplitFunction) Description() *Description {
+	return &Description{
+		Name:      "Split Function by Sections",
+		Synopsis:  "Extracts each comment-delimited section of a function into a new function",
+		Usage:     "[<preview_only?>]",
+		Selection: "A function declaration",
+		HTMLDoc:   splitFunctionDoc,
+		Multifile: false,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Preview Only:",
+			Prompt:       "Only list the functions that would be extracted.",
+			DefaultValue: false,
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *SplitFunction) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.preview = len(config.Args) > 0 && config.Args[0].(bool)
+	// Variables declared before a section may be used in later sections,
+	// so they must remain declared in the function
+	r.passConstants = true
+
+	if !r.findSections() || !r.checkNames() {
+		return &r.Result
+	}
+
+	imports := r.ImportResolver()
+	var decls bytes.Buffer
+	for _, s := range r.sections {
+		if !r.analyzeSection(s) {
+			return &r.Result
+		}
+		funcDecl, funcCall := r.createExtractedFunc(imports).SourceCode()
+		r.Log.Infof("%s: %s", s.name, funcCall)
+		r.Log.AssociatePos(s.stmts[0].Pos(), s.stmts[len(s.stmts)-1].End())
+		if r.preview {
+			continue
+		}
+		decls.WriteString(funcDecl)
+		r.Edits[r.Filename].Add(r.Extent(r.stmtRange), funcCall)
+	}
+	if r.preview {
+		return &r.Result
+	}
+
+	// Insert the new function declarations after the function, in order
+	next := r.OffsetOfPos(r.decl.End())
+	r.Edits[r.Filename].Add(&text.Extent{Offset: next, Length: 0},
+		decls.String())
+	if err := imports.AddEdits(r.Edits[r.Filename]); err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	r.FormatFileInEditor()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findSections finds the selected function and the sections of its body,
+// returning false (after logging an error) if there are none.
+func (r *SplitFunction) findSections() bool {
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			r.decl = decl
+			break
+		}
+	}
+	if r.decl == nil || r.decl.Body == nil {
+		r.Log.Error("Please select a function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	body := r.decl.Body.List
+	var current *funcSection
+	for _, cg := range r.File.Comments {
+		if cg.Pos() < r.decl.Body.Lbrace || cg.End() > r.decl.Body.Rbrace {
+			continue
+		}
+		i := 0
+		for i < len(body) && body[i].End() <= cg.Pos() {
+			i++
+		}
+		if i == len(body) || body[i].Pos() < cg.End() ||
+			!r.startsLine(cg, body[:i]) {
+			// The comment is after the last statement, inside a
+			// statement, or at the end of a line
+			continue
+		}
+		if current != nil && current.stmts[0] == body[i] {
+			// Only the first of several comments starts a section
+			continue
+		}
+		if current != nil {
+			current.stmts = current.stmts[:indexOfStmt(current.stmts, body[i])]
+		}
+		current = &funcSection{comment: cg, stmts: body[i:]}
+		r.sections = append(r.sections, current)
+	}
+	if len(r.sections) == 0 {
+		r.Log.Errorf("The body of %s does not contain any comments "+
+			"(on lines by themselves) that begin sections",
+			r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+	return true
+}
+
+// startsLine returns true if the given comment is not on the same line as the
+// end of the last of the given statements (or the function's opening brace).
+func (r *SplitFunction) startsLine(cg *ast.CommentGroup, before []ast.Stmt) bool {
+	prev := r.decl.Body.Lbrace
+	if len(before) > 0 {
+		prev = before[len(before)-1].End()
+	}
+	fset := r.Program.Fset
+	return fset.Position(cg.Pos()).Line > fset.Position(prev).Line
+}
+
+// indexOfStmt returns the index of the given statement in the list.
+func indexOfStmt(stmts []ast.Stmt, stmt ast.Stmt) int {
+	for i, s := range stmts {
+		if s == stmt {
+			return i
+		}
+	}
+	return len(stmts)
+}
+
+// sectionName returns a function name derived from the words in the given
+// comment, or "" if it contains no words.
+func sectionName(cg *ast.CommentGroup) string {
+	line := strings.SplitN(strings.TrimSpace(cg.Text()), "\n", 2)[0]
+	words := strings.FieldsFunc(line, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if word == "a" || word == "an" || word == "the" {
+			continue
+		}
+		if b.Len() == 0 {
+			if !unicode.IsLetter([]rune(word)[0]) {
+				continue
+			}
+			b.WriteString(word)
+		} else {
+			b.WriteString(capitalize(word))
+		}
+	}
+	return b.String()
+}
+
+// checkNames determines the name of the function for each section, returning
+// false (after logging an error) if any is invalid or would conflict with an
+// existing declaration.
+func (r *SplitFunction) checkNames() bool {
+	fn, _ := r.SelectedNodePkg.Defs[r.decl.Name].(*types.Func)
+	var recv types.Type
+	if fn != nil && fn.Type().(*types.Signature).Recv() != nil {
+		recv = fn.Type().(*types.Signature).Recv().Type()
+	}
+	names := map[string]bool{}
+	for _, s := range r.sections {
+		s.name = sectionName(s.comment)
+		if s.name == "" || isReservedWord(s.name) {
+			r.Log.Errorf("A function name could not be derived from the "+
+				"comment \"%s\"", strings.TrimSpace(s.comment.Text()))
+			r.Log.AssociateNode(s.comment)
+			return false
+		}
+		conflict := names[s.name] || usesName(r.decl, s.name)
+		if recv != nil {
+			conflict = conflict ||
+				members.Lookup(recv, r.SelectedNodePkg.Pkg, s.name) != nil
+		} else {
+			conflict = conflict ||
+				r.SelectedNodePkg.Pkg.Scope().Lookup(s.name) != nil
+		}
+		if conflict {
+			r.Log.Errorf("The name %s, derived from the comment \"%s\", "+
+				"is already used; please reword the comment", s.name,
+				strings.TrimSpace(s.comment.Text()))
+			r.Log.AssociateNode(s.comment)
+			return false
+		}
+		names[s.name] = true
+	}
+	return true
+}
+
+// analyzeSection prepares the embedded ExtractFunc to extract the given
+// section, returning false (after logging an error) if it cannot be extracted
+// without changing the function's behavior.
+func (r *SplitFunction) analyzeSection(s *funcSection) bool {
+	start, end := s.stmts[0].Pos(), s.stmts[len(s.stmts)-1].End()
+	var err error
+	r.funcName = s.name
+	r.stmtRange, err = newStmtRange(r.File, start, end, r.SelectedNodePkg)
+	if err != nil {
+		r.Log.Error(err)
+		r.Log.AssociatePos(start, end)
+		return false
+	}
+	problem := ""
+	switch {
+	case r.stmtRange.ContainsReturn():
+		problem = "contains a return statement"
+	case r.stmtRange.ContainsDefer():
+		problem = "contains a defer statement"
+	case len(r.stmtRange.EntryPoints()) > 1:
+		problem = "has multiple control flow paths into it"
+	case len(r.stmtRange.ExitDestinations()) > 1:
+		problem = "has multiple control flow paths out of it"
+	}
+	if problem != "" {
+		r.Log.Errorf("The section \"%s\" cannot be extracted because it %s",
+			strings.TrimSpace(s.comment.Text()), problem)
+		r.Log.AssociatePos(start, end)
+		return false
+	}
+	if r.stmtRange.ContainsAnonymousFunc() {
+		r.Log.Warnf("The section \"%s\" contains anonymous functions, "+
+			"which may not extract correctly",
+			strings.TrimSpace(s.comment.Text()))
+		r.Log.AssociatePos(start, end)
+	}
+	return true
+}
+
+const splitFunctionDoc = `
+  <h4>Purpose</h4>
+  <p>The Split Function by Sections refactoring breaks a long function whose
+  body is organized into sections, each introduced by a comment, into several
+  smaller functions.  Each section is extracted into a new function, exactly
+  as if the Extract Function refactoring were applied to it.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration.</li>
+    <li>Activate the Split Function by Sections refactoring.</li>
+    <li>Optionally, indicate that the proposed functions should only be
+    listed, not extracted.</li>
+  </ol>
+
+  <p>A section begins with a comment on a line by itself, directly in the
+  function's body, and extends to the next such comment or the end of the
+  body.  Each new function is named after the words in its section's comment,
+  omitting articles.  The refactoring fails if a section contains a
+  <tt>return</tt> or <tt>defer</tt> statement or is entered or exited by more
+  than one control flow path.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of splitting
+  <tt>run</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func <span class="highlight">run</span>(path string) {
+    // Read the input
+    data, _ := ioutil.ReadFile(path)
+    lines := strings.Split(string(data), "\n")
+
+    // Print lines
+    for _, line := range lines {
+        fmt.Println(line)
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func run(path string) {
+    // Read the input
+    lines := readInput(path)
+
+    // Print lines
+    printLines(lines)
+}
+
+func readInput(path string) []string {
+    data, _ := ioutil.ReadFile(path)
+    lines := strings.Split(string(data), "\n")
+    return lines
+}
+
+func printLines(lines []string) {
+    for _, line := range lines {
+        fmt.Println(line)
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,664 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that converts sections of a test function
+// into subtests.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// ConvertToSubtests is a refactoring that wraps sections of a test function
+// in calls to t.Run, so each section becomes a subtest.
+//
+// If statements in the body of the test function are selected, they become a
+// single subtest.  Otherwise, the body is split into sections at blank lines
+// and comments, and each section that uses t becomes a subtest (sections that
+// do not use t are assumed to be setup or teardown code, and they are left in
+// place).  Since t.Run does not return until the subtest is complete, the
+// statements still execute in the same order.  A subtest is named after the
+// comment preceding its section, if any.
+//
+// A section cannot become a subtest if it declares something that a later
+// section depends on, or if it contains a defer statement or a call to
+// t.Cleanup (which would run when the subtest completes, rather than the
+// test).  However, a variable that a later section only reuses, i.e., assigns
+// before reading it, does not prevent the conversion: the later section
+// declares its own variable with the same name instead.
+type ConvertToSubtests struct {
+	RefactoringBase
+	m *fileMigration
+	// The test function and its *testing.T (or *testing.B) parameter
+	decl *ast.FuncDecl
+	t    *types.Var
+	// The name of the subtest, if statements are selected
+	name     string
+	sections []*subtestSection
+}
+
+// A subtestSection is a sequence of statements in the body of a test function
+// that may be converted into a subtest.
+type subtestSection struct {
+	stmts []ast.Stmt
+	// The comment immediately preceding the statements, or nil
+	comment *ast.CommentGroup
+	// True if the section should become a subtest, if possible, and true if
+	// it will
+	candidate, wrap bool
+	// Edits to the statements
+	edits []regionEdit
+}
+
+func (s *subtestSection) Pos() token.Pos {
+	return s.stmts[0].Pos()
+}
+
+func (s *subtestSection) End() token.Pos {
+	return s.stmts[len(s.stmts)-1].End()
+}
+
+func (r *ConvertToSubtests) Description() *Description {
+	return &Description{
+		Name:      "Convert to Subtests",
+		Synopsis:  "Converts sections of a test function into subtests",
+		Usage:     "[<subtest_name>]",
+		Selection: "A test function, or a sequence of statements in one",
+		HTMLDoc:   convertToSubtestsDoc,
+		Multifile: false,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Subtest Name:",
+			Prompt:       "Name for the subtest, if statements are selected (leave blank to use the preceding comment).",
+			DefaultValue: "",
+		}},
+		Hidden: false,
+	}
+}
+
+func (r *ConvertToSubtests) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.name = ""
+	if len(config.Args) > 0 {
+		r.name = strings.TrimSpace(config.Args[0].(string))
+	}
+	if !r.findTest() {
+		return &r.Result
+	}
+	r.m = r.newFileMigration(config, r.SelectedNodePkg, r.File)
+	if r.m == nil {
+		return &r.Result
+	}
+
+	selected := r.selectedStmts()
+	if selected != nil {
+		r.sections = r.sectionsAround(selected)
+	} else {
+		r.sections = r.splitSections()
+	}
+	count := 0
+	for i, s := range r.sections {
+		s.wrap = s.candidate && r.canWrap(i, selected != nil)
+		if s.wrap {
+			count++
+		}
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if count == 0 {
+		r.Log.Errorf("No sections of %s can be converted to subtests",
+			r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Name)
+		return &r.Result
+	}
+	r.redeclare()
+	r.Log.Infof("Converting %d section(s) of %s to subtests", count,
+		r.decl.Name.Name)
+
+	names := map[string]bool{}
+	for _, s := range r.sections {
+		if !s.wrap {
+			for _, e := range s.edits {
+				r.m.replace(e.start, e.end, e.replacement)
+			}
+			continue
+		}
+		r.wrap(s, r.subtestName(s, len(names)+1, names))
+	}
+	r.m.finish()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findTest finds the function declaration enclosing the selection and its
+// *testing.T (or *testing.B) parameter, returning false (after logging an
+// error) if there is none.
+func (r *ConvertToSubtests) findTest() bool {
+	r.decl, r.t = nil, nil
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			r.decl = decl
+			break
+		}
+	}
+	if r.decl == nil || r.decl.Body == nil {
+		r.Log.Error("Please select a test function, or statements in one.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if r.t = testingParam(r.SelectedNodePkg, r.decl.Type); r.t == nil {
+		r.Log.Errorf("%s does not have a named parameter of type "+
+			"*testing.T or *testing.B", r.decl.Name.Name)
+		r.Log.AssociateNode(r.decl.Type)
+		return false
+	}
+	return true
+}
+
+// selectedStmts returns the statements in the body of the test function that
+// are entirely within the selection, or nil if there are none or if every
+// statement is selected (so the body should be split into sections).
+func (r *ConvertToSubtests) selectedStmts() []ast.Stmt {
+	var result []ast.Stmt
+	for _, stmt := range r.decl.Body.List {
+		if r.SelectionStart <= stmt.Pos() && stmt.End() <= r.SelectionEnd {
+			result = append(result, stmt)
+		}
+	}
+	if len(result) == len(r.decl.Body.List) {
+		return nil
+	}
+	return result
+}
+
+// sectionsAround returns a section containing the given statements, which
+// will become a subtest, together with sections containing the statements
+// before and after them.
+func (r *ConvertToSubtests) sectionsAround(selected []ast.Stmt) []*subtestSection {
+	body := r.decl.Body
+	result := []*subtestSection{}
+	first, last := selected[0].Pos(), selected[len(selected)-1].End()
+	before, after := &subtestSection{}, &subtestSection{}
+	for _, stmt := range body.List {
+		if stmt.Pos() < first {
+			before.stmts = append(before.stmts, stmt)
+		} else if stmt.Pos() >= last {
+			after.stmts = append(after.stmts, stmt)
+		}
+	}
+	prev := body.Lbrace
+	if len(before.stmts) > 0 {
+		result = append(result, before)
+		prev = before.End()
+	}
+	comment, _ := r.gap(prev, first)
+	result = append(result, &subtestSection{
+		stmts:     selected,
+		comment:   comment,
+		candidate: true,
+	})
+	if len(after.stmts) > 0 {
+		result = append(result, after)
+	}
+	return result
+}
+
+// splitSections splits the body of the test function into sections separated
+// by blank lines and comments.
+func (r *ConvertToSubtests) splitSections() []*subtestSection {
+	result := []*subtestSection{}
+	var current *subtestSection
+	prev := r.decl.Body.Lbrace
+	for _, stmt := range r.decl.Body.List {
+		comment, boundary := r.gap(prev, stmt.Pos())
+		if current == nil || boundary {
+			current = &subtestSection{comment: comment, candidate: true}
+			result = append(result, current)
+		}
+		current.stmts = append(current.stmts, stmt)
+		prev = stmt.End()
+	}
+	return result
+}
+
+// gap examines the source code between a statement (or the opening brace of
+// the function body) ending at prev and a statement beginning at next.  It
+// returns the comment on the line(s) immediately preceding next, if any, and
+// true if the statements are separated by a blank line or a comment.
+func (r *ConvertToSubtests) gap(prev, next token.Pos) (*ast.CommentGroup, bool) {
+	var comment *ast.CommentGroup
+	boundary := false
+	for _, cg := range r.File.Comments {
+		if prev < cg.Pos() && cg.End() <= next &&
+			r.line(cg.Pos()) > r.line(prev) {
+			boundary = true
+			if r.line(cg.End())+1 == r.line(next) {
+				comment = cg
+			}
+		}
+	}
+	lines := strings.Split(r.m.text(prev, next), "\n")
+	for i := 1; i < len(lines)-1; i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			boundary = true
+		}
+	}
+	return comment, boundary
+}
+
+// canWrap determines whether the section with the given index can become a
+// subtest.  If explicit is true, the section was selected, and an error is
+// logged if it cannot; otherwise, sections that do not use t are skipped, and
+// an informational message is logged for other sections that cannot become
+// subtests.
+func (r *ConvertToSubtests) canWrap(index int, explicit bool) bool {
+	s := r.sections[index]
+	if !explicit && !r.uses(s.stmts, r.t) {
+		return false
+	}
+	reject := func(node ast.Node, reason string) bool {
+		if explicit {
+			r.Log.Error("The selected statements cannot be converted " +
+				"to a subtest: " + reason)
+		} else {
+			r.Log.Info("This section was not converted to a " +
+				"subtest: " + reason)
+		}
+		r.Log.AssociateNode(node)
+		return false
+	}
+	if node, reason := r.findExit(s); node != nil {
+		return reject(node, reason)
+	}
+	for _, stmt := range s.stmts {
+		for _, id := range r.assignedNames(stmt) {
+			obj := r.SelectedNodePkg.ObjectOf(id)
+			if obj == nil || obj.Name() == "_" {
+				continue
+			}
+			_, isVar := obj.(*types.Var)
+			for _, later := range r.sections[index+1:] {
+				if r.uses(later.stmts, obj) &&
+					(!isVar || r.escapes(s, obj) ||
+						r.firstWrite(later, obj) == nil) {
+					return reject(id, fmt.Sprintf("%s is used by "+
+						"a later section of the test", id.Name))
+				}
+			}
+		}
+	}
+	return true
+}
+
+// findExit returns a statement in the given section (and a description of
+// the problem) whose behavior would change inside a subtest: a return
+// statement, a defer statement, a call to t.Cleanup, a label, or a goto
+// statement.  It returns nil if there is none.  Function literals are not
+// examined.
+func (r *ConvertToSubtests) findExit(s *subtestSection) (ast.Node, string) {
+	var node ast.Node
+	var reason string
+	for _, stmt := range s.stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if node != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				node, reason = n, "a return statement would only end "+
+					"the subtest, not the test"
+			case *ast.DeferStmt:
+				node, reason = n, "a deferred call would run at the "+
+					"end of the subtest, not the test"
+			case *ast.LabeledStmt:
+				node, reason = n, "it contains a label"
+			case *ast.BranchStmt:
+				if n.Tok == token.GOTO {
+					node, reason = n, "it contains a goto statement"
+				}
+			case *ast.CallExpr:
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok &&
+					sel.Sel.Name == "Cleanup" && r.isT(sel.X) {
+					node, reason = n, "a cleanup function would run "+
+						"at the end of the subtest, not the test"
+				}
+			}
+			return node == nil
+		})
+	}
+	return node, reason
+}
+
+// isT returns true if the given expression is the test's *testing.T (or
+// *testing.B) parameter.
+func (r *ConvertToSubtests) isT(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && r.SelectedNodePkg.Uses[id] == r.t
+}
+
+// assignedNames returns the identifiers declared by the given statement in
+// the body of the test function, together with the identifiers of existing
+// variables that are redeclared by a short variable declaration (which will
+// refer to new variables inside a subtest).
+func (r *ConvertToSubtests) assignedNames(stmt ast.Stmt) []*ast.Ident {
+	result := []*ast.Ident{}
+	switch stmt := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmt.Tok == token.DEFINE {
+			for _, lhs := range stmt.Lhs {
+				result = append(result, lhs.(*ast.Ident))
+			}
+		}
+	case *ast.DeclStmt:
+		for _, spec := range stmt.Decl.(*ast.GenDecl).Specs {
+			result = append(result, specNames(spec)...)
+		}
+	}
+	return result
+}
+
+// uses returns true if the given statements refer to the given object.
+func (r *ConvertToSubtests) uses(stmts []ast.Stmt, obj types.Object) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok &&
+				r.SelectedNodePkg.Uses[id] == obj {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// escapes returns true if the given variable is referenced by a function
+// literal or has its address taken in the given section, so its value may be
+// read after the section.
+func (r *ConvertToSubtests) escapes(s *subtestSection, obj types.Object) bool {
+	found := false
+	for _, stmt := range s.stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				found = found || r.uses(n.Body.List, obj)
+			case *ast.UnaryExpr:
+				if id, ok := ast.Unparen(n.X).(*ast.Ident); ok &&
+					n.Op == token.AND && r.SelectedNodePkg.Uses[id] == obj {
+					found = true
+				}
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// firstWrite returns the assignment that assigns a value to the given
+// variable before anything else in the given section refers to it, or nil if
+// there is none.  The assignment must be one of the statements in the
+// section, and the variable must appear on its left-hand side by itself.
+func (r *ConvertToSubtests) firstWrite(s *subtestSection, obj types.Object) *ast.AssignStmt {
+	for _, stmt := range s.stmts {
+		if !r.uses([]ast.Stmt{stmt}, obj) {
+			continue
+		}
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.ASSIGN {
+			return nil
+		}
+		count := 0
+		ast.Inspect(assign, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok &&
+				r.SelectedNodePkg.Uses[id] == obj {
+				count++
+			}
+			return true
+		})
+		for _, lhs := range assign.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && count == 1 &&
+				r.SelectedNodePkg.Uses[id] == obj {
+				return assign
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// redeclare records edits so that each variable declared in a subtest and
+// reused by a later section is declared again in that section (or, if that
+// section is not a subtest, in the first such section that is not a
+// subtest).  An assignment to such variables becomes a short variable
+// declaration if it assigns values of the same types to all of them;
+// otherwise, var declarations are inserted before it.
+func (r *ConvertToSubtests) redeclare() {
+	type key struct {
+		s      *subtestSection
+		assign *ast.AssignStmt
+	}
+	vars := map[key][]types.Object{}
+	keys := []key{}
+	for i, s := range r.sections {
+		if !s.wrap {
+			continue
+		}
+		for _, stmt := range s.stmts {
+			for _, id := range r.assignedNames(stmt) {
+				obj := r.SelectedNodePkg.Defs[id]
+				if obj == nil || obj.Name() == "_" {
+					continue
+				}
+				declaredAtTop := false
+				for _, later := range r.sections[i+1:] {
+					if !r.uses(later.stmts, obj) ||
+						(!later.wrap && declaredAtTop) {
+						continue
+					}
+					declaredAtTop = declaredAtTop || !later.wrap
+					k := key{later, r.firstWrite(later, obj)}
+					if vars[k] == nil {
+						keys = append(keys, k)
+					}
+					vars[k] = append(vars[k], obj)
+				}
+			}
+		}
+	}
+	for _, k := range keys {
+		assign := k.assign
+		if r.canDefine(assign, vars[k]) {
+			k.s.edits = append(k.s.edits, regionEdit{assign.TokPos,
+				assign.TokPos + token.Pos(len(token.ASSIGN.String())),
+				token.DEFINE.String()})
+			continue
+		}
+		indent := Indentation(r.m.src, r.m.offset(assign.Pos()))
+		qualifier := r.m.imports.Qualifier(assign.Pos())
+		var b strings.Builder
+		for _, obj := range vars[k] {
+			b.WriteString("var " + obj.Name() + " " +
+				types.TypeString(obj.Type(), qualifier) + "\n" + indent)
+		}
+		k.s.edits = append(k.s.edits,
+			regionEdit{assign.Pos(), assign.Pos(), b.String()})
+	}
+}
+
+// canDefine returns true if the given assignment can become a short variable
+// declaration of the given variables: every variable on its left-hand side
+// is one of them (or blank), and the type of each value is the same as the
+// type of the variable.
+func (r *ConvertToSubtests) canDefine(assign *ast.AssignStmt, vars []types.Object) bool {
+	valueType := func(i int) types.Type {
+		if len(assign.Rhs) == len(assign.Lhs) {
+			tv := r.SelectedNodePkg.Types[assign.Rhs[i]]
+			if tv.Value != nil {
+				// The type of an untyped constant depends on
+				// its context
+				return nil
+			}
+			return tv.Type
+		}
+		if tuple, ok := r.SelectedNodePkg.TypeOf(assign.Rhs[0]).(*types.Tuple); ok {
+			return tuple.At(i).Type()
+		}
+		return nil
+	}
+	for i, lhs := range assign.Lhs {
+		id, ok := lhs.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		if id.Name == "_" {
+			continue
+		}
+		obj := r.SelectedNodePkg.Uses[id]
+		found := false
+		for _, v := range vars {
+			found = found || v == obj
+		}
+		if t := valueType(i); !found || t == nil ||
+			!types.Identical(t, obj.Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+// subtestName returns the name for the subtest created from the given
+// section, which is the nth subtest, and adds it to the given set of names
+// that have been used.
+func (r *ConvertToSubtests) subtestName(s *subtestSection, n int, used map[string]bool) string {
+	name := ""
+	if r.name != "" {
+		name = r.name
+	} else if s.comment != nil {
+		name = strings.SplitN(strings.TrimSpace(s.comment.Text()), "\n", 2)[0]
+		name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	}
+	if name == "" {
+		name = fmt.Sprintf("part %d", n)
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// wrap replaces the statements in the given section with a call to t.Run
+// that executes them in a subtest with the given name.
+func (r *ConvertToSubtests) wrap(s *subtestSection, name string) {
+	start, end := s.Pos(), s.End()
+	// Include a comment at the end of the last statement
+	for _, cg := range r.File.Comments {
+		if cg.Pos() >= end && r.line(cg.Pos()) == r.line(end) {
+			end = maxPos(end, cg.End())
+		}
+	}
+	indent := Indentation(r.m.src, r.m.offset(start))
+	inner := indent + DetectIndentStyle(r.m.src).Unit
+	code := applyEdits(r.m.text(start, end), start, s.edits)
+	t := r.t.Name()
+	r.m.replace(start, end, fmt.Sprintf("%s.Run(%s, func(%s %s) {\n%s%s\n%s})",
+		t, strconv.Quote(name), t,
+		types.TypeString(r.t.Type(), r.m.imports.Qualifier(start)),
+		inner, shiftIndentation(code, indent, inner), indent))
+}
+
+const convertToSubtestsDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert to Subtests refactoring wraps sections of a long test
+  function in calls to <tt>t.Run</tt>, so each section becomes a subtest that
+  can be run (and can fail) independently.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a test function (or place the cursor on its name), or select a
+    sequence of statements in its body.</li>
+    <li>Activate the Convert to Subtests refactoring.</li>
+    <li>Optionally, if statements are selected, enter a name for the
+    subtest.</li>
+  </ol>
+
+  <p>If statements are selected, they become a single subtest.  Otherwise,
+  the body of the function is split into sections at blank lines and
+  comments, and each section that uses <tt>t</tt> becomes a subtest; sections
+  that do not use <tt>t</tt> are assumed to be setup or teardown code and are
+  left in place.  Since <tt>t.Run</tt> waits for the subtest to complete, the
+  statements are still executed in the same order.  Each subtest is named
+  after the comment preceding its section, if any.</p>
+
+  <p>A section cannot become a subtest if it declares something that a later
+  section depends on, or if it contains a return statement, a defer
+  statement, or a call to <tt>t.Cleanup</tt>.  If a later section only
+  reuses a variable declared in a subtest (assigning it a new value before
+  reading it), it declares its own variable with the same name instead.
+  Note that a fatal failure in a subtest does not stop the remaining
+  subtests.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of converting
+  <tt>TestParse</tt> to subtests.  The first section does not use <tt>t</tt>,
+  so it is left in place.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func TestParse(t *testing.T) {
+    p := newParser()
+
+    // valid input
+    got, err := p.parse("1")
+    if err != nil || got != 1 {
+        t.Errorf("got %d, %v", got, err)
+    }
+
+    // invalid input
+    _, err = p.parse("x")
+    if err == nil {
+        t.Error("expected an error")
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func TestParse(t *testing.T) {
+    p := newParser()
+
+    // valid input
+    t.Run("valid input", func(t *testing.T) {
+        got, err := p.parse("1")
+        if err != nil || got != 1 {
+            t.Errorf("got %d, %v", got, err)
+        }
+    })
+
+    // invalid input
+    t.Run("invalid input", func(t *testing.T) {
+        _, err := p.parse("x")
+        if err == nil {
+            t.Error("expected an error")
+        }
+    })
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
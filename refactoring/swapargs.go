@@ -0,0 +1,389 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that swaps two arguments of a call and the
+// corresponding parameters of the function being called.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// SwapArguments is a refactoring that swaps the two selected arguments of a
+// call.  If the function being called is declared in the code being
+// refactored, the corresponding parameters are swapped in its declaration,
+// and the arguments are swapped in every call to it, so the behavior of the
+// program is unchanged.  Otherwise, only the selected call is changed, and a
+// warning is logged, since the function will receive its arguments in a
+// different order.
+//
+// Swapping two arguments changes the order in which they are evaluated, so
+// the refactoring fails if they may depend on each other (see
+// MoveStatement).
+type SwapArguments struct {
+	RefactoringBase
+	// The function being called, or nil if it is not a declared function
+	fn *types.Func
+	// The declaration of fn, if it is declared in the code being refactored
+	decl *ast.FuncDecl
+	// The indices of the arguments to swap (i < j)
+	i, j int
+}
+
+func (r *SwapArguments) Description() *Description {
+	return &Description{
+		Name:           "Swap Arguments",
+		Synopsis:       "Swaps two arguments of a call and the callee's parameters",
+		Usage:          "",
+		Selection:      "Two arguments of a function call",
+		HTMLDoc:        swapArgumentsDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *SwapArguments) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	call := r.selectedCall()
+	if call == nil {
+		r.Log.Error("Please select two arguments of a function call.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	r.findCallee(call)
+
+	if r.decl == nil {
+		if !r.swapArgs(config, r.SelectedNodePkg, r.File, call) {
+			return &r.Result
+		}
+		name := types.ExprString(call.Fun)
+		r.Log.Warnf("%s is not declared in the code being refactored, "+
+			"so its parameters cannot be swapped; it will receive these "+
+			"arguments in a different order", name)
+		r.Log.AssociateNode(call)
+	} else {
+		if !r.checkCallee() {
+			return &r.Result
+		}
+		r.swapParams(config)
+		for _, ref := range r.references() {
+			call := callOf(ref)
+			if !r.swapArgs(config, ref.pkgInfo, ref.file, call) {
+				return &r.Result
+			}
+		}
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedCall returns the innermost call such that the selection begins in
+// one of its arguments and ends in a later argument, setting r.i and r.j to
+// their indices, or nil if there is no such call.
+func (r *SwapArguments) selectedCall() *ast.CallExpr {
+	for _, node := range r.PathEnclosingSelection {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		r.i, r.j = -1, -1
+		for k, arg := range call.Args {
+			if arg.Pos() <= r.SelectionStart && r.SelectionStart < arg.End() {
+				r.i = k
+			}
+			if arg.Pos() < r.SelectionEnd && r.SelectionEnd <= arg.End() {
+				r.j = k
+			}
+		}
+		if r.i >= 0 && r.i < r.j {
+			return call
+		}
+	}
+	return nil
+}
+
+// findCallee sets r.fn to the function called by the given call (if it is a
+// function or method declared in some package) and r.decl to its declaration
+// (if it is declared outside $GOROOT in the code being refactored).
+func (r *SwapArguments) findCallee(call *ast.CallExpr) {
+	var id *ast.Ident
+	switch fun := astutil.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		if sel := r.SelectedNodePkg.Selections[fun]; sel != nil &&
+			sel.Kind() != types.MethodVal {
+			return
+		}
+		id = fun.Sel
+	default:
+		return
+	}
+	r.fn, _ = r.SelectedNodePkg.Uses[id].(*types.Func)
+	if r.fn == nil || r.fn.Pkg() == nil {
+		return
+	}
+	pkgInfo := r.Program.AllPackages[r.fn.Pkg()]
+	if pkgInfo == nil {
+		return
+	}
+	for _, file := range pkgInfo.Files {
+		filename := r.Program.Fset.Position(file.Package).Filename
+		if isInGoRoot(filename) {
+			return
+		}
+		for _, decl := range file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok &&
+				pkgInfo.Defs[decl.Name] == r.fn && decl.Body != nil {
+				r.decl = decl
+				return
+			}
+		}
+	}
+}
+
+// checkCallee returns true if the parameters of the callee can be swapped;
+// otherwise, it logs an error and returns false.
+func (r *SwapArguments) checkCallee() bool {
+	sig := r.fn.Type().(*types.Signature)
+	if sig.Variadic() && r.j == sig.Params().Len()-1 {
+		r.Log.Errorf("The variadic parameter of %s cannot be moved",
+			r.fn.Name())
+		r.Log.AssociateNode(r.decl.Name)
+		return false
+	}
+	if sig.Recv() != nil {
+		if iface := r.interfaceDeclaring(r.fn.Name()); iface != nil {
+			r.Log.Errorf("The parameters of %s cannot be swapped because "+
+				"an interface (%s) declares a method with the same name",
+				r.fn.Name(), iface.Name())
+			r.Log.AssociatePos(iface.Pos(), iface.Pos())
+			return false
+		}
+	}
+	for _, ref := range r.references() {
+		call := callOf(ref)
+		if call == nil || len(call.Args) <= r.j {
+			r.Log.Errorf("The parameters of %s cannot be swapped because "+
+				"it is not called directly, with an argument for each "+
+				"parameter", r.fn.Name())
+			r.Log.AssociateNode(ref.id)
+			return false
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+			if s := ref.pkgInfo.Selections[sel]; s != nil &&
+				s.Kind() == types.MethodExpr {
+				r.Log.Errorf("The parameters of %s cannot be swapped "+
+					"because it is used as a method expression",
+					r.fn.Name())
+				r.Log.AssociateNode(ref.id)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// interfaceDeclaring returns an interface type declared outside $GOROOT in
+// the code being refactored that has a method with the given name, or nil.
+func (r *SwapArguments) interfaceDeclaring(name string) *types.TypeName {
+	for _, pkgInfo := range r.Program.AllPackages {
+		if len(pkgInfo.Files) == 0 || isInGoRoot(
+			r.Program.Fset.Position(pkgInfo.Files[0].Package).Filename) {
+			continue
+		}
+		for _, obj := range pkgInfo.Defs {
+			tn, ok := obj.(*types.TypeName)
+			if !ok {
+				continue
+			}
+			if iface, ok := tn.Type().Underlying().(*types.Interface); ok {
+				for k := 0; k < iface.NumMethods(); k++ {
+					if iface.Method(k).Name() == name {
+						return tn
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// references returns every use of the callee in the program, in order.
+func (r *SwapArguments) references() []*reference {
+	result := []*reference{}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for id, obj := range pkgInfo.Uses {
+			if obj != r.fn {
+				continue
+			}
+			file := fileContaining(pkgInfo, id.Pos())
+			if file == nil {
+				continue
+			}
+			path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+			result = append(result, &reference{pkgInfo, file, id, path[1:]})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id.Pos() < result[j].id.Pos()
+	})
+	return result
+}
+
+// swapArgs swaps the arguments of the given call, returning false (after
+// logging an error) if they cannot be swapped.
+func (r *SwapArguments) swapArgs(config *Config, pkgInfo *loader.PackageInfo, file *ast.File, call *ast.CallExpr) bool {
+	a, b := call.Args[r.i], call.Args[r.j]
+	effectsA, effectsB := effectsOf(pkgInfo, a), effectsOf(pkgInfo, b)
+	reason := effectsA.conflict(effectsB)
+	// The arguments between them are evaluated before b and after a
+	for _, arg := range call.Args[r.i+1 : r.j] {
+		if reason != "" {
+			break
+		}
+		between := effectsOf(pkgInfo, arg)
+		if reason = effectsA.conflict(between); reason == "" {
+			reason = effectsB.conflict(between)
+		}
+	}
+	if reason != "" {
+		r.Log.Errorf("The arguments cannot be swapped because %s", reason)
+		r.Log.AssociateNode(call)
+		return false
+	}
+	m := r.migration(config, pkgInfo, file)
+	if m == nil {
+		return false
+	}
+	textA, textB := m.textOf(a), m.textOf(b)
+	m.replace(a.Pos(), a.End(), textB)
+	m.replace(b.Pos(), b.End(), textA)
+	return true
+}
+
+// A paramEntry is a parameter in a function declaration.
+type paramEntry struct {
+	field *ast.Field
+	// The parameter's name, or nil if it is unnamed
+	name *ast.Ident
+}
+
+// paramEntries returns the parameters declared in the given function.
+func paramEntries(decl *ast.FuncDecl) []paramEntry {
+	result := []paramEntry{}
+	for _, field := range decl.Type.Params.List {
+		if len(field.Names) == 0 {
+			result = append(result, paramEntry{field, nil})
+		}
+		for _, name := range field.Names {
+			result = append(result, paramEntry{field, name})
+		}
+	}
+	return result
+}
+
+// swapParams swaps the parameters of the callee's declaration.
+func (r *SwapArguments) swapParams(config *Config) {
+	pkgInfo := r.Program.AllPackages[r.fn.Pkg()]
+	m := r.migration(config, pkgInfo, fileContaining(pkgInfo, r.decl.Pos()))
+	if m == nil {
+		return
+	}
+	params := paramEntries(r.decl)
+	a, b := params[r.i], params[r.j]
+	switch {
+	case a.field == b.field:
+		// Parameters with the same type: swap the names
+		m.replace(a.name.Pos(), a.name.End(), b.name.Name)
+		m.replace(b.name.Pos(), b.name.End(), a.name.Name)
+	case len(a.field.Names) <= 1 && len(b.field.Names) <= 1:
+		textA, textB := m.textOf(a.field), m.textOf(b.field)
+		m.replace(a.field.Pos(), a.field.End(), textB)
+		m.replace(b.field.Pos(), b.field.End(), textA)
+	default:
+		// Declare each parameter separately, in the new order
+		params[r.i], params[r.j] = params[r.j], params[r.i]
+		decls := []string{}
+		for _, p := range params {
+			if p.name != nil {
+				decls = append(decls, p.name.Name+" "+m.textOf(p.field.Type))
+			} else {
+				decls = append(decls, m.textOf(p.field.Type))
+			}
+		}
+		list := r.decl.Type.Params.List
+		m.replace(list[0].Pos(), list[len(list)-1].End(),
+			strings.Join(decls, ", "))
+	}
+}
+
+const swapArgumentsDoc = `
+  <h4>Purpose</h4>
+  <p>The Swap Arguments refactoring swaps two arguments of a function call.
+  If the function is declared in the code being refactored, its parameters
+  are swapped as well, and so are the arguments of every other call to it, so
+  the behavior of the program does not change.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select two arguments of a function call, starting in one argument
+    and ending in the other.</li>
+    <li>Activate the Swap Arguments refactoring.</li>
+  </ol>
+
+  <p>If the function is not declared in the code being refactored (e.g., it
+  is in the standard library, or it is a function value), only the selected
+  call is changed, and a warning is logged, since the function will receive
+  its arguments in a different order.  The refactoring fails if the
+  arguments may depend on each other (e.g., if both are function calls),
+  since swapping them changes the order in which they are evaluated.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of swapping the arguments
+  <tt>"box"</tt> and <tt>3</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func label(name string, width int) string {
+    return fmt.Sprintf("%s (%d)", name, width)
+}
+
+func main() {
+    fmt.Println(label(<span class="highlight">"box", 3</span>))
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func label(width int, name string) string {
+    return fmt.Sprintf("%s (%d)", name, width)
+}
+
+func main() {
+    fmt.Println(label(3, "box"))
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,27 @@
+package main //<<<<<addfield,6,6,6,12,Retries,int,3,pass
+
+import "fmt"
+
+// Config configures a client.
+type Config struct {
+	Addr    string
+	Verbose bool // print requests
+}
+
+// NewConfig returns a configuration for the given address.
+func NewConfig(addr string) *Config {
+	return &Config{Addr: addr}
+}
+
+func main() {
+	local := Config{Addr: "localhost"}
+	remote := NewConfig("example.com")
+	configs := []Config{
+		{},
+		{
+			Addr:    "127.0.0.1",
+			Verbose: true, // debugging
+		},
+	}
+	fmt.Println(local, remote, configs)
+}
@@ -0,0 +1,13 @@
+package main //<<<<<addfield,5,6,5,10,name,string,"none",pass
+
+import "fmt"
+
+type item struct{}
+
+func newItem() item { return item{} }
+
+func main() {
+	type pair struct{ a, b item }
+	p := pair{a: newItem()}
+	fmt.Println(p)
+}
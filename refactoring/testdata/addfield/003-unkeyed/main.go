@@ -0,0 +1,11 @@
+package main //<<<<<addfield,5,6,5,11,Z,int,0,fail
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func main() {
+	fmt.Println(Point{X: 1, Y: 2}, Point{3, 4})
+}
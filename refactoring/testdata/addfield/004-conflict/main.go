@@ -0,0 +1,15 @@
+package main //<<<<<addfield,5,6,5,11,String,string,"",fail
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+func main() {
+	fmt.Println(Point{X: 1, Y: 2})
+}
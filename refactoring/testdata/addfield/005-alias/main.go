@@ -0,0 +1,16 @@
+package main //<<<<<addfield,10,6,10,12,Retries,int,3,pass
+
+import "fmt"
+
+// Config configures a client.
+type Config struct {
+	Addr string
+}
+
+type Options = Config
+
+func main() {
+	local := Options{Addr: "localhost"}
+	remote := &Config{Addr: "example.com"}
+	fmt.Println(local, remote)
+}
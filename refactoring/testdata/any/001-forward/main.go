@@ -0,0 +1,35 @@
+package main //<<<<<any,1,1,1,1,pass
+
+import "fmt"
+
+type Stringer interface {
+	String() string
+}
+
+type Box struct {
+	Value interface{}
+	Tags  map[string]interface{}
+}
+
+func Print(values ...interface{}) {
+	fmt.Println(values...)
+}
+
+func Keep(v interface{ /* intentionally empty */ }) {
+	fmt.Println(v)
+}
+
+func Shadowed() {
+	any := 1
+	var v interface{} = any
+	fmt.Println(v)
+}
+
+func main() {
+	var x interface{} = Box{Value: []interface{}{1, "two"}}
+	if _, ok := x.(interface{}); ok {
+		Print(x)
+	}
+	Keep(x)
+	Shadowed()
+}
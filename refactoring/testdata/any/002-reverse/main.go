@@ -0,0 +1,20 @@
+package main //<<<<<any,1,1,1,1,true,pass
+
+import "fmt"
+
+func Map[T, U any](values []T, f func(T) U) []U {
+	result := []U{}
+	for _, v := range values {
+		result = append(result, f(v))
+	}
+	return result
+}
+
+func Describe(v any) string {
+	return fmt.Sprint(v)
+}
+
+func main() {
+	var anyValue any = 3
+	fmt.Println(Map([]any{1, anyValue}, Describe))
+}
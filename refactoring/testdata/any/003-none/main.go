@@ -0,0 +1,11 @@
+package main //<<<<<any,1,1,1,1,fail
+
+import "fmt"
+
+type Stringer interface {
+	String() string
+}
+
+func main() {
+	fmt.Println("nothing to replace")
+}
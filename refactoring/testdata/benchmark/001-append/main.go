@@ -0,0 +1,17 @@
+package main //<<<<<benchmark,11,6,11,12,main_test.go,pass
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type Duration int64
+
+func Process(ctx context.Context, name string, data []byte, d Duration, counts map[string]int, ok bool, f func(int) int, tags ...string) string {
+	return fmt.Sprint(ctx, name, len(data), d, counts, ok, f(1), strings.Join(tags, ","))
+}
+
+func main() {
+	fmt.Println(Process(context.Background(), "x", nil, 0, nil, false, func(n int) int { return n }))
+}
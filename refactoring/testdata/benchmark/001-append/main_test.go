@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestProcess(t *testing.T) {
+	if Process(nil, "", nil, 0, nil, false, func(n int) int { return n }) == "" {
+		t.Fatal("empty")
+	}
+}
@@ -0,0 +1,22 @@
+package main //<<<<<benchmark,9,17,9,22,pass
+
+import "fmt"
+
+type Cache struct {
+	items map[string]int
+}
+
+func (c *Cache) Lookup(key string, n int32, opts *Options, w fmt.Stringer) int {
+	return c.items[key] + int(n)
+}
+
+type Options struct {
+	Verbose bool
+}
+
+func Map[T any](xs []T) []T { return xs }
+
+func main() {
+	c := &Cache{}
+	fmt.Println(c.Lookup("a", 1, nil, nil), Map([]int{1}))
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func Map[T any](xs []T, f func(T) T) []T { //<<<<<benchmark,5,6,5,8,fail
+	for i := range xs {
+		xs[i] = f(xs[i])
+	}
+	return xs
+}
+
+func main() {
+	fmt.Println(Map([]int{1}, func(n int) int { return n + 1 }))
+}
@@ -0,0 +1,7 @@
+package main //<<<<<debug,1,1,1,1,showcycles,pass
+
+import "fmt"
+
+func main() {
+	fmt.Println("No cycles here")
+}
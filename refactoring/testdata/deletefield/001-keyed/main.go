@@ -0,0 +1,29 @@
+package main //<<<<<deletefield,9,2,9,8,pass
+
+import "fmt"
+
+// Config configures a client.
+type Config struct {
+	Addr string
+	// Legacy enables the old protocol.
+	Legacy  bool
+	Retries int
+}
+
+func legacy() bool { return true }
+
+func main() {
+	c := Config{Addr: "localhost", Legacy: true}
+	d := Config{
+		Addr:    "example.com",
+		Legacy:  false, // for now
+		Retries: 3,
+	}
+	e := Config{"127.0.0.1", false, 1}
+	c.Legacy = false
+	d.Legacy = legacy()
+	if d.Legacy {
+		fmt.Println("legacy")
+	}
+	fmt.Println(c, d, e)
+}
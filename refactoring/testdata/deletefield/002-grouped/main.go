@@ -0,0 +1,15 @@
+package main //<<<<<deletefield,6,8,6,9,pass
+
+import "fmt"
+
+type Point struct {
+	X, Y, Z int
+}
+
+func main() {
+	p := Point{1, 2, 3}
+	q := struct{ A, B int }{4, 5}
+	p.Z++
+	p.X, p.Z = 6, 7
+	fmt.Println(p, q, Point{X: 8, Z: 9, Y: 10})
+}
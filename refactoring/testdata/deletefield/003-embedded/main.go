@@ -0,0 +1,15 @@
+package main //<<<<<deletefield,14,16,14,20,fail
+
+import "fmt"
+
+type Base struct{ ID int }
+
+type Item struct {
+	Base
+	Name string
+}
+
+func main() {
+	i := Item{Base{1}, "a"}
+	fmt.Println(i.Base, i.Name)
+}
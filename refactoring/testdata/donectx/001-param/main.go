@@ -0,0 +1,29 @@
+package main //<<<<<donectx,8,31,8,34,pass
+
+import (
+	"fmt"
+	"time"
+)
+
+func worker(jobs <-chan int, done <-chan struct{}, id int) {
+	for {
+		select {
+		case j := <-jobs:
+			fmt.Println(id, j)
+		case <-done:
+			fmt.Println(id, "stopping")
+			return
+		}
+	}
+}
+
+func main() {
+	jobs := make(chan int)
+	stop := make(chan struct{})
+	go worker(jobs, stop, 1)
+	jobs <- 1
+	close(stop)
+	<-stop
+	worker(nil, nil, 2)
+	time.Sleep(time.Millisecond)
+}
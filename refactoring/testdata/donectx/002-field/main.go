@@ -0,0 +1,42 @@
+package main //<<<<<donectx,11,2,11,6,pass
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Server struct {
+	name string
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+func NewServer(name string) *Server {
+	s := &Server{name: name}
+	s.quit = make(chan struct{})
+	return s
+}
+
+func (s *Server) Serve(requests <-chan string) {
+	defer s.wg.Done()
+	for {
+		select {
+		case req := <-requests:
+			fmt.Println(s.name, req)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Server) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+
+func main() {
+	s := NewServer("main")
+	s.wg.Add(1)
+	go s.Serve(nil)
+	s.Stop()
+}
@@ -0,0 +1,18 @@
+package main //<<<<<donectx,9,11,9,15,fail
+
+import "fmt"
+
+func relay(done chan struct{}) {
+	wait(done)
+}
+
+func wait(done chan struct{}) {
+	<-done
+	fmt.Println("done")
+}
+
+func main() {
+	done := make(chan struct{})
+	go func() { done <- struct{}{} }()
+	relay(done)
+}
@@ -0,0 +1,34 @@
+package main //<<<<<examples,24,6,24,12,pass
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reverse returns s with its runes in reverse order.  For example:
+//
+//	fmt.Println(Reverse("abc"))
+//	// Output: cba
+//
+// It can be combined with other string functions:
+//
+// ```go
+// s := strings.ToUpper(Reverse("abc"))
+// fmt.Println(s)
+// // Output: CBA
+// ```
+//
+// The grammar is:
+//
+//	Reverse = { rune } .
+func Reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func main() {
+	fmt.Println(strings.ToLower(Reverse("ABC")))
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+// ExampleReverse is generated from the doc comment of Reverse.
+func ExampleReverse() {
+	fmt.Println(Reverse("ab"))
+	// Output: ba
+}
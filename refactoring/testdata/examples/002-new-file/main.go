@@ -0,0 +1,23 @@
+package main //<<<<<examples,21,4,21,7,pass
+
+import "fmt"
+
+type Stack struct {
+	items []int
+}
+
+// Push adds n to the top of the stack:
+//
+//	var s Stack
+//	s.Push(1)
+//	fmt.Println(s.items)
+//	// Output: [1]
+func (s *Stack) Push(n int) {
+	s.items = append(s.items, n)
+}
+
+func main() {
+	var s Stack
+	s.Push(2)
+	fmt.Println(s.items)
+}
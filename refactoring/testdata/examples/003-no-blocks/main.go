@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// Double returns twice n.  The grammar of its argument is:
+//
+//	Number = digit { digit } .
+func Double(n int) int { //<<<<<examples,8,6,8,11,fail
+	return 2 * n
+}
+
+func main() {
+	fmt.Println(Double(2))
+}
@@ -0,0 +1,32 @@
+package main //<<<<<exhaustive,20,2,20,7,pass
+
+import "fmt"
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+	Blue
+	Yellow
+
+	// Default is the color used when none is given.
+	Default = Red
+)
+
+const maxColor = 10
+
+func name(c Color) string {
+	switch c {
+	case Red:
+		return "red"
+	case Yellow:
+		return "yellow"
+	default:
+		return "unknown"
+	}
+}
+
+func main() {
+	fmt.Println(name(Green), maxColor)
+}
@@ -0,0 +1,38 @@
+package main //<<<<<exhaustive,27,2,27,7,pass
+
+import "fmt"
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ side float64 }
+
+func (s Square) Area() float64 { return s.side * s.side }
+
+type Circle struct{ radius float64 }
+
+func (c *Circle) Area() float64 { return 3.14 * c.radius * c.radius }
+
+type Triangle struct{ base, height float64 }
+
+func (t Triangle) Area() float64 { return t.base * t.height / 2 }
+
+type Polygon interface {
+	Shape
+	Sides() int
+}
+
+func describe(s Shape) string {
+	switch s := s.(type) {
+	case Square:
+		return fmt.Sprint("square ", s.side)
+	case nil:
+		return "nothing"
+	}
+	return "shape"
+}
+
+func main() {
+	fmt.Println(describe(Square{1}), describe(&Circle{2}))
+}
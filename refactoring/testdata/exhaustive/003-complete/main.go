@@ -0,0 +1,24 @@
+package main //<<<<<exhaustive,13,2,13,7,fail
+
+import "fmt"
+
+type Direction int
+
+const (
+	Up Direction = iota
+	Down
+)
+
+func flip(d Direction) Direction {
+	switch d {
+	case Up:
+		return Down
+	case Down:
+		return Up
+	}
+	return d
+}
+
+func main() {
+	fmt.Println(flip(Up))
+}
@@ -0,0 +1,14 @@
+// <<<<< extract,12,2,13,24,write,pass
+package main
+
+import (
+	"fmt"
+
+	buf "bytes"
+)
+
+func main() {
+	b := &buf.Buffer{}
+	b.WriteString("hello")
+	fmt.Println(b.String())
+}
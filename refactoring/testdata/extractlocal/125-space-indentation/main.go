@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+    a := 1
+    if a > 0 {
+        fmt.Println(a + 2) // <<<<< var,8,21,8,25,sum,pass
+    }
+}
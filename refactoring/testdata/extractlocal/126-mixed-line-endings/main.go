@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	a := 1
+	fmt.Println(a + 2) // <<<<< var,7,14,7,18,sum,pass
+	fmt.Println(a)
+}
@@ -0,0 +1,27 @@
+package main //<<<<<featureflag,15,2,21,26,fancy-greeting,pass
+
+import (
+	"fmt"
+	"strings"
+)
+
+type greeting struct {
+	text string
+}
+
+func greet(name string) {
+	fmt.Println("Welcome!")
+	// Build the message
+	parts := []string{"Hello", name}
+	msg, n := strings.Join(parts, ", "), len(parts)
+	var g = greeting{msg}
+	var count int
+	const suffix = "!"
+	type pair struct{ a, b int }
+	count = n + len(suffix) // add one
+	fmt.Println(g.text+suffix, count, pair{1, 2})
+}
+
+func main() {
+	greet("world")
+}
@@ -0,0 +1,22 @@
+package main //<<<<<featureflag,13,2,16,31,new-total,pass
+
+import (
+	"fmt"
+	"os"
+)
+
+func featureFlag(name string) bool {
+	return os.Getenv("FLAG_"+name) != "0"
+}
+
+func total(xs []int) {
+	for _, x := range xs {
+		fmt.Println(x)
+	}
+	sum, _ := fmt.Println("done")
+	fmt.Println(sum)
+}
+
+func main() {
+	total([]int{1, 2})
+}
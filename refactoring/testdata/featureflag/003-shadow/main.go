@@ -0,0 +1,16 @@
+package main //<<<<<featureflag,9,2,10,7,shadow,fail
+
+import "fmt"
+
+var x = 1
+
+func show() {
+	fmt.Println("start")
+	fmt.Println(x)
+	x := 2
+	fmt.Println(x)
+}
+
+func main() {
+	show()
+}
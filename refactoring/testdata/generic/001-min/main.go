@@ -0,0 +1,43 @@
+package main //<<<<<generic,5,6,5,6,pass
+
+import "fmt"
+
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MinFloat64 returns the smaller of a and b.
+func MinFloat64(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MaxInt is not merged, since it differs by more than a type.
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func SumInt(values []int) int {
+	var total int
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func main() {
+	x := 3
+	fmt.Println(MinInt(x, 2))
+	fmt.Println(MinFloat64(1, 2))
+	fmt.Println(MaxInt(x, 4), SumInt([]int{x}))
+	min := MinFloat64
+	fmt.Println(min(1.5, 2.5))
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"mathx"
+)
+
+func main() {
+	fmt.Println(mathx.FirstInt([]int{3, 1}))
+	fmt.Println(mathx.FirstCelsius(nil))
+	fmt.Println(mathx.FirstString([]string{"a"}))
+}
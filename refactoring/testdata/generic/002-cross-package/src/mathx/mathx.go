@@ -0,0 +1,27 @@
+package mathx //<<<<<generic,5,6,5,6,FirstOf,pass
+
+type Celsius float64
+
+func FirstInt(values []int) int {
+	var zero int
+	if len(values) == 0 {
+		return zero
+	}
+	return values[0]
+}
+
+func FirstCelsius(values []Celsius) Celsius {
+	var zero Celsius
+	if len(values) == 0 {
+		return zero
+	}
+	return values[0]
+}
+
+func FirstString(values []string) string {
+	var zero string
+	if len(values) == 0 {
+		return zero
+	}
+	return values[0]
+}
@@ -0,0 +1,21 @@
+package main //<<<<<generic,5,6,5,6,fail
+
+import "fmt"
+
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func MaxFloat64(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func main() {
+	fmt.Println(MinInt(1, 2), MaxFloat64(1, 2))
+}
@@ -0,0 +1,30 @@
+package main //<<<<<guard,16,6,16,9,pass
+
+import (
+	"errors"
+	"fmt"
+)
+
+type doc struct {
+	name  string
+	dirty bool
+	size  float64
+}
+
+// save writes d if it has changed.
+func save(d *doc) error {
+	if d != nil {
+		if d.dirty {
+			fmt.Println("writing", d.name)
+			return nil
+		} else {
+			// Nothing to do
+			return nil
+		}
+	}
+	return errors.New("no doc")
+}
+
+func main() {
+	fmt.Println(save(&doc{name: "a"}))
+}
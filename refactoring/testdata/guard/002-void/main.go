@@ -0,0 +1,29 @@
+package main //<<<<<guard,12,6,12,10,pass
+
+import "fmt"
+
+type doc struct {
+	name  string
+	dirty bool
+	size  float64
+}
+
+// print prints d if it is large enough.
+func print(d *doc, verbose bool) {
+	fmt.Println("checking")
+	if n := len(d.name); n > 0 {
+		if d.size > 10 {
+			fmt.Println(d.name, n)
+
+			if verbose { // extra detail
+				fmt.Println(d.size)
+			}
+		} else {
+			fmt.Println("small")
+		}
+	}
+}
+
+func main() {
+	print(&doc{name: "a", size: 20}, true)
+}
@@ -0,0 +1,17 @@
+package main //<<<<<guard,5,6,5,10,fail
+
+import "fmt"
+
+func scale(x int) int {
+	v := 1
+	if x > 0 {
+		v := x * 2
+		fmt.Println("scaled", v)
+		return v
+	}
+	return v
+}
+
+func main() {
+	fmt.Println(scale(3))
+}
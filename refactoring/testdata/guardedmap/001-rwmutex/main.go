@@ -0,0 +1,47 @@
+package main //<<<<<guardedmap,10,2,10,7,pass
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Registry struct {
+	mu    sync.RWMutex
+	users map[string]int
+	name  string
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{name: "main"}
+	r.users = make(map[string]int)
+	return r
+}
+
+func (reg *Registry) Reset() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for k := range reg.users {
+		delete(reg.users, k)
+	}
+}
+
+func register(r *Registry, name string, id int) {
+	r.users[name] = id
+	r.users[name]++
+	fmt.Println(r.users[name], len(r.users))
+	if id, ok := r.users["admin"]; ok {
+		fmt.Println(id)
+	}
+	var other, found = r.users["guest"]
+	fmt.Println(other, found)
+	delete(r.users, "guest")
+	for k, v := range r.users {
+		fmt.Println(k, v)
+	}
+}
+
+func main() {
+	r := NewRegistry()
+	register(r, "bob", 1)
+	r.Reset()
+}
@@ -0,0 +1,19 @@
+package main //<<<<<guardedmap,12,2,12,7,pass
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Cache struct {
+	sync.Mutex
+	Sessions map[int]time.Time
+	Users    map[string]*Cache
+}
+
+func main() {
+	c := &Cache{Users: map[string]*Cache{}}
+	c.Users["self"] = c
+	fmt.Println(c.Users["self"] == c)
+}
@@ -0,0 +1,16 @@
+package main //<<<<<guardedmap,9,2,9,7,fail
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Counter struct {
+	mu    sync.Mutex
+	count int
+}
+
+func main() {
+	c := &Counter{}
+	fmt.Println(c.count)
+}
@@ -0,0 +1,31 @@
+package main //<<<<<handler,18,30,18,30,handleHealth,pass
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Server struct {
+	mux    *http.ServeMux
+	status string
+}
+
+func NewServer() *Server {
+	return &Server{mux: http.NewServeMux(), status: "ok"}
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, s.status)
+	})
+}
+
+func main() {
+	s := NewServer()
+	s.routes()
+	http.ListenAndServe(":8080", s.mux)
+}
@@ -0,0 +1,15 @@
+package main //<<<<<handler,11,3,11,3,greet,pass
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func main() {
+	greeting := "hello"
+	http.Handle("/greet", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, r.URL.Query().Get("name"))
+	}))
+	fmt.Println(greeting)
+	http.ListenAndServe(":8080", nil)
+}
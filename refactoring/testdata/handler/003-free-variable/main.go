@@ -0,0 +1,14 @@
+package main //<<<<<handler,11,3,11,3,greet,fail
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func main() {
+	greeting := "hello"
+	http.HandleFunc("/greet", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, greeting, r.URL.Path)
+	})
+	http.ListenAndServe(":8080", nil)
+}
@@ -0,0 +1,5 @@
+package lib // import "github.com/old/lib"
+
+import "github.com/old/lib/strs"
+
+var Name = strs.Upper("lib")
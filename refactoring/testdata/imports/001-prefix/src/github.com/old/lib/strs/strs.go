@@ -0,0 +1,7 @@
+package strs /* import "github.com/old/lib/strs" */
+
+import "strings"
+
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
@@ -0,0 +1,13 @@
+package strs_test
+
+import (
+	"testing"
+
+	. "github.com/old/lib/strs"
+)
+
+func TestUpper(t *testing.T) {
+	if Upper("a") != "A" {
+		t.Fail()
+	}
+}
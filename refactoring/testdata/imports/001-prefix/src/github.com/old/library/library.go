@@ -0,0 +1,3 @@
+package library // import "github.com/old/library"
+
+var Name = "library"
@@ -0,0 +1,13 @@
+package main //<<<<<imports,1,1,1,1,github.com/old/lib,example.com/lib,pass
+
+import (
+	"fmt"
+
+	"github.com/old/lib"
+	s "github.com/old/lib/strs"
+	"github.com/old/library"
+)
+
+func main() {
+	fmt.Println(lib.Name, s.Upper(library.Name))
+}
@@ -0,0 +1,11 @@
+package main //<<<<<imports,1,1,1,1,fmt,fmt,fail
+//<<<<<imports,1,1,1,1,github.com/old/lib,example.com/lib,fail
+//<<<<<imports,1,1,1,1,,example.com/lib,fail
+//<<<<<imports,1,1,1,1,f,example.com/f,fail
+//<<<<<imports,1,1,1,1,fmt,example.com/fmt,pass
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello")
+}
@@ -0,0 +1,13 @@
+// Package fork is a fork of lib that uses util, so util cannot import it
+package fork
+
+import (
+	"fmt"
+	"util"
+)
+
+func Print(s string) {
+	fmt.Println(s)
+}
+
+var _ = util.Print
@@ -0,0 +1,7 @@
+package lib
+
+import "fmt"
+
+func Print(s string) {
+	fmt.Println(s)
+}
@@ -0,0 +1,7 @@
+package main //<<<<<imports,1,1,1,1,lib,fork,fail
+
+import "util"
+
+func main() {
+	util.Print("Hello")
+}
@@ -0,0 +1,7 @@
+package util
+
+import "lib"
+
+func Print(s string) {
+	lib.Print(s)
+}
@@ -0,0 +1,11 @@
+package main //<<<<<imports,1,1,1,1,old,new,fail
+
+import (
+	"new/a"
+	"new/b"
+)
+
+func main() {
+	a.Print("Hello")
+	b.Print("Hello")
+}
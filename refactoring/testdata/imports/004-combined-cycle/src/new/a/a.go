@@ -0,0 +1,9 @@
+// Package a imports b once old is replaced with new; neither rewritten
+// import forms a cycle alone, but together they do
+package a
+
+import "old/b"
+
+func Print(s string) {
+	b.Print(s)
+}
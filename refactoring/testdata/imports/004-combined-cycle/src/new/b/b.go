@@ -0,0 +1,7 @@
+package b
+
+import "old/a"
+
+func Print(s string) {
+	a.Print(s)
+}
@@ -0,0 +1,7 @@
+package a
+
+import "fmt"
+
+func Print(s string) {
+	fmt.Println(s)
+}
@@ -0,0 +1,7 @@
+package b
+
+import "fmt"
+
+func Print(s string) {
+	fmt.Println(s)
+}
@@ -0,0 +1,9 @@
+// Package lib provides greetings.
+package lib
+
+import "lib/util"
+
+// Greeting returns a greeting.
+func Greeting() string {
+	return util.Exclaim("Hello")
+}
@@ -0,0 +1,8 @@
+package util // import "lib/util"
+
+//<<<<<internal,3,1,3,1,pass
+
+// Exclaim adds an exclamation point to a string.
+func Exclaim(s string) string {
+	return s + "!"
+}
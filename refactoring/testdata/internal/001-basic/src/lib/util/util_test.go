@@ -0,0 +1,13 @@
+package util_test
+
+import (
+	"testing"
+
+	"lib/util"
+)
+
+func TestExclaim(t *testing.T) {
+	if util.Exclaim("hi") != "hi!" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"lib"
+	u "lib/util"
+)
+
+func main() {
+	fmt.Println(lib.Greeting(), u.Exclaim("world"))
+}
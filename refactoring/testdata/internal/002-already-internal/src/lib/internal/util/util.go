@@ -0,0 +1,3 @@
+package util //<<<<<internal,1,1,1,1,fail
+
+func Hello() {}
@@ -0,0 +1,7 @@
+package lib
+
+import "lib/internal/util"
+
+func Hello() {
+	util.Hello()
+}
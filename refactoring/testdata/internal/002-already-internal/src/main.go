@@ -0,0 +1,7 @@
+package main
+
+import "lib"
+
+func main() {
+	lib.Hello()
+}
@@ -0,0 +1,5 @@
+package c //<<<<<internal,1,1,1,1,a,pass
+//<<<<<internal,1,1,1,1,b/c,fail
+//<<<<<internal,1,1,1,1,x,fail
+
+func Hello() {}
@@ -0,0 +1,7 @@
+package main
+
+import "a/b/c"
+
+func main() {
+	c.Hello()
+}
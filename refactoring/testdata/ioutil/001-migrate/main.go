@@ -0,0 +1,31 @@
+package main //<<<<<ioutil,1,1,1,1,pass
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+func main() {
+	data, _ := ioutil.ReadAll(strings.NewReader("data"))
+	ioutil.WriteFile("out.txt", data, 0644)
+	contents, _ := ioutil.ReadFile("out.txt")
+	fmt.Fprintln(ioutil.Discard, string(contents))
+
+	dir, _ := ioutil.TempDir("", "example")
+	f, _ := ioutil.TempFile(dir, "*.txt")
+	f.Close()
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			fmt.Println(entry.Name())
+		}
+	}
+	fmt.Println(entries[0].Name())
+	rc := ioutil.NopCloser(strings.NewReader(""))
+	rc.Close()
+}
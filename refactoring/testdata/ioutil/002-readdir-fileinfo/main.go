@@ -0,0 +1,13 @@
+package main //<<<<<ioutil,1,1,1,1,pass
+
+import "io/ioutil"
+
+func main() {
+	contents, _ := ioutil.ReadFile("in.txt")
+	println(len(contents))
+
+	entries, _ := ioutil.ReadDir(".")
+	for _, entry := range entries {
+		println(entry.Name(), entry.Size())
+	}
+}
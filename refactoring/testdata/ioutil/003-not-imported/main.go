@@ -0,0 +1,7 @@
+package main //<<<<<ioutil,1,1,1,1,fail
+
+import "os"
+
+func main() {
+	os.ReadFile("in.txt")
+}
@@ -0,0 +1,23 @@
+package main //<<<<<keyed,5,6,5,10,pass
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Size struct {
+	W, H int
+}
+
+var origin = Point{0, 0}
+
+func main() {
+	corners := []*Point{{0, 1}, {1, 0}}
+	p := &Point{
+		3, // across
+		4, // down
+	}
+	s := Size{5, 6}
+	fmt.Println(origin, corners, p, s, Point{X: 7, Y: 8})
+}
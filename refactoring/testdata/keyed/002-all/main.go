@@ -0,0 +1,23 @@
+package main //<<<<<keyed,1,1,1,1,pass
+
+import (
+	"fmt"
+	"image"
+)
+
+type Named struct {
+	string
+	Tags []string
+}
+
+type Pair[T any] struct {
+	First, Second T
+}
+
+func main() {
+	n := Named{"a", []string{"b", "c"}}
+	pairs := map[string]Pair[int]{"p": {1, 2}}
+	anon := struct{ A, B int }{3, 4}
+	rect := image.Rectangle{image.Point{0, 0}, image.Pt(1, 1)}
+	fmt.Println(n, pairs, anon, rect)
+}
@@ -0,0 +1,11 @@
+package main //<<<<<keyed,5,6,5,10,fail
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func main() {
+	fmt.Println(Point{X: 1, Y: 2}, struct{ A int }{3})
+}
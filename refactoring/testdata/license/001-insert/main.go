@@ -0,0 +1,10 @@
+//go:build go1.18
+
+// Package main prints a greeting.
+package main //<<<<<license,1,1,1,1,Copyright 2024 Acme Inc. All rights reserved.\nUse of this source code is governed by the MIT license.,pass
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello")
+}
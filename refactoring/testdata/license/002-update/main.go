@@ -0,0 +1,11 @@
+// Copyright 2015 Old Corp.
+// Licensed under the Apache License.
+
+// Package main prints a greeting.
+package main //<<<<<license,5,1,5,1,// SPDX-License-Identifier: MIT,pass
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello")
+}
@@ -0,0 +1,4 @@
+package main //<<<<<license,1,1,1,1,/* Copyright 2024 Acme Inc.,fail
+
+func main() {
+}
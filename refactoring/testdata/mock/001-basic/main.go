@@ -0,0 +1,21 @@
+package main //<<<<<mock,10,6,10,10,main.go,pass
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Store stores values by key.
+type Store interface {
+	Get(key string) (string, error)
+	Put(key, value string, ttl time.Duration) error
+	Dump(io.Writer, ...string)
+	Len() int
+	Stats() struct{ Hits int }
+}
+
+func main() {
+	var s Store
+	fmt.Println(s)
+}
@@ -0,0 +1,13 @@
+package main //<<<<<mock,11,8,11,12,pass
+
+import "io"
+
+type Store interface {
+	Load(r io.Reader) error
+	Close()
+}
+
+func main() {
+	var s Store
+	_ = s
+}
@@ -0,0 +1,12 @@
+package main //<<<<<mock,5,6,5,10,fail
+
+import "fmt"
+
+type Store[T any] interface {
+	Get(key string) (T, error)
+}
+
+func main() {
+	var s Store[int]
+	fmt.Println(s)
+}
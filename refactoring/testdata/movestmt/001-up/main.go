@@ -0,0 +1,13 @@
+package main //<<<<<movestmt,11,2,11,2,pass
+
+import "fmt"
+
+func main() {
+	width := 3
+	// The height is fixed
+	height := 4 // in meters
+
+	// Name the box
+	name := "box"
+	fmt.Println(name, width*height)
+}
@@ -0,0 +1,17 @@
+package main //<<<<<movestmt,8,3,8,3,true,pass
+
+import "fmt"
+
+func main() {
+	for i := 0; i < 3; i++ {
+		count := 0
+		total := i
+		for j := 0; j < i; j++ {
+			if j > 1 {
+				break
+			}
+			count++
+		}
+		fmt.Println(total, count)
+	}
+}
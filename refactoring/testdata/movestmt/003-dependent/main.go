@@ -0,0 +1,8 @@
+package main //<<<<<movestmt,7,2,7,2,fail
+
+import "fmt"
+
+func main() {
+	x := 1
+	fmt.Println(x)
+}
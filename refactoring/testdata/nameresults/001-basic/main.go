@@ -0,0 +1,25 @@
+package main //<<<<<nameresults,10,6,10,10,n err,pass
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// parse converts s to a positive number.
+func parse(s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("empty")
+	}
+	check := func(x int) bool {
+		return x > 0
+	}
+	if v, e := strconv.Atoi(s); e == nil && !check(v) {
+		return v, fmt.Errorf("%d is not positive", v)
+	}
+	return strconv.Atoi(s)
+}
+
+func main() {
+	fmt.Println(parse("42"))
+}
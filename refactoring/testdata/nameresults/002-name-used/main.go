@@ -0,0 +1,15 @@
+package main //<<<<<nameresults,5,6,5,8,n,fail
+
+import "fmt"
+
+func sum(xs []int) int {
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
+
+func main() {
+	fmt.Println(sum([]int{1, 2, 3}))
+}
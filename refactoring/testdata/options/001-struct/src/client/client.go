@@ -0,0 +1,26 @@
+package client //<<<<<options,14,6,14,6,pass
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Client struct {
+	name string
+}
+
+// Dial connects to the given address.
+func Dial(ctx context.Context, addr string, timeout time.Duration, retries int, verbose bool) (*Client, error) {
+	if verbose {
+		fmt.Println("dialing", addr, timeout, retries)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Client{name: addr}, nil
+}
+
+func Local() (*Client, error) {
+	return Dial(context.Background(), "localhost", time.Second, 0, false)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"client"
+)
+
+func main() {
+	c, err := client.Dial(context.TODO(), "example.com:80", 5*time.Second, 3, true)
+	fmt.Println(c, err)
+	fmt.Println(client.Local())
+}
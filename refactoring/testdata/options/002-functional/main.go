@@ -0,0 +1,17 @@
+package main //<<<<<options,9,18,9,18,true,pass
+
+import "fmt"
+
+type Server struct {
+	addr string
+}
+
+func (s *Server) listen(port int, host string, backlog int) error {
+	fmt.Println(s.addr, host, port, backlog)
+	return nil
+}
+
+func main() {
+	s := &Server{addr: "local"}
+	s.listen(8080, "", 128)
+}
@@ -0,0 +1,11 @@
+package main //<<<<<options,5,6,5,6,fail
+
+import "fmt"
+
+func greet(name string) {
+	fmt.Println("hello", name)
+}
+
+func main() {
+	greet("world")
+}
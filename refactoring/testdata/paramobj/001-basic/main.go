@@ -0,0 +1,24 @@
+package main //<<<<<paramobj,6,6,6,6,rect,pass
+
+import "fmt"
+
+// area returns the area of a rectangle.
+func area(x, y, w, h int) int {
+	return w * h
+}
+
+func describe(name string, x, y, w, h int, filled bool) {
+	fmt.Println(name, x, y, w, h, filled)
+}
+
+func shrink(x, y, w, h int) {
+	if w > 0 && h > 0 {
+		shrink(x+1, y+1, w-2, h-2)
+	}
+}
+
+func main() {
+	fmt.Println(area(0, 0, 3, 4))
+	describe("box", 1, 2, 3, 4, true)
+	shrink(0, 0, 10, 10)
+}
@@ -0,0 +1,11 @@
+package geo //<<<<<paramobj,5,6,5,6,Point,pass
+
+import "math"
+
+func Distance(lat, lon float64, toLat, toLon float64) float64 {
+	return math.Hypot(toLat-lat, toLon-lon)
+}
+
+func Format(label string, lat, lon float64) string {
+	return label
+}
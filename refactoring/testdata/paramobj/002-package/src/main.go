@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"geo"
+)
+
+func main() {
+	fmt.Println(geo.Distance(1.5, 2.5, 3, 4))
+	fmt.Println(geo.Format("home", 0, 0))
+}
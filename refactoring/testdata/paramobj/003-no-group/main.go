@@ -0,0 +1,15 @@
+package main //<<<<<paramobj,5,6,5,6,Pair,fail
+
+import "fmt"
+
+func add(a, b int) int {
+	return a + b
+}
+
+func sub(b, a int) int {
+	return a - b
+}
+
+func main() {
+	fmt.Println(add(1, 2), sub(3, 4))
+}
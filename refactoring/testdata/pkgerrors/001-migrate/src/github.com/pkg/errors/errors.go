@@ -0,0 +1,53 @@
+// Package errors is a minimal stand-in for github.com/pkg/errors.
+package errors
+
+import "fmt"
+
+type StackTrace []uintptr
+
+func New(message string) error {
+	return fmt.Errorf("%s", message)
+}
+
+func Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
+}
+
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
+
+func Wrapf(err error, format string, args ...interface{}) error {
+	return Wrap(err, fmt.Sprintf(format, args...))
+}
+
+func WithMessage(err error, message string) error {
+	return Wrap(err, message)
+}
+
+func WithMessagef(err error, format string, args ...interface{}) error {
+	return Wrapf(err, format, args...)
+}
+
+func WithStack(err error) error {
+	return err
+}
+
+func Cause(err error) error {
+	return err
+}
+
+func Is(err, target error) bool {
+	return err == target
+}
+
+func As(err error, target interface{}) bool {
+	return false
+}
+
+func Unwrap(err error) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package main //<<<<<pkgerrors,1,1,1,1,pass
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"store"
+)
+
+var errMissing = errors.New("missing")
+
+func open(name string) error {
+	_, err := os.Open(name)
+	if err != nil {
+		return errors.Wrap(err, "open failed (100%)")
+	}
+	return nil
+}
+
+func read(name string, n int) error {
+	err := open(name)
+	return errors.Wrapf(err, "reading %d bytes from %s", n, name)
+}
+
+func main() {
+	err := read("x", 3)
+	if errors.Cause(err) == errMissing {
+		println(errors.WithStack(err))
+	}
+	if errors.Cause(err) != errMissing && !errors.Is(err, os.ErrNotExist) {
+		err = errors.Errorf("unexpected: %v", err)
+	}
+	err = errors.WithMessage(err, store.Name)
+	println(store.Check(err), store.Other(err))
+}
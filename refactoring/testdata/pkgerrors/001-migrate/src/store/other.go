@@ -0,0 +1,10 @@
+package store
+
+import "github.com/pkg/errors"
+
+func Other(err error) error {
+	if nil != err {
+		return errors.WithMessagef(err, "other %d", 1)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package store
+
+import "github.com/pkg/errors"
+
+const Name = "store"
+
+func Trace(err error) errors.StackTrace {
+	return nil
+}
+
+func Check(err error) error {
+	if err != nil {
+		return errors.Wrap(err, Name)
+	}
+	return nil
+}
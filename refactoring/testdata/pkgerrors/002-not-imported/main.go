@@ -0,0 +1,7 @@
+package main //<<<<<pkgerrors,1,1,1,1,fail
+
+import "errors"
+
+func main() {
+	println(errors.New("x"))
+}
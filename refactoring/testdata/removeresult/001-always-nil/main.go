@@ -0,0 +1,30 @@
+package main //<<<<<removeresult,9,28,9,32,pass
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// parse returns the number of digits in s.
+func parse(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return len(strconv.Quote(s)) - 2, nil
+}
+
+var total, failure = parse("12345")
+
+func main() {
+	n, err := parse("abc")
+	if err != nil {
+		panic(err)
+	}
+	m, _ := parse("de")
+	_, err = parse("f")
+	if err != nil {
+		panic(err)
+	}
+	parse("ignored")
+	fmt.Println(n, m, total, failure)
+}
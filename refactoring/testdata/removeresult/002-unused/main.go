@@ -0,0 +1,31 @@
+package main //<<<<<removeresult,6,32,6,36,pass
+
+import "fmt"
+
+// counts returns the number of vowels and consonants in s.
+func counts(s string) (vowels, other int) {
+	for _, c := range s {
+		switch c {
+		case 'a', 'e', 'i', 'o', 'u':
+			vowels++
+		default:
+		}
+	}
+	return
+}
+
+type text string
+
+func (t text) split() (string, string, bool) {
+	if len(t) < 2 {
+		return string(t), "", false
+	}
+	return string(t[:1]), string(t[1:]), true
+}
+
+func main() {
+	v, _ := counts("hello")
+	fmt.Println(v)
+	head, tail, _ := text("hello").split()
+	fmt.Println(head, tail)
+}
@@ -0,0 +1,15 @@
+package main //<<<<<removeresult,5,31,5,34,fail
+
+import "fmt"
+
+func split(s string) (string, bool) {
+	if len(s) < 2 {
+		return s, false
+	}
+	return s[:1], true
+}
+
+func main() {
+	head, ok := split("hello")
+	fmt.Println(head, ok)
+}
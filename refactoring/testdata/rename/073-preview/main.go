@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+// hello is printed by main
+var hello = "Hello" // <<<<< rename,6,5,6,5,greeting,true,pass
+
+func main() {
+	fmt.Println(hello)
+	hello += "!"
+}
@@ -0,0 +1,10 @@
+package lib
+
+// Hello returns a greeting
+func Hello() string {
+	return "Hello"
+}
+
+func Goodbye() string {
+	return "Goodbye"
+}
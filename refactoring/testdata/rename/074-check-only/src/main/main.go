@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"lib"
+)
+
+func main() {
+	fmt.Println(lib.Hello()) // <<<<< rename,9,18,9,18,Greeting,false,true,pass
+	fmt.Println(lib.Hello()) // <<<<< rename,10,18,10,18,Goodbye,false,true,fail
+	fmt.Println(lib.Goodbye())
+}
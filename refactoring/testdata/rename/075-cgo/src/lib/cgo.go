@@ -0,0 +1,11 @@
+package lib
+
+// #include <stdlib.h>
+import "C"
+
+// Allocate allocates Counter bytes and then frees them
+func Allocate() int {
+	p := C.malloc(C.size_t(Counter))
+	C.free(p)
+	return Counter
+}
@@ -0,0 +1,4 @@
+package lib
+
+// Counter is the number of bytes to allocate
+var Counter = 1
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"lib"
+)
+
+func main() {
+	lib.Counter++ // <<<<< rename,9,6,9,6,Count,pass
+	fmt.Println(lib.Counter, lib.Allocate())
+}
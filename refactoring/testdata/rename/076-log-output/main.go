@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	a := 5 // <<<<< rename,6,2,6,2,b,fail
+	b := 6
+	fmt.Println(a, b)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+type Point struct{ X, Y int }
+
+type Pos = Point // <<<<< rename,7,6,7,6,Coord,pass
+
+type Named struct {
+	Pos
+	Name string
+}
+
+type Plain struct {
+	Point
+}
+
+func main() {
+	var p Pos = Point{1, 2}
+	n := Named{Pos: p, Name: "origin"}
+	q := Plain{Point: p}
+	fmt.Println(n.Pos, q.Point)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+type Point struct{ X, Y int } // <<<<< rename,5,6,5,6,Vertex,pass
+
+type Pos = Point
+
+type Named struct {
+	Pos
+	Name string
+}
+
+type Plain struct {
+	Point
+}
+
+func main() {
+	var p Pos = Point{1, 2}
+	n := Named{Pos: p, Name: "origin"}
+	q := Plain{Point: p}
+	fmt.Println(n.Pos, q.Point)
+}
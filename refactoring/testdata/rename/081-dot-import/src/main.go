@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	. "mypackage"
+)
+
+func main() {
+	fmt.Println(Double(5))
+}
@@ -0,0 +1,6 @@
+package mypackage
+
+// Test for renaming a function referenced through a dot import
+func Double(n int) int { // <<<<< rename,4,6,4,6,Twice,pass
+	return 2 * n
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	. "mypackage"
+)
+
+func main() {
+	Twice := 2
+	fmt.Println(Double(5) * Twice)
+}
@@ -0,0 +1,7 @@
+package mypackage
+
+// Test for renaming a function referenced through a dot import to a name
+// declared in the scope of the reference
+func Double(n int) int { // <<<<< rename,5,6,5,6,Twice,fail
+	return 2 * n
+}
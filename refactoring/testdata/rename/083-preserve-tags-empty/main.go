@@ -0,0 +1,16 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Person struct {
+	Name string `json:"" xml:"name"` // <<<<< rename,9,2,9,2,FullName,false,false,true,pass
+	Age  int    `json:"age"`
+}
+
+func main() {
+	data, _ := json.Marshal(Person{Name: "Gopher", Age: 10})
+	fmt.Println(string(data))
+}
@@ -0,0 +1,44 @@
+package main //<<<<<segregate,6,6,6,10,pass
+
+import "fmt"
+
+// Store is a key-value store.
+type Store interface {
+	// Get returns the value for the given key.
+	Get(key string) string
+	Put(key, value string)
+	Delete(key string) // removes the key
+}
+
+type memory map[string]string
+
+func (m memory) Get(key string) string { return m[key] }
+func (m memory) Put(key, value string) { m[key] = value }
+func (m memory) Delete(key string)     { delete(m, key) }
+
+func show(s Store, keys ...string) {
+	for _, key := range keys {
+		fmt.Println(key, s.Get(key))
+	}
+}
+
+func copyKey(from, to Store, key string) {
+	to.Put(key, from.Get(key))
+}
+
+func move(s Store, from, to string) {
+	s.Put(to, s.Get(from))
+	s.Delete(from)
+}
+
+func reset(s Store) {
+	move(s, "a", "b")
+}
+
+func main() {
+	s := memory{}
+	s.Put("a", "1")
+	copyKey(s, s, "b")
+	reset(s)
+	show(s, "a", "b")
+}
@@ -0,0 +1,23 @@
+package main //<<<<<segregate,5,6,5,11,fail
+
+import "fmt"
+
+type Shape interface {
+	Area() float64
+	Perimeter() float64
+}
+
+type square float64
+
+func (s square) Area() float64      { return float64(s * s) }
+func (s square) Perimeter() float64 { return float64(4 * s) }
+
+func describe(s Shape) {
+	fmt.Println(s.Area(), s.Perimeter())
+}
+
+func main() {
+	var s Shape = square(2)
+	describe(s)
+	fmt.Println(s.Area())
+}
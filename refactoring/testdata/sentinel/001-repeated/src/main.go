@@ -0,0 +1,7 @@
+package main
+
+import "store"
+
+func main() {
+	store.Main()
+}
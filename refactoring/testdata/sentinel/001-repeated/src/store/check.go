@@ -0,0 +1,13 @@
+package store
+
+import "errors"
+
+func check(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if name == "y" {
+		return errors.New("already exists")
+	}
+	return errors.New("unique message")
+}
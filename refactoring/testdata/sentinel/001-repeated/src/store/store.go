@@ -0,0 +1,26 @@
+package store //<<<<<sentinel,1,1,1,1,pass
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errExisting = errors.New("already exists")
+
+func find(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if name == "x" {
+		return fmt.Errorf("already exists")
+	}
+	return fmt.Errorf("%s not found", name)
+}
+
+func Main() {
+	err := find("")
+	if err != nil && err.Error() == "name is empty" {
+		fmt.Println("empty")
+	}
+	fmt.Println(check(""), validate(""), find("x") == errExisting)
+}
@@ -0,0 +1,16 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+func validate(name string) error {
+	fmt.Println("validating", name)
+	if name == "" {
+		errNameIsEmpty := "shadowed"
+		fmt.Println(errNameIsEmpty)
+		return errors.New("name is empty")
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package main //<<<<<sentinel,1,1,1,1,fail
+
+import (
+	"errors"
+	"fmt"
+)
+
+func main() {
+	fmt.Println(errors.New("one"), errors.New("two"))
+	fmt.Println(fmt.Errorf("%d", 3), fmt.Errorf("%d", 3))
+}
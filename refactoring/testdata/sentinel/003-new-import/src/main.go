@@ -0,0 +1,15 @@
+package main //<<<<<sentinel,1,1,1,1,pass
+
+import "fmt"
+
+func a() error {
+	return fmt.Errorf("failed")
+}
+
+func b() error {
+	return fmt.Errorf("failed")
+}
+
+func main() {
+	fmt.Println(a(), b())
+}
@@ -0,0 +1,37 @@
+package main //<<<<<service,8,1,12,1,Counter,pass
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Shared state
+var (
+	mu     sync.Mutex
+	counts = map[string]int{} // counts by key
+)
+
+// Add increments the count for the given key.
+func Add(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+	counts[key]++
+}
+
+func get(key string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return counts[key]
+}
+
+func report(keys ...string) {
+	for _, key := range keys {
+		fmt.Println(key, get(key))
+	}
+}
+
+func main() {
+	Add("x")
+	Add("x")
+	report("x", "y")
+}
@@ -0,0 +1,19 @@
+package main //<<<<<service,5,1,8,1,Cache,fail
+
+import "fmt"
+
+var (
+	Size  = 10
+	items []string
+)
+
+func add(item string) {
+	if len(items) < Size {
+		items = append(items, item)
+	}
+}
+
+func main() {
+	add("x")
+	fmt.Println(items)
+}
@@ -0,0 +1,28 @@
+package main //<<<<<split,9,6,9,6,pass
+
+import (
+	"fmt"
+	"strings"
+)
+
+func report(text string, verbose bool) {
+	prefix := "> "
+
+	// Split the input into words
+	words := strings.Fields(text)
+	count := len(words)
+
+	// Print each word
+	for _, word := range words {
+		fmt.Println(prefix + word)
+	}
+
+	// Summarize results.
+	if verbose {
+		fmt.Println(count, "words")
+	}
+}
+
+func main() {
+	report("hello doctor", true)
+}
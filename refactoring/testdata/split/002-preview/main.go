@@ -0,0 +1,15 @@
+package main //<<<<<split,5,6,5,6,true,pass
+
+import "fmt"
+
+func greet(name string) {
+	// Build a greeting
+	msg := "hello, " + name
+
+	// Print it
+	fmt.Println(msg)
+}
+
+func main() {
+	greet("world")
+}
@@ -0,0 +1,17 @@
+package main //<<<<<split,5,6,5,6,fail
+
+import "fmt"
+
+func check(n int) {
+	// Validate the input
+	if n < 0 {
+		return
+	}
+
+	// Print the input
+	fmt.Println(n)
+}
+
+func main() {
+	check(1)
+}
@@ -0,0 +1,45 @@
+package main //<<<<<subtests,15,6,15,6,pass
+
+import (
+	"strconv"
+	"testing"
+)
+
+type parser struct{ base int }
+
+func (p *parser) parse(s string) (int, error) {
+	n, err := strconv.ParseInt(s, p.base, 64)
+	return int(n), err
+}
+
+func TestParse(t *testing.T) {
+	p := &parser{base: 10}
+
+	// valid input
+	got, err := p.parse("42")
+	if err != nil || got != 42 {
+		t.Errorf("got %d, %v", got, err)
+	}
+
+	// invalid input
+	_, err = p.parse("x")
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	got, err = p.parse("-1") // negative
+	if got != -1 {
+		t.Errorf("got %d, %v", got, err)
+	}
+
+	// zero.
+	got = 0
+	if got != 0 {
+		t.Error(got)
+	}
+
+	p.base = 0
+}
+
+func main() {
+}
@@ -0,0 +1,24 @@
+package main //<<<<<subtests,13,2,17,2,first entry,pass
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	var fields []string
+	fields = strings.Fields("a b  c")
+	var count float64
+	// check the count
+	count = float64(len(fields))
+	if count != 3 {
+		t.Fatalf("got %v", count)
+	}
+	t.Log(fields[0])
+	fields = nil
+	count = 1
+	t.Log(fields, count)
+}
+
+func main() {
+}
@@ -0,0 +1,22 @@
+package main //<<<<<subtests,12,2,16,27,fail
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTemp(t *testing.T) {
+	dir := os.TempDir()
+	t.Log(dir)
+
+	f, err := os.CreateTemp(dir, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	t.Log(dir)
+}
+
+func main() {
+}
@@ -0,0 +1,22 @@
+package main //<<<<<swapargs,21,30,21,33,pass
+
+import "fmt"
+
+type shape struct{}
+
+func (s shape) label(name string, width, height int, unit string) string {
+	return fmt.Sprintf("%s: %dx%d %s", name, width, height, unit)
+}
+
+func area(width, height int) int {
+	return width * height
+}
+
+func main() {
+	var s shape
+	fmt.Println(s.label("box", 3, 4, "m"))
+	fmt.Println(s.label("square", 2, 2, "cm"))
+	w, h := 5, 6
+	fmt.Println(area(w, h))
+	fmt.Println(s.label("tall", w, h, "in"))
+}
@@ -0,0 +1,7 @@
+package main //<<<<<swapargs,6,14,6,27,pass
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello", "world")
+}
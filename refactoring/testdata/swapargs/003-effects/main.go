@@ -0,0 +1,13 @@
+package main //<<<<<swapargs,12,14,12,30,fail
+
+import "fmt"
+
+func next(counter *int) int {
+	*counter++
+	return *counter
+}
+
+func main() {
+	n := 0
+	fmt.Println(next(&n), next(&n))
+}
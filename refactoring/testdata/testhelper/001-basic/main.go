@@ -0,0 +1,31 @@
+package main //<<<<<testhelper,17,2,27,2,checkParse,pass
+
+import (
+	"strconv"
+	"testing"
+)
+
+func parse(s string) (int, error) {
+	return strconv.Atoi(s)
+}
+
+func TestParse(t *testing.T) {
+	inputs := map[string]int{
+		"1":  1,
+		"42": 42,
+	}
+	for input, want := range inputs {
+		t.Logf("parsing %s", input)
+		got, err := parse(input)
+		if err != nil {
+			t.Errorf("parse(%q) failed: %v", input, err)
+			return
+		}
+		if got != want {
+			t.Errorf("parse(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
+
+func main() {
+}
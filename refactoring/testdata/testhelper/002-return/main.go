@@ -0,0 +1,19 @@
+package main //<<<<<testhelper,11,2,14,2,checkEmpty,fail
+
+import "testing"
+
+func TestEmpty(t *testing.T) {
+	var s []int
+	s = append(s, 1)
+	if len(s) == 0 {
+		t.Log("empty")
+	}
+	if len(s) > 1 {
+		t.Log("too long")
+		return
+	}
+	t.Log(s)
+}
+
+func main() {
+}
@@ -0,0 +1,12 @@
+// <<<<< toggle,10,3,10,15,pass
+package main
+
+import "fmt"
+import "broken"
+
+// Test for toggling a declaration when a different package contains a type
+// error; the error is reported as a warning, and the refactoring proceeds
+func main() {
+  var i int = 3
+  fmt.Println("value of i is", i, broken.Value())
+}
@@ -0,0 +1,10 @@
+package broken
+
+func Value() int {
+	return 1
+}
+
+func Unrelated() {
+	var s string = 5
+	_ = s
+}
@@ -0,0 +1,16 @@
+// <<<<< toggle,9,3,9,15,fail
+package main
+
+import "fmt"
+
+// Test for toggling a declaration when the same package contains a type
+// error, which prevents the refactoring from proceeding
+func main() {
+  var i int = 3
+  fmt.Println("value of i is", i)
+}
+
+func unrelated() {
+  var s string = 5
+  _ = s
+}
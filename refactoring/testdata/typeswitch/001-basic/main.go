@@ -0,0 +1,47 @@
+package main //<<<<<typeswitch,35,2,42,3,Describe,pass
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Shape is a geometric shape.
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ side float64 }
+
+type Circle struct{ r float64 }
+
+type Empty struct{}
+
+func (s Square) Area() float64  { return s.side * s.side }
+func (c *Circle) Area() float64 { return math.Pi * c.r * c.r }
+func (Empty) Area() float64     { return 0 }
+
+func show(w io.Writer, shapes ...Shape) {
+	for _, s := range shapes {
+		fmt.Fprint(w, "Shape: ")
+		describe(w, s, "\n")
+	}
+}
+
+func describe(w io.Writer, shape Shape, suffix string) {
+	precision := 2
+	// Describe the shape
+	switch s := shape.(type) {
+	case Square:
+		// A square
+		fmt.Fprintf(w, "square with side %.*f%s", precision, s.side, suffix)
+	case *Circle:
+		fmt.Fprintf(w, "circle with radius %.*f%s", precision, s.r, suffix)
+	case Empty: fmt.Fprint(w, "nothing", suffix)
+	}
+}
+
+func main() {
+	show(os.Stdout, Square{2}, &Circle{1}, Empty{})
+}
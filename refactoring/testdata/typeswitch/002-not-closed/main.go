@@ -0,0 +1,30 @@
+package main //<<<<<typeswitch,19,2,24,3,Name,fail
+
+import "fmt"
+
+type Animal interface {
+	Sound() string
+}
+
+type Dog struct{}
+type Cat struct{}
+type Cow struct{}
+
+func (Dog) Sound() string { return "woof" }
+func (Cat) Sound() string { return "meow" }
+func (Cow) Sound() string { return "moo" }
+
+func name(a Animal) string {
+	result := ""
+	switch a.(type) {
+	case Dog:
+		result = "dog"
+	case Cat:
+		result = "cat"
+	}
+	return result
+}
+
+func main() {
+	fmt.Println(name(Dog{}), name(Cow{}))
+}
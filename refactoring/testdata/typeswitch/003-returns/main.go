@@ -0,0 +1,36 @@
+package main //<<<<<typeswitch,23,2,30,3,Perimeter,pass
+
+import (
+	"fmt"
+	"math"
+)
+
+type Shape interface{ Name() string }
+
+type Square struct{ side float64 }
+
+type Circle struct{ r float64 }
+
+func (Square) Name() string { return "square" }
+func (Circle) Name() string { return "circle" }
+
+func perimeter(shape Shape, scale float64) (float64, error) {
+	if scale <= 0 {
+		return 0, fmt.Errorf("invalid scale %f", scale)
+	}
+	sum := func(xs ...float64) float64 { return xs[0] + xs[1] }
+	fmt.Println(sum(1, 2))
+	switch shape := shape.(type) {
+	case Square:
+		return 4 * shape.side * scale, nil
+	case Circle:
+		return 2 * math.Pi * shape.r * scale, nil
+	default:
+		panic("unknown shape")
+	}
+}
+
+func main() {
+	fmt.Println(perimeter(Square{1}, 2))
+	fmt.Println(perimeter(Circle{1}, 1))
+}
@@ -0,0 +1,27 @@
+package main //<<<<<unnameresults,6,6,6,10,pass
+
+import "fmt"
+
+// count returns the number of letters in s and whether it is not empty.
+func count(s string) (n int, ok bool) {
+	for range s {
+		n++
+	}
+	if n > 10 {
+		return 10, true
+	}
+	ok = n > 0
+	return
+}
+
+func div(a, b int) (q, r int, err error) {
+	if b == 0 {
+		return 0, 0, fmt.Errorf("division by zero")
+	}
+	return a / b, a % b, nil
+}
+
+func main() {
+	fmt.Println(count("hello"))
+	fmt.Println(div(7, 2))
+}
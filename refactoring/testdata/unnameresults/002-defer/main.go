@@ -0,0 +1,21 @@
+package main //<<<<<unnameresults,9,6,9,8,pass
+
+import (
+	"errors"
+	"fmt"
+)
+
+func run(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("panic")
+		}
+		fmt.Println("done:", err)
+	}()
+	f()
+	return nil
+}
+
+func main() {
+	fmt.Println(run(func() {}))
+}
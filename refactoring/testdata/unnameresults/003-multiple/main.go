@@ -0,0 +1,16 @@
+package main //<<<<<unnameresults,5,6,5,8,pass
+
+import "fmt"
+
+func div(a, b int) (q, r int, err error) {
+	if b == 0 {
+		err = fmt.Errorf("division by zero")
+		return
+	}
+	q, r = a/b, a%b
+	return
+}
+
+func main() {
+	fmt.Println(div(7, 2))
+}
@@ -0,0 +1,11 @@
+package main //<<<<<unnameresults,5,6,5,9,fail
+
+import "fmt"
+
+func read() (_ int, err error) {
+	return 0, nil
+}
+
+func main() {
+	fmt.Println(read())
+}
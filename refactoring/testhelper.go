@@ -0,0 +1,365 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that extracts statements in a test into a
+// test helper function.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/loader"
+)
+
+// ExtractTestHelper is a refactoring that extracts the selected statements in
+// a test function into a new helper function, like the Extract Function
+// refactoring, but (1) the test's *testing.T (or *testing.B) is always passed
+// as the first argument, (2) the helper begins by calling t.Helper(), so
+// failures are reported at the line of the call, and (3) a failure followed
+// by a return statement, which would stop the test, becomes a fatal failure
+// in the helper, e.g.,
+//     t.Errorf("bad value: %d", v)
+//     return
+// becomes t.Fatalf("bad value: %d", v).
+type ExtractTestHelper struct {
+	ExtractFunc
+	// The parameter of the test function with type *testing.T or *testing.B
+	t *types.Var
+	// The return statements that are removed, and edits to the text of the
+	// selected statements
+	returns map[ast.Stmt]bool
+	edits   []regionEdit
+}
+
+// fatalForms maps methods of testing.TB that report a failure to the
+// corresponding methods that also stop the test.  Skip, Skipf, and SkipNow
+// already stop the test, so a following return statement is simply removed.
+var fatalForms = map[string]string{
+	"Error":   "Fatal",
+	"Errorf":  "Fatalf",
+	"Fail":    "FailNow",
+	"Fatal":   "Fatal",
+	"Fatalf":  "Fatalf",
+	"FailNow": "FailNow",
+	"Skip":    "Skip",
+	"Skipf":   "Skipf",
+	"SkipNow": "SkipNow",
+}
+
+func (r *ExtractTestHelper) Description() *Description {
+	return &Description{
+		Name:      "Extract Test Helper",
+		Synopsis:  "Extracts statements in a test to a new test helper function",
+		Usage:     "<new_name>",
+		Selection: "A sequence of statements in a test function",
+		HTMLDoc:   extractTestHelperDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Name:",
+			Prompt:       "Enter a name for the new helper function.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *ExtractTestHelper) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.funcName = config.Args[0].(string)
+	if !isIdentifierValid(r.funcName) {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+			r.funcName)
+		r.Log.AssociateArg(0)
+		return &r.Result
+	}
+	r.returns, r.edits = map[ast.Stmt]bool{}, nil
+
+	var err error
+	r.stmtRange, err = newStmtRange(r.File, r.SelectionStart, r.SelectionEnd, r.SelectedNodePkg)
+	if err != nil {
+		r.Log.Error(err)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if r.stmtRange.IsInAnonymousFunc() {
+		r.Log.Error("Code inside an anonymous function cannot be extracted.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	if !r.findTestParam() || !r.convertReturns() || !r.checkControlFlow() {
+		return &r.Result
+	}
+
+	imports := r.ImportResolver()
+	f := r.createExtractedFunc(imports)
+	params := []*types.Var{r.t}
+	for _, v := range f.params {
+		if v != r.t {
+			params = append(params, v)
+		}
+	}
+	f.params = params
+	f.code = []byte(r.t.Name() + ".Helper()\n" + r.helperCode())
+	funcDecl, funcCall := f.SourceCode()
+
+	r.Edits[r.Filename].Add(r.Extent(r.stmtRange), funcCall)
+	next := r.OffsetOfPos(r.stmtRange.enclosingFunc.End())
+	r.Edits[r.Filename].Add(&text.Extent{Offset: next, Length: 0}, funcDecl)
+	if err := imports.AddEdits(r.Edits[r.Filename]); err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	r.FormatFileInEditor()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findTestParam finds the parameter of the function enclosing the selection
+// whose type is *testing.T or *testing.B, returning false (after logging an
+// error) if there is none.
+func (r *ExtractTestHelper) findTestParam() bool {
+	decl := r.stmtRange.enclosingFunc
+	if r.t = testingParam(r.SelectedNodePkg, decl.Type); r.t != nil {
+		return true
+	}
+	r.Log.Errorf("%s does not have a named parameter of type *testing.T "+
+		"or *testing.B", decl.Name.Name)
+	r.Log.AssociateNode(decl.Type)
+	return false
+}
+
+// testingParam returns the first named parameter of the given function type
+// whose type is *testing.T or *testing.B, or nil if there is none.
+func testingParam(pkgInfo *loader.PackageInfo, ftype *ast.FuncType) *types.Var {
+	for _, field := range ftype.Params.List {
+		for _, name := range field.Names {
+			v, _ := pkgInfo.Defs[name].(*types.Var)
+			if v != nil && name.Name != "_" && isTestingPtr(v.Type()) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// isTestingPtr returns true if the given type is *testing.T or *testing.B.
+func isTestingPtr(t types.Type) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := types.Unalias(ptr.Elem()).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil ||
+		named.Obj().Pkg().Path() != "testing" {
+		return false
+	}
+	return named.Obj().Name() == "T" || named.Obj().Name() == "B"
+}
+
+// convertReturns finds the return statements in the selection, each of which
+// must follow a call that reports a failure (or skips the test), and records
+// edits that remove it and make the call stop the test.  It returns false
+// (after logging an error) if a return statement cannot be converted.
+func (r *ExtractTestHelper) convertReturns() bool {
+	ok := true
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if !ok {
+			return false
+		}
+		if _, isFuncLit := n.(*ast.FuncLit); isFuncLit {
+			return false
+		}
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		}
+		for i, stmt := range list {
+			if _, isReturn := stmt.(*ast.ReturnStmt); isReturn {
+				if i == 0 || !r.convertFailure(list[i-1], stmt) {
+					r.Log.Error("A return statement can only be " +
+						"extracted if it follows a call to " +
+						r.t.Name() + ".Error, Errorf, Fail, or Skip")
+					r.Log.AssociateNode(stmt)
+					ok = false
+				}
+			}
+		}
+		return ok
+	})
+	// Return statements directly in the selection are not in a block
+	// inside it, so check them separately
+	stmts := r.stmtRange.selectedStmts()
+	for i, stmt := range stmts {
+		if _, isReturn := stmt.(*ast.ReturnStmt); isReturn && ok {
+			if i == 0 || !r.convertFailure(stmts[i-1], stmt) {
+				r.Log.Error("A return statement can only be extracted " +
+					"if it follows a call to " + r.t.Name() +
+					".Error, Errorf, Fail, or Skip")
+				r.Log.AssociateNode(stmt)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// convertFailure records edits that remove the given return statement and
+// make the given call (which precedes it) stop the test, returning false if
+// the call is not a method call on the test's *testing.T that reports a
+// failure or skips the test.
+func (r *ExtractTestHelper) convertFailure(prev, ret ast.Stmt) bool {
+	if len(ret.(*ast.ReturnStmt).Results) > 0 {
+		return false
+	}
+	expr, ok := prev.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := expr.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	recv, ok := sel.X.(*ast.Ident)
+	if !ok || r.SelectedNodePkg.Uses[recv] != r.t {
+		return false
+	}
+	fatal, ok := fatalForms[sel.Sel.Name]
+	if !ok {
+		return false
+	}
+	if fatal != sel.Sel.Name {
+		r.edits = append(r.edits, regionEdit{sel.Sel.Pos(), sel.Sel.End(), fatal})
+	}
+	r.edits = append(r.edits, regionEdit{prev.End(), ret.End(), ""})
+	r.returns[ret] = true
+	return true
+}
+
+// checkControlFlow returns false (after logging an error) if the selection
+// contains a defer statement, or if control can flow into or out of the
+// selection other than by executing it from beginning to end (ignoring the
+// return statements that are removed).
+func (r *ExtractTestHelper) checkControlFlow() bool {
+	problem := ""
+	exits := map[ast.Stmt]bool{}
+	for _, b := range r.stmtRange.blocksInRange {
+		if r.returns[b] {
+			continue
+		}
+		for _, succ := range r.stmtRange.cfg.Succs(b) {
+			if !r.stmtRange.Contains(succ) {
+				exits[succ] = true
+			}
+		}
+	}
+	switch {
+	case r.stmtRange.ContainsDefer():
+		problem = "contain a defer statement"
+	case len(r.stmtRange.EntryPoints()) > 1:
+		problem = "have multiple control flow paths into them"
+	case len(exits) > 1:
+		problem = "have multiple control flow paths out of them"
+	}
+	if problem != "" {
+		r.Log.Errorf("The selected statements cannot be extracted "+
+			"because they %s", problem)
+		r.Log.AssociatePos(r.stmtRange.Pos(), r.stmtRange.End())
+		return false
+	}
+	if r.stmtRange.ContainsAnonymousFunc() {
+		r.Log.Warn("Code containing anonymous functions may not " +
+			"extract correctly.")
+		r.Log.AssociatePos(r.stmtRange.Pos(), r.stmtRange.End())
+	}
+	return true
+}
+
+// helperCode returns the text of the selected statements with the edits that
+// convert failures applied.
+func (r *ExtractTestHelper) helperCode() string {
+	start := r.stmtRange.Pos()
+	code := r.TextFromPosRange(start, r.stmtRange.End())
+	return strings.TrimSpace(applyEdits(code, start, r.edits))
+}
+
+const extractTestHelperDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Test Helper refactoring extracts a sequence of statements in
+  a test function into a new helper function.  It is like the Extract
+  Function refactoring, but it is tailored to tests: the test's
+  <tt>*testing.T</tt> (or <tt>*testing.B</tt>) is always passed as the first
+  argument, the helper calls <tt>t.Helper()</tt> so failures are reported at
+  the line where the helper is called, and a failure followed by a return
+  statement becomes a fatal failure.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a sequence of statements inside a test function.</li>
+    <li>Activate the Extract Test Helper refactoring.</li>
+    <li>Enter a name for the new helper function.</li>
+  </ol>
+
+  <p>A return statement in the selected statements must immediately follow a
+  call to <tt>t.Error</tt>, <tt>t.Errorf</tt>, <tt>t.Fail</tt>, or one of
+  the <tt>Skip</tt> or <tt>Fatal</tt> methods.  The return statement is
+  removed, and the call is replaced by the corresponding method that stops
+  the test (<tt>Fatal</tt>, <tt>Fatalf</tt>, or <tt>FailNow</tt>), which
+  has the same effect inside the helper.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of extracting the statements
+  that check the result of <tt>parse</tt> into <tt>checkParse</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func TestParse(t *testing.T) {
+    v, err := parse("42")
+    if err != nil {
+        t.Errorf("parse failed: %v", err)
+        return
+    }
+    if v != 42 {
+        t.Errorf("got %d", v)
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func TestParse(t *testing.T) {
+    checkParse(t)
+}
+
+func checkParse(t *testing.T) {
+    t.Helper()
+    v, err := parse("42")
+    if err != nil {
+        t.Fatalf("parse failed: %v", err)
+    }
+    if v != 42 {
+        t.Errorf("got %d", v)
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -49,15 +49,41 @@
 // replaced by \n\n.  This is used by the formatter tests, since go/printer's
 // behavior changed between versions.
 //
+// Line endings are normally ignored when the output is compared against the
+// .golden file, so the tests pass when git converts line endings on checkout.
+// If filename.go.exactLineEndings exists, they are compared as well; this is
+// used to test that refactorings preserve a file's line endings.
+//
 // To test the Debug refactoring, include a file named filename.go.debugOutput
 // containing the output that is expected to be written to Result.DebugOutput.
 // The actual debug output usually includes absolute paths; to be testable,
 // all occurrences of the current working directory are replaced with "." when
 // comparing against this file.
+//
+// Refactorings that move, create, or remove files (see Result.FSChanges) are
+// tested by including a file named filename.go.fsChanges, which lists the
+// expected changes, one per line, with paths relative to the current working
+// directory.  Edits are still compared against the .golden files for the
+// original filenames.
+//
+// The diagnostics a refactoring logs (errors, warnings, and informational
+// messages) can be tested by including a file named filename.go.logOutput
+// containing the expected contents of the log, in the format written by
+// Log.Write, with filenames relative to the current working directory.  This
+// is most useful for refactorings that are expected to fail.
+//
+// Each test directory is run as a subtest named after its path relative to the
+// testdata directory, so a failure in one directory does not prevent the
+// others from running, and individual tests can also be selected with, e.g.,
+//     go test -run=TestRefactorings/rename/003
+// When all of the tests are run, every registered refactoring (see
+// engine.AllRefactoringNames) must be invoked by at least one marker, so new
+// refactorings cannot go untested.
 
 package testutil
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/parser"
@@ -85,16 +111,35 @@ var filterFlag = flag.String("filter", "",
 	"Only tests from directories containing this substring will be run")
 
 func TestRefactorings(directory string, t *testing.T) {
+	text.CheckInvariants = true
 	testDirs, err := ioutil.ReadDir(directory)
 	failIfError(err, t)
+	tested := map[string]bool{}
 	for _, testDirInfo := range testDirs {
 		if testDirInfo.IsDir() {
-			runAllTestsInSubdirectories(directory, testDirInfo, t)
+			runAllTestsInSubdirectories(directory, testDirInfo, tested, t)
 		}
 	}
+	if *filterFlag == "" && runFlag() == "" && len(tested) > 0 {
+		for _, shortName := range engine.AllRefactoringNames() {
+			if !tested[shortName] {
+				t.Errorf("No tests in %s invoke the %s refactoring",
+					directory, shortName)
+			}
+		}
+	}
+}
+
+// runFlag returns the value of go test's -run flag, which may select only
+// some of the subtests run by TestRefactorings.
+func runFlag() string {
+	if f := flag.Lookup("test.run"); f != nil {
+		return f.Value.String()
+	}
+	return ""
 }
 
-func runAllTestsInSubdirectories(directory string, testDirInfo os.FileInfo, t *testing.T) {
+func runAllTestsInSubdirectories(directory string, testDirInfo os.FileInfo, tested map[string]bool, t *testing.T) {
 	testDirPath := filepath.Join(directory, testDirInfo.Name())
 	subDirs, err := ioutil.ReadDir(testDirPath)
 	failIfError(err, t)
@@ -102,19 +147,23 @@ func runAllTestsInSubdirectories(directory string, testDirInfo os.FileInfo, t *t
 		if subDirInfo.IsDir() {
 			subDirPath := filepath.Join(testDirPath, subDirInfo.Name())
 			if strings.Contains(subDirPath, *filterFlag) {
-				runAllTestsInDirectory(subDirPath, t)
+				testName := testDirInfo.Name() + "/" + subDirInfo.Name()
+				t.Run(testName, func(t *testing.T) {
+					runAllTestsInDirectory(subDirPath, tested, t)
+				})
 			}
 		}
 	}
 }
 
 // RunAllTests is a utility method that runs a set of refactoring tests
-// based on markers in all of the files in subdirectories of a given directory
-func runAllTestsInDirectory(directory string, t *testing.T) {
+// based on markers in all of the files in subdirectories of a given directory.
+// The name of each refactoring that is run is added to tested.
+func runAllTestsInDirectory(directory string, tested map[string]bool, t *testing.T) {
 	files, err := recursiveReadDir(directory)
 	failIfError(err, t)
 
-	runTestsInFiles(directory, files, t)
+	runTestsInFiles(directory, files, tested, t)
 }
 
 // Assumes no duplication or circularity due to symbolic links
@@ -151,7 +200,7 @@ func failIfError(err error, t *testing.T) {
 	}
 }
 
-func runTestsInFiles(directory string, files []string, t *testing.T) {
+func runTestsInFiles(directory string, files []string, tested map[string]bool, t *testing.T) {
 	markers := make(map[string][]string)
 	for _, path := range files {
 		if strings.HasSuffix(path, ".go") {
@@ -167,6 +216,7 @@ func runTestsInFiles(directory string, files []string, t *testing.T) {
 
 	for path, markersInFile := range markers {
 		for _, marker := range markersInFile {
+			tested[strings.SplitN(marker, ",", 2)[0]] = true
 			runRefactoring(directory, path, marker, t)
 		}
 	}
@@ -221,6 +271,23 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 		t.Fatalf("Refactoring should have produced errors but didn't")
 	}
 
+	logOutputFilename := filename + ".logOutput"
+	if exists(logOutputFilename, t) {
+		var log bytes.Buffer
+		result.Log.Write(&log, cwd)
+		bytes, err := ioutil.ReadFile(logOutputFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedOutput := sanitize(string(bytes), false)
+		actualOutput := sanitize(log.String(), true)
+		if expectedOutput != actualOutput {
+			fmt.Printf(">>>>> Log does not match contents of %s\n", logOutputFilename)
+			showExpectedAndActual(expectedOutput, actualOutput)
+			t.Fatalf("Refactoring test failed - %s", filename)
+		}
+	}
+
 	debugOutput := result.DebugOutput.String()
 	if len(debugOutput) > 0 {
 		debugOutputFilename := filename + ".debugOutput"
@@ -238,6 +305,24 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 		}
 	}
 
+	fsChangesFilename := filename + ".fsChanges"
+	if shouldPass && (len(result.FSChanges) > 0 || exists(fsChangesFilename, t)) {
+		bytes, err := ioutil.ReadFile(fsChangesFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedOutput := sanitize(string(bytes), false)
+		actualOutput := ""
+		for _, change := range result.FSChanges {
+			actualOutput += change.String(cwd) + "\n"
+		}
+		if expectedOutput != actualOutput {
+			fmt.Printf(">>>>> File system changes do not match contents of %s\n", fsChangesFilename)
+			showExpectedAndActual(expectedOutput, actualOutput)
+			t.Fatalf("Refactoring test failed - %s", filename)
+		}
+	}
+
 	err = filepath.Walk(directory,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -294,8 +379,11 @@ func checkResult(filename string, actualOutput string, t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedOutput := strings.Replace(string(bytes), "\r\n", "\n", -1)
-	actualOutput = strings.Replace(actualOutput, "\r\n", "\n", -1)
+	expectedOutput := string(bytes)
+	if !exists(filename+".exactLineEndings", t) {
+		expectedOutput = strings.Replace(expectedOutput, "\r\n", "\n", -1)
+		actualOutput = strings.Replace(actualOutput, "\r\n", "\n", -1)
+	}
 	if exists(filename+".fixWhitespace", t) {
 		expectedOutput = strings.TrimSpace(expectedOutput)
 		actualOutput = strings.TrimSpace(actualOutput)
@@ -32,6 +32,7 @@ func (r *ToggleVar) Description() *Description {
 		Name:           "Toggle var ⇔ :=",
 		Synopsis:       "Toggles between a var declaration and := statement",
 		Usage:          "",
+		Selection:      "A short assignment or var declaration",
 		HTMLDoc:        toggleVarDoc,
 		Multifile:      false,
 		Params:         nil,
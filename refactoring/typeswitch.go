@@ -0,0 +1,698 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that replaces a type switch over the
+// implementations of an interface with a call to a new method of the
+// interface.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/members"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// ReplaceTypeSwitch is a refactoring that replaces a type switch on a value of
+// an interface type with a call to a new method of that interface.  The body
+// of each case becomes the method's implementation for the case's type, with
+// the variable declared by the switch (if any) as its receiver.  Local
+// variables of the enclosing function that the cases read become parameters
+// of the method.
+//
+// The switch must handle every type in the program (outside $GOROOT) that
+// implements the interface (so the set of types is closed), each case must
+// list a single named type declared in the same package as the switch, and
+// the cases may not assign local variables of the enclosing function or
+// branch outside the switch.  They may return only if the switch is the last statement of the
+// enclosing function, in which case the method returns the function's
+// results.
+type ReplaceTypeSwitch struct {
+	RefactoringBase
+	// The type switch and the function enclosing it
+	stmt      *ast.TypeSwitchStmt
+	funcType  *ast.FuncType
+	funcSig   *types.Signature
+	funcBody  *ast.BlockStmt
+	topLevel  *ast.FuncDecl
+	assert    *ast.TypeAssertExpr
+	bound     *ast.Ident
+	iface     *types.TypeName
+	ifaceSpec *ast.TypeSpec
+	// The cases, the types they handle, and the default case, if any
+	clauses     []*ast.CaseClause
+	caseTypes   []types.Type
+	defaultCase *ast.CaseClause
+	// The local variables passed as arguments, sorted by position
+	params []*types.Var
+	// True if the method returns the enclosing function's results
+	returns bool
+}
+
+func (r *ReplaceTypeSwitch) Description() *Description {
+	return &Description{
+		Name:      "Replace Type Switch with Method",
+		Synopsis:  "Replaces a type switch with a method implemented by each type",
+		Usage:     "<method_name>",
+		Selection: "A type switch statement",
+		HTMLDoc:   replaceTypeSwitchDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Method Name:",
+			Prompt:       "Name of the method to add to the interface.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+	}
+}
+
+func (r *ReplaceTypeSwitch) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	name := config.Args[0].(string)
+	r.clauses, r.caseTypes, r.defaultCase = nil, nil, nil
+	r.params, r.returns = nil, false
+
+	if !r.findSwitch() || !r.findInterface() || !r.findCases() ||
+		!r.checkCoverage() || !r.checkName(name) || !r.checkBodies() {
+		return &r.Result
+	}
+	r.Log.Infof("Adding method %s to %s and %d type(s)", name,
+		r.iface.Name(), len(r.clauses))
+	if r.defaultCase != nil {
+		r.Log.Warnf("The default case is removed; it is only executed "+
+			"if the value is nil, and calling %s on a nil %s will "+
+			"panic", name, r.iface.Name())
+		r.Log.AssociateNode(r.defaultCase)
+	}
+
+	if !r.addInterfaceMethod(config, name) || !r.addMethods(config, name) {
+		return &r.Result
+	}
+
+	r.finishMigrations()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findSwitch finds the selected type switch and the function enclosing it,
+// returning false (after logging an error) if there is none.
+func (r *ReplaceTypeSwitch) findSwitch() bool {
+	r.stmt, r.funcType, r.funcSig = nil, nil, nil
+	r.funcBody, r.topLevel = nil, nil
+	for _, node := range r.PathEnclosingSelection {
+		switch node := node.(type) {
+		case *ast.TypeSwitchStmt:
+			if r.stmt == nil {
+				r.stmt = node
+			}
+		case *ast.FuncLit:
+			if r.stmt != nil && r.funcType == nil {
+				r.funcType, r.funcBody = node.Type, node.Body
+				r.funcSig, _ = r.SelectedNodePkg.TypeOf(node).(*types.Signature)
+			}
+		case *ast.FuncDecl:
+			if r.stmt != nil && r.funcType == nil {
+				r.funcType, r.funcBody = node.Type, node.Body
+				if obj := r.SelectedNodePkg.Defs[node.Name]; obj != nil {
+					r.funcSig, _ = obj.Type().(*types.Signature)
+				}
+			}
+			r.topLevel = node
+		}
+	}
+	if r.stmt == nil || r.topLevel == nil || r.funcSig == nil {
+		r.Log.Error("Please select a type switch statement.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	if r.stmt.Init != nil {
+		r.Log.Error("A type switch with an initialization statement " +
+			"cannot be replaced")
+		r.Log.AssociateNode(r.stmt.Init)
+		return false
+	}
+	if r.topLevel.Type.TypeParams != nil || (r.topLevel.Recv != nil &&
+		r.SelectedNodePkg.Defs[r.topLevel.Name].Type().(*types.Signature).RecvTypeParams().Len() > 0) {
+		r.Log.Errorf("%s is generic, so the type switch cannot be "+
+			"replaced", r.topLevel.Name.Name)
+		r.Log.AssociateNode(r.topLevel.Name)
+		return false
+	}
+	switch assign := r.stmt.Assign.(type) {
+	case *ast.AssignStmt:
+		r.bound = assign.Lhs[0].(*ast.Ident)
+		r.assert = assign.Rhs[0].(*ast.TypeAssertExpr)
+	case *ast.ExprStmt:
+		r.bound = nil
+		r.assert = assign.X.(*ast.TypeAssertExpr)
+	}
+	return true
+}
+
+// findInterface finds the interface type of the value being switched on and
+// its declaration, returning false (after logging an error) if it is not an
+// interface to which a method can be added.
+func (r *ReplaceTypeSwitch) findInterface() bool {
+	r.iface, r.ifaceSpec = nil, nil
+	named, ok := types.Unalias(r.SelectedNodePkg.TypeOf(r.assert.X)).(*types.Named)
+	if !ok || named.Obj().Pkg() != r.SelectedNodePkg.Pkg {
+		r.Log.Errorf("The type of %s must be an interface declared in "+
+			"package %s", types.ExprString(r.assert.X),
+			r.SelectedNodePkg.Pkg.Name())
+		r.Log.AssociateNode(r.assert.X)
+		return false
+	}
+	r.iface = named.Obj()
+	if named.TypeParams().Len() > 0 {
+		r.Log.Errorf("%s is generic, so a method cannot be added to it",
+			r.iface.Name())
+		r.Log.AssociateNode(r.assert.X)
+		return false
+	}
+	if file := fileContaining(r.SelectedNodePkg, r.iface.Pos()); file != nil {
+		path, _ := astutil.PathEnclosingInterval(file, r.iface.Pos(), r.iface.Pos())
+		for _, node := range path {
+			if spec, ok := node.(*ast.TypeSpec); ok {
+				if _, ok := spec.Type.(*ast.InterfaceType); ok {
+					r.ifaceSpec = spec
+				}
+				break
+			}
+		}
+	}
+	if r.ifaceSpec == nil {
+		r.Log.Errorf("%s is not declared by an interface type literal, "+
+			"so a method cannot be added to it", r.iface.Name())
+		r.Log.AssociateNode(r.assert.X)
+		return false
+	}
+	return true
+}
+
+// findCases finds the type handled by each case of the switch, returning
+// false (after logging an error) if a case does not handle exactly one named
+// type declared in the selected package.
+func (r *ReplaceTypeSwitch) findCases() bool {
+	for _, stmt := range r.stmt.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			r.defaultCase = clause
+			continue
+		}
+		if len(clause.List) > 1 {
+			r.Log.Error("Each case must handle a single type")
+			r.Log.AssociateNode(clause)
+			return false
+		}
+		t := r.SelectedNodePkg.TypeOf(clause.List[0])
+		if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		named, _ := types.Unalias(t).(*types.Named)
+		if named == nil || types.IsInterface(named) ||
+			named.Obj().Pkg() != r.SelectedNodePkg.Pkg ||
+			named.TypeParams().Len() > 0 {
+			r.Log.Errorf("%s is not a non-generic, non-interface type "+
+				"declared in package %s, so a method cannot be "+
+				"added to it", types.ExprString(clause.List[0]),
+				r.SelectedNodePkg.Pkg.Name())
+			r.Log.AssociateNode(clause.List[0])
+			return false
+		}
+		r.clauses = append(r.clauses, clause)
+		r.caseTypes = append(r.caseTypes,
+			types.Unalias(r.SelectedNodePkg.TypeOf(clause.List[0])))
+	}
+	if len(r.clauses) == 0 {
+		r.Log.Error("The type switch has no cases")
+		r.Log.AssociateNode(r.stmt)
+		return false
+	}
+	return true
+}
+
+// checkCoverage returns false (after logging an error) if a package-level
+// type in the program (outside $GOROOT) implements the interface but is not
+// handled by a case of the switch, or is handled as *T although T implements
+// the interface (so adding a method with a pointer receiver would prevent T
+// from implementing it).
+func (r *ReplaceTypeSwitch) checkCoverage() bool {
+	handled := map[string]bool{}
+	for _, t := range r.caseTypes {
+		handled[types.TypeString(t, nil)] = true
+	}
+	it := r.iface.Type().Underlying().(*types.Interface)
+	for _, want := range r.implementers(it) {
+		if !handled[types.TypeString(want, nil)] {
+			r.Log.Errorf("%s implements %s but is not handled by "+
+				"a case of the type switch",
+				types.TypeString(want, types.RelativeTo(r.SelectedNodePkg.Pkg)),
+				r.iface.Name())
+			r.Log.AssociateNode(r.stmt)
+			return false
+		}
+	}
+	return true
+}
+
+// implementers returns the package-level types in the program (outside
+// $GOROOT) that implement the given interface: T if T implements it, or *T if
+// only *T implements it.  Types in $GOROOT are not considered, since they are
+// unlikely to be used as implementations of an interface in the program.
+func (r *RefactoringBase) implementers(it *types.Interface) []types.Type {
+	result := []types.Type{}
+	for _, pkgInfo := range r.migrationCandidates(func(string) bool { return false }) {
+		scope := pkgInfo.Pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() || types.IsInterface(tn.Type()) {
+				continue
+			}
+			if types.Implements(tn.Type(), it) {
+				result = append(result, tn.Type())
+			} else if types.Implements(types.NewPointer(tn.Type()), it) {
+				result = append(result, types.NewPointer(tn.Type()))
+			}
+		}
+	}
+	return result
+}
+
+// checkName returns false (after logging an error) if the method name is
+// invalid or the interface or a case type already has a field or method with
+// that name.
+func (r *ReplaceTypeSwitch) checkName(name string) bool {
+	if !isIdentifierValid(name) || isReservedWord(name) || name == "_" {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier", name)
+		r.Log.AssociateArg(0)
+		return false
+	}
+	for _, t := range append([]types.Type{r.iface.Type()}, r.caseTypes...) {
+		if obj := members.Lookup(t, r.SelectedNodePkg.Pkg, name); obj != nil {
+			r.Log.Errorf("%s already has a field or method named %s",
+				types.TypeString(t, types.RelativeTo(r.SelectedNodePkg.Pkg)),
+				name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+	}
+	return true
+}
+
+// checkBodies determines the local variables that the cases read (which will
+// become the method's parameters) and whether the method returns the
+// enclosing function's results, returning false (after logging an error) if a
+// case assigns a local variable of the enclosing function, branches outside
+// the switch, or returns when the switch is not the last statement of the
+// enclosing function.
+func (r *ReplaceTypeSwitch) checkBodies() bool {
+	list := r.funcBody.List
+	last := len(list) > 0 && list[len(list)-1] == ast.Stmt(r.stmt)
+	namedResults := r.funcType.Results != nil &&
+		len(r.funcType.Results.List) > 0 &&
+		len(r.funcType.Results.List[0].Names) > 0
+	params := map[*types.Var]bool{}
+	for _, clause := range r.clauses {
+		implicit := r.SelectedNodePkg.Implicits[clause]
+		for _, stmt := range clause.Body {
+			var bad ast.Node
+			var reason string
+			breakTargets, continueTargets := 0, 0
+			stack := []ast.Node{}
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				if n == nil {
+					top := stack[len(stack)-1]
+					breakTargets -= isBranchTarget(top, token.BREAK)
+					continueTargets -= isBranchTarget(top, token.CONTINUE)
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				if bad != nil {
+					return false
+				}
+				stack = append(stack, n)
+				breakTargets += isBranchTarget(n, token.BREAK)
+				continueTargets += isBranchTarget(n, token.CONTINUE)
+				switch n := n.(type) {
+				case *ast.FuncLit:
+					// Branches and returns in the literal do not
+					// leave the case
+					stack = stack[:len(stack)-1]
+					return false
+				case *ast.ReturnStmt:
+					if !last {
+						bad, reason = n, "returns from "+
+							"the enclosing function, but the "+
+							"switch is not its last statement"
+					} else if namedResults && len(n.Results) == 0 {
+						bad, reason = n, "returns the "+
+							"enclosing function's named results"
+					}
+				case *ast.LabeledStmt:
+					bad, reason = n, "contains a labeled statement"
+				case *ast.BranchStmt:
+					if n.Label != nil || n.Tok == token.GOTO ||
+						n.Tok == token.FALLTHROUGH ||
+						(n.Tok == token.BREAK && breakTargets == 0) ||
+						(n.Tok == token.CONTINUE && continueTargets == 0) {
+						bad, reason = n, "branches outside of "+
+							"the case"
+					}
+				}
+				return true
+			})
+			if bad == nil {
+				bad, reason = r.findParams(stmt, clause, implicit, params)
+			}
+			if bad != nil {
+				r.Log.Errorf("The type switch cannot be replaced "+
+					"because a case %s", reason)
+				r.Log.AssociateNode(bad)
+				return false
+			}
+		}
+	}
+	// If the switch is the last statement of a function with results, it
+	// must be a terminating statement, so each case returns (or panics)
+	r.returns = last && r.funcType.Results != nil &&
+		len(r.funcType.Results.List) > 0
+	for v := range params {
+		r.params = append(r.params, v)
+	}
+	sort.Slice(r.params, func(i, j int) bool {
+		return r.params[i].Pos() < r.params[j].Pos()
+	})
+	return r.checkShadowing()
+}
+
+// findParams adds the local variables of the enclosing function that are
+// referenced in the given node (in the given case) to params, returning the
+// node and a reason (after which nothing is added) if one of them is
+// assigned, has its address taken, or is not a variable.
+func (r *ReplaceTypeSwitch) findParams(node ast.Node, clause *ast.CaseClause, implicit types.Object, params map[*types.Var]bool) (ast.Node, string) {
+	pkgInfo := r.SelectedNodePkg
+	isFree := func(obj types.Object) bool {
+		if obj == nil || obj == implicit || !isLocal(obj) {
+			return false
+		}
+		if _, isLabel := obj.(*types.Label); isLabel {
+			return false
+		}
+		pos := obj.Pos()
+		return pos >= r.funcType.Pos() && pos < r.funcBody.End() &&
+			(pos < clause.Pos() || pos >= clause.End())
+	}
+	effects := effectsOf(pkgInfo, node)
+	var bad ast.Node
+	var reason string
+	ast.Inspect(node, func(n ast.Node) bool {
+		if bad != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.UnaryExpr:
+			if id, ok := astutil.Unparen(n.X).(*ast.Ident); ok &&
+				n.Op == token.AND && isFree(pkgInfo.Uses[id]) {
+				bad, reason = n, "takes the address of "+id.Name
+			}
+		case *ast.SelectorExpr:
+			id, ok := astutil.Unparen(n.X).(*ast.Ident)
+			sel := pkgInfo.Selections[n]
+			if ok && sel != nil && sel.Kind() == types.MethodVal &&
+				isFree(pkgInfo.Uses[id]) {
+				_, ptrRecv := sel.Obj().Type().(*types.Signature).Recv().Type().(*types.Pointer)
+				_, ptrVal := types.Unalias(sel.Recv()).Underlying().(*types.Pointer)
+				if ptrRecv && !ptrVal {
+					bad, reason = n, "calls a method that may "+
+						"modify "+id.Name
+				}
+			}
+		case *ast.Ident:
+			obj := pkgInfo.Uses[n]
+			if !isFree(obj) {
+				return true
+			}
+			v, ok := obj.(*types.Var)
+			if !ok {
+				bad, reason = n, "refers to the local declaration "+
+					"of "+n.Name
+			} else if effects.writes[obj] {
+				bad, reason = n, "assigns "+n.Name
+			} else {
+				params[v] = true
+			}
+		}
+		return true
+	})
+	return bad, reason
+}
+
+// checkShadowing returns false (after logging an error) if a case declares a
+// variable with the same name as a parameter or the receiver of the method,
+// which would conflict with it.
+func (r *ReplaceTypeSwitch) checkShadowing() bool {
+	names := map[string]bool{}
+	for _, v := range r.params {
+		names[v.Name()] = true
+	}
+	if r.bound != nil {
+		names[r.bound.Name] = true
+	}
+	for _, clause := range r.clauses {
+		for id, obj := range r.SelectedNodePkg.Defs {
+			if obj != nil && names[id.Name] && id.Pos() >= clause.Colon &&
+				id.End() <= clause.End() &&
+				obj.Parent() == r.SelectedNodePkg.Scopes[clause] {
+				r.Log.Errorf("The type switch cannot be replaced "+
+					"because a case declares %s, which would "+
+					"conflict with a parameter or receiver of the "+
+					"method", id.Name)
+				r.Log.AssociateNode(id)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// signature returns the parameters and results of the new method, as they
+// should be written at the given position in the given file, e.g.,
+// "(w io.Writer) int".
+func (r *ReplaceTypeSwitch) signature(m *fileMigration, pos token.Pos) string {
+	qualifier := m.imports.Qualifier(pos)
+	params := []string{}
+	for _, v := range r.params {
+		params = append(params, v.Name()+" "+types.TypeString(v.Type(), qualifier))
+	}
+	result := "(" + strings.Join(params, ", ") + ")"
+	if r.returns {
+		results := []string{}
+		for i := 0; i < r.funcSig.Results().Len(); i++ {
+			results = append(results, types.TypeString(
+				r.funcSig.Results().At(i).Type(), qualifier))
+		}
+		if len(results) == 1 {
+			result += " " + results[0]
+		} else {
+			result += " (" + strings.Join(results, ", ") + ")"
+		}
+	}
+	return result
+}
+
+// addInterfaceMethod adds the method to the interface's declaration,
+// returning false (after logging an error) if its file cannot be read.
+func (r *ReplaceTypeSwitch) addInterfaceMethod(config *Config, name string) bool {
+	file := fileContaining(r.SelectedNodePkg, r.ifaceSpec.Pos())
+	m := r.migration(config, r.SelectedNodePkg, file)
+	if m == nil {
+		return false
+	}
+	style := DetectIndentStyle(m.src)
+	it := r.ifaceSpec.Type.(*ast.InterfaceType)
+	method := name + r.signature(m, it.Pos())
+	closing := m.offset(it.Methods.Closing)
+	indent := Indentation(m.src, closing)
+	if start := closing - len(indent); start > 0 && m.src[start-1] == '\n' &&
+		m.offset(it.Methods.Opening) < start {
+		// Insert the method on a new line before the closing brace
+		pos := it.Methods.Closing - token.Pos(len(indent))
+		m.replace(pos, pos, indent+style.Unit+method+"\n")
+		return true
+	}
+	var b bytes.Buffer
+	b.WriteString("interface {\n")
+	for _, field := range it.Methods.List {
+		fmt.Fprintf(&b, "\t%s\n", m.textOf(field))
+	}
+	fmt.Fprintf(&b, "\t%s\n}", method)
+	m.replace(it.Pos(), it.Methods.Closing+1,
+		style.Reindent(b.String(), indent))
+	return true
+}
+
+// addMethods adds a method for each case following the top-level function
+// declaration enclosing the switch, and replaces the switch with a call to
+// the method, returning false (after logging an error) if the file cannot be
+// read.
+func (r *ReplaceTypeSwitch) addMethods(config *Config, name string) bool {
+	m := r.migration(config, r.SelectedNodePkg,
+		fileContaining(r.SelectedNodePkg, r.stmt.Pos()))
+	if m == nil {
+		return false
+	}
+	style := DetectIndentStyle(m.src)
+	signature := r.signature(m, r.stmt.Pos())
+	var b bytes.Buffer
+	for i, clause := range r.clauses {
+		recv := m.textOf(clause.List[0])
+		implicit := r.SelectedNodePkg.Implicits[clause]
+		if implicit != nil && usesObject(r.SelectedNodePkg, clause, implicit) {
+			recv = implicit.Name() + " " + recv
+		}
+		fmt.Fprintf(&b, "\n\nfunc (%s) %s%s {\n", recv, name, signature)
+		b.WriteString(r.caseBody(m, style, i))
+		b.WriteString("}")
+	}
+	m.replace(r.topLevel.End(), r.topLevel.End(), b.String())
+
+	args := []string{}
+	for _, v := range r.params {
+		args = append(args, v.Name())
+	}
+	call := fmt.Sprintf("%s.%s(%s)", m.textOf(r.assert.X), name,
+		strings.Join(args, ", "))
+	if r.returns {
+		call = "return " + call
+	}
+	m.replace(r.stmt.Pos(), r.stmt.End(), call)
+	return true
+}
+
+// usesObject returns true if the given object is referenced in the given
+// node.
+func usesObject(pkgInfo *loader.PackageInfo, node ast.Node, obj types.Object) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && pkgInfo.Uses[id] == obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// caseBody returns the statements of the i-th case, indented one level (in
+// the given style) to form the body of a method.
+func (r *ReplaceTypeSwitch) caseBody(m *fileMigration, style IndentStyle, i int) string {
+	clause := r.clauses[i]
+	if len(clause.Body) == 0 {
+		return ""
+	}
+	lines := strings.SplitAfter(m.text(clause.Colon+1, clause.End()), "\n")
+	indent := Indentation(m.src, m.offset(clause.Body[0].Pos()))
+	var b bytes.Buffer
+	for i, line := range lines {
+		if i == 0 {
+			// Text following the colon on the same line
+			if line = strings.TrimSpace(line); line != "" {
+				b.WriteString(style.Unit + line + "\n")
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			b.WriteString(strings.TrimLeft(line, " \t"))
+			continue
+		}
+		b.WriteString(style.Unit + strings.TrimPrefix(line, indent))
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+const replaceTypeSwitchDoc = `
+  <h4>Purpose</h4>
+  <p>The Replace Type Switch with Method refactoring replaces a type switch
+  that dispatches on the concrete type of an interface value with a call to a
+  new method of the interface.  The body of each case becomes the method's
+  implementation for the case's type, so the behavior is defined alongside
+  the other methods of each type rather than in a single switch.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a type switch statement.</li>
+    <li>Activate the Replace Type Switch with Method refactoring.</li>
+    <li>Enter a name for the new method.</li>
+  </ol>
+
+  <p>The method is added to the interface, and a method is added for each
+  case's type (following the function containing the switch), with the
+  variable declared by the switch as its receiver.  Local variables that the
+  cases read become parameters of the method.  If the switch is the last
+  statement of its function, the cases may return, and the method returns the
+  function's results.</p>
+
+  <p>The refactoring is not performed unless the set of types is closed:
+  every type in the program that implements the interface must be handled by
+  a case, and each case must handle a single type declared in the same
+  package.  The cases may not assign local variables of the enclosing
+  function or branch outside of the switch.  A default case is removed,
+  since it can only be reached if the interface value is nil.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of replacing the highlighted
+  type switch with a method named <tt>Area</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>type Shape interface {
+    Name() string
+}
+
+func area(s Shape) float64 {
+    <span class="highlight">switch s := s.(type) {
+    case Square:
+        return s.side * s.side
+    case Circle:
+        return math.Pi * s.r * s.r
+    default:
+        panic("unknown shape")
+    }</span>
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>type Shape interface {
+    Name() string
+    Area() float64
+}
+
+func area(s Shape) float64 {
+    return s.Area()
+}
+
+func (s Square) Area() float64 {
+    return s.side * s.side
+}
+
+func (s Circle) Area() float64 {
+    return math.Pi * s.r * s.r
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
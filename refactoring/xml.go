@@ -0,0 +1,181 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file outputs a Log in the Checkstyle and JUnit XML formats, which are
+// understood by many continuous integration systems (e.g., Jenkins plugins).
+
+package refactoring
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type checkstyleXML struct {
+	XMLName xml.Name             `xml:"checkstyle"`
+	Version string               `xml:"version,attr"`
+	Files   []*checkstyleFileXML `xml:"file"`
+}
+
+type checkstyleFileXML struct {
+	Name   string                `xml:"name,attr"`
+	Errors []*checkstyleErrorXML `xml:"error"`
+}
+
+type checkstyleErrorXML struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+type junitTestSuitesXML struct {
+	XMLName xml.Name             `xml:"testsuites"`
+	Suites  []*junitTestSuiteXML `xml:"testsuite"`
+}
+
+type junitTestSuiteXML struct {
+	Name      string              `xml:"name,attr"`
+	Tests     int                 `xml:"tests,attr"`
+	Failures  int                 `xml:"failures,attr"`
+	Errors    int                 `xml:"errors,attr"`
+	TestCases []*junitTestCaseXML `xml:"testcase"`
+}
+
+type junitTestCaseXML struct {
+	Name      string           `xml:"name,attr"`
+	ClassName string           `xml:"classname,attr"`
+	Failure   *junitFailureXML `xml:"failure,omitempty"`
+	SystemOut string           `xml:"system-out,omitempty"`
+}
+
+type junitFailureXML struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// xmlSeverities maps each Severity to the corresponding Checkstyle severity
+// (which is also used as the type of a JUnit failure).
+var xmlSeverities = map[Severity]string{
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+// WriteCheckstyle outputs this log in the Checkstyle XML format.  Entries are
+// grouped by file; entries that are not associated with a file are listed
+// under a file with an empty name.  The source of every entry is the given
+// string (typically the short name of the refactoring that produced the
+// log).  Filenames are given relative to the given directory, if possible.
+func (log *Log) WriteCheckstyle(out io.Writer, source, cwd string) error {
+	result := &checkstyleXML{Version: "4.3"}
+	for _, group := range log.groupByFile(cwd) {
+		file := &checkstyleFileXML{Name: group.filename}
+		for _, entry := range group.entries {
+			line, column := log.lineColumn(entry)
+			file.Errors = append(file.Errors, &checkstyleErrorXML{
+				Line:     line,
+				Column:   column,
+				Severity: xmlSeverities[entry.Severity],
+				Message:  entry.Message,
+				Source:   source,
+			})
+		}
+		result.Files = append(result.Files, file)
+	}
+	return writeXML(out, result)
+}
+
+// WriteJUnit outputs this log in the JUnit XML format.  There is one test
+// suite per file, and each entry is a test case in that suite, whose class
+// name is the given string (typically the short name of the refactoring that
+// produced the log).  Errors and warnings are reported as failures;
+// informational messages are reported as passing test cases.  Filenames are
+// given relative to the given directory, if possible.
+func (log *Log) WriteJUnit(out io.Writer, className, cwd string) error {
+	result := &junitTestSuitesXML{}
+	for _, group := range log.groupByFile(cwd) {
+		suite := &junitTestSuiteXML{Name: group.filename}
+		if suite.Name == "" {
+			suite.Name = className
+		}
+		for _, entry := range group.entries {
+			line, column := log.lineColumn(entry)
+			testCase := &junitTestCaseXML{
+				Name:      fmt.Sprintf("%s:%d:%d", group.filename, line, column),
+				ClassName: className,
+			}
+			if group.filename == "" {
+				testCase.Name = className
+			}
+			if entry.Severity == Info {
+				testCase.SystemOut = entry.Message
+			} else {
+				testCase.Failure = &junitFailureXML{
+					Message:  entry.Message,
+					Type:     xmlSeverities[entry.Severity],
+					Contents: entry.String(),
+				}
+				suite.Failures++
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+			suite.Tests++
+		}
+		result.Suites = append(result.Suites, suite)
+	}
+	return writeXML(out, result)
+}
+
+// writeXML outputs the given value as an indented XML document.
+func writeXML(out io.Writer, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// A fileEntries is a list of the log entries associated with a single file.
+type fileEntries struct {
+	// The displayable name of the file, or "" for the entries that are
+	// not associated with a file
+	filename string
+	entries  []*Entry
+}
+
+// groupByFile partitions this log's entries by the file they are associated
+// with, in the order each file first appears in the log.  Filenames are given
+// relative to the given directory, if possible.
+func (log *Log) groupByFile(cwd string) []*fileEntries {
+	result := []*fileEntries{}
+	index := map[string]*fileEntries{}
+	for _, entry := range log.Entries {
+		filename := ""
+		if log.Fset != nil && entry.Pos.IsValid() {
+			filename = displayablePath(log.Fset.Position(entry.Pos).Filename, cwd)
+		}
+		group, ok := index[filename]
+		if !ok {
+			group = &fileEntries{filename: filename}
+			index[filename] = group
+			result = append(result, group)
+		}
+		group.entries = append(group.entries, entry)
+	}
+	return result
+}
+
+// lineColumn returns the line and column where the given entry starts, or
+// 0, 0 if it is not associated with a position in a file.
+func (log *Log) lineColumn(entry *Entry) (int, int) {
+	if log.Fset == nil || !entry.Pos.IsValid() {
+		return 0, 0
+	}
+	pos := log.Fset.Position(entry.Pos)
+	return pos.Line, pos.Column
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains a post-processing pass that gives a Patch the same hunk
+// structure that GNU diff -u would produce.
+
+package text
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Coalesce restructures this patch's hunks so that they have the same
+// structure as the hunks GNU diff -u would produce for the same change.
+//
+// CreatePatch groups edits into hunks based on the lines they affect, but an
+// edit can replace text with identical text or rewrite many lines, only a
+// few of which actually change.  So, Coalesce determines which lines each
+// hunk changes (using a line-by-line diff), trims unchanged lines so that at
+// most the requested number of lines of context (see CreatePatchWithContext)
+// surround each change, splits hunks whose changes are separated by more than
+// twice that many unchanged lines, merges
+// adjacent hunks whose contexts overlap, and removes hunks that change
+// nothing.  The edits in the resulting hunks are line-by-line additions and
+// deletions, and DetectMoves should be invoked after (not before) Coalesce.
+//
+// It returns an error (and leaves this patch unchanged) if the edits in a
+// hunk cannot be applied.
+func (p *Patch) Coalesce() error {
+	hunks := []*hunk{}
+	for _, h := range p.hunks {
+		split, err := h.split()
+		if err != nil {
+			return err
+		}
+		for _, s := range split {
+			if n := len(hunks); n > 0 && hunks[n-1].overlaps(s) {
+				hunks[n-1].merge(s)
+			} else {
+				hunks = append(hunks, s)
+			}
+		}
+	}
+	p.hunks = hunks
+	p.moves = nil
+	return nil
+}
+
+// split returns the hunks GNU diff -u would produce for the changes made by
+// this hunk, i.e., hunks containing line-by-line edits with at most
+// maxCtxLines lines of context before and after each change.
+func (h *hunk) split() ([]*hunk, error) {
+	orig := h.hunk.String()
+	newText, err := ApplyToString(&EditSet{edits: h.edits}, orig)
+	if err != nil {
+		return nil, err
+	}
+	origLines := splitLines(orig)
+	newLines := splitLines(newText)
+
+	// lineOffsets[i] is the offset of the ith line in the hunk
+	lineOffsets := make([]int, len(origLines)+1)
+	for i, line := range origLines {
+		lineOffsets[i+1] = lineOffsets[i] + len(line)
+	}
+	changes := lineChanges(Diff(origLines, newLines), lineOffsets)
+
+	// If the hunk was ended by CreatePatch (rather than the end of the
+	// file), a change must not slide into its last maxCtxLines lines,
+	// since it would not be followed by enough context
+	ctx := h.maxCtxLines
+	limit := len(origLines)
+	if n := len(changes); n == 0 ||
+		len(origLines)-changes[n-1].end() > 2*ctx {
+		limit -= ctx
+	}
+	for i, c := range changes {
+		next := limit
+		if i+1 < len(changes) {
+			next = min(next, changes[i+1].start)
+		}
+		c.slide(origLines, next)
+	}
+
+	result := []*hunk{}
+	for i := 0; i < len(changes); {
+		first := changes[i].start
+		last := first // Line following the last changed line
+		j := i
+		for ; j < len(changes) && changes[j].start <= last+2*ctx; j++ {
+			last = max(last, changes[j].end())
+		}
+		from := max(first-ctx, 0)
+		to := min(last+ctx, len(origLines))
+		sub := &hunk{
+			startOffset: -1,
+			startLine:   h.startLine + from,
+			numLines:    to - from,
+			numCtxLines: first - from,
+			maxCtxLines: ctx,
+			coalesced:   true,
+		}
+		if h.startOffset >= 0 {
+			sub.startOffset = h.startOffset + lineOffsets[from]
+		}
+		sub.hunk.WriteString(orig[lineOffsets[from]:lineOffsets[to]])
+		for _, c := range changes[i:j] {
+			for k := c.start; k < c.end(); k++ {
+				sub.addLineEdit(lineOffsets[k]-lineOffsets[from],
+					len(origLines[k]), "")
+			}
+			for _, line := range c.inserted {
+				sub.addLineEdit(lineOffsets[c.end()]-lineOffsets[from],
+					0, line)
+			}
+		}
+		result = append(result, sub)
+		i = j
+	}
+	return result, nil
+}
+
+// addLineEdit adds an edit to this hunk.
+func (h *hunk) addLineEdit(offset, length int, replacement string) {
+	extent := &Extent{Offset: offset, Length: length}
+	h.edits = append(h.edits, edit{extent, replacement})
+}
+
+// A lineChange is a group of adjacent lines deleted from a hunk, followed by
+// the lines inserted in their place.
+type lineChange struct {
+	start    int      // Index of the first deleted line (or insertion point)
+	deleted  int      // Number of lines deleted
+	inserted []string // Lines inserted
+}
+
+// end returns the index of the line following the deleted lines.
+func (c *lineChange) end() int {
+	return c.start + c.deleted
+}
+
+// lineChanges groups the edits in the given EditSet, which was produced by
+// Diff, into lineChanges.  lineOffsets contains the offset of each line.
+func lineChanges(es *EditSet, lineOffsets []int) []*lineChange {
+	result := []*lineChange{}
+	for _, e := range es.edits {
+		line := sort.SearchInts(lineOffsets, e.Offset)
+		var c *lineChange
+		if n := len(result); n > 0 && result[n-1].end() == line &&
+			(e.Length == 0 || len(result[n-1].inserted) == 0) {
+			c = result[n-1]
+		} else {
+			c = &lineChange{start: line}
+			result = append(result, c)
+		}
+		if e.Length > 0 {
+			c.deleted++
+		} else {
+			c.inserted = append(c.inserted, e.replacement)
+		}
+	}
+	return result
+}
+
+// slide moves a change that only deletes or only inserts lines as far down
+// as possible without changing its effect or reaching the given line, as GNU
+// diff does when a change could be placed in several places (e.g., when a
+// repeated line is added).
+func (c *lineChange) slide(origLines []string, limit int) {
+	switch {
+	case c.deleted == 0:
+		for c.start < limit && c.inserted[0] == origLines[c.start] {
+			c.inserted = append(c.inserted[1:], origLines[c.start])
+			c.start++
+		}
+	case len(c.inserted) == 0:
+		for c.end() < limit && origLines[c.start] == origLines[c.end()] {
+			c.start++
+		}
+	}
+}
+
+// overlaps returns true if the given hunk, which follows this hunk in the
+// file, begins at or before the line following this hunk.  Since each hunk
+// returned by split has at most maxCtxLines lines of context, this is true iff
+// their changes are separated by at most 2*maxCtxLines unchanged lines.
+func (h *hunk) overlaps(next *hunk) bool {
+	return next.startLine <= h.startLine+h.numLines
+}
+
+// merge appends the given hunk, which overlaps this hunk, to this hunk.
+func (h *hunk) merge(next *hunk) {
+	nextBytes := next.hunk.Bytes()
+	overlap := 0 // Number of bytes at the start of next that are in h
+	for i := next.startLine; i < h.startLine+h.numLines; i++ {
+		overlap += bytes.IndexByte(nextBytes[overlap:], '\n') + 1
+	}
+	shift := h.hunk.Len() - overlap
+	h.numLines = next.startLine + next.numLines - h.startLine
+	h.hunk.Write(nextBytes[overlap:])
+	for _, e := range next.edits {
+		h.addLineEdit(e.Offset+shift, e.Length, e.replacement)
+	}
+}
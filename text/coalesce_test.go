@@ -0,0 +1,141 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineNumbers returns a string containing n lines, "1\n" through "n\n".
+func lineNumbers(n int) string {
+	var b bytes.Buffer
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func coalescedDiff(a string, edits *EditSet, t *testing.T) string {
+	patch, err := edits.CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patch.Coalesce(); err != nil {
+		t.Fatal(err)
+	}
+	var result bytes.Buffer
+	if err := patch.Write("f", "f", time.Time{}, time.Time{}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := patch.ApplyToString(a); err != nil {
+		t.Fatal(err)
+	} else if expected, _ := ApplyToString(edits, a); s != expected {
+		t.Fatalf("Coalesced patch produced %q; expected %q", s, expected)
+	}
+	return result.String()
+}
+
+func TestCoalesceTrimsContext(t *testing.T) {
+	a := lineNumbers(20)
+	// Rewrite lines 5-12, changing only line 10
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: strings.Index(a, "5\n"), Length: 19},
+		strings.Replace(a[strings.Index(a, "5\n"):][:19], "10", "ten", 1))
+	assertEquals(`--- f
++++ f
+@@ -7,7 +7,7 @@
+ 7
+ 8
+ 9
+-10
++ten
+ 11
+ 12
+ 13
+`, coalescedDiff(a, edits, t), t)
+}
+
+func TestCoalesceSplitsHunks(t *testing.T) {
+	a := lineNumbers(20)
+	// Replace the whole file, changing only lines 2 and 18
+	b := strings.Replace(strings.Replace(a, "\n2\n", "\ntwo\n", 1),
+		"18", "eighteen", 1)
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: 0, Length: len(a)}, b)
+	assertEquals(`--- f
++++ f
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -15,6 +15,6 @@
+ 15
+ 16
+ 17
+-18
++eighteen
+ 19
+ 20
+`, coalescedDiff(a, edits, t), t)
+}
+
+func TestCoalesceMergesHunks(t *testing.T) {
+	a := lineNumbers(20)
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: strings.Index(a, "5\n"), Length: 1}, "five")
+	edits.Add(&Extent{Offset: strings.Index(a, "11\n"), Length: 2}, "eleven")
+	assertEquals(`--- f
++++ f
+@@ -2,13 +2,13 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
+-11
++eleven
+ 12
+ 13
+ 14
+`, coalescedDiff(a, edits, t), t)
+}
+
+func TestCoalesceRemovesNoOps(t *testing.T) {
+	a := lineNumbers(10)
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: 0, Length: 4}, "1\n2\n")
+	assertEquals("", coalescedDiff(a, edits, t), t)
+}
+
+func TestCoalesceRepeatedLines(t *testing.T) {
+	// As in GNU diff, an added line that repeats the line before it is
+	// shown after that line
+	a := "a\nb\nx\nc\nd\ne\nf\ng\n"
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: 4, Length: 0}, "x\n")
+	assertEquals(`--- f
++++ f
+@@ -1,6 +1,7 @@
+ a
+ b
+ x
++x
+ c
+ d
+ e
+`, coalescedDiff(a, edits, t), t)
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for coloring unified diffs with ANSI escape
+// sequences, so that they are easier to read in a terminal.
+
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ANSI escape sequences used to color diffs
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// WriteColored writes a unified diff to the given io.Writer, like Write, but
+// colors it with ANSI escape sequences for display in a terminal (see
+// ColorizeDiff).
+func (p *Patch) WriteColored(origFile, newFile string, origTime, newTime time.Time, out io.Writer) error {
+	var buf bytes.Buffer
+	if err := p.Write(origFile, newFile, origTime, newTime, &buf); err != nil {
+		return err
+	}
+	_, err := out.Write(ColorizeDiff(buf.Bytes()))
+	return err
+}
+
+// ColorizeDiff returns a copy of the given unified diff (which may include
+// several files, and git-style headers) with ANSI escape sequences that color
+// added lines green, deleted lines red, and hunk headers cyan.  File headers
+// (e.g., "--- filename") are displayed in bold.
+//
+// Hunk headers are parsed to determine which lines belong to each hunk, so a
+// deleted line beginning with "--" is not mistaken for a file header.
+func ColorizeDiff(diff []byte) []byte {
+	var out bytes.Buffer
+	origLeft, newLeft := 0, 0 // Lines remaining in the current hunk
+	for _, line := range strings.SplitAfter(string(diff), "\n") {
+		content := strings.TrimRight(line, "\r\n")
+		eol := line[len(content):]
+		if content == "" {
+			out.WriteString(line)
+			continue
+		}
+		color := ""
+		switch {
+		case origLeft > 0 || newLeft > 0:
+			switch content[0] {
+			case '+':
+				color = ansiGreen
+				newLeft--
+			case '-':
+				color = ansiRed
+				origLeft--
+			case ' ':
+				origLeft--
+				newLeft--
+			}
+		case strings.HasPrefix(content, "@@ "):
+			var r HunkRange
+			if _, err := fmt.Sscanf(hunkHeaderRanges(content),
+				"-%d,%d +%d,%d", &r.OrigStart, &r.OrigLines,
+				&r.NewStart, &r.NewLines); err == nil {
+				origLeft, newLeft = r.OrigLines, r.NewLines
+			}
+			// Only the header itself is colored, not the annotation
+			// (e.g., describing a move) that may follow it
+			if end := strings.Index(content[2:], "@@"); end >= 0 {
+				header := content[:end+4]
+				out.WriteString(ansiCyan + header + ansiReset +
+					content[len(header):] + eol)
+				continue
+			}
+			color = ansiCyan
+		case content[0] != '\\':
+			color = ansiBold
+		}
+		if color == "" {
+			out.WriteString(line)
+		} else {
+			out.WriteString(color + content + ansiReset + eol)
+		}
+	}
+	return out.Bytes()
+}
+
+// hunkHeaderRanges returns the ranges in the given hunk header, normalized so
+// that each includes a line count (e.g., "@@ -3 +3,2 @@" becomes
+// "-3,1 +3,2").
+func hunkHeaderRanges(header string) string {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return ""
+	}
+	ranges := fields[1:3]
+	for i, r := range ranges {
+		if !strings.Contains(r, ",") {
+			ranges[i] = r + ",1"
+		}
+	}
+	return strings.Join(ranges, " ")
+}
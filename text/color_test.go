@@ -0,0 +1,66 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColorizeDiff(t *testing.T) {
+	const (
+		reset = "\x1b[0m"
+		bold  = "\x1b[1m"
+		red   = "\x1b[31m"
+		green = "\x1b[32m"
+		cyan  = "\x1b[36m"
+	)
+	diff := "diff --git a/f.sql b/f.sql\n" +
+		"index ce01362..dd7e1c6 100644\n" +
+		"--- a/f.sql\n" +
+		"+++ b/f.sql\n" +
+		"@@ -1,3 +1,3 @@ moved\n" +
+		" select 1;\n" +
+		"--- comment\n" +
+		"+++ comment\n" +
+		" select 2;\n" +
+		"@@ -9 +9 @@\n" +
+		"-a\r\n" +
+		"\\ No newline at end of file\n" +
+		"+b\n"
+	expected := bold + "diff --git a/f.sql b/f.sql" + reset + "\n" +
+		bold + "index ce01362..dd7e1c6 100644" + reset + "\n" +
+		bold + "--- a/f.sql" + reset + "\n" +
+		bold + "+++ b/f.sql" + reset + "\n" +
+		cyan + "@@ -1,3 +1,3 @@" + reset + " moved\n" +
+		" select 1;\n" +
+		red + "--- comment" + reset + "\n" +
+		green + "+++ comment" + reset + "\n" +
+		" select 2;\n" +
+		cyan + "@@ -9 +9 @@" + reset + "\n" +
+		red + "-a" + reset + "\r\n" +
+		"\\ No newline at end of file\n" +
+		green + "+b" + reset + "\n"
+	assertEquals(expected, string(ColorizeDiff([]byte(diff))), t)
+	assertEquals("", string(ColorizeDiff(nil)), t)
+}
+
+func TestPatchWriteColored(t *testing.T) {
+	patch, err := DiffStrings("a\nb\n", "a\nc\n").CreatePatch(strings.NewReader("a\nb\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain, colored bytes.Buffer
+	if err := patch.Write("f", "f", time.Time{}, time.Time{}, &plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := patch.WriteColored("f", "f", time.Time{}, time.Time{}, &colored); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(string(ColorizeDiff(plain.Bytes())), colored.String(), t)
+	assertTrue(strings.Contains(colored.String(), "\x1b[32m+c\x1b[0m\n"), t)
+}
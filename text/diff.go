@@ -18,6 +18,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 	"time"
 )
@@ -38,7 +40,9 @@ import (
 // is 0 and its replacement text is a single line to insert.
 //
 // The implementation follows the pseudocode in Myers' paper (cited above)
-// fairly closely.
+// fairly closely.  Since the basic algorithm uses O((N+M)D) space, large
+// inputs with many differences are compared using the linear-space
+// refinement described in the paper instead (see maxTraceSize).
 func Diff(a []string, b []string) *EditSet {
 	n := len(a)
 	m := len(b)
@@ -89,6 +93,10 @@ func Diff(a []string, b []string) *EditSet {
 				return edits
 			}
 		}
+		if (d+2)*len(v) > maxTraceSize {
+			// Recording another copy of v would use too much memory
+			return diffLinear(a, b)
+		}
 		vCopy := make([]int, len(v))
 		copy(vCopy, v)
 		vs = append(vs, vCopy)
@@ -96,6 +104,55 @@ func Diff(a []string, b []string) *EditSet {
 	panic("Length of SES longer than max (internal error)")
 }
 
+// maxTraceSize is the maximum number of elements Diff records (in copies of
+// the V array, one for each value of D) in order to trace back the path it
+// finds.  When more would be needed, i.e., when the inputs are large and
+// differ substantially, it uses the linear-space algorithm (see linearDiff)
+// instead.  The two algorithms produce edit scripts of the same length, but
+// when there are several such scripts, they may choose different ones.
+const maxTraceSize = 1 << 22
+
+// DiffStrings creates an EditSet containing the minimum number of line
+// additions and deletions necessary to change a into b (see Diff).  The
+// resulting EditSet can be applied to a.  Unlike Diff, DiffStrings splits the
+// strings into lines itself; the last line of a or b need not end with a
+// newline.
+func DiffStrings(a, b string) *EditSet {
+	return Diff(splitLines(a), splitLines(b))
+}
+
+// DiffBytes creates an EditSet containing the minimum number of line
+// additions and deletions necessary to change a into b (see DiffStrings).
+func DiffBytes(a, b []byte) *EditSet {
+	return DiffStrings(string(a), string(b))
+}
+
+// DiffReaders reads the contents of a and b and returns an EditSet containing
+// the minimum number of line additions and deletions necessary to change the
+// contents of a into the contents of b (see DiffStrings).  It returns an error
+// if either reader cannot be read.
+func DiffReaders(a, b io.Reader) (*EditSet, error) {
+	var bufA, bufB bytes.Buffer
+	if _, err := bufA.ReadFrom(a); err != nil {
+		return nil, err
+	}
+	if _, err := bufB.ReadFrom(b); err != nil {
+		return nil, err
+	}
+	return DiffStrings(bufA.String(), bufB.String()), nil
+}
+
+// splitLines splits s into lines, each including its terminating newline
+// (except possibly the last).  Unlike strings.SplitAfter, it does not include
+// an empty final line when s ends with a newline (or is empty).
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
 // constructEditSet uses the matrixtargetvs (computed by Diff) to compute a
 // sequence of deletions and additions.
 func constructEditSet(a, b []string, vs [][]int, edits *EditSet, k int) {
@@ -146,6 +203,146 @@ func constructEditSet(a, b []string, vs [][]int, edits *EditSet, k int) {
 	}
 }
 
+// A linearDiff computes a shortest edit script using the linear-space
+// refinement of the Myers algorithm (section 4b of Myers' paper): rather than
+// recording the furthest reaching paths for every value of D in order to
+// trace the path back, it finds the "middle snake" of an optimal path by
+// searching forward from the start and backward from the end at the same
+// time, then recursively computes the paths before and after the snake.  Only
+// O(N+M) space is needed (plus the edits themselves).
+type linearDiff struct {
+	editScript
+	vf, vb []int // Furthest reaching x on each diagonal, forward/backward
+}
+
+// An editScript accumulates the edits that change a into b, in order, as
+// they are computed by a linearDiff or an anchoredDiff.
+type editScript struct {
+	a, b    []string
+	offsets []int // offsets[i] is the offset of a[i] in strings.Join(a, "")
+	edits   []edit
+}
+
+// newEditScript returns an empty editScript for changing a into b.
+func newEditScript(a, b []string) editScript {
+	s := editScript{a: a, b: b, offsets: make([]int, len(a)+1)}
+	for i, line := range a {
+		s.offsets[i+1] = s.offsets[i] + len(line)
+	}
+	return s
+}
+
+// diffLinear returns the same edits as Diff, computed by a linearDiff.  Both a
+// and b must be nonempty.
+func diffLinear(a, b []string) *EditSet {
+	d := &linearDiff{editScript: newEditScript(a, b)}
+	size := 2*(len(a)+len(b)+1) + 2
+	d.vf = make([]int, size)
+	d.vb = make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+	return &EditSet{edits: d.edits}
+}
+
+// compare appends the edits that change a[aLo:aHi] into b[bLo:bHi].  Edits
+// are appended in order, with insertions preceding a deletion at the same
+// offset, as constructEditSet produces them.
+func (d *linearDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.insert(aLo, j)
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.delete(i)
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(u, aHi, v, bHi)
+	}
+}
+
+// insert appends an edit inserting b[j] before a[i].
+func (d *editScript) insert(i, j int) {
+	if d.b[j] != "" {
+		d.edits = append(d.edits, edit{&Extent{d.offsets[i], 0}, d.b[j]})
+	}
+}
+
+// delete appends an edit deleting a[i].
+func (d *editScript) delete(i int) {
+	if d.a[i] != "" {
+		d.edits = append(d.edits, edit{&Extent{d.offsets[i], len(d.a[i])}, ""})
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the middle snake of
+// an optimal path from (aLo, bLo) to (aHi, bHi), where the first and last
+// elements of a[aLo:aHi] and b[bLo:bHi] differ.  The snake (a sequence of
+// diagonal moves, possibly empty) divides the path into two paths that each
+// contain about half of the edits.
+func (d *linearDiff) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	// Forward paths are indexed by diagonal k = x - y; backward paths
+	// (through the reversed sequences) by diagonal delta - k
+	offset := (n+m+1)/2 + 1
+	vf, vb := d.vf, d.vb
+	vf[offset+1], vb[offset+1] = 0, 0
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x0 int
+			if k == -D || k != D && vf[offset+k-1] < vf[offset+k+1] {
+				x0 = vf[offset+k+1]
+			} else {
+				x0 = vf[offset+k-1] + 1
+			}
+			y0 := x0 - k
+			x, y := x0, y0
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			if kr := delta - k; odd && kr >= -(D-1) && kr <= D-1 &&
+				x+vb[offset+kr] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y
+			}
+		}
+		for kr := -D; kr <= D; kr += 2 {
+			var x0 int
+			if kr == -D || kr != D && vb[offset+kr-1] < vb[offset+kr+1] {
+				x0 = vb[offset+kr+1]
+			} else {
+				x0 = vb[offset+kr-1] + 1
+			}
+			y0 := x0 - kr
+			x, y := x0, y0
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[offset+kr] = x
+			if k := delta - kr; !odd && k >= -D && k <= D &&
+				x+vf[offset+k] >= n {
+				return aLo + n - x, bLo + m - y, aLo + n - x0, bLo + m - y0
+			}
+		}
+	}
+	panic("Length of SES longer than max (internal error)")
+}
+
 // offsetOfString returns the byte offset of the substring ss[indextarget in the
 // string strings.Join(ss, "")
 func offsetOfString(index int, ss []string) int {
@@ -158,15 +355,19 @@ func offsetOfString(index int, ss []string) int {
 
 /* -=-=- Unified Diff Support =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
-// numCtxLines is the number of leading/trailing context lines in a unified diff
+// numCtxLines is the default number of leading/trailing context lines in a
+// unified diff (see CreatePatchWithContext)
 const numCtxLines int = 3
 
 // A Patch is an object representing a unified diff.  It can be created from an
 // EditSet by invoking the CreatePatch method.  To get the contents of the
-// unified diff, invoke the Write method.
+// unified diff, invoke the Write method; to apply it to a copy of the original
+// file, invoke ApplyTo, ApplyToString, or ApplyToFile.
 type Patch struct {
-	filename string
-	hunks    []*hunk
+	filename    string
+	hunks       []*hunk
+	moves       []Move       // Set by DetectMoves
+	diffOptions *DiffOptions // Set by SetDiffOptions
 }
 
 // IsEmpty returns true iff this patch contains no hunks
@@ -174,6 +375,151 @@ func (p *Patch) IsEmpty() bool {
 	return len(p.hunks) == 0
 }
 
+// String returns a description of this patch's hunks (for debugging), which
+// shows how its edits were grouped into hunks and how much context each hunk
+// includes.  If DetectMoves has been called, the moves it detected are listed
+// as well.
+func (p *Patch) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Patch with %d hunk(s)\n", len(p.hunks))
+	for i, h := range p.hunks {
+		fmt.Fprintf(&b, "%d. %s", i+1, h.String())
+	}
+	for _, m := range p.moves {
+		fmt.Fprintf(&b, "Move: %s\n", m.String())
+	}
+	return b.String()
+}
+
+// ApplyTo reads the original file from the given reader, applies this patch
+// to it, and writes the patched file to the given writer.  It returns an error
+// if the input does not match the lines this patch expects to change (i.e.,
+// if the patch does not apply), or if an I/O error occurs.
+func (p *Patch) ApplyTo(in io.Reader, out io.Writer) error {
+	orig, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	edits, err := p.editSet(orig)
+	if err != nil {
+		return err
+	}
+	return edits.ApplyTo(bytes.NewReader(orig), out)
+}
+
+// EditSet reads the original file from the given reader and returns an
+// EditSet containing the edits in this patch, with offsets relative to the
+// start of the file.  It returns an error if the input does not match the
+// lines this patch expects to change.
+func (p *Patch) EditSet(in io.Reader) (*EditSet, error) {
+	orig, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	return p.editSet(orig)
+}
+
+// ApplyToString applies this patch to the given string, returning the result.
+func (p *Patch) ApplyToString(s string) (string, error) {
+	var buf bytes.Buffer
+	err := p.ApplyTo(strings.NewReader(s), &buf)
+	return buf.String(), err
+}
+
+// ApplyToFile applies this patch to the contents of the given file, returning
+// the result.  The file itself is not modified.
+func (p *Patch) ApplyToFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	err = p.ApplyTo(f, &buf)
+	return buf.Bytes(), err
+}
+
+// Invert returns a patch that reverses this patch, i.e., if this patch
+// transforms a file into a new file, the resulting patch transforms the new
+// file back into the original.  (Since each hunk contains the original text
+// it changes, the original file is not needed.)  It returns an error if the
+// edits in a hunk cannot be applied.
+func (p *Patch) Invert() (*Patch, error) {
+	result := &Patch{filename: p.filename}
+	lineAdjust, offsetAdjust := 0, 0
+	for _, h := range p.hunks {
+		orig := h.hunk.String()
+		es := &EditSet{edits: h.edits}
+		newText, err := ApplyToString(es, orig)
+		if err != nil {
+			return nil, err
+		}
+		inverse, err := es.Invert(orig)
+		if err != nil {
+			return nil, err
+		}
+		inv := &hunk{
+			startOffset: -1,
+			startLine:   h.startLine + lineAdjust,
+			numLines:    len(splitLines(newText)),
+			numCtxLines: h.numCtxLines,
+			maxCtxLines: h.maxCtxLines,
+			coalesced:   h.coalesced,
+			edits:       inverse.edits,
+		}
+		if h.startOffset >= 0 {
+			inv.startOffset = h.startOffset + offsetAdjust
+		}
+		inv.hunk.WriteString(newText)
+		result.add(inv)
+		lineAdjust += inv.numLines - len(splitLines(orig))
+		offsetAdjust += len(newText) - len(orig)
+	}
+	return result, nil
+}
+
+// editSet returns an EditSet containing the edits in this patch's hunks, with
+// offsets relative to the start of the file, after verifying that each hunk
+// matches the corresponding bytes of the given original file.  (The edits are
+// appended directly, rather than using Add, since Add would reverse the order
+// of several insertions at the same offset.)
+func (p *Patch) editSet(orig []byte) (*EditSet, error) {
+	result := NewEditSet()
+	for _, h := range p.hunks {
+		start := h.startOffset
+		if start < 0 {
+			// The hunk was parsed, so only its line number is known
+			start = offsetOfLine(orig, h.startLine)
+		}
+		end := start + h.hunk.Len()
+		if start < 0 || end > len(orig) ||
+			!bytes.Equal(orig[start:end], h.hunk.Bytes()) {
+			return nil, fmt.Errorf("patch does not apply: the input does "+
+				"not match the hunk at line %d", h.startLine)
+		}
+		for _, e := range h.edits {
+			extent := &Extent{Offset: start + e.Offset, Length: e.Length}
+			result.edits = append(result.edits, edit{extent, e.replacement})
+		}
+	}
+	return result, nil
+}
+
+// offsetOfLine returns the offset of the given 1-based line in the given
+// text, or -1 if it has fewer lines.  (The line following the last line,
+// i.e., the end of the text, is considered to be a line.)
+func offsetOfLine(text []byte, line int) int {
+	offset := 0
+	for i := 1; i < line; i++ {
+		next := bytes.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return -1
+		}
+		offset += next + 1
+	}
+	return offset
+}
+
 // add appends a hunk to this patch.  It is the caller's responsibility to
 // ensure that hunks are added in the correct order.
 func (p *Patch) add(hunk *hunk) {
@@ -193,7 +539,7 @@ func (p *Patch) Write(origFile, newFile string, origTime, newTime time.Time, out
 			newFile, newTime.Format(layout))
 		lineOffset := 0
 		for _, hunk := range p.hunks {
-			adjust, err := writeDiffHunk(hunk, lineOffset, out)
+			adjust, err := p.writeDiffHunk(hunk, lineOffset, out)
 			if err != nil {
 				return err
 			}
@@ -207,8 +553,9 @@ func (p *Patch) Write(origFile, newFile string, origTime, newTime time.Time, out
 // edits in that hunk add lines, it returns the number of lines added; if the
 // edits delete lines, it returns a negative number indicating the number of
 // lines deleted (0 - number of lines deleted).  If the edits in the hunk do
-// not change the number of lines, returns 0.
-func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
+// not change the number of lines, returns 0.  If the hunk moves lines (see
+// DetectMoves), the moves are described following the hunk header.
+func (p *Patch) writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 	// Determine the lines in this hunk before and after applying edits
 	origLines, newLines, err := computeLines(h)
 	if err != nil {
@@ -218,14 +565,19 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 	// Write the unified diff header
 	numOrigLines := lenWithoutLastIfEmpty(origLines)
 	numNewLines := lenWithoutLastIfEmpty(newLines)
-	if _, err = fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n",
-		h.startLine, numOrigLines,
-		h.startLine+outputLineOffset, numNewLines); err != nil {
+	r := HunkRange{h.startLine, numOrigLines,
+		h.startLine + outputLineOffset, numNewLines}
+	annotation := p.moveAnnotation(r.OrigStart, r.OrigLines,
+		r.NewStart, r.NewLines)
+	if annotation != "" {
+		annotation = " " + annotation
+	}
+	if _, err = fmt.Fprintf(out, "%s%s\n", r, annotation); err != nil {
 		return 0, err
 	}
 
 	// Create an iterator that will traverse deletions and additions
-	it := Diff(origLines, newLines).newEditIter()
+	it := p.diffLines(origLines, newLines).newEditIter()
 
 	// For each line in the original file, add one or more lines to the
 	// unified diff output
@@ -234,7 +586,7 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 		if it.edit() == nil || it.edit().Offset > offset {
 			// This line was not affected by any edits
 			if i < len(origLines)-1 || line != "" {
-				fmt.Fprintf(out, " %s", origLines[i])
+				writeDiffLine(out, " ", line)
 			}
 		} else {
 			// This line was deleted (and possibly replaced by a
@@ -246,26 +598,17 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 				edit := it.edit()
 				if edit.Length > 0 {
 					// Delete line
-					line := origLines[i]
-					fmt.Fprintf(out, "-%s", line)
-					if !strings.HasSuffix(line, "\n") {
-						fmt.Fprintf(out, "\n\\ No newline at end of file\n")
-					}
+					writeDiffLine(out, "-", origLines[i])
 					deleted = true
 				} else if edit.replacement != "" {
 					// Insert line
-					repl := edit.replacement
-					fmt.Fprintf(out, "+%s", repl)
-					if !strings.HasSuffix(repl, "\n") {
-						fmt.Fprintf(out, "\n\\ No newline at end of file\n")
-					}
-
+					writeDiffLine(out, "+", edit.replacement)
 				}
 				it.moveToNextEdit()
 			}
 			if !deleted {
 				if i < len(origLines)-1 || line != "" {
-					fmt.Fprintf(out, " %s", origLines[i])
+					writeDiffLine(out, " ", line)
 				}
 			}
 		}
@@ -274,6 +617,66 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 	return numNewLines - numOrigLines, nil
 }
 
+// A HunkRange gives the lines of the original file and the new file that are
+// contained in a hunk of a unified diff.  If a hunk contains no lines of a
+// file (e.g., it only inserts lines), its start is the number of the line
+// that follows the hunk's position in that file.
+type HunkRange struct {
+	OrigStart int // 1-based line number of the first line in the original
+	OrigLines int // Number of lines of the original file in the hunk
+	NewStart  int // 1-based line number of the first line in the new file
+	NewLines  int // Number of lines of the new file in the hunk
+}
+
+// String returns the header of a hunk with this range, e.g.,
+// "@@ -1,3 +1,4 @@".
+func (r HunkRange) String() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(r.OrigStart, r.OrigLines),
+		hunkRange(r.NewStart, r.NewLines))
+}
+
+// HunkRanges returns the range of each hunk in this patch, in the order the
+// hunks are written.  It returns an error if the edits in a hunk cannot be
+// applied.
+func (p *Patch) HunkRanges() ([]HunkRange, error) {
+	result := []HunkRange{}
+	lineOffset := 0
+	for _, h := range p.hunks {
+		origLines, newLines, err := computeLines(h)
+		if err != nil {
+			return nil, err
+		}
+		r := HunkRange{h.startLine, lenWithoutLastIfEmpty(origLines),
+			h.startLine + lineOffset, lenWithoutLastIfEmpty(newLines)}
+		result = append(result, r)
+		lineOffset += r.NewLines - r.OrigLines
+	}
+	return result, nil
+}
+
+// hunkRange returns the range of lines in a unified diff hunk header, given
+// the 1-based number of the hunk's first line and its number of lines.  As in
+// GNU diff, a range containing no lines is given by the number of the line
+// preceding it (0 at the beginning of a file), since that is where patch and
+// git apply expect to insert lines into (or delete lines from) the file.
+func hunkRange(startLine, numLines int) string {
+	if numLines == 0 {
+		startLine--
+	}
+	return fmt.Sprintf("%d,%d", startLine, numLines)
+}
+
+// writeDiffLine writes a single line of a unified diff hunk, i.e., the given
+// prefix (" ", "-", or "+") followed by the given line.  If the line is the
+// last line of a file and does not end with a newline, it is followed by a
+// newline and the "\ No newline at end of file" marker.
+func writeDiffLine(out io.Writer, prefix, line string) {
+	fmt.Fprintf(out, "%s%s", prefix, line)
+	if !strings.HasSuffix(line, "\n") {
+		fmt.Fprintf(out, "\n\\ No newline at end of file\n")
+	}
+}
+
 // If the last string in the slice is the empty string, returns len(ss)-1;
 // otherwise, returns len(ss).
 func lenWithoutLastIfEmpty(ss []string) int {
@@ -297,21 +700,34 @@ func computeLines(h *hunk) (origLines []string, newLines []string, err error) {
 	origLines = strings.SplitAfter(hunk, "\n")
 	newLines = strings.SplitAfter(newText, "\n")
 
+	if !h.coalesced {
+		_, linesToRemove := trailingContext(origLines, newLines,
+			h.maxCtxLines)
+		if linesToRemove > 0 {
+			// Keep an empty last line, so lines inserted after
+			// the last remaining line are still written
+			origLines = append(origLines[:len(origLines)-linesToRemove], "")
+			newLines = append(newLines[:len(newLines)-linesToRemove], "")
+		}
+	}
+	return
+}
+
+// trailingContext returns the number of lines at the end of a hunk that are
+// unchanged by its edits, given the hunk's lines before and after applying
+// the edits, and the number of those lines that must be removed so that at
+// most maxCtxLines lines of trailing context remain.
+func trailingContext(origLines, newLines []string, maxCtxLines int) (ctxLines, linesToRemove int) {
 	numOrig := len(origLines)
 	numNew := len(newLines)
-	trailingCtxLines := 0
 	for i, n := 0, min(numOrig, numNew); i < n; i++ {
 		if origLines[numOrig-i-1] == newLines[numNew-i-1] {
-			trailingCtxLines++
+			ctxLines++
 		} else {
 			break
 		}
 	}
-	linesToRemove := max(trailingCtxLines-numCtxLines, 0)
-
-	origLines = origLines[:numOrig-linesToRemove]
-	newLines = newLines[:numNew-linesToRemove]
-	return
+	return ctxLines, max(ctxLines-maxCtxLines, 0)
 }
 
 // min returns the minimum of two integers.
@@ -332,18 +748,69 @@ func max(m, n int) int {
 
 // A hunk represents a single hunk in a unified diff.  A hunk consists of all
 // of the edits that affect a particular region of a file.  Typically, a hunk
-// is written with numCtxLines lines of context preceding and following
-// the hunk.  So, edits are grouped: if there are more than 2*numCtxLines+1
-// lines between two edits, they should be in separate hunks.  Otherwise, the
-// two edits should be in the same hunk.
+// is written with maxCtxLines (by default, numCtxLines) lines of context
+// preceding and following the hunk.  So, edits are grouped: if there are more
+// than 2*maxCtxLines+1 lines between two edits, they should be in separate
+// hunks.  Otherwise, the two edits should be in the same hunk.
 type hunk struct {
-	startOffset int          // Offset of this hunk in the original file
+	startOffset int          // Offset in the original file (-1 if unknown)
 	startLine   int          // 1-based line number of this hunk
 	numLines    int          // Number of lines modified by this hunk
+	numCtxLines int          // Number of lines of leading context
+	maxCtxLines int          // Maximum number of lines of context
+	coalesced   bool         // Trailing context already trimmed (Coalesce)
 	hunk        bytes.Buffer // Affected bytes from the original file
 	edits       []edit       // Edits to be applied to hunk
 }
 
+// String returns a description of this hunk (for debugging): its location in
+// the original file, the number of lines of leading and trailing context it
+// includes, its edits (with offsets relative to both the hunk and the file),
+// and the lines it contains before and after applying its edits.  Lines are
+// quoted, so differences in whitespace and line endings are visible.
+func (h *hunk) String() string {
+	var b bytes.Buffer
+	offset := "unknown"
+	if h.startOffset >= 0 {
+		offset = fmt.Sprint(h.startOffset)
+	}
+	fmt.Fprintf(&b, "Hunk at line %d, offset %s: %d line(s), %d byte(s)\n",
+		h.startLine, offset, h.numLines, h.hunk.Len())
+	fmt.Fprintf(&b, "  Leading context: %d line(s)\n", h.numCtxLines)
+	origText := h.hunk.String()
+	newText, err := ApplyToString(&EditSet{edits: h.edits}, origText)
+	if err != nil {
+		fmt.Fprintf(&b, "  Edits cannot be applied: %s\n", err)
+	} else {
+		ctxLines, linesToRemove := trailingContext(
+			strings.SplitAfter(origText, "\n"),
+			strings.SplitAfter(newText, "\n"), h.maxCtxLines)
+		if h.coalesced {
+			linesToRemove = 0
+		}
+		fmt.Fprintf(&b, "  Trailing context: %d line(s), of which %d "+
+			"will be omitted\n", ctxLines, linesToRemove)
+	}
+	for _, e := range h.edits {
+		fmt.Fprintf(&b, "  Edit: Replace offset %d (file offset %d), "+
+			"length %d with %q\n", e.Offset, e.Offset+h.startOffset,
+			e.Length, e.replacement)
+	}
+	writeLines := func(label, text string, firstLine int) {
+		fmt.Fprintf(&b, "  %s:\n", label)
+		for i, line := range strings.SplitAfter(text, "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "    %5d %q\n", firstLine+i, line)
+			}
+		}
+	}
+	writeLines("Before", origText, h.startLine)
+	if err == nil {
+		writeLines("After", newText, h.startLine)
+	}
+	return b.String()
+}
+
 // addLine adds a single line of text to the hunk.
 func (h *hunk) addLine(line string) {
 	h.hunk.WriteString(line)
@@ -358,7 +825,7 @@ func (h *hunk) addEdit(e *edit) {
 
 // A lineRdr reads lines, one at a time, from an io.Reader, keeping track of
 // the 0-based offset and 1-based line number of the line.  It also keeps
-// track of the previous numCtxLines lines that were read.  (This is used to
+// track of the previous maxCtxLines lines that were read.  (This is used to
 // create leading context for a unified diff hunk.)
 type lineRdr struct {
 	reader          *bufio.Reader
@@ -367,18 +834,25 @@ type lineRdr struct {
 	lineNum         int
 	err             error
 	leadingCtxLines []string
+	maxCtxLines     int
 }
 
-// newLineRdr creates a new lineRdr that reads from the given io.Reader.
-func newLineRdr(in io.Reader) *lineRdr {
-	return &lineRdr{reader: bufio.NewReader(in)}
+// newLineRdr creates a new lineRdr that reads from the given io.Reader and
+// keeps track of up to maxCtxLines lines of leading context.  Its buffer holds
+// at least peekSize bytes, so isNoOp can examine up to peekSize bytes
+// following the current line.
+func newLineRdr(in io.Reader, maxCtxLines int, peekSize int) *lineRdr {
+	return &lineRdr{
+		reader:      bufio.NewReaderSize(in, max(peekSize, 4096)),
+		maxCtxLines: maxCtxLines,
+	}
 }
 
 // readLine reads a single line from the wrapped io.Reader.  When the end of
 // the input is reached, it returns io.EOF.
 func (l *lineRdr) readLine() error {
-	if l.lineNum > 0 {
-		if len(l.leadingCtxLines) == numCtxLines {
+	if l.lineNum > 0 && l.maxCtxLines > 0 {
+		if len(l.leadingCtxLines) == l.maxCtxLines {
 			l.leadingCtxLines = l.leadingCtxLines[1:]
 		}
 		l.leadingCtxLines = append(l.leadingCtxLines, l.line)
@@ -432,19 +906,54 @@ func (l *lineRdr) nextLineIsAffectedBy(e *edit) bool {
 	}
 }
 
-// startHunk creats a new hunk, adding the current line and up to numCtxLines
+// isNoOp returns true iff the given edit, which must begin on the line that was
+// most recently read, replaces text with the same text.  Text following the
+// current line is examined without reading it, so the edit must not extend
+// more than the size of the reader's buffer past the current line.
+func (l *lineRdr) isNoOp(e *edit) bool {
+	start := e.Offset - l.lineOffset
+	if e.Length != len(e.replacement) || start < 0 || start > len(l.line) {
+		return false
+	}
+	end := min(start+e.Length, len(l.line))
+	if l.line[start:end] != e.replacement[:end-start] {
+		return false
+	}
+	if rest := e.Length - (end - start); rest > 0 {
+		following, err := l.reader.Peek(rest)
+		return err == nil && string(following) == e.replacement[end-start:]
+	}
+	return true
+}
+
+// startsOnCurLine returns true iff the given edit begins on the line that was
+// most recently read (or, if the end of the input was reached, at or after
+// the beginning of the last line).
+func (l *lineRdr) startsOnCurLine(e *edit) bool {
+	if e == nil || e.Offset < l.lineOffset {
+		return false
+	} else if l.err == io.EOF {
+		return true
+	} else {
+		return e.Offset < l.offsetPastEnd()
+	}
+}
+
+// startHunk creats a new hunk, adding the current line and up to maxCtxLines
 // lines of leading context.
 func startHunk(lr *lineRdr) *hunk {
 	h := &hunk{
 		startOffset: lr.lineOffset,
 		startLine:   lr.lineNum,
 		numLines:    1,
+		maxCtxLines: lr.maxCtxLines,
 	}
 
 	for _, line := range lr.leadingCtxLines {
 		h.startOffset -= len(line)
 		h.startLine--
 		h.numLines++
+		h.numCtxLines++
 		h.hunk.WriteString(line)
 	}
 
@@ -479,25 +988,40 @@ func (e *editIter) moveToNextEdit() *edit {
 	return e.edit()
 }
 
-// createPatch creates a Patch from an EditSet.  (The CreatePatch method on
-// EditSet delegates to this function.)
-func createPatch(e *EditSet, in io.Reader) (result *Patch, err error) {
+// createPatch creates a Patch from an EditSet, with at most maxCtxLines lines
+// of context surrounding each hunk.  Edits whose replacement is the same as
+// the text they replace are omitted.  (The CreatePatch and
+// CreatePatchWithContext methods on EditSet delegate to this function.)
+func createPatch(e *EditSet, in io.Reader, maxCtxLines int) (result *Patch, err error) {
 	result = &Patch{}
 
 	if len(e.edits) == 0 {
 		return
 	}
 
-	reader := newLineRdr(in) // Reads lines from the original file
-	it := e.newEditIter()    // Traverses edits (in order)
-	var hunk *hunk           // Current hunk being added to
-	var trailingCtxLines int // Number of unchanged lines at end of hunk
+	// The input is read one line at a time, so it is never held in memory
+	// all at once.  No-op edits are skipped as soon as the line they begin
+	// on is read, so that they do not add lines to a hunk or start one;
+	// the reader's buffer must be large enough to compare the longest of
+	// them with the input.
+	peekSize := 0
+	for _, ed := range e.edits {
+		if ed.Length == len(ed.replacement) {
+			peekSize = max(peekSize, ed.Length)
+		}
+	}
+
+	reader := newLineRdr(in, maxCtxLines, peekSize) // Reads lines from the original file
+	it := e.newEditIter()                           // Traverses edits (in order)
+	var hunk *hunk                                  // Current hunk being added to
+	var trailingCtxLines int                        // Number of unchanged lines at end of hunk
 
 	// Iterate through each line, adding lines to a hunk if they are
-	// affected by an edit or at most 2*numCtxLines following an edit;
+	// affected by an edit or at most 2*maxCtxLines following an edit;
 	// add edits to the hunk whenever the last offset affected by that edit
 	// is on the current line
 	for err = reader.readLine(); err == nil || err == io.EOF; err = reader.readLine() {
+		skipNoOps(reader, it)
 		if hunk == nil {
 			// No hunk has been started, so start one as soon as
 			// we find a line that is changed
@@ -528,7 +1052,7 @@ func createPatch(e *EditSet, in io.Reader) (result *Patch, err error) {
 				}
 			} else {
 				trailingCtxLines++
-				if trailingCtxLines > 2*numCtxLines {
+				if trailingCtxLines > 2*maxCtxLines {
 					result.add(hunk)
 					hunk = nil
 				}
@@ -545,6 +1069,14 @@ func createPatch(e *EditSet, in io.Reader) (result *Patch, err error) {
 	return
 }
 
+// skipNoOps moves the iterator it past each edit that begins on the line most
+// recently read by reader and replaces text with the same text.
+func skipNoOps(reader *lineRdr, it *editIter) {
+	for e := it.edit(); reader.startsOnCurLine(e) && reader.isNoOp(e); e = it.edit() {
+		it.moveToNextEdit()
+	}
+}
+
 // addEditsOnCurLine begins with the current edit marked by the iterator it and
 // adds that edit to the hunk as well as all subsequent edits whose last
 // affected offset is on the current line.  It returns the last edit added to
@@ -559,7 +1091,9 @@ func addEditsOnCurLine(hunk *hunk, reader *lineRdr, it *editIter) *edit {
 		}
 		lastEdit = curEdit
 		hunk.addEdit(curEdit)
-		curEdit = it.moveToNextEdit()
+		it.moveToNextEdit()
+		skipNoOps(reader, it)
+		curEdit = it.edit()
 	}
 	return lastEdit
 }
@@ -0,0 +1,110 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+// This file contains fuzz tests for Diff and CreatePatch.  Run them with, e.g.,
+//     go test -fuzz=FuzzDiff ./text
+// Without -fuzz, only the seed corpus is tested.
+
+package text
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzDiff(f *testing.F) {
+	f.Add("", "")
+	f.Add("a\nb\nc\n", "a\nc\n")
+	f.Add("a\nb", "a\nb\n")
+	f.Add("ABCABBA", "CBABAC")
+	f.Add("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\n2\nx\n4\n5\n6\n7\n8\ny\n10\n")
+	f.Add("\n\n\n", "\n")
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if len(a)+len(b) > 2000 {
+			// Diff requires O((len(a)+len(b))^2) space in the
+			// worst case
+			t.Skip()
+		}
+
+		// Line-by-line and character-by-character diffs reproduce b
+		for _, edits := range []*EditSet{
+			DiffStrings(a, b),
+			Diff(strings.Split(a, ""), strings.Split(b, "")),
+		} {
+			result, err := ApplyToString(edits, a)
+			if err != nil {
+				t.Fatalf("Diff %q -> %q: %s", a, b, err)
+			}
+			if result != b {
+				t.Fatalf("Diff %q -> %q produced %q", a, b, result)
+			}
+		}
+
+		// A patch can be created and written, and its hunk headers are
+		// consistent with its contents
+		edits := DiffStrings(a, b)
+		patch, err := edits.CreatePatch(strings.NewReader(a))
+		if err != nil {
+			t.Fatalf("CreatePatch %q -> %q: %s", a, b, err)
+		}
+		if a == b && !patch.IsEmpty() {
+			t.Fatalf("Patch %q -> %q should be empty", a, b)
+		}
+		var out bytes.Buffer
+		if err := patch.Write("a", "b", time.Time{}, time.Time{}, &out); err != nil {
+			t.Fatalf("Write %q -> %q: %s", a, b, err)
+		}
+		if err := checkHunkCounts(out.String()); err != nil {
+			t.Fatalf("Patch %q -> %q: %s\n%s", a, b, err, out.String())
+		}
+	})
+}
+
+// checkHunkCounts verifies that the line counts in the header of each hunk in
+// a unified diff match the number of lines in the hunk.
+func checkHunkCounts(patch string) error {
+	var origStart, origCount, newStart, newCount int
+	inHunk := false
+	check := func() error {
+		if inHunk && (origCount != 0 || newCount != 0) {
+			return fmt.Errorf("hunk at -%d +%d has %d original and "+
+				"%d new lines more than its header indicates",
+				origStart, newStart, -origCount, -newCount)
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(patch))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			if err := check(); err != nil {
+				return err
+			}
+			if _, err := fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@",
+				&origStart, &origCount, &newStart, &newCount); err != nil {
+				return fmt.Errorf("invalid hunk header %q", line)
+			}
+			inHunk = true
+		case !inHunk || strings.HasPrefix(line, `\`):
+		case strings.HasPrefix(line, "-"):
+			origCount--
+		case strings.HasPrefix(line, "+"):
+			newCount--
+		case strings.HasPrefix(line, " "):
+			origCount--
+			newCount--
+		default:
+			return fmt.Errorf("invalid line in hunk: %q", line)
+		}
+	}
+	return check()
+}
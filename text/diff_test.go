@@ -9,10 +9,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -40,10 +43,45 @@ func testDiffs(a, b string, t *testing.T) {
 	assertEquals(b, result, t)
 }
 
+func TestDiffStrings(t *testing.T) {
+	texts := []string{"", "\n", "a", "a\n", "a\nb", "a\nb\n", "b\n",
+		"a\n\nb\n", "x\na\nb\n"}
+	for _, a := range texts {
+		for _, b := range texts {
+			for _, edits := range []*EditSet{
+				DiffStrings(a, b),
+				DiffBytes([]byte(a), []byte(b)),
+			} {
+				edits.Iterate(func(extent *Extent, replacement string) bool {
+					if extent.Length == 0 && replacement == "" {
+						t.Fatalf("Diff %q -> %q contains an "+
+							"empty edit", a, b)
+					}
+					return true
+				})
+				result, err := ApplyToString(edits, a)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEquals(b, result, t)
+			}
+		}
+	}
+
+	edits, err := DiffReaders(strings.NewReader("a\nb\nc"),
+		strings.NewReader("a\nc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("Replace offset 2, length 2 with \"\"\n"+
+		"Replace offset 4, length 1 with \"\"\n"+
+		"Replace offset 5, length 0 with \"c\n\"\n", edits.String(), t)
+}
+
 func TestLineRdr(t *testing.T) {
 	// Line2 starts at offset 10, Line3 at 20, etc.
 	s := "Line1....\nLine2....\nLine3....\nLine4....\nLine5"
-	r := newLineRdr(strings.NewReader(s))
+	r := newLineRdr(strings.NewReader(s), numCtxLines, 0)
 
 	r.readLine()
 	assertEquals("Line1....\n", r.line, t)
@@ -190,6 +228,309 @@ func testUnifiedDiff(a, b, expected, name string, t *testing.T) {
 	}
 }
 
+func TestPatchString(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	edits := NewEditSet()
+	edits.Add(&Extent{Offset: 8, Length: 1}, "five")
+	patch, err := edits.CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := patch.String()
+	for _, expected := range []string{
+		"Patch with 1 hunk(s)\n",
+		"1. Hunk at line 2, offset 2: ",
+		"  Leading context: 3 line(s)\n",
+		"  Trailing context: 6 line(s), of which 3 will be omitted\n",
+		"  Edit: Replace offset 6 (file offset 8), length 1 with \"five\"\n",
+		"        5 \"5\\n\"\n",
+		"        5 \"five\\n\"\n",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Fatalf("Expected patch description to contain %q; got:\n%s",
+				expected, s)
+		}
+	}
+}
+
+func TestPatchApplyTo(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n13\n"
+	patch, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := patch.ApplyToString(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(b, result, t)
+
+	if _, err := patch.ApplyToString(strings.Replace(a, "11", "eleven", 1)); err == nil {
+		t.Fatal("Expected patch not to apply to modified input")
+	}
+
+	empty, err := NewEditSet().CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = empty.ApplyToString(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(a, result, t)
+}
+
+// patchEdgeCases are pairs of files whose diffs involve empty hunk ranges or
+// missing newlines at the end of the file.
+var patchEdgeCases = [][2]string{
+	{"", "a\n"},
+	{"", "a"},
+	{"a\n", ""},
+	{"a", ""},
+	{"a", "b"},
+	{"x", "x\ny"},
+	{"a\nb", "a\nb\n"},
+	{"a\nb\n", "a\nb"},
+	{"a\nb", "x\na\nb"},
+	{"a\nb\nc", "a\nB\nc"},
+	{"a\nb\nc", "a\nb"},
+	{"a\n\n", "a\n"},
+	{"a\r\nb\r\n", "a\r\nc\r\n"},
+}
+
+func TestPatchHunkRanges(t *testing.T) {
+	for _, c := range [][3]string{
+		{"", "a\n", "@@ -0,0 +1,1 @@"},
+		{"a\n", "", "@@ -1,1 +0,0 @@"},
+		{"a\nb", "x\na\nb", "@@ -1,2 +1,3 @@"},
+	} {
+		diff := unifiedDiff(c[0], c[1], t)
+		if !strings.Contains(diff, "\n"+c[2]+"\n") {
+			t.Fatalf("Diff from %q to %q should contain %s; got:\n%s",
+				c[0], c[1], c[2], diff)
+		}
+	}
+	diff := unifiedDiff("a\nb", "a\nB", t)
+	if strings.Count(diff, "\\ No newline at end of file") != 2 {
+		t.Fatalf("Expected two missing newline markers; got:\n%s", diff)
+	}
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\nnew\n2\n3\n4\n5\n6\n7\n8\n10\n"
+	patch, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patch.Coalesce(); err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := patch.HunkRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []HunkRange{{1, 4, 1, 5}, {6, 5, 7, 4}}
+	if fmt.Sprint(ranges) != fmt.Sprint(expected) {
+		t.Fatalf("Expected hunk ranges %v; got %v", expected, ranges)
+	}
+	assertEquals("@@ -6,5 +7,4 @@", ranges[1].String(), t)
+}
+
+func TestCreatePatchWithContext(t *testing.T) {
+	// Lines 1-10, with a line inserted before line 3 and line 8 changed
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	es := NewEditSet()
+	es.Add(&Extent{Offset: 4, Length: 0}, "new\n")
+	es.Add(&Extent{Offset: 14, Length: 1}, "eight")
+
+	expected := map[int]string{
+		0: "@@ -2,0 +3,1 @@\n+new\n" +
+			"@@ -8,1 +9,1 @@\n-8\n+eight\n",
+		1: "@@ -2,2 +2,3 @@\n 2\n+new\n 3\n" +
+			"@@ -7,3 +8,3 @@\n 7\n-8\n+eight\n 9\n",
+		3: "@@ -1,10 +1,11 @@\n 1\n 2\n+new\n 3\n 4\n 5\n 6\n 7\n" +
+			"-8\n+eight\n 9\n 10\n",
+	}
+	for ctx, hunks := range expected {
+		for _, coalesce := range []bool{false, true} {
+			patch, err := es.CreatePatchWithContext(strings.NewReader(a), ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if coalesce {
+				if err := patch.Coalesce(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var b bytes.Buffer
+			if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &b); err != nil {
+				t.Fatal(err)
+			}
+			assertEquals("--- filename\n+++ filename\n"+hunks, b.String(), t)
+		}
+	}
+
+	if _, err := es.CreatePatchWithContext(strings.NewReader(a), -1); err == nil {
+		t.Fatal("Expected an error for a negative number of context lines")
+	}
+}
+
+// TestCreatePatchNoOps checks that edits replacing text with the same text do
+// not appear in a patch.
+func TestCreatePatchNoOps(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	es := NewEditSet()
+	es.Add(&Extent{Offset: 2, Length: 2}, "2\n")
+	es.Add(&Extent{Offset: 8, Length: 0}, "")
+	patch, err := es.CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patch.IsEmpty() {
+		t.Fatalf("Expected an empty patch; got\n%s", patch)
+	}
+	var b bytes.Buffer
+	if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &b); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("", b.String(), t)
+
+	es.Add(&Extent{Offset: 14, Length: 1}, "eight")
+	es.Add(&Extent{Offset: 18, Length: 3}, "10\n")
+	patch, err = es.CreatePatchWithContext(strings.NewReader(a), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &b); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("--- filename\n+++ filename\n"+
+		"@@ -8,1 +8,1 @@\n-8\n+eight\n", b.String(), t)
+
+	// No-op edits do not add context to a hunk
+	patch, err = es.CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &b); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("--- filename\n+++ filename\n"+
+		"@@ -5,6 +5,6 @@\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n", b.String(), t)
+
+	// An edit spanning several lines is compared with the lines following
+	// the one it begins on before they are read
+	es = NewEditSet()
+	es.Add(&Extent{Offset: 2, Length: 6}, "2\n3\n4\n")
+	es.Add(&Extent{Offset: 21, Length: 0}, "")
+	patch, err = es.CreatePatch(iotest.OneByteReader(strings.NewReader(a)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patch.IsEmpty() {
+		t.Fatalf("Expected an empty patch; got\n%s", patch)
+	}
+	es = NewEditSet()
+	es.Add(&Extent{Offset: 2, Length: 6}, "2\n3\n5\n")
+	patch, err = es.CreatePatchWithContext(iotest.OneByteReader(strings.NewReader(a)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &b); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("--- filename\n+++ filename\n"+
+		"@@ -2,3 +2,3 @@\n 2\n 3\n-4\n+5\n", b.String(), t)
+}
+
+// TestPatchTools checks that the patch(1) and git apply commands (if they are
+// installed) accept the diffs of patchEdgeCases and produce the new files.
+func TestPatchTools(t *testing.T) {
+	tools := map[string][]string{
+		"patch": {"patch", "-s", "filename"},
+		"git":   {"git", "apply", "-"},
+	}
+	for name, args := range tools {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Logf("Skipping %s: %s", name, err)
+			continue
+		}
+		for _, c := range patchEdgeCases {
+			applyWithTool(args, c[0], c[1], t)
+		}
+	}
+}
+
+func unifiedDiff(a, b string, t *testing.T) string {
+	patch, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result bytes.Buffer
+	if err := patch.Write("filename", "filename", time.Time{}, time.Time{}, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.String()
+}
+
+func applyWithTool(args []string, a, b string, t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "filename")
+	if err := ioutil.WriteFile(filename, []byte(a), 0666); err != nil {
+		t.Fatal(err)
+	}
+	diff := unifiedDiff(a, b, t)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(diff)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s rejected the diff from %q to %q: %s\n%s\n%s",
+			args[0], a, b, err, out, diff)
+	}
+	result, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != b {
+		t.Fatalf("%s applied the diff from %q to %q incorrectly: got %q\n%s",
+			args[0], a, b, result, diff)
+	}
+}
+
+func TestPatchInvert(t *testing.T) {
+	cases := append([][2]string{
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			"1\nnew\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n13\n14\n15\n"},
+	}, patchEdgeCases...)
+	for _, c := range cases {
+		patch, err := DiffStrings(c[0], c[1]).CreatePatch(strings.NewReader(c[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inverse, err := patch.Invert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := inverse.ApplyToString(c[1])
+		if err != nil {
+			t.Fatalf("Inverse of diff from %q to %q did not apply: %s",
+				c[0], c[1], err)
+		}
+		assertEquals(c[0], result, t)
+
+		var buf bytes.Buffer
+		inverse.Write("filename", "filename", time.Time{}, time.Time{}, &buf)
+		assertEquals(unifiedDiff(c[1], c[0], t), buf.String(), t)
+	}
+}
+
 func TestRandomDiffs(t *testing.T) {
 	seed := time.Now().Unix()
 	r := rand.New(rand.NewSource(seed))
@@ -207,6 +548,58 @@ func TestRandomDiffs(t *testing.T) {
 	}
 }
 
+// TestDiffLinear checks that the linear-space algorithm produces valid edit
+// scripts that are as short as those produced by the basic algorithm.
+func TestDiffLinear(t *testing.T) {
+	seed := time.Now().Unix()
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < 100; i++ {
+		s1 := makeLines(1+r.Intn(100), r)
+		s2 := makeLines(1+r.Intn(100), r)
+		edits := diffLinear(s1, s2)
+		result, err := ApplyToString(edits, strings.Join(s1, ""))
+		if err != nil || result != strings.Join(s2, "") {
+			t.Fatalf("Linear diff failed - seed %d, iteration %d",
+				seed, i)
+		}
+		if expected := len(Diff(s1, s2).edits); len(edits.edits) != expected {
+			t.Fatalf("Linear diff has %d edits, not %d - seed %d, "+
+				"iteration %d", len(edits.edits), expected, seed, i)
+		}
+	}
+	for _, b := range []string{"a\nbcd", "abcfg", "defg", "abcd", "ag",
+		"bcd", "abd", "efg", "axy", "xcg", "xcdghy", "xabcdefgy"} {
+		edits := diffLinear(strings.Split("abcdefg", ""), strings.Split(b, ""))
+		result, err := ApplyToString(edits, "abcdefg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEquals(b, result, t)
+	}
+}
+
+// TestDiffLarge checks that Diff can compare large inputs that differ in many
+// places, which requires the linear-space algorithm.
+func TestDiffLarge(t *testing.T) {
+	a := make([]string, 50000)
+	b := make([]string, 50000)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d\n", i)
+		b[i] = a[i]
+		if i%100 == 0 {
+			b[i] = fmt.Sprintf("changed %d\n", i)
+		}
+	}
+	edits := Diff(a, b)
+	if len(edits.edits) != 2*len(a)/100 {
+		t.Fatalf("Expected %d edits; got %d", 2*len(a)/100, len(edits.edits))
+	}
+	result, err := ApplyToString(edits, strings.Join(a, ""))
+	if err != nil || result != strings.Join(b, "") {
+		t.Fatalf("Large diff failed")
+	}
+}
+
 func BenchmarkDiff(b *testing.B) {
 	r := rand.New(rand.NewSource(time.Now().Unix()))
 	s1 := makeLines(5000, r)
@@ -217,6 +610,34 @@ func BenchmarkDiff(b *testing.B) {
 	}
 }
 
+// BenchmarkCreatePatch measures the time to create and write a patch with
+// many hunks, similar to the patch produced by a refactoring that changes
+// every few lines of a large file.
+func BenchmarkCreatePatch(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	lines := makeLines(10000, r)
+	orig := strings.Join(lines, "")
+	edits := NewEditSet()
+	offset := 0
+	for i, line := range lines {
+		if i%10 == 0 {
+			edits.Add(&Extent{Offset: offset, Length: len(line)},
+				strings.ToUpper(line))
+		}
+		offset += len(line)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		patch, err := edits.CreatePatch(strings.NewReader(orig))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := patch.Write("a", "b", time.Time{}, time.Time{}, ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func makeLines(count int, r *rand.Rand) []string {
 	possibilities := []string{
 		"Lorem ipsum dolor sit amet, consectetur adipisicing elit,\n",
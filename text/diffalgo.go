@@ -0,0 +1,286 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the patience and histogram diff algorithms, which can be
+// selected as alternatives to the Myers algorithm using DiffWithOptions.
+//
+// The Myers algorithm finds an edit script of minimum length, but when there
+// are several, the one it chooses often matches lines that are common in
+// source code (closing braces, blank lines, "return nil") rather than the
+// lines that actually correspond, so a diff that moves a function may appear
+// to rewrite two functions line by line.  Patience diff (described by Bram
+// Cohen; see http://bramcohen.livejournal.com/73318.html) and histogram diff
+// (an extension of patience diff from JGit) first match lines that are rare
+// in both files, then diff the lines between them, which usually produces
+// diffs that are easier to read, although they may contain more edits.
+
+package text
+
+import "fmt"
+
+// A DiffAlgorithm determines how DiffWithOptions computes the differences
+// between two lists of lines.
+type DiffAlgorithm int
+
+const (
+	// MyersDiff computes an edit script of minimum length (see Diff).
+	MyersDiff DiffAlgorithm = iota
+	// PatienceDiff matches lines that occur exactly once in each input,
+	// keeping as many as possible in order, then diffs the lines between
+	// them recursively.  Where there are no such lines, it uses MyersDiff.
+	PatienceDiff
+	// HistogramDiff matches the longest common run of lines containing the
+	// line that occurs the fewest times in the first input, then diffs the
+	// lines before and after it recursively.  Where all common lines occur
+	// too many times (see maxHistogramCount), it uses MyersDiff.
+	HistogramDiff
+)
+
+var diffAlgorithmNames = []string{"myers", "patience", "histogram"}
+
+func (a DiffAlgorithm) String() string {
+	if a < 0 || int(a) >= len(diffAlgorithmNames) {
+		return fmt.Sprintf("DiffAlgorithm(%d)", int(a))
+	}
+	return diffAlgorithmNames[a]
+}
+
+// ParseDiffAlgorithm returns the DiffAlgorithm with the given name (myers,
+// patience, or histogram).
+func ParseDiffAlgorithm(name string) (DiffAlgorithm, error) {
+	for i, n := range diffAlgorithmNames {
+		if n == name {
+			return DiffAlgorithm(i), nil
+		}
+	}
+	return MyersDiff, fmt.Errorf("invalid diff algorithm %q (must be myers, patience, or histogram)", name)
+}
+
+// DiffOptions determine how DiffWithOptions computes a diff.
+type DiffOptions struct {
+	// The algorithm used to compute the diff (default: MyersDiff)
+	Algorithm DiffAlgorithm
+}
+
+// DiffWithOptions creates an EditSet containing line additions and deletions
+// that change a into b, like Diff, using the algorithm given in the options
+// (which may be nil, for the defaults).  The EditSet has the same form as the
+// EditSet returned by Diff, but unless the algorithm is MyersDiff, it need
+// not contain the minimum number of edits.
+func DiffWithOptions(a, b []string, opts *DiffOptions) *EditSet {
+	if opts == nil || opts.Algorithm == MyersDiff ||
+		len(a) == 0 || len(b) == 0 {
+		return Diff(a, b)
+	}
+	d := &anchoredDiff{
+		editScript: newEditScript(a, b),
+		histogram:  opts.Algorithm == HistogramDiff,
+	}
+	d.compare(0, len(a), 0, len(b))
+	return &EditSet{edits: d.edits}
+}
+
+// DiffStringsWithOptions splits a and b into lines (see DiffStrings) and
+// returns an EditSet that changes a into b, computed by DiffWithOptions.
+func DiffStringsWithOptions(a, b string, opts *DiffOptions) *EditSet {
+	return DiffWithOptions(splitLines(a), splitLines(b), opts)
+}
+
+// SetDiffOptions determines how the lines in each hunk of this patch are
+// compared to determine which lines are deleted and added when the patch is
+// written (and by ModifiedLines, DetectMoves, and Stats).  Applying the patch
+// is not affected.  By default (or if opts is nil), lines are compared using
+// Diff.
+func (p *Patch) SetDiffOptions(opts *DiffOptions) {
+	p.diffOptions = opts
+}
+
+// diffLines compares the lines of a hunk before and after its edits are
+// applied, using the algorithm set by SetDiffOptions.
+func (p *Patch) diffLines(origLines, newLines []string) *EditSet {
+	return DiffWithOptions(origLines, newLines, p.diffOptions)
+}
+
+// maxHistogramCount is the maximum number of times a line can occur in the
+// first input for HistogramDiff to match it.  As in JGit, this bounds the
+// time spent searching for matches in inputs with many repeated lines.
+const maxHistogramCount = 64
+
+// An anchoredDiff computes an edit script using the patience or histogram
+// algorithm: it chooses lines to match (anchors), then recursively computes
+// the edits between them.
+type anchoredDiff struct {
+	editScript
+	histogram bool // HistogramDiff if true, PatienceDiff if false
+}
+
+// An anchor is a run of lines a[i:i+n] matched with b[j:j+n].
+type anchor struct {
+	i, j, n int
+}
+
+// compare appends the edits that change a[aLo:aHi] into b[bLo:bHi].  Edits
+// are appended in order (see linearDiff.compare).
+//
+// Unlike linearDiff.compare, it does not remove a common suffix before
+// choosing anchors, since lines in the suffix may be needed to match the
+// lines around an insertion or deletion; otherwise, a block of lines added
+// after a repeated line (e.g., a closing brace) could be placed before an
+// earlier occurrence of the same line.
+func (d *anchoredDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.insert(aLo, j)
+		}
+		return
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.delete(i)
+		}
+		return
+	}
+
+	var anchors []anchor
+	if d.histogram {
+		anchors = d.histogramAnchor(aLo, aHi, bLo, bHi)
+	} else {
+		anchors = d.patienceAnchors(aLo, aHi, bLo, bHi)
+	}
+	if len(anchors) == 0 {
+		d.compareMyers(aLo, aHi, bLo, bHi)
+		return
+	}
+	for _, m := range anchors {
+		d.compare(aLo, m.i, bLo, m.j)
+		aLo, bLo = m.i+m.n, m.j+m.n
+	}
+	d.compare(aLo, aHi, bLo, bHi)
+}
+
+// compareMyers appends the edits that change a[aLo:aHi] into b[bLo:bHi],
+// computed by Diff.
+func (d *anchoredDiff) compareMyers(aLo, aHi, bLo, bHi int) {
+	base := d.offsets[aLo]
+	for _, e := range Diff(d.a[aLo:aHi], d.b[bLo:bHi]).edits {
+		d.edits = append(d.edits,
+			edit{&Extent{base + e.Offset, e.Length}, e.replacement})
+	}
+}
+
+// patienceAnchors returns the longest sequence of lines that occur exactly
+// once in both a[aLo:aHi] and b[bLo:bHi] and appear in the same order in
+// both, as anchors of length 1.
+func (d *anchoredDiff) patienceAnchors(aLo, aHi, bLo, bHi int) []anchor {
+	type occurrence struct {
+		countA, countB int
+		i, j           int
+	}
+	lines := map[string]*occurrence{}
+	for i := aLo; i < aHi; i++ {
+		o := lines[d.a[i]]
+		if o == nil {
+			o = &occurrence{}
+			lines[d.a[i]] = o
+		}
+		o.countA++
+		o.i = i
+	}
+	for j := bLo; j < bHi; j++ {
+		if o := lines[d.b[j]]; o != nil {
+			o.countB++
+			o.j = j
+		}
+	}
+	unique := []anchor{} // Unique common lines, in the order they occur in a
+	for i := aLo; i < aHi; i++ {
+		if o := lines[d.a[i]]; o.countA == 1 && o.countB == 1 {
+			unique = append(unique, anchor{o.i, o.j, 1})
+		}
+	}
+	return longestIncreasing(unique)
+}
+
+// longestIncreasing returns the longest subsequence of the given anchors
+// whose lines in b are increasing, using patience sorting.
+func longestIncreasing(anchors []anchor) []anchor {
+	if len(anchors) == 0 {
+		return nil
+	}
+	// piles[k] is the index of the anchor on top of the kth pile, i.e., the
+	// anchor with the smallest j that ends an increasing subsequence of
+	// length k+1; prev[i] is the anchor preceding anchors[i] in such a
+	// subsequence
+	piles := []int{}
+	prev := make([]int, len(anchors))
+	for i, m := range anchors {
+		lo, hi := 0, len(piles)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if anchors[piles[mid]].j < m.j {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = piles[lo-1]
+		}
+		if lo == len(piles) {
+			piles = append(piles, i)
+		} else {
+			piles[lo] = i
+		}
+	}
+	result := make([]anchor, len(piles))
+	for k, i := len(piles)-1, piles[len(piles)-1]; k >= 0; k, i = k-1, prev[i] {
+		result[k] = anchors[i]
+	}
+	return result
+}
+
+// histogramAnchor returns the longest run of lines common to a[aLo:aHi] and
+// b[bLo:bHi] that contains a line occurring the fewest times in a[aLo:aHi]
+// (and at most maxHistogramCount times), or nil if there is no such run.
+func (d *anchoredDiff) histogramAnchor(aLo, aHi, bLo, bHi int) []anchor {
+	positions := map[string][]int{} // Lines of a[aLo:aHi] -> indices in a
+	for i := aLo; i < aHi; i++ {
+		positions[d.a[i]] = append(positions[d.a[i]], i)
+	}
+
+	var best anchor
+	bestCount := maxHistogramCount + 1
+	for j := bLo; j < bHi; {
+		next := j + 1
+		for _, i := range positions[d.b[j]] {
+			// Extend the match of a[i] and b[j] in both directions,
+			// noting the lowest count of any line in the run
+			m := anchor{i, j, 1}
+			count := len(positions[d.b[j]])
+			for m.i > aLo && m.j > bLo && d.a[m.i-1] == d.b[m.j-1] {
+				m.i, m.j, m.n = m.i-1, m.j-1, m.n+1
+				count = min(count, len(positions[d.a[m.i]]))
+			}
+			for m.i+m.n < aHi && m.j+m.n < bHi &&
+				d.a[m.i+m.n] == d.b[m.j+m.n] {
+				count = min(count, len(positions[d.a[m.i+m.n]]))
+				m.n++
+			}
+			if count < bestCount || count == bestCount && m.n > best.n {
+				best, bestCount = m, count
+			}
+			next = max(next, m.j+m.n)
+		}
+		j = next
+	}
+	if bestCount > maxHistogramCount {
+		return nil
+	}
+	return []anchor{best}
+}
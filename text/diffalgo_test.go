@@ -0,0 +1,205 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDiffAlgorithm(t *testing.T) {
+	for _, a := range []DiffAlgorithm{MyersDiff, PatienceDiff, HistogramDiff} {
+		parsed, err := ParseDiffAlgorithm(a.String())
+		if err != nil || parsed != a {
+			t.Fatalf("Could not parse %s", a)
+		}
+	}
+	if _, err := ParseDiffAlgorithm("minimal"); err == nil {
+		t.Fatal("Expected an error for an invalid diff algorithm")
+	}
+}
+
+func TestDiffWithOptionsRandom(t *testing.T) {
+	seed := time.Now().Unix()
+	r := rand.New(rand.NewSource(seed))
+	for _, alg := range []DiffAlgorithm{PatienceDiff, HistogramDiff} {
+		for i := 0; i < 100; i++ {
+			s1 := makeLines(r.Intn(100), r)
+			s2 := makeLines(r.Intn(100), r)
+			edits := DiffWithOptions(s1, s2, &DiffOptions{Algorithm: alg})
+			result, err := ApplyToString(edits, strings.Join(s1, ""))
+			if err != nil || result != strings.Join(s2, "") {
+				t.Fatalf("%s diff failed - seed %d, iteration %d",
+					alg, seed, i)
+			}
+		}
+	}
+}
+
+// Swapping two functions with similar bodies: the Myers diff matches the lines
+// the functions have in common, as does the histogram diff (after matching
+// beta, the longest run of lines that occur once), while the patience diff
+// moves the functions as a whole.
+const (
+	alphaBetaGamma = `func alpha() error {
+	for _, x := range alpha0 {
+		use(x)
+	}
+	if err := alpha1(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func beta() error {
+	beta0()
+	return nil
+}
+
+func gamma() error {
+	for _, x := range gamma0 {
+		use(x)
+	}
+	return nil
+}
+`
+	gammaBetaAlpha = `func gamma() error {
+	for _, x := range gamma0 {
+		use(x)
+	}
+	return nil
+}
+
+func beta() error {
+	beta0()
+	return nil
+}
+
+func alpha() error {
+	for _, x := range alpha0 {
+		use(x)
+	}
+	if err := alpha1(); err != nil {
+		return err
+	}
+	return nil
+}
+`
+)
+
+func TestPatchSetDiffOptions(t *testing.T) {
+	tests := map[DiffAlgorithm]string{
+		MyersDiff: `@@ -1,9 +1,6 @@
+-func alpha() error {
+-	for _, x := range alpha0 {
++func gamma() error {
++	for _, x := range gamma0 {
+ 		use(x)
+ 	}
+-	if err := alpha1(); err != nil {
+-		return err
+-	}
+ 	return nil
+ }
+@@ -13,9 +10,12 @@
+ 	return nil
+ }
+ 
+-func gamma() error {
+-	for _, x := range gamma0 {
++func alpha() error {
++	for _, x := range alpha0 {
+ 		use(x)
+ 	}
++	if err := alpha1(); err != nil {
++		return err
++	}
+ 	return nil
+ }
+`,
+		PatienceDiff: `@@ -1,3 +1,15 @@
++func gamma() error {
++	for _, x := range gamma0 {
++		use(x)
++	}
++	return nil
++}
++
++func beta() error {
++	beta0()
++	return nil
++}
++
+ func alpha() error {
+ 	for _, x := range alpha0 {
+ 		use(x)
+@@ -7,15 +19,3 @@
+ 	}
+ 	return nil
+ }
+-
+-func beta() error {
+-	beta0()
+-	return nil
+-}
+-
+-func gamma() error {
+-	for _, x := range gamma0 {
+-		use(x)
+-	}
+-	return nil
+-}
+`,
+		HistogramDiff: `@@ -1,9 +1,6 @@
+-func alpha() error {
+-	for _, x := range alpha0 {
++func gamma() error {
++	for _, x := range gamma0 {
+ 		use(x)
+-	}
+-	if err := alpha1(); err != nil {
+-		return err
+ 	}
+ 	return nil
+ }
+@@ -13,9 +10,12 @@
+ 	return nil
+ }
+ 
+-func gamma() error {
+-	for _, x := range gamma0 {
++func alpha() error {
++	for _, x := range alpha0 {
+ 		use(x)
++	}
++	if err := alpha1(); err != nil {
++		return err
+ 	}
+ 	return nil
+ }
+`,
+	}
+	for alg, expected := range tests {
+		opts := &DiffOptions{Algorithm: alg}
+		patch, err := DiffStringsWithOptions(alphaBetaGamma, gammaBetaAlpha, opts).
+			CreatePatch(strings.NewReader(alphaBetaGamma))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch.SetDiffOptions(opts)
+		var result bytes.Buffer
+		if err := patch.Write("", "", time.Time{}, time.Time{}, &result); err != nil {
+			t.Fatal(err)
+		}
+		diff := result.String()
+		diff = diff[strings.Index(diff, "@@"):]
+		if diff != expected {
+			t.Errorf("%s diff: expected\n%s\ngot\n%s", alg, expected, diff)
+		}
+	}
+}
@@ -147,11 +147,20 @@ func (e *EditSet) Add(pos *Extent, replacement string) error {
 			break
 		}
 	}
-	if idx > 0 && e.edits[idx-1].overlaps(pos) {
-		return fmt.Errorf("overlapping edit at offset %d", pos.Offset)
+	// Insertions (length-zero edits) do not overlap adjacent edits, so
+	// check past them to the nearest edits with nonzero length
+	for i := idx - 1; i >= 0; i-- {
+		if e.edits[i].overlaps(pos) {
+			return fmt.Errorf("overlapping edit at offset %d", pos.Offset)
+		}
+		if e.edits[i].Length > 0 {
+			break
+		}
 	}
-	if idx < len(e.edits) && e.edits[idx].overlaps(pos) {
-		return fmt.Errorf("overlapping edit at offset %d", pos.Offset)
+	for i := idx; i < len(e.edits) && e.edits[i].Offset <= pos.OffsetPastEnd(); i++ {
+		if e.edits[i].overlaps(pos) {
+			return fmt.Errorf("overlapping edit at offset %d", pos.Offset)
+		}
 	}
 	newEdit := edit{pos, replacement}
 	e.edits = append(e.edits, newEdit)
@@ -214,6 +223,34 @@ func (e *EditSet) SizeChange() int64 {
 	return total
 }
 
+// Invert returns an EditSet that reverses this EditSet, i.e., if this EditSet
+// transforms the string original into the string s, the resulting EditSet
+// transforms s back into original.  It returns an error if an edit extends
+// beyond the end of original.
+func (e *EditSet) Invert(original string) (*EditSet, error) {
+	result := NewEditSet()
+	adjust := 0
+	end := 0 // Offset in original following the edits so far
+	for _, ed := range e.edits {
+		if ed.OffsetPastEnd() > len(original) {
+			return nil, fmt.Errorf("edit at offset %d extends past end of string (length %d)",
+				ed.Offset, len(original))
+		}
+		// Like ApplyTo, apply an insertion at the same offset as the
+		// preceding edit after that edit's replacement text
+		offset := max(ed.Offset, end)
+		result.edits = append(result.edits, edit{
+			&Extent{
+				Offset: offset + adjust,
+				Length: len(ed.replacement),
+			},
+			original[ed.Offset:ed.OffsetPastEnd()]})
+		adjust += len(ed.replacement) - ed.Length
+		end = max(end, ed.OffsetPastEnd())
+	}
+	return result, nil
+}
+
 // Iterate executes the given callback on each of the edits in this EditSet,
 // traversing the edits in ascending order by offset.  Iteration stops
 // immediately after the callback returns false.
@@ -238,8 +275,10 @@ func (e *EditSet) String() string {
 // ApplyTo reads from the given reader, applying the edits in this EditSet as
 // it reads, and writes the output to the given writer.  It returns an error if
 // there are edits with offsets beyond the end of the input or some other error
-// occurs, such as an I/O error.
+// occurs, such as an I/O error.  (If CheckInvariants is true, it panics if
+// this EditSet is invalid.)
 func (e *EditSet) ApplyTo(in io.Reader, out io.Writer) error {
+	e.checkInvariants()
 	bufin := bufio.NewReader(in)
 	bufout := bufio.NewWriter(out)
 	return e.applyTo(bufin, bufout)
@@ -295,7 +334,19 @@ func (e *EditSet) applyTo(in *bufio.Reader, out *bufio.Writer) error {
 // CreatePatch creates a Patch from this EditSet.  A Patch can be output as a
 // unified diff by invoking the Patch's Write method.
 func (e *EditSet) CreatePatch(in io.Reader) (result *Patch, err error) {
-	return createPatch(e, in)
+	return createPatch(e, in, numCtxLines)
+}
+
+// CreatePatchWithContext creates a Patch from this EditSet, like CreatePatch,
+// but with at most ctxLines lines of context preceding and following each
+// change (rather than 3).  For example, 0 produces a minimal patch, like
+// diff -U0, while a larger number may be useful when a patch is reviewed.
+func (e *EditSet) CreatePatchWithContext(in io.Reader, ctxLines int) (result *Patch, err error) {
+	if ctxLines < 0 {
+		return nil, fmt.Errorf("number of context lines is negative (%d)",
+			ctxLines)
+	}
+	return createPatch(e, in, ctxLines)
 }
 
 // ApplyToString reads bytes from a string, applying the edits in an EditSet
@@ -4,7 +4,10 @@
 
 package text
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // -=-= Extent =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
@@ -96,6 +99,40 @@ func TestSizeChange(t *testing.T) {
 	}
 }
 
+func TestInvert(t *testing.T) {
+	original := "0123456789"
+	es := NewEditSet()
+	es.Add(&Extent{2, 5}, "x")   // replace 5 bytes with 1
+	es.Add(&Extent{7, 0}, "abc") // insert
+	es.Add(&Extent{9, 1}, "")    // delete
+	edited := applyToString(es, original)
+	assertEquals("01xabc78", edited, t)
+
+	inverse, err := es.Invert(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(original, applyToString(inverse, edited), t)
+
+	if _, err := es.Invert("0123"); err == nil {
+		t.Fatal("Invert should fail when edits extend past the end")
+	}
+
+	// An insertion added before a replacement at the same offset is
+	// applied after the replacement text
+	es = NewEditSet()
+	es.Add(&Extent{2, 0}, "abc") // insert
+	es.Add(&Extent{2, 5}, "x")   // replace 5 bytes with 1
+	edited = applyToString(es, original)
+	assertEquals("01xabc789", edited, t)
+
+	inverse, err = es.Invert(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(original, applyToString(inverse, edited), t)
+}
+
 func TestNewOldOffset(t *testing.T) {
 	es := NewEditSet()
 	es.Add(&Extent{2, 5}, "x") // replace 5 bytes with 1 (-4)
@@ -174,6 +211,28 @@ func TestOverlap(t *testing.T) {
 	}
 }
 
+func TestOverlapPastInsertion(t *testing.T) {
+	// An insertion at offset 3 is sorted before an edit at offset 3 if it
+	// is added later and after it if it is added earlier, so an
+	// overlapping edit can be on either side of the insertion
+	es := NewEditSet()
+	es.Add(&Extent{3, 4}, "x")
+	es.Add(&Extent{3, 0}, "y")
+	if err := es.Add(&Extent{3, 1}, "z"); err == nil {
+		t.Fatalf("Overlapping edit following an insertion undetected")
+	}
+
+	es = NewEditSet()
+	es.Add(&Extent{3, 0}, "y")
+	es.Add(&Extent{3, 4}, "x")
+	if err := es.Add(&Extent{4, 1}, "z"); err == nil {
+		t.Fatalf("Overlapping edit preceding an insertion undetected")
+	}
+	if err := es.Validate(-1); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestEditApply(t *testing.T) {
 	input := "0123456789"
 
@@ -224,3 +283,20 @@ func TestEditApply(t *testing.T) {
 	es.Add(&Extent{0, 0}, "")
 	assertEquals("", applyToString(es, ""), t)
 }
+
+// BenchmarkApplyEditSet measures the time to apply an EditSet containing
+// many edits to a large input.
+func BenchmarkApplyEditSet(b *testing.B) {
+	input := strings.Repeat("0123456789", 100000)
+	es := NewEditSet()
+	for offset := 0; offset < len(input); offset += 50 {
+		es.Add(&Extent{Offset: offset, Length: 5}, "abcdefg")
+	}
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ApplyToString(es, input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for preserving a file's byte order mark, line
+// endings, and final newline when it is edited.  Refactorings generate code
+// with Unix line endings and no byte order mark, so without this, refactoring
+// a file with Windows line endings would produce a file with a mix of line
+// endings, which version control systems (e.g., git) report as changes to
+// lines that were not modified.
+
+package text
+
+import (
+	"bytes"
+	"strings"
+)
+
+// utf8BOM is the UTF-8 encoding of the byte order mark, U+FEFF.
+const utf8BOM = "\xef\xbb\xbf"
+
+// A FileFormat describes properties of a file's contents that are not
+// significant to the Go compiler but should be preserved when the file is
+// edited.
+type FileFormat struct {
+	// True iff the file begins with a UTF-8 byte order mark
+	BOM bool
+	// The line ending used by most lines in the file: "\n" or "\r\n"
+	LineEnding string
+	// True iff the file is empty or its last line ends with a line ending
+	FinalNewline bool
+}
+
+// DetectFileFormat determines the FileFormat of the given file contents.  If
+// the file contains equally many Unix and Windows line endings (e.g., if it
+// contains a single line), its LineEnding is "\n".
+func DetectFileFormat(contents []byte) *FileFormat {
+	crlf := bytes.Count(contents, []byte("\r\n"))
+	lf := bytes.Count(contents, []byte("\n")) - crlf
+	result := &FileFormat{
+		BOM:          bytes.HasPrefix(contents, []byte(utf8BOM)),
+		LineEnding:   "\n",
+		FinalNewline: len(contents) == 0 || contents[len(contents)-1] == '\n',
+	}
+	if crlf > lf {
+		result.LineEnding = "\r\n"
+	}
+	return result
+}
+
+// Restore converts the given contents to this format: it adds or removes the
+// byte order mark and final newline, and it changes every line ending to
+// f.LineEnding.  It is intended for text that was generated from scratch,
+// e.g., by formatting a file with go/printer.
+func (f *FileFormat) Restore(contents string) string {
+	contents = strings.TrimPrefix(contents, utf8BOM)
+	contents = convertLineEndings(contents, f.LineEnding)
+	contents = f.restoreFinalNewline(contents)
+	if f.BOM {
+		contents = utf8BOM + contents
+	}
+	return contents
+}
+
+// restoreFinalNewline adds or removes a line ending at the end of the given
+// (nonempty) contents so that it ends with a newline iff f.FinalNewline.
+func (f *FileFormat) restoreFinalNewline(contents string) string {
+	switch {
+	case contents == "" || contents == utf8BOM:
+		return contents
+	case f.FinalNewline && !strings.HasSuffix(contents, "\n"):
+		return contents + f.LineEnding
+	case !f.FinalNewline:
+		return strings.TrimSuffix(strings.TrimSuffix(contents, "\n"), "\r")
+	default:
+		return contents
+	}
+}
+
+// convertLineEndings changes every line ending in s to the given line ending
+// ("\n" or "\r\n").
+func convertLineEndings(s, lineEnding string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if lineEnding != "\n" {
+		s = strings.Replace(s, "\n", lineEnding, -1)
+	}
+	return s
+}
+
+// PreserveFileFormat returns an EditSet that makes the same changes to the
+// given file contents as the given EditSet, except that the result has the
+// same FileFormat as the original contents: text inserted by the edits uses
+// the file's predominant line ending, and the byte order mark and final
+// newline are retained (or omitted) as in the original file.  Edits that have
+// no effect after their line endings are converted are removed.  Lines that
+// are not edited are never changed, so a file with a mix of line endings
+// retains them.  An error is returned if the EditSet is not valid for the
+// contents (see Validate), e.g., if an edit extends beyond the end of the
+// file.
+func PreserveFileFormat(es *EditSet, contents []byte) (*EditSet, error) {
+	if err := es.Validate(len(contents)); err != nil {
+		return nil, err
+	}
+	f := DetectFileFormat(contents)
+	result := NewEditSet()
+	for _, e := range es.edits {
+		replacement := convertLineEndings(e.replacement, f.LineEnding)
+		if replacement == string(contents[e.Offset:e.OffsetPastEnd()]) {
+			continue
+		}
+		result.edits = append(result.edits,
+			edit{&Extent{e.Offset, e.Length}, replacement})
+	}
+
+	updated, err := ApplyToString(result, string(contents))
+	if err != nil {
+		return nil, err
+	}
+	if expected := f.restoreBOM(f.restoreFinalNewline(updated)); expected != updated {
+		// The edits removed the byte order mark or changed the final
+		// newline; since this is rare, correct it by replacing the
+		// edited lines rather than trying to adjust individual edits
+		return DiffStrings(string(contents), expected), nil
+	}
+	return result, nil
+}
+
+// restoreBOM adds a byte order mark to the given contents if the original file
+// had one but the contents do not.
+func (f *FileFormat) restoreBOM(contents string) string {
+	if f.BOM && !strings.HasPrefix(contents, utf8BOM) {
+		return utf8BOM + contents
+	}
+	return contents
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import "testing"
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected FileFormat
+	}{
+		{"", FileFormat{false, "\n", true}},
+		{"package p", FileFormat{false, "\n", false}},
+		{"package p\n", FileFormat{false, "\n", true}},
+		{"package p\r\n\r\nvar x int\r\n", FileFormat{false, "\r\n", true}},
+		{"a\r\nb\nc\r\n", FileFormat{false, "\r\n", true}},
+		{"a\r\nb\n", FileFormat{false, "\n", true}},
+		{"\xef\xbb\xbfpackage p\r\nvar x int", FileFormat{true, "\r\n", false}},
+	}
+	for _, test := range tests {
+		if f := DetectFileFormat([]byte(test.contents)); *f != test.expected {
+			t.Errorf("DetectFileFormat(%q): expected %+v; got %+v",
+				test.contents, test.expected, *f)
+		}
+	}
+}
+
+func TestFileFormatRestore(t *testing.T) {
+	tests := []struct {
+		orig, generated, expected string
+	}{
+		{"a\nb\n", "x\ny\n", "x\ny\n"},
+		{"a\r\nb\r\n", "x\ny\n", "x\r\ny\r\n"},
+		{"a\r\nb", "x\ny\n", "x\r\ny"},
+		{"a\nb", "x\r\ny", "x\ny"},
+		{"\xef\xbb\xbfa\r\n", "x\n", "\xef\xbb\xbfx\r\n"},
+		{"a\n", "\xef\xbb\xbfx", "x\n"},
+	}
+	for _, test := range tests {
+		f := DetectFileFormat([]byte(test.orig))
+		if result := f.Restore(test.generated); result != test.expected {
+			t.Errorf("Restore(%q) for %q: expected %q; got %q",
+				test.generated, test.orig, test.expected, result)
+		}
+	}
+}
+
+func TestPreserveFileFormat(t *testing.T) {
+	tests := []struct {
+		orig     string
+		edits    []edit
+		expected string
+	}{
+		// Inserted lines use the file's line ending
+		{"a\r\nb\r\n", []edit{{&Extent{3, 0}, "x\ny\n"}},
+			"a\r\nx\r\ny\r\nb\r\n"},
+		{"a\nb\n", []edit{{&Extent{2, 0}, "x\r\n"}},
+			"a\nx\nb\n"},
+		// Lines that are not edited are unchanged in a mixed file
+		{"a\r\nb\nc\r\n", []edit{{&Extent{5, 1}, "x\ny"}},
+			"a\r\nb\nx\r\ny\r\n"},
+		// The byte order mark and final newline are retained
+		{"\xef\xbb\xbfa\r\nb\r\n", []edit{{&Extent{0, 6}, "x\n"}},
+			"\xef\xbb\xbfx\r\nb\r\n"},
+		{"a\r\nb", []edit{{&Extent{3, 1}, "x\ny\n"}},
+			"a\r\nx\r\ny"},
+		{"a\r\nb\r\n", []edit{{&Extent{3, 3}, "x"}},
+			"a\r\nx\r\n"},
+	}
+	for _, test := range tests {
+		es := &EditSet{edits: test.edits}
+		preserved, err := PreserveFileFormat(es, []byte(test.orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ApplyToString(preserved, test.orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != test.expected {
+			t.Errorf("PreserveFileFormat(%s) for %q: expected %q; got %q",
+				es, test.orig, test.expected, result)
+		}
+	}
+
+	// Edits that only change line endings are removed
+	es := NewEditSet()
+	es.Add(&Extent{0, 3}, "a\n")
+	es.Add(&Extent{3, 3}, "x\n")
+	preserved, err := PreserveFileFormat(es, []byte("a\r\nb\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preserved.edits) != 1 || preserved.edits[0].Offset != 3 ||
+		preserved.edits[0].replacement != "x\r\n" {
+		t.Errorf("Expected only the edit at offset 3; got %s", preserved)
+	}
+
+	// An edit past the end of the file is an error, not a panic
+	es = NewEditSet()
+	es.Add(&Extent{4, 10}, "x")
+	if _, err := PreserveFileFormat(es, []byte("a\r\nb\r\n")); err == nil {
+		t.Errorf("Expected an error for an edit past the end of the file")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for writing patches in the format of git diff,
+// so they can be applied with git apply or git am.
+
+package text
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+// gitFileMode is the mode given for files in a git diff (a regular file that
+// is not executable).
+const gitFileMode = "100644"
+
+// gitNullID is the abbreviated blob ID given for a file that does not exist.
+const gitNullID = "0000000"
+
+// GitBlobID returns the object ID git assigns to a file with the given
+// contents, i.e., the SHA-1 hash of a blob object.
+func GitBlobID(contents []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(contents))
+	h.Write(contents)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteGit writes this patch in the format of git diff, so it can be applied
+// using git apply (or, as part of a larger patch, git am).  The ---/+++
+// filenames have a/ and b/ prefixes, and they are preceded by a "diff --git"
+// line and an index line, which gives the blob IDs (see GitBlobID) of the
+// file's contents before and after the patch, orig and updated.
+//
+// If the patch creates the file, origFile should be empty; if it deletes the
+// file, newFile should be empty.  If both are given but differ, the patch
+// renames the file.  Nothing is written if the patch is empty, unless it
+// creates, deletes, or renames the file.
+func (p *Patch) WriteGit(origFile, newFile string, orig, updated []byte, out io.Writer) error {
+	created, deleted := origFile == "", newFile == ""
+	renamed := !created && !deleted && origFile != newFile
+	if p.IsEmpty() && !created && !deleted && !renamed {
+		return nil
+	}
+	if created {
+		origFile = newFile
+	} else if deleted {
+		newFile = origFile
+	}
+
+	fmt.Fprintf(out, "diff --git a/%s b/%s\n", origFile, newFile)
+	origID, newID := abbrevID(orig), abbrevID(updated)
+	mode := " " + gitFileMode
+	switch {
+	case created:
+		fmt.Fprintf(out, "new file mode %s\n", gitFileMode)
+		origID, mode = gitNullID, ""
+	case deleted:
+		fmt.Fprintf(out, "deleted file mode %s\n", gitFileMode)
+		newID, mode = gitNullID, ""
+	case renamed:
+		similarity, err := p.similarity(orig, updated)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "similarity index %d%%\n", similarity)
+		fmt.Fprintf(out, "rename from %s\nrename to %s\n", origFile, newFile)
+		if p.IsEmpty() {
+			return nil
+		}
+	}
+	if _, err := fmt.Fprintf(out, "index %s..%s%s\n", origID, newID, mode); err != nil {
+		return err
+	}
+
+	from, to := "a/"+origFile, "b/"+newFile
+	if created {
+		from = "/dev/null"
+	} else if deleted {
+		to = "/dev/null"
+	}
+	return p.Write(from, to, time.Time{}, time.Time{}, out)
+}
+
+// abbrevID returns the abbreviated (7-character) blob ID for the given file
+// contents, as displayed in the index line of a git diff.
+func abbrevID(contents []byte) string {
+	return GitBlobID(contents)[:len(gitNullID)]
+}
+
+// similarity returns the percentage of the original file's bytes that are
+// not deleted by this patch (relative to the size of the larger of the
+// original and new files), which is given as the similarity index of a
+// renamed file.
+func (p *Patch) similarity(orig, updated []byte) (int, error) {
+	size := max(len(orig), len(updated))
+	if size == 0 {
+		return 100, nil
+	}
+	stats, err := p.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return (len(orig) - stats.BytesRemoved) * 100 / size, nil
+}
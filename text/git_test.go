@@ -0,0 +1,124 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitBlobID(t *testing.T) {
+	// Computed by git hash-object
+	assertEquals("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", GitBlobID(nil), t)
+	assertEquals("ce013625030ba8dba906f756967f9e9ca394464a",
+		GitBlobID([]byte("hello\n")), t)
+}
+
+func writeGit(origFile, newFile, a, b string, t *testing.T) string {
+	patch, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orig, updated []byte
+	if origFile != "" {
+		orig = []byte(a)
+	}
+	if newFile != "" {
+		updated = []byte(b)
+	}
+	var result bytes.Buffer
+	if err := patch.WriteGit(origFile, newFile, orig, updated, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.String()
+}
+
+func TestPatchWriteGit(t *testing.T) {
+	assertEquals("diff --git a/f.txt b/f.txt\n"+
+		"index ce01362..dd7e1c6 100644\n"+
+		"--- a/f.txt\n"+
+		"+++ b/f.txt\n"+
+		"@@ -1,1 +1,1 @@\n"+
+		"-hello\n"+
+		"+goodbye\n",
+		writeGit("f.txt", "f.txt", "hello\n", "goodbye\n", t), t)
+	assertEquals("", writeGit("f.txt", "f.txt", "hello\n", "hello\n", t), t)
+	assertEquals("diff --git a/new.txt b/new.txt\n"+
+		"new file mode 100644\n"+
+		"index 0000000..ce01362\n"+
+		"--- /dev/null\n"+
+		"+++ b/new.txt\n"+
+		"@@ -0,0 +1,1 @@\n"+
+		"+hello\n",
+		writeGit("", "new.txt", "", "hello\n", t), t)
+	assertEquals("diff --git a/old.txt b/old.txt\n"+
+		"deleted file mode 100644\n"+
+		"index ce01362..0000000\n"+
+		"--- a/old.txt\n"+
+		"+++ /dev/null\n"+
+		"@@ -1,1 +0,0 @@\n"+
+		"-hello\n",
+		writeGit("old.txt", "", "hello\n", "", t), t)
+	assertEquals("diff --git a/old.txt b/new.txt\n"+
+		"similarity index 100%\n"+
+		"rename from old.txt\n"+
+		"rename to new.txt\n",
+		writeGit("old.txt", "new.txt", "hello\n", "hello\n", t), t)
+}
+
+// TestPatchWriteGitApply checks that git apply (if it is installed) accepts
+// diffs that modify, create, delete, and rename files.
+func TestPatchWriteGitApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("Skipping git: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{
+		"modified.txt": "1\n2\n3\n",
+		"deleted.txt":  "gone\n",
+		"renamed.txt":  "a\nb\nc\nd\ne\nf\ng\nh\n",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	diff := writeGit("modified.txt", "modified.txt", "1\n2\n3\n", "1\ntwo\n3", t) +
+		writeGit("deleted.txt", "", "gone\n", "", t) +
+		writeGit("", "sub/created.txt", "", "new\n", t) +
+		writeGit("renamed.txt", "moved.txt", "a\nb\nc\nd\ne\nf\ng\nh\n",
+			"a\nb\nc\nD\ne\nf\ng\nh\n", t)
+	cmd := exec.Command("git", "apply", "-")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(diff)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply rejected the diff: %s\n%s\n%s", err, out, diff)
+	}
+	for name, expected := range map[string]string{
+		"modified.txt":    "1\ntwo\n3",
+		"sub/created.txt": "new\n",
+		"moved.txt":       "a\nb\nc\nD\ne\nf\ng\nh\n",
+	} {
+		result, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEquals(expected, string(result), t)
+	}
+	for _, name := range []string{"deleted.txt", "renamed.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("Expected git apply to remove %s", name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for intra-line diffs, i.e., determining which
+// parts of a line changed when a Patch replaces it with a similar line, so
+// that a user interface can highlight precisely what changed rather than the
+// entire line.
+
+package text
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A DiffUnit determines how lines are divided before their differences are
+// computed by ModifiedLines.
+type DiffUnit int
+
+const (
+	// CharDiff compares lines character by character.
+	CharDiff DiffUnit = iota
+	// WordDiff compares lines word by word, where a word is a run of
+	// letters, digits, and underscores, a run of whitespace, or any other
+	// single character.
+	WordDiff
+)
+
+// A ModifiedLine is a line that a Patch deletes and replaces with another
+// line, together with the parts of each line that differ.
+//
+// Lines are paired as they appear in a unified diff: within each block of
+// deleted and added lines, the first deleted line is paired with the first
+// added line, the second with the second, and so on.
+type ModifiedLine struct {
+	OrigLine int       // 1-based line number in the original file
+	NewLine  int       // 1-based line number in the new file
+	Orig     string    // Original line, without its newline
+	New      string    // New line, without its newline
+	Deleted  []*Extent // Byte ranges of Orig that were deleted or replaced
+	Inserted []*Extent // Byte ranges of New that were inserted
+}
+
+// ModifiedLines returns the lines this Patch replaces (see ModifiedLine) in
+// the order they appear in the patch, along with the spans of each line that
+// changed, as determined by a Myers diff of the lines' characters or words.
+// Lines that are only deleted or only added are not included.
+func (p *Patch) ModifiedLines(unit DiffUnit) ([]*ModifiedLine, error) {
+	result := []*ModifiedLine{}
+	lineOffset := 0
+	for _, h := range p.hunks {
+		origLines, newLines, err := computeLines(h)
+		if err != nil {
+			return nil, err
+		}
+
+		// Traverse the deletions and additions as writeDiffHunk does,
+		// pairing lines in each block of deletions and additions
+		var deleted, added numberedLines
+		flush := func() {
+			for i := 0; i < len(deleted) && i < len(added); i++ {
+				result = append(result, modifiedLine(deleted[i],
+					added[i], unit))
+			}
+			deleted, added = nil, nil
+		}
+		it := p.diffLines(origLines, newLines).newEditIter()
+		origLine := h.startLine
+		newLine := h.startLine + lineOffset
+		offset := 0
+		for i, line := range origLines {
+			isDeleted := false
+			for it.edit() != nil && (it.edit().Offset == offset ||
+				i == len(origLines)-1) {
+				edit := it.edit()
+				if edit.Length > 0 {
+					deleted = append(deleted,
+						numberedLine{origLine, line})
+					isDeleted = true
+				} else if edit.replacement != "" {
+					added = append(added,
+						numberedLine{newLine, edit.replacement})
+					newLine++
+				}
+				it.moveToNextEdit()
+			}
+			if !isDeleted {
+				flush()
+				newLine++
+			}
+			origLine++
+			offset += len(line)
+		}
+		flush()
+		lineOffset += lenWithoutLastIfEmpty(newLines) -
+			lenWithoutLastIfEmpty(origLines)
+	}
+	return result, nil
+}
+
+// modifiedLine returns a ModifiedLine describing the replacement of the given
+// original line with the given new line.
+func modifiedLine(orig, new numberedLine, unit DiffUnit) *ModifiedLine {
+	result := &ModifiedLine{
+		OrigLine: orig.line,
+		NewLine:  new.line,
+		Orig:     strings.TrimSuffix(orig.text, "\n"),
+		New:      strings.TrimSuffix(new.text, "\n"),
+	}
+	result.Deleted, result.Inserted = DiffSpans(result.Orig, result.New, unit)
+	return result
+}
+
+// DiffSpans computes a Myers diff of the characters or words of a and b, and
+// returns the byte ranges of a that are deleted and the byte ranges of b that
+// are inserted to change a into b.  Adjacent ranges are merged.
+func DiffSpans(a, b string, unit DiffUnit) (deleted, inserted []*Extent) {
+	deleted, inserted = []*Extent{}, []*Extent{}
+	pos, newPos := 0, 0 // Offsets in a and b of the next unchanged byte
+	Diff(splitUnits(a, unit), splitUnits(b, unit)).Iterate(
+		func(extent *Extent, replacement string) bool {
+			newPos += extent.Offset - pos
+			pos = extent.Offset
+			if extent.Length > 0 {
+				deleted = addSpan(deleted, extent.Offset, extent.Length)
+				pos += extent.Length
+			}
+			if replacement != "" {
+				inserted = addSpan(inserted, newPos, len(replacement))
+				newPos += len(replacement)
+			}
+			return true
+		})
+	return deleted, inserted
+}
+
+// addSpan adds the given range to a list of ranges, merging it with the last
+// range if they are adjacent.
+func addSpan(spans []*Extent, offset, length int) []*Extent {
+	if len(spans) > 0 && spans[len(spans)-1].OffsetPastEnd() == offset {
+		spans[len(spans)-1].Length += length
+		return spans
+	}
+	return append(spans, &Extent{offset, length})
+}
+
+// splitUnits splits s into characters or words (see DiffUnit).
+func splitUnits(s string, unit DiffUnit) []string {
+	result := []string{}
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if unit == WordDiff {
+			switch {
+			case isWordChar(r):
+				size = runLength(s, isWordChar)
+			case unicode.IsSpace(r):
+				size = runLength(s, unicode.IsSpace)
+			}
+		}
+		result = append(result, s[:size])
+		s = s[size:]
+	}
+	return result
+}
+
+// isWordChar returns true iff r is a letter, digit, or underscore.
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// runLength returns the length (in bytes) of the longest prefix of s whose
+// characters all satisfy the given predicate.
+func runLength(s string, predicate func(rune) bool) int {
+	for i, r := range s {
+		if !predicate(r) {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// spans returns a string representation of a list of Extents, e.g., [7,1 9,2].
+func spans(extents []*Extent) string {
+	result := []string{}
+	for _, e := range extents {
+		result = append(result, fmt.Sprintf("%d,%d", e.Offset, e.Length))
+	}
+	return "[" + strings.Join(result, " ") + "]"
+}
+
+func TestDiffSpans(t *testing.T) {
+	tests := []struct {
+		a, b              string
+		unit              DiffUnit
+		deleted, inserted string
+	}{
+		{"", "", CharDiff, "[]", "[]"},
+		{"same", "same", CharDiff, "[]", "[]"},
+		{"foo(a, b)", "foo(a, c)", CharDiff, "[7,1]", "[7,1]"},
+		{"abc", "xabcy", CharDiff, "[]", "[0,1 4,1]"},
+		{"abcdef", "abef", CharDiff, "[2,2]", "[]"},
+		{"こんにちは", "こんばんは", CharDiff, "[6,6]", "[6,6]"},
+		{"var x int", "var yy int", CharDiff, "[4,1]", "[4,2]"},
+		{"var x int", "var xy int", WordDiff, "[4,1]", "[4,2]"},
+		{"f(a,  b)", "f(a, b)", WordDiff, "[4,2]", "[4,1]"},
+	}
+	for _, test := range tests {
+		deleted, inserted := DiffSpans(test.a, test.b, test.unit)
+		if spans(deleted) != test.deleted || spans(inserted) != test.inserted {
+			t.Fatalf("DiffSpans(%q, %q): expected %s %s; got %s %s",
+				test.a, test.b, test.deleted, test.inserted,
+				spans(deleted), spans(inserted))
+		}
+	}
+}
+
+func TestPatchModifiedLines(t *testing.T) {
+	a := "a\nfunc f(x int) {\n\treturn x\n}\nb\nc\n"
+	b := "a\nfunc f(y int) {\n\treturn y\n}\nb\nnew\nc"
+	p, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := p.ModifiedLines(CharDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, l := range lines {
+		result = append(result, fmt.Sprintf("%d:%q->%d:%q %s %s",
+			l.OrigLine, l.Orig, l.NewLine, l.New,
+			spans(l.Deleted), spans(l.Inserted)))
+	}
+	// Line 6 is replaced by two lines, so it is paired with the first
+	assertEquals(`2:"func f(x int) {"->2:"func f(y int) {" [7,1] [7,1]`+"\n"+
+		`3:"\treturn x"->3:"\treturn y" [8,1] [8,1]`+"\n"+
+		`6:"c"->6:"new" [0,1] [0,3]`,
+		strings.Join(result, "\n"), t)
+
+	// Lines that are only added or deleted are not included
+	p, err = DiffStrings("a\nb\n", "a\nb\nc\n").CreatePatch(strings.NewReader("a\nb\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := p.ModifiedLines(WordDiff); err != nil || len(lines) != 0 {
+		t.Fatalf("Expected no modified lines; got %d (%v)", len(lines), err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import "fmt"
+
+// CheckInvariants determines whether EditSets verify their invariants (see
+// Validate) each time they are applied.  When it is true, ApplyTo panics if
+// an EditSet's edits are out of order, overlap, or have negative offsets or
+// lengths.  Such an EditSet can only be produced by a bug (e.g., modifying an
+// Extent after it has been added to an EditSet), and applying it would
+// otherwise produce corrupted output silently.  (Edits that extend beyond the
+// end of the input are always reported as errors by ApplyTo, since they can
+// also occur when a file changes unexpectedly.)
+//
+// CheckInvariants is false by default.  It is set to true by the tests in
+// this package and by the refactoring tests, and in builds using the
+// godoctordebug build tag.
+var CheckInvariants = false
+
+// Validate checks that the edits in this EditSet are sorted by offset, do not
+// overlap, have nonnegative offsets and lengths, and (if length is
+// nonnegative) do not extend beyond the end of a text of the given length.
+// It returns an error describing the first violation found, or nil if there
+// are none.
+//
+// As in Add, an insertion (i.e., an edit with length 0) may have the same
+// offset as an adjacent edit, but an edit may not start strictly inside
+// another edit.
+func (e *EditSet) Validate(length int) error {
+	var widest *Extent // Previous edit extending farthest into the text
+	for i, edit := range e.edits {
+		switch {
+		case edit.Offset < 0 || edit.Length < 0:
+			return fmt.Errorf("edit %d (%s) has a negative "+
+				"offset or length", i, edit.Extent)
+		case i > 0 && edit.Offset < e.edits[i-1].Offset:
+			return fmt.Errorf("edit %d (%s) is out of order", i,
+				edit.Extent)
+		case widest != nil && widest.Intersect(edit.Extent) != nil:
+			return fmt.Errorf("edit %d (%s) overlaps a preceding "+
+				"edit (%s)", i, edit.Extent, widest)
+		case length >= 0 && edit.OffsetPastEnd() > length:
+			return fmt.Errorf("edit %d (%s) extends beyond the end "+
+				"of the text (%d bytes)", i, edit.Extent, length)
+		}
+		if widest == nil || edit.OffsetPastEnd() > widest.OffsetPastEnd() {
+			widest = edit.Extent
+		}
+	}
+	return nil
+}
+
+// checkInvariants panics if CheckInvariants is true and this EditSet does
+// not satisfy its invariants (see Validate).
+func (e *EditSet) checkInvariants() {
+	if CheckInvariants {
+		if err := e.Validate(-1); err != nil {
+			panic(fmt.Sprintf("invalid EditSet (internal error): %s\n%s",
+				err, e))
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build godoctordebug
+// +build godoctordebug
+
+package text
+
+func init() {
+	CheckInvariants = true
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	CheckInvariants = true
+}
+
+func TestValidate(t *testing.T) {
+	es := NewEditSet()
+	es.Add(&Extent{Offset: 2, Length: 0}, "A")
+	es.Add(&Extent{Offset: 2, Length: 3}, "B")
+	es.Add(&Extent{Offset: 5, Length: 0}, "C")
+	if err := es.Validate(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.Validate(4); err == nil {
+		t.Fatalf("Expected out-of-bounds error")
+	}
+
+	// Extents are pointers, so they can be (incorrectly) modified after
+	// they are added to an EditSet
+	extent := &Extent{Offset: 8, Length: 1}
+	es.Add(extent, "D")
+	extent.Offset = 3
+	if err := es.Validate(-1); err == nil {
+		t.Fatalf("Expected overlap error")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected ApplyTo to panic")
+		}
+	}()
+	ApplyToString(es, "0123456789")
+}
+
+// randomEditSet returns a random EditSet that can be applied to a string of
+// the given length.
+func randomEditSet(length int, r *rand.Rand) *EditSet {
+	es := NewEditSet()
+	for i := r.Intn(5); i > 0; i-- {
+		offset := r.Intn(length + 1)
+		extent := &Extent{
+			Offset: offset,
+			Length: r.Intn(length - offset + 1),
+		}
+		replacement := strings.Repeat("x", r.Intn(4))
+		// Overlapping edits are rejected by Add; that's fine
+		es.Add(extent, replacement)
+	}
+	return es
+}
+
+// applyNaively applies an EditSet to a string by slicing and concatenating
+// strings.  Like ApplyTo, it applies an insertion at the same offset as a
+// preceding edit after that edit's replacement text.
+func applyNaively(es *EditSet, s string) string {
+	result, pos := "", 0
+	for _, e := range es.edits {
+		if e.Offset > pos {
+			result += s[pos:e.Offset]
+			pos = e.Offset
+		}
+		result += e.replacement
+		if e.OffsetPastEnd() > pos {
+			pos = e.OffsetPastEnd()
+		}
+	}
+	return result + s[pos:]
+}
+
+func TestRandomEditSets(t *testing.T) {
+	seed := time.Now().Unix()
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < 1000; i++ {
+		input := "0123456789"[:r.Intn(11)]
+		es := randomEditSet(len(input), r)
+		if err := es.Validate(len(input)); err != nil {
+			t.Fatalf("Seed %d: %s\n%s", seed, err, es)
+		}
+
+		output, err := ApplyToString(es, input)
+		if err != nil {
+			t.Fatalf("Seed %d: %s\n%s", seed, err, es)
+		}
+		if expected := applyNaively(es, input); output != expected {
+			t.Fatalf("Seed %d: applying\n%sto %q produced %q, "+
+				"expected %q", seed, es, input, output, expected)
+		}
+		if int64(len(output)-len(input)) != es.SizeChange() {
+			t.Fatalf("Seed %d: SizeChange is %d, expected %d",
+				seed, es.SizeChange(), len(output)-len(input))
+		}
+
+		inverse, err := es.Invert(input)
+		if err != nil {
+			t.Fatalf("Seed %d: %s", seed, err)
+		}
+		if err := inverse.Validate(len(output)); err != nil {
+			t.Fatalf("Seed %d: inverse is invalid: %s\n%sfrom\n%s", seed,
+				err, inverse, es)
+		}
+		if original, _ := ApplyToString(inverse, output); original != input {
+			t.Fatalf("Seed %d: inverse produced %q, expected %q",
+				seed, original, input)
+		}
+
+		es.Iterate(func(extent *Extent, replacement string) bool {
+			if newOffset := es.NewOffset(extent.Offset); newOffset < 0 || newOffset > len(output) {
+				t.Fatalf("Seed %d: NewOffset(%d) = %d is out of "+
+					"bounds", seed, extent.Offset, newOffset)
+			}
+			return true
+		})
+	}
+}
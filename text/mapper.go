@@ -0,0 +1,156 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines OffsetMappers, which translate offsets in a file to the
+// corresponding offsets after one or more EditSets have been applied.
+
+package text
+
+// An OffsetMapper translates offsets in a file to the corresponding offsets
+// after one or more EditSets have been applied to it (and vice versa).  It is
+// obtained by invoking the Mapper method on an EditSet when that EditSet is
+// applied; mappers for EditSets that are applied successively can be combined
+// using the Then method.  This allows positions computed against the original
+// file (e.g., log entries or the locations of edits in a subsequent
+// refactoring) to be translated into positions in the edited file.
+//
+// An OffsetMapper is unaffected by changes made to the EditSet after it was
+// created.
+type OffsetMapper struct {
+	// The edits in each EditSet, in the order they are applied
+	steps [][]edit
+}
+
+// Mapper returns an OffsetMapper that translates offsets in a file to the
+// corresponding offsets after this EditSet has been applied to it.
+func (e *EditSet) Mapper() *OffsetMapper {
+	edits := make([]edit, len(e.edits))
+	copy(edits, e.edits)
+	return &OffsetMapper{steps: [][]edit{edits}}
+}
+
+// Then returns an OffsetMapper that maps offsets through this mapper and then
+// through next, i.e., it describes the effect of applying the EditSet(s)
+// corresponding to this mapper, then applying those corresponding to next.
+func (m *OffsetMapper) Then(next *OffsetMapper) *OffsetMapper {
+	steps := make([][]edit, 0, len(m.steps)+len(next.steps))
+	steps = append(steps, m.steps...)
+	steps = append(steps, next.steps...)
+	return &OffsetMapper{steps: steps}
+}
+
+// NewOffset returns the offset of the "same" byte as the given offset after
+// the edits have been applied.  Text inserted at the given offset precedes
+// the byte at that offset, so it is included in the adjustment.  If the byte
+// at the given offset is deleted or replaced, the offset of the start of its
+// replacement is returned.
+func (m *OffsetMapper) NewOffset(offset int) int {
+	for _, edits := range m.steps {
+		offset = newOffset(edits, offset)
+	}
+	return offset
+}
+
+// OldOffset takes an offset in the text that results when the edits have been
+// applied and returns the corresponding offset in the original text.  If the
+// given offset is in text that was inserted or replaced, the offset of the
+// start of the region that was replaced is returned.
+func (m *OffsetMapper) OldOffset(offset int) int {
+	for i := len(m.steps) - 1; i >= 0; i-- {
+		offset = oldOffset(m.steps[i], offset)
+	}
+	return offset
+}
+
+// NewExtent returns the region of the edited text corresponding to the given
+// region of the original text.  If edits replaced text at the boundaries of
+// the region, the result includes the replacement text; text inserted at the
+// start or end of the region is excluded.
+func (m *OffsetMapper) NewExtent(extent *Extent) *Extent {
+	start := m.NewOffset(extent.Offset)
+	end := start
+	if extent.Length > 0 {
+		end = m.endOffset(extent.OffsetPastEnd())
+	}
+	if end < start {
+		end = start
+	}
+	return &Extent{Offset: start, Length: end - start}
+}
+
+// endOffset maps the offset immediately following a region, so that text
+// inserted at that offset is not included in the region.
+func (m *OffsetMapper) endOffset(offset int) int {
+	for _, edits := range m.steps {
+		offset = endOffset(edits, offset)
+	}
+	return offset
+}
+
+// Replaced returns true if any of the edits deletes or replaces text in the
+// given region of the original text, or inserts text inside it (i.e., not at
+// its start or end).
+func (m *OffsetMapper) Replaced(extent *Extent) bool {
+	start, end := extent.Offset, extent.OffsetPastEnd()
+	for _, edits := range m.steps {
+		for _, e := range edits {
+			if e.Length > 0 && e.Offset < end && start < e.OffsetPastEnd() ||
+				e.Length == 0 && start < e.Offset && e.Offset < end {
+				return true
+			}
+		}
+		start, end = newOffset(edits, start), endOffset(edits, end)
+	}
+	return false
+}
+
+func endOffset(edits []edit, offset int) int {
+	adjust := 0
+	for _, e := range edits {
+		if e.Offset >= offset {
+			break
+		}
+		if e.OffsetPastEnd() > offset {
+			// The end of the region was replaced; include the
+			// entire replacement
+			adjust += len(e.replacement) - (offset - e.Offset)
+			break
+		}
+		adjust += len(e.replacement) - e.Length
+	}
+	return offset + adjust
+}
+
+func newOffset(edits []edit, offset int) int {
+	adjust := 0
+	for _, e := range edits {
+		if e.Offset > offset {
+			break
+		}
+		if e.Length == 0 || e.OffsetPastEnd() <= offset {
+			adjust += len(e.replacement) - e.Length
+		} else {
+			// The byte at offset is replaced by this edit
+			return e.Offset + adjust
+		}
+	}
+	return offset + adjust
+}
+
+func oldOffset(edits []edit, offset int) int {
+	adjust := 0
+	for _, e := range edits {
+		start := e.Offset + adjust
+		if offset < start {
+			break
+		}
+		if offset < start+len(e.replacement) {
+			// The byte at offset is part of this edit's
+			// replacement text
+			return e.Offset
+		}
+		adjust += len(e.replacement) - e.Length
+	}
+	return offset - adjust
+}
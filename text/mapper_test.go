@@ -0,0 +1,84 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import "testing"
+
+func TestOffsetMapper(t *testing.T) {
+	es := NewEditSet()
+	es.Add(&Extent{2, 5}, "x") // replace 5 bytes with 1 (-4)
+	es.Add(&Extent{7, 0}, "6") // add 1 byte
+	m := es.Mapper()
+
+	// "0123456789" -> "01x6789"
+	offset := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	expect := []int{0, 1, 2, 2, 2, 2, 2, 4, 5, 6}
+	for i := range offset {
+		if actual := m.NewOffset(offset[i]); actual != expect[i] {
+			t.Fatalf("NewOffset(%d): expected %d, got %d",
+				offset[i], expect[i], actual)
+		}
+	}
+
+	offset = []int{0, 1, 2, 3, 4, 5, 6}
+	expect = []int{0, 1, 2, 7, 7, 8, 9}
+	for i := range offset {
+		if actual := m.OldOffset(offset[i]); actual != expect[i] {
+			t.Fatalf("OldOffset(%d): expected %d, got %d",
+				offset[i], expect[i], actual)
+		}
+	}
+
+	// The mapper is not affected by subsequent changes to the EditSet
+	es.Add(&Extent{0, 0}, "zzz")
+	if actual := m.NewOffset(8); actual != 5 {
+		t.Fatalf("NewOffset(8): expected 5, got %d", actual)
+	}
+}
+
+func TestOffsetMapperThen(t *testing.T) {
+	s := "Hello, world"
+	first := NewEditSet()
+	first.Add(&Extent{0, 5}, "Goodbye") // "Goodbye, world"
+	s1 := applyToString(first, s)
+	second := NewEditSet()
+	second.Add(&Extent{9, 5}, "Go") // "Goodbye, Go"
+	second.Add(&Extent{7, 0}, "!")  // "Goodbye!, Go"
+	s2 := applyToString(second, s1)
+	assertEquals("Goodbye!, Go", s2, t)
+
+	m := first.Mapper().Then(second.Mapper())
+	// The comma is at offset 5 originally and offset 8 after both edits
+	if actual := m.NewOffset(5); actual != 8 {
+		t.Fatalf("NewOffset(5): expected 8, got %d", actual)
+	}
+	if actual := m.OldOffset(8); actual != 5 {
+		t.Fatalf("OldOffset(8): expected 5, got %d", actual)
+	}
+	// "world" is replaced by "Go"
+	assertEquals("offset 10, length 2", m.NewExtent(&Extent{7, 5}).String(), t)
+	// "Hello" becomes "Goodbye" (the "!" inserted at the end of the region
+	// is excluded)
+	assertEquals("offset 0, length 7", m.NewExtent(&Extent{0, 5}).String(), t)
+	assertEquals("offset 8, length 0", m.NewExtent(&Extent{5, 0}).String(), t)
+
+	// "world" is replaced by the second EditSet; ", " is not changed, and
+	// "!" is inserted at its start
+	for _, test := range []struct {
+		extent   *Extent
+		replaced bool
+	}{
+		{&Extent{0, 5}, true},
+		{&Extent{5, 2}, false},
+		{&Extent{6, 3}, true},
+		{&Extent{11, 1}, true},
+		{&Extent{4, 2}, true},
+	} {
+		if actual := m.Replaced(test.extent); actual != test.replaced {
+			t.Fatalf("Replaced(%s): expected %v, got %v",
+				test.extent, test.replaced, actual)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file provides support for three-way merges, i.e., applying an EditSet
+// computed against one version of a file to a version of that file that has
+// since been modified independently (Rebase), and combining two EditSets
+// computed independently against the same text (Merge).
+
+package text
+
+import "fmt"
+
+// A Conflict describes an edit that could not be applied by Rebase because
+// the region of the file it modifies was also changed independently.
+type Conflict struct {
+	// The region of the base content that the edit would have modified
+	Base *Extent
+	// The replacement text of the edit
+	Replacement string
+	// The region of the current content corresponding to the base region,
+	// which was changed independently
+	Current *Extent
+}
+
+func (c *Conflict) String() string {
+	return fmt.Sprintf("Conflict at offset %d: replacing %d byte(s) with %q overlaps an independent change",
+		c.Base.Offset, c.Base.Length, c.Replacement)
+}
+
+// Rebase takes an EditSet that was computed against the string base and
+// returns an EditSet that makes the same changes to the string current, which
+// is the result of independently modifying base.  This is analogous to a
+// three-way merge (e.g., diff3): the differences between base and current
+// are determined line by line, and each edit is moved to the corresponding
+// location in current.
+//
+// If an edit modifies a line that was also modified (or deleted) in current,
+// or if an edit and the modification to current both insert text at the same
+// location, the correct result is ambiguous.  Such edits are omitted from the
+// resulting EditSet and returned as Conflicts instead.
+func Rebase(es *EditSet, base, current string) (*EditSet, []*Conflict) {
+	changes := DiffStrings(base, current)
+
+	result := NewEditSet()
+	conflicts := []*Conflict{}
+	for _, e := range es.edits {
+		if changes.conflictsWith(e.Extent) {
+			conflicts = append(conflicts, &Conflict{
+				Base:        e.Extent,
+				Replacement: e.replacement,
+				Current:     changes.mapExtent(e.Extent),
+			})
+			continue
+		}
+		extent := &Extent{
+			Offset: changes.mapOffset(e.Offset, e.Length == 0),
+			Length: e.Length,
+		}
+		result.Add(extent, e.replacement)
+	}
+	return result, conflicts
+}
+
+// conflictsWith returns true iff this EditSet modifies a region of text that
+// overlaps the given extent, or if both this EditSet and the given extent
+// insert text at the same offset.
+func (e *EditSet) conflictsWith(extent *Extent) bool {
+	for _, edit := range e.edits {
+		if edit.Offset > extent.OffsetPastEnd() {
+			break
+		}
+		if edit.overlaps(extent) {
+			return true
+		}
+		if edit.Length == 0 && extent.Length == 0 &&
+			edit.Offset == extent.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// mapOffset returns the offset that will contain the byte at the given offset
+// after this EditSet has been applied.  The given offset must not be in a
+// region modified by this EditSet.  Text inserted at the given offset is
+// assumed to precede it, unless isInsertion is true (in which case the caller
+// must ensure that no text is inserted at that offset).
+func (e *EditSet) mapOffset(offset int, isInsertion bool) int {
+	adjust := 0
+	for _, edit := range e.edits {
+		if edit.Offset > offset || edit.Offset == offset && isInsertion {
+			break
+		}
+		if edit.OffsetPastEnd() > offset {
+			break
+		}
+		adjust += len(edit.replacement) - edit.Length
+	}
+	return offset + adjust
+}
+
+// mapExtent returns the region that will correspond to the given extent after
+// this EditSet has been applied.  If the EditSet modifies text overlapping the
+// extent, the resulting region includes all of the modified text.
+func (e *EditSet) mapExtent(extent *Extent) *Extent {
+	start, end := extent.Offset, extent.OffsetPastEnd()
+	adjustBefore, adjustWithin := 0, 0
+	for _, edit := range e.edits {
+		if edit.Offset < extent.Offset && edit.OffsetPastEnd() <= extent.Offset {
+			adjustBefore += len(edit.replacement) - edit.Length
+		} else if edit.Offset < extent.OffsetPastEnd() ||
+			edit.Offset == extent.Offset {
+			start = min(start, edit.Offset)
+			end = max(end, edit.OffsetPastEnd())
+			adjustWithin += len(edit.replacement) - edit.Length
+		} else {
+			break
+		}
+	}
+	return &Extent{
+		Offset: start + adjustBefore,
+		Length: end - start + adjustWithin,
+	}
+}
+
+// A MergeConflict describes a region of the base text that two EditSets given
+// to Merge modify in different ways.
+type MergeConflict struct {
+	// The region of the base text modified by the conflicting edits
+	Base *Extent
+	// The text that replaces that region when each EditSet is applied
+	A, B string
+}
+
+func (c *MergeConflict) String() string {
+	return fmt.Sprintf("Conflict at offset %d, length %d: %q conflicts with %q",
+		c.Base.Offset, c.Base.Length, c.A, c.B)
+}
+
+// Merge combines two EditSets computed independently against the string base
+// (e.g., by refactorings run concurrently), returning an EditSet that makes
+// the changes of both.  Edits that modify overlapping regions of base, or
+// that both insert text at the same offset, conflict unless they change that
+// region of base to the same text (in which case the change is made only
+// once, even if the two EditSets divide it into edits differently).
+// Conflicting edits are omitted from the resulting EditSet, and each region
+// of base containing conflicting edits is returned as a MergeConflict.  Text
+// inserted by one EditSet at the start of a region modified by the other
+// precedes the modified text.
+//
+// Merge returns an error if either EditSet contains edits beyond the end of
+// base.
+func Merge(base string, a, b *EditSet) (*EditSet, []*MergeConflict, error) {
+	if err := a.Validate(len(base)); err != nil {
+		return nil, nil, err
+	}
+	if err := b.Validate(len(base)); err != nil {
+		return nil, nil, err
+	}
+
+	result := NewEditSet()
+	conflicts := []*MergeConflict{}
+	for _, c := range mergeClusters(a.edits, b.edits) {
+		if len(c.b) == 0 {
+			result.edits = append(result.edits, c.a...)
+			continue
+		}
+		if len(c.a) == 0 || sameEdits(c.a, c.b) {
+			result.edits = append(result.edits, c.b...)
+			continue
+		}
+		region := base[c.start:c.end]
+		textA := applyEditsToRegion(c.a, region, c.start)
+		textB := applyEditsToRegion(c.b, region, c.start)
+		if textA == textB {
+			// The same change, made by differently split edits
+			result.edits = append(result.edits, c.b...)
+			continue
+		}
+		conflicts = append(conflicts, &MergeConflict{
+			Base: &Extent{c.start, c.end - c.start},
+			A:    textA,
+			B:    textB,
+		})
+	}
+	return result, conflicts, nil
+}
+
+// A mergeCluster is a maximal sequence of edits from the two EditSets given
+// to Merge (a and b, each in order) that may interfere with one another.  The
+// edits modify the region of the base text from start to end.
+type mergeCluster struct {
+	a, b       []edit
+	start, end int
+	insertion  int // Offset of the last insertion, or -1 if none
+}
+
+// mergeClusters divides the edits in a and b (each sorted by offset) into
+// mergeClusters, in order by offset.  Each EditSet's edits are first grouped
+// into hunks of adjacent edits (e.g., an insertion followed by a deletion at
+// the same offset, as Diff produces when a line is changed).  A hunk is in
+// the same cluster as the preceding hunks if it overlaps them, or if both it
+// and the cluster insert text at the same offset.
+func mergeClusters(a, b []edit) []*mergeCluster {
+	hunksA, hunksB := mergeHunks(a), mergeHunks(b)
+	clusters := []*mergeCluster{}
+	var c *mergeCluster
+	for len(hunksA) > 0 || len(hunksB) > 0 {
+		// Take the next hunk in offset order; at the same offset, a
+		// hunk beginning with an insertion is taken first, since the
+		// inserted text precedes text modified by the other hunk
+		fromA := len(hunksB) == 0 ||
+			len(hunksA) > 0 && precedes(hunksA[0][0], hunksB[0][0])
+		var hunk []edit
+		if fromA {
+			hunk, hunksA = hunksA[0], hunksA[1:]
+		} else {
+			hunk, hunksB = hunksB[0], hunksB[1:]
+		}
+
+		first := hunk[0]
+		if c == nil || first.Offset > c.end || first.Offset == c.end &&
+			(first.Length > 0 || c.insertion != first.Offset) {
+			c = &mergeCluster{start: first.Offset, end: first.Offset,
+				insertion: -1}
+			clusters = append(clusters, c)
+		}
+		if fromA {
+			c.a = append(c.a, hunk...)
+		} else {
+			c.b = append(c.b, hunk...)
+		}
+		for _, e := range hunk {
+			c.end = max(c.end, e.OffsetPastEnd())
+			if e.Length == 0 {
+				c.insertion = e.Offset
+			}
+		}
+	}
+	return clusters
+}
+
+// mergeHunks divides the given edits (sorted by offset) into hunks: maximal
+// sequences of edits in which each edit begins where the previous one ends.
+func mergeHunks(edits []edit) [][]edit {
+	hunks := [][]edit{}
+	for i, e := range edits {
+		if i > 0 && e.Offset == edits[i-1].OffsetPastEnd() {
+			hunks[len(hunks)-1] = append(hunks[len(hunks)-1], e)
+		} else {
+			hunks = append(hunks, []edit{e})
+		}
+	}
+	return hunks
+}
+
+// precedes returns true if the edit e1 must be applied before e2.
+func precedes(e1, e2 edit) bool {
+	return e1.Offset < e2.Offset ||
+		e1.Offset == e2.Offset && e1.Length <= e2.Length
+}
+
+// sameEdits returns true iff the given slices contain the same edits.
+func sameEdits(a, b []edit) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i].Extent != *b[i].Extent || a[i].replacement != b[i].replacement {
+			return false
+		}
+	}
+	return true
+}
+
+// applyEditsToRegion returns the result of applying the given edits to the
+// given region of text, which begins at the given offset.
+func applyEditsToRegion(edits []edit, region string, offset int) string {
+	result := ""
+	pos := 0
+	for _, e := range edits {
+		e = e.RelativeToOffset(offset)
+		result += region[pos:e.Offset] + e.replacement
+		pos = e.OffsetPastEnd()
+	}
+	return result + region[pos:]
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"strings"
+	"testing"
+)
+
+const mergeBase = `line 1
+line 2
+line 3
+line 4
+line 5
+`
+
+func TestRebase(t *testing.T) {
+	tests := []struct {
+		current   string
+		expected  string
+		conflicts int
+	}{
+		// Unchanged
+		{mergeBase, "line 1\nLINE 2\nline 3\nline 4\nline five\n", 0},
+		// Lines inserted before and between edits
+		{"line 0\nline 1\nline 2\nline 3\nline 3.5\nline 4\nline 5\n",
+			"line 0\nline 1\nLINE 2\nline 3\nline 3.5\nline 4\nline five\n", 0},
+		// Line deleted between edits
+		{"line 1\nline 2\nline 4\nline 5\n",
+			"line 1\nLINE 2\nline 4\nline five\n", 0},
+		// Line inserted at the start of an edited region
+		{"line 1\nline 1.5\nline 2\nline 3\nline 4\nline 5\n",
+			"line 1\nline 1.5\nLINE 2\nline 3\nline 4\nline five\n", 0},
+		// Edited line modified independently
+		{"line 1\nline two\nline 3\nline 4\nline 5\n",
+			"line 1\nline two\nline 3\nline 4\nline five\n", 1},
+		// Both edited lines deleted independently
+		{"line 1\nline 3\nline 4\n", "line 1\nline 3\nline 4\n", 2},
+	}
+	for _, test := range tests {
+		es := NewEditSet()
+		es.Add(&Extent{Offset: 7, Length: 4}, "LINE")  // line 2
+		es.Add(&Extent{Offset: 33, Length: 1}, "five") // line 5
+		rebased, conflicts := Rebase(es, mergeBase, test.current)
+		if len(conflicts) != test.conflicts {
+			t.Fatalf("Expected %d conflicts, got %d (%v)",
+				test.conflicts, len(conflicts), conflicts)
+		}
+		assertEquals(test.expected, applyToString(rebased, test.current), t)
+	}
+}
+
+func TestRebaseInsertions(t *testing.T) {
+	es := NewEditSet()
+	es.Add(&Extent{Offset: 7, Length: 0}, "line 1.5\n")
+	es.Add(&Extent{Offset: 21, Length: 0}, "line 3.5\n")
+
+	current := strings.Replace(mergeBase, "line 4\n", "line 3.9\nline 4\n", 1)
+	rebased, conflicts := Rebase(es, mergeBase, current)
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %d", len(conflicts))
+	}
+	assertEquals(`Conflict at offset 21: replacing 0 byte(s) with "line 3.5\n" overlaps an independent change`,
+		conflicts[0].String(), t)
+	assertEquals("offset 21, length 9", conflicts[0].Current.String(), t)
+	assertEquals("line 1\nline 1.5\nline 2\nline 3\nline 3.9\nline 4\nline 5\n",
+		applyToString(rebased, current), t)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		a, b      string // Versions of mergeBase
+		expected  string
+		conflicts []string
+	}{
+		// Independent changes
+		{"line 1\nLINE 2\nline 3\nline 4\nline 5\n",
+			"line 1\nline 2\nline 3\nline 4\nline five\n",
+			"line 1\nLINE 2\nline 3\nline 4\nline five\n", nil},
+		// Adjacent changes, and a line inserted before a changed line
+		{"line 0\nline 1\nLINE 2\nline 3\nline 4\nline 5\n",
+			"line 1\nline 2\nline three\nline 4\n",
+			"line 0\nline 1\nLINE 2\nline three\nline 4\n", nil},
+		// The same change in both
+		{"line 1\nLINE 2\nline 3\nline 4\nline 5\n",
+			"line 1\nLINE 2\nline 3\nline 4\nline five\n",
+			"line 1\nLINE 2\nline 3\nline 4\nline five\n", nil},
+		// Different changes to the same line
+		{"line 1\nLINE 2\nline 3\nline 4\nline 5\n",
+			"line 1\nline two\nline 3\nline 4\nline five\n",
+			"line 1\nline 2\nline 3\nline 4\nline five\n",
+			[]string{`Conflict at offset 7, length 7: "LINE 2\n" conflicts with "line two\n"`}},
+		// Different lines inserted at the same place
+		{"line 1\nline 2\nline 2.5\nline 3\nline 4\nline 5\n",
+			"line 1\nline 2\nline 2.9\nline 3\nline 4\nline 5\n",
+			mergeBase,
+			[]string{`Conflict at offset 14, length 0: "line 2.5\n" conflicts with "line 2.9\n"`}},
+	}
+	for _, test := range tests {
+		a, b := DiffStrings(mergeBase, test.a), DiffStrings(mergeBase, test.b)
+		for _, reversed := range []bool{false, true} {
+			if reversed {
+				a, b = b, a
+			}
+			merged, conflicts, err := Merge(mergeBase, a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := merged.Validate(len(mergeBase)); err != nil {
+				t.Fatal(err)
+			}
+			assertEquals(test.expected, applyToString(merged, mergeBase), t)
+			if len(conflicts) != len(test.conflicts) {
+				t.Fatalf("Expected %d conflicts, got %d (%v)",
+					len(test.conflicts), len(conflicts), conflicts)
+			}
+			for i, c := range conflicts {
+				if !reversed {
+					assertEquals(test.conflicts[i], c.String(), t)
+				}
+			}
+		}
+	}
+
+	// Text inserted at the start of a modified region precedes it
+	a, b := NewEditSet(), NewEditSet()
+	a.Add(&Extent{Offset: 7, Length: 0}, "line 1.5\n")
+	b.Add(&Extent{Offset: 7, Length: 4}, "LINE")
+	for _, es := range [][]*EditSet{{a, b}, {b, a}} {
+		merged, conflicts, err := Merge(mergeBase, es[0], es[1])
+		if err != nil || len(conflicts) != 0 {
+			t.Fatalf("Unexpected error or conflicts: %v %v", err, conflicts)
+		}
+		assertEquals("line 1\nline 1.5\nLINE 2\nline 3\nline 4\nline 5\n",
+			applyToString(merged, mergeBase), t)
+	}
+
+	// Myers and patience diff make the same change with different edits
+	base, changed := "a\nb\n\n}\n", "}\n}\nb\na\n"
+	myers := DiffStrings(base, changed)
+	patience := DiffStringsWithOptions(base, changed,
+		&DiffOptions{Algorithm: PatienceDiff})
+	if sameEdits(myers.edits, patience.edits) {
+		t.Fatalf("Expected different edits:\n%s\n%s", myers, patience)
+	}
+	for _, es := range [][]*EditSet{{myers, patience}, {patience, myers}} {
+		merged, conflicts, err := Merge(base, es[0], es[1])
+		if err != nil || len(conflicts) != 0 {
+			t.Fatalf("Unexpected error or conflicts: %v %v", err, conflicts)
+		}
+		assertEquals(changed, applyToString(merged, base), t)
+	}
+
+	beyond := NewEditSet()
+	beyond.Add(&Extent{Offset: len(mergeBase), Length: 1}, "")
+	if _, _, err := Merge(mergeBase, a, beyond); err == nil {
+		t.Fatalf("Expected an error merging an edit beyond the end of the text")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for detecting blocks of lines that a Patch moves,
+// i.e., deletes from one place in a file and adds at another.  Moved blocks
+// are found by anchoring on lines that are deleted exactly once and added
+// exactly once (similar to the "patience diff" algorithm), then extending each
+// anchor to the surrounding deleted and added lines that are identical.
+
+package text
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Move describes a block of lines that a Patch deletes from one place in a
+// file and adds, unchanged, at another.
+type Move struct {
+	OrigLine int // 1-based line number of the block in the original file
+	NewLine  int // 1-based line number of the block in the new file
+	NumLines int // Number of lines in the block
+}
+
+// String returns a description of this Move, e.g., "moved 3 lines from line
+// 12 to line 40".
+func (m Move) String() string {
+	return fmt.Sprintf("moved %s from line %d to line %d",
+		pluralLines(m.NumLines), m.OrigLine, m.NewLine)
+}
+
+// pluralLines returns "1 line" or "n lines".
+func pluralLines(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	return fmt.Sprintf("%d lines", n)
+}
+
+// DetectMoves finds blocks of lines that this Patch moves and records them in
+// the Patch, so that the Write method annotates the header of each affected
+// hunk (e.g., "@@ -12,8 +12,0 @@ moved 8 lines to line 40").  Patch tools
+// ignore text following a hunk header, so an annotated patch can still be
+// applied.  DetectMoves returns the moves that were found, ordered by their
+// line numbers in the original file.
+func (p *Patch) DetectMoves() ([]Move, error) {
+	deleted, added, err := p.changedLines()
+	if err != nil {
+		return nil, err
+	}
+
+	// Anchors are nonblank lines that are deleted exactly once and added
+	// exactly once
+	numDeleted := map[string]int{}
+	for _, line := range deleted {
+		numDeleted[line.text]++
+	}
+	numAdded := map[string]int{}
+	addedIndex := map[string]int{}
+	for j, line := range added {
+		numAdded[line.text]++
+		addedIndex[line.text] = j
+	}
+
+	moves := []Move{}
+	usedDeleted := make([]bool, len(deleted))
+	usedAdded := make([]bool, len(added))
+	for i, line := range deleted {
+		if usedDeleted[i] || strings.TrimSpace(line.text) == "" ||
+			numDeleted[line.text] != 1 || numAdded[line.text] != 1 {
+			continue
+		}
+		j := addedIndex[line.text]
+		if usedAdded[j] {
+			continue
+		}
+
+		// Extend the anchor to adjacent identical lines
+		start, end := 0, 1
+		for i+start > 0 && j+start > 0 &&
+			deleted.continues(i+start-1) && added.continues(j+start-1) &&
+			!usedDeleted[i+start-1] && !usedAdded[j+start-1] &&
+			deleted[i+start-1].text == added[j+start-1].text {
+			start--
+		}
+		for i+end < len(deleted) && j+end < len(added) &&
+			deleted.continues(i+end-1) && added.continues(j+end-1) &&
+			!usedDeleted[i+end] && !usedAdded[j+end] &&
+			deleted[i+end].text == added[j+end].text {
+			end++
+		}
+		for k := start; k < end; k++ {
+			usedDeleted[i+k] = true
+			usedAdded[j+k] = true
+		}
+		moves = append(moves, Move{
+			OrigLine: deleted[i+start].line,
+			NewLine:  added[j+start].line,
+			NumLines: end - start,
+		})
+	}
+	p.moves = moves
+	return moves, nil
+}
+
+// Moves returns the moves found by the most recent call to DetectMoves, or nil
+// if DetectMoves has not been called.
+func (p *Patch) Moves() []Move {
+	return p.moves
+}
+
+// A numberedLine is a single line of text, with its 1-based line number.
+type numberedLine struct {
+	line int
+	text string
+}
+
+// numberedLines is a slice of lines in increasing order by line number.
+type numberedLines []numberedLine
+
+// continues returns true iff the line following lines[i] in the slice is the
+// next line in the file.
+func (lines numberedLines) continues(i int) bool {
+	return i+1 < len(lines) && lines[i+1].line == lines[i].line+1
+}
+
+// changedLines returns the lines deleted by this Patch, numbered by their
+// positions in the original file, and the lines added by this Patch, numbered
+// by their positions in the new file.
+func (p *Patch) changedLines() (deleted, added numberedLines, err error) {
+	lineOffset := 0
+	for _, h := range p.hunks {
+		origLines, newLines, err := computeLines(h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Traverse the deletions and additions as writeDiffHunk does
+		it := p.diffLines(origLines, newLines).newEditIter()
+		origLine := h.startLine
+		newLine := h.startLine + lineOffset
+		offset := 0
+		for i, line := range origLines {
+			isDeleted := false
+			for it.edit() != nil && (it.edit().Offset == offset ||
+				i == len(origLines)-1) {
+				edit := it.edit()
+				if edit.Length > 0 {
+					deleted = append(deleted,
+						numberedLine{origLine, line})
+					isDeleted = true
+				} else if edit.replacement != "" {
+					added = append(added,
+						numberedLine{newLine, edit.replacement})
+					newLine++
+				}
+				it.moveToNextEdit()
+			}
+			if !isDeleted {
+				newLine++
+			}
+			origLine++
+			offset += len(line)
+		}
+		lineOffset += lenWithoutLastIfEmpty(newLines) -
+			lenWithoutLastIfEmpty(origLines)
+	}
+	return deleted, added, nil
+}
+
+// moveAnnotation returns a description of the moves that delete lines in the
+// range [origStart, origStart+numOrig) of the original file or add lines in
+// the range [newStart, newStart+numNew) of the new file, or the empty string
+// if there are none.
+func (p *Patch) moveAnnotation(origStart, numOrig, newStart, numNew int) string {
+	notes := []string{}
+	for _, m := range p.moves {
+		if m.OrigLine >= origStart && m.OrigLine < origStart+numOrig {
+			notes = append(notes, fmt.Sprintf("moved %s to line %d",
+				pluralLines(m.NumLines), m.NewLine))
+		}
+		if m.NewLine >= newStart && m.NewLine < newStart+numNew {
+			notes = append(notes, fmt.Sprintf("moved %s from line %d",
+				pluralLines(m.NumLines), m.OrigLine))
+		}
+	}
+	return strings.Join(notes, "; ")
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const moveFrom = `package main
+
+func f() {
+	println("f")
+}
+
+func main() {
+	f()
+	g()
+}
+
+func g() {
+	println("g")
+}
+`
+
+const moveTo = `package main
+
+func main() {
+	f()
+	g()
+}
+
+func g() {
+	println("g")
+}
+
+func f() {
+	println("f")
+}
+`
+
+const moveDiff = `--- filename
++++ filename
+@@ -1,8 +1,4 @@ moved 3 lines to line 12
+ package main
+ 
+-func f() {
+-	println("f")
+-}
+-
+ func main() {
+ 	f()
+@@ -12,3 +8,7 @@ moved 3 lines from line 3
+ func g() {
+ 	println("g")
+ }
++
++func f() {
++	println("f")
++}
+`
+
+func TestDetectMoves(t *testing.T) {
+	patch, err := DiffStrings(moveFrom, moveTo).CreatePatch(
+		strings.NewReader(moveFrom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patch.Moves() != nil {
+		t.Fatalf("Expected no moves before DetectMoves")
+	}
+	moves, err := patch.DetectMoves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Move{{OrigLine: 3, NewLine: 12, NumLines: 3}}
+	if !reflect.DeepEqual(moves, expected) {
+		t.Fatalf("Expected moves %v, got %v", expected, moves)
+	}
+	if actual := moves[0].String(); actual != "moved 3 lines from line 3 to line 12" {
+		t.Fatalf("Unexpected description %q", actual)
+	}
+
+	var result bytes.Buffer
+	patch.Write("filename", "filename", time.Time{}, time.Time{}, &result)
+	assertEquals(moveDiff, result.String(), t)
+}
+
+func TestDetectMovesIgnoresEdits(t *testing.T) {
+	// Blank and repeated lines are not moves, nor are lines that change
+	from := "a\n\nb\n}\nc\n"
+	to := "a\nB\n}\n\nc\n"
+	patch, err := DiffStrings(from, to).CreatePatch(strings.NewReader(from))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves, err := patch.DetectMoves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 0 {
+		t.Fatalf("Expected no moves, got %v", moves)
+	}
+}
+
+func TestDetectMovesSwap(t *testing.T) {
+	lines := []string{}
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	from := strings.Join(lines, "")
+	lines[2], lines[17] = lines[17], lines[2]
+	to := strings.Join(lines, "")
+
+	patch, err := DiffStrings(from, to).CreatePatch(strings.NewReader(from))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves, err := patch.DetectMoves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Move{
+		{OrigLine: 3, NewLine: 18, NumLines: 1},
+		{OrigLine: 18, NewLine: 3, NumLines: 1},
+	}
+	if !reflect.DeepEqual(moves, expected) {
+		t.Fatalf("Expected moves %v, got %v", expected, moves)
+	}
+}
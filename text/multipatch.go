@@ -0,0 +1,101 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for unified diffs that modify several files.
+
+package text
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// A MultiPatch is a unified diff that modifies several files, e.g., the
+// changes made by a refactoring that renames an identifier used in several
+// packages.  It consists of one Patch per file; when it is written, the
+// patches are output in order by filename, each preceded by a "diff -u" line
+// and its own ---/+++ headers, so the result can be applied with a single
+// invocation of patch(1).
+type MultiPatch struct {
+	patches map[string]*Patch
+}
+
+// NewMultiPatch returns a MultiPatch that does not modify any files.
+func NewMultiPatch() *MultiPatch {
+	return &MultiPatch{patches: map[string]*Patch{}}
+}
+
+// CreateMultiPatch creates a MultiPatch from the given EditSets, keyed by the
+// name of the file each one modifies.  The given function is invoked to read
+// the original contents of each file.
+func CreateMultiPatch(edits map[string]*EditSet, open func(filename string) (io.ReadCloser, error)) (*MultiPatch, error) {
+	result := NewMultiPatch()
+	for filename, es := range edits {
+		in, err := open(filename)
+		if err != nil {
+			return nil, err
+		}
+		p, err := es.CreatePatch(in)
+		in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		result.Add(filename, p)
+	}
+	return result, nil
+}
+
+// Add adds a patch for the given file to this MultiPatch, replacing any patch
+// that was previously added for that file.
+func (m *MultiPatch) Add(filename string, p *Patch) {
+	p.filename = filename
+	m.patches[filename] = p
+}
+
+// Filenames returns the names of the files with patches in this MultiPatch,
+// in sorted order.
+func (m *MultiPatch) Filenames() []string {
+	result := make([]string, 0, len(m.patches))
+	for filename := range m.patches {
+		result = append(result, filename)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Patch returns the patch for the given file, or nil if there is none.
+func (m *MultiPatch) Patch(filename string) *Patch {
+	return m.patches[filename]
+}
+
+// IsEmpty returns true iff none of the patches in this MultiPatch contain any
+// hunks.
+func (m *MultiPatch) IsEmpty() bool {
+	for _, p := range m.patches {
+		if !p.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes a unified diff for every file in this MultiPatch to the given
+// io.Writer.  Files whose patches are empty are omitted.
+func (m *MultiPatch) Write(out io.Writer) error {
+	for _, filename := range m.Filenames() {
+		p := m.patches[filename]
+		if p.IsEmpty() {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "diff -u %s %s\n", filename, filename); err != nil {
+			return err
+		}
+		if err := p.Write(filename, filename, time.Time{}, time.Time{}, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
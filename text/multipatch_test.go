@@ -0,0 +1,59 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMultiPatch(t *testing.T) {
+	files := map[string]string{
+		"b.go": "package b\n\nvar x = 1\n",
+		"a.go": "package a\n\nvar y = 2\n",
+		"c.go": "package c\n",
+	}
+	edits := map[string]*EditSet{
+		"b.go": DiffStrings(files["b.go"], "package b\n\nvar z = 1\n"),
+		"a.go": DiffStrings(files["a.go"], "package a\n\nvar y = 3\n"),
+		"c.go": NewEditSet(),
+	}
+	open := func(filename string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(files[filename])), nil
+	}
+	mp, err := CreateMultiPatch(edits, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("a.go b.go c.go", strings.Join(mp.Filenames(), " "), t)
+	assertFalse(mp.IsEmpty(), t)
+	assertTrue(mp.Patch("c.go").IsEmpty(), t)
+
+	var buf bytes.Buffer
+	if err := mp.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `diff -u a.go a.go
+--- a.go
++++ a.go
+@@ -1,3 +1,3 @@
+ package a
+ 
+-var y = 2
++var y = 3
+diff -u b.go b.go
+--- b.go
++++ b.go
+@@ -1,3 +1,3 @@
+ package b
+ 
+-var x = 1
++var z = 1
+`
+	assertEquals(expected, buf.String(), t)
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains a parser for unified diffs, so patches produced by other
+// tools (e.g., diff -u or git diff) can be applied, inverted, or merged.
+
+package text
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches a unified diff hunk header, e.g., "@@ -1,3 +1,4 @@".
+// The line counts may be omitted, in which case they are 1.
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParsePatch reads a unified diff that modifies a single file.  It returns an
+// error if the diff is malformed or modifies more than one file.  (Use
+// ParseMultiPatch to read a diff that modifies several files.)
+//
+// Since a unified diff describes lines, not byte offsets, the offsets of the
+// edits in the resulting patch are determined when it is applied (by
+// ApplyTo or EditSet).
+func ParsePatch(in io.Reader) (*Patch, error) {
+	mp, err := ParseMultiPatch(in)
+	if err != nil {
+		return nil, err
+	}
+	filenames := mp.Filenames()
+	switch len(filenames) {
+	case 0:
+		return &Patch{}, nil
+	case 1:
+		return mp.Patch(filenames[0]), nil
+	default:
+		return nil, fmt.Errorf("the patch modifies %d files (%s); "+
+			"expected a patch for a single file", len(filenames),
+			strings.Join(filenames, ", "))
+	}
+}
+
+// ParseMultiPatch reads a unified diff that may modify several files, such as
+// the output of diff -ru or git diff.  Each file's patch is keyed by the name
+// on its +++ line (or its --- line if the file is deleted), without a
+// timestamp or git's a/ and b/ prefixes.  Lines that are not part of a
+// file's ---/+++ headers or hunks (e.g., "diff" and "index" lines) are
+// ignored.
+func ParseMultiPatch(in io.Reader) (*MultiPatch, error) {
+	p := &patchParser{in: bufio.NewReader(in)}
+	result := NewMultiPatch()
+	for {
+		line, err := p.readLine()
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "--- ") {
+			continue
+		}
+		origName := patchFilename(line[len("--- "):])
+		line, err = p.readLine()
+		if err != nil || !strings.HasPrefix(line, "+++ ") {
+			return nil, p.errorf("expected +++ line following --- line")
+		}
+		newName := patchFilename(line[len("+++ "):])
+		filename := newName
+		if strings.HasPrefix(origName, "a/") && strings.HasPrefix(newName, "b/") {
+			filename = newName[len("b/"):]
+		} else if newName == "/dev/null" {
+			filename = origName
+		}
+
+		patch, err := p.parseHunks()
+		if err != nil {
+			return nil, err
+		}
+		result.Add(filename, patch)
+	}
+}
+
+// patchFilename returns the filename on a ---/+++ line of a unified diff,
+// without its timestamp (if any).
+func patchFilename(s string) string {
+	if tab := strings.IndexByte(s, '\t'); tab >= 0 {
+		s = s[:tab]
+	}
+	return strings.TrimRight(s, "\r\n")
+}
+
+// A patchParser reads the lines of a unified diff.
+type patchParser struct {
+	in     *bufio.Reader
+	lineNo int    // Number of the line most recently read
+	peeked string // Line read by peekLine but not yet by readLine
+	peek   bool   // True iff peeked is valid
+}
+
+// readLine reads the next line of the diff, including its terminating
+// newline (if any).  It returns io.EOF at the end of the diff.
+func (p *patchParser) readLine() (string, error) {
+	if p.peek {
+		p.peek = false
+		p.lineNo++
+		return p.peeked, nil
+	}
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err == nil {
+		p.lineNo++
+	}
+	return line, err
+}
+
+// peekLine returns the next line of the diff without consuming it.
+func (p *patchParser) peekLine() (string, error) {
+	if !p.peek {
+		line, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+		p.lineNo--
+		p.peeked, p.peek = line, true
+	}
+	return p.peeked, nil
+}
+
+// errorf returns an error describing a problem on the current line.
+func (p *patchParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d of patch: %s", p.lineNo,
+		fmt.Sprintf(format, args...))
+}
+
+// parseHunks reads the hunks following a ---/+++ header.
+func (p *patchParser) parseHunks() (*Patch, error) {
+	result := &Patch{}
+	for {
+		line, err := p.peekLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		} else if err == io.EOF || !strings.HasPrefix(line, "@@ ") {
+			return result, nil
+		}
+		p.readLine()
+		h, err := p.parseHunk(line)
+		if err != nil {
+			return nil, err
+		}
+		result.add(h)
+	}
+}
+
+// parseHunk reads the lines of a hunk with the given header.  The hunk's
+// original lines (context and deleted lines) become its text, and its added
+// and deleted lines become its edits.
+func (p *patchParser) parseHunk(header string) (*hunk, error) {
+	m := hunkHeader.FindStringSubmatch(header)
+	if m == nil {
+		return nil, p.errorf("malformed hunk header: %s",
+			strings.TrimSpace(header))
+	}
+	origStart, _ := strconv.Atoi(m[1])
+	numOrig, numNew := 1, 1
+	if m[2] != "" {
+		numOrig, _ = strconv.Atoi(m[2])
+	}
+	if m[4] != "" {
+		numNew, _ = strconv.Atoi(m[4])
+	}
+	h := &hunk{
+		startOffset: -1,
+		startLine:   origStart,
+		numLines:    numOrig,
+		maxCtxLines: numCtxLines,
+		coalesced:   true,
+	}
+	if numOrig == 0 {
+		// An empty range is given by the line preceding it
+		h.startLine++
+	}
+
+	changed := false // Has an added or deleted line been read?
+	var last *edit   // Edit for the last line read (nil for context)
+	for numOrig > 0 || numNew > 0 {
+		line, err := p.readLine()
+		if err == io.EOF {
+			return nil, p.errorf("unexpected end of patch in hunk")
+		} else if err != nil {
+			return nil, err
+		}
+		if line == "\n" {
+			// Some tools remove the space from empty context lines
+			line = " \n"
+		}
+		text := line[1:]
+		offset := h.hunk.Len()
+		switch line[0] {
+		case ' ':
+			if !changed {
+				h.numCtxLines++
+			}
+			h.hunk.WriteString(text)
+			last = nil
+			numOrig--
+			numNew--
+		case '-':
+			h.addLineEdit(offset, len(text), "")
+			h.hunk.WriteString(text)
+			last = &h.edits[len(h.edits)-1]
+			changed = true
+			numOrig--
+		case '+':
+			h.addLineEdit(offset, 0, text)
+			last = &h.edits[len(h.edits)-1]
+			changed = true
+			numNew--
+		default:
+			return nil, p.errorf("unexpected line in hunk: %s",
+				strings.TrimSpace(line))
+		}
+		if numOrig < 0 || numNew < 0 {
+			return nil, p.errorf("hunk contains more lines than its " +
+				"header indicates")
+		}
+		if err := p.parseNoNewline(h, last); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// parseNoNewline reads a "\ No newline at end of file" line, if there is
+// one, and removes the newline from the end of the last line read, which was
+// a line of the given hunk changed by the given edit (or a context line, if
+// the edit is nil).
+func (p *patchParser) parseNoNewline(h *hunk, last *edit) error {
+	line, err := p.peekLine()
+	if err != nil || !strings.HasPrefix(line, `\`) {
+		return nil
+	}
+	p.readLine()
+	switch {
+	case last != nil && last.Length == 0:
+		last.replacement = strings.TrimSuffix(last.replacement, "\n")
+	default:
+		if !strings.HasSuffix(h.hunk.String(), "\n") {
+			return p.errorf("misplaced \"No newline\" marker")
+		}
+		h.hunk.Truncate(h.hunk.Len() - 1)
+		if last != nil {
+			last.Length--
+		}
+	}
+	return nil
+}
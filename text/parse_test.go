@@ -0,0 +1,102 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePatchRoundTrip(t *testing.T) {
+	for _, c := range patchEdgeCases {
+		p, err := ParsePatch(strings.NewReader(unifiedDiff(c[0], c[1], t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := p.ApplyToString(c[0])
+		if err != nil {
+			t.Fatalf("Parsed diff from %q to %q did not apply: %s",
+				c[0], c[1], err)
+		}
+		assertEquals(c[1], result, t)
+	}
+}
+
+func TestParsePatchTestdata(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join(diffTestDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range dirs {
+		from := readFile(filepath.Join(dir, "from.txt"), t)
+		to := readFile(filepath.Join(dir, "to.txt"), t)
+		diff := readFile(filepath.Join(dir, "diff.txt"), t)
+		p, err := ParsePatch(strings.NewReader(diff))
+		if err != nil {
+			t.Fatalf("%s: %s", dir, err)
+		}
+		result, err := p.ApplyToString(from)
+		if err != nil {
+			t.Fatalf("%s: %s", dir, err)
+		}
+		assertEquals(to, result, t)
+	}
+}
+
+const gitDiff = `diff --git a/one.txt b/one.txt
+index 3b18e51..5c5ff4a 100644
+--- a/one.txt
++++ b/one.txt
+@@ -1,2 +1,2 @@
+ hello
+-world
++there
+diff --git a/two.txt b/two.txt
+index e69de29..8baef1b 100644
+--- a/two.txt	2018-01-01 00:00:00.000000000 -0600
++++ b/two.txt	2018-01-02 00:00:00.000000000 -0600
+@@ -0,0 +1 @@
++abc
+\ No newline at end of file
+`
+
+func TestParseMultiPatch(t *testing.T) {
+	mp, err := ParseMultiPatch(strings.NewReader(gitDiff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("one.txt two.txt", strings.Join(mp.Filenames(), " "), t)
+	result, err := mp.Patch("one.txt").ApplyToString("hello\nworld\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("hello\nthere\n", result, t)
+	edits, err := mp.Patch("two.txt").EditSet(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("Replace offset 0, length 0 with \"abc\"\n", edits.String(), t)
+
+	if _, err := ParsePatch(strings.NewReader(gitDiff)); err == nil {
+		t.Fatal("ParsePatch should reject a patch for two files")
+	}
+	if _, err := mp.Patch("one.txt").ApplyToString("hello\nWorld\n"); err == nil {
+		t.Fatal("Patch should not apply to a file that does not match")
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	for _, diff := range []string{
+		"--- a\n@@ -1 +1 @@\n-x\n+y\n",
+		"--- a\n+++ a\n@@ -1 @@\n-x\n",
+		"--- a\n+++ a\n@@ -1,2 +1,2 @@\n-x\n+y\n",
+		"--- a\n+++ a\n@@ -1 +1 @@\n*x\n+y\n",
+	} {
+		if _, err := ParsePatch(strings.NewReader(diff)); err == nil {
+			t.Fatalf("Expected error parsing:\n%s", diff)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const fileNotFoundFmt = "The file %s was not found or was not loaded"
@@ -232,6 +233,89 @@ func lineColToPos(file *token.File, line int, column int) (token.Pos, error) {
 	return pos, nil
 }
 
+// MapSelection takes a Selection in a file's original contents and returns the
+// corresponding Selection in the file after edits have been applied to it,
+// where the given OffsetMapper describes those edits (see EditSet.Mapper).
+// The resulting Selection has the same type as the given Selection.  If the
+// selected text was replaced, the new selection covers the replacement text;
+// e.g., if an identifier is selected and then renamed, the resulting selection
+// covers the new name.  This allows a text editor to keep the selection on the
+// "same" text after a refactoring's edits are applied.
+//
+// The original and edited contents of the file are needed to convert between
+// line/column positions and offsets; they are not needed (and may be empty)
+// for an OffsetLengthSelection.
+func MapSelection(sel Selection, mapper *OffsetMapper, oldContents, newContents string) (Selection, error) {
+	switch sel := sel.(type) {
+	case *OffsetLengthSelection:
+		extent := mapper.NewExtent(&Extent{Offset: sel.Offset, Length: sel.Length})
+		return &OffsetLengthSelection{
+			Filename: sel.Filename,
+			Offset:   extent.Offset,
+			Length:   extent.Length,
+		}, nil
+	case *LineColSelection:
+		start, err := offsetOfLineCol(oldContents, sel.StartLine, sel.StartCol)
+		if err != nil {
+			return nil, err
+		}
+		last, err := offsetOfLineCol(oldContents, sel.EndLine, sel.EndCol)
+		if err != nil {
+			return nil, err
+		}
+		// The end position is inclusive, so the selection extends to
+		// the end of the (possibly multibyte) character at that position
+		_, size := utf8.DecodeRuneInString(oldContents[last:])
+		if last+size < start {
+			return nil, fmt.Errorf("Invalid selection (end < start)")
+		}
+		extent := mapper.NewExtent(&Extent{Offset: start, Length: last + size - start})
+		if extent.OffsetPastEnd() > len(newContents) {
+			return nil, fmt.Errorf("Selection %v is beyond the end of the edited file", sel)
+		}
+		result := &LineColSelection{Filename: sel.Filename}
+		result.StartLine, result.StartCol = lineColOfOffset(newContents, extent.Offset)
+		lastOffset := extent.Offset
+		if extent.Length > 0 {
+			_, size := utf8.DecodeLastRuneInString(newContents[:extent.OffsetPastEnd()])
+			lastOffset = extent.OffsetPastEnd() - size
+		}
+		result.EndLine, result.EndCol = lineColOfOffset(newContents, lastOffset)
+		return result, nil
+	default:
+		return nil, fmt.Errorf("Unknown selection type %T", sel)
+	}
+}
+
+// offsetOfLineCol returns the byte offset corresponding to the given 1-based
+// line and (byte) column in the given string.
+func offsetOfLineCol(s string, line, col int) (int, error) {
+	offset := 0
+	for l := 1; l < line; l++ {
+		idx := strings.IndexByte(s[offset:], '\n')
+		if idx < 0 {
+			return 0, fmt.Errorf("Invalid position: line %d, column %d (file contains %d lines)", line, col, l)
+		}
+		offset += idx + 1
+	}
+	end := len(s)
+	if idx := strings.IndexByte(s[offset:], '\n'); idx >= 0 {
+		end = offset + idx
+	}
+	if col < 1 || offset+col-1 > end {
+		return 0, fmt.Errorf("Invalid position: line %d, column %d", line, col)
+	}
+	return offset + col - 1, nil
+}
+
+// lineColOfOffset returns the 1-based line and (byte) column corresponding to
+// the given byte offset in the given string.
+func lineColOfOffset(s string, offset int) (int, int) {
+	line := 1 + strings.Count(s[:offset], "\n")
+	col := offset - strings.LastIndex(s[:offset], "\n")
+	return line, col
+}
+
 // NewSelection takes an input string of the form "line,col:line,col" or
 // "offset,length" and returns a Selection (either LineColSelection or
 // OffsetLengthSelection) corresponding to that selection in the given file.
@@ -262,6 +346,59 @@ func NewSelection(filename string, pos string) (Selection, error) {
 	return nil, fmt.Errorf("invalid -pos %s", pos)
 }
 
+// IsRegexpPos returns true if the given -pos argument selects text using a
+// regular expression (see NewRegexpSelections) rather than a line/column or
+// offset/length position.
+func IsRegexpPos(pos string) bool {
+	return strings.HasPrefix(pos, "/") && strings.LastIndex(pos, "/") > 0
+}
+
+// NewRegexpSelections takes an input string of the form "/regexp/" or
+// "/regexp/g" and returns an OffsetLengthSelection of the text matched by the
+// regular expression in the given file contents: the first match, or (with
+// the g suffix) every match, in order.  If the regular expression contains a
+// parenthesized subexpression, only the text matched by the first
+// subexpression is selected; for example, /func (\w+)\(/ selects the name
+// of the first function.  This allows scripts to select text without
+// computing positions.  It returns an error if there is no match.
+func NewRegexpSelections(filename string, contents []byte, pos string) ([]Selection, error) {
+	if !IsRegexpPos(pos) {
+		return nil, fmt.Errorf("invalid -pos %s", pos)
+	}
+	slash := strings.LastIndex(pos, "/")
+	n := 1
+	switch pos[slash+1:] {
+	case "":
+	case "g":
+		n = -1
+	default:
+		return nil, fmt.Errorf("invalid -pos %s (a regular expression "+
+			"may only be followed by g)", pos)
+	}
+	re, err := regexp.Compile(pos[1:slash])
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %s: %s",
+			pos[:slash+1], err)
+	}
+	result := []Selection{}
+	for _, match := range re.FindAllSubmatchIndex(contents, n) {
+		start, end := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		result = append(result, &OffsetLengthSelection{
+			Filename: filename,
+			Offset:   start,
+			Length:   end - start,
+		})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s does not match any text in %s",
+			pos[:slash+1], filename)
+	}
+	return result, nil
+}
+
 // parseLineCol parses a string consisting of two nonnegative integers (e.g.,
 // "302,6") and returns the two integer values, or returns (-1,-1) if the
 // input string does not have the correct format
@@ -248,3 +248,80 @@ func TestNewSelectionErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestNewRegexpSelections(t *testing.T) {
+	src := []byte("package main\nfunc f() { x := 1; x++ }\nfunc g() {}\n")
+	tests := []struct {
+		pos      string
+		expected []string // Selected text
+	}{
+		{"/x/", []string{"x"}},
+		{"/x/g", []string{"x", "x"}},
+		{`/func (\w+)\(/g`, []string{"f", "g"}},
+		{`/(x)?\+\+/`, []string{"x"}},
+		{`/a\/?i/`, []string{"ai"}},
+		{"/\\{\\}/", []string{"{}"}},
+	}
+	for _, test := range tests {
+		if !text.IsRegexpPos(test.pos) {
+			t.Fatalf("IsRegexpPos(%s) returned false", test.pos)
+		}
+		sels, err := text.NewRegexpSelections("main.go", src, test.pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := []string{}
+		for _, sel := range sels {
+			ol := sel.(*text.OffsetLengthSelection)
+			selected = append(selected, string(src[ol.Offset:ol.Offset+ol.Length]))
+		}
+		if !reflect.DeepEqual(selected, test.expected) {
+			t.Errorf("%s: expected %q; got %q", test.pos, test.expected, selected)
+		}
+	}
+
+	for _, pos := range []string{"1,2", "/", "/x", "/x/i", "/y/", "/(/"} {
+		if _, err := text.NewRegexpSelections("main.go", src, pos); err == nil {
+			t.Errorf("NewRegexpSelections should have failed for %s", pos)
+		}
+	}
+}
+
+func TestMapSelection(t *testing.T) {
+	// Rename fmt to format on line 4 and insert a line before it
+	es := text.NewEditSet()
+	es.Add(&text.Extent{Offset: 81, Length: 0}, "  // Print\n")
+	es.Add(&text.Extent{Offset: 83, Length: 3}, "format")
+	newFile, err := text.ApplyToString(es, file2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := es.Mapper()
+
+	tests := []struct {
+		sel      text.Selection
+		expected string
+	}{
+		{&text.LineColSelection{"main.go", 4, 3, 4, 5}, "main.go: 5,3:5,8"},
+		{&text.LineColSelection{"main.go", 4, 7, 4, 13}, "main.go: 5,10:5,16"},
+		{&text.LineColSelection{"main.go", 1, 1, 1, 1}, "main.go: 1,1:1,1"},
+		{&text.OffsetLengthSelection{"main.go", 83, 3}, "main.go: 94,6"},
+		{&text.OffsetLengthSelection{"main.go", 86, 1}, "main.go: 100,1"},
+	}
+	for _, test := range tests {
+		sel, err := text.MapSelection(test.sel, mapper, file2, newFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sel.String() != test.expected {
+			t.Fatalf("Mapping %s: expected %s, got %s",
+				test.sel, test.expected, sel)
+		}
+	}
+
+	_, err = text.MapSelection(&text.LineColSelection{"main.go", 9, 1, 9, 1},
+		mapper, file2, newFile)
+	if err == nil {
+		t.Fatalf("Mapping selection beyond end of file should fail")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains support for summarizing the size of a change, e.g., so a
+// user can be warned before applying a very large refactoring.
+
+package text
+
+import "fmt"
+
+// EditStats summarizes the size of a set of changes.
+//
+// An EditSet does not contain the text it replaces, so EditSet.Stats can only
+// count bytes; Patch.Stats and MultiPatch.Stats also count the lines inserted
+// and deleted, as they would appear in a unified diff.
+type EditStats struct {
+	Files        int // Number of files changed
+	Edits        int // Number of edits
+	BytesAdded   int // Number of bytes inserted
+	BytesRemoved int // Number of bytes deleted
+	Insertions   int // Number of lines inserted
+	Deletions    int // Number of lines deleted
+}
+
+// Stats returns the number of edits in this EditSet and the number of bytes
+// they add and remove.  An EditSet modifies a single file, so Files is 1 if
+// it contains any edits.
+func (e *EditSet) Stats() *EditStats {
+	result := &EditStats{}
+	for _, edit := range e.edits {
+		result.Edits++
+		result.BytesAdded += len(edit.replacement)
+		result.BytesRemoved += edit.Length
+	}
+	if result.Edits > 0 {
+		result.Files = 1
+	}
+	return result
+}
+
+// Stats returns the number of lines this patch inserts and deletes (as they
+// would appear in its unified diff), the number of bytes in those lines, and
+// the number of edits in its hunks.  It returns an error if the edits in a
+// hunk cannot be applied.
+func (p *Patch) Stats() (*EditStats, error) {
+	result := &EditStats{}
+	for _, h := range p.hunks {
+		origLines, newLines, err := computeLines(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range p.diffLines(origLines, newLines).edits {
+			if e.Length > 0 {
+				result.Deletions++
+				result.BytesRemoved += e.Length
+			} else if e.replacement != "" {
+				result.Insertions++
+				result.BytesAdded += len(e.replacement)
+			}
+		}
+		result.Edits += len(h.edits)
+	}
+	if result.Insertions > 0 || result.Deletions > 0 {
+		result.Files = 1
+	}
+	return result, nil
+}
+
+// Stats returns the total size of the changes in all of the patches in this
+// MultiPatch (see Patch.Stats).
+func (m *MultiPatch) Stats() (*EditStats, error) {
+	result := &EditStats{}
+	for _, p := range m.patches {
+		stats, err := p.Stats()
+		if err != nil {
+			return nil, err
+		}
+		result.Add(stats)
+	}
+	return result, nil
+}
+
+// Add adds the given counts to these counts.
+func (s *EditStats) Add(other *EditStats) {
+	s.Files += other.Files
+	s.Edits += other.Edits
+	s.BytesAdded += other.BytesAdded
+	s.BytesRemoved += other.BytesRemoved
+	s.Insertions += other.Insertions
+	s.Deletions += other.Deletions
+}
+
+// String returns a summary of these counts in the format used by git diff
+// --stat, e.g., "3 files changed, 120 insertions(+), 45 deletions(-)".  The
+// counts of insertions and deletions are omitted if they are zero.
+func (s *EditStats) String() string {
+	result := fmt.Sprintf("%d %s changed", s.Files,
+		plural(s.Files, "file", "files"))
+	if s.Insertions > 0 {
+		result += fmt.Sprintf(", %d %s(+)", s.Insertions,
+			plural(s.Insertions, "insertion", "insertions"))
+	}
+	if s.Deletions > 0 {
+		result += fmt.Sprintf(", %d %s(-)", s.Deletions,
+			plural(s.Deletions, "deletion", "deletions"))
+	}
+	return result
+}
+
+// plural returns singular if n is 1 and plural otherwise.
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditSetStats(t *testing.T) {
+	es := NewEditSet()
+	assertEquals("0 files changed", es.Stats().String(), t)
+	es.Add(&Extent{Offset: 0, Length: 3}, "abcde")
+	es.Add(&Extent{Offset: 5, Length: 2}, "")
+	expected := &EditStats{Files: 1, Edits: 2, BytesAdded: 5, BytesRemoved: 5}
+	if stats := es.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("Expected %#v; got %#v", expected, stats)
+	}
+}
+
+func TestPatchStats(t *testing.T) {
+	a := "a\nb\nc\nd\n"
+	b := "a\nB\nc\nx\ny\nd"
+	p, err := DiffStrings(a, b).CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := p.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("1 file changed, 4 insertions(+), 2 deletions(-)",
+		stats.String(), t)
+
+	mp := NewMultiPatch()
+	mp.Add("one", p)
+	mp.Add("two", p)
+	mp.Add("three", &Patch{})
+	total, err := mp.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals("2 files changed, 8 insertions(+), 4 deletions(-)",
+		total.String(), t)
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains a streaming variant of Diff, which compares two
+// io.Readers line by line while holding only a bounded number of lines from
+// each in memory.  It is intended for very large files (e.g., generated files
+// of hundreds of megabytes), where splitting both files into lines, as Diff
+// requires, would use too much memory.
+
+package text
+
+import (
+	"bufio"
+	"io"
+	"sort"
+)
+
+// DefaultDiffWindow is the number of lines DiffStreams reads ahead from each
+// reader when no window size is given.
+const DefaultDiffWindow = 4096
+
+// DiffStreams compares the contents of a and b line by line and calls emit
+// with each edit needed to change the contents of a into the contents of b,
+// in order by offset.  Like the edits in the EditSet returned by Diff, each
+// edit either deletes a single line or inserts a single line, and offsets are
+// relative to the contents of a.  If emit returns false, DiffStreams stops
+// and returns nil.
+//
+// At most window lines (DefaultDiffWindow if window < 2) of each reader are
+// held in memory at a time.  Lines common to both readers are skipped; when
+// they differ, the lines in the windows are compared (see Diff), the edits
+// for the first half of each window are emitted, and the windows are
+// refilled.  So the result always changes a into b, but it is minimal only if
+// the differences between a and b are no further apart than about half of
+// the window.  For example, a line moved a long distance may be reported as
+// a deletion and an insertion of many more lines than necessary.
+func DiffStreams(a, b io.Reader, window int, emit func(extent *Extent, replacement string) bool) error {
+	if window < 2 {
+		window = DefaultDiffWindow
+	}
+	s := &streamDiff{
+		a:      newStreamLines(a),
+		b:      newStreamLines(b),
+		window: window,
+	}
+	for {
+		if err := s.a.fill(window); err != nil {
+			return err
+		}
+		if err := s.b.fill(window); err != nil {
+			return err
+		}
+		if s.skipCommonPrefix() {
+			continue
+		}
+		if len(s.a.lines) == 0 && len(s.b.lines) == 0 {
+			return nil
+		}
+		if !s.compareWindows(emit) {
+			return nil
+		}
+	}
+}
+
+// DiffReadersWindowed returns an EditSet containing the edits DiffStreams
+// emits for a and b.  The EditSet holds only the edits, so unlike
+// DiffReaders, it does not need memory proportional to the size of a and b
+// unless they are very different.
+func DiffReadersWindowed(a, b io.Reader, window int) (*EditSet, error) {
+	result := NewEditSet()
+	err := DiffStreams(a, b, window, func(extent *Extent, replacement string) bool {
+		result.edits = append(result.edits, edit{extent, replacement})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// A streamDiff holds the state of DiffStreams: the windows of lines that have
+// been read from each reader but not yet compared, and the offset in a of the
+// first line in a's window.
+type streamDiff struct {
+	a, b   *streamLines
+	window int
+	offset int
+}
+
+// skipCommonPrefix removes the lines that begin both windows and are the same
+// in both, returning true if any were removed.
+func (s *streamDiff) skipCommonPrefix() bool {
+	n := 0
+	for n < len(s.a.lines) && n < len(s.b.lines) && s.a.lines[n] == s.b.lines[n] {
+		s.offset += len(s.a.lines[n])
+		n++
+	}
+	s.a.lines = s.a.lines[n:]
+	s.b.lines = s.b.lines[n:]
+	return n > 0
+}
+
+// compareWindows compares the lines in the two windows, calls emit with the
+// edits up to a cut point, and removes the lines before the cut point from
+// the windows.  If a reader has been read to the end, its entire window may
+// precede the cut point; otherwise, at most half of its window does, since
+// the lines that follow may change the result.  It returns false if emit
+// returned false.
+func (s *streamDiff) compareWindows(emit func(*Extent, string) bool) bool {
+	a, b := s.a.lines, s.b.lines
+	limitA, limitB := len(a), len(b)
+	if !s.a.eof {
+		limitA = s.window / 2
+	}
+	if !s.b.eof {
+		limitB = s.window / 2
+	}
+
+	d := &linearDiff{editScript: newEditScript(a, b)}
+	size := 2*(len(a)+len(b)+1) + 2
+	d.vf = make([]int, size)
+	d.vb = make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+
+	// i and j are the number of lines of a and b before the cut point
+	i, j, held := 0, 0, false
+	for _, e := range d.edits {
+		line := sort.SearchInts(d.offsets, e.Offset)
+		common := min(line-i, min(limitA-i, limitB-j))
+		i, j = i+common, j+common
+		if i < line || e.Length == 0 && j >= limitB ||
+			e.Length > 0 && i >= limitA {
+			held = true
+			break
+		}
+		if e.Length == 0 {
+			j++
+		} else {
+			i++
+		}
+		if !emit(&Extent{s.offset + e.Offset, e.Length}, e.replacement) {
+			return false
+		}
+	}
+	if !held {
+		// The remaining lines are common to both windows
+		common := min(limitA-i, limitB-j)
+		i, j = i+common, j+common
+	}
+
+	s.offset += d.offsets[i]
+	s.a.lines = a[i:]
+	s.b.lines = b[j:]
+	return true
+}
+
+// streamLines is a window of lines read from an io.Reader.
+type streamLines struct {
+	reader *bufio.Reader
+	lines  []string
+	eof    bool
+}
+
+func newStreamLines(r io.Reader) *streamLines {
+	return &streamLines{reader: bufio.NewReader(r)}
+}
+
+// fill reads lines until the window contains n lines or the end of the input
+// is reached.  Each line includes its terminating newline, except possibly
+// the last line of the input.
+func (s *streamLines) fill(n int) error {
+	for !s.eof && len(s.lines) < n {
+		line, err := s.reader.ReadString('\n')
+		if line != "" {
+			s.lines = append(s.lines, line)
+		}
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffStreams(t *testing.T) {
+	texts := []string{"", "\n", "a", "a\n", "a\nb", "a\nb\n", "b\n",
+		"a\n\nb\n", "x\na\nb\n"}
+	for _, a := range texts {
+		for _, b := range texts {
+			for _, window := range []int{0, 2, 3} {
+				edits, err := DiffReadersWindowed(strings.NewReader(a),
+					strings.NewReader(b), window)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := ApplyToString(edits, a)
+				if err != nil || result != b {
+					t.Fatalf("Diff %q -> %q with window %d produced %q (%v)",
+						a, b, window, result, err)
+				}
+				// (Diff replaces an empty string with a single edit)
+				if expected := len(DiffStrings(a, b).edits); window == 0 &&
+					a != "" && b != "" && len(edits.edits) != expected {
+					t.Fatalf("Diff %q -> %q has %d edits, not %d",
+						a, b, len(edits.edits), expected)
+				}
+			}
+		}
+	}
+}
+
+func TestDiffStreamsRandom(t *testing.T) {
+	seed := time.Now().Unix()
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < 100; i++ {
+		s1 := strings.Join(makeLines(r.Intn(100), r), "")
+		s2 := strings.Join(makeLines(r.Intn(100), r), "")
+		edits, err := DiffReadersWindowed(strings.NewReader(s1),
+			strings.NewReader(s2), 2+r.Intn(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ApplyToString(edits, s1)
+		if err != nil || result != s2 {
+			t.Fatalf("Streaming diff failed - seed %d, iteration %d",
+				seed, i)
+		}
+	}
+}
+
+// TestDiffStreamsLarge checks that a small window finds a minimal diff when
+// the changes are far apart, as they are in regenerated files.
+func TestDiffStreamsLarge(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 50000; i++ {
+		a = append(a, fmt.Sprintf("line %d\n", i))
+		switch i % 1000 {
+		case 0:
+			b = append(b, fmt.Sprintf("changed %d\n", i))
+		case 500:
+			b = append(b, fmt.Sprintf("line %d\n", i), "inserted\n")
+		case 700:
+		default:
+			b = append(b, a[i])
+		}
+	}
+	edits, err := DiffReadersWindowed(strings.NewReader(strings.Join(a, "")),
+		strings.NewReader(strings.Join(b, "")), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := len(Diff(a, b).edits); len(edits.edits) != expected {
+		t.Fatalf("Expected %d edits; got %d", expected, len(edits.edits))
+	}
+	result, err := ApplyToString(edits, strings.Join(a, ""))
+	if err != nil || result != strings.Join(b, "") {
+		t.Fatalf("Large streaming diff failed")
+	}
+
+	// DiffStreams stops when emit returns false
+	n := 0
+	err = DiffStreams(strings.NewReader(strings.Join(a, "")),
+		strings.NewReader(strings.Join(b, "")), 64,
+		func(*Extent, string) bool {
+			n++
+			return n < 3
+		})
+	if err != nil || n != 3 {
+		t.Fatalf("Expected DiffStreams to stop after 3 edits; got %d (%v)", n, err)
+	}
+}